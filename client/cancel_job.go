@@ -0,0 +1,30 @@
+package chclient
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/cloudradar-monitoring/rport/share/comm"
+)
+
+// jobCanceledErr is the error of a job canceled by the server
+const jobCanceledErr = "cancelled by user"
+
+// HandleCancelJobRequest kills a running command of a job together with its child processes.
+func (c *Client) HandleCancelJobRequest(reqPayload []byte) error {
+	req := &comm.CancelJobRequest{}
+	if err := json.Unmarshal(reqPayload, req); err != nil {
+		return fmt.Errorf("failed to decode cancel job request: %s", err)
+	}
+
+	// only commands started by the client can be killed
+	if !c.markCmdPIDCanceled(req.PID) {
+		return fmt.Errorf("no running command with pid %d", req.PID)
+	}
+
+	c.Infof("Canceling command[jid=%q,pid=%d]", req.JID, req.PID)
+	if err := killProcessGroup(req.PID); err != nil {
+		return fmt.Errorf("failed to kill command with pid %d: %v", req.PID, err)
+	}
+	return nil
+}
@@ -0,0 +1,16 @@
+//+build !windows
+
+package chclient
+
+import (
+	"syscall"
+)
+
+// killProcessGroup kills a process group of a command started in its own group, otherwise the process only.
+func killProcessGroup(pid int) error {
+	err := syscall.Kill(-pid, syscall.SIGKILL)
+	if err == syscall.ESRCH {
+		return syscall.Kill(pid, syscall.SIGKILL)
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+//+build !windows
+
+package chclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/rport/share/comm"
+	"github.com/cloudradar-monitoring/rport/share/models"
+	"github.com/cloudradar-monitoring/rport/share/test"
+)
+
+func TestHandleCancelJobRequest(t *testing.T) {
+	connMock := test.NewConnMock()
+	done := make(chan bool)
+	connMock.DoneChannel = done
+
+	config := getDefaultValidMinConfig()
+	config.Client.DataDir = filepath.Join(config.Client.DataDir, "TestHandleCancelJobRequest")
+	defer os.RemoveAll(config.Client.DataDir)
+	require.NoError(t, PrepareDirs(&config))
+
+	c := Client{
+		cmdExec:    NewCmdExecutor(testLog),
+		sshConn:    connMock,
+		Logger:     testLog,
+		config:     &config,
+		systemInfo: &mockSystemInfo{ReturnHostname: "test-host"},
+	}
+	job := models.Job{
+		JobSummary: models.JobSummary{JID: "5f02b216-3f8a-42be-b66c-f4c1d0ea3809"},
+		// the child process is killed together with the shell
+		Command:    "/usr/bin/sleep 60; /usr/bin/sleep 60",
+		TimeoutSec: 60,
+	}
+	payload, err := json.Marshal(job)
+	require.NoError(t, err)
+
+	res, err := c.HandleRunCmdRequest(context.Background(), payload)
+	require.NoError(t, err)
+
+	cancelPayload := func(pid int) []byte {
+		b, err := json.Marshal(comm.CancelJobRequest{JID: job.JID, PID: pid})
+		require.NoError(t, err)
+		return b
+	}
+
+	err = c.HandleCancelJobRequest(cancelPayload(res.Pid + 1))
+	assert.EqualError(t, err, fmt.Sprintf("no running command with pid %d", res.Pid+1))
+
+	err = c.HandleCancelJobRequest(cancelPayload(res.Pid))
+	require.NoError(t, err)
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("canceled command result is not sent")
+	}
+	_, _, resultPayload := connMock.InputSendRequest()
+	gotJob := models.Job{}
+	require.NoError(t, json.Unmarshal(resultPayload, &gotJob))
+	assert.Equal(t, models.JobStatusFailed, gotJob.Status)
+	assert.Equal(t, "cancelled by user", gotJob.Error)
+	assert.Empty(t, c.getCmdPIDs())
+}
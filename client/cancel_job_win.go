@@ -0,0 +1,18 @@
+//+build windows
+
+package chclient
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+)
+
+// killProcessGroup kills a process together with its child processes.
+func killProcessGroup(pid int) error {
+	out, err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(pid)).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, out)
+	}
+	return nil
+}
@@ -2,15 +2,17 @@ package chclient
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -19,6 +21,7 @@ import (
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/net/proxy"
 
+	"github.com/cloudradar-monitoring/rport/client/health"
 	"github.com/cloudradar-monitoring/rport/client/updates"
 	chshare "github.com/cloudradar-monitoring/rport/share"
 	"github.com/cloudradar-monitoring/rport/share/comm"
@@ -30,18 +33,37 @@ const UnknownValue = "unknown"
 type Client struct {
 	*chshare.Logger
 
-	config         *Config
-	sshConfig      *ssh.ClientConfig
-	sshConn        ssh.Conn
-	running        bool
-	runningc       chan error
-	connStats      chshare.ConnStats
-	cmdExec        CmdExecutor
-	curCmdPID      *int
-	curCmdPIDMutex sync.Mutex
-	systemInfo     SystemInfo
-	runCmdMutex    sync.Mutex
-	updates        *updates.Updates
+	config       *Config
+	sshConfig    *ssh.ClientConfig
+	sshConn      ssh.Conn
+	sshConnMtx   sync.RWMutex
+	running      bool
+	runningc     chan error
+	connStats    chshare.ConnStats
+	cmdExec      CmdExecutor
+	cmdPIDs      map[int]bool
+	canceledPIDs map[int]bool
+	cmdPIDsMutex sync.Mutex
+	systemInfo   SystemInfo
+	cmdSlots     chan struct{}
+	cmdSlotsOnce sync.Once
+	tagsMutex    sync.Mutex
+	updates      *updates.Updates
+	health       *health.Health
+	// cmdLogger is set if executed commands are recorded in the system log
+	cmdLogger cmdLogger
+	// cmdOutputs are outputs of running commands by job IDs
+	cmdOutputs      map[string]*cmdOutput
+	cmdOutputsMutex sync.Mutex
+	// signedJobs are IDs of accepted signed jobs until their signature expires, so they can't be replayed
+	signedJobs      map[string]time.Time
+	signedJobsMutex sync.Mutex
+	// keepAlive is a keepalive interval, it can be changed by a config pushed by the server
+	keepAlive     int64
+	keepAliveOnce sync.Once
+	// reconnectTarget is a server the client was asked to connect to on the next connection attempt
+	reconnectTarget    string
+	reconnectTargetMtx sync.Mutex
 }
 
 //NewClient creates a new client instance
@@ -55,7 +77,8 @@ func NewClient(config *Config) *Client {
 		runningc:   make(chan error, 1),
 		cmdExec:    cmdExec,
 		systemInfo: NewSystemInfo(cmdExec),
-		updates:    updates.New(logger, config.Client.UpdatesInterval),
+		updates:    updates.New(logger, config.Client.UpdatesInterval, config.Client.UpdatesCacheTTL),
+		health:     health.New(logger, config.Health),
 	}
 
 	client.sshConfig = &ssh.ClientConfig{
@@ -91,38 +114,96 @@ func (c *Client) verifyServer(hostname string, remote net.Addr, key ssh.PublicKe
 
 //Start client and does not block
 func (c *Client) Start(ctx context.Context) error {
+	if err := c.loadSavedTags(); err != nil {
+		return err
+	}
 
-	//optional keepalive loop
-	if c.config.Connection.KeepAlive > 0 {
-		go c.keepAliveLoop()
+	if c.config.RemoteCommands.Syslog {
+		cmdLogger, err := newCmdLogger()
+		if err != nil {
+			return fmt.Errorf("could not open the system log for commands: %v", err)
+		}
+		c.cmdLogger = cmdLogger
 	}
+
+	//optional keepalive loop
+	c.setKeepAlive(c.config.Connection.KeepAlive)
 	//connection loop
 	go c.connectionLoop(ctx)
 
 	c.updates.Start(ctx)
+	c.health.Start(ctx)
 
 	return nil
 }
 
+func (c *Client) getSSHConn() ssh.Conn {
+	c.sshConnMtx.RLock()
+	defer c.sshConnMtx.RUnlock()
+	return c.sshConn
+}
+
+func (c *Client) setSSHConn(conn ssh.Conn) {
+	c.sshConnMtx.Lock()
+	defer c.sshConnMtx.Unlock()
+	c.sshConn = conn
+}
+
+// keepAliveLoop pings the server every keepalive interval. If keepalive timeout is set and the server didn't reply
+// to any ping within it, the connection is closed to let the connection loop reconnect.
 func (c *Client) keepAliveLoop() {
+	var conn ssh.Conn
+	var lastReply int64
 	for c.running {
-		time.Sleep(c.config.Connection.KeepAlive)
-		if c.sshConn != nil {
-			_, _, _ = c.sshConn.SendRequest(comm.RequestTypePing, true, nil)
+		time.Sleep(c.getKeepAlive())
+		curConn := c.getSSHConn()
+		if curConn == nil {
+			continue
+		}
+		if curConn != conn {
+			// new connection, start counting from now
+			conn = curConn
+			atomic.StoreInt64(&lastReply, time.Now().UnixNano())
 		}
+
+		timeout := c.config.Connection.KeepAliveTimeout
+		sinceReply := time.Since(time.Unix(0, atomic.LoadInt64(&lastReply)))
+		if timeout > 0 && sinceReply > timeout {
+			c.Errorf("No keepalive response from server for %s, closing the connection", sinceReply.Round(time.Millisecond))
+			_ = conn.Close()
+			continue
+		}
+
+		// send a ping without blocking the loop, so unanswered pings don't delay the next ones
+		go func(conn ssh.Conn, sentAt time.Time) {
+			payload := []byte(strconv.FormatInt(sentAt.UnixNano(), 10))
+			ok, _, err := conn.SendRequest(comm.RequestTypePing, true, payload)
+			if err != nil || !ok {
+				return
+			}
+			c.Debugf("Keepalive response received in %s", time.Since(sentAt))
+			atomic.StoreInt64(&lastReply, time.Now().UnixNano())
+		}(conn, time.Now())
 	}
 }
 
 func (c *Client) connectionLoop(ctx context.Context) {
 	//connection loop!
 	var connerr error
+	// connected is true once the client connected to a server at least once
+	connected := false
 	switchbackChan := make(chan *sshClientConn, 1)
 	b := &backoff.Backoff{Max: c.config.Connection.MaxRetryInterval}
 	for c.running {
 		if connerr != nil {
+			if !connected && c.config.Connection.FailFastInitial {
+				c.runningc <- fmt.Errorf("initial connection failed, check the server url and credentials: %v", connerr)
+				break
+			}
 			attempt := int(b.Attempt())
 			d := b.Duration()
-			c.showConnectionError(connerr, attempt)
+			c.showConnectionError(connerr, attempt, !connected)
+			c.checkReconnectAlert(attempt+1, connerr)
 			//give up?
 			if c.config.Connection.MaxRetryCount >= 0 && attempt >= c.config.Connection.MaxRetryCount {
 				break
@@ -140,6 +221,16 @@ func (c *Client) connectionLoop(ctx context.Context) {
 			isPrimary = true
 		default:
 			var err error
+			if target := c.popReconnectTarget(); target != "" {
+				sshConn, err = c.connect(target)
+				if err != nil {
+					c.Errorf("Failed to connect to %s requested by server: %v", target, err)
+				}
+				isPrimary = target == c.config.Client.Server
+			}
+			if sshConn != nil {
+				break
+			}
 			sshConn, isPrimary, err = c.connectToMainOrFallback()
 			if err != nil {
 				if _, ok := err.(retryableError); ok {
@@ -183,16 +274,19 @@ func (c *Client) connectionLoop(ctx context.Context) {
 		}
 
 		b.Reset()
+		connected = true
 
-		c.sshConn = sshConn.Connection
+		c.setSSHConn(sshConn.Connection)
 		c.updates.SetConn(sshConn.Connection)
+		c.health.SetConn(sshConn.Connection)
 		go c.handleSSHRequests(ctx, sshConn.Requests)
 		go c.connectStreams(sshConn.Channels)
 
 		err = sshConn.Connection.Wait()
 		//disconnected
-		c.sshConn = nil
+		c.setSSHConn(nil)
 		c.updates.SetConn(nil)
+		c.health.SetConn(nil)
 		cancelSwitchback()
 
 		// use of closed network connection happens when switchback closes the connection, ignore the error
@@ -317,13 +411,15 @@ func (c *Client) sendConnectionRequest(ctx context.Context, sshConn ssh.Conn) er
 
 		return errors.New(msg)
 	}
-	var remotes []*chshare.Remote
-	err = json.Unmarshal(respBytes, &remotes)
+	resp, err := chshare.DecodeConnectionResponse(respBytes)
 	if err != nil {
 		return fmt.Errorf("can't decode reply payload: %s", err)
 	}
 	c.Infof("Connected (Latency %s)", time.Since(t0))
-	for _, r := range remotes {
+	if len(resp.Config) > 0 {
+		c.applyPushedConfig(resp.Config)
+	}
+	for _, r := range resp.Remotes {
 		c.Infof("new tunnel: %s", r.String())
 	}
 
@@ -339,8 +435,20 @@ func (c *Client) handleSSHRequests(ctx context.Context, reqs <-chan *ssh.Request
 			resp, err = checkPort(r.Payload)
 		case comm.RequestTypeRunCmd:
 			resp, err = c.HandleRunCmdRequest(ctx, r.Payload)
+		case comm.RequestTypeValidateCmd:
+			resp, err = c.HandleValidateCmdRequest(r.Payload)
 		case comm.RequestTypeRefreshUpdatesStatus:
-			c.updates.Refresh()
+			err = c.HandleRefreshUpdatesStatusRequest(r.Payload)
+		case comm.RequestTypeUpdateTags:
+			resp, err = c.HandleUpdateTagsRequest(r.Payload)
+		case comm.RequestTypeInstallUpdates:
+			resp, err = c.HandleInstallUpdatesRequest(ctx, r.Payload)
+		case comm.RequestTypeCancelJob:
+			err = c.HandleCancelJobRequest(r.Payload)
+		case comm.RequestTypeStreamCmdOutput:
+			err = c.HandleStreamCmdOutputRequest(r.Payload)
+		case comm.RequestTypeReconnect:
+			err = c.HandleReconnectRequest(r.Payload)
 		default:
 			c.Debugf("Unknown request: %q", r.Type)
 			comm.ReplyError(c.Logger, r, errors.New("unknown request"))
@@ -354,6 +462,10 @@ func (c *Client) handleSSHRequests(ctx context.Context, reqs <-chan *ssh.Request
 		}
 
 		comm.ReplySuccessJSON(c.Logger, r, resp)
+
+		if r.Type == comm.RequestTypeReconnect {
+			c.closeForReconnect()
+		}
 	}
 }
 
@@ -374,10 +486,13 @@ func checkPort(payload []byte) (*comm.CheckPortResponse, error) {
 	}, nil
 }
 
-func (c *Client) showConnectionError(connerr error, attempt int) {
+func (c *Client) showConnectionError(connerr error, attempt int, initial bool) {
 	maxAttempt := c.config.Connection.MaxRetryCount
 	//show error and attempt counts
 	msg := fmt.Sprintf("Connection error: %s", connerr)
+	if initial {
+		msg = fmt.Sprintf("Initial connection error, check the server url and credentials: %s", connerr)
+	}
 	if attempt > 0 {
 		msg += fmt.Sprintf(" (Attempt: %d", attempt)
 		if maxAttempt > 0 {
@@ -397,23 +512,21 @@ func (c *Client) Wait() error {
 //Close manually stops the client
 func (c *Client) Close() error {
 	c.running = false
-	if c.sshConn == nil {
+	conn := c.getSSHConn()
+	if conn == nil {
 		return nil
 	}
-	return c.sshConn.Close()
+	return conn.Close()
 }
 
 func (c *Client) connectStreams(chans <-chan ssh.NewChannel) {
 	for ch := range chans {
-		remote := string(ch.ExtraData())
-		stream, reqs, err := ch.Accept()
-		if err != nil {
-			c.Debugf("Failed to accept stream: %s", err)
+		l := c.Logger.Fork("conn#%d", c.connStats.New())
+		if ch.ChannelType() == chshare.UDPChannelType {
+			go chshare.HandleUDPChannel(l, &c.connStats, ch)
 			continue
 		}
-		go ssh.DiscardRequests(reqs)
-		l := c.Logger.Fork("conn#%d", c.connStats.New())
-		go chshare.HandleTCPStream(l, &c.connStats, stream, remote)
+		go chshare.HandleTCPChannel(l, &c.connStats, ch)
 	}
 }
 
@@ -446,16 +559,79 @@ func (c *Client) localIPAddresses() ([]string, []string, error) {
 	return ipv4, ipv6, nil
 }
 
-func (c *Client) getCurCmdPID() *int {
-	c.curCmdPIDMutex.Lock()
-	defer c.curCmdPIDMutex.Unlock()
-	return c.curCmdPID
+// getCmdPIDs returns sorted PIDs of commands that are observed.
+func (c *Client) getCmdPIDs() []int {
+	c.cmdPIDsMutex.Lock()
+	defer c.cmdPIDsMutex.Unlock()
+	res := make([]int, 0, len(c.cmdPIDs))
+	for pid := range c.cmdPIDs {
+		res = append(res, pid)
+	}
+	sort.Ints(res)
+	return res
 }
 
-func (c *Client) setCurCmdPID(pid *int) {
-	c.curCmdPIDMutex.Lock()
-	defer c.curCmdPIDMutex.Unlock()
-	c.curCmdPID = pid
+func (c *Client) addCmdPID(pid int) {
+	c.cmdPIDsMutex.Lock()
+	defer c.cmdPIDsMutex.Unlock()
+	if c.cmdPIDs == nil {
+		c.cmdPIDs = make(map[int]bool)
+	}
+	c.cmdPIDs[pid] = true
+}
+
+func (c *Client) removeCmdPID(pid int) {
+	c.cmdPIDsMutex.Lock()
+	defer c.cmdPIDsMutex.Unlock()
+	delete(c.cmdPIDs, pid)
+	delete(c.canceledPIDs, pid)
+}
+
+// markCmdPIDCanceled marks a running command as canceled, it returns false if no command is running with a given PID.
+func (c *Client) markCmdPIDCanceled(pid int) bool {
+	c.cmdPIDsMutex.Lock()
+	defer c.cmdPIDsMutex.Unlock()
+	if !c.cmdPIDs[pid] {
+		return false
+	}
+	if c.canceledPIDs == nil {
+		c.canceledPIDs = make(map[int]bool)
+	}
+	c.canceledPIDs[pid] = true
+	return true
+}
+
+func (c *Client) isCmdPIDCanceled(pid int) bool {
+	c.cmdPIDsMutex.Lock()
+	defer c.cmdPIDsMutex.Unlock()
+	return c.canceledPIDs[pid]
+}
+
+func (c *Client) getCmdSlots() chan struct{} {
+	c.cmdSlotsOnce.Do(func() {
+		c.cmdSlots = make(chan struct{}, c.config.RemoteCommands.GetMaxConcurrent())
+	})
+	return c.cmdSlots
+}
+
+// acquireCmdSlot takes a slot to run a command. If no slot is free it waits if wait is true, otherwise it returns false.
+func (c *Client) acquireCmdSlot(wait bool) bool {
+	slots := c.getCmdSlots()
+	select {
+	case slots <- struct{}{}:
+		return true
+	default:
+	}
+	if !wait {
+		return false
+	}
+	c.Debugf("Waiting for a running command to finish, running PIDs: %v", c.getCmdPIDs())
+	slots <- struct{}{}
+	return true
+}
+
+func (c *Client) releaseCmdSlot() {
+	<-c.getCmdSlots()
 }
 
 func (c *Client) connectionRequest(ctx context.Context) *chshare.ConnectionRequest {
@@ -465,7 +641,11 @@ func (c *Client) connectionRequest(ctx context.Context) *chshare.ConnectionReque
 	connReq := &chshare.ConnectionRequest{
 		ID:                     c.config.Client.ID,
 		Name:                   c.config.Client.Name,
-		Tags:                   c.config.Client.Tags,
+		Tags:                   c.getTags(),
+		Environment:            c.config.Client.Environment,
+		CommandsDisabled:       !c.config.RemoteCommands.Enabled,
+		AcceptsPushedConfig:    true,
+		AcceptsUDPTunnels:      true,
 		Remotes:                c.config.Client.remotes,
 		OS:                     UnknownValue,
 		OSArch:                 c.systemInfo.GoArch(),
@@ -488,6 +668,9 @@ func (c *Client) connectionRequest(ctx context.Context) *chshare.ConnectionReque
 	} else {
 		connReq.OSKernel = info.OS
 		connReq.OSFamily = info.PlatformFamily
+		if info.BootTime > 0 {
+			connReq.BootTime = time.Unix(int64(info.BootTime), 0).UTC()
+		}
 	}
 
 	os, err := c.getOS(ctx, info)
@@ -544,6 +727,8 @@ func (c *Client) connectionRequest(ctx context.Context) *chshare.ConnectionReque
 	}
 
 	connReq.Timezone = c.getTimezone()
+	connReq.PackageManager = c.systemInfo.PackageManager(ctx)
+	connReq.Interpreters = c.systemInfo.Interpreters()
 
 	return connReq
 }
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -22,6 +23,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	chshare "github.com/cloudradar-monitoring/rport/share"
+	"github.com/cloudradar-monitoring/rport/share/comm"
 )
 
 func TestCustomHeaders(t *testing.T) {
@@ -82,6 +84,9 @@ func TestConnectionRequest(t *testing.T) {
 			Tags:    []string{"tag1", "tag2"},
 			remotes: []*chshare.Remote{remote1, remote2},
 		},
+		RemoteCommands: CommandsConfig{
+			Enabled: true,
+		},
 	}
 	interfaceAddrs := []net.Addr{
 		&net.IPAddr{
@@ -116,6 +121,7 @@ func TestConnectionRequest(t *testing.T) {
 					PlatformVersion:      "18.04",
 					VirtualizationSystem: "KVM",
 					VirtualizationRole:   "guest",
+					BootTime:             1609459200,
 				},
 				ReturnInterfaceAddrs: interfaceAddrs,
 				ReturnGoArch:         "test-arch",
@@ -133,7 +139,9 @@ func TestConnectionRequest(t *testing.T) {
 				ReturnMemoryStat: &mem.VirtualMemoryStat{
 					Total: 100000,
 				},
-				ReturnSystemTime: time.Date(2001, 1, 1, 1, 0, 0, 0, time.UTC),
+				ReturnSystemTime:     time.Date(2001, 1, 1, 1, 0, 0, 0, time.UTC),
+				ReturnPackageManager: "apt",
+				ReturnInterpreters:   []string{"tacoscript"},
 			},
 			ExpectedConnectionRequest: &chshare.ConnectionRequest{
 				NumCPUs:                4,
@@ -158,6 +166,11 @@ func TestConnectionRequest(t *testing.T) {
 				IPv4:                   []string{"192.0.2.1", "192.0.2.2"},
 				IPv6:                   []string{"2001:db8::1", "2001:db8::2"},
 				Tags:                   []string{"tag1", "tag2"},
+				PackageManager:         "apt",
+				Interpreters:           []string{"tacoscript"},
+				BootTime:               time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+				AcceptsPushedConfig:    true,
+				AcceptsUDPTunnels:      true,
 				Remotes:                []*chshare.Remote{remote1, remote2},
 			},
 		}, {
@@ -187,26 +200,28 @@ func TestConnectionRequest(t *testing.T) {
 				ReturnSystemTime: time.Date(2001, 1, 1, 1, 0, 0, 0, time.UTC),
 			},
 			ExpectedConnectionRequest: &chshare.ConnectionRequest{
-				Version:      "0.0.0-src",
-				ID:           "test-client-id",
-				Name:         "test-name",
-				Tags:         []string{"tag1", "tag2"},
-				Remotes:      []*chshare.Remote{remote1, remote2},
-				OS:           "test-platform 123 test-family",
-				OSArch:       "test-arch",
-				OSFamily:     "test-family",
-				OSKernel:     "windows",
-				Hostname:     "test-hostname",
-				OSFullName:   "Test-Platform 123",
-				OSVersion:    "123",
-				CPUFamily:    "cpufam1",
-				CPUModel:     "cpumod1",
-				CPUModelName: "cpumod_name1",
-				CPUVendor:    "GenuineIntel",
-				Timezone:     "UTC (UTC+00:00)",
-				NumCPUs:      2,
-				IPv4:         []string{"192.0.2.1", "192.0.2.2"},
-				IPv6:         []string{"2001:db8::1", "2001:db8::2"},
+				Version:             "0.0.0-src",
+				ID:                  "test-client-id",
+				Name:                "test-name",
+				Tags:                []string{"tag1", "tag2"},
+				AcceptsPushedConfig: true,
+				AcceptsUDPTunnels:   true,
+				Remotes:             []*chshare.Remote{remote1, remote2},
+				OS:                  "test-platform 123 test-family",
+				OSArch:              "test-arch",
+				OSFamily:            "test-family",
+				OSKernel:            "windows",
+				Hostname:            "test-hostname",
+				OSFullName:          "Test-Platform 123",
+				OSVersion:           "123",
+				CPUFamily:           "cpufam1",
+				CPUModel:            "cpumod1",
+				CPUModelName:        "cpumod_name1",
+				CPUVendor:           "GenuineIntel",
+				Timezone:            "UTC (UTC+00:00)",
+				NumCPUs:             2,
+				IPv4:                []string{"192.0.2.1", "192.0.2.2"},
+				IPv6:                []string{"2001:db8::1", "2001:db8::2"},
 			},
 		}, {
 			Name: "all errors",
@@ -220,25 +235,27 @@ func TestConnectionRequest(t *testing.T) {
 				ReturnMemoryError:         errors.New("test error"),
 			},
 			ExpectedConnectionRequest: &chshare.ConnectionRequest{
-				Version:      "0.0.0-src",
-				ID:           "test-client-id",
-				Name:         "test-name",
-				Tags:         []string{"tag1", "tag2"},
-				Remotes:      []*chshare.Remote{remote1, remote2},
-				OS:           UnknownValue,
-				OSArch:       "test-arch",
-				OSFamily:     UnknownValue,
-				OSKernel:     UnknownValue,
-				Hostname:     UnknownValue,
-				CPUFamily:    UnknownValue,
-				CPUModel:     UnknownValue,
-				CPUModelName: UnknownValue,
-				CPUVendor:    UnknownValue,
-				OSFullName:   UnknownValue,
-				OSVersion:    UnknownValue,
-				Timezone:     "UTC (UTC+00:00)",
-				IPv4:         nil,
-				IPv6:         nil,
+				Version:             "0.0.0-src",
+				ID:                  "test-client-id",
+				Name:                "test-name",
+				Tags:                []string{"tag1", "tag2"},
+				AcceptsPushedConfig: true,
+				AcceptsUDPTunnels:   true,
+				Remotes:             []*chshare.Remote{remote1, remote2},
+				OS:                  UnknownValue,
+				OSArch:              "test-arch",
+				OSFamily:            UnknownValue,
+				OSKernel:            UnknownValue,
+				Hostname:            UnknownValue,
+				CPUFamily:           UnknownValue,
+				CPUModel:            UnknownValue,
+				CPUModelName:        UnknownValue,
+				CPUVendor:           UnknownValue,
+				OSFullName:          UnknownValue,
+				OSVersion:           UnknownValue,
+				Timezone:            "UTC (UTC+00:00)",
+				IPv4:                nil,
+				IPv6:                nil,
 			},
 		}, {
 			Name: "uname error",
@@ -256,25 +273,27 @@ func TestConnectionRequest(t *testing.T) {
 				ReturnSystemTime:     time.Date(2001, 1, 1, 1, 0, 0, 0, time.UTC),
 			},
 			ExpectedConnectionRequest: &chshare.ConnectionRequest{
-				Version:      "0.0.0-src",
-				ID:           "test-client-id",
-				Name:         "test-name",
-				OSVersion:    "123",
-				OSFullName:   "Test-Platform 123",
-				Tags:         []string{"tag1", "tag2"},
-				Remotes:      []*chshare.Remote{remote1, remote2},
-				OS:           UnknownValue,
-				OSArch:       "test-arch",
-				OSFamily:     "test-family",
-				OSKernel:     "test-os",
-				Hostname:     "test-hostname",
-				Timezone:     "UTC (UTC+00:00)",
-				CPUFamily:    UnknownValue,
-				CPUModel:     UnknownValue,
-				CPUModelName: UnknownValue,
-				CPUVendor:    UnknownValue,
-				IPv4:         []string{"192.0.2.1", "192.0.2.2"},
-				IPv6:         []string{"2001:db8::1", "2001:db8::2"},
+				Version:             "0.0.0-src",
+				ID:                  "test-client-id",
+				Name:                "test-name",
+				OSVersion:           "123",
+				OSFullName:          "Test-Platform 123",
+				Tags:                []string{"tag1", "tag2"},
+				AcceptsPushedConfig: true,
+				AcceptsUDPTunnels:   true,
+				Remotes:             []*chshare.Remote{remote1, remote2},
+				OS:                  UnknownValue,
+				OSArch:              "test-arch",
+				OSFamily:            "test-family",
+				OSKernel:            "test-os",
+				Hostname:            "test-hostname",
+				Timezone:            "UTC (UTC+00:00)",
+				CPUFamily:           UnknownValue,
+				CPUModel:            UnknownValue,
+				CPUModelName:        UnknownValue,
+				CPUVendor:           UnknownValue,
+				IPv4:                []string{"192.0.2.1", "192.0.2.2"},
+				IPv6:                []string{"2001:db8::1", "2001:db8::2"},
 			},
 		},
 	}
@@ -300,6 +319,8 @@ type mockServer struct {
 	mtx           sync.Mutex
 	isUnavailable bool
 	isConnected   bool
+	ignorePings   bool
+	connCount     int
 	sshConn       ssh.Conn
 }
 
@@ -358,8 +379,11 @@ func (m *mockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	m.mtx.Lock()
 	m.isConnected = true
+	m.connCount++
 	m.mtx.Unlock()
 
+	go m.handleRequests(reqs)
+
 	defer func() {
 		m.mtx.Lock()
 		defer m.mtx.Unlock()
@@ -374,6 +398,33 @@ func (m *mockServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func (m *mockServer) handleRequests(reqs <-chan *ssh.Request) {
+	for req := range reqs {
+		if req.Type != comm.RequestTypePing {
+			_ = req.Reply(false, nil)
+			continue
+		}
+		m.mtx.Lock()
+		ignorePings := m.ignorePings
+		m.mtx.Unlock()
+		if !ignorePings {
+			_ = req.Reply(true, req.Payload)
+		}
+	}
+}
+
+func (m *mockServer) SetIgnorePings(ignore bool) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	m.ignorePings = ignore
+}
+
+func (m *mockServer) ConnCount() int {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	return m.connCount
+}
+
 func (m *mockServer) IsConnected() bool {
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
@@ -396,6 +447,27 @@ func (m *mockServer) SetAvailable(isAvailable bool) {
 	m.isUnavailable = !isAvailable
 }
 
+// SendRequest sends a request to a connected client and returns whether the client replied ok and its reply payload.
+func (m *mockServer) SendRequest(name string, payload []byte) (bool, []byte, error) {
+	m.mtx.Lock()
+	conn := m.sshConn
+	m.mtx.Unlock()
+	if conn == nil {
+		return false, nil, errors.New("client is not connected")
+	}
+	return conn.SendRequest(name, true, payload)
+}
+
+func (m *mockServer) WaitForConnCount(count int) error {
+	for i := 0; i < 300; i++ {
+		if m.ConnCount() >= count {
+			return nil
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return fmt.Errorf("timeout waiting for %d connections, actual: %d", count, m.ConnCount())
+}
+
 func (m *mockServer) CloseConnection() {
 	m.mtx.Lock()
 	defer m.mtx.Unlock()
@@ -467,3 +539,182 @@ func TestConnectionLoop(t *testing.T) {
 	assert.NoError(t, mainServer.WaitForStatus(true))
 	assert.NoError(t, fallbackServer.WaitForStatus(false))
 }
+
+func TestConnectionLoopReconnectRequest(t *testing.T) {
+	mainServer, err := newMockServer()
+	require.NoError(t, err)
+	tsMain := httptest.NewServer(mainServer)
+	defer tsMain.Close()
+
+	altServer, err := newMockServer()
+	require.NoError(t, err)
+	tsAlt := httptest.NewServer(altServer)
+	defer tsAlt.Close()
+
+	config := Config{
+		Client: ClientConfig{
+			Server:                   tsMain.URL,
+			FallbackServers:          []string{tsAlt.URL},
+			ServerSwitchbackInterval: 500 * time.Millisecond,
+			DataDir:                  "./",
+		},
+		RemoteCommands: CommandsConfig{
+			Order: allowDenyOrder,
+		},
+		Logging: LogConfig{
+			LogOutput: chshare.NewLogOutput(""),
+		},
+		Connection: ConnectionConfig{
+			MaxRetryCount: -1,
+		},
+	}
+	require.NoError(t, config.ParseAndValidate(true))
+
+	c := NewClient(&config)
+	go c.connectionLoop(context.Background())
+
+	require.NoError(t, mainServer.WaitForConnCount(1))
+
+	// invalid directive is refused and the client stays connected
+	ok, resp, err := mainServer.SendRequest(comm.RequestTypeReconnect, []byte(`{"server_url":"ftp://example.com"}`))
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, `invalid server_url "ftp://example.com": expected an http, https, ws or wss URL`, string(resp))
+	assert.True(t, mainServer.IsConnected())
+
+	// a server that is not a fallback server is refused
+	ok, resp, err = mainServer.SendRequest(comm.RequestTypeReconnect, []byte(`{"server_url":"https://attacker.example.com"}`))
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, `server_url "https://attacker.example.com" is not one of the fallback_servers of the client`, string(resp))
+	assert.True(t, mainServer.IsConnected())
+
+	// disconnects and connects to the alternate server
+	ok, _, err = mainServer.SendRequest(comm.RequestTypeReconnect, []byte(`{"server_url":"`+tsAlt.URL+`"}`))
+	require.NoError(t, err)
+	assert.True(t, ok)
+	require.NoError(t, altServer.WaitForConnCount(1))
+	assert.Equal(t, 1, mainServer.ConnCount())
+
+	// switches back to the main server
+	require.NoError(t, mainServer.WaitForConnCount(2))
+	assert.NoError(t, altServer.WaitForStatus(false))
+}
+
+func TestConnectionLoopFailFastInitial(t *testing.T) {
+	testCases := []struct {
+		name            string
+		failFastInitial bool
+		wantAttempts    int32
+		wantErr         string
+	}{
+		{
+			name:            "fail fast",
+			failFastInitial: true,
+			wantAttempts:    1,
+			wantErr:         "initial connection failed, check the server url and credentials: websocket: bad handshake",
+		},
+		{
+			name:            "retry",
+			failFastInitial: false,
+			wantAttempts:    3,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var attempts int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&attempts, 1)
+				w.WriteHeader(http.StatusNotFound)
+			}))
+			defer ts.Close()
+
+			config := Config{
+				Client: ClientConfig{
+					Server:  ts.URL,
+					DataDir: "./",
+				},
+				RemoteCommands: CommandsConfig{
+					Order: allowDenyOrder,
+				},
+				Logging: LogConfig{
+					LogOutput: chshare.NewLogOutput(""),
+				},
+				Connection: ConnectionConfig{
+					MaxRetryCount:   2,
+					FailFastInitial: tc.failFastInitial,
+				},
+			}
+			require.NoError(t, config.ParseAndValidate(true))
+
+			c := NewClient(&config)
+			go c.connectionLoop(context.Background())
+
+			done := make(chan error)
+			go func() {
+				done <- c.Wait()
+			}()
+			select {
+			case err := <-done:
+				if tc.wantErr != "" {
+					require.EqualError(t, err, tc.wantErr)
+				} else {
+					require.NoError(t, err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("client didn't exit")
+			}
+			assert.Equal(t, tc.wantAttempts, atomic.LoadInt32(&attempts))
+		})
+	}
+}
+
+func TestKeepAliveTimeout(t *testing.T) {
+	server, err := newMockServer()
+	require.NoError(t, err)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	config := Config{
+		Client: ClientConfig{
+			Server:  ts.URL,
+			DataDir: "./",
+		},
+		RemoteCommands: CommandsConfig{
+			Order: allowDenyOrder,
+		},
+		Logging: LogConfig{
+			LogOutput: chshare.NewLogOutput(""),
+		},
+		Connection: ConnectionConfig{
+			KeepAlive:        50 * time.Millisecond,
+			KeepAliveTimeout: 300 * time.Millisecond,
+			MaxRetryCount:    -1,
+		},
+	}
+	require.NoError(t, config.ParseAndValidate(true))
+
+	c := NewClient(&config)
+	c.setKeepAlive(config.Connection.KeepAlive)
+	go c.connectionLoop(context.Background())
+
+	require.NoError(t, server.WaitForStatus(true))
+
+	// stays connected while the server responds to pings
+	time.Sleep(2 * config.Connection.KeepAliveTimeout)
+	assert.True(t, server.IsConnected())
+	assert.Equal(t, 1, server.ConnCount())
+
+	// reconnects when the server stops responding
+	server.SetIgnorePings(true)
+	t0 := time.Now()
+	for server.ConnCount() < 2 && time.Since(t0) < 3*time.Second {
+		time.Sleep(10 * time.Millisecond)
+	}
+	elapsed := time.Since(t0)
+	require.Equal(t, 2, server.ConnCount(), "client didn't reconnect")
+	assert.GreaterOrEqual(t, int64(elapsed), int64(config.Connection.KeepAliveTimeout))
+	assert.Less(t, int64(elapsed), int64(config.Connection.KeepAliveTimeout+time.Second))
+}
@@ -0,0 +1,94 @@
+package chclient
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cloudradar-monitoring/rport/share/models"
+)
+
+// DefaultSyslogMaxCommandLength is used when syslog_max_command_length is not set.
+const DefaultSyslogMaxCommandLength = 1024
+
+// cmdLogger records executed commands in the system log of the client host.
+type cmdLogger interface {
+	Info(msg string) error
+	Warning(msg string) error
+}
+
+// Command events written to the system log
+const (
+	cmdLogEventStarted  = "started"
+	cmdLogEventFinished = "finished"
+	cmdLogEventRefused  = "refused"
+)
+
+// formatCmdLogEntry returns a structured entry of a command event, the command and the reason are truncated
+// to maxCmdLen bytes. A reason is set only for refused commands, it can contain the command.
+func formatCmdLogEntry(event string, job *models.Job, reason string, maxCmdLen int) string {
+	cmd := truncateCmdLogValue(job.Command, maxCmdLen)
+	reason = truncateCmdLogValue(reason, maxCmdLen)
+
+	entry := &strings.Builder{}
+	fmt.Fprintf(entry, "rport command %s: jid=%q", event, job.JID)
+	if job.MultiJobID != nil {
+		fmt.Fprintf(entry, " multi_job_id=%q", *job.MultiJobID)
+	}
+	fmt.Fprintf(entry, " issuer=%q", job.CreatedBy)
+	if event == cmdLogEventFinished {
+		fmt.Fprintf(entry, " status=%q", job.Status)
+	}
+	if job.PID != nil {
+		fmt.Fprintf(entry, " pid=%d", *job.PID)
+	}
+	if job.ExecutionMetadata != nil && job.ExecutionMetadata.ExitCode != nil {
+		fmt.Fprintf(entry, " exit_code=%d", *job.ExecutionMetadata.ExitCode)
+	}
+	if reason != "" {
+		fmt.Fprintf(entry, " reason=%q", reason)
+	}
+	fmt.Fprintf(entry, " is_script=%t is_sudo=%t command=%q", job.IsScript, job.IsSudo, cmd)
+
+	return entry.String()
+}
+
+func truncateCmdLogValue(v string, maxLen int) string {
+	if len(v) > maxLen {
+		return v[:maxLen] + "..."
+	}
+	return v
+}
+
+// logCmdStarted writes a started command to the system log if it's enabled.
+func (c *Client) logCmdStarted(job *models.Job, pid int) {
+	started := *job
+	started.PID = &pid
+	c.writeCmdLog(cmdLogEventStarted, &started, "", false)
+}
+
+// logCmd writes a finished command to the system log if it's enabled.
+func (c *Client) logCmd(job *models.Job) {
+	c.writeCmdLog(cmdLogEventFinished, job, "", job.Status != models.JobStatusSuccessful)
+}
+
+// logCmdRefused writes a command that was not started to the system log if it's enabled.
+func (c *Client) logCmdRefused(job *models.Job, reason error) {
+	c.writeCmdLog(cmdLogEventRefused, job, reason.Error(), true)
+}
+
+func (c *Client) writeCmdLog(event string, job *models.Job, reason string, warn bool) {
+	if c.cmdLogger == nil {
+		return
+	}
+
+	entry := formatCmdLogEntry(event, job, reason, c.config.RemoteCommands.GetSyslogMaxCommandLength())
+	var err error
+	if warn {
+		err = c.cmdLogger.Warning(entry)
+	} else {
+		err = c.cmdLogger.Info(entry)
+	}
+	if err != nil {
+		c.Errorf("Could not write command [jid=%q] to the system log: %v", job.JID, err)
+	}
+}
@@ -0,0 +1,16 @@
+//+build !windows
+
+package chclient
+
+import (
+	"log/syslog"
+)
+
+// newCmdLogger returns a logger writing to the local syslog.
+func newCmdLogger() (cmdLogger, error) {
+	return dialCmdLogger("", "")
+}
+
+func dialCmdLogger(network, raddr string) (cmdLogger, error) {
+	return syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_DAEMON, "rport")
+}
@@ -0,0 +1,154 @@
+//+build !windows
+
+package chclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/rport/share/models"
+	"github.com/cloudradar-monitoring/rport/share/test"
+)
+
+func TestHandleRunCmdRequestSyslog(t *testing.T) {
+	now = nowMockF
+
+	testCases := []struct {
+		name          string
+		command       string
+		waitErr       error
+		maxCmdLength  int
+		wantPriority  string
+		wantEntryPart string
+	}{
+		{
+			name:          "successful command",
+			command:       "/usr/bin/date",
+			wantPriority:  "<30>",
+			wantEntryPart: `issuer="admin" status="successful" pid=123 exit_code=0 is_script=false is_sudo=false command="/usr/bin/date"`,
+		},
+		{
+			name:          "failed command",
+			command:       "/usr/bin/false",
+			waitErr:       errors.New("failed"),
+			wantPriority:  "<28>",
+			wantEntryPart: `issuer="admin" status="failed" pid=123 is_script=false is_sudo=false command="/usr/bin/false"`,
+		},
+		{
+			name:          "truncated command",
+			command:       "/usr/bin/echo " + strings.Repeat("a", 100),
+			maxCmdLength:  16,
+			wantPriority:  "<30>",
+			wantEntryPart: `command="/usr/bin/echo aa..."`,
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "TestHandleRunCmdRequestSyslog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	sockPath := filepath.Join(dir, "syslog.sock")
+	sink, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: sockPath, Net: "unixgram"})
+	require.NoError(t, err)
+	defer sink.Close()
+
+	syslogger, err := dialCmdLogger("unixgram", sockPath)
+	require.NoError(t, err)
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			execMock := NewCmdExecutorMock()
+			execMock.ReturnPID = 123
+			execMock.ReturnWaitErr = tc.waitErr
+			connMock := test.NewConnMock()
+			done := make(chan bool)
+			connMock.DoneChannel = done
+
+			configCopy := getDefaultValidMinConfig()
+			configCopy.Client.DataDir = filepath.Join(configCopy.Client.DataDir, "TestHandleRunCmdRequestSyslog")
+			defer os.RemoveAll(configCopy.Client.DataDir)
+			require.NoError(t, PrepareDirs(&configCopy))
+			configCopy.RemoteCommands.Syslog = true
+			configCopy.RemoteCommands.SyslogMaxCommandLength = tc.maxCmdLength
+
+			c := Client{
+				cmdExec:    execMock,
+				sshConn:    connMock,
+				Logger:     testLog,
+				config:     &configCopy,
+				systemInfo: &mockSystemInfo{ReturnHostname: "test-host"},
+				cmdLogger:  syslogger,
+			}
+			job := models.Job{
+				JobSummary: models.JobSummary{JID: "5f02b216-3f8a-42be-b66c-f4c1d0ea3809"},
+				ClientID:   "d81e6b93e75aef59a7701b90555f43808458b34e30370c3b808c1816a32252b3",
+				Command:    tc.command,
+				CreatedBy:  "admin",
+				TimeoutSec: 60,
+			}
+			payload, err := json.Marshal(job)
+			require.NoError(t, err)
+
+			_, err = c.HandleRunCmdRequest(context.Background(), payload)
+			require.NoError(t, err)
+			<-done
+
+			started := readSyslogMsg(t, sink)
+			assert.True(t, strings.HasPrefix(started, "<30>"), started)
+			assert.Contains(t, started, `rport command started: jid="5f02b216-3f8a-42be-b66c-f4c1d0ea3809" issuer="admin" pid=123 is_script=false`)
+
+			finished := readSyslogMsg(t, sink)
+			assert.True(t, strings.HasPrefix(finished, tc.wantPriority), finished)
+			assert.Contains(t, finished, `rport command finished: jid="5f02b216-3f8a-42be-b66c-f4c1d0ea3809" issuer="admin"`)
+			assert.Contains(t, finished, tc.wantEntryPart)
+		})
+	}
+
+	t.Run("refused command", func(t *testing.T) {
+		configCopy := getDefaultValidMinConfig()
+		configCopy.RemoteCommands.Syslog = true
+		configCopy.RemoteCommands.denyRegexp = []*regexp.Regexp{regexp.MustCompile("^/usr/bin/rm")}
+		c := Client{
+			cmdExec:   NewCmdExecutorMock(),
+			Logger:    testLog,
+			config:    &configCopy,
+			cmdLogger: syslogger,
+		}
+		payload, err := json.Marshal(models.Job{
+			JobSummary: models.JobSummary{JID: "5f02b216-3f8a-42be-b66c-f4c1d0ea3809"},
+			Command:    "/usr/bin/rm -rf /",
+			CreatedBy:  "admin",
+			TimeoutSec: 60,
+		})
+		require.NoError(t, err)
+
+		_, err = c.HandleRunCmdRequest(context.Background(), payload)
+		require.Error(t, err)
+
+		refused := readSyslogMsg(t, sink)
+		assert.True(t, strings.HasPrefix(refused, "<28>"), refused)
+		assert.Contains(t, refused, fmt.Sprintf(`rport command refused: jid="5f02b216-3f8a-42be-b66c-f4c1d0ea3809" issuer="admin" reason=%q is_script=false is_sudo=false command="/usr/bin/rm -rf /"`, err.Error()))
+	})
+}
+
+func readSyslogMsg(t *testing.T, sink *net.UnixConn) string {
+	buf := make([]byte, 4096)
+	require.NoError(t, sink.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, err := sink.Read(buf)
+	require.NoError(t, err)
+	return string(buf[:n])
+}
@@ -0,0 +1,53 @@
+//+build windows
+
+package chclient
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows/registry"
+	"golang.org/x/sys/windows/svc/eventlog"
+)
+
+const (
+	cmdLogEventID = 1
+	cmdLogSource  = "rport"
+	// eventLogSourcesKey is a registry key of event sources of the Application log
+	eventLogSourcesKey = `SYSTEM\CurrentControlSet\Services\EventLog\Application`
+)
+
+type eventLogCmdLogger struct {
+	log *eventlog.Log
+}
+
+// newCmdLogger returns a logger writing to the Windows Event Log. The event source is registered if it's missing,
+// otherwise the Event Viewer can't show the messages.
+func newCmdLogger() (cmdLogger, error) {
+	if err := registerCmdLogSource(); err != nil {
+		return nil, err
+	}
+	l, err := eventlog.Open(cmdLogSource)
+	if err != nil {
+		return nil, err
+	}
+	return &eventLogCmdLogger{log: l}, nil
+}
+
+func registerCmdLogSource() error {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, eventLogSourcesKey+`\`+cmdLogSource, registry.QUERY_VALUE)
+	if err == nil {
+		return k.Close()
+	}
+	if !errors.Is(err, registry.ErrNotExist) {
+		return err
+	}
+	return eventlog.InstallAsEventCreate(cmdLogSource, eventlog.Error|eventlog.Warning|eventlog.Info)
+}
+
+func (l *eventLogCmdLogger) Info(msg string) error {
+	return l.log.Info(cmdLogEventID, msg)
+}
+
+func (l *eventLogCmdLogger) Warning(msg string) error {
+	return l.log.Warning(cmdLogEventID, msg)
+}
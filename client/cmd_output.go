@@ -0,0 +1,172 @@
+package chclient
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/cloudradar-monitoring/rport/share/comm"
+)
+
+// cmdOutputFlushInterval is how often new output of a streamed command is sent to the server. var is used to override in tests
+var cmdOutputFlushInterval = 500 * time.Millisecond
+
+// cmdOutput collects stdout and stderr of a running command. On request of the server it streams the output
+// produced so far and then new chunks of it until the command is finished.
+type cmdOutput struct {
+	jid    string
+	mu     sync.Mutex
+	stdOut *CapacityBuffer
+	stdErr *CapacityBuffer
+	// sentOut and sentErr are lengths of the output that is already streamed
+	sentOut   int
+	sentErr   int
+	streaming bool
+	finished  bool
+	stop      chan struct{}
+	stopped   chan struct{}
+}
+
+func newCmdOutput(jid string, sendBackLimit, maxResultSize int) *cmdOutput {
+	return &cmdOutput{
+		jid:    jid,
+		stdOut: &CapacityBuffer{capacity: sendBackLimit, truncateAt: maxResultSize},
+		stdErr: &CapacityBuffer{capacity: sendBackLimit, truncateAt: maxResultSize},
+	}
+}
+
+// StdOut returns a writer to be set as stdout of a command.
+func (o *cmdOutput) StdOut() io.Writer {
+	return &cmdOutputWriter{out: o, buf: o.stdOut}
+}
+
+// StdErr returns a writer to be set as stderr of a command.
+func (o *cmdOutput) StdErr() io.Writer {
+	return &cmdOutputWriter{out: o, buf: o.stdErr}
+}
+
+// startStreaming sends the output produced so far and then starts to send new chunks of it periodically.
+func (o *cmdOutput) startStreaming(send func(*comm.CmdOutput)) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.finished {
+		return errors.New("command is finished")
+	}
+	if o.streaming {
+		return nil
+	}
+	o.streaming = true
+	o.stop = make(chan struct{})
+	o.stopped = make(chan struct{})
+
+	go func() {
+		defer close(o.stopped)
+		ticker := time.NewTicker(cmdOutputFlushInterval)
+		defer ticker.Stop()
+		for {
+			o.flush(send)
+			select {
+			case <-ticker.C:
+			case <-o.stop:
+				// send the rest of the output
+				o.flush(send)
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// finish stops streaming after all the output is sent.
+func (o *cmdOutput) finish() {
+	o.mu.Lock()
+	o.finished = true
+	streaming := o.streaming
+	o.mu.Unlock()
+
+	if streaming {
+		close(o.stop)
+		<-o.stopped
+	}
+}
+
+func (o *cmdOutput) flush(send func(*comm.CmdOutput)) {
+	o.mu.Lock()
+	chunk := &comm.CmdOutput{
+		JID:    o.jid,
+		StdOut: string(o.stdOut.data[o.sentOut:]),
+		StdErr: string(o.stdErr.data[o.sentErr:]),
+	}
+	o.sentOut = len(o.stdOut.data)
+	o.sentErr = len(o.stdErr.data)
+	o.mu.Unlock()
+
+	if chunk.StdOut != "" || chunk.StdErr != "" {
+		send(chunk)
+	}
+}
+
+type cmdOutputWriter struct {
+	out *cmdOutput
+	buf *CapacityBuffer
+}
+
+func (w *cmdOutputWriter) Write(p []byte) (int, error) {
+	w.out.mu.Lock()
+	defer w.out.mu.Unlock()
+	return w.buf.Write(p)
+}
+
+// newCmdOutput creates an output of a command of a given job that can be streamed until it's removed.
+// Output beyond a given max result size is truncated, 0 means no limit.
+func (c *Client) newCmdOutput(jid string, maxResultSize int) *cmdOutput {
+	out := newCmdOutput(jid, c.config.RemoteCommands.SendBackLimit, maxResultSize)
+	c.cmdOutputsMutex.Lock()
+	defer c.cmdOutputsMutex.Unlock()
+	if c.cmdOutputs == nil {
+		c.cmdOutputs = make(map[string]*cmdOutput)
+	}
+	c.cmdOutputs[jid] = out
+	return out
+}
+
+// finishCmdOutput sends the rest of a streamed output and removes it.
+func (c *Client) finishCmdOutput(out *cmdOutput) {
+	c.cmdOutputsMutex.Lock()
+	delete(c.cmdOutputs, out.jid)
+	c.cmdOutputsMutex.Unlock()
+	out.finish()
+}
+
+// HandleStreamCmdOutputRequest starts streaming the output of a running command of a job to the server.
+func (c *Client) HandleStreamCmdOutputRequest(reqPayload []byte) error {
+	req := &comm.StreamCmdOutputRequest{}
+	if err := json.Unmarshal(reqPayload, req); err != nil {
+		return fmt.Errorf("failed to decode stream cmd output request: %s", err)
+	}
+
+	c.cmdOutputsMutex.Lock()
+	out := c.cmdOutputs[req.JID]
+	c.cmdOutputsMutex.Unlock()
+	if out == nil {
+		return fmt.Errorf("no running command of job %q", req.JID)
+	}
+
+	c.Debugf("Streaming output of command[jid=%q]", req.JID)
+	return out.startStreaming(c.sendCmdOutput)
+}
+
+func (c *Client) sendCmdOutput(chunk *comm.CmdOutput) {
+	chunkBytes, err := json.Marshal(chunk)
+	if err != nil {
+		c.Errorf("failed to encode output of command[jid=%q]: %s", chunk.JID, err)
+		return
+	}
+	_, _, err = c.sshConn.SendRequest(comm.RequestTypeCmdOutput, false, chunkBytes)
+	if err != nil {
+		c.Errorf("failed to send output of command[jid=%q] to server: %s", chunk.JID, err)
+	}
+}
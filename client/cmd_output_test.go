@@ -0,0 +1,70 @@
+package chclient
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/rport/share/comm"
+)
+
+func TestCmdOutputStreaming(t *testing.T) {
+	defer func(interval time.Duration) { cmdOutputFlushInterval = interval }(cmdOutputFlushInterval)
+	cmdOutputFlushInterval = time.Hour
+
+	var mu sync.Mutex
+	var chunks []*comm.CmdOutput
+	send := func(chunk *comm.CmdOutput) {
+		mu.Lock()
+		defer mu.Unlock()
+		chunks = append(chunks, chunk)
+	}
+	sentChunks := func() []*comm.CmdOutput {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]*comm.CmdOutput(nil), chunks...)
+	}
+
+	out := newCmdOutput("job-1", 100, 0)
+	_, err := out.StdOut().Write([]byte("line 1\n"))
+	require.NoError(t, err)
+
+	// output produced before streaming is started is sent right away
+	require.NoError(t, out.startStreaming(send))
+	require.NoError(t, out.startStreaming(send))
+	assert.Eventually(t, func() bool { return len(sentChunks()) == 1 }, time.Second, 10*time.Millisecond)
+
+	_, err = out.StdOut().Write([]byte("line 2\n"))
+	require.NoError(t, err)
+	_, err = out.StdErr().Write([]byte("error\n"))
+	require.NoError(t, err)
+
+	// the rest is sent when the command is finished
+	out.finish()
+
+	assert.Equal(t, []*comm.CmdOutput{
+		{JID: "job-1", StdOut: "line 1\n"},
+		{JID: "job-1", StdOut: "line 2\n", StdErr: "error\n"},
+	}, sentChunks())
+	assert.Equal(t, "line 1\nline 2\n", out.stdOut.String())
+	assert.EqualError(t, out.startStreaming(send), "command is finished")
+}
+
+func TestHandleStreamCmdOutputRequest(t *testing.T) {
+	config := getDefaultValidMinConfig()
+	c := Client{
+		Logger: testLog,
+		config: &config,
+	}
+	out := c.newCmdOutput("job-1", 0)
+
+	err := c.HandleStreamCmdOutputRequest([]byte(`{"jid":"job-2"}`))
+	assert.EqualError(t, err, `no running command of job "job-2"`)
+
+	c.finishCmdOutput(out)
+	err = c.HandleStreamCmdOutputRequest([]byte(`{"jid":"job-1"}`))
+	assert.EqualError(t, err, `no running command of job "job-1"`)
+}
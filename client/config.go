@@ -1,6 +1,8 @@
 package chclient
 
 import (
+	"bufio"
+	"crypto/ed25519"
 	"errors"
 	"fmt"
 	"log"
@@ -12,15 +14,24 @@ import (
 	"strings"
 	"time"
 
+	"github.com/cloudradar-monitoring/rport/client/health"
 	chshare "github.com/cloudradar-monitoring/rport/share"
+	"github.com/cloudradar-monitoring/rport/share/models"
 )
 
 type ConnectionConfig struct {
 	KeepAlive        time.Duration `mapstructure:"keep_alive"`
+	KeepAliveTimeout time.Duration `mapstructure:"keep_alive_timeout"`
 	MaxRetryCount    int           `mapstructure:"max_retry_count"`
 	MaxRetryInterval time.Duration `mapstructure:"max_retry_interval"`
+	FailFastInitial  bool          `mapstructure:"fail_fast_initial"`
 	HeadersRaw       []string      `mapstructure:"headers"`
+	AllowedHeaders   []string      `mapstructure:"allowed_headers"`
 	Hostname         string        `mapstructure:"hostname"`
+	// AlertAfterFailures triggers an alert after that many consecutive failed connection attempts, 0 disables it.
+	AlertAfterFailures int `mapstructure:"alert_after_failures"`
+	// AlertCommand is an executable run on the alert, if empty the alert is only logged.
+	AlertCommand string `mapstructure:"alert_command"`
 
 	headers http.Header
 }
@@ -40,9 +51,13 @@ type ClientConfig struct {
 	ID                       string        `mapstructure:"id"`
 	Name                     string        `mapstructure:"name"`
 	Tags                     []string      `mapstructure:"tags"`
+	Environment              string        `mapstructure:"environment"`
+	NoCommands               bool          `mapstructure:"no_commands"`
 	Remotes                  []string      `mapstructure:"remotes"`
+	RemotesFile              string        `mapstructure:"remotes_file"`
 	AllowRoot                bool          `mapstructure:"allow_root"`
 	UpdatesInterval          time.Duration `mapstructure:"updates_interval"`
+	UpdatesCacheTTL          time.Duration `mapstructure:"updates_cache_ttl"`
 	DataDir                  string        `mapstructure:"data_dir"`
 
 	proxyURL *url.URL
@@ -66,9 +81,38 @@ type CommandsConfig struct {
 	Allow         []string  `mapstructure:"allow"`
 	Deny          []string  `mapstructure:"deny"`
 	Order         [2]string `mapstructure:"order"`
+	// MaxConcurrent limits how many commands run simultaneously, 0 means 1.
+	MaxConcurrent int `mapstructure:"max_concurrent"`
+	// QueueWhenBusy makes commands wait for a free slot instead of being refused. Multi-client jobs always wait.
+	QueueWhenBusy bool `mapstructure:"queue_when_busy"`
+	// SignaturePublicKey is a path to a PEM encoded ed25519 public key to verify command signatures.
+	SignaturePublicKey string `mapstructure:"signature_public_key"`
+	// RequireSignature makes unsigned commands to be refused.
+	RequireSignature bool `mapstructure:"require_signature"`
+	// Syslog records executed commands in the syslog on Unix or in the Event Log on Windows.
+	Syslog bool `mapstructure:"syslog"`
+	// SyslogMaxCommandLength truncates commands written to the system log, 0 means the default.
+	SyslogMaxCommandLength int `mapstructure:"syslog_max_command_length"`
+
+	allowRegexp        []*regexp.Regexp
+	denyRegexp         []*regexp.Regexp
+	signaturePublicKey ed25519.PublicKey
+}
 
-	allowRegexp []*regexp.Regexp
-	denyRegexp  []*regexp.Regexp
+// GetMaxConcurrent returns the number of commands allowed to run simultaneously.
+func (c CommandsConfig) GetMaxConcurrent() int {
+	if c.MaxConcurrent < 1 {
+		return 1
+	}
+	return c.MaxConcurrent
+}
+
+// GetSyslogMaxCommandLength returns the max length of a command written to the system log.
+func (c CommandsConfig) GetSyslogMaxCommandLength() int {
+	if c.SyslogMaxCommandLength < 1 {
+		return DefaultSyslogMaxCommandLength
+	}
+	return c.SyslogMaxCommandLength
 }
 
 type ScriptsConfig struct {
@@ -81,6 +125,10 @@ type Config struct {
 	Logging        LogConfig        `mapstructure:"logging"`
 	RemoteCommands CommandsConfig   `mapstructure:"remote-commands"`
 	RemoteScripts  ScriptsConfig    `mapstructure:"remote-scripts"`
+	Health         health.Config    `mapstructure:"health"`
+
+	// locallySet are keys of values set explicitly in the config file or on the command line
+	locallySet map[string]bool
 }
 
 func (c *Config) ParseAndValidate(skipScriptsDirValidation bool) error {
@@ -96,10 +144,27 @@ func (c *Config) ParseAndValidate(skipScriptsDirValidation bool) error {
 	if err := c.parseProxyURL(); err != nil {
 		return err
 	}
+	if err := c.loadRemotesFile(); err != nil {
+		return err
+	}
 	if err := c.parseRemotes(); err != nil {
 		return err
 	}
 
+	if c.Connection.KeepAliveTimeout < 0 {
+		return errors.New("'keepalive timeout' cannot be negative")
+	}
+	if c.Connection.KeepAliveTimeout > 0 && c.Connection.KeepAlive <= 0 {
+		return errors.New("'keepalive timeout' requires 'keepalive' to be set")
+	}
+	if c.Connection.KeepAliveTimeout > 0 && c.Connection.KeepAliveTimeout <= c.Connection.KeepAlive {
+		return fmt.Errorf("'keepalive timeout' must be longer than 'keepalive' of %s", c.Connection.KeepAlive)
+	}
+
+	if c.Connection.AlertAfterFailures < 0 {
+		return fmt.Errorf("alert after failures can not be negative: %d", c.Connection.AlertAfterFailures)
+	}
+
 	if c.Connection.MaxRetryInterval < time.Second {
 		c.Connection.MaxRetryInterval = 5 * time.Minute
 	}
@@ -112,6 +177,16 @@ func (c *Config) ParseAndValidate(skipScriptsDirValidation bool) error {
 		return fmt.Errorf("remote commands: %v", err)
 	}
 
+	// a client that serves only tunnels
+	if c.Client.NoCommands {
+		c.RemoteCommands.Enabled = false
+		c.RemoteScripts.Enabled = false
+	}
+
+	if err := c.Health.Validate(); err != nil {
+		return fmt.Errorf("health: %v", err)
+	}
+
 	c.Client.authUser, c.Client.authPass = chshare.ParseAuth(c.Client.Auth)
 
 	if err := c.parseRemoteScripts(skipScriptsDirValidation); err != nil {
@@ -122,12 +197,20 @@ func (c *Config) ParseAndValidate(skipScriptsDirValidation bool) error {
 }
 
 func (c *Config) parseHeaders() error {
+	allowed := make(map[string]bool, len(c.Connection.AllowedHeaders))
+	for _, name := range c.Connection.AllowedHeaders {
+		allowed[http.CanonicalHeaderKey(strings.TrimSpace(name))] = true
+	}
 	c.Connection.headers = http.Header{}
 	for _, h := range c.Connection.HeadersRaw {
 		name, val, err := parseHeader(h)
 		if err != nil {
 			return err
 		}
+		// if allowed headers are not set, any header is allowed
+		if len(allowed) > 0 && !allowed[http.CanonicalHeaderKey(name)] {
+			return fmt.Errorf("header %q is not allowed, allowed headers: %s", name, strings.Join(c.Connection.AllowedHeaders, ", "))
+		}
 		c.Connection.headers.Set(name, val)
 	}
 	if c.Connection.Hostname != "" {
@@ -209,6 +292,38 @@ func (c *Config) parseRemotes() error {
 	return nil
 }
 
+// loadRemotesFile reads remotes from the remotes file, one per line. Blank lines and lines starting with # are ignored.
+// The remotes are put before other remotes, so remotes given on the command line are appended after them.
+func (c *Config) loadRemotesFile() error {
+	if c.Client.RemotesFile == "" {
+		return nil
+	}
+	f, err := os.Open(c.Client.RemotesFile)
+	if err != nil {
+		return fmt.Errorf("failed to open remotes file: %v", err)
+	}
+	defer f.Close()
+
+	var remotes []string
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := chshare.DecodeRemote(line); err != nil {
+			return fmt.Errorf("remotes file %q, line %d: failed to decode remote %q: %v", c.Client.RemotesFile, lineNum, line, err)
+		}
+		remotes = append(remotes, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read remotes file: %v", err)
+	}
+
+	c.Client.Remotes = append(remotes, c.Client.Remotes...)
+	return nil
+}
+
 func parseHeader(h string) (string, string, error) {
 	index := strings.Index(h, ":")
 	if index < 0 {
@@ -222,6 +337,10 @@ func (c *Config) parseRemoteCommands() error {
 		return fmt.Errorf("send back limit can not be negative: %d", c.RemoteCommands.SendBackLimit)
 	}
 
+	if c.RemoteCommands.MaxConcurrent < 0 {
+		return fmt.Errorf("max concurrent commands can not be negative: %d", c.RemoteCommands.MaxConcurrent)
+	}
+
 	allow, err := parseRegexpList(c.RemoteCommands.Allow)
 	if err != nil {
 		return fmt.Errorf("allow regexp: %v", err)
@@ -238,6 +357,15 @@ func (c *Config) parseRemoteCommands() error {
 		return fmt.Errorf("invalid order: %v", c.RemoteCommands.Order)
 	}
 
+	if c.RemoteCommands.SignaturePublicKey != "" {
+		c.RemoteCommands.signaturePublicKey, err = models.ReadEd25519PublicKey(c.RemoteCommands.SignaturePublicKey)
+		if err != nil {
+			return fmt.Errorf("signature public key: %v", err)
+		}
+	} else if c.RemoteCommands.RequireSignature {
+		return errors.New("'require_signature' requires 'signature_public_key' to be set")
+	}
+
 	return nil
 }
 
@@ -2,9 +2,11 @@ package chclient
 
 import (
 	"errors"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
 	"testing"
 	"time"
@@ -38,6 +40,7 @@ func TestConfigParseAndValidateHeaders(t *testing.T) {
 		Name           string
 		ConnConfig     ConnectionConfig
 		ExpectedHeader http.Header
+		ExpectedError  string
 	}{
 		{
 			Name: "defaults",
@@ -71,6 +74,40 @@ func TestConfigParseAndValidateHeaders(t *testing.T) {
 				"Test2":      []string{"v2"},
 				"User-Agent": []string{"rport 0.0.0-src"},
 			},
+		}, {
+			Name: "allowed header set",
+			ConnConfig: ConnectionConfig{
+				HeadersRaw:     []string{"x-custom-id: v1"},
+				AllowedHeaders: []string{"User-Agent", "X-Custom-Id"},
+			},
+			ExpectedHeader: http.Header{
+				"X-Custom-Id": []string{"v1"},
+				"User-Agent":  []string{"rport 0.0.0-src"},
+			},
+		}, {
+			Name: "disallowed header set",
+			ConnConfig: ConnectionConfig{
+				HeadersRaw:     []string{"X-Custom-Id: v1", "Authorization: Basic XXXXXX"},
+				AllowedHeaders: []string{"X-Custom-Id"},
+			},
+			ExpectedError: `header "Authorization" is not allowed, allowed headers: X-Custom-Id`,
+		}, {
+			Name: "host header not in allowed headers",
+			ConnConfig: ConnectionConfig{
+				HeadersRaw:     []string{"Host: spoofed.com"},
+				AllowedHeaders: []string{"X-Custom-Id"},
+			},
+			ExpectedError: `header "Host" is not allowed, allowed headers: X-Custom-Id`,
+		}, {
+			Name: "hostname set with allowed headers",
+			ConnConfig: ConnectionConfig{
+				Hostname:       "test.com",
+				AllowedHeaders: []string{"X-Custom-Id"},
+			},
+			ExpectedHeader: http.Header{
+				"Host":       []string{"test.com"},
+				"User-Agent": []string{"rport 0.0.0-src"},
+			},
 		},
 	}
 
@@ -80,6 +117,10 @@ func TestConfigParseAndValidateHeaders(t *testing.T) {
 			config.Connection = tc.ConnConfig
 
 			err := config.ParseAndValidate(true)
+			if tc.ExpectedError != "" {
+				require.EqualError(t, err, tc.ExpectedError)
+				return
+			}
 			require.NoError(t, err)
 
 			assert.Equal(t, tc.ExpectedHeader, config.Connection.Headers())
@@ -178,6 +219,53 @@ func TestConfigParseAndValidateMaxRetryInterval(t *testing.T) {
 	}
 }
 
+func TestConfigParseAndValidateKeepAliveTimeout(t *testing.T) {
+	testCases := []struct {
+		Name             string
+		KeepAlive        time.Duration
+		KeepAliveTimeout time.Duration
+		ExpectedError    string
+	}{
+		{
+			Name:             "disabled",
+			KeepAliveTimeout: 0,
+		}, {
+			Name:             "set",
+			KeepAlive:        30 * time.Second,
+			KeepAliveTimeout: 2 * time.Minute,
+		}, {
+			Name:             "negative",
+			KeepAlive:        30 * time.Second,
+			KeepAliveTimeout: -time.Second,
+			ExpectedError:    "'keepalive timeout' cannot be negative",
+		}, {
+			Name:             "keepalive disabled",
+			KeepAliveTimeout: 2 * time.Minute,
+			ExpectedError:    "'keepalive timeout' requires 'keepalive' to be set",
+		}, {
+			Name:             "not longer than keepalive",
+			KeepAlive:        30 * time.Second,
+			KeepAliveTimeout: 30 * time.Second,
+			ExpectedError:    "'keepalive timeout' must be longer than 'keepalive' of 30s",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			config := getDefaultValidMinConfig()
+			config.Connection.KeepAlive = tc.KeepAlive
+			config.Connection.KeepAliveTimeout = tc.KeepAliveTimeout
+			err := config.ParseAndValidate(true)
+
+			if tc.ExpectedError == "" {
+				require.NoError(t, err)
+			} else {
+				require.EqualError(t, err, tc.ExpectedError)
+			}
+		})
+	}
+}
+
 func TestConfigParseAndValidateProxyURL(t *testing.T) {
 	expectedProxyURL, err := url.Parse("http://proxy.com")
 	require.NoError(t, err)
@@ -238,6 +326,7 @@ func TestConfigParseAndValidateRemotes(t *testing.T) {
 				&chshare.Remote{
 					RemoteHost: "0.0.0.0",
 					RemotePort: "8000",
+					Protocol:   "tcp",
 				},
 			},
 		}, {
@@ -247,16 +336,43 @@ func TestConfigParseAndValidateRemotes(t *testing.T) {
 				&chshare.Remote{
 					RemoteHost: "0.0.0.0",
 					RemotePort: "8000",
+					Protocol:   "tcp",
 				},
 				&chshare.Remote{
 					RemoteHost: "0.0.0.0",
 					RemotePort: "3000",
+					Protocol:   "tcp",
+				},
+			},
+		}, {
+			Name:    "udp",
+			Remotes: []string{"3000/udp:8.8.8.8:53/udp", "514/udp"},
+			ExpectedRemotes: []*chshare.Remote{
+				&chshare.Remote{
+					LocalHost:  "0.0.0.0",
+					LocalPort:  "3000",
+					RemoteHost: "8.8.8.8",
+					RemotePort: "53",
+					Protocol:   "udp",
+				},
+				&chshare.Remote{
+					RemoteHost: "0.0.0.0",
+					RemotePort: "514",
+					Protocol:   "udp",
 				},
 			},
 		}, {
 			Name:          "invalid",
 			Remotes:       []string{"abc"},
 			ExpectedError: `failed to decode remote "abc": Missing ports`,
+		}, {
+			Name:          "protocols mismatch",
+			Remotes:       []string{"3000/tcp:8.8.8.8:53/udp"},
+			ExpectedError: `failed to decode remote "3000/tcp:8.8.8.8:53/udp": Protocols of local and remote ports don't match`,
+		}, {
+			Name:          "unsupported protocol",
+			Remotes:       []string{"3000:8.8.8.8:53/sctp"},
+			ExpectedError: `failed to decode remote "3000:8.8.8.8:53/sctp": Invalid protocol "sctp", expected "tcp" or "udp"`,
 		},
 	}
 
@@ -277,6 +393,71 @@ func TestConfigParseAndValidateRemotes(t *testing.T) {
 	}
 }
 
+func TestConfigParseAndValidateRemotesFile(t *testing.T) {
+	testCases := []struct {
+		Name            string
+		FileContent     string
+		Remotes         []string
+		ExpectedRemotes []string
+		ExpectedError   string
+	}{
+		{
+			Name:            "remotes, blanks and comments",
+			FileContent:     "# ssh\n2222:127.0.0.1:22\n\n  3000/udp:8.8.8.8:53/udp  \n\t# web\n8080:192.168.1.1:80\n",
+			ExpectedRemotes: []string{"2222:127.0.0.1:22", "3000/udp:8.8.8.8:53/udp", "8080:192.168.1.1:80"},
+		},
+		{
+			Name:            "with command line remotes",
+			FileContent:     "2222:127.0.0.1:22\n",
+			Remotes:         []string{"3389:3389"},
+			ExpectedRemotes: []string{"2222:127.0.0.1:22", "3389:3389"},
+		},
+		{
+			Name:            "empty file",
+			FileContent:     "# nothing yet\n",
+			Remotes:         []string{"3389:3389"},
+			ExpectedRemotes: []string{"3389:3389"},
+		},
+		{
+			Name:          "invalid line",
+			FileContent:   "2222:127.0.0.1:22\n# web\nabc\n",
+			ExpectedError: `line 3: failed to decode remote "abc": Missing ports`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "remotes.txt")
+			require.NoError(t, ioutil.WriteFile(file, []byte(tc.FileContent), 0600))
+			config := getDefaultValidMinConfig()
+			config.Client.RemotesFile = file
+			config.Client.Remotes = tc.Remotes
+
+			err := config.ParseAndValidate(true)
+
+			if tc.ExpectedError != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.ExpectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.ExpectedRemotes, config.Client.Remotes)
+			assert.Len(t, config.Client.remotes, len(tc.ExpectedRemotes))
+		})
+	}
+}
+
+func TestConfigParseAndValidateMissingRemotesFile(t *testing.T) {
+	config := getDefaultValidMinConfig()
+	config.Client.RemotesFile = filepath.Join(t.TempDir(), "missing.txt")
+
+	err := config.ParseAndValidate(true)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to open remotes file")
+}
+
 func TestConfigParseAndValidateAuth(t *testing.T) {
 	testCases := []struct {
 		Auth         string
@@ -362,6 +543,87 @@ func TestConfigParseAndValidateSendBackLimit(t *testing.T) {
 	}
 }
 
+func TestConfigParseAndValidateMaxConcurrent(t *testing.T) {
+	testCases := []struct {
+		name              string
+		maxConcurrent     int
+		wantMaxConcurrent int
+		wantErrContains   string
+	}{
+		{
+			name:              "unset",
+			wantMaxConcurrent: 1,
+		},
+		{
+			name:              "valid",
+			maxConcurrent:     5,
+			wantMaxConcurrent: 5,
+		},
+		{
+			name:            "invalid negative",
+			maxConcurrent:   -1,
+			wantErrContains: "max concurrent commands can not be negative",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := getDefaultValidMinConfig()
+			config.RemoteCommands.MaxConcurrent = tc.maxConcurrent
+
+			gotErr := config.ParseAndValidate(true)
+
+			if tc.wantErrContains != "" {
+				require.Error(t, gotErr)
+				assert.Contains(t, gotErr.Error(), tc.wantErrContains)
+			} else {
+				require.NoError(t, gotErr)
+				assert.Equal(t, tc.wantMaxConcurrent, config.RemoteCommands.GetMaxConcurrent())
+			}
+		})
+	}
+}
+
+func TestConfigParseAndValidateSignaturePublicKey(t *testing.T) {
+	testCases := []struct {
+		name             string
+		publicKey        string
+		requireSignature bool
+		wantErrContains  string
+	}{
+		{
+			name: "unset",
+		},
+		{
+			name:             "required without a key",
+			requireSignature: true,
+			wantErrContains:  "'require_signature' requires 'signature_public_key' to be set",
+		},
+		{
+			name:            "missing key file",
+			publicKey:       "/non-existing/public.pem",
+			wantErrContains: "signature public key: failed to read key",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := getDefaultValidMinConfig()
+			config.RemoteCommands.SignaturePublicKey = tc.publicKey
+			config.RemoteCommands.RequireSignature = tc.requireSignature
+
+			gotErr := config.ParseAndValidate(true)
+
+			if tc.wantErrContains != "" {
+				require.Error(t, gotErr)
+				assert.Contains(t, gotErr.Error(), tc.wantErrContains)
+			} else {
+				require.NoError(t, gotErr)
+			}
+		})
+	}
+}
+
 func TestConfigParseAndValidateAllowRegexp(t *testing.T) {
 	testCases := []struct {
 		name            string
@@ -571,3 +833,16 @@ func TestConfigParseAndValidateFallbackServers(t *testing.T) {
 		})
 	}
 }
+
+func TestNoCommandsDisablesCommandsAndScripts(t *testing.T) {
+	config := getDefaultValidMinConfig()
+	config.Client.NoCommands = true
+	config.RemoteCommands.Enabled = true
+	config.RemoteScripts.Enabled = true
+
+	err := config.ParseAndValidate(true)
+
+	require.NoError(t, err)
+	assert.False(t, config.RemoteCommands.Enabled)
+	assert.False(t, config.RemoteScripts.Enabled)
+}
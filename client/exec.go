@@ -24,6 +24,10 @@ type CmdExecutorContext struct {
 	WorkingDir  string
 	IsSudo      bool
 	IsScript    bool
+	// RunAs is an OS user to run the command as, empty to run as the client user
+	RunAs string
+	// Env holds environment variables that are set in addition to the client environment
+	Env map[string]string
 }
 
 type CmdExecutor interface {
@@ -42,6 +46,18 @@ func NewCmdExecutor(l *chshare.Logger) *CmdExecutorImpl {
 	}
 }
 
+// cmdEnv returns the client environment with given variables added, nil if there are none to keep the default.
+func cmdEnv(env map[string]string) []string {
+	if len(env) == 0 {
+		return nil
+	}
+	res := os.Environ()
+	for _, key := range models.SortedEnvKeys(env) {
+		res = append(res, key+"="+env[key])
+	}
+	return res
+}
+
 func (e *CmdExecutorImpl) Start(cmd *exec.Cmd) error {
 	return cmd.Start()
 }
@@ -50,51 +66,89 @@ func (e *CmdExecutorImpl) Wait(cmd *exec.Cmd) error {
 	return cmd.Wait()
 }
 
+// truncatedMarker is appended to stdout or stderr of a job exceeding the max result size
+const truncatedMarker = "\n[truncated]"
+
 // now is used to stub time.Now in tests
 var now = time.Now
 
-func (c *Client) HandleRunCmdRequest(ctx context.Context, reqPayload []byte) (*comm.RunCmdResponse, error) {
+// verifyJobSignature checks a job signature if a public key is configured. Unsigned jobs are accepted unless a signature is required.
+// A signed job is accepted only once.
+func (c *Client) verifyJobSignature(job *models.Job) error {
+	key := c.config.RemoteCommands.signaturePublicKey
+	if key == nil || (job.Signature == "" && !c.config.RemoteCommands.RequireSignature) {
+		return nil
+	}
+	curTime := now()
+	if err := job.VerifySignature(key, curTime); err != nil {
+		return err
+	}
+
+	c.signedJobsMutex.Lock()
+	defer c.signedJobsMutex.Unlock()
+	for jid, expiresAt := range c.signedJobs {
+		if curTime.After(expiresAt) {
+			delete(c.signedJobs, jid)
+		}
+	}
+	if _, ok := c.signedJobs[job.JID]; ok {
+		return fmt.Errorf("command with job id %q was already received", job.JID)
+	}
+	if c.signedJobs == nil {
+		c.signedJobs = make(map[string]time.Time)
+	}
+	c.signedJobs[job.JID] = *job.SignatureExpiresAt
+	return nil
+}
+
+func (c *Client) HandleRunCmdRequest(ctx context.Context, reqPayload []byte) (_ *comm.RunCmdResponse, err error) {
 	if !c.config.RemoteCommands.Enabled {
 		return nil, errors.New("remote commands execution is disabled")
 	}
 
 	job := models.Job{}
-	err := json.Unmarshal(reqPayload, &job)
+	err = json.Unmarshal(reqPayload, &job)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode requested job: %s", err)
 	}
-
-	// do not accept a new request when the previous is not finished yet, except multi-client job. In this case wait
-	// NOTE: HandleRunCmdRequest is run sequentially, that's why no need to lock a block with read/write curPID
-	curPID := c.getCurCmdPID()
-	if curPID != nil {
-		if job.MultiJobID == nil {
-			return nil, fmt.Errorf("a previous command execution with PID %d is still running", *curPID)
+	defer func() {
+		if err != nil {
+			c.logCmdRefused(&job, err)
 		}
-		c.Debugf("Waiting for a previous command with PID %d to finish", *curPID)
-	}
+	}()
 
-	if job.IsScript && !c.config.RemoteScripts.Enabled {
-		return nil, errors.New("remote scripts are disabled")
+	if err := c.verifyJobSignature(&job); err != nil {
+		return nil, err
 	}
 
-	// TODO: temporary solution, refactor with using worker pool
-	c.runCmdMutex.Lock()
+	interpreter, denied := c.checkJobPolicy(&job)
+	if denied != nil {
+		return nil, errors.New(denied.Reason)
+	}
+	job.Interpreter = interpreter
 
-	job.Interpreter, err = getInterpreter(job.Interpreter, runtime.GOOS, HasShebangLine(job.Command))
+	umask, err := parseJobUmask(job.Umask)
 	if err != nil {
-		c.runCmdMutex.Unlock()
 		return nil, err
 	}
+	job.Umask = effectiveUmask(umask)
 
-	if !job.IsScript && !c.isAllowed(job.Command) {
-		c.runCmdMutex.Unlock()
-		return nil, fmt.Errorf("command is not allowed: %v", job.Command)
+	if err := validateJobRunAs(job.RunAs); err != nil {
+		return nil, err
+	}
+
+	if err := models.ValidateStdin(job.Stdin); err != nil {
+		return nil, err
 	}
 
-	scriptPath, err := CreateScriptFile(c.config.GetScriptsDir(), job.Interpreter, job.Command)
+	// do not accept a new request when max concurrent commands are running, except multi-client job or when configured to queue. In this case wait
+	if !c.acquireCmdSlot(job.MultiJobID != nil || c.config.RemoteCommands.QueueWhenBusy) {
+		return nil, fmt.Errorf("max concurrent commands limit (%d) is reached, running PIDs: %v", c.config.RemoteCommands.GetMaxConcurrent(), c.getCmdPIDs())
+	}
+
+	scriptPath, err := c.createJobScript(ctx, &job)
 	if err != nil {
-		c.runCmdMutex.Unlock()
+		c.releaseCmdSlot()
 		return nil, err
 	}
 
@@ -104,25 +158,35 @@ func (c *Client) HandleRunCmdRequest(ctx context.Context, reqPayload []byte) (*c
 		WorkingDir:  job.Cwd,
 		IsSudo:      job.IsSudo,
 		IsScript:    job.IsScript,
+		RunAs:       job.RunAs,
+		Env:         job.Env,
 	}
+	// env values are secrets, they should not be logged or sent back with the result
+	job.Env = nil
 	cmd := c.cmdExec.New(ctx, execCtx)
-	stdOut := &CapacityBuffer{capacity: c.config.RemoteCommands.SendBackLimit}
-	stdErr := &CapacityBuffer{capacity: c.config.RemoteCommands.SendBackLimit}
-	cmd.Stdout = stdOut
-	cmd.Stderr = stdErr
+	if job.Stdin != "" {
+		// stdin is closed after the data is written
+		cmd.Stdin = strings.NewReader(job.Stdin)
+		job.Stdin = ""
+	}
+	out := c.newCmdOutput(job.JID, job.MaxResultSize)
+	cmd.Stdout = out.StdOut()
+	cmd.Stderr = out.StdErr()
 
 	c.Debugf("Input command: %s, sysProcAttributes: %+v, executable command: %s", job.Command, cmd.SysProcAttr, cmd.String())
 
 	startedAt := now()
-	err = c.cmdExec.Start(cmd)
+	err = c.startCmd(cmd, umask)
 	if err != nil {
-		c.runCmdMutex.Unlock()
-		c.rmScript(scriptPath)
+		c.releaseCmdSlot()
+		c.finishCmdOutput(out)
+		c.rmJobScript(scriptPath, job.RunAs)
 		return nil, fmt.Errorf("failed to start a command: %s", err)
 	}
 
 	// set running PID
-	c.setCurCmdPID(&cmd.Process.Pid)
+	c.addCmdPID(cmd.Process.Pid)
+	c.logCmdStarted(&job, cmd.Process.Pid)
 
 	res := &comm.RunCmdResponse{
 		Pid:       cmd.Process.Pid,
@@ -131,66 +195,109 @@ func (c *Client) HandleRunCmdRequest(ctx context.Context, reqPayload []byte) (*c
 
 	// observe the cmd execution in background
 	go func() {
-		defer c.rmScript(scriptPath)
-
-		c.Debugf("started to observe cmd [jid=%q,pid=%d]", job.JID, res.Pid)
-
-		// after timeout stop observing but leave the cmd running
-		done := make(chan error)
-		go func() { done <- c.cmdExec.Wait(cmd) }()
-
-		var status string
-		var execErr error
-		select {
-		case execErr = <-done:
-			if execErr != nil {
-				status = models.JobStatusFailed
-				c.Errorf("failed to run command[jid=%q,pid=%d]:\ncmd:\n%s\nerr: %s", job.JID, res.Pid, job.Command, execErr)
-			} else {
-				status = models.JobStatusSuccessful
-			}
-		case <-time.After(time.Duration(job.TimeoutSec) * time.Second):
-			status = models.JobStatusUnknown
-			c.Debugf("timeout (%d seconds) reached, stop observing command[jid=%q,pid=%d]:\n%s", job.TimeoutSec, job.JID, res.Pid, job.Command)
-		}
+		defer c.rmJobScript(scriptPath, job.RunAs)
+		c.observeCmd(cmd, job, startedAt, out)
+	}()
 
-		// observing stopped - unset PID
-		c.setCurCmdPID(nil)
-		c.runCmdMutex.Unlock()
+	return res, nil
+}
 
-		// fill all unset fields
-		now := now()
-		job.FinishedAt = &now
-		job.Status = status
-		job.PID = &res.Pid
-		job.StartedAt = startedAt
+// observeCmd waits for a started job command to finish and sends the filled job to the server.
+func (c *Client) observeCmd(cmd *exec.Cmd, job models.Job, startedAt time.Time, out *cmdOutput) {
+	pid := cmd.Process.Pid
+	c.Debugf("started to observe cmd [jid=%q,pid=%d]", job.JID, pid)
 
-		job.Error = c.buildErrText(execErr, stdOut, stdErr)
-		if job.Error != "" {
-			c.Errorf(job.Error)
-		}
+	hostname, err := c.systemInfo.Hostname()
+	if err != nil {
+		c.Errorf("Could not get hostname: %v", err)
+		hostname = UnknownValue
+	}
 
-		job.Result = &models.JobResult{
-			StdOut: stdOut.String(),
-			StdErr: stdErr.String(),
+	// after timeout stop observing but leave the cmd running
+	done := make(chan error)
+	go func() { done <- c.cmdExec.Wait(cmd) }()
+
+	var status string
+	var execErr error
+	var exitCode *int
+	select {
+	case execErr = <-done:
+		exitCode = getExitCode(execErr)
+		if c.isCmdPIDCanceled(pid) {
+			status = models.JobStatusFailed
+			execErr = errors.New(jobCanceledErr)
+			c.Infof("command[jid=%q,pid=%d] canceled", job.JID, pid)
+		} else if execErr != nil {
+			status = models.JobStatusFailed
+			c.Errorf("failed to run command[jid=%q,pid=%d]:\ncmd:\n%s\nerr: %s", job.JID, pid, job.Command, execErr)
+		} else {
+			status = models.JobStatusSuccessful
 		}
+	case <-time.After(time.Duration(job.TimeoutSec) * time.Second):
+		status = models.JobStatusUnknown
+		c.Debugf("timeout (%d seconds) reached, stop observing command[jid=%q,pid=%d]:\n%s", job.TimeoutSec, job.JID, pid, job.Command)
+	}
 
-		// send the filled job to the server
-		jobBytes, err := json.Marshal(job)
-		if err != nil {
-			c.Errorf("failed to send command result for [jid=%q,pid=%d]: failed to encode job result: %s", job.JID, res.Pid, err)
-			return
-		}
-		c.Debugf("sending job to server: %v", job)
-		_, _, err = c.sshConn.SendRequest(comm.RequestTypeCmdResult, false, jobBytes)
-		if err != nil {
-			c.Errorf("failed to send command result to server[jid=%q,pid=%d]: %s", job.JID, res.Pid, err)
-		}
+	// observing stopped - unset PID
+	c.removeCmdPID(pid)
+	c.releaseCmdSlot()
+	// streamed output is sent before the result
+	c.finishCmdOutput(out)
+
+	// fill all unset fields
+	now := now()
+	job.FinishedAt = &now
+	job.Status = status
+	job.PID = &pid
+	job.StartedAt = startedAt
+
+	out.mu.Lock()
+	job.Error = c.buildErrText(execErr, out.stdOut, out.stdErr)
+	job.Result = &models.JobResult{
+		StdOut: out.stdOut.Result(),
+		StdErr: out.stdErr.Result(),
+	}
+	job.Truncated = out.stdOut.Truncated() || out.stdErr.Truncated()
+	out.mu.Unlock()
+	if job.Error != "" {
+		c.Errorf(job.Error)
+	}
 
-		c.Debugf("finished to observe cmd [jid=%q,pid=%d]", job.JID, res.Pid)
-	}()
+	job.ExecutionMetadata = &models.ExecutionMetadata{
+		Hostname:   hostname,
+		StartedAt:  startedAt,
+		FinishedAt: now,
+		ExitCode:   exitCode,
+	}
 
-	return res, nil
+	c.logCmd(&job)
+
+	// send the filled job to the server
+	jobBytes, err := json.Marshal(job)
+	if err != nil {
+		c.Errorf("failed to send command result for [jid=%q,pid=%d]: failed to encode job result: %s", job.JID, pid, err)
+		return
+	}
+	c.Debugf("sending job to server: %v", job)
+	_, _, err = c.sshConn.SendRequest(comm.RequestTypeCmdResult, false, jobBytes)
+	if err != nil {
+		c.Errorf("failed to send command result to server[jid=%q,pid=%d]: %s", job.JID, pid, err)
+	}
+
+	c.Debugf("finished to observe cmd [jid=%q,pid=%d]", job.JID, pid)
+}
+
+// getExitCode returns an exit code of a finished command or nil if it's unknown.
+func getExitCode(execErr error) *int {
+	code := 0
+	if execErr != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(execErr, &exitErr) {
+			return nil
+		}
+		code = exitErr.ExitCode()
+	}
+	return &code
 }
 
 func (c *Client) buildErrText(execErr error, stdOut, stdErr *CapacityBuffer) string {
@@ -209,6 +316,29 @@ func (c *Client) buildErrText(execErr error, stdOut, stdErr *CapacityBuffer) str
 	return strings.Join(errs, ", ")
 }
 
+// createJobScript writes a job command to a script file. A script of a job run as another user is owned by that user,
+// since the user can't read the client scripts directory.
+func (c *Client) createJobScript(ctx context.Context, job *models.Job) (string, error) {
+	if job.RunAs != "" {
+		return createRunAsScriptFile(ctx, job.RunAs, job.Command)
+	}
+	return CreateScriptFile(c.config.GetScriptsDir(), job.Interpreter, job.Command)
+}
+
+// rmJobScript deletes a script created by createJobScript.
+func (c *Client) rmJobScript(scriptPath, runAs string) {
+	if runAs == "" {
+		c.rmScript(scriptPath)
+		return
+	}
+	err := removeRunAsScriptFile(runAs, scriptPath)
+	if err != nil {
+		c.Errorf("failed to delete script %s: %v", scriptPath, err)
+	} else {
+		c.Debugf("deleted script %s after execution", scriptPath)
+	}
+}
+
 func (c *Client) rmScript(scriptPath string) {
 	err := os.Remove(scriptPath)
 	if err != nil {
@@ -244,6 +374,53 @@ var getInterpreter = func(inputInterpreter, os string, hasShebang bool) (string,
 	return chshare.UnixShell, nil
 }
 
+// HandleValidateCmdRequest checks whether a given job would pass all the restrictions of the client without running it.
+func (c *Client) HandleValidateCmdRequest(reqPayload []byte) (*comm.ValidateCmdResponse, error) {
+	job := models.Job{}
+	err := json.Unmarshal(reqPayload, &job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode requested job: %s", err)
+	}
+
+	if _, denied := c.checkJobPolicy(&job); denied != nil {
+		return denied, nil
+	}
+	return &comm.ValidateCmdResponse{Allowed: true}, nil
+}
+
+// checkJobPolicy runs the checks of the client restrictions a job has to pass to be executed. It returns the interpreter
+// to run the job with, or a verdict naming the failed rule if the job is denied.
+func (c *Client) checkJobPolicy(job *models.Job) (string, *comm.ValidateCmdResponse) {
+	if !c.config.RemoteCommands.Enabled {
+		return "", comm.NewCmdDenied(comm.CmdRuleRemoteCommands, "remote commands execution is disabled")
+	}
+
+	if job.IsScript && !c.config.RemoteScripts.Enabled {
+		return "", comm.NewCmdDenied(comm.CmdRuleRemoteScripts, "remote scripts are disabled")
+	}
+
+	interpreter, err := getInterpreter(job.Interpreter, runtime.GOOS, HasShebangLine(job.Command))
+	if err != nil {
+		return "", comm.NewCmdDenied(comm.CmdRuleInterpreter, err.Error())
+	}
+
+	if !job.IsScript && !c.isAllowed(job.Command) {
+		return "", comm.NewCmdDenied(comm.CmdRuleAllowDenyList, fmt.Sprintf("command is not allowed: %v", job.Command))
+	}
+
+	if job.Cwd != "" {
+		info, err := os.Stat(job.Cwd)
+		if err != nil {
+			return "", comm.NewCmdDenied(comm.CmdRuleWorkingDir, fmt.Sprintf("invalid working directory: %v", err))
+		}
+		if !info.IsDir() {
+			return "", comm.NewCmdDenied(comm.CmdRuleWorkingDir, fmt.Sprintf("working directory %s is not a directory", job.Cwd))
+		}
+	}
+
+	return interpreter, nil
+}
+
 // isAllowed returns true if a given command passes configured restrictions.
 func (c *Client) isAllowed(cmd string) bool {
 	allowMatch := matchRegexp(cmd, c.config.RemoteCommands.allowRegexp)
@@ -277,6 +454,9 @@ type CapacityBuffer struct {
 	data        []byte
 	capacity    int
 	hasOverflow bool
+	// truncateAt is a max size of a job result set by the server, 0 means no limit. Unlike capacity, output beyond it is silently dropped.
+	truncateAt int
+	truncated  bool
 }
 
 func (b *CapacityBuffer) HasOverflow() bool {
@@ -288,6 +468,16 @@ func (b *CapacityBuffer) GetOverflowMessage() string {
 }
 
 func (b *CapacityBuffer) Write(p []byte) (n int, err error) {
+	n = len(p)
+	if b.truncateAt > 0 && len(b.data)+len(p) > b.truncateAt {
+		b.truncated = true
+		free := b.truncateAt - len(b.data)
+		if free < 0 {
+			free = 0
+		}
+		p = p[:free]
+	}
+
 	freeCapacity := b.capacity - len(b.data)
 
 	// do not write to buffer if no space left
@@ -299,7 +489,20 @@ func (b *CapacityBuffer) Write(p []byte) (n int, err error) {
 
 	b.data = append(b.data, p...)
 
-	return len(p), nil
+	return n, nil
+}
+
+// Truncated returns true if some data was dropped because of the max job result size.
+func (b *CapacityBuffer) Truncated() bool {
+	return b.truncated
+}
+
+// Result returns the buffered data followed by a marker if it was truncated.
+func (b *CapacityBuffer) Result() string {
+	if b.truncated {
+		return string(b.data) + truncatedMarker
+	}
+	return string(b.data)
 }
 
 func (b *CapacityBuffer) String() string {
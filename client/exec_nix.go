@@ -3,16 +3,23 @@
 package chclient
 
 import (
+	"bytes"
 	"context"
+	"fmt"
 	"os/exec"
 	"strings"
+	"sync"
+	"syscall"
 
 	chshare "github.com/cloudradar-monitoring/rport/share"
+	"github.com/cloudradar-monitoring/rport/share/models"
 )
 
 func (e *CmdExecutorImpl) New(ctx context.Context, execCtx *CmdExecutorContext) *exec.Cmd {
 	var args []string
-	if execCtx.IsSudo {
+	if execCtx.RunAs != "" {
+		args = append(args, "sudo", "-n", "-u", execCtx.RunAs)
+	} else if execCtx.IsSudo {
 		args = append(args, "sudo", "-n")
 	}
 
@@ -33,6 +40,91 @@ func (e *CmdExecutorImpl) New(ctx context.Context, execCtx *CmdExecutorContext)
 
 	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
 	cmd.Dir = execCtx.WorkingDir
+	cmd.Env = cmdEnv(execCtx.Env)
+	// run in an own process group to be able to kill child processes when canceled
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 
 	return cmd
 }
+
+// umaskMtx guards the process umask. A command with a umask takes it exclusively to set and restore the umask around the spawn.
+var umaskMtx sync.RWMutex
+
+// processUmask is the client umask. It's read once at start, since reading it requires to change it temporarily,
+// and the client never changes it except around a spawn.
+var processUmask = readUmask()
+
+func readUmask() int {
+	umask := syscall.Umask(0)
+	syscall.Umask(umask)
+	return umask
+}
+
+// effectiveUmask returns an octal umask a command is started with, e.g. "0027", nil umask means the client umask.
+func effectiveUmask(umask *int) string {
+	if umask == nil {
+		return fmt.Sprintf("%04o", processUmask)
+	}
+	return fmt.Sprintf("%04o", *umask)
+}
+
+// parseJobUmask returns a umask to run a job with, nil if the client umask is kept.
+func parseJobUmask(umask string) (*int, error) {
+	if umask == "" {
+		return nil, nil
+	}
+	v, err := models.ParseUmask(umask)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// validateJobRunAs returns an error if a given user to run a job as is not safe to pass to sudo.
+func validateJobRunAs(runAs string) error {
+	if runAs == "" {
+		return nil
+	}
+	return models.ValidateRunAs(runAs)
+}
+
+// runAsScriptCopyCmd creates a temp file readable only by the user it runs as, writes a script from stdin to it and prints its path.
+const runAsScriptCopyCmd = `umask 077 && f=$(mktemp /tmp/rport-XXXXXXXXXX) && cat > "$f" && chmod 0500 "$f" && echo "$f"`
+
+// createRunAsScriptFile writes a script to a temp file owned by a given user. The script is passed on stdin of a command
+// run with sudo, so the rport user needs no more privileges than to run commands as the user.
+func createRunAsScriptFile(ctx context.Context, runAs, script string) (string, error) {
+	cmd := exec.CommandContext(ctx, "sudo", "-n", "-u", runAs, "/bin/sh", "-c", runAsScriptCopyCmd)
+	cmd.Stdin = strings.NewReader(script)
+	stdErr := &bytes.Buffer{}
+	cmd.Stderr = stdErr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to create a script file owned by user %q: %v: %s", runAs, err, strings.TrimSpace(stdErr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// removeRunAsScriptFile deletes a script file created by createRunAsScriptFile.
+func removeRunAsScriptFile(runAs, scriptPath string) error {
+	out, err := exec.Command("sudo", "-n", "-u", runAs, "rm", "-f", "--", scriptPath).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// startCmd starts a given command with a given umask, nil umask keeps the client umask.
+func (c *Client) startCmd(cmd *exec.Cmd, umask *int) error {
+	if umask == nil {
+		umaskMtx.RLock()
+		defer umaskMtx.RUnlock()
+		return c.cmdExec.Start(cmd)
+	}
+
+	umaskMtx.Lock()
+	defer umaskMtx.Unlock()
+	oldUmask := syscall.Umask(*umask)
+	defer syscall.Umask(oldUmask)
+	return c.cmdExec.Start(cmd)
+}
@@ -0,0 +1,405 @@
+//go:build !windows
+// +build !windows
+
+package chclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/rport/share/models"
+	"github.com/cloudradar-monitoring/rport/share/test"
+)
+
+func TestStartCmdWithUmask(t *testing.T) {
+	// the client umask is set explicitly to make file permissions predictable
+	defaultUmask := syscall.Umask(0022)
+	defer syscall.Umask(defaultUmask)
+
+	testCases := []struct {
+		name     string
+		umask    string
+		wantPerm os.FileMode
+	}{
+		{
+			name:     "client umask",
+			umask:    "",
+			wantPerm: 0644,
+		},
+		{
+			name:     "restrictive umask",
+			umask:    "077",
+			wantPerm: 0600,
+		},
+		{
+			name:     "leading zero",
+			umask:    "0027",
+			wantPerm: 0640,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "umask")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			file := filepath.Join(dir, "created-by-cmd")
+			c := Client{
+				Logger:  testLog,
+				cmdExec: NewCmdExecutor(testLog),
+			}
+			umask, err := parseJobUmask(tc.umask)
+			require.NoError(t, err)
+
+			cmd := exec.Command("/bin/sh", "-c", "touch "+file)
+			require.NoError(t, c.startCmd(cmd, umask))
+			require.NoError(t, cmd.Wait())
+
+			info, err := os.Stat(file)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantPerm, info.Mode().Perm())
+			// the client umask is restored
+			assert.Equal(t, 0022, syscall.Umask(0022))
+		})
+	}
+}
+
+func TestCmdExecutorEnv(t *testing.T) {
+	e := NewCmdExecutor(testLog)
+
+	cmd := e.New(context.Background(), &CmdExecutorContext{
+		Interpreter: "/bin/sh",
+		Command:     "printenv",
+		Env:         map[string]string{"RPORT_TEST_FOO": "bar baz"},
+	})
+	out, err := cmd.Output()
+	require.NoError(t, err)
+
+	assert.Contains(t, string(out), "RPORT_TEST_FOO=bar baz\n")
+	// the client environment is kept
+	assert.Contains(t, string(out), "PATH="+os.Getenv("PATH")+"\n")
+}
+
+func TestCmdExecutorRunAs(t *testing.T) {
+	testCases := []struct {
+		name     string
+		isSudo   bool
+		runAs    string
+		wantArgs []string
+	}{
+		{
+			name:     "client user",
+			wantArgs: []string{"/bin/sh", "-c", "/tmp/script.sh"},
+		},
+		{
+			name:     "sudo",
+			isSudo:   true,
+			wantArgs: []string{"sudo", "-n", "/bin/sh", "-c", "/tmp/script.sh"},
+		},
+		{
+			name:     "run as user",
+			runAs:    "www-data",
+			wantArgs: []string{"sudo", "-n", "-u", "www-data", "/bin/sh", "-c", "/tmp/script.sh"},
+		},
+		{
+			name:     "run as user takes precedence over sudo",
+			isSudo:   true,
+			runAs:    "www-data",
+			wantArgs: []string{"sudo", "-n", "-u", "www-data", "/bin/sh", "-c", "/tmp/script.sh"},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := NewCmdExecutor(testLog).New(context.Background(), &CmdExecutorContext{
+				Interpreter: "/bin/sh",
+				Command:     "/tmp/script.sh",
+				IsSudo:      tc.isSudo,
+				RunAs:       tc.runAs,
+			})
+
+			assert.Equal(t, tc.wantArgs, cmd.Args)
+		})
+	}
+}
+
+func TestHandleRunCmdRequestRunAs(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("running commands as another user requires root")
+	}
+	if _, err := exec.LookPath("sudo"); err != nil {
+		t.Skip("sudo is not installed")
+	}
+
+	connMock := test.NewConnMock()
+	done := make(chan bool)
+	connMock.DoneChannel = done
+	configCopy := getDefaultValidMinConfig()
+	configCopy.Client.DataDir = filepath.Join(configCopy.Client.DataDir, "TestHandleRunCmdRequestRunAs")
+	defer os.RemoveAll(configCopy.Client.DataDir)
+	require.NoError(t, PrepareDirs(&configCopy))
+	c := Client{
+		cmdExec:    NewCmdExecutor(testLog),
+		sshConn:    connMock,
+		Logger:     testLog,
+		config:     &configCopy,
+		systemInfo: &mockSystemInfo{ReturnHostname: "test-host"},
+	}
+	jobBytes, err := json.Marshal(models.Job{
+		JobSummary: models.JobSummary{JID: "job-1"},
+		Command:    "id -un",
+		TimeoutSec: 10,
+		RunAs:      "nobody",
+	})
+	require.NoError(t, err)
+
+	_, err = c.HandleRunCmdRequest(context.Background(), jobBytes)
+	require.NoError(t, err)
+	<-done
+
+	_, _, payload := connMock.InputSendRequest()
+	gotJob := models.Job{}
+	require.NoError(t, json.Unmarshal(payload, &gotJob))
+	assert.Equal(t, models.JobStatusSuccessful, gotJob.Status, gotJob.Error)
+	require.NotNil(t, gotJob.Result)
+	assert.Equal(t, "nobody\n", gotJob.Result.StdOut)
+}
+
+func TestValidateJobRunAs(t *testing.T) {
+	assert.NoError(t, validateJobRunAs(""))
+	assert.NoError(t, validateJobRunAs("www-data"))
+	assert.EqualError(t, validateJobRunAs("-u root"), `invalid user name "-u root", expected up to 32 letters, digits, '_', '.' and '-' not starting with a digit, '.' or '-'`)
+}
+
+func TestParseJobUmask(t *testing.T) {
+	for _, umask := range []string{"8", "0778", "1000", "abc", "-1"} {
+		_, err := parseJobUmask(umask)
+		assert.EqualError(t, err, `invalid umask "`+umask+`", expected an octal value from 0000 to 0777`)
+	}
+}
+
+func TestGetExitCode(t *testing.T) {
+	zero, three := 0, 3
+	testCases := []struct {
+		name    string
+		execErr error
+		want    *int
+	}{
+		{
+			name: "success",
+			want: &zero,
+		},
+		{
+			name:    "non-zero exit code",
+			execErr: exec.Command("sh", "-c", "exit 3").Run(),
+			want:    &three,
+		},
+		{
+			name:    "not an exit error",
+			execErr: errors.New("failed to start"),
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, getExitCode(tc.execErr))
+		})
+	}
+}
+
+func TestHandleRunCmdRequestSeparatesStdOutAndStdErr(t *testing.T) {
+	connMock := test.NewConnMock()
+	done := make(chan bool)
+	connMock.DoneChannel = done
+	configCopy := getDefaultValidMinConfig()
+	configCopy.Client.DataDir = filepath.Join(configCopy.Client.DataDir, "TestHandleRunCmdRequestSeparatesStdOutAndStdErr")
+	defer os.RemoveAll(configCopy.Client.DataDir)
+	require.NoError(t, PrepareDirs(&configCopy))
+	configCopy.RemoteScripts.Enabled = true
+	c := Client{
+		cmdExec:    NewCmdExecutor(testLog),
+		sshConn:    connMock,
+		Logger:     testLog,
+		config:     &configCopy,
+		systemInfo: &mockSystemInfo{ReturnHostname: "test-host"},
+	}
+	jobBytes, err := json.Marshal(models.Job{
+		JobSummary: models.JobSummary{JID: "job-1"},
+		Command:    "echo data\necho diagnostics >&2\necho more data",
+		IsScript:   true,
+		TimeoutSec: 10,
+	})
+	require.NoError(t, err)
+
+	_, err = c.HandleRunCmdRequest(context.Background(), jobBytes)
+	require.NoError(t, err)
+	<-done
+
+	_, _, payload := connMock.InputSendRequest()
+	gotJob := models.Job{}
+	require.NoError(t, json.Unmarshal(payload, &gotJob))
+	assert.Equal(t, models.JobStatusSuccessful, gotJob.Status)
+	assert.Equal(t, &models.JobResult{StdOut: "data\nmore data\n", StdErr: "diagnostics\n"}, gotJob.Result)
+}
+
+func TestHandleRunCmdRequestTruncatesOutput(t *testing.T) {
+	connMock := test.NewConnMock()
+	done := make(chan bool)
+	connMock.DoneChannel = done
+	configCopy := getDefaultValidMinConfig()
+	configCopy.Client.DataDir = filepath.Join(configCopy.Client.DataDir, "TestHandleRunCmdRequestTruncatesOutput")
+	defer os.RemoveAll(configCopy.Client.DataDir)
+	require.NoError(t, PrepareDirs(&configCopy))
+	configCopy.RemoteScripts.Enabled = true
+	c := Client{
+		cmdExec:    NewCmdExecutor(testLog),
+		sshConn:    connMock,
+		Logger:     testLog,
+		config:     &configCopy,
+		systemInfo: &mockSystemInfo{ReturnHostname: "test-host"},
+	}
+	jobBytes, err := json.Marshal(models.Job{
+		JobSummary:    models.JobSummary{JID: "job-1"},
+		Command:       "echo 1234567890\necho diagnostics >&2",
+		IsScript:      true,
+		TimeoutSec:    10,
+		MaxResultSize: 5,
+	})
+	require.NoError(t, err)
+
+	_, err = c.HandleRunCmdRequest(context.Background(), jobBytes)
+	require.NoError(t, err)
+	<-done
+
+	_, _, payload := connMock.InputSendRequest()
+	gotJob := models.Job{}
+	require.NoError(t, json.Unmarshal(payload, &gotJob))
+	assert.Equal(t, models.JobStatusSuccessful, gotJob.Status)
+	assert.Empty(t, gotJob.Error)
+	assert.True(t, gotJob.Truncated)
+	assert.Equal(t, &models.JobResult{StdOut: "12345\n[truncated]", StdErr: "diagn\n[truncated]"}, gotJob.Result)
+}
+
+func TestHandleRunCmdRequestWithStdin(t *testing.T) {
+	connMock := test.NewConnMock()
+	done := make(chan bool)
+	connMock.DoneChannel = done
+	configCopy := getDefaultValidMinConfig()
+	configCopy.Client.DataDir = filepath.Join(configCopy.Client.DataDir, "TestHandleRunCmdRequestWithStdin")
+	defer os.RemoveAll(configCopy.Client.DataDir)
+	require.NoError(t, PrepareDirs(&configCopy))
+	c := Client{
+		cmdExec:    NewCmdExecutor(testLog),
+		sshConn:    connMock,
+		Logger:     testLog,
+		config:     &configCopy,
+		systemInfo: &mockSystemInfo{ReturnHostname: "test-host"},
+	}
+	jobBytes, err := json.Marshal(models.Job{
+		JobSummary: models.JobSummary{JID: "job-1"},
+		Command:    "cat",
+		TimeoutSec: 10,
+		Stdin:      "line1\nline2\n",
+	})
+	require.NoError(t, err)
+
+	_, err = c.HandleRunCmdRequest(context.Background(), jobBytes)
+	require.NoError(t, err)
+	<-done
+
+	_, _, payload := connMock.InputSendRequest()
+	gotJob := models.Job{}
+	require.NoError(t, json.Unmarshal(payload, &gotJob))
+	assert.Equal(t, models.JobStatusSuccessful, gotJob.Status)
+	assert.Equal(t, &models.JobResult{StdOut: "line1\nline2\n"}, gotJob.Result)
+	// stdin is not sent back
+	assert.Empty(t, gotJob.Stdin)
+}
+
+func TestHandleRunCmdRequestReportsUmask(t *testing.T) {
+	testCases := []struct {
+		name      string
+		umask     string
+		wantUmask string
+	}{
+		{
+			name:      "client umask",
+			umask:     "",
+			wantUmask: fmt.Sprintf("%04o", processUmask),
+		},
+		{
+			name:      "requested umask",
+			umask:     "27",
+			wantUmask: "0027",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			connMock := test.NewConnMock()
+			done := make(chan bool)
+			connMock.DoneChannel = done
+			configCopy := getDefaultValidMinConfig()
+			configCopy.Client.DataDir = filepath.Join(configCopy.Client.DataDir, "TestHandleRunCmdRequestReportsUmask")
+			defer os.RemoveAll(configCopy.Client.DataDir)
+			require.NoError(t, PrepareDirs(&configCopy))
+			c := Client{
+				cmdExec:    NewCmdExecutor(testLog),
+				sshConn:    connMock,
+				Logger:     testLog,
+				config:     &configCopy,
+				systemInfo: &mockSystemInfo{ReturnHostname: "test-host"},
+			}
+			jobBytes, err := json.Marshal(models.Job{
+				JobSummary: models.JobSummary{JID: "job-1"},
+				Command:    "true",
+				TimeoutSec: 10,
+				Umask:      tc.umask,
+			})
+			require.NoError(t, err)
+
+			_, err = c.HandleRunCmdRequest(context.Background(), jobBytes)
+			require.NoError(t, err)
+			<-done
+
+			_, _, payload := connMock.InputSendRequest()
+			gotJob := models.Job{}
+			require.NoError(t, json.Unmarshal(payload, &gotJob))
+			assert.Equal(t, tc.wantUmask, gotJob.Umask)
+		})
+	}
+}
+
+func TestHandleRunCmdRequestOversizeStdin(t *testing.T) {
+	configCopy := getDefaultValidMinConfig()
+	c := Client{
+		cmdExec: NewCmdExecutor(testLog),
+		Logger:  testLog,
+		config:  &configCopy,
+	}
+	jobBytes, err := json.Marshal(models.Job{
+		JobSummary: models.JobSummary{JID: "job-1"},
+		Command:    "cat",
+		TimeoutSec: 10,
+		Stdin:      strings.Repeat("a", models.MaxStdinSize+1),
+	})
+	require.NoError(t, err)
+
+	_, err = c.HandleRunCmdRequest(context.Background(), jobBytes)
+
+	assert.EqualError(t, err, fmt.Sprintf("stdin size %d exceeds the limit of %d bytes", models.MaxStdinSize+1, models.MaxStdinSize))
+}
@@ -2,6 +2,8 @@ package chclient
 
 import (
 	"context"
+	"crypto/ed25519"
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
@@ -18,6 +20,7 @@ import (
 
 	chshare "github.com/cloudradar-monitoring/rport/share"
 	"github.com/cloudradar-monitoring/rport/share/comm"
+	"github.com/cloudradar-monitoring/rport/share/models"
 	"github.com/cloudradar-monitoring/rport/share/test"
 )
 
@@ -29,7 +32,9 @@ type CmdExecutorMock struct {
 	ReturnStdOut   []string
 	ReturnStdErr   []string
 
-	wg sync.WaitGroup
+	// wgs tracks output writes per command, commands can run concurrently
+	wgs   map[*exec.Cmd]*sync.WaitGroup
+	wgsMu sync.Mutex
 }
 
 func NewCmdExecutorMock() *CmdExecutorMock {
@@ -58,16 +63,28 @@ func (e *CmdExecutorMock) Start(cmd *exec.Cmd) error {
 	}
 
 	// mock output to stdout and stderr
-	e.wg.Add(1)
-	go e.writeToStdOut(cmd)
-	e.wg.Add(1)
-	go e.writeToStdErr(cmd)
+	wg := e.getWaitGroup(cmd)
+	wg.Add(2)
+	go e.writeToStdOut(cmd, wg)
+	go e.writeToStdErr(cmd, wg)
 
 	return nil
 }
 
-func (e *CmdExecutorMock) writeToStdOut(cmd *exec.Cmd) {
-	defer e.wg.Done()
+func (e *CmdExecutorMock) getWaitGroup(cmd *exec.Cmd) *sync.WaitGroup {
+	e.wgsMu.Lock()
+	defer e.wgsMu.Unlock()
+	if e.wgs == nil {
+		e.wgs = make(map[*exec.Cmd]*sync.WaitGroup)
+	}
+	if e.wgs[cmd] == nil {
+		e.wgs[cmd] = &sync.WaitGroup{}
+	}
+	return e.wgs[cmd]
+}
+
+func (e *CmdExecutorMock) writeToStdOut(cmd *exec.Cmd, wg *sync.WaitGroup) {
+	defer wg.Done()
 
 	for _, s := range e.ReturnStdOut {
 		_, err := cmd.Stdout.Write([]byte(s))
@@ -78,8 +95,8 @@ func (e *CmdExecutorMock) writeToStdOut(cmd *exec.Cmd) {
 	}
 }
 
-func (e *CmdExecutorMock) writeToStdErr(cmd *exec.Cmd) {
-	defer e.wg.Done()
+func (e *CmdExecutorMock) writeToStdErr(cmd *exec.Cmd, wg *sync.WaitGroup) {
+	defer wg.Done()
 
 	for _, s := range e.ReturnStdErr {
 		_, err := cmd.Stderr.Write([]byte(s))
@@ -94,7 +111,7 @@ func (e *CmdExecutorMock) Wait(cmd *exec.Cmd) error {
 	if e.ReturnWaitErr != nil {
 		return e.ReturnWaitErr
 	}
-	e.wg.Wait()
+	e.getWaitGroup(cmd).Wait()
 	// wait if needed
 	if e.DoneChannel != nil {
 		e.DoneChannel <- true
@@ -120,7 +137,9 @@ const jobToRunJSON = `
 	"created_by": "admin",
 	"timeout_sec": 60,
 	"is_sudo": true,
-	"cwd": "/root"
+	"cwd": "/root",
+	"env": {"FOO": "bar"},
+	"env_keys": ["FOO"]
 }
 `
 const scriptToRunJSON = `
@@ -247,6 +266,7 @@ func TestHandleRunCmdRequestPositiveCase(t *testing.T) {
 	now = nowMockF
 
 	// given
+	defer func(f func(string, string, bool) (string, error)) { getInterpreter = f }(getInterpreter)
 	getInterpreter = func(inputInterpreter, os string, hashShebang bool) (string, error) {
 		return "test-interpreter", nil
 	}
@@ -261,10 +281,11 @@ func TestHandleRunCmdRequestPositiveCase(t *testing.T) {
 	connMock.DoneChannel = done
 	configCopy := getDefaultValidMinConfig()
 	c := Client{
-		cmdExec: execMock,
-		sshConn: connMock,
-		Logger:  testLog,
-		config:  &configCopy,
+		cmdExec:    execMock,
+		sshConn:    connMock,
+		Logger:     testLog,
+		config:     &configCopy,
+		systemInfo: &mockSystemInfo{ReturnHostname: "test-host"},
 	}
 
 	configCopy.Client.DataDir = filepath.Join(configCopy.Client.DataDir, "TestHandleRunCmdRequestPositiveCase")
@@ -291,8 +312,12 @@ func TestHandleRunCmdRequestPositiveCase(t *testing.T) {
 	"cwd": "/root",
 	"timeout_sec": 60,
 	"multi_job_id":null,
+	"env_keys": ["FOO"],
 	"error":"%s",
 `
+	if umask := effectiveUmask(nil); umask != "" {
+		wantJSONPart1 += `"umask": "` + umask + `",`
+	}
 	wantJSONPart2 := `
 	  "result": {
 			"stdout": "output1output2output3",
@@ -300,6 +325,14 @@ func TestHandleRunCmdRequestPositiveCase(t *testing.T) {
 		}
 	}
 	`
+	wantMetadataJSON := `
+	"execution_metadata": {
+		"hostname": "test-host",
+		"started_at": "2020-08-19T12:00:00+03:00",
+		"finished_at": "2020-08-19T12:00:00+03:00",
+		"exit_code": 0
+	},
+`
 	stdOutSize := len(strings.Join(execMock.ReturnStdOut, ""))
 	stdErrSize := len(strings.Join(execMock.ReturnStdErr, ""))
 
@@ -313,17 +346,17 @@ func TestHandleRunCmdRequestPositiveCase(t *testing.T) {
 		{
 			name:          "limit is larger than stdout and stderr",
 			sendBackLimit: stdOutSize + 1,
-			wantJSON:      fmt.Sprintf(wantJSONPart1, "") + wantJSONPart2,
+			wantJSON:      fmt.Sprintf(wantJSONPart1, "") + wantMetadataJSON + wantJSONPart2,
 		},
 		{
 			name:          "limit is equal to the larger output",
 			sendBackLimit: stdOutSize,
-			wantJSON:      fmt.Sprintf(wantJSONPart1, "") + wantJSONPart2,
+			wantJSON:      fmt.Sprintf(wantJSONPart1, "") + wantMetadataJSON + wantJSONPart2,
 		},
 		{
 			name:          "limit is equal to the smaller output",
 			sendBackLimit: stdErrSize,
-			wantJSON: fmt.Sprintf(wantJSONPart1, "overflow of stdOut buffer: maximum send_back_limit of 12 bytes exceeded") + `
+			wantJSON: fmt.Sprintf(wantJSONPart1, "overflow of stdOut buffer: maximum send_back_limit of 12 bytes exceeded") + wantMetadataJSON + `
        "result": {
        "stdout": "output1outpu",
        "stderr": "error1error2"
@@ -333,7 +366,7 @@ func TestHandleRunCmdRequestPositiveCase(t *testing.T) {
 		{
 			name:          "limit is less than smaller output",
 			sendBackLimit: stdErrSize - 1,
-			wantJSON: fmt.Sprintf(wantJSONPart1, "overflow of stdOut buffer: maximum send_back_limit of 11 bytes exceeded, overflow of stdErr buffer: maximum send_back_limit of 11 bytes exceeded") + `
+			wantJSON: fmt.Sprintf(wantJSONPart1, "overflow of stdOut buffer: maximum send_back_limit of 11 bytes exceeded, overflow of stdErr buffer: maximum send_back_limit of 11 bytes exceeded") + wantMetadataJSON + `
 		"result": {
 		"stdout": "output1outp",
 		"stderr": "error1error"
@@ -343,7 +376,7 @@ func TestHandleRunCmdRequestPositiveCase(t *testing.T) {
 		{
 			name:          "limit is zero",
 			sendBackLimit: 0,
-			wantJSON: fmt.Sprintf(wantJSONPart1, "overflow of stdOut buffer: maximum send_back_limit of 0 bytes exceeded, overflow of stdErr buffer: maximum send_back_limit of 0 bytes exceeded") + `
+			wantJSON: fmt.Sprintf(wantJSONPart1, "overflow of stdOut buffer: maximum send_back_limit of 0 bytes exceeded, overflow of stdErr buffer: maximum send_back_limit of 0 bytes exceeded") + wantMetadataJSON + `
 				"result": {
 				"stdout": "",
 				"stderr": ""
@@ -414,10 +447,11 @@ func TestHandleRunCmdRequestHasRunningCmd(t *testing.T) {
 	}()
 
 	c := Client{
-		cmdExec: execMock,
-		sshConn: connMock,
-		Logger:  testLog,
-		config:  &configCopy,
+		cmdExec:    execMock,
+		sshConn:    connMock,
+		Logger:     testLog,
+		config:     &configCopy,
+		systemInfo: &mockSystemInfo{ReturnHostname: "test-host"},
 	}
 
 	err := PrepareDirs(&configCopy)
@@ -433,24 +467,115 @@ func TestHandleRunCmdRequestHasRunningCmd(t *testing.T) {
 
 	// then
 	// check that running new commands is blocked
-	curPID := c.getCurCmdPID()
-	require.NotNil(t, curPID)
-	assert.Equal(t, wantPID, *curPID)
+	assert.Equal(t, []int{wantPID}, c.getCmdPIDs())
 	// finish the cmd execution
 	<-doneCmd
 	// finish to send the response to server
 	<-doneSendResp
 	// check that running new commands is not blocked anymore
-	curPID = c.getCurCmdPID()
-	assert.Nil(t, curPID)
+	assert.Empty(t, c.getCmdPIDs())
 
 	assert.Equal(t, &comm.RunCmdResponse{Pid: wantPID, StartedAt: nowMock}, res1)
 
 	require.Error(t, err2)
-	assert.Equal(t, fmt.Errorf("a previous command execution with PID %d is still running", wantPID), err2)
+	assert.Equal(t, fmt.Errorf("max concurrent commands limit (1) is reached, running PIDs: [%d]", wantPID), err2)
 	assert.Nil(t, res2)
 }
 
+func TestHandleRunCmdRequestMaxConcurrent(t *testing.T) {
+	now = nowMockF
+
+	testCases := []struct {
+		name          string
+		queueWhenBusy bool
+	}{
+		{
+			name: "refuse when busy",
+		},
+		{
+			name:          "queue when busy",
+			queueWhenBusy: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// given
+			execMock := NewCmdExecutorMock()
+			execMock.ReturnPID = 123
+			doneCmd := make(chan bool)
+			execMock.DoneChannel = doneCmd
+			connMock := test.NewConnMock()
+			doneSendResp := make(chan bool)
+			connMock.DoneChannel = doneSendResp
+
+			configCopy := getDefaultValidMinConfig()
+			configCopy.Client.DataDir = filepath.Join(configCopy.Client.DataDir, "TestHandleRunCmdRequestMaxConcurrent")
+			configCopy.RemoteCommands.MaxConcurrent = 2
+			configCopy.RemoteCommands.QueueWhenBusy = tc.queueWhenBusy
+			defer os.RemoveAll(configCopy.Client.DataDir)
+			require.NoError(t, PrepareDirs(&configCopy))
+
+			c := Client{
+				cmdExec:    execMock,
+				sshConn:    connMock,
+				Logger:     testLog,
+				config:     &configCopy,
+				systemInfo: &mockSystemInfo{ReturnHostname: "test-host"},
+			}
+
+			// when
+			_, err := c.HandleRunCmdRequest(context.Background(), []byte(jobToRunJSON))
+			require.NoError(t, err)
+			_, err = c.HandleRunCmdRequest(context.Background(), []byte(jobToRunJSON))
+			require.NoError(t, err)
+
+			type result struct {
+				res *comm.RunCmdResponse
+				err error
+			}
+			thirdDone := make(chan result, 1)
+			go func() {
+				res, err := c.HandleRunCmdRequest(context.Background(), []byte(jobToRunJSON))
+				thirdDone <- result{res: res, err: err}
+			}()
+
+			// then
+			if !tc.queueWhenBusy {
+				got := <-thirdDone
+				require.Error(t, got.err)
+				assert.Contains(t, got.err.Error(), "max concurrent commands limit (2) is reached")
+				assert.Nil(t, got.res)
+			} else {
+				select {
+				case <-thirdDone:
+					require.Fail(t, "command should wait for a free slot")
+				case <-time.After(100 * time.Millisecond):
+				}
+			}
+
+			// finish one of the running commands to free a slot
+			<-doneCmd
+			<-doneSendResp
+
+			if tc.queueWhenBusy {
+				got := <-thirdDone
+				require.NoError(t, got.err)
+				assert.Equal(t, &comm.RunCmdResponse{Pid: 123, StartedAt: nowMock}, got.res)
+			} else {
+				_, err = c.HandleRunCmdRequest(context.Background(), []byte(jobToRunJSON))
+				require.NoError(t, err)
+			}
+
+			// finish remaining commands
+			for i := 0; i < 2; i++ {
+				<-doneCmd
+				<-doneSendResp
+			}
+		})
+	}
+}
+
 func TestRemoteCommandsDisabled(t *testing.T) {
 	// given
 	c := Client{
@@ -492,6 +617,191 @@ func TestRemoteScriptsDisabled(t *testing.T) {
 	require.EqualError(t, gotErr, "remote scripts are disabled")
 }
 
+func TestHandleRunCmdRequestInvalidWorkingDir(t *testing.T) {
+	config := getDefaultValidMinConfig()
+	config.RemoteCommands.allowRegexp = getRegexpList([]string{".*"})
+	c := Client{
+		Logger: testLog,
+		config: &config,
+	}
+
+	_, gotErr := c.HandleRunCmdRequest(context.Background(), []byte(`{"command": "/bin/date", "cwd": "/not/existing/dir"}`))
+
+	require.Error(t, gotErr)
+	assert.Contains(t, gotErr.Error(), "invalid working directory")
+}
+
+func TestHandleRunCmdRequestSignature(t *testing.T) {
+	now = nowMockF
+
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	_, otherPrivKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	newJob := func() *models.Job {
+		return &models.Job{
+			JobSummary: models.JobSummary{JID: "5f02b216-3f8a-42be-b66c-f4c1d0ea3809"},
+			ClientID:   "d81e6b93e75aef59a7701b90555f43808458b34e30370c3b808c1816a32252b3",
+			Command:    "/bin/date",
+			TimeoutSec: 60,
+		}
+	}
+	signedJob := func(key ed25519.PrivateKey) *models.Job {
+		job := newJob()
+		require.NoError(t, job.Sign(key, nowMock.Add(time.Minute)))
+		return job
+	}
+	tamperedJob := signedJob(privKey)
+	tamperedJob.Command = "rm -rf /"
+	tamperedStdinJob := newJob()
+	tamperedStdinJob.Stdin = "data"
+	require.NoError(t, tamperedStdinJob.Sign(privKey, nowMock.Add(time.Minute)))
+	tamperedStdinJob.Stdin = "other data"
+	expiredJob := newJob()
+	require.NoError(t, expiredJob.Sign(privKey, nowMock.Add(-time.Second)))
+
+	testCases := []struct {
+		name             string
+		publicKey        ed25519.PublicKey
+		requireSignature bool
+		job              *models.Job
+		wantErr          string
+	}{
+		{
+			name:             "valid signature",
+			publicKey:        pubKey,
+			requireSignature: true,
+			job:              signedJob(privKey),
+		},
+		{
+			name:             "signed by another key",
+			publicKey:        pubKey,
+			requireSignature: true,
+			job:              signedJob(otherPrivKey),
+			wantErr:          "invalid command signature",
+		},
+		{
+			name:             "tampered command",
+			publicKey:        pubKey,
+			requireSignature: true,
+			job:              tamperedJob,
+			wantErr:          "invalid command signature",
+		},
+		{
+			name:             "tampered stdin",
+			publicKey:        pubKey,
+			requireSignature: true,
+			job:              tamperedStdinJob,
+			wantErr:          "invalid command signature",
+		},
+		{
+			name:             "expired signature",
+			publicKey:        pubKey,
+			requireSignature: true,
+			job:              expiredJob,
+			wantErr:          "command signature is expired",
+		},
+		{
+			name:             "unsigned, signature required",
+			publicKey:        pubKey,
+			requireSignature: true,
+			job:              newJob(),
+			wantErr:          "command is not signed",
+		},
+		{
+			name:      "invalid signature, signature not required",
+			publicKey: pubKey,
+			job:       signedJob(otherPrivKey),
+			wantErr:   "invalid command signature",
+		},
+		{
+			name:      "unsigned, signature not required",
+			publicKey: pubKey,
+			job:       newJob(),
+		},
+		{
+			name: "unsigned, no public key",
+			job:  newJob(),
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			execMock := NewCmdExecutorMock()
+			execMock.ReturnPID = 123
+			connMock := test.NewConnMock()
+			done := make(chan bool)
+			connMock.DoneChannel = done
+
+			configCopy := getDefaultValidMinConfig()
+			configCopy.Client.DataDir = filepath.Join(configCopy.Client.DataDir, "TestHandleRunCmdRequestSignature")
+			defer os.RemoveAll(configCopy.Client.DataDir)
+			require.NoError(t, PrepareDirs(&configCopy))
+			configCopy.RemoteCommands.RequireSignature = tc.requireSignature
+			configCopy.RemoteCommands.signaturePublicKey = tc.publicKey
+
+			c := Client{
+				cmdExec:    execMock,
+				sshConn:    connMock,
+				Logger:     testLog,
+				config:     &configCopy,
+				systemInfo: &mockSystemInfo{ReturnHostname: "test-host"},
+			}
+			payload, err := json.Marshal(tc.job)
+			require.NoError(t, err)
+
+			res, err := c.HandleRunCmdRequest(context.Background(), payload)
+
+			if tc.wantErr != "" {
+				require.EqualError(t, err, tc.wantErr)
+				assert.Nil(t, res)
+				assert.Empty(t, c.getCmdPIDs())
+				return
+			}
+			require.NoError(t, err)
+			<-done
+			assert.Equal(t, &comm.RunCmdResponse{Pid: 123, StartedAt: nowMock}, res)
+		})
+	}
+}
+
+func TestVerifyJobSignatureRejectsReplay(t *testing.T) {
+	now = nowMockF
+	defer func() { now = nowMockF }()
+
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	config := getDefaultValidMinConfig()
+	config.RemoteCommands.signaturePublicKey = pubKey
+	c := Client{config: &config}
+
+	job := &models.Job{
+		JobSummary: models.JobSummary{JID: "5f02b216-3f8a-42be-b66c-f4c1d0ea3809"},
+		Command:    "/bin/date",
+	}
+	require.NoError(t, job.Sign(privKey, nowMock.Add(time.Minute)))
+
+	require.NoError(t, c.verifyJobSignature(job))
+	assert.EqualError(t, c.verifyJobSignature(job), `command with job id "5f02b216-3f8a-42be-b66c-f4c1d0ea3809" was already received`)
+
+	other := &models.Job{
+		JobSummary: models.JobSummary{JID: "6a5bf5d4-8e4c-4c4c-9d1a-0c2f1e7c1e55"},
+		Command:    "/bin/date",
+	}
+	require.NoError(t, other.Sign(privKey, nowMock.Add(2*time.Minute)))
+	assert.NoError(t, c.verifyJobSignature(other))
+
+	// expired jobs are forgotten
+	now = func() time.Time { return nowMock.Add(90 * time.Second) }
+	assert.EqualError(t, c.verifyJobSignature(job), "command signature is expired")
+	other.JID = "8f6e2c1a-3b7d-4e5f-a9c0-1d2e3f4a5b6c"
+	require.NoError(t, other.Sign(privKey, nowMock.Add(3*time.Minute)))
+	assert.NoError(t, c.verifyJobSignature(other))
+	assert.Len(t, c.signedJobs, 2)
+}
+
 func TestIsCommandAllowed(t *testing.T) {
 	defaultTestAllow := []string{"^/usr/bin.*", "^/usr/local/bin/.*", `^C:\\Windows\\System32.*`}
 	testCases := []struct {
@@ -623,6 +933,104 @@ func TestIsCommandAllowed(t *testing.T) {
 	}
 }
 
+func TestHandleValidateCmdRequest(t *testing.T) {
+	notDir := filepath.Join(t.TempDir(), "file.txt")
+	require.NoError(t, os.WriteFile(notDir, []byte("some"), 0600))
+	testCases := []struct {
+		name string
+
+		payload        string
+		commandsOff    bool
+		scriptsOff     bool
+		deny           []string
+		wantResp       *comm.ValidateCmdResponse
+		wantErrContain string
+	}{
+		{
+			name:     "allowed",
+			payload:  `{"command": "/usr/bin/date"}`,
+			wantResp: &comm.ValidateCmdResponse{Allowed: true},
+		},
+		{
+			name:     "allowed with working dir",
+			payload:  `{"command": "/usr/bin/date", "cwd": "` + filepath.ToSlash(t.TempDir()) + `"}`,
+			wantResp: &comm.ValidateCmdResponse{Allowed: true},
+		},
+		{
+			name:        "remote commands disabled",
+			payload:     `{"command": "/usr/bin/date"}`,
+			commandsOff: true,
+			wantResp:    comm.NewCmdDenied(comm.CmdRuleRemoteCommands, "remote commands execution is disabled"),
+		},
+		{
+			name:       "remote scripts disabled",
+			payload:    `{"command": "/usr/bin/date", "is_script": true}`,
+			scriptsOff: true,
+			wantResp:   comm.NewCmdDenied(comm.CmdRuleRemoteScripts, "remote scripts are disabled"),
+		},
+		{
+			name:     "denied by deny list",
+			payload:  `{"command": "/usr/bin/zip"}`,
+			deny:     []string{"^/usr/bin/zip.*"},
+			wantResp: comm.NewCmdDenied(comm.CmdRuleAllowDenyList, "command is not allowed: /usr/bin/zip"),
+		},
+		{
+			name:     "invalid interpreter",
+			payload:  `{"command": "/usr/bin/date", "interpreter": "unknown"}`,
+			wantResp: &comm.ValidateCmdResponse{Rule: comm.CmdRuleInterpreter},
+		},
+		{
+			name:     "working dir not found",
+			payload:  `{"command": "/usr/bin/date", "cwd": "/not/existing/dir"}`,
+			wantResp: &comm.ValidateCmdResponse{Rule: comm.CmdRuleWorkingDir},
+		},
+		{
+			name:     "working dir is a file",
+			payload:  `{"command": "/usr/bin/date", "cwd": "` + filepath.ToSlash(notDir) + `"}`,
+			wantResp: comm.NewCmdDenied(comm.CmdRuleWorkingDir, fmt.Sprintf("working directory %s is not a directory", filepath.ToSlash(notDir))),
+		},
+		{
+			name:           "invalid payload",
+			payload:        `{"command": `,
+			wantErrContain: "failed to decode requested job",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// given
+			config := getDefaultValidMinConfig()
+			config.RemoteCommands.Enabled = !tc.commandsOff
+			config.RemoteScripts.Enabled = !tc.scriptsOff
+			config.RemoteCommands.Order = allowDenyOrder
+			config.RemoteCommands.allowRegexp = getRegexpList([]string{".*"})
+			config.RemoteCommands.denyRegexp = getRegexpList(tc.deny)
+			c := Client{
+				Logger: testLog,
+				config: &config,
+			}
+
+			// when
+			gotResp, gotErr := c.HandleValidateCmdRequest([]byte(tc.payload))
+
+			// then
+			if tc.wantErrContain != "" {
+				require.Error(t, gotErr)
+				assert.Contains(t, gotErr.Error(), tc.wantErrContain)
+				return
+			}
+			require.NoError(t, gotErr)
+			if tc.wantResp.Allowed || tc.wantResp.Reason != "" {
+				assert.Equal(t, tc.wantResp, gotResp)
+			} else {
+				assert.False(t, gotResp.Allowed)
+				assert.Equal(t, tc.wantResp.Rule, gotResp.Rule)
+				assert.NotEmpty(t, gotResp.Reason)
+			}
+		})
+	}
+}
+
 func getRegexpList(list []string) []*regexp.Regexp {
 	var res []*regexp.Regexp
 	for _, v := range list {
@@ -630,3 +1038,67 @@ func getRegexpList(list []string) []*regexp.Regexp {
 	}
 	return res
 }
+
+func TestCapacityBufferTruncate(t *testing.T) {
+	testCases := []struct {
+		name          string
+		capacity      int
+		truncateAt    int
+		writes        []string
+		wantResult    string
+		wantTruncated bool
+		wantOverflow  bool
+	}{
+		{
+			name:       "no limit",
+			capacity:   100,
+			writes:     []string{"abc", "def"},
+			wantResult: "abcdef",
+		},
+		{
+			name:       "within limit",
+			capacity:   100,
+			truncateAt: 6,
+			writes:     []string{"abc", "def"},
+			wantResult: "abcdef",
+		},
+		{
+			name:          "exceeds limit",
+			capacity:      100,
+			truncateAt:    4,
+			writes:        []string{"abc", "def", "ghi"},
+			wantResult:    "abcd" + truncatedMarker,
+			wantTruncated: true,
+		},
+		{
+			name:         "capacity is less than limit",
+			capacity:     4,
+			truncateAt:   6,
+			writes:       []string{"abc", "def"},
+			wantResult:   "abcd",
+			wantOverflow: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			b := &CapacityBuffer{capacity: tc.capacity, truncateAt: tc.truncateAt}
+
+			var gotErr error
+			for _, w := range tc.writes {
+				n, err := b.Write([]byte(w))
+				if err != nil {
+					gotErr = err
+					break
+				}
+				assert.Equal(t, len(w), n)
+			}
+
+			assert.Equal(t, tc.wantOverflow, gotErr != nil)
+			assert.Equal(t, tc.wantOverflow, b.HasOverflow())
+			assert.Equal(t, tc.wantTruncated, b.Truncated())
+			assert.Equal(t, tc.wantResult, b.Result())
+		})
+	}
+}
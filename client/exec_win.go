@@ -4,6 +4,7 @@ package chclient
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -24,14 +25,17 @@ func (e *CmdExecutorImpl) New(ctx context.Context, execCtx *CmdExecutorContext)
 		e.Debugf("resolved absolute interpreter path %s for interpreter %s", absInterpreterPath, execCtx.Interpreter)
 	}
 
+	var cmd *exec.Cmd
 	switch execCtx.Interpreter {
 	case chshare.CmdShell:
-		return buildCmdInterpreterCmd(ctx, execCtx, interpreterPath)
+		cmd = buildCmdInterpreterCmd(ctx, execCtx, interpreterPath)
 	case chshare.PowerShell:
-		return buildPowershellCmd(ctx, execCtx, interpreterPath)
+		cmd = buildPowershellCmd(ctx, execCtx, interpreterPath)
 	default:
-		return buildDefaultCmd(ctx, execCtx, interpreterPath)
+		cmd = buildDefaultCmd(ctx, execCtx, interpreterPath)
 	}
+	cmd.Env = cmdEnv(execCtx.Env)
+	return cmd
 }
 
 func buildCmdInterpreterCmd(ctx context.Context, execCtx *CmdExecutorContext, interpreterPath string) *exec.Cmd {
@@ -92,3 +96,38 @@ func getInterpreterAbsolutePath(interpreter string) (absInterpreterPath string,
 
 	return "", fmt.Errorf("failed to find %s at %%PATH%%: %s: %w", interpreter, path, os.ErrNotExist)
 }
+
+// parseJobUmask returns an error if a umask is set, it's not supported on Windows.
+func parseJobUmask(umask string) (*int, error) {
+	if umask != "" {
+		return nil, errors.New("umask is not supported on Windows")
+	}
+	return nil, nil
+}
+
+// validateJobRunAs returns an error if a user to run a job as is set, the executor can't impersonate users on Windows.
+func validateJobRunAs(runAs string) error {
+	if runAs != "" {
+		return errors.New("running commands as another user is not supported on Windows")
+	}
+	return nil
+}
+
+// createRunAsScriptFile returns an error, running commands as another user is not supported on Windows.
+func createRunAsScriptFile(ctx context.Context, runAs, script string) (string, error) {
+	return "", errors.New("running commands as another user is not supported on Windows")
+}
+
+// removeRunAsScriptFile returns an error, running commands as another user is not supported on Windows.
+func removeRunAsScriptFile(runAs, scriptPath string) error {
+	return errors.New("running commands as another user is not supported on Windows")
+}
+
+// effectiveUmask returns an empty umask, it's not applicable on Windows.
+func effectiveUmask(umask *int) string {
+	return ""
+}
+
+func (c *Client) startCmd(cmd *exec.Cmd, umask *int) error {
+	return c.cmdExec.Start(cmd)
+}
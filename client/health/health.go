@@ -0,0 +1,192 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	chshare "github.com/cloudradar-monitoring/rport/share"
+	"github.com/cloudradar-monitoring/rport/share/comm"
+	"github.com/cloudradar-monitoring/rport/share/models"
+)
+
+type Config struct {
+	// Interval is how often the health state is refreshed, 0 disables health reporting.
+	Interval             time.Duration `mapstructure:"interval"`
+	DiskPath             string        `mapstructure:"disk_path"`
+	DiskDegradedPercent  float64       `mapstructure:"disk_degraded_percent"`
+	DiskUnhealthyPercent float64       `mapstructure:"disk_unhealthy_percent"`
+	// LoadDegraded and LoadUnhealthy are thresholds of 1 minute load average per CPU.
+	LoadDegraded  float64 `mapstructure:"load_degraded"`
+	LoadUnhealthy float64 `mapstructure:"load_unhealthy"`
+	// Hooks are executables run on each refresh. Exit code 1 makes a client degraded, other non-zero codes unhealthy.
+	Hooks []string `mapstructure:"hooks"`
+}
+
+func (c *Config) Validate() error {
+	if c.Interval < 0 {
+		return fmt.Errorf("interval can not be negative: %v", c.Interval)
+	}
+	if c.DiskDegradedPercent < 0 || c.DiskDegradedPercent > 100 {
+		return fmt.Errorf("disk degraded percent should be between 0 and 100: %v", c.DiskDegradedPercent)
+	}
+	if c.DiskUnhealthyPercent < 0 || c.DiskUnhealthyPercent > 100 {
+		return fmt.Errorf("disk unhealthy percent should be between 0 and 100: %v", c.DiskUnhealthyPercent)
+	}
+	if c.DiskUnhealthyPercent < c.DiskDegradedPercent {
+		return fmt.Errorf("disk unhealthy percent %v can not be less than degraded percent %v", c.DiskUnhealthyPercent, c.DiskDegradedPercent)
+	}
+	if c.LoadDegraded < 0 || c.LoadUnhealthy < 0 {
+		return fmt.Errorf("load thresholds can not be negative: %v, %v", c.LoadDegraded, c.LoadUnhealthy)
+	}
+	if c.LoadUnhealthy < c.LoadDegraded {
+		return fmt.Errorf("load unhealthy %v can not be less than degraded %v", c.LoadUnhealthy, c.LoadDegraded)
+	}
+	for _, hook := range c.Hooks {
+		if !filepath.IsAbs(hook) {
+			return fmt.Errorf("hook should be an absolute path: %q", hook)
+		}
+	}
+	return nil
+}
+
+// SystemStats provides the inputs of the health checks.
+type SystemStats interface {
+	DiskUsedPercent(ctx context.Context, path string) (float64, error)
+	// LoadPerCPU returns 1 minute load average divided by the number of CPUs.
+	LoadPerCPU(ctx context.Context) (float64, error)
+	// RunHook runs a given executable and returns its exit code, an error is returned if it can't be run.
+	RunHook(ctx context.Context, path string) (int, error)
+}
+
+type Health struct {
+	// mtx protects both conn and status
+	mtx    sync.RWMutex
+	conn   ssh.Conn
+	status *models.HealthStatus
+
+	config Config
+	stats  SystemStats
+	logger *chshare.Logger
+}
+
+func New(logger *chshare.Logger, config Config) *Health {
+	return &Health{
+		config: config,
+		stats:  systemStats{},
+		logger: logger,
+	}
+}
+
+func (h *Health) Start(ctx context.Context) {
+	if h.config.Interval <= 0 {
+		return
+	}
+
+	go h.refreshLoop(ctx)
+}
+
+func (h *Health) refreshLoop(ctx context.Context) {
+	for {
+		h.refreshStatus(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(h.config.Interval):
+		}
+	}
+}
+
+func (h *Health) refreshStatus(ctx context.Context) {
+	newStatus := h.evaluate(ctx)
+	newStatus.Refreshed = time.Now()
+
+	h.mtx.Lock()
+	if h.status == nil || h.status.State != newStatus.State {
+		h.logger.Infof("Health state changed to %s %v", newStatus.State, newStatus.Reasons)
+	}
+	h.status = newStatus
+	h.mtx.Unlock()
+
+	go h.sendStatus()
+}
+
+// evaluate runs all the checks. A failing check makes a client unhealthy or degraded, the worst state wins.
+// A check that can't be run makes a client degraded.
+func (h *Health) evaluate(ctx context.Context) *models.HealthStatus {
+	status := &models.HealthStatus{
+		State:   models.HealthHealthy,
+		Reasons: []string{},
+	}
+	setState := func(state, reason string) {
+		if state == models.HealthUnhealthy || status.State == models.HealthHealthy {
+			status.State = state
+		}
+		status.Reasons = append(status.Reasons, reason)
+	}
+
+	diskUsed, err := h.stats.DiskUsedPercent(ctx, h.config.DiskPath)
+	if err != nil {
+		setState(models.HealthDegraded, fmt.Sprintf("failed to get disk usage of %s: %v", h.config.DiskPath, err))
+	} else if h.config.DiskUnhealthyPercent > 0 && diskUsed >= h.config.DiskUnhealthyPercent {
+		setState(models.HealthUnhealthy, fmt.Sprintf("disk usage of %s is %.1f%%", h.config.DiskPath, diskUsed))
+	} else if h.config.DiskDegradedPercent > 0 && diskUsed >= h.config.DiskDegradedPercent {
+		setState(models.HealthDegraded, fmt.Sprintf("disk usage of %s is %.1f%%", h.config.DiskPath, diskUsed))
+	}
+
+	loadPerCPU, err := h.stats.LoadPerCPU(ctx)
+	if err != nil {
+		setState(models.HealthDegraded, fmt.Sprintf("failed to get load: %v", err))
+	} else if h.config.LoadUnhealthy > 0 && loadPerCPU >= h.config.LoadUnhealthy {
+		setState(models.HealthUnhealthy, fmt.Sprintf("load per CPU is %.2f", loadPerCPU))
+	} else if h.config.LoadDegraded > 0 && loadPerCPU >= h.config.LoadDegraded {
+		setState(models.HealthDegraded, fmt.Sprintf("load per CPU is %.2f", loadPerCPU))
+	}
+
+	for _, hook := range h.config.Hooks {
+		exitCode, err := h.stats.RunHook(ctx, hook)
+		if err != nil {
+			setState(models.HealthDegraded, fmt.Sprintf("failed to run hook %s: %v", hook, err))
+		} else if exitCode == 1 {
+			setState(models.HealthDegraded, fmt.Sprintf("hook %s exited with code %d", hook, exitCode))
+		} else if exitCode != 0 {
+			setState(models.HealthUnhealthy, fmt.Sprintf("hook %s exited with code %d", hook, exitCode))
+		}
+	}
+
+	return status
+}
+
+// sendStatus sends the health status in background, it's called both after status is refreshed or conn set
+func (h *Health) sendStatus() {
+	h.mtx.RLock()
+	defer h.mtx.RUnlock()
+
+	if h.conn != nil && h.status != nil {
+		data, err := json.Marshal(h.status)
+		if err != nil {
+			h.logger.Errorf("Could not marshal json for health status: %v", err)
+			return
+		}
+
+		_, _, err = h.conn.SendRequest(comm.RequestTypeHealthStatus, false, data)
+		if err != nil {
+			h.logger.Errorf("Could not send health status: %v", err)
+			return
+		}
+	}
+}
+
+func (h *Health) SetConn(c ssh.Conn) {
+	h.mtx.Lock()
+	defer h.mtx.Unlock()
+
+	h.conn = c
+	go h.sendStatus()
+}
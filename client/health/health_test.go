@@ -0,0 +1,239 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	chshare "github.com/cloudradar-monitoring/rport/share"
+	"github.com/cloudradar-monitoring/rport/share/comm"
+	"github.com/cloudradar-monitoring/rport/share/models"
+)
+
+type mockSystemStats struct {
+	diskUsed float64
+	diskErr  error
+	load     float64
+	loadErr  error
+	// hooks are exit codes of hooks by their paths, a hook without a code fails to run
+	hooks map[string]int
+}
+
+func (s *mockSystemStats) DiskUsedPercent(context.Context, string) (float64, error) {
+	return s.diskUsed, s.diskErr
+}
+
+func (s *mockSystemStats) LoadPerCPU(context.Context) (float64, error) {
+	return s.load, s.loadErr
+}
+
+func (s *mockSystemStats) RunHook(_ context.Context, path string) (int, error) {
+	exitCode, ok := s.hooks[path]
+	if !ok {
+		return 0, errors.New("file not found")
+	}
+	return exitCode, nil
+}
+
+type mockSSHRequest struct {
+	Name string
+	Data []byte
+}
+
+type mockSSHConn struct {
+	ssh.Conn
+
+	requests chan mockSSHRequest
+}
+
+func (c *mockSSHConn) SendRequest(name string, _ bool, data []byte) (bool, []byte, error) {
+	c.requests <- mockSSHRequest{
+		Name: name,
+		Data: data,
+	}
+
+	return false, nil, nil
+}
+
+var testConfig = Config{
+	Interval:             time.Minute,
+	DiskPath:             "/",
+	DiskDegradedPercent:  80,
+	DiskUnhealthyPercent: 95,
+	LoadDegraded:         1,
+	LoadUnhealthy:        2,
+}
+
+var testHooks = []string{"/hooks/backup", "/hooks/raid"}
+
+func TestHealthEvaluate(t *testing.T) {
+	logger := chshare.NewLogger("test", chshare.NewLogOutput(""), chshare.LogLevelDebug)
+	okHooks := map[string]int{"/hooks/backup": 0, "/hooks/raid": 0}
+
+	testCases := []struct {
+		name        string
+		stats       *mockSystemStats
+		wantState   string
+		wantReasons []string
+	}{
+		{
+			name:        "below thresholds",
+			stats:       &mockSystemStats{diskUsed: 50, load: 0.5, hooks: okHooks},
+			wantState:   models.HealthHealthy,
+			wantReasons: []string{},
+		},
+		{
+			name:        "disk degraded",
+			stats:       &mockSystemStats{diskUsed: 80, load: 0.5, hooks: okHooks},
+			wantState:   models.HealthDegraded,
+			wantReasons: []string{"disk usage of / is 80.0%"},
+		},
+		{
+			name:        "disk unhealthy, load degraded",
+			stats:       &mockSystemStats{diskUsed: 96, load: 1.5, hooks: okHooks},
+			wantState:   models.HealthUnhealthy,
+			wantReasons: []string{"disk usage of / is 96.0%", "load per CPU is 1.50"},
+		},
+		{
+			name:        "disk degraded, load unhealthy",
+			stats:       &mockSystemStats{diskUsed: 85, load: 2, hooks: okHooks},
+			wantState:   models.HealthUnhealthy,
+			wantReasons: []string{"disk usage of / is 85.0%", "load per CPU is 2.00"},
+		},
+		{
+			name:        "failed check",
+			stats:       &mockSystemStats{diskErr: errors.New("test error"), load: 0.5, hooks: okHooks},
+			wantState:   models.HealthDegraded,
+			wantReasons: []string{"failed to get disk usage of /: test error"},
+		},
+		{
+			name:        "hook degraded",
+			stats:       &mockSystemStats{diskUsed: 50, load: 0.5, hooks: map[string]int{"/hooks/backup": 1, "/hooks/raid": 0}},
+			wantState:   models.HealthDegraded,
+			wantReasons: []string{"hook /hooks/backup exited with code 1"},
+		},
+		{
+			name:        "hook unhealthy, hook failed to run",
+			stats:       &mockSystemStats{diskUsed: 50, load: 0.5, hooks: map[string]int{"/hooks/raid": 2}},
+			wantState:   models.HealthUnhealthy,
+			wantReasons: []string{"failed to run hook /hooks/backup: file not found", "hook /hooks/raid exited with code 2"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config := testConfig
+			config.Hooks = testHooks
+			h := New(logger, config)
+			h.stats = tc.stats
+
+			got := h.evaluate(context.Background())
+
+			assert.Equal(t, tc.wantState, got.State)
+			assert.Equal(t, tc.wantReasons, got.Reasons)
+		})
+	}
+}
+
+func TestHealthReportsStateChanges(t *testing.T) {
+	logger := chshare.NewLogger("test", chshare.NewLogOutput(""), chshare.LogLevelDebug)
+	stats := &mockSystemStats{diskUsed: 50, load: 0.5, hooks: map[string]int{"/hooks/backup": 0, "/hooks/raid": 0}}
+	config := testConfig
+	config.Hooks = testHooks
+	h := New(logger, config)
+	h.stats = stats
+	conn := &mockSSHConn{requests: make(chan mockSSHRequest, 1)}
+	h.conn = conn
+
+	getSent := func() *models.HealthStatus {
+		select {
+		case req := <-conn.requests:
+			assert.Equal(t, comm.RequestTypeHealthStatus, req.Name)
+			status := &models.HealthStatus{}
+			require.NoError(t, json.Unmarshal(req.Data, status))
+			return status
+		case <-time.After(time.Second):
+			require.Fail(t, "health status was not sent")
+			return nil
+		}
+	}
+
+	h.refreshStatus(context.Background())
+	assert.Equal(t, models.HealthHealthy, getSent().State)
+
+	stats.diskUsed = 90
+	h.refreshStatus(context.Background())
+	assert.Equal(t, models.HealthDegraded, getSent().State)
+
+	stats.load = 3
+	h.refreshStatus(context.Background())
+	assert.Equal(t, models.HealthUnhealthy, getSent().State)
+
+	stats.diskUsed = 50
+	stats.load = 0.5
+	h.refreshStatus(context.Background())
+	assert.Equal(t, models.HealthHealthy, getSent().State)
+
+	stats.hooks["/hooks/raid"] = 1
+	h.refreshStatus(context.Background())
+	assert.Equal(t, models.HealthDegraded, getSent().State)
+}
+
+func TestConfigValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		modify  func(c *Config)
+		wantErr string
+	}{
+		{
+			name:   "valid",
+			modify: func(c *Config) {},
+		},
+		{
+			name:    "negative interval",
+			modify:  func(c *Config) { c.Interval = -time.Second },
+			wantErr: "interval can not be negative: -1s",
+		},
+		{
+			name:    "disk percent out of range",
+			modify:  func(c *Config) { c.DiskUnhealthyPercent = 101 },
+			wantErr: "disk unhealthy percent should be between 0 and 100: 101",
+		},
+		{
+			name:    "disk unhealthy below degraded",
+			modify:  func(c *Config) { c.DiskUnhealthyPercent = 70 },
+			wantErr: "disk unhealthy percent 70 can not be less than degraded percent 80",
+		},
+		{
+			name:    "load unhealthy below degraded",
+			modify:  func(c *Config) { c.LoadUnhealthy = 0.5 },
+			wantErr: "load unhealthy 0.5 can not be less than degraded 1",
+		},
+		{
+			name:    "relative hook path",
+			modify:  func(c *Config) { c.Hooks = []string{"check_backup.sh"} },
+			wantErr: `hook should be an absolute path: "check_backup.sh"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := testConfig
+			tc.modify(&c)
+
+			err := c.Validate()
+
+			if tc.wantErr != "" {
+				require.EqualError(t, err, tc.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
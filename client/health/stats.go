@@ -0,0 +1,47 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"time"
+
+	"github.com/shirou/gopsutil/disk"
+	"github.com/shirou/gopsutil/load"
+)
+
+// hookTimeout is how long a hook can run before it's killed
+const hookTimeout = 30 * time.Second
+
+type systemStats struct{}
+
+func (systemStats) DiskUsedPercent(ctx context.Context, path string) (float64, error) {
+	usage, err := disk.UsageWithContext(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	return usage.UsedPercent, nil
+}
+
+func (systemStats) LoadPerCPU(ctx context.Context) (float64, error) {
+	avg, err := load.AvgWithContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return avg.Load1 / float64(runtime.NumCPU()), nil
+}
+
+func (systemStats) RunHook(ctx context.Context, path string) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, hookTimeout)
+	defer cancel()
+
+	err := exec.CommandContext(ctx, path).Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return 0, fmt.Errorf("timed out after %v", hookTimeout)
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode(), nil
+	}
+	return 0, err
+}
@@ -0,0 +1,104 @@
+package chclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/cloudradar-monitoring/rport/share/comm"
+)
+
+// HandleRefreshUpdatesStatusRequest triggers refreshing the updates status. A cached status is sent back unless
+// the refresh is forced. Servers not supporting force send an empty request.
+func (c *Client) HandleRefreshUpdatesStatusRequest(reqPayload []byte) error {
+	req := &comm.RefreshUpdatesStatusRequest{}
+	if len(reqPayload) > 0 {
+		if err := json.Unmarshal(reqPayload, req); err != nil {
+			return fmt.Errorf("failed to decode refresh updates status request: %s", err)
+		}
+	}
+
+	if req.Force {
+		c.updates.RefreshStale()
+	} else {
+		c.updates.Refresh()
+	}
+	return nil
+}
+
+// HandleInstallUpdatesRequest starts installing updates by the package manager and observes it like a command job.
+// The job passes the same signature check as a command, the package manager command is checked against allow and deny.
+func (c *Client) HandleInstallUpdatesRequest(ctx context.Context, reqPayload []byte) (_ *comm.RunCmdResponse, err error) {
+	if !c.config.RemoteCommands.Enabled {
+		return nil, errors.New("remote commands execution is disabled")
+	}
+
+	req := &comm.InstallUpdatesRequest{}
+	if err := json.Unmarshal(reqPayload, req); err != nil {
+		return nil, fmt.Errorf("failed to decode install updates request: %s", err)
+	}
+	job := req.Job
+	defer func() {
+		if err != nil {
+			c.logCmdRefused(&job, err)
+		}
+	}()
+
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	// the signature covers the job command, so it must describe the requested updates
+	if job.Command != req.JobCommand() {
+		return nil, fmt.Errorf("job command %q doesn't match the requested updates", job.Command)
+	}
+	if err := c.verifyJobSignature(&job); err != nil {
+		return nil, err
+	}
+
+	// installing updates counts as a running command
+	if !c.acquireCmdSlot(c.config.RemoteCommands.QueueWhenBusy) {
+		return nil, fmt.Errorf("max concurrent commands limit (%d) is reached, running PIDs: %v", c.config.RemoteCommands.GetMaxConcurrent(), c.getCmdPIDs())
+	}
+
+	args, err := c.updates.InstallCmd(ctx, req.Packages, req.SecurityOnly)
+	if err != nil {
+		c.releaseCmdSlot()
+		return nil, err
+	}
+	job.Command = strings.Join(args, " ")
+	if !c.isAllowed(job.Command) {
+		c.releaseCmdSlot()
+		return nil, fmt.Errorf("command is not allowed: %v", job.Command)
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	out := c.newCmdOutput(job.JID, job.MaxResultSize)
+	cmd.Stdout = out.StdOut()
+	cmd.Stderr = out.StdErr()
+
+	c.Debugf("Installing updates: %s", job.Command)
+
+	startedAt := now()
+	if err := c.startCmd(cmd, nil); err != nil {
+		c.releaseCmdSlot()
+		c.finishCmdOutput(out)
+		return nil, fmt.Errorf("failed to start installing updates: %s", err)
+	}
+
+	c.addCmdPID(cmd.Process.Pid)
+	c.logCmdStarted(&job, cmd.Process.Pid)
+
+	go func() {
+		c.observeCmd(cmd, job, startedAt, out)
+		// installed updates are reported right away
+		c.updates.RefreshStale()
+	}()
+
+	return &comm.RunCmdResponse{
+		Pid:       cmd.Process.Pid,
+		StartedAt: startedAt,
+	}, nil
+}
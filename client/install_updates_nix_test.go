@@ -0,0 +1,149 @@
+//+build !windows
+
+package chclient
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/rport/client/updates"
+	chshare "github.com/cloudradar-monitoring/rport/share"
+	"github.com/cloudradar-monitoring/rport/share/comm"
+	"github.com/cloudradar-monitoring/rport/share/models"
+	"github.com/cloudradar-monitoring/rport/share/test"
+)
+
+type mockInstaller struct {
+	installCmd []string
+}
+
+func (m *mockInstaller) Name() string {
+	return "mock"
+}
+
+func (m *mockInstaller) IsAvailable(context.Context) bool {
+	return true
+}
+
+func (m *mockInstaller) GetUpdatesStatus(context.Context, *chshare.Logger) (*models.UpdatesStatus, error) {
+	return &models.UpdatesStatus{}, nil
+}
+
+func (m *mockInstaller) InstallCmd(ctx context.Context, packages []string, securityOnly bool) ([]string, error) {
+	return append(append([]string{}, m.installCmd...), packages...), nil
+}
+
+func TestHandleInstallUpdatesRequest(t *testing.T) {
+	pubKey, privKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	_, otherPrivKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	newRequest := func(command string, key ed25519.PrivateKey) *comm.InstallUpdatesRequest {
+		req := &comm.InstallUpdatesRequest{
+			Job: models.Job{
+				JobSummary: models.JobSummary{JID: "5f02b216-3f8a-42be-b66c-f4c1d0ea3809"},
+				Command:    command,
+				TimeoutSec: 60,
+			},
+			Packages:     []string{"openssl"},
+			SecurityOnly: true,
+		}
+		if key != nil {
+			require.NoError(t, req.Job.Sign(key, now().Add(time.Minute)))
+		}
+		return req
+	}
+
+	testCases := []struct {
+		name      string
+		req       *comm.InstallUpdatesRequest
+		publicKey ed25519.PublicKey
+		deny      string
+		wantErr   string
+	}{
+		{
+			name:      "signed",
+			req:       newRequest("install security updates openssl", privKey),
+			publicKey: pubKey,
+		},
+		{
+			name: "unsigned, no public key",
+			req:  newRequest("install security updates openssl", nil),
+		},
+		{
+			name:      "signed by another key",
+			req:       newRequest("install security updates openssl", otherPrivKey),
+			publicKey: pubKey,
+			wantErr:   "invalid command signature",
+		},
+		{
+			name:      "packages don't match the signed command",
+			req:       newRequest("install security updates curl", privKey),
+			publicKey: pubKey,
+			wantErr:   `job command "install security updates curl" doesn't match the requested updates`,
+		},
+		{
+			name:    "denied",
+			req:     newRequest("install security updates openssl", nil),
+			deny:    "^true",
+			wantErr: "command is not allowed: true --upgrade openssl",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			connMock := test.NewConnMock()
+			done := make(chan bool)
+			connMock.DoneChannel = done
+
+			configCopy := getDefaultValidMinConfig()
+			configCopy.Client.DataDir = filepath.Join(configCopy.Client.DataDir, "TestHandleInstallUpdatesRequest")
+			defer os.RemoveAll(configCopy.Client.DataDir)
+			require.NoError(t, PrepareDirs(&configCopy))
+			configCopy.RemoteCommands.RequireSignature = tc.publicKey != nil
+			configCopy.RemoteCommands.signaturePublicKey = tc.publicKey
+			if tc.deny != "" {
+				configCopy.RemoteCommands.denyRegexp = []*regexp.Regexp{regexp.MustCompile(tc.deny)}
+			}
+
+			c := Client{
+				cmdExec:    NewCmdExecutor(testLog),
+				sshConn:    connMock,
+				Logger:     testLog,
+				config:     &configCopy,
+				systemInfo: &mockSystemInfo{ReturnHostname: "test-host"},
+				updates:    updates.NewWithPackageManager(testLog, 0, 0, &mockInstaller{installCmd: []string{"true", "--upgrade"}}),
+			}
+			payload, err := json.Marshal(tc.req)
+			require.NoError(t, err)
+
+			res, err := c.HandleInstallUpdatesRequest(context.Background(), payload)
+
+			if tc.wantErr != "" {
+				require.EqualError(t, err, tc.wantErr)
+				assert.Nil(t, res)
+				assert.Empty(t, c.getCmdPIDs())
+				return
+			}
+			require.NoError(t, err)
+			<-done
+
+			_, _, resultPayload := connMock.InputSendRequest()
+			gotJob := models.Job{}
+			require.NoError(t, json.Unmarshal(resultPayload, &gotJob))
+			assert.Equal(t, models.JobStatusSuccessful, gotJob.Status)
+			assert.Equal(t, "true --upgrade openssl", gotJob.Command)
+		})
+	}
+}
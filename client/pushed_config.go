@@ -0,0 +1,83 @@
+package chclient
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudradar-monitoring/rport/share/comm"
+)
+
+// keys of config values the server can push
+const (
+	ConfigKeyKeepAlive     = "connection.keep_alive"
+	ConfigKeySendBackLimit = "remote-commands.send_back_limit"
+)
+
+// PushableConfigKeys are config keys the server can push. Security relevant settings like allowed and denied commands
+// are not pushable, so a compromised server can't loosen them.
+var PushableConfigKeys = []string{ConfigKeyKeepAlive, ConfigKeySendBackLimit}
+
+// SetLocallySet marks a given config key as set explicitly in the config file or on the command line.
+// Such values are not overridden by a config pushed by the server.
+func (c *Config) SetLocallySet(key string) {
+	if c.locallySet == nil {
+		c.locallySet = make(map[string]bool)
+	}
+	c.locallySet[key] = true
+}
+
+func (c *Config) isLocallySet(key string) bool {
+	return c.locallySet[key]
+}
+
+// applyPushed applies a validated pushed config and returns keys of the applied values.
+func (c *Config) applyPushed(pushed comm.PushedConfig) []string {
+	var applied []string
+	if pushed.KeepAlive > 0 && !c.isLocallySet(ConfigKeyKeepAlive) {
+		c.Connection.KeepAlive = pushed.KeepAlive
+		applied = append(applied, ConfigKeyKeepAlive)
+	}
+
+	if pushed.RemoteCommands.SendBackLimit > 0 && !c.isLocallySet(ConfigKeySendBackLimit) {
+		c.RemoteCommands.SendBackLimit = pushed.RemoteCommands.SendBackLimit
+		applied = append(applied, ConfigKeySendBackLimit)
+	}
+	return applied
+}
+
+// applyPushedConfig merges a config pushed by the server over the local defaults. Unknown keys are ignored,
+// an invalid config is ignored entirely.
+func (c *Client) applyPushedConfig(raw []byte) {
+	pushed := comm.PushedConfig{}
+	if err := json.Unmarshal(raw, &pushed); err != nil {
+		c.Errorf("Ignoring config pushed by the server: %v", err)
+		return
+	}
+	if err := pushed.Validate(); err != nil {
+		c.Errorf("Ignoring config pushed by the server: %v", err)
+		return
+	}
+
+	applied := c.config.applyPushed(pushed)
+	if len(applied) == 0 {
+		return
+	}
+	c.Infof("Applied config pushed by the server: %v", applied)
+
+	c.setKeepAlive(c.config.Connection.KeepAlive)
+}
+
+func (c *Client) getKeepAlive() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.keepAlive))
+}
+
+// setKeepAlive changes the keepalive interval and starts the keepalive loop if it's enabled.
+func (c *Client) setKeepAlive(d time.Duration) {
+	atomic.StoreInt64(&c.keepAlive, int64(d))
+	if d > 0 {
+		c.keepAliveOnce.Do(func() {
+			go c.keepAliveLoop()
+		})
+	}
+}
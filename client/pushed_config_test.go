@@ -0,0 +1,111 @@
+package chclient
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shirou/gopsutil/host"
+	"github.com/shirou/gopsutil/mem"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	chshare "github.com/cloudradar-monitoring/rport/share"
+	"github.com/cloudradar-monitoring/rport/share/test"
+)
+
+func TestSendConnectionRequestAppliesPushedConfig(t *testing.T) {
+	testCases := []struct {
+		name       string
+		reply      string
+		locallySet []string
+
+		wantKeepAlive     time.Duration
+		wantSendBackLimit int
+		wantAllow         []string
+	}{
+		{
+			name:              "reply of an old server",
+			reply:             `[]`,
+			wantKeepAlive:     time.Second,
+			wantSendBackLimit: 2048,
+			wantAllow:         []string{"^/usr/bin/.*"},
+		},
+		{
+			name:              "pushed config is applied, unknown keys are ignored",
+			reply:             `{"remotes":[],"config":{"keep_alive":30000000000,"remote_commands":{"send_back_limit":100,"unknown":1},"unknown":"x"}}`,
+			wantKeepAlive:     30 * time.Second,
+			wantSendBackLimit: 100,
+			wantAllow:         []string{"^/usr/bin/.*"},
+		},
+		{
+			name:              "locally set values win",
+			reply:             `{"remotes":[],"config":{"keep_alive":30000000000,"remote_commands":{"send_back_limit":100}}}`,
+			locallySet:        []string{ConfigKeyKeepAlive},
+			wantKeepAlive:     time.Second,
+			wantSendBackLimit: 100,
+			wantAllow:         []string{"^/usr/bin/.*"},
+		},
+		{
+			name:              "allowed and denied commands can't be pushed",
+			reply:             `{"remotes":[],"config":{"remote_commands":{"allow":["^/bin/.*"],"deny":[]}}}`,
+			wantKeepAlive:     time.Second,
+			wantSendBackLimit: 2048,
+			wantAllow:         []string{"^/usr/bin/.*"},
+		},
+		{
+			name:              "invalid pushed config is ignored",
+			reply:             `{"remotes":[],"config":{"keep_alive":30000000000,"remote_commands":{"send_back_limit":-1}}}`,
+			wantKeepAlive:     time.Second,
+			wantSendBackLimit: 2048,
+			wantAllow:         []string{"^/usr/bin/.*"},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			config := Config{
+				Client: ClientConfig{
+					Server:  "test.com",
+					DataDir: "./",
+				},
+				Connection: ConnectionConfig{
+					KeepAlive: time.Second,
+				},
+				RemoteCommands: CommandsConfig{
+					Allow:         []string{"^/usr/bin/.*"},
+					Order:         allowDenyOrder,
+					SendBackLimit: 2048,
+				},
+				Logging: LogConfig{
+					LogOutput: chshare.NewLogOutput(""),
+				},
+			}
+			require.NoError(t, config.ParseAndValidate(true))
+			for _, key := range tc.locallySet {
+				config.SetLocallySet(key)
+			}
+			c := NewClient(&config)
+			c.systemInfo = &mockSystemInfo{
+				ReturnHostInfo:   &host.InfoStat{},
+				ReturnMemoryStat: &mem.VirtualMemoryStat{},
+			}
+			connMock := test.NewConnMock()
+			connMock.ReturnOk = true
+			connMock.ReturnResponsePayload = []byte(tc.reply)
+
+			require.NoError(t, c.sendConnectionRequest(context.Background(), connMock))
+
+			_, _, payload := connMock.InputSendRequest()
+			connReq, err := chshare.DecodeConnectionRequest(payload)
+			require.NoError(t, err)
+			assert.True(t, connReq.AcceptsPushedConfig)
+			assert.Equal(t, tc.wantKeepAlive, config.Connection.KeepAlive)
+			assert.Equal(t, tc.wantSendBackLimit, config.RemoteCommands.SendBackLimit)
+			assert.Equal(t, tc.wantAllow, config.RemoteCommands.Allow)
+			require.Len(t, config.RemoteCommands.allowRegexp, 1)
+			assert.Equal(t, tc.wantAllow[0], config.RemoteCommands.allowRegexp[0].String())
+		})
+	}
+}
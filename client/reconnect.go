@@ -0,0 +1,67 @@
+package chclient
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/cloudradar-monitoring/rport/share/comm"
+)
+
+// HandleReconnectRequest remembers a server the client is asked to reconnect to. Only servers listed in
+// fallback_servers are accepted, so a server can't redirect clients to collect their credentials. The current
+// connection is closed after replying, the next connection attempt goes to the given server and the client switches back to the main
+// server by server_switchback_interval like from a fallback server.
+func (c *Client) HandleReconnectRequest(payload []byte) error {
+	req := &comm.ReconnectRequest{}
+	if err := json.Unmarshal(payload, req); err != nil {
+		return fmt.Errorf("failed to decode reconnect request: %v", err)
+	}
+	if err := req.Validate(); err != nil {
+		return err
+	}
+	server, err := c.config.parseURL(req.ServerURL)
+	if err != nil {
+		return fmt.Errorf("invalid server_url: %v", err)
+	}
+	if !c.isFallbackServer(server) {
+		return fmt.Errorf("server_url %q is not one of the fallback_servers of the client", req.ServerURL)
+	}
+
+	c.reconnectTargetMtx.Lock()
+	c.reconnectTarget = server
+	c.reconnectTargetMtx.Unlock()
+
+	c.Infof("Server asked to reconnect to %s", server)
+	return nil
+}
+
+// isFallbackServer returns true if a given parsed server URL is one of the configured fallback servers.
+func (c *Client) isFallbackServer(server string) bool {
+	for _, fallback := range c.config.Client.FallbackServers {
+		if server == fallback {
+			return true
+		}
+	}
+	return false
+}
+
+// popReconnectTarget returns a server the client was asked to reconnect to and resets it, empty if there is none.
+func (c *Client) popReconnectTarget() string {
+	c.reconnectTargetMtx.Lock()
+	defer c.reconnectTargetMtx.Unlock()
+	target := c.reconnectTarget
+	c.reconnectTarget = ""
+	return target
+}
+
+// closeForReconnect closes the current connection, so the connection loop connects to a requested server.
+func (c *Client) closeForReconnect() {
+	conn := c.getSSHConn()
+	if conn == nil {
+		return
+	}
+	c.Infof("Disconnecting to reconnect to another server")
+	if err := conn.Close(); err != nil {
+		c.Errorf("Failed to close connection: %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+package chclient
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+const reconnectAlertCmdTimeout = time.Minute
+
+// checkReconnectAlert alerts once the number of consecutive failed connection attempts reaches the configured threshold.
+// The number is reset by a successful connection, so the alert fires again if the client gets disconnected persistently again.
+func (c *Client) checkReconnectAlert(failures int, connerr error) {
+	threshold := c.config.Connection.AlertAfterFailures
+	if threshold <= 0 || failures != threshold {
+		return
+	}
+
+	c.Errorf("ALERT: %d consecutive connection attempts failed, last error: %v", failures, connerr)
+
+	if c.config.Connection.AlertCommand != "" {
+		go c.runReconnectAlertCmd(failures, connerr)
+	}
+}
+
+func (c *Client) runReconnectAlertCmd(failures int, connerr error) {
+	ctx, cancel := context.WithTimeout(context.Background(), reconnectAlertCmdTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, c.config.Connection.AlertCommand)
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("RPORT_FAILED_ATTEMPTS=%d", failures),
+		fmt.Sprintf("RPORT_CONNECTION_ERROR=%v", connerr),
+	)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		c.Errorf("Alert command %q failed: %v, output: %s", c.config.Connection.AlertCommand, err, out)
+	}
+}
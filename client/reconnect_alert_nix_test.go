@@ -0,0 +1,91 @@
+//+build !windows
+
+package chclient
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	chshare "github.com/cloudradar-monitoring/rport/share"
+)
+
+func TestReconnectAlert(t *testing.T) {
+	server, err := newMockServer()
+	require.NoError(t, err)
+	server.SetAvailable(false)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	dir, err := ioutil.TempDir("", "TestReconnectAlert")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	alertsFile := filepath.Join(dir, "alerts")
+	alertCmd := filepath.Join(dir, "alert.sh")
+	script := "#!/bin/sh\necho \"$RPORT_FAILED_ATTEMPTS\" >> " + alertsFile + "\n"
+	require.NoError(t, ioutil.WriteFile(alertCmd, []byte(script), 0700))
+
+	config := Config{
+		Client: ClientConfig{
+			Server:  ts.URL,
+			DataDir: "./",
+		},
+		RemoteCommands: CommandsConfig{
+			Order: allowDenyOrder,
+		},
+		Logging: LogConfig{
+			LogOutput: chshare.NewLogOutput(""),
+		},
+		Connection: ConnectionConfig{
+			MaxRetryCount:      -1,
+			AlertAfterFailures: 2,
+			AlertCommand:       alertCmd,
+		},
+	}
+	require.NoError(t, config.ParseAndValidate(true))
+
+	c := NewClient(&config)
+	go c.connectionLoop(context.Background())
+
+	readAlerts := func() []string {
+		content, _ := ioutil.ReadFile(alertsFile)
+		return strings.Fields(string(content))
+	}
+
+	// alert fires once the threshold of failed attempts is reached
+	require.Eventually(t, func() bool { return len(readAlerts()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"2"}, readAlerts())
+
+	// further failures don't fire the alert again
+	time.Sleep(500 * time.Millisecond)
+	assert.Equal(t, []string{"2"}, readAlerts())
+
+	// successful connection resets the counter
+	server.SetAvailable(true)
+	require.NoError(t, waitForStatus(server, true))
+
+	server.SetAvailable(false)
+	server.CloseConnection()
+	require.Eventually(t, func() bool { return len(readAlerts()) == 2 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, []string{"2", "2"}, readAlerts())
+}
+
+func waitForStatus(server *mockServer, isConnected bool) error {
+	var err error
+	// connection is retried with a growing delay, so wait longer than WaitForStatus does
+	for i := 0; i < 10; i++ {
+		if err = server.WaitForStatus(isConnected); err == nil {
+			return nil
+		}
+	}
+	return err
+}
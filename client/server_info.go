@@ -0,0 +1,69 @@
+package chclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	chshare "github.com/cloudradar-monitoring/rport/share"
+	"github.com/cloudradar-monitoring/rport/share/comm"
+)
+
+// serverInfoTimeout limits the time to get the server info
+const serverInfoTimeout = 30 * time.Second
+
+// GetServerInfo requests build and features info of a server at a given address without connecting to it as a client.
+// The address is the same as the server address the client connects to.
+func GetServerInfo(ctx context.Context, serverAddr string) (*comm.ServerInfo, error) {
+	serverURL, err := Config{}.parseURL(serverAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid server address: %v", err)
+	}
+	// the info is served over plain http(s) by the same listener that accepts client websocket connections
+	serverURL = strings.Replace(serverURL, "ws", "http", 1)
+
+	ctx, cancel := context.WithTimeout(ctx, serverInfoTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(serverURL, "/")+comm.ServerInfoPath, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to request server info: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to request server info: unexpected status code %d, the server might not support it", resp.StatusCode)
+	}
+
+	payload := struct {
+		Data comm.ServerInfo `json:"data"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return nil, fmt.Errorf("failed to decode server info: %v", err)
+	}
+	return &payload.Data, nil
+}
+
+// PrintServerInfo writes server info in a human readable format together with the compatibility of the client.
+func PrintServerInfo(w io.Writer, info *comm.ServerInfo) error {
+	compatibility := "compatible"
+	if info.ProtocolVersion != chshare.ProtocolVersion {
+		compatibility = fmt.Sprintf("not compatible, the client uses %s", chshare.ProtocolVersion)
+	}
+	features := "none"
+	if len(info.Features) > 0 {
+		features = strings.Join(info.Features, ", ")
+	}
+
+	_, err := fmt.Fprintf(w, "Server version: %s\nClient version: %s\nProtocol: %s (%s)\nFingerprint: %s\nFeatures: %s\n",
+		info.Version, chshare.BuildVersion, info.ProtocolVersion, compatibility, info.Fingerprint, features)
+	return err
+}
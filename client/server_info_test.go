@@ -0,0 +1,83 @@
+package chclient
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	chshare "github.com/cloudradar-monitoring/rport/share"
+	"github.com/cloudradar-monitoring/rport/share/comm"
+)
+
+func TestServerInfo(t *testing.T) {
+	testCases := []struct {
+		name           string
+		respStatus     int
+		respBody       string
+		wantOutput     string
+		wantErrContain string
+	}{
+		{
+			name:       "compatible server",
+			respStatus: http.StatusOK,
+			respBody:   `{"data":{"version":"0.5.0","protocol_version":"rport-v1","fingerprint":"ab:cd","features":["command_signing","max_job_result_size"]}}`,
+			wantOutput: "Server version: 0.5.0\n" +
+				"Client version: " + chshare.BuildVersion + "\n" +
+				"Protocol: rport-v1 (compatible)\n" +
+				"Fingerprint: ab:cd\n" +
+				"Features: command_signing, max_job_result_size\n",
+		},
+		{
+			name:       "incompatible server without features",
+			respStatus: http.StatusOK,
+			respBody:   `{"data":{"version":"9.0.0","protocol_version":"rport-v2","fingerprint":"ab:cd","features":[]}}`,
+			wantOutput: "Server version: 9.0.0\n" +
+				"Client version: " + chshare.BuildVersion + "\n" +
+				"Protocol: rport-v2 (not compatible, the client uses rport-v1)\n" +
+				"Fingerprint: ab:cd\n" +
+				"Features: none\n",
+		},
+		{
+			name:           "server without server info",
+			respStatus:     http.StatusNotFound,
+			wantErrContain: "unexpected status code 404",
+		},
+		{
+			name:           "invalid response",
+			respStatus:     http.StatusOK,
+			respBody:       `not json`,
+			wantErrContain: "failed to decode server info",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var gotPath string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.Path
+				w.WriteHeader(tc.respStatus)
+				_, _ = w.Write([]byte(tc.respBody))
+			}))
+			defer srv.Close()
+
+			info, err := GetServerInfo(context.Background(), srv.URL)
+
+			assert.Equal(t, comm.ServerInfoPath, gotPath)
+			if tc.wantErrContain != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErrContain)
+				return
+			}
+			require.NoError(t, err)
+			out := &bytes.Buffer{}
+			require.NoError(t, PrintServerInfo(out, info))
+			assert.Equal(t, tc.wantOutput, out.String())
+		})
+	}
+}
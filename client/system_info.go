@@ -14,6 +14,9 @@ import (
 	"github.com/shirou/gopsutil/mem"
 
 	"github.com/shirou/gopsutil/host"
+
+	"github.com/cloudradar-monitoring/rport/client/updates"
+	chshare "github.com/cloudradar-monitoring/rport/share"
 )
 
 type CPUInfo struct {
@@ -31,6 +34,8 @@ type SystemInfo interface {
 	GoArch() string
 	SystemTime() time.Time
 	VirtualizationInfo(ctx context.Context, infoStat *host.InfoStat) (virtSystem, virtRole string, err error)
+	PackageManager(ctx context.Context) string
+	Interpreters() []string
 }
 
 type realSystemInfo struct {
@@ -97,6 +102,44 @@ func (s *realSystemInfo) SystemTime() time.Time {
 	return time.Now()
 }
 
+// PackageManager returns a type of a package manager available on the system, empty if none is supported
+func (s *realSystemInfo) PackageManager(ctx context.Context) string {
+	pm := updates.DetectPackageManager(ctx)
+	if pm == nil {
+		return ""
+	}
+	return pm.Name()
+}
+
+// interpreterExecutables are executables of named interpreters, an interpreter is installed if any of them is found.
+// PowerShell Core is installed as pwsh on all platforms, Windows PowerShell as powershell.
+var interpreterExecutables = []struct {
+	interpreter string
+	executables []string
+}{
+	{interpreter: chshare.CmdShell, executables: []string{chshare.CmdShell}},
+	{interpreter: chshare.PowerShell, executables: []string{"pwsh", chshare.PowerShell}},
+	{interpreter: chshare.Tacoscript, executables: []string{chshare.Tacoscript}},
+}
+
+// Interpreters returns named interpreters that are installed on the system and can be used to run commands and scripts.
+// The default interpreter is not included, it's always available.
+func (s *realSystemInfo) Interpreters() []string {
+	res := []string{}
+	for _, cur := range interpreterExecutables {
+		if cur.interpreter == chshare.CmdShell && runtime.GOOS != "windows" {
+			continue
+		}
+		for _, executable := range cur.executables {
+			if _, err := exec.LookPath(executable); err == nil {
+				res = append(res, cur.interpreter)
+				break
+			}
+		}
+	}
+	return res
+}
+
 func (s *realSystemInfo) VirtualizationInfo(ctx context.Context, infoStat *host.InfoStat) (virtSystem, virtRole string, err error) {
 	if infoStat != nil && infoStat.VirtualizationSystem != "" {
 		return strings.ToUpper(infoStat.VirtualizationSystem), strings.ToLower(infoStat.VirtualizationRole), nil
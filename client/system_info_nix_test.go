@@ -0,0 +1,58 @@
+//go:build !windows
+// +build !windows
+
+package chclient
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	chshare "github.com/cloudradar-monitoring/rport/share"
+)
+
+func TestInterpreters(t *testing.T) {
+	testCases := []struct {
+		name        string
+		executables []string
+		want        []string
+	}{
+		{
+			name: "none",
+			want: []string{},
+		},
+		{
+			name:        "powershell core",
+			executables: []string{"pwsh"},
+			want:        []string{chshare.PowerShell},
+		},
+		{
+			name:        "windows powershell and tacoscript",
+			executables: []string{"powershell", "tacoscript"},
+			want:        []string{chshare.PowerShell, chshare.Tacoscript},
+		},
+		{
+			name:        "both powershells",
+			executables: []string{"pwsh", "powershell"},
+			want:        []string{chshare.PowerShell},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, name := range tc.executables {
+				require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), 0755))
+			}
+			defer os.Setenv("PATH", os.Getenv("PATH"))
+			require.NoError(t, os.Setenv("PATH", dir))
+
+			assert.Equal(t, tc.want, (&realSystemInfo{}).Interpreters())
+		})
+	}
+}
@@ -26,6 +26,8 @@ type mockSystemInfo struct {
 	ReturnGoArch                  string
 	ReturnSystemTime              time.Time
 	ReturnVirtualizationInfoError error
+	ReturnPackageManager          string
+	ReturnInterpreters            []string
 }
 
 func (s *mockSystemInfo) Hostname() (string, error) {
@@ -60,6 +62,14 @@ func (s *mockSystemInfo) SystemTime() time.Time {
 	return s.ReturnSystemTime
 }
 
+func (s *mockSystemInfo) PackageManager(ctx context.Context) string {
+	return s.ReturnPackageManager
+}
+
+func (s *mockSystemInfo) Interpreters() []string {
+	return s.ReturnInterpreters
+}
+
 func (s *mockSystemInfo) VirtualizationInfo(ctx context.Context, infoStat *host.InfoStat) (virtSystem, virtRole string, err error) {
 	if infoStat == nil {
 		return "", "", s.ReturnVirtualizationInfoError
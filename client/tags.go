@@ -0,0 +1,76 @@
+package chclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/cloudradar-monitoring/rport/share/comm"
+)
+
+const tagsFileName = "tags.json"
+
+// GetTagsFilePath returns a path of a file with tags changed by the server.
+func (c *Config) GetTagsFilePath() string {
+	return filepath.Join(c.Client.DataDir, tagsFileName)
+}
+
+// loadSavedTags overrides configured tags with the ones changed by the server, if any.
+func (c *Client) loadSavedTags() error {
+	b, err := ioutil.ReadFile(c.config.GetTagsFilePath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read saved tags: %v", err)
+	}
+
+	var tags []string
+	if err := json.Unmarshal(b, &tags); err != nil {
+		return fmt.Errorf("failed to decode saved tags from %q: %v", c.config.GetTagsFilePath(), err)
+	}
+
+	c.Infof("Using tags saved in %q: %v", c.config.GetTagsFilePath(), tags)
+	c.setTags(tags)
+	return nil
+}
+
+func (c *Client) getTags() []string {
+	c.tagsMutex.Lock()
+	defer c.tagsMutex.Unlock()
+	return c.config.Client.Tags
+}
+
+func (c *Client) setTags(tags []string) {
+	c.tagsMutex.Lock()
+	defer c.tagsMutex.Unlock()
+	c.config.Client.Tags = tags
+}
+
+// HandleUpdateTagsRequest adds and removes tags. The result is saved to be used after reconnects and restarts.
+func (c *Client) HandleUpdateTagsRequest(payload []byte) (*comm.UpdateTagsResponse, error) {
+	req := &comm.UpdateTagsRequest{}
+	if err := json.Unmarshal(payload, req); err != nil {
+		return nil, fmt.Errorf("failed to decode update tags request: %v", err)
+	}
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+
+	tags := req.Apply(c.getTags())
+
+	b, err := json.Marshal(tags)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(c.config.GetTagsFilePath(), b, 0600); err != nil {
+		return nil, fmt.Errorf("failed to save tags: %v", err)
+	}
+
+	c.setTags(tags)
+	c.Infof("Tags updated: %v", tags)
+
+	return &comm.UpdateTagsResponse{Tags: tags}, nil
+}
@@ -0,0 +1,63 @@
+package chclient
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/rport/share/comm"
+)
+
+func TestHandleUpdateTagsRequest(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "TestHandleUpdateTagsRequest")
+	require.NoError(t, err)
+	defer os.RemoveAll(dataDir)
+
+	config := getDefaultValidMinConfig()
+	config.Client.DataDir = dataDir
+	config.Client.Tags = []string{"linux", "old"}
+	c := &Client{
+		Logger: testLog,
+		config: &config,
+	}
+
+	resp, err := c.HandleUpdateTagsRequest([]byte(`{"add":["web","linux"],"remove":["old"]}`))
+	require.NoError(t, err)
+	assert.Equal(t, &comm.UpdateTagsResponse{Tags: []string{"linux", "web"}}, resp)
+	assert.Equal(t, []string{"linux", "web"}, c.getTags())
+
+	_, err = c.HandleUpdateTagsRequest([]byte(`{"add":["web|rm"]}`))
+	require.EqualError(t, err, `tag "web|rm" is invalid: only letters, digits, spaces and '_.:/@-' are allowed`)
+	assert.Equal(t, []string{"linux", "web"}, c.getTags())
+
+	// saved tags override configured ones after restart
+	restartedConfig := getDefaultValidMinConfig()
+	restartedConfig.Client.DataDir = dataDir
+	restartedConfig.Client.Tags = []string{"linux", "old"}
+	restarted := &Client{
+		Logger: testLog,
+		config: &restartedConfig,
+	}
+	require.NoError(t, restarted.loadSavedTags())
+	assert.Equal(t, []string{"linux", "web"}, restarted.getTags())
+}
+
+func TestLoadSavedTagsNoFile(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "TestLoadSavedTagsNoFile")
+	require.NoError(t, err)
+	defer os.RemoveAll(dataDir)
+
+	config := getDefaultValidMinConfig()
+	config.Client.DataDir = dataDir
+	config.Client.Tags = []string{"linux"}
+	c := &Client{
+		Logger: testLog,
+		config: &config,
+	}
+
+	require.NoError(t, c.loadSavedTags())
+	assert.Equal(t, []string{"linux"}, c.getTags())
+}
@@ -0,0 +1,113 @@
+package updates
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	chshare "github.com/cloudradar-monitoring/rport/share"
+	"github.com/cloudradar-monitoring/rport/share/models"
+)
+
+// ApkPackageManager reports updates on Alpine Linux. Alpine has no separate security feed
+// and doesn't maintain a reboot flag, so neither security updates nor pending reboot are reported.
+type ApkPackageManager struct {
+	runner Runner
+
+	detectCmd      []string
+	updateCacheCmd []string
+	listUpdatesCmd []string
+}
+
+func NewApkPackageManager() *ApkPackageManager {
+	return &ApkPackageManager{
+		runner: &RunnerImpl{},
+
+		detectCmd:      []string{"apk", "--version"},
+		updateCacheCmd: []string{"sudo", "-n", "apk", "update", "--quiet"},
+		listUpdatesCmd: []string{"apk", "version", "-l", "<"},
+	}
+}
+
+func (p *ApkPackageManager) Name() string {
+	return "apk"
+}
+
+func (p *ApkPackageManager) IsAvailable(ctx context.Context) bool {
+	_, err := p.runner.Run(ctx, p.detectCmd...)
+	return err == nil
+}
+
+func (p *ApkPackageManager) GetUpdatesStatus(ctx context.Context, logger *chshare.Logger) (*models.UpdatesStatus, error) {
+	err := p.updatePackageCache(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	updates, err := p.listUpdates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := make([]models.UpdateSummary, len(updates))
+	for i, update := range updates {
+		summaries[i] = models.UpdateSummary{
+			Title:       update.name,
+			Description: fmt.Sprintf("%s %s -> %s", update.name, update.installedVersion, update.version),
+		}
+	}
+
+	return &models.UpdatesStatus{
+		UpdatesAvailable: len(updates),
+		UpdateSummaries:  summaries,
+	}, nil
+}
+
+type apkUpdate struct {
+	name             string
+	installedVersion string
+	version          string
+}
+
+// listUpdates parses lines like "busybox-1.35.0-r17    < 1.35.0-r18".
+func (p *ApkPackageManager) listUpdates(ctx context.Context) ([]apkUpdate, error) {
+	output, err := p.runner.Run(ctx, p.listUpdatesCmd...)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []apkUpdate
+	for _, line := range strings.Split(output, "\n") {
+		parts := strings.Fields(line)
+		if len(parts) != 3 || parts[1] != "<" {
+			continue
+		}
+
+		name, installedVersion := splitApkPackage(parts[0])
+		result = append(result, apkUpdate{
+			name:             name,
+			installedVersion: installedVersion,
+			version:          parts[2],
+		})
+	}
+
+	return result, nil
+}
+
+// splitApkPackage splits "name-version-rN" into name and "version-rN".
+func splitApkPackage(pkg string) (name, version string) {
+	release := strings.LastIndex(pkg, "-")
+	if release <= 0 {
+		return pkg, ""
+	}
+	i := strings.LastIndex(pkg[:release], "-")
+	if i <= 0 {
+		return pkg, ""
+	}
+	return pkg[:i], pkg[i+1:]
+}
+
+func (p *ApkPackageManager) updatePackageCache(ctx context.Context) error {
+	_, err := p.runner.Run(ctx, p.updateCacheCmd...)
+	return err
+}
@@ -0,0 +1,122 @@
+package updates
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudradar-monitoring/rport/share/models"
+)
+
+func TestApkPackageManagerIsAvailable(t *testing.T) { //nolint:dupl
+	ctx := context.Background()
+	testCases := []struct {
+		Name           string
+		DetectCmdError error
+		ExpectedResult bool
+	}{
+		{
+			Name:           "Apk detected",
+			DetectCmdError: nil,
+			ExpectedResult: true,
+		},
+		{
+			Name:           "Apk not detected",
+			DetectCmdError: errors.New(`exec: "apk": executable file not found in $PATH`),
+			ExpectedResult: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			mr := newMockRunner()
+			apk := NewApkPackageManager()
+			apk.runner = mr
+			mr.Register(apk.detectCmd, "", tc.DetectCmdError)
+
+			result := apk.IsAvailable(ctx)
+
+			assert.Equal(t, tc.ExpectedResult, result)
+		})
+	}
+}
+
+func TestApkPackageManagerGetUpdatesStatus(t *testing.T) {
+	ctx := context.Background()
+	testCases := []struct {
+		Name                 string
+		UpdateCacheCmdErr    error
+		ListUpdatesCmdOutput string
+		ListUpdatesCmdErr    error
+		ExpectedResult       *models.UpdatesStatus
+		ExpectedError        error
+	}{
+		{
+			Name:              "Update package cache error",
+			UpdateCacheCmdErr: errors.New("some error"),
+			ExpectedError:     errors.New("some error"),
+		},
+		{
+			Name:              "List updates error",
+			ListUpdatesCmdErr: errors.New("some error"),
+			ExpectedError:     errors.New("some error"),
+		},
+		{
+			Name: "No updates",
+			ListUpdatesCmdOutput: `Installed:                                Available:
+`,
+			ExpectedResult: &models.UpdatesStatus{
+				UpdateSummaries: []models.UpdateSummary{},
+			},
+		},
+		{
+			Name: "Updates available",
+			ListUpdatesCmdOutput: `WARNING: Ignoring https://dl-cdn.alpinelinux.org/alpine/v3.16/community: No such file or directory
+Installed:                                Available:
+busybox-1.35.0-r17                      < 1.35.0-r18
+ssl_client-1.35.0-r17                   < 1.35.0-r18
+libcrypto1.1-1.1.1q-r0                  < 1.1.1s-r0
+`,
+			ExpectedResult: &models.UpdatesStatus{
+				UpdatesAvailable: 3,
+				UpdateSummaries: []models.UpdateSummary{
+					{
+						Title:       "busybox",
+						Description: "busybox 1.35.0-r17 -> 1.35.0-r18",
+					},
+					{
+						Title:       "ssl_client",
+						Description: "ssl_client 1.35.0-r17 -> 1.35.0-r18",
+					},
+					{
+						Title:       "libcrypto1.1",
+						Description: "libcrypto1.1 1.1.1q-r0 -> 1.1.1s-r0",
+					},
+				},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			mr := newMockRunner()
+			apk := NewApkPackageManager()
+			apk.runner = mr
+			mr.Register(apk.updateCacheCmd, "", tc.UpdateCacheCmdErr)
+			mr.Register(apk.listUpdatesCmd, tc.ListUpdatesCmdOutput, tc.ListUpdatesCmdErr)
+
+			result, err := apk.GetUpdatesStatus(ctx, nil /* logger */)
+
+			assert.Equal(t, tc.ExpectedError, err)
+			assert.Equal(t, tc.ExpectedResult, result)
+		})
+	}
+}
@@ -2,6 +2,7 @@ package updates
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"regexp"
@@ -20,6 +21,8 @@ type AptPackageManager struct {
 	updateCacheCmd         []string
 	getSummariesCmd        []string
 	getCountsCmd           []string
+	upgradeCmd             []string
+	installCmd             []string
 }
 
 type getCountsCmdError error
@@ -31,11 +34,17 @@ func NewAptPackageManager() *AptPackageManager {
 		rebootRequiredFilename: "/var/run/reboot-required",
 		detectCmd:              []string{"apt-get", "help"},
 		updateCacheCmd:         []string{"sudo", "-n", "apt-get", "update", "-o", "Debug::NoLocking=true"},
-		getSummariesCmd:        []string{"apt-get", "-s", "-o", "Debug::NoLocking=true", "upgrade"},
+		getSummariesCmd:        []string{"apt-get", "-s", "-o", "Debug::NoLocking=true", "dist-upgrade"},
 		getCountsCmd:           []string{"/usr/lib/update-notifier/apt-check"},
+		upgradeCmd:             []string{"sudo", "-n", "apt-get", "dist-upgrade", "-y"},
+		installCmd:             []string{"sudo", "-n", "apt-get", "install", "-y", "--only-upgrade"},
 	}
 }
 
+func (p *AptPackageManager) Name() string {
+	return "apt"
+}
+
 func (p *AptPackageManager) IsAvailable(ctx context.Context) bool {
 	_, err := p.runner.Run(ctx, p.detectCmd...)
 	return err == nil
@@ -140,16 +149,16 @@ func (p *AptPackageManager) getSummaries(ctx context.Context) ([]models.UpdateSu
 		title := parts[1]
 		descriptionMatch := p.descriptionRegex.FindStringSubmatch(line)
 		description := title
+		isSecurity := false
 		if len(descriptionMatch) > 1 {
 			description = fmt.Sprintf(
 				"%s %s",
 				title,
 				descriptionMatch[1],
 			)
+			isSecurity = hasSecuritySuite(descriptionMatch[1])
 		}
 
-		isSecurity := strings.Contains(description, "-security")
-
 		result = append(result, models.UpdateSummary{
 			Title:            title,
 			Description:      description,
@@ -160,6 +169,55 @@ func (p *AptPackageManager) getSummaries(ctx context.Context) ([]models.UpdateSu
 	return result, nil
 }
 
+// hasSecuritySuite returns true if one of the sources of a given "(version origin/suite, origin/suite [arch])" part
+// is a security suite, e.g. "Ubuntu:20.04/focal-security".
+func hasSecuritySuite(versionSources string) bool {
+	for _, field := range strings.Fields(strings.ReplaceAll(versionSources, ",", " ")) {
+		i := strings.LastIndex(field, "/")
+		if i < 0 {
+			continue
+		}
+		if strings.HasSuffix(field[i+1:], "-security") {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *AptPackageManager) InstallCmd(ctx context.Context, packages []string, securityOnly bool) ([]string, error) {
+	if !securityOnly {
+		if len(packages) == 0 {
+			return p.upgradeCmd, nil
+		}
+		return append(append([]string{}, p.installCmd...), packages...), nil
+	}
+
+	// apt-get cannot filter security updates, so they are selected from the pending ones
+	summaries, err := p.getSummaries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var securityPackages []string
+	for _, s := range summaries {
+		if s.IsSecurityUpdate && (len(packages) == 0 || containsString(packages, s.Title)) {
+			securityPackages = append(securityPackages, s.Title)
+		}
+	}
+	if len(securityPackages) == 0 {
+		return nil, errors.New("no security updates to install")
+	}
+	return append(append([]string{}, p.installCmd...), securityPackages...), nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, cur := range list {
+		if cur == s {
+			return true
+		}
+	}
+	return false
+}
+
 func (p *AptPackageManager) updatePackageCache(ctx context.Context) error {
 	_, err := p.runner.Run(ctx, p.updateCacheCmd...)
 	return err
@@ -230,6 +230,36 @@ Conf libc6-dev (2.31-0ubuntu9.2 Ubuntu:20.04/focal-updates [amd64])
 				},
 			},
 		},
+		{
+			Name: "Security updates detected by source suite only",
+			GetSummariesCmdOutput: `
+Inst node-security-utils [1.0-1] (1.0-2 Debian:11.6/stable [all])
+Inst libssl1.1 [1.1.1n-0+deb11u3] (1.1.1n-0+deb11u4 Debian-Security:11/stable-security [amd64])
+Inst bash [5.1-2] (5.1-2+deb11u1 Debian:11.6/stable, Debian:11-updates/stable-updates [amd64])
+`,
+			GetCountsCmdErr: errors.New("command not found"),
+			ExpectedResult: &models.UpdatesStatus{
+				UpdatesAvailable:         3,
+				SecurityUpdatesAvailable: 1,
+				UpdateSummaries: []models.UpdateSummary{
+					{
+						Title:            "node-security-utils",
+						Description:      "node-security-utils 1.0-2 Debian:11.6/stable [all]",
+						IsSecurityUpdate: false,
+					},
+					{
+						Title:            "libssl1.1",
+						Description:      "libssl1.1 1.1.1n-0+deb11u4 Debian-Security:11/stable-security [amd64]",
+						IsSecurityUpdate: true,
+					},
+					{
+						Title:            "bash",
+						Description:      "bash 5.1-2+deb11u1 Debian:11.6/stable, Debian:11-updates/stable-updates [amd64]",
+						IsSecurityUpdate: false,
+					},
+				},
+			},
+		},
 		{
 			Name:                   "Reboot pending",
 			RebootRequiredFilename: tmpFile.Name(),
@@ -267,3 +297,68 @@ Conf libc6-dev (2.31-0ubuntu9.2 Ubuntu:20.04/focal-updates [amd64])
 		})
 	}
 }
+
+func TestAptPackageMangerInstallCmd(t *testing.T) {
+	ctx := context.Background()
+	summariesOutput := `
+Inst libc6 [2.31-0ubuntu9.1] (2.31-0ubuntu9.2 Ubuntu:20.04/focal-updates [amd64])
+Inst openvpn [2.4.7-1ubuntu2] (2.4.7-1ubuntu2.20.04.2 Ubuntu:20.04/focal-updates, Ubuntu:20.04/focal-security [amd64])
+Inst openssl [1.1.1f-1ubuntu2] (1.1.1f-1ubuntu2.1 Ubuntu:20.04/focal-security [amd64])
+`
+
+	testCases := []struct {
+		Name          string
+		Packages      []string
+		SecurityOnly  bool
+		ExpectedCmd   []string
+		ExpectedError string
+	}{
+		{
+			Name:        "All updates",
+			ExpectedCmd: []string{"sudo", "-n", "apt-get", "dist-upgrade", "-y"},
+		},
+		{
+			Name:        "Given packages",
+			Packages:    []string{"libc6", "curl"},
+			ExpectedCmd: []string{"sudo", "-n", "apt-get", "install", "-y", "--only-upgrade", "libc6", "curl"},
+		},
+		{
+			Name:         "All security updates",
+			SecurityOnly: true,
+			ExpectedCmd:  []string{"sudo", "-n", "apt-get", "install", "-y", "--only-upgrade", "openvpn", "openssl"},
+		},
+		{
+			Name:         "Security updates of given packages",
+			Packages:     []string{"libc6", "openssl"},
+			SecurityOnly: true,
+			ExpectedCmd:  []string{"sudo", "-n", "apt-get", "install", "-y", "--only-upgrade", "openssl"},
+		},
+		{
+			Name:          "No security updates of given packages",
+			Packages:      []string{"libc6"},
+			SecurityOnly:  true,
+			ExpectedError: "no security updates to install",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			mr := newMockRunner()
+			apt := NewAptPackageManager()
+			apt.runner = mr
+			mr.Register(apt.getSummariesCmd, summariesOutput, nil)
+
+			cmd, err := apt.InstallCmd(ctx, tc.Packages, tc.SecurityOnly)
+
+			if tc.ExpectedError != "" {
+				assert.EqualError(t, err, tc.ExpectedError)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.ExpectedCmd, cmd)
+		})
+	}
+}
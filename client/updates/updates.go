@@ -3,7 +3,8 @@ package updates
 import (
 	"context"
 	"encoding/json"
-	"reflect"
+	"errors"
+	"fmt"
 	"sync"
 	"time"
 
@@ -15,50 +16,95 @@ import (
 )
 
 type PackageManager interface {
+	// Name returns a package manager type reported to the server, e.g. "apt"
+	Name() string
 	IsAvailable(context.Context) bool
 	GetUpdatesStatus(context.Context, *chshare.Logger) (*models.UpdatesStatus, error)
 }
 
+// Installer is implemented by package managers that can install updates.
+type Installer interface {
+	// InstallCmd returns a command that installs updates of given packages, all updates if no packages are given.
+	InstallCmd(ctx context.Context, packages []string, securityOnly bool) ([]string, error)
+}
+
+// detector detects an available package manager once and caches the result, since detection runs external commands.
+type detector struct {
+	packageManagers []PackageManager
+
+	// mtx protects detected and pkgMgr, it also serializes detection, since IsAvailable can modify a package manager
+	mtx      sync.Mutex
+	detected bool
+	pkgMgr   PackageManager
+}
+
+func (d *detector) detect(ctx context.Context) PackageManager {
+	d.mtx.Lock()
+	defer d.mtx.Unlock()
+
+	if d.detected {
+		return d.pkgMgr
+	}
+	for _, pm := range d.packageManagers {
+		if pm.IsAvailable(ctx) {
+			d.pkgMgr = pm
+			break
+		}
+	}
+	// detection interrupted by a canceled context is retried next time
+	d.detected = d.pkgMgr != nil || ctx.Err() == nil
+	return d.pkgMgr
+}
+
+var defaultDetector = &detector{packageManagers: packageManagers}
+
+// DetectPackageManager returns the first available package manager from the registry, nil if none is found.
+// The result is cached.
+func DetectPackageManager(ctx context.Context) PackageManager {
+	return defaultDetector.detect(ctx)
+}
+
 type Updates struct {
-	// mtx protects both conn and status
+	// mtx protects conn, status and stale
 	mtx    sync.RWMutex
 	conn   ssh.Conn
 	status *models.UpdatesStatus
+	// stale is set when the status is outdated before the interval elapsed, e.g. after updates were installed
+	stale bool
 
-	interval    time.Duration
+	interval time.Duration
+	// cacheTTL is how long a refreshed status is sent again on refresh instead of querying the package manager
+	cacheTTL    time.Duration
 	refreshChan chan struct{}
 
-	pkgMgr PackageManager
-	logger *chshare.Logger
+	detector *detector
+	logger   *chshare.Logger
 }
 
-func New(logger *chshare.Logger, interval time.Duration) *Updates {
+func New(logger *chshare.Logger, interval, cacheTTL time.Duration) *Updates {
 	return &Updates{
 		interval:    interval,
+		cacheTTL:    cacheTTL,
 		refreshChan: make(chan struct{}),
+		detector:    defaultDetector,
 		logger:      logger,
 	}
 }
 
-func (u *Updates) Start(ctx context.Context) {
-	if u.interval <= 0 {
-		return
-	}
+// NewWithPackageManager returns Updates that use a given package manager instead of detecting one.
+func NewWithPackageManager(logger *chshare.Logger, interval, cacheTTL time.Duration, pkgMgr PackageManager) *Updates {
+	u := New(logger, interval, cacheTTL)
+	u.detector = &detector{detected: true, pkgMgr: pkgMgr}
+	return u
+}
 
+// Start starts refreshing the status every interval. If the interval is not set, the status is refreshed only on Refresh.
+func (u *Updates) Start(ctx context.Context) {
 	go u.refreshLoop(ctx)
 }
 
 func (u *Updates) getPackageManager(ctx context.Context) PackageManager {
-	if u.pkgMgr != nil {
-		return u.pkgMgr
-	}
-	for _, pm := range packageManagers {
-		if pm.IsAvailable(ctx) {
-			u.pkgMgr = pm
-			return pm
-		}
-	}
-	return nil
+	return u.detector.detect(ctx)
 }
 
 func (u *Updates) Refresh() {
@@ -69,18 +115,63 @@ func (u *Updates) Refresh() {
 }
 
 func (u *Updates) refreshLoop(ctx context.Context) {
-	for {
+	var tick <-chan time.Time
+	if u.interval > 0 {
+		ticker := time.NewTicker(u.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+
 		u.refreshStatus(ctx)
+	}
 
+	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-time.After(u.interval):
+		case <-tick:
+			u.refreshStatus(ctx)
 		case <-u.refreshChan:
+			if u.isStatusFresh() {
+				u.logger.Debugf("Update status refreshed less than %v ago, sending the cached one", u.cacheTTL)
+				go u.sendUpdates()
+				continue
+			}
+			u.refreshStatus(ctx)
 		}
 	}
 }
 
+// isStatusFresh returns true if the status was successfully refreshed within the cache TTL
+func (u *Updates) isStatusFresh() bool {
+	u.mtx.RLock()
+	defer u.mtx.RUnlock()
+
+	return u.status != nil && !u.stale && u.status.Error == "" && time.Since(u.status.Refreshed) < u.cacheTTL
+}
+
+// InstallCmd returns a command installing updates by the detected package manager.
+func (u *Updates) InstallCmd(ctx context.Context, packages []string, securityOnly bool) ([]string, error) {
+	pkgMgr := u.getPackageManager(ctx)
+	if pkgMgr == nil {
+		return nil, errors.New("no supported package manager found")
+	}
+
+	installer, ok := pkgMgr.(Installer)
+	if !ok {
+		return nil, fmt.Errorf("installing updates is not supported by %s", pkgMgr.Name())
+	}
+	return installer.InstallCmd(ctx, packages, securityOnly)
+}
+
+// RefreshStale marks the status as outdated and refreshes it bypassing the cache.
+func (u *Updates) RefreshStale() {
+	u.mtx.Lock()
+	u.stale = true
+	u.mtx.Unlock()
+
+	u.Refresh()
+}
+
 func (u *Updates) refreshStatus(ctx context.Context) {
 	var newStatus *models.UpdatesStatus
 
@@ -90,7 +181,7 @@ func (u *Updates) refreshStatus(ctx context.Context) {
 			Error: "no supported package manager found",
 		}
 	} else {
-		u.logger.Infof("Using %v for updates", reflect.TypeOf(pkgMgr).Elem().Name())
+		u.logger.Infof("Using %v for updates", pkgMgr.Name())
 
 		status, err := pkgMgr.GetUpdatesStatus(ctx, u.logger)
 		if err != nil {
@@ -112,6 +203,7 @@ func (u *Updates) refreshStatus(ctx context.Context) {
 
 	u.mtx.Lock()
 	u.status = newStatus
+	u.stale = false
 	u.mtx.Unlock()
 
 	go u.sendUpdates()
@@ -6,4 +6,5 @@ var packageManagers = []PackageManager{
 	NewZypperPackageManager(),
 	NewYumPackageManager(),
 	NewAptPackageManager(),
+	NewApkPackageManager(),
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -17,16 +18,24 @@ import (
 )
 
 type mockPackageManager struct {
-	isAvailable bool
-	status      *models.UpdatesStatus
-	err         error
+	isAvailable    bool
+	status         *models.UpdatesStatus
+	err            error
+	calls          int32
+	availableCalls int32
+}
+
+func (pm *mockPackageManager) Name() string {
+	return "mock"
 }
 
 func (pm *mockPackageManager) IsAvailable(context.Context) bool {
+	atomic.AddInt32(&pm.availableCalls, 1)
 	return pm.isAvailable
 }
 
 func (pm *mockPackageManager) GetUpdatesStatus(context.Context, *chshare.Logger) (*models.UpdatesStatus, error) {
+	atomic.AddInt32(&pm.calls, 1)
 	newStatus := &models.UpdatesStatus{}
 	if pm.status != nil {
 		*newStatus = *pm.status
@@ -122,12 +131,11 @@ func TestUpdates(t *testing.T) {
 				status:      tc.Status,
 				isAvailable: !tc.NotAvailable,
 			}
-			packageManagers = []PackageManager{pm}
-
 			if tc.Interval == 0 {
 				tc.Interval = time.Hour
 			}
-			updates := New(logger, tc.Interval)
+			updates := New(logger, tc.Interval, tc.Interval)
+			updates.detector = &detector{packageManagers: []PackageManager{pm}}
 			updates.Start(ctx)
 
 			mockConn := &mockSSHConn{
@@ -157,3 +165,129 @@ func TestUpdates(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdatesRefresh(t *testing.T) {
+	logger := chshare.NewLogger("test", chshare.NewLogOutput(""), chshare.LogLevelDebug)
+
+	testCases := []struct {
+		Name              string
+		Interval          time.Duration
+		CacheTTL          time.Duration
+		Force             bool
+		PackageManagerErr error
+		NumRefreshes      int
+		ExpectedCalls     int32
+	}{
+		{
+			Name:          "Pull only without cache, refreshed on every request",
+			NumRefreshes:  2,
+			ExpectedCalls: 2,
+		},
+		{
+			Name:          "Refresh within cache TTL reuses cached status",
+			Interval:      time.Hour,
+			CacheTTL:      time.Hour,
+			NumRefreshes:  2,
+			ExpectedCalls: 1,
+		},
+		{
+			Name:          "Pull only, refresh within cache TTL reuses cached status",
+			CacheTTL:      time.Hour,
+			NumRefreshes:  2,
+			ExpectedCalls: 1,
+		},
+		{
+			Name:          "Forced refresh bypasses cache",
+			CacheTTL:      time.Hour,
+			Force:         true,
+			NumRefreshes:  2,
+			ExpectedCalls: 2,
+		},
+		{
+			Name:          "Refresh after cache TTL expired",
+			Interval:      time.Hour,
+			CacheTTL:      time.Nanosecond,
+			NumRefreshes:  2,
+			ExpectedCalls: 3,
+		},
+		{
+			Name:              "Failed status is not cached",
+			Interval:          time.Hour,
+			CacheTTL:          time.Hour,
+			PackageManagerErr: errors.New("some error"),
+			NumRefreshes:      2,
+			ExpectedCalls:     3,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			pm := &mockPackageManager{
+				err:         tc.PackageManagerErr,
+				status:      &models.UpdatesStatus{UpdatesAvailable: 13},
+				isAvailable: true,
+			}
+			// conn is set directly, SetConn would send the initial status once more
+			updates := New(logger, tc.Interval, tc.CacheTTL)
+			updates.detector = &detector{packageManagers: []PackageManager{pm}}
+			mockConn := &mockSSHConn{
+				requests: make(chan mockSSHRequest, 1),
+			}
+			updates.conn = mockConn
+			updates.Start(ctx)
+
+			if tc.Interval > 0 {
+				// initial refresh
+				<-mockConn.requests
+			}
+			for i := 0; i < tc.NumRefreshes; i++ {
+				// refresh is dropped while the previous one is being processed, so retry until it's sent
+				var request mockSSHRequest
+				require.Eventually(t, func() bool {
+					if tc.Force {
+						updates.RefreshStale()
+					} else {
+						updates.Refresh()
+					}
+					select {
+					case request = <-mockConn.requests:
+						return true
+					case <-time.After(10 * time.Millisecond):
+						return false
+					}
+				}, time.Second, time.Millisecond)
+				assert.Equal(t, comm.RequestTypeUpdatesStatus, request.Name)
+			}
+
+			assert.Equal(t, tc.ExpectedCalls, atomic.LoadInt32(&pm.calls))
+		})
+	}
+}
+
+func TestDetectorCachesPackageManager(t *testing.T) {
+	notAvailable := &mockPackageManager{}
+	available := &mockPackageManager{isAvailable: true}
+	d := &detector{packageManagers: []PackageManager{notAvailable, available}}
+
+	for i := 0; i < 3; i++ {
+		assert.Same(t, available, d.detect(context.Background()))
+	}
+	assert.EqualValues(t, 1, atomic.LoadInt32(&notAvailable.availableCalls))
+	assert.EqualValues(t, 1, atomic.LoadInt32(&available.availableCalls))
+}
+
+func TestDetectorRetriesCanceledDetection(t *testing.T) {
+	pm := &mockPackageManager{}
+	d := &detector{packageManagers: []PackageManager{pm}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	assert.Nil(t, d.detect(ctx))
+	pm.isAvailable = true
+	assert.Same(t, pm, d.detect(context.Background()))
+	assert.Same(t, pm, d.detect(context.Background()))
+	assert.EqualValues(t, 2, atomic.LoadInt32(&pm.availableCalls))
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/go-ole/go-ole"
 	"github.com/go-ole/go-ole/oleutil"
 	"github.com/scjalliance/comshim"
+	"golang.org/x/sys/windows/registry"
 
 	chshare "github.com/cloudradar-monitoring/rport/share"
 	"github.com/cloudradar-monitoring/rport/share/models"
@@ -25,6 +26,10 @@ func NewWindowsPackageManager() *WindowsPackageManager {
 	return &WindowsPackageManager{}
 }
 
+func (p *WindowsPackageManager) Name() string {
+	return "windows_update"
+}
+
 func (p *WindowsPackageManager) IsAvailable(ctx context.Context) bool {
 	return true
 }
@@ -109,7 +114,14 @@ func (p *WindowsPackageManager) GetUpdatesStatus(ctx context.Context, logger *ch
 	}, nil
 }
 
+// rebootRequiredKey exists while Windows Update waits for a reboot to finish installing updates
+const rebootRequiredKey = `SOFTWARE\Microsoft\Windows\CurrentVersion\WindowsUpdate\Auto Update\RebootRequired`
+
 func (p *WindowsPackageManager) checkRebootPending() (bool, error) {
+	if p.rebootRequiredKeyExists() {
+		return true, nil
+	}
+
 	sysInfo, err := p.newCOMObject("Microsoft.Update.SystemInfo")
 	if err != nil {
 		return false, err
@@ -119,6 +131,15 @@ func (p *WindowsPackageManager) checkRebootPending() (bool, error) {
 	return p.getBool(sysInfo, "RebootRequired")
 }
 
+func (p *WindowsPackageManager) rebootRequiredKeyExists() bool {
+	key, err := registry.OpenKey(registry.LOCAL_MACHINE, rebootRequiredKey, registry.QUERY_VALUE)
+	if err != nil {
+		return false
+	}
+	key.Close()
+	return true
+}
+
 func (p *WindowsPackageManager) listUpdates() (*ole.IDispatch, error) {
 	sess, err := p.newCOMObject("Microsoft.Update.Session")
 	if err != nil {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
 
 	chshare "github.com/cloudradar-monitoring/rport/share"
 	"github.com/cloudradar-monitoring/rport/share/models"
@@ -11,7 +12,10 @@ import (
 
 type YumPackageManager struct {
 	runner Runner
-	cmd    string
+
+	// mtx protects cmd, it's set on detection while a running updates refresh can read it
+	mtx sync.RWMutex
+	cmd string
 }
 
 func NewYumPackageManager() *YumPackageManager {
@@ -21,12 +25,18 @@ func NewYumPackageManager() *YumPackageManager {
 	}
 }
 
+func (p *YumPackageManager) Name() string {
+	return "yum"
+}
+
 func (p *YumPackageManager) IsAvailable(ctx context.Context) bool {
 	// Can select either dnf or yum command, whichever is available
 	for _, cmd := range []string{"dnf", "yum"} {
-		p.cmd = cmd
-		_, err := p.run(ctx, "help")
+		_, err := p.runner.Run(ctx, cmd, "help")
 		if err == nil {
+			p.mtx.Lock()
+			p.cmd = cmd
+			p.mtx.Unlock()
 			return true
 		}
 	}
@@ -114,7 +124,22 @@ func (p *YumPackageManager) checkRebootRequired(ctx context.Context) bool {
 	return strings.Contains(output, "Reboot is required")
 }
 
+func (p *YumPackageManager) InstallCmd(ctx context.Context, packages []string, securityOnly bool) ([]string, error) {
+	cmd := []string{"sudo", "-n", p.command(), "update", "-y"}
+	if securityOnly {
+		cmd = append(cmd, "--security")
+	}
+	return append(cmd, packages...), nil
+}
+
 func (p *YumPackageManager) run(ctx context.Context, args ...string) (string, error) {
-	fullCmd := append([]string{p.cmd}, args...)
+	fullCmd := append([]string{p.command()}, args...)
 	return p.runner.Run(ctx, fullCmd...)
 }
+
+func (p *YumPackageManager) command() string {
+	p.mtx.RLock()
+	defer p.mtx.RUnlock()
+
+	return p.cmd
+}
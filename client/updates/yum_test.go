@@ -206,3 +206,13 @@ It could be a DNF plugin command, try: "dnf install 'dnf-command(needs-restartin
 		}
 	}
 }
+
+func TestYumPackageMangerInstallCmd(t *testing.T) {
+	yum := NewYumPackageManager()
+	yum.cmd = "dnf"
+
+	cmd, err := yum.InstallCmd(context.Background(), []string{"openssl", "curl"}, true)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"sudo", "-n", "dnf", "update", "-y", "--security", "openssl", "curl"}, cmd)
+}
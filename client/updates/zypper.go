@@ -33,6 +33,10 @@ func NewZypperPackageManager() *ZypperPackageManager {
 	}
 }
 
+func (p *ZypperPackageManager) Name() string {
+	return "zypper"
+}
+
 func (p *ZypperPackageManager) IsAvailable(ctx context.Context) bool {
 	_, err := p.runner.Run(ctx, p.detectCmd...)
 	return err == nil
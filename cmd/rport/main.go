@@ -1,10 +1,15 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/kardianos/service"
@@ -76,12 +81,23 @@ var clientHelp = `
     specify a time with a unit, for example '30s' or '2m'. Defaults
     to '0s' (disabled).
 
+    --keepalive-timeout, An optional time to wait for a response to
+    keepalive pings. If the server doesn't respond to any ping within it,
+    the connection is considered dead and the client reconnects.
+    It should be a few times longer than the keepalive interval, for
+    example '2m' for '30s'. It's rejected if --keepalive is not set
+    or is not shorter. Defaults to '0s' (disabled).
+
     --max-retry-count, Maximum number of times to retry before exiting.
     Defaults to unlimited (-1).
 
     --max-retry-interval, Maximum wait time before retrying after a
     disconnection. Defaults to 5 minutes ('5m').
 
+    --fail-fast-initial, Exit with an error if the very first connection
+    to the server fails instead of retrying. Reconnects after a successful
+    connection are not affected. Defaults to false.
+
     --proxy, An optional HTTP CONNECT or SOCKS5 proxy which will be
     used to reach the rport server. Authentication can be specified
     inside the URL.
@@ -91,6 +107,10 @@ var clientHelp = `
     --header, Set a custom header in the form "HeaderName: HeaderContent".
     Can be used multiple times. (e.g --header "User-Agent: test1" --header "Authorization: Basic XXXXXX")
 
+    --allowed-header, An optional name of a header that is allowed to be set by --header.
+    Can be used multiple times. If set, the client refuses to start if --header contains any other header.
+    The 'Host' header set by --hostname is always allowed. By default, any header can be set.
+
     --hostname, Optionally set the 'Host' header (defaults to the host
     found in the server url).
 
@@ -107,6 +127,10 @@ var clientHelp = `
     Used for filtering clients on the server.
     Can be used multiple times. (e.g --tag "foobaz" --tag "bingo")
 
+    --environment, An optional label of an environment the client runs in, e.g. "dev", "staging" or "prod".
+    Used for filtering and sorting clients on the server.
+    Defaults to unset.
+
     --allow-root, An optional arg to allow running rport as root. There is no technical requirement to run the rport
     client under the root user. Running it as root is an unnecessary security risk.
 
@@ -125,6 +149,10 @@ var clientHelp = `
     --remote-scripts-enabled, Enable or disable remote scripts.
     Defaults: false
 
+    --no-commands, Disable execution of remote commands and scripts entirely, the client serves only tunnels.
+    Overrides --remote-commands-enabled and --remote-scripts-enabled.
+    Defaults: false
+
     --data-dir, Temporary directory to store temp client data.
     Defaults: /var/lib/rport (unix) or C:\Program Files\rport (windows)
 
@@ -132,22 +160,42 @@ var clientHelp = `
     Applies to the stdout and stderr separately. If exceeded the specified number of bytes are sent.
     Defaults: 2048
 
+    --max-concurrent-commands, Limit how many remote commands or scripts run simultaneously.
+    Further commands are refused, multi-client jobs wait for a running command to finish.
+    Defaults: 1
+
+    --queue-commands-when-busy, Let all commands wait for a running command to finish instead of being refused
+    when --max-concurrent-commands is reached.
+    Defaults: false
+
     --updates-interval, How often after the rport client has started pending updates are summarized.
     Defaults: 4h
 
+    --updates-cache-ttl, How long the last summary of pending updates is returned on a refresh requested by the server
+    instead of querying the package manager again, unless the refresh is forced. Set 0 to query it on every refresh.
+    Defaults: 4h
+
     --fallback-server, Set fallback server(s) to which the client tries to connect if the main server is not reachable.
 
+    --remotes-file, A path to a file with remotes, one per line in the same format as <remote>s above.
+    Blank lines and lines starting with # are ignored. Remotes given after <server> are appended after the ones of the file.
+
     --server-switchback-interval, If connected to fallback server, try every interval to switch back to the main server.
     Defaults: 2m
 
     --config, -c, An optional arg to define a path to a config file. If it is set then
     configuration will be loaded from the file. Note: command arguments and env variables will override them.
-    Config file should be in TOML format. You can find an example "rport.example.conf" in the release archive.
+    Config file should be in TOML format, or in JSON format if its name ends with ".json".
+    You can find an example "rport.example.conf" in the release archive.
 
     --help, This help text
 
     --version, Print version info and exit
 
+    --server-info, Print the version, the protocol and the features of a server at a given address and exit
+    without connecting to it as a client, e.g. --server-info "rport.example.com:8080". Use it to check
+    the compatibility of the client and the server before deploying.
+
   Signals:
     The rport process is listening for:
       a SIGUSR2 to print process stats, and
@@ -164,6 +212,8 @@ var (
 
 	svcCommand *string
 	svcUser    *string
+
+	serverInfoAddr *string
 )
 
 func init() {
@@ -178,27 +228,37 @@ func init() {
 	pFlags.String("fingerprint", "", "")
 	pFlags.String("auth", "", "")
 	pFlags.Duration("keepalive", 0, "")
+	pFlags.Duration("keepalive-timeout", 0, "")
 	pFlags.Int("max-retry-count", 0, "")
 	pFlags.Duration("max-retry-interval", 0, "")
+	pFlags.Bool("fail-fast-initial", false, "")
 	pFlags.String("proxy", "", "")
 	pFlags.StringArray("header", []string{}, "")
+	pFlags.StringArray("allowed-header", []string{}, "")
 	pFlags.String("id", "", "")
 	pFlags.String("name", "", "")
 	pFlags.StringArrayP("tag", "t", []string{}, "")
+	pFlags.String("environment", "", "")
 	pFlags.String("hostname", "", "")
 	pFlags.StringP("log-file", "l", "", "")
 	pFlags.String("log-level", "", "")
 	pFlags.Bool("allow-root", false, "")
 	pFlags.Bool("remote-commands-enabled", false, "")
 	pFlags.Bool("remote-scripts-enabled", false, "")
+	pFlags.Bool("no-commands", false, "")
 	pFlags.String("data-dir", chclient.DefaultDataDir, "")
 	pFlags.Int("remote-commands-send-back-limit", 0, "")
+	pFlags.Int("max-concurrent-commands", 0, "")
+	pFlags.Bool("queue-commands-when-busy", false, "")
 	pFlags.Duration("updates-interval", 0, "")
+	pFlags.Duration("updates-cache-ttl", 0, "")
 	pFlags.StringArray("fallback-server", []string{}, "")
+	pFlags.String("remotes-file", "", "")
 	pFlags.Duration("server-switchback-interval", 0, "")
 
 	cfgPath = pFlags.StringP("config", "c", "", "")
 	svcCommand = pFlags.String("service", "", "")
+	serverInfoAddr = pFlags.String("server-info", "", "")
 	if runtime.GOOS != "windows" {
 		svcUser = pFlags.String("service-user", "rport", "")
 	}
@@ -219,10 +279,25 @@ func init() {
 	viperCfg.SetDefault("remote-commands.deny", []string{`(\||<|>|;|,|\n|&)`})
 	viperCfg.SetDefault("remote-commands.order", []string{"allow", "deny"})
 	viperCfg.SetDefault("remote-commands.send_back_limit", 4194304)
+	viperCfg.SetDefault("remote-commands.max_concurrent", 1)
 	viperCfg.SetDefault("remote-commands.enabled", true)
 	viperCfg.SetDefault("remote-scripts.enabled", false)
 	viperCfg.SetDefault("client.updates_interval", 4*time.Hour)
+	viperCfg.SetDefault("client.updates_cache_ttl", 4*time.Hour)
 	viperCfg.SetDefault("client.data_dir", chclient.DefaultDataDir)
+	viperCfg.SetDefault("health.interval", 5*time.Minute)
+	viperCfg.SetDefault("health.disk_path", defaultHealthDiskPath())
+	viperCfg.SetDefault("health.disk_degraded_percent", 90)
+	viperCfg.SetDefault("health.disk_unhealthy_percent", 98)
+	viperCfg.SetDefault("health.load_degraded", 2)
+	viperCfg.SetDefault("health.load_unhealthy", 4)
+}
+
+func defaultHealthDiskPath() string {
+	if runtime.GOOS == "windows" {
+		return `C:\`
+	}
+	return "/"
 }
 
 func bindPFlags() {
@@ -234,24 +309,33 @@ func bindPFlags() {
 	_ = viperCfg.BindPFlag("client.id", pFlags.Lookup("id"))
 	_ = viperCfg.BindPFlag("client.name", pFlags.Lookup("name"))
 	_ = viperCfg.BindPFlag("client.tags", pFlags.Lookup("tag"))
+	_ = viperCfg.BindPFlag("client.environment", pFlags.Lookup("environment"))
 	_ = viperCfg.BindPFlag("client.allow_root", pFlags.Lookup("allow-root"))
 	_ = viperCfg.BindPFlag("client.updates_interval", pFlags.Lookup("updates-interval"))
+	_ = viperCfg.BindPFlag("client.updates_cache_ttl", pFlags.Lookup("updates-cache-ttl"))
 	_ = viperCfg.BindPFlag("client.fallback_servers", pFlags.Lookup("fallback-server"))
+	_ = viperCfg.BindPFlag("client.remotes_file", pFlags.Lookup("remotes-file"))
 	_ = viperCfg.BindPFlag("client.server_switchback_interval", pFlags.Lookup("server-switchback-interval"))
 	_ = viperCfg.BindPFlag("client.data_dir", pFlags.Lookup("data-dir"))
+	_ = viperCfg.BindPFlag("client.no_commands", pFlags.Lookup("no-commands"))
 
 	_ = viperCfg.BindPFlag("logging.log_file", pFlags.Lookup("log-file"))
 	_ = viperCfg.BindPFlag("logging.log_level", pFlags.Lookup("log-level"))
 
 	_ = viperCfg.BindPFlag("connection.keep_alive", pFlags.Lookup("keepalive"))
+	_ = viperCfg.BindPFlag("connection.keep_alive_timeout", pFlags.Lookup("keepalive-timeout"))
 	_ = viperCfg.BindPFlag("connection.max_retry_count", pFlags.Lookup("max-retry-count"))
 	_ = viperCfg.BindPFlag("connection.max_retry_interval", pFlags.Lookup("max-retry-interval"))
+	_ = viperCfg.BindPFlag("connection.fail_fast_initial", pFlags.Lookup("fail-fast-initial"))
 	_ = viperCfg.BindPFlag("connection.hostname", pFlags.Lookup("hostname"))
 	_ = viperCfg.BindPFlag("connection.headers", pFlags.Lookup("header"))
+	_ = viperCfg.BindPFlag("connection.allowed_headers", pFlags.Lookup("allowed-header"))
 
 	_ = viperCfg.BindPFlag("remote-commands.enabled", pFlags.Lookup("remote-commands-enabled"))
 	_ = viperCfg.BindPFlag("remote-scripts.enabled", pFlags.Lookup("remote-scripts-enabled"))
 	_ = viperCfg.BindPFlag("remote-commands.send_back_limit", pFlags.Lookup("remote-commands-send-back-limit"))
+	_ = viperCfg.BindPFlag("remote-commands.max_concurrent", pFlags.Lookup("max-concurrent-commands"))
+	_ = viperCfg.BindPFlag("remote-commands.queue_when_busy", pFlags.Lookup("queue-commands-when-busy"))
 }
 
 func main() {
@@ -261,9 +345,24 @@ func main() {
 	}
 }
 
+// configFileType returns a format of a given config file. Files with ".json" extension are JSON. Other files are JSON
+// if their content starts with "{", otherwise TOML.
+func configFileType(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return "json"
+	}
+	content, err := ioutil.ReadFile(path)
+	if err == nil && bytes.HasPrefix(bytes.TrimSpace(content), []byte("{")) {
+		return "json"
+	}
+	return "toml"
+}
+
+// decodeConfig loads the config file. The server and remotes given as args override the ones from the file.
 func decodeConfig(args []string) error {
 	if *cfgPath != "" {
 		viperCfg.SetConfigFile(*cfgPath)
+		viperCfg.SetConfigType(configFileType(*cfgPath))
 	} else {
 		viperCfg.AddConfigPath(".")
 		viperCfg.SetConfigName("rport.conf")
@@ -275,17 +374,63 @@ func decodeConfig(args []string) error {
 
 	if len(args) > 0 {
 		config.Client.Server = args[0]
+	}
+	if len(args) > 1 {
 		config.Client.Remotes = args[1:]
 	}
 
+	return markLocallySetConfig()
+}
+
+// pushableConfigFlags maps config keys the server can push to command line flags that set them.
+var pushableConfigFlags = map[string]string{
+	chclient.ConfigKeyKeepAlive:     "keepalive",
+	chclient.ConfigKeySendBackLimit: "remote-commands-send-back-limit",
+}
+
+// markLocallySetConfig marks values set explicitly in the config file or on the command line,
+// so they are not overridden by a config pushed by the server.
+func markLocallySetConfig() error {
+	fileCfg := viper.New()
+	if file := viperCfg.ConfigFileUsed(); file != "" {
+		fileCfg.SetConfigFile(file)
+		fileCfg.SetConfigType(configFileType(file))
+		if err := fileCfg.ReadInConfig(); err != nil {
+			if _, ok := err.(viper.ConfigFileNotFoundError); !ok && !os.IsNotExist(err) {
+				return fmt.Errorf("error reading config file: %s", err)
+			}
+		}
+	}
+
+	pFlags := RootCmd.PersistentFlags()
+	for _, key := range chclient.PushableConfigKeys {
+		flag := pFlags.Lookup(pushableConfigFlags[key])
+		if fileCfg.IsSet(key) || (flag != nil && flag.Changed) {
+			config.SetLocallySet(key)
+		}
+	}
 	return nil
 }
 
 func runMain(cmd *cobra.Command, args []string) {
+	if *serverInfoAddr != "" {
+		info, err := chclient.GetServerInfo(context.Background(), *serverInfoAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := chclient.PrintServerInfo(os.Stdout, info); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	if svcCommand != nil && *svcCommand != "" {
 		// validate config file without command line args before installing it for the service
 		// other service commands do not change config file specified at install
 		if *svcCommand == "install" {
+			if len(args) > 0 {
+				log.Println("The server and remotes given as arguments are ignored, the service uses only the config file.")
+			}
 			err := decodeConfig(nil)
 			if err != nil {
 				log.Fatalf("Invalid config: %v. Check your config file.", err)
@@ -306,7 +451,7 @@ func runMain(cmd *cobra.Command, args []string) {
 	// Bind command line arguments late, so they're not included in validation for service install
 	bindPFlags()
 
-	err := decodeConfig(nil)
+	err := decodeConfig(args)
 	if err != nil {
 		log.Fatalf("Invalid config: %v. Check your config file.", err)
 	}
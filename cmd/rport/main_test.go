@@ -0,0 +1,166 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	chclient "github.com/cloudradar-monitoring/rport/client"
+)
+
+const (
+	tomlConfig = `
+[client]
+  server = "file.example.com:8080"
+  remotes = ["2222:22", "3389"]
+`
+	jsonConfig = `
+{
+  "client": {
+    "server": "file.example.com:8080",
+    "remotes": ["2222:22", "3389"]
+  }
+}`
+)
+
+func writeConfigFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestConfigFileType(t *testing.T) {
+	testCases := []struct {
+		name     string
+		fileName string
+		content  string
+		want     string
+	}{
+		{
+			name:     "json extension",
+			fileName: "rport.json",
+			content:  jsonConfig,
+			want:     "json",
+		},
+		{
+			name:     "json extension in upper case",
+			fileName: "rport.JSON",
+			content:  jsonConfig,
+			want:     "json",
+		},
+		{
+			name:     "toml extension",
+			fileName: "rport.toml",
+			content:  tomlConfig,
+			want:     "toml",
+		},
+		{
+			name:     "conf extension",
+			fileName: "rport.conf",
+			content:  tomlConfig,
+			want:     "toml",
+		},
+		{
+			name:     "json content without extension",
+			fileName: "rport",
+			content:  jsonConfig,
+			want:     "json",
+		},
+		{
+			name:     "toml content without extension",
+			fileName: "rport",
+			content:  tomlConfig,
+			want:     "toml",
+		},
+		{
+			name:     "json content with unknown extension",
+			fileName: "rport.cfg",
+			content:  jsonConfig,
+			want:     "json",
+		},
+		{
+			name:     "unknown content with unknown extension",
+			fileName: "rport.yaml",
+			content:  "client:\n  server: file.example.com:8080\n",
+			want:     "toml",
+		},
+		{
+			name:     "empty file",
+			fileName: "rport",
+			want:     "toml",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			path := writeConfigFile(t, tc.fileName, tc.content)
+
+			assert.Equal(t, tc.want, configFileType(path))
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		assert.Equal(t, "toml", configFileType(filepath.Join(t.TempDir(), "rport")))
+	})
+}
+
+func TestDecodeConfigArgsOverrideFile(t *testing.T) {
+	defaultViperCfg, defaultConfig, defaultCfgPath := viperCfg, config, *cfgPath
+	defer func() {
+		viperCfg, config, *cfgPath = defaultViperCfg, defaultConfig, defaultCfgPath
+	}()
+
+	testCases := []struct {
+		name        string
+		args        []string
+		wantServer  string
+		wantRemotes []string
+	}{
+		{
+			name:        "no args",
+			wantServer:  "file.example.com:8080",
+			wantRemotes: []string{"2222:22", "3389"},
+		},
+		{
+			name:        "server",
+			args:        []string{"arg.example.com:9090"},
+			wantServer:  "arg.example.com:9090",
+			wantRemotes: []string{"2222:22", "3389"},
+		},
+		{
+			name:        "server and remotes",
+			args:        []string{"arg.example.com:9090", "8080:80"},
+			wantServer:  "arg.example.com:9090",
+			wantRemotes: []string{"8080:80"},
+		},
+	}
+
+	for _, file := range []struct {
+		name    string
+		content string
+	}{
+		{name: "rport.conf", content: tomlConfig},
+		{name: "rport.json", content: jsonConfig},
+		{name: "rport", content: jsonConfig},
+	} {
+		path := writeConfigFile(t, file.name, file.content)
+		for _, tc := range testCases {
+			tc := tc
+			t.Run(file.name+"/"+tc.name, func(t *testing.T) {
+				viperCfg = viper.New()
+				config = &chclient.Config{}
+				*cfgPath = path
+
+				require.NoError(t, decodeConfig(tc.args))
+
+				assert.Equal(t, tc.wantServer, config.Client.Server)
+				assert.Equal(t, tc.wantRemotes, config.Client.Remotes)
+			})
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/spf13/viper"
 
 	chserver "github.com/cloudradar-monitoring/rport/server"
+	"github.com/cloudradar-monitoring/rport/server/api/jobs"
 	"github.com/cloudradar-monitoring/rport/server/api/message"
 	chshare "github.com/cloudradar-monitoring/rport/share"
 	"github.com/cloudradar-monitoring/rport/share/files"
@@ -27,6 +28,19 @@ const (
 	DefaultServerAddress          = "0.0.0.0:8080"
 	DefaultLogLevel               = "info"
 	DefaultRunRemoteCmdTimeoutSec = 60
+	DefaultMaxTunnelCopies        = 20000
+	DefaultTunnelCopyWait         = time.Second
+	DefaultTunnelConnLogLevel     = "debug"
+	DefaultTunnelConnLogSampling  = 1
+	DefaultMaxChannelsPerClient   = 1000
+	DefaultMaxJobResultSizeBytes  = 4 * 1024 * 1024
+	DefaultKeepAuditLog           = 365 * 24 * time.Hour
+	DefaultMaxClientsPageLimit    = 1000
+	DefaultCleanClientsBatchSize  = 100
+	DefaultClientSaveBatchSize    = 100
+	DefaultConnAttemptsInterval   = time.Minute
+	DefaultConnRateBanTime        = 5 * time.Minute
+	DefaultShutdownGracePeriod    = 30 * time.Second
 )
 
 var serverHelp = `
@@ -202,6 +216,8 @@ var serverHelp = `
 
   Signals:
     The rportd process is listening for SIGUSR2 to print process stats
+    On SIGTERM or SIGINT the rportd process stops accepting new connections and waits up to
+    'shutdown_grace_period' for running jobs to finish before it exits
 
 `
 
@@ -284,6 +300,8 @@ func init() {
 	viperCfg.SetDefault("server.data_dir", chserver.DefaultDataDirectory)
 	viperCfg.SetDefault("server.keep_lost_clients", DefaultKeepLostClients)
 	viperCfg.SetDefault("server.cleanup_clients_interval", DefaultCleanClientsInterval)
+	viperCfg.SetDefault("server.cleanup_clients_batch_size", DefaultCleanClientsBatchSize)
+	viperCfg.SetDefault("server.client_save_batch_size", DefaultClientSaveBatchSize)
 	viperCfg.SetDefault("server.max_request_bytes", DefaultMaxRequestBytes)
 	viperCfg.SetDefault("server.check_port_timeout", DefaultCheckPortTimeout)
 	viperCfg.SetDefault("server.auth_write", true)
@@ -292,13 +310,35 @@ func init() {
 	viperCfg.SetDefault("server.client_login_wait", 2)
 	viperCfg.SetDefault("server.max_failed_login", 5)
 	viperCfg.SetDefault("server.ban_time", 3600)
+	viperCfg.SetDefault("server.conn_attempts_interval", DefaultConnAttemptsInterval)
+	viperCfg.SetDefault("server.conn_rate_ban_time", DefaultConnRateBanTime)
 	viperCfg.SetDefault("server.enable_ws_test_endpoints", false)
+	viperCfg.SetDefault("server.max_concurrent_multi_jobs", 100)
+	viperCfg.SetDefault("server.jobs_db_driver", jobs.DBDriverSqlite)
+	viperCfg.SetDefault("server.max_concurrent_tunnel_copies", DefaultMaxTunnelCopies)
+	viperCfg.SetDefault("server.tunnel_copy_wait", DefaultTunnelCopyWait)
+	viperCfg.SetDefault("server.tunnel_conn_log_level", DefaultTunnelConnLogLevel)
+	viperCfg.SetDefault("server.tunnel_conn_log_sample_rate", DefaultTunnelConnLogSampling)
+	viperCfg.SetDefault("server.max_channels_per_client", DefaultMaxChannelsPerClient)
+	viperCfg.SetDefault("server.max_job_result_size_bytes", DefaultMaxJobResultSizeBytes)
+	viperCfg.SetDefault("server.keep_audit_log", DefaultKeepAuditLog)
+	viperCfg.SetDefault("server.first_registration_hook_retries", 3)
+	viperCfg.SetDefault("server.first_registration_hook_timeout", 10*time.Second)
+	viperCfg.SetDefault("server.client_state_webhook_retries", 3)
+	viperCfg.SetDefault("server.client_state_webhook_timeout", 10*time.Second)
+	viperCfg.SetDefault("server.shutdown_grace_period", DefaultShutdownGracePeriod)
 	viperCfg.SetDefault("api.user_login_wait", 2)
 	viperCfg.SetDefault("api.max_failed_login", 10)
 	viperCfg.SetDefault("api.ban_time", 600)
+	viperCfg.SetDefault("api.max_clients_page_limit", DefaultMaxClientsPageLimit)
 	viperCfg.SetDefault("api.two_fa_token_ttl_seconds", 600)
 	viperCfg.SetDefault("api.two_fa_send_timeout", 10*time.Second)
 	viperCfg.SetDefault("api.two_fa_send_to_type", message.ValidationNone)
+	viperCfg.SetDefault("ldap.user_filter", "(uid=%s)")
+	viperCfg.SetDefault("ldap.group_filter", "(member=%s)")
+	viperCfg.SetDefault("ldap.group_attribute", "cn")
+	viperCfg.SetDefault("ldap.timeout", 10*time.Second)
+	viperCfg.SetDefault("ldap.bind_cache_ttl", time.Minute)
 }
 
 func bindPFlags() {
@@ -66,5 +66,5 @@ func (w *serviceWrapper) Start(service.Service) error {
 }
 
 func (w *serviceWrapper) Stop(service.Service) error {
-	return w.Server.Close()
+	return w.Server.Shutdown()
 }
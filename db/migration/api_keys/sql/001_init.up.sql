@@ -0,0 +1,10 @@
+CREATE TABLE api_keys (
+    id TEXT PRIMARY KEY NOT NULL,
+    username TEXT NOT NULL,
+    name TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME DEFAULT NULL
+);
+CREATE UNIQUE INDEX api_keys_username_name ON api_keys (username, name);
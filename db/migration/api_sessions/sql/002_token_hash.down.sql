@@ -0,0 +1,11 @@
+DROP TABLE api_sessions;
+CREATE TABLE api_sessions (
+    token TEXT PRIMARY KEY NOT NULL,
+    id TEXT NOT NULL,
+    username TEXT NOT NULL,
+    issued_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX api_sessions_expires_at ON api_sessions (expires_at);
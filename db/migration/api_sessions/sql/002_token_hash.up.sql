@@ -0,0 +1,12 @@
+-- sessions are recreated, because tokens can't be hashed in sqlite, users have to log in again
+DROP TABLE api_sessions;
+CREATE TABLE api_sessions (
+    token_hash TEXT PRIMARY KEY NOT NULL,
+    id TEXT NOT NULL,
+    username TEXT NOT NULL,
+    issued_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX api_sessions_expires_at ON api_sessions (expires_at);
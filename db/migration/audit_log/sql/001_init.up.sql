@@ -0,0 +1,11 @@
+CREATE TABLE audit_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    timestamp DATETIME NOT NULL,
+    username TEXT NOT NULL,
+    method TEXT NOT NULL,
+    route TEXT NOT NULL,
+    target_id TEXT NOT NULL DEFAULT '',
+    status INTEGER NOT NULL
+);
+CREATE INDEX audit_log_timestamp ON audit_log (timestamp);
+CREATE INDEX audit_log_username ON audit_log (username);
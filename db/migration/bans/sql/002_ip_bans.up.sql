@@ -0,0 +1,4 @@
+CREATE TABLE ip_bans (
+    visitor_key TEXT PRIMARY KEY NOT NULL,
+    expires_at DATETIME NOT NULL
+) WITHOUT ROWID;
@@ -0,0 +1 @@
+DROP TABLE registered_clients;
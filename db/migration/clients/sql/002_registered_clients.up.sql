@@ -0,0 +1,6 @@
+CREATE TABLE registered_clients (
+    id TEXT PRIMARY KEY NOT NULL,
+    registered_at DATETIME NOT NULL
+) WITHOUT ROWID;
+
+INSERT INTO registered_clients (id, registered_at) SELECT id, DATETIME('now') FROM clients;
@@ -0,0 +1,19 @@
+CREATE TABLE clients_tmp (
+    id TEXT PRIMARY KEY NOT NULL,
+	client_auth_id TEXT NOT NULL,
+    disconnected_at DATETIME,
+	details TEXT NOT NULL
+) WITHOUT ROWID;
+
+INSERT INTO clients_tmp (id, client_auth_id, disconnected_at, details)
+    SELECT id, client_auth_id, disconnected_at, details FROM clients;
+
+DROP TABLE clients;
+
+ALTER TABLE clients_tmp RENAME TO clients;
+
+CREATE INDEX idx_disconnected_client
+    ON clients (disconnected_at DESC, client_auth_id);
+
+CREATE INDEX idx_disconnected_time_client
+	ON clients (DATETIME(disconnected_at) DESC, client_auth_id);
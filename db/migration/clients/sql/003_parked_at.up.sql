@@ -0,0 +1 @@
+ALTER TABLE clients ADD COLUMN parked_at DATETIME;
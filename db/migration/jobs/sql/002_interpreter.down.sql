@@ -0,0 +1,46 @@
+DROP INDEX idx_jobs_interpreter;
+
+DROP INDEX idx_multi_jobs_interpreter;
+
+CREATE TABLE multi_jobs_old (
+    jid TEXT PRIMARY KEY NOT NULL,
+    started_at DATETIME NOT NULL,
+    created_by TEXT NOT NULL,
+    details TEXT NOT NULL
+) WITHOUT ROWID;
+
+INSERT INTO multi_jobs_old (jid, started_at, created_by, details)
+    SELECT jid, started_at, created_by, details FROM multi_jobs;
+
+CREATE TABLE jobs_old (
+    jid TEXT PRIMARY KEY NOT NULL,
+    status TEXT NOT NULL,
+    started_at DATETIME NOT NULL,
+    finished_at DATETIME,
+    created_by TEXT NOT NULL,
+    client_id TEXT NOT NULL,
+    multi_job_id TEXT,
+    details TEXT NOT NULL,
+    FOREIGN KEY (multi_job_id) REFERENCES multi_jobs(jid)
+) WITHOUT ROWID;
+
+INSERT INTO jobs_old (jid, status, started_at, finished_at, created_by, client_id, multi_job_id, details)
+    SELECT jid, status, started_at, finished_at, created_by, client_id, multi_job_id, details FROM jobs;
+
+DROP INDEX idx_jobs_client_id_time;
+
+DROP INDEX idx_jobs_multi_id;
+
+DROP TABLE jobs;
+
+DROP TABLE multi_jobs;
+
+ALTER TABLE multi_jobs_old RENAME TO multi_jobs;
+
+ALTER TABLE jobs_old RENAME TO jobs;
+
+CREATE INDEX idx_jobs_client_id_time
+    ON jobs (client_id, finished_at DESC);
+
+CREATE INDEX idx_jobs_multi_id
+    ON jobs (multi_job_id);
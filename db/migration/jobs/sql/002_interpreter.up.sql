@@ -0,0 +1,26 @@
+ALTER TABLE jobs ADD COLUMN interpreter TEXT;
+
+CREATE INDEX idx_jobs_interpreter
+    ON jobs (interpreter);
+
+ALTER TABLE multi_jobs ADD COLUMN interpreter TEXT;
+
+CREATE INDEX idx_multi_jobs_interpreter
+    ON multi_jobs (interpreter);
+
+-- fill the interpreter of existing jobs from their details, sqlite is built without the JSON1 extension
+UPDATE jobs SET interpreter = CASE
+    WHEN INSTR(details, '"interpreter":"') > 0 THEN SUBSTR(
+        SUBSTR(details, INSTR(details, '"interpreter":"') + 15), 1,
+        INSTR(SUBSTR(details, INSTR(details, '"interpreter":"') + 15), '"') - 1
+    )
+    ELSE ''
+END;
+
+UPDATE multi_jobs SET interpreter = CASE
+    WHEN INSTR(details, '"interpreter":"') > 0 THEN SUBSTR(
+        SUBSTR(details, INSTR(details, '"interpreter":"') + 15), 1,
+        INSTR(SUBSTR(details, INSTR(details, '"interpreter":"') + 15), '"') - 1
+    )
+    ELSE ''
+END;
@@ -0,0 +1,34 @@
+CREATE TABLE jobs_old (
+    jid TEXT PRIMARY KEY NOT NULL,
+    status TEXT NOT NULL,
+    started_at DATETIME NOT NULL,
+    finished_at DATETIME,
+    created_by TEXT NOT NULL,
+    client_id TEXT NOT NULL,
+    multi_job_id TEXT,
+    details TEXT NOT NULL,
+    interpreter TEXT,
+    FOREIGN KEY (multi_job_id) REFERENCES multi_jobs(jid)
+) WITHOUT ROWID;
+
+INSERT INTO jobs_old (jid, status, started_at, finished_at, created_by, client_id, multi_job_id, details, interpreter)
+    SELECT jid, status, started_at, finished_at, created_by, client_id, multi_job_id, details, interpreter FROM jobs;
+
+DROP INDEX idx_jobs_client_id_time;
+
+DROP INDEX idx_jobs_multi_id;
+
+DROP INDEX idx_jobs_interpreter;
+
+DROP TABLE jobs;
+
+ALTER TABLE jobs_old RENAME TO jobs;
+
+CREATE INDEX idx_jobs_client_id_time
+    ON jobs (client_id, finished_at DESC);
+
+CREATE INDEX idx_jobs_multi_id
+    ON jobs (multi_job_id);
+
+CREATE INDEX idx_jobs_interpreter
+    ON jobs (interpreter);
@@ -0,0 +1,13 @@
+DROP TABLE schedules;
+
+DROP INDEX idx_jobs_interpreter;
+
+DROP INDEX idx_jobs_multi_id;
+
+DROP INDEX idx_jobs_client_id_time;
+
+DROP TABLE jobs;
+
+DROP INDEX idx_multi_jobs_interpreter;
+
+DROP TABLE multi_jobs;
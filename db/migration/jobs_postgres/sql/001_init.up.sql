@@ -0,0 +1,38 @@
+CREATE TABLE IF NOT EXISTS multi_jobs (
+    jid TEXT PRIMARY KEY NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    created_by TEXT NOT NULL,
+    interpreter TEXT,
+    details TEXT NOT NULL
+);
+
+CREATE INDEX idx_multi_jobs_interpreter
+    ON multi_jobs (interpreter);
+
+CREATE TABLE jobs (
+    jid TEXT PRIMARY KEY NOT NULL,
+    status TEXT NOT NULL,
+    started_at TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ,
+    created_by TEXT NOT NULL,
+    client_id TEXT NOT NULL,
+    multi_job_id TEXT REFERENCES multi_jobs(jid),
+    interpreter TEXT,
+    details TEXT NOT NULL
+);
+
+CREATE INDEX idx_jobs_client_id_time
+    ON jobs (client_id, finished_at DESC);
+
+CREATE INDEX idx_jobs_multi_id
+    ON jobs (multi_job_id);
+
+CREATE INDEX idx_jobs_interpreter
+    ON jobs (interpreter);
+
+CREATE TABLE schedules (
+    id TEXT PRIMARY KEY NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL,
+    created_by TEXT NOT NULL,
+    details TEXT NOT NULL
+);
@@ -4,6 +4,8 @@
 // 001_init.up.sql
 // 002_commands.down.sql
 // 002_commands.up.sql
+// 003_command_templates.down.sql
+// 003_command_templates.up.sql
 package library
 
 import (
@@ -80,7 +82,7 @@ func (fi bindataFileInfo) Sys() interface{} {
 	return nil
 }
 
-var __001_initDownSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x72\x09\xf2\x0f\x50\x08\x71\x74\xf2\x71\x55\x28\x4e\x2e\xca\x2c\x28\x29\xb6\xe6\x02\x04\x00\x00\xff\xff\x24\x6d\x54\xc3\x14\x00\x00\x00")
+var __001_initDownSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x00\x14\x00\xeb\xff\x44\x52\x4f\x50\x20\x54\x41\x42\x4c\x45\x20\x73\x63\x72\x69\x70\x74\x73\x3b\x0a\x03\x00\x24\x6d\x54\xc3\x14\x00\x00\x00")
 
 func _001_initDownSqlBytes() ([]byte, error) {
 	return bindataRead(
@@ -95,12 +97,12 @@ func _001_initDownSql() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "001_init.down.sql", size: 20, mode: os.FileMode(436), modTime: time.Unix(1625562284, 0)}
+	info := bindataFileInfo{name: "001_init.down.sql", size: 20, mode: os.FileMode(436), modTime: time.Unix(1634219394, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
 
-var __001_initUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x90\xcb\x6a\xc3\x30\x10\x45\xf7\xfa\x8a\x4b\x56\x31\xd4\xd0\xae\xb3\x32\x89\x28\xa6\xa9\xd2\xba\x32\x24\x2b\x47\xb1\x26\x60\x70\xe5\x54\x1a\x51\xfa\xf7\x25\x96\x29\x69\xe9\x4b\x3b\xcd\x9d\x73\xa4\x99\x3c\x47\xfe\xcb\x11\x79\x0e\x6d\x0e\x3d\x21\xb0\x8f\x2d\x47\x4f\x38\x0e\x1e\xa1\xf5\xdd\x89\x83\xf8\x0b\x6f\x3d\x19\x26\x70\x52\x4c\xd0\x5c\x00\x40\x67\xa1\xe5\x56\xe3\xa1\x2a\xef\x8b\x6a\x87\x3b\xb9\x83\xda\x68\xa8\x7a\xbd\xbe\x1a\x3b\x9c\x79\xa6\xd4\xe3\x06\x86\x8b\x7d\x9f\xea\x49\x6a\x1b\xc3\x58\x15\x5a\xfe\x90\x1e\xde\xbe\x63\x3b\xc7\xe4\x4f\x9e\x98\xfc\x18\x4f\xd5\xd0\x84\x68\x07\x94\x4a\xcb\x5b\x59\xcd\x6f\x32\x58\x3a\x9a\xd8\x33\xae\xbf\xea\x5f\xed\x05\x98\x46\xfa\xfc\x90\xc8\x16\x42\x2c\x2b\x79\xfe\x5a\xa9\x56\x72\x8b\xd9\x79\x92\xd9\x08\x6c\x14\xf6\xd3\x1e\xf6\x48\x8b\x48\x29\x8a\xa7\xe5\x78\xbd\xa0\x6b\x55\x3e\xd6\x1f\x92\xe8\xba\x97\x48\xcd\x7f\x5d\xd9\x42\xbc\x07\x00\x00\xff\xff\xe9\x96\x0a\x2f\xdd\x01\x00\x00")
+var __001_initUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x90\x5f\x4b\xc3\x30\x14\xc5\xdf\xf3\x29\x0e\x7b\x5a\xc1\x82\x3e\xef\xa9\x6c\x41\x8a\x33\xd3\x9a\xc2\xf6\xd4\x65\xcd\x1d\x14\x6a\x3a\x93\x1b\xc4\x6f\x2f\x6b\x8a\x4c\xf1\x5f\xdf\x7a\xcf\xfd\xfd\x92\x9c\x3c\x47\xfe\xcb\x27\xf2\x1c\xda\x1c\x7a\x42\x60\x1f\x5b\x8e\x9e\x70\x1c\x3c\x42\xeb\xbb\x13\x07\xf1\x17\xde\x7a\x32\x4c\xe0\xa4\x98\xa0\xb9\x00\x80\xce\x42\xcb\xad\xc6\x43\x55\xde\x17\xd5\x0e\x77\x72\x07\xb5\xd1\x50\xf5\x7a\x7d\x35\x6e\x38\xf3\x4c\x69\xc7\x0d\x0c\x17\xfb\x3e\xcd\x93\xd4\x36\x86\xb1\x2a\xb4\xfc\x21\x3d\xbc\x7d\xc7\x76\x8e\xc9\x9f\x3c\x31\xf9\x31\x9e\xa6\xa1\x09\xd1\x0e\x28\x95\x96\xb7\xb2\x9a\xdf\x64\xb0\x74\x34\xb1\x67\x5c\x7f\xd5\xbf\xda\x0b\x30\xf5\xf0\xf9\x20\x91\x2d\x84\x58\x56\xf2\x7c\xb5\x52\xad\xe4\x16\xb3\xf3\x4b\x66\x23\xbe\x51\xd8\x4f\x3d\xec\x91\x8a\x48\x29\x8a\xa7\xe5\xf8\x7b\x41\xd7\xaa\x7c\xac\x3f\x24\xd1\x75\x2f\x91\x9a\xff\xba\xb2\x85\x78\x1f\x00\xe9\x96\x0a\x2f\xdd\x01\x00\x00")
 
 func _001_initUpSqlBytes() ([]byte, error) {
 	return bindataRead(
@@ -115,12 +117,12 @@ func _001_initUpSql() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "001_init.up.sql", size: 477, mode: os.FileMode(436), modTime: time.Unix(1625562284, 0)}
+	info := bindataFileInfo{name: "001_init.up.sql", size: 477, mode: os.FileMode(436), modTime: time.Unix(1634219394, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
 
-var __002_commandsDownSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x72\x09\xf2\x0f\x50\x08\x71\x74\xf2\x71\x55\x48\xce\xcf\xcd\x4d\xcc\x4b\x29\xb6\xe6\x02\x04\x00\x00\xff\xff\xb6\x29\x99\x09\x15\x00\x00\x00")
+var __002_commandsDownSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x00\x15\x00\xea\xff\x44\x52\x4f\x50\x20\x54\x41\x42\x4c\x45\x20\x63\x6f\x6d\x6d\x61\x6e\x64\x73\x3b\x0a\x03\x00\xb6\x29\x99\x09\x15\x00\x00\x00")
 
 func _002_commandsDownSqlBytes() ([]byte, error) {
 	return bindataRead(
@@ -135,12 +137,12 @@ func _002_commandsDownSql() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "002_commands.down.sql", size: 21, mode: os.FileMode(436), modTime: time.Unix(1632139533, 0)}
+	info := bindataFileInfo{name: "002_commands.down.sql", size: 21, mode: os.FileMode(436), modTime: time.Unix(1634219394, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
 
-var __002_commandsUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x8f\xc1\x4e\xc4\x20\x14\x45\xf7\x7c\xc5\x4d\x57\x4e\x22\x5f\x30\xab\x66\x86\x45\xe3\xc8\x68\xa5\xc9\xcc\xaa\x43\x01\x93\x26\x85\x2a\x85\x85\x7f\x6f\x0a\xa9\xd1\xa4\x56\xd9\x71\xef\x3b\x27\xef\x51\x0a\xba\xf1\x08\xa5\x10\xb2\x1b\x0c\xa6\xe0\xa3\x0a\xd1\x1b\xbc\x8e\x1e\x6a\xb4\x56\x3a\x3d\x91\xbf\x78\xe5\x8d\x0c\x06\x21\x39\xbe\xa8\x3b\x02\x00\xbd\x86\x60\x17\x81\xa7\xba\x7a\x2c\xeb\x2b\x1e\xd8\x15\xfc\x2c\xc0\x9b\xd3\xe9\x3e\x4d\x38\x69\x4d\x9e\x71\x63\x80\x8b\xc3\x90\xf3\x6c\xd5\xad\x0c\x38\x96\x82\xfd\xd2\x76\x1f\x6b\x6c\x7c\xd3\x1b\xec\xd2\xae\xb3\xca\xea\x9f\x31\xd9\xed\x09\x39\xd4\x6c\x16\x55\xfc\xc8\x2e\x28\x96\x23\xdb\x76\xde\xbe\x48\xdc\x99\xe3\xb6\xe4\x37\xe4\xeb\x8b\x54\xa3\x7c\x39\xa4\xef\x37\x51\xc3\xab\xe7\x66\xc5\x17\x5d\xff\x1e\xcd\xff\xb5\xbb\x3d\xf9\x0c\x00\x00\xff\xff\x78\x59\x4f\x68\xdf\x01\x00\x00")
+var __002_commandsUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x8c\x8f\xc1\x4e\xc4\x20\x14\x45\xf7\x7c\xc5\x4d\x57\x4e\x22\x5f\x30\xab\x66\x86\x45\xe3\xc8\x68\xa5\xc9\xcc\xaa\x43\x01\x93\x26\x85\x2a\x85\x85\x7f\x6f\x0a\xa9\xd1\xa4\x56\xd9\x71\xef\x3b\x27\xef\x51\x0a\xba\xf1\x08\xa5\x10\xb2\x1b\x0c\xa6\xe0\xa3\x0a\xd1\x1b\xbc\x8e\x1e\x6a\xb4\x56\x3a\x3d\x91\xbf\x78\xe5\x8d\x0c\x06\x21\x39\xbe\xa8\x3b\x02\x00\xbd\x86\x60\x17\x81\xa7\xba\x7a\x2c\xeb\x2b\x1e\xd8\x15\xfc\x2c\xc0\x9b\xd3\xe9\x3e\x4d\x38\x69\x4d\x9e\x71\x63\x80\x8b\xc3\x90\xf3\x6c\xd5\xad\x0c\x38\x96\x82\xfd\xd2\x76\x1f\x6b\x6c\x7c\xd3\x1b\xec\xd2\xae\xb3\xca\xea\x9f\x31\xd9\xed\x09\x39\xd4\x6c\x5e\xa2\xe2\x47\x76\x41\xb1\x1c\xd9\xb6\xf3\xf6\x45\xb2\x9e\x39\x6e\x4b\x7e\x43\xbe\xbe\x48\x35\xca\x97\x43\xfa\x7e\x13\x35\xbc\x7a\x6e\x56\x7c\xd1\xf5\xef\xd1\xfc\x5f\xbb\xdb\x93\xcf\x01\x00\x78\x59\x4f\x68\xdf\x01\x00\x00")
 
 func _002_commandsUpSqlBytes() ([]byte, error) {
 	return bindataRead(
@@ -155,7 +157,47 @@ func _002_commandsUpSql() (*asset, error) {
 		return nil, err
 	}
 
-	info := bindataFileInfo{name: "002_commands.up.sql", size: 479, mode: os.FileMode(436), modTime: time.Unix(1632141081, 0)}
+	info := bindataFileInfo{name: "002_commands.up.sql", size: 479, mode: os.FileMode(436), modTime: time.Unix(1634219394, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var __003_command_templatesDownSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\xa4\x52\xbb\x6e\x83\x40\x10\xec\xf7\x2b\x46\xae\x8c\xc4\x1f\x50\x5d\xcc\x46\x42\x81\xc3\x39\x0e\xc9\xae\x30\xe6\x28\x90\x78\xe4\x01\x85\xff\x3e\xe2\x88\x0d\x48\x24\x8a\x94\xee\x98\x99\x9d\x9d\x65\xf7\xa0\x58\x68\x86\x16\x4f\x21\xa3\xe8\x9a\x26\x6f\xcd\x67\xd6\xd5\x86\xf6\x04\x00\x95\x81\xe6\x93\xc6\x51\x05\x91\x50\x67\xbc\xf0\x19\x32\xd6\x90\x69\x18\xba\x56\xd1\xe6\x4d\x39\x69\xda\xae\x47\x3b\xd4\xf5\x84\x17\x1f\x65\xde\x97\x26\xcb\x7b\xf8\x63\x8b\x6d\xf6\x7a\xdb\xaa\x1d\xde\xcc\x2f\xb5\x77\x76\xbb\xb6\x68\xcc\x1a\x26\xc7\x23\x0a\x64\xc2\x4a\x23\x90\x3a\x5e\x8d\x89\x7d\x65\x5c\x3b\x83\xbb\x48\x3c\xbf\xaf\x37\x77\x91\x66\x7e\x8f\x78\xd1\x18\xc7\x06\x4a\x38\xe4\x83\xc6\xbf\x9c\xf0\xac\xe2\xe8\x11\xcd\x23\xf2\x55\x7c\x44\x20\x7d\x3e\xcd\x81\xb3\xd1\xfe\x27\x6e\x68\xab\xf7\xa1\x5c\x49\xd6\x6b\xf5\x88\x44\xa8\x59\x6d\x6c\x1b\x8a\xa5\x88\x18\x8b\xbf\xe3\x11\x7d\x1f\xc7\xd4\x68\xf7\xd0\xdb\x16\x3b\x3b\x79\x2c\x71\xb9\xe3\x17\x4c\x27\xb3\xb3\x34\x44\x72\xb0\x9f\xce\x6c\x94\xca\xe0\x35\xdd\xf0\x5b\x24\xff\x93\xad\xe3\xd1\xd7\x00\xe2\x4e\xbc\xbc\xb8\x02\x00\x00")
+
+func _003_command_templatesDownSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__003_command_templatesDownSql,
+		"003_command_templates.down.sql",
+	)
+}
+
+func _003_command_templatesDownSql() (*asset, error) {
+	bytes, err := _003_command_templatesDownSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "003_command_templates.down.sql", size: 696, mode: os.FileMode(420), modTime: time.Unix(1792293836, 0)}
+	a := &asset{bytes: bytes, info: info}
+	return a, nil
+}
+
+var __003_command_templatesUpSql = []byte("\x1f\x8b\x08\x00\x00\x00\x00\x00\x00\xff\x84\xce\xb1\x0a\xc2\x30\x10\x06\xe0\xdd\xa7\xf8\xb7\xae\xee\x4e\xd1\x9c\x22\x9c\x29\x94\x0b\xb8\x49\xa8\x37\x74\x48\x5b\x2e\xe7\xfb\xfb\x00\x82\x79\x81\x8f\x2f\xb0\xd0\x04\x09\x67\x26\xcc\x5b\xad\x65\x7d\x37\x84\x18\x71\x19\x39\x3f\x12\x96\xd5\xd5\x76\x53\x57\x83\xd0\x53\x90\x46\x41\xca\xcc\x88\x74\x0d\x99\x05\xc3\x70\x3a\xf4\x14\x5f\xaa\x6e\x1f\x7f\x35\x9d\x71\x4f\x42\x37\x9a\x7e\xa1\x63\xdf\xd9\x8b\x95\xda\xfe\x44\xbe\x03\x00\x0f\xaf\x7c\x6b\xcf\x00\x00\x00")
+
+func _003_command_templatesUpSqlBytes() ([]byte, error) {
+	return bindataRead(
+		__003_command_templatesUpSql,
+		"003_command_templates.up.sql",
+	)
+}
+
+func _003_command_templatesUpSql() (*asset, error) {
+	bytes, err := _003_command_templatesUpSqlBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	info := bindataFileInfo{name: "003_command_templates.up.sql", size: 207, mode: os.FileMode(420), modTime: time.Unix(1792293830, 0)}
 	a := &asset{bytes: bytes, info: info}
 	return a, nil
 }
@@ -212,10 +254,12 @@ func AssetNames() []string {
 
 // _bindata is a table, holding each asset generator, mapped to its name.
 var _bindata = map[string]func() (*asset, error){
-	"001_init.down.sql":     _001_initDownSql,
-	"001_init.up.sql":       _001_initUpSql,
-	"002_commands.down.sql": _002_commandsDownSql,
-	"002_commands.up.sql":   _002_commandsUpSql,
+	"001_init.down.sql":              _001_initDownSql,
+	"001_init.up.sql":                _001_initUpSql,
+	"002_commands.down.sql":          _002_commandsDownSql,
+	"002_commands.up.sql":            _002_commandsUpSql,
+	"003_command_templates.down.sql": _003_command_templatesDownSql,
+	"003_command_templates.up.sql":   _003_command_templatesUpSql,
 }
 
 // AssetDir returns the file names below a certain
@@ -259,10 +303,12 @@ type bintree struct {
 }
 
 var _bintree = &bintree{nil, map[string]*bintree{
-	"001_init.down.sql":     &bintree{_001_initDownSql, map[string]*bintree{}},
-	"001_init.up.sql":       &bintree{_001_initUpSql, map[string]*bintree{}},
-	"002_commands.down.sql": &bintree{_002_commandsDownSql, map[string]*bintree{}},
-	"002_commands.up.sql":   &bintree{_002_commandsUpSql, map[string]*bintree{}},
+	"001_init.down.sql":              &bintree{_001_initDownSql, map[string]*bintree{}},
+	"001_init.up.sql":                &bintree{_001_initUpSql, map[string]*bintree{}},
+	"002_commands.down.sql":          &bintree{_002_commandsDownSql, map[string]*bintree{}},
+	"002_commands.up.sql":            &bintree{_002_commandsUpSql, map[string]*bintree{}},
+	"003_command_templates.down.sql": &bintree{_003_command_templatesDownSql, map[string]*bintree{}},
+	"003_command_templates.up.sql":   &bintree{_003_command_templatesUpSql, map[string]*bintree{}},
 }}
 
 // RestoreAsset restores an asset under the given directory
@@ -0,0 +1,31 @@
+CREATE TABLE commands_old
+(
+    id TEXT PRIMARY KEY NOT NULL,
+    name TEXT not null,
+    created_at DATE not null,
+    created_by TEXT not null,
+    updated_at DATE not null,
+    updated_by TEXT not null,
+    cmd TEXT not null
+);
+
+INSERT INTO commands_old (id, name, created_at, created_by, updated_at, updated_by, cmd)
+    SELECT id, name, created_at, created_by, updated_at, updated_by, cmd FROM commands;
+
+DROP INDEX commands__name;
+
+DROP INDEX commands__unique_name;
+
+DROP TABLE commands;
+
+ALTER TABLE commands_old RENAME TO commands;
+
+CREATE INDEX "commands__name"
+    ON `commands` (
+    "name" ASC
+    );
+
+CREATE UNIQUE INDEX "commands__unique_name"
+    ON `commands` (
+    "name" ASC
+);
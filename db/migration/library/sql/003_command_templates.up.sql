@@ -0,0 +1,3 @@
+ALTER TABLE commands ADD COLUMN interpreter TEXT NOT NULL DEFAULT '';
+ALTER TABLE commands ADD COLUMN timeout_sec INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE commands ADD COLUMN params TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,48 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	bindata "github.com/golang-migrate/migrate/v4/source/go_bindata"
+	"github.com/jmoiron/sqlx"
+	// registers "postgres" driver
+	_ "github.com/lib/pq"
+)
+
+// New returns a new PostgreSQL DB instance with migrated DB scheme to the latest version.
+// assetNames and asset are used to migrate DB scheme.
+func New(dataSourceName string, assetNames []string, asset func(name string) ([]byte, error)) (*sqlx.DB, error) {
+	db, err := sqlx.Connect("postgres", dataSourceName)
+	if err != nil {
+		// errors of parsing the DSN contain it with the password
+		return nil, fmt.Errorf("failed to connect to DB: %s", strings.ReplaceAll(err.Error(), dataSourceName, "[redacted]"))
+	}
+
+	s := bindata.Resource(assetNames,
+		func(name string) ([]byte, error) {
+			return asset(name)
+		})
+	sourceDriver, err := bindata.WithInstance(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init DB source driver: %v", err)
+	}
+
+	dbDriver, err := postgres.WithInstance(db.DB, &postgres.Config{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to init DB migration driver: %v", err)
+	}
+
+	m, err := migrate.NewWithInstance("go-bindata", sourceDriver, "postgres", dbDriver)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init DB migration instance: %v", err)
+	}
+
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return nil, fmt.Errorf("failed to migrate DB to the latest version: %v", err)
+	}
+
+	return db, nil
+}
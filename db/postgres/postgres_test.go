@@ -0,0 +1,15 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRedactsDSNInErrors(t *testing.T) {
+	_, err := New("postgres://rport:secret pass@127.0.0.1:5432/rport", nil, nil)
+	require.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret")
+	assert.Contains(t, err.Error(), "[redacted]")
+}
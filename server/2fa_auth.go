@@ -2,14 +2,18 @@ package chserver
 
 import (
 	"context"
+	"crypto/sha256"
 	"crypto/subtle"
+	"encoding/hex"
 	"fmt"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	errors2 "github.com/cloudradar-monitoring/rport/server/api/errors"
 	"github.com/cloudradar-monitoring/rport/server/api/message"
+	"github.com/cloudradar-monitoring/rport/server/api/users"
 	"github.com/cloudradar-monitoring/rport/share/security"
 )
 
@@ -18,9 +22,15 @@ type TwoFAService struct {
 	MsgSrv      message.Service
 	UserSrv     UserService
 	SendTimeout time.Duration
+	// TOTPOn is true when users verify with a code of an enrolled authenticator app instead of a sent token.
+	TOTPOn bool
 
 	tokensByUser map[string]*expirableToken
-	mu           sync.RWMutex
+	// pendingTOTPLogins holds logins with a valid password that wait for a totp code by login tokens
+	pendingTOTPLogins map[string]*pendingTOTPLogin
+	// lastTOTPSteps holds the last period a totp code was accepted for by usernames, to reject reused codes
+	lastTOTPSteps map[string]int64
+	mu            sync.RWMutex
 }
 
 func NewTwoFAService(tokenTTLSeconds int, sendTimeout time.Duration, userSrv UserService, msgSrv message.Service) TwoFAService {
@@ -33,12 +43,53 @@ func NewTwoFAService(tokenTTLSeconds int, sendTimeout time.Duration, userSrv Use
 	}
 }
 
+// NewTOTPTwoFAService returns a 2fa service that validates codes of authenticator apps, no tokens are sent.
+// A login with a valid password waits for a code of an authenticator app for tokenTTLSeconds.
+func NewTOTPTwoFAService(tokenTTLSeconds int, userSrv UserService) TwoFAService {
+	return TwoFAService{
+		TokenTTL:          time.Duration(tokenTTLSeconds) * time.Second,
+		UserSrv:           userSrv,
+		TOTPOn:            true,
+		tokensByUser:      make(map[string]*expirableToken),
+		pendingTOTPLogins: make(map[string]*pendingTOTPLogin),
+		lastTOTPSteps:     make(map[string]int64),
+	}
+}
+
 type expirableToken struct {
 	token  string
 	expiry time.Time
 }
 
-const twoFATokenLength = 6
+type pendingTOTPLogin struct {
+	username       string
+	expiry         time.Time
+	failedAttempts int
+}
+
+const (
+	twoFATokenLength = 6
+
+	totpDeliveryMethod = "totp"
+	// totpSkewSteps is a number of TOTP periods before and after the current one a code is accepted for.
+	totpSkewSteps          = 1
+	totpRecoveryCodesCount = 10
+	totpRecoveryCodeLength = 10
+	totpLoginTokenLength   = 32
+	// totpMaxFailedAttempts is a number of invalid codes after which a pending login is discarded
+	totpMaxFailedAttempts = 5
+)
+
+// DeliveryMethod returns how 2fa tokens are delivered to users.
+func (srv *TwoFAService) DeliveryMethod() string {
+	if srv.TOTPOn {
+		return totpDeliveryMethod
+	}
+	if srv.MsgSrv == nil {
+		return ""
+	}
+	return srv.MsgSrv.DeliveryMethod()
+}
 
 // TODO: add tests
 func (srv *TwoFAService) SendToken(ctx context.Context, username string) (sendTo string, err error) {
@@ -63,6 +114,14 @@ func (srv *TwoFAService) SendToken(ctx context.Context, username string) (sendTo
 		}
 	}
 
+	// with totp the code is generated by the authenticator app of the user, nothing to send
+	if srv.TOTPOn {
+		return "", errors2.APIError{
+			Message:    "2fa tokens are not sent with totp",
+			HTTPStatus: http.StatusConflict,
+		}
+	}
+
 	if user.TwoFASendTo == "" {
 		return "", errors2.APIError{
 			Message:    "no two_fa_send_to set for this user",
@@ -99,8 +158,14 @@ func (srv *TwoFAService) SendToken(ctx context.Context, username string) (sendTo
 	return user.TwoFASendTo, nil
 }
 
+// ValidateToken checks a sent 2fa token of a given user. With totp, it checks a code of the authenticator app,
+// use ValidateTOTPLogin to finish a login.
 // TODO: add tests
 func (srv *TwoFAService) ValidateToken(username, token string) error {
+	if srv.TOTPOn {
+		return srv.validateTOTPCode(username, token)
+	}
+
 	srv.mu.RLock()
 	t := srv.tokensByUser[username]
 	defer srv.mu.RUnlock()
@@ -128,3 +193,206 @@ func (srv *TwoFAService) ValidateToken(username, token string) error {
 
 	return nil
 }
+
+// StartTOTPLogin registers a login of a given user with a valid password. The returned login token is required
+// to verify a totp code or to enroll an authenticator app if the user hasn't enrolled one yet.
+func (srv *TwoFAService) StartTOTPLogin(username string) (loginToken string, err error) {
+	loginToken, err = security.NewRandomToken(totpLoginTokenLength)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate totp login token: %v", err)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	now := time.Now()
+	for token, pending := range srv.pendingTOTPLogins {
+		if now.After(pending.expiry) {
+			delete(srv.pendingTOTPLogins, token)
+		}
+	}
+	srv.pendingTOTPLogins[loginToken] = &pendingTOTPLogin{
+		username: username,
+		expiry:   now.Add(srv.TokenTTL),
+	}
+	return loginToken, nil
+}
+
+// checkTOTPLogin returns an error if a given login token doesn't belong to a pending login of a given user.
+func (srv *TwoFAService) checkTOTPLogin(username, loginToken string) error {
+	srv.mu.RLock()
+	defer srv.mu.RUnlock()
+	pending := srv.pendingTOTPLogins[loginToken]
+	if pending == nil || pending.username != username || time.Now().After(pending.expiry) {
+		return errors2.APIError{
+			Message:    "login token is invalid or expired",
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+	return nil
+}
+
+// ValidateTOTPLogin checks a totp or recovery code of a pending login. The login is finished on success and discarded
+// after totpMaxFailedAttempts invalid codes.
+func (srv *TwoFAService) ValidateTOTPLogin(username, loginToken, code string) error {
+	if err := srv.checkTOTPLogin(username, loginToken); err != nil {
+		return err
+	}
+
+	err := srv.validateTOTPCode(username, code)
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	pending := srv.pendingTOTPLogins[loginToken]
+	if err == nil {
+		if pending == nil {
+			// finished or discarded by a concurrent request
+			return errors2.APIError{
+				Message:    "login token is invalid or expired",
+				HTTPStatus: http.StatusUnauthorized,
+			}
+		}
+		delete(srv.pendingTOTPLogins, loginToken)
+		return nil
+	}
+	if pending != nil {
+		pending.failedAttempts++
+		if pending.failedAttempts >= totpMaxFailedAttempts {
+			delete(srv.pendingTOTPLogins, loginToken)
+		}
+	}
+	return err
+}
+
+// EnrollTOTPLogin enrolls a new authenticator app for a user of a pending login who hasn't enrolled one yet.
+func (srv *TwoFAService) EnrollTOTPLogin(username, loginToken string) (secret string, recoveryCodes []string, err error) {
+	if err := srv.checkTOTPLogin(username, loginToken); err != nil {
+		return "", nil, err
+	}
+
+	user, err := srv.UserSrv.GetByUsername(username)
+	if err != nil {
+		return "", nil, err
+	}
+	if user == nil {
+		return "", nil, errors2.APIError{
+			Message:    "login token is invalid or expired",
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+	if IsTOTPEnrolled(user) {
+		return "", nil, errors2.APIError{
+			Message:    "totp is already enrolled, use the current code to change it after login",
+			HTTPStatus: http.StatusConflict,
+		}
+	}
+
+	return srv.EnrollTOTP(username)
+}
+
+// EnrollTOTP generates and stores a new TOTP secret and a new set of one-time recovery codes for a given user.
+// Previous secret and recovery codes become invalid.
+func (srv *TwoFAService) EnrollTOTP(username string) (secret string, recoveryCodes []string, err error) {
+	secret, err = security.NewTOTPSecret()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate totp secret: %v", err)
+	}
+
+	hashes := make([]string, 0, totpRecoveryCodesCount)
+	for i := 0; i < totpRecoveryCodesCount; i++ {
+		code, err := security.NewRandomToken(totpRecoveryCodeLength)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to generate totp recovery code: %v", err)
+		}
+		recoveryCodes = append(recoveryCodes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+
+	hashesStr := strings.Join(hashes, ",")
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	err = srv.UserSrv.Change(&users.User{
+		TOTPSecret:        &secret,
+		TOTPRecoveryCodes: &hashesStr,
+	}, username)
+	if err != nil {
+		return "", nil, err
+	}
+	delete(srv.lastTOTPSteps, username)
+
+	return secret, recoveryCodes, nil
+}
+
+// IsTOTPEnrolled returns true if a given user has an authenticator app enrolled.
+func IsTOTPEnrolled(user *users.User) bool {
+	return user.TOTPSecret != nil && *user.TOTPSecret != ""
+}
+
+// validateTOTPCode checks a code of the authenticator app or a recovery code of a given user. A code is accepted only
+// once, codes of the same or an earlier period as the last accepted code are rejected.
+func (srv *TwoFAService) validateTOTPCode(username, code string) error {
+	// hold the lock while the user is read and changed, so the same code can't be used by concurrent requests
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	user, err := srv.UserSrv.GetByUsername(username)
+	if err != nil {
+		return err
+	}
+	if user == nil || !IsTOTPEnrolled(user) {
+		return errors2.APIError{
+			Message:    "totp is not enrolled for provided username",
+			HTTPStatus: http.StatusUnauthorized,
+		}
+	}
+
+	step, ok, err := security.ValidateTOTPCode(*user.TOTPSecret, code, time.Now(), totpSkewSteps)
+	if err != nil {
+		return err
+	}
+	if ok {
+		if last, found := srv.lastTOTPSteps[username]; found && step <= last {
+			return errors2.APIError{
+				Message:    "token has already been used",
+				HTTPStatus: http.StatusUnauthorized,
+			}
+		}
+		srv.lastTOTPSteps[username] = step
+		return nil
+	}
+
+	return srv.useRecoveryCode(user, code)
+}
+
+// useRecoveryCode checks a given code against the recovery codes of a given user and invalidates a matching one.
+// It must be called with the lock held.
+func (srv *TwoFAService) useRecoveryCode(user *users.User, code string) error {
+	invalidCode := errors2.APIError{
+		Message:    "invalid token",
+		HTTPStatus: http.StatusUnauthorized,
+	}
+	if user.TOTPRecoveryCodes == nil || *user.TOTPRecoveryCodes == "" {
+		return invalidCode
+	}
+
+	hash := hashRecoveryCode(code)
+	hashes := strings.Split(*user.TOTPRecoveryCodes, ",")
+	for i := range hashes {
+		if subtle.ConstantTimeCompare([]byte(hashes[i]), []byte(hash)) != 1 {
+			continue
+		}
+
+		remaining := strings.Join(append(hashes[:i:i], hashes[i+1:]...), ",")
+		err := srv.UserSrv.Change(&users.User{TOTPRecoveryCodes: &remaining}, user.Username)
+		if err != nil {
+			return fmt.Errorf("failed to invalidate used recovery code: %v", err)
+		}
+		return nil
+	}
+
+	return invalidCode
+}
+
+func hashRecoveryCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,145 @@
+package chserver
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/rport/server/api/users"
+	"github.com/cloudradar-monitoring/rport/share/security"
+)
+
+func TestTOTPValidateToken(t *testing.T) {
+	secret, err := security.NewTOTPSecret()
+	require.NoError(t, err)
+	recoveryCodes := strings.Join([]string{hashRecoveryCode("recovery1"), hashRecoveryCode("recovery2")}, ",")
+	enrolledUser := &users.User{
+		Username:          "enrolled",
+		TOTPSecret:        &secret,
+		TOTPRecoveryCodes: &recoveryCodes,
+	}
+	notEnrolledUser := &users.User{
+		Username: "not-enrolled",
+	}
+
+	codeAt := func(t *testing.T, at time.Time) string {
+		code, err := security.TOTPCode(secret, at)
+		require.NoError(t, err)
+		return code
+	}
+
+	testCases := []struct {
+		Name                 string
+		Username             string
+		Token                string
+		ExpectedError        string
+		ExpectedChangedCodes *string
+	}{
+		{
+			Name:     "current code",
+			Username: enrolledUser.Username,
+			Token:    codeAt(t, time.Now()),
+		},
+		{
+			Name:     "previous code",
+			Username: enrolledUser.Username,
+			Token:    codeAt(t, time.Now().Add(-security.TOTPPeriod)),
+		},
+		{
+			Name:          "outdated code",
+			Username:      enrolledUser.Username,
+			Token:         codeAt(t, time.Now().Add(-3*security.TOTPPeriod)),
+			ExpectedError: "invalid token",
+		},
+		{
+			Name:                 "recovery code",
+			Username:             enrolledUser.Username,
+			Token:                "recovery2",
+			ExpectedChangedCodes: users.Token(hashRecoveryCode("recovery1")),
+		},
+		{
+			Name:          "invalid recovery code",
+			Username:      enrolledUser.Username,
+			Token:         "recovery3",
+			ExpectedError: "invalid token",
+		},
+		{
+			Name:          "user not enrolled",
+			Username:      notEnrolledUser.Username,
+			Token:         "123456",
+			ExpectedError: "totp is not enrolled for provided username",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			mockUsersService := &MockUsersService{
+				UserService: users.NewAPIService(users.NewStaticProvider([]*users.User{enrolledUser, notEnrolledUser}), false),
+			}
+			srv := NewTOTPTwoFAService(600, mockUsersService)
+
+			err := srv.ValidateToken(tc.Username, tc.Token)
+
+			if tc.ExpectedError != "" {
+				assert.EqualError(t, err, tc.ExpectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+			if tc.ExpectedChangedCodes != nil {
+				assert.Equal(t, tc.Username, mockUsersService.ChangeUsername)
+				assert.Equal(t, &users.User{TOTPRecoveryCodes: tc.ExpectedChangedCodes}, mockUsersService.ChangeUser)
+			} else {
+				assert.Nil(t, mockUsersService.ChangeUser)
+			}
+		})
+	}
+}
+
+func TestTOTPValidateTokenRejectsReusedCode(t *testing.T) {
+	secret, err := security.NewTOTPSecret()
+	require.NoError(t, err)
+	user := &users.User{
+		Username:   "enrolled",
+		TOTPSecret: &secret,
+	}
+	srv := NewTOTPTwoFAService(600, users.NewAPIService(users.NewStaticProvider([]*users.User{user}), false))
+
+	now := time.Now()
+	current, err := security.TOTPCode(secret, now)
+	require.NoError(t, err)
+	previous, err := security.TOTPCode(secret, now.Add(-security.TOTPPeriod))
+	require.NoError(t, err)
+
+	assert.NoError(t, srv.ValidateToken(user.Username, current))
+	assert.EqualError(t, srv.ValidateToken(user.Username, current), "token has already been used")
+	assert.EqualError(t, srv.ValidateToken(user.Username, previous), "token has already been used", "codes of earlier periods are rejected")
+}
+
+func TestTOTPLoginExpires(t *testing.T) {
+	user := &users.User{
+		Username: "test-user",
+	}
+	srv := NewTOTPTwoFAService(0, users.NewAPIService(users.NewStaticProvider([]*users.User{user}), false))
+
+	loginToken, err := srv.StartTOTPLogin(user.Username)
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond)
+
+	assert.EqualError(t, srv.ValidateTOTPLogin(user.Username, loginToken, "123456"), "login token is invalid or expired")
+}
+
+func TestTOTPSendToken(t *testing.T) {
+	user := &users.User{
+		Username: "test-user",
+	}
+	srv := NewTOTPTwoFAService(600, users.NewAPIService(users.NewStaticProvider([]*users.User{user}), false))
+
+	_, err := srv.SendToken(context.Background(), user.Username)
+
+	assert.EqualError(t, err, "2fa tokens are not sent with totp")
+	assert.Equal(t, "totp", srv.DeliveryMethod())
+}
@@ -7,11 +7,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net"
 	"net/http"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/handlers"
@@ -19,6 +23,7 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/jpillora/requestlog"
 	"github.com/tomasen/realip"
+	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/crypto/ssh"
 
 	"github.com/cloudradar-monitoring/rport/server/api"
@@ -45,7 +50,10 @@ import (
 )
 
 const (
-	queryParamSort = "sort"
+	queryParamSort                   = "sort"
+	queryParamGroup                  = "group"
+	queryParamUpdatesStatusOlderThan = "updates_status_older_than"
+	queryParamState                  = "state"
 
 	routeParamClientID       = "client_id"
 	routeParamUserID         = "user_id"
@@ -55,6 +63,19 @@ const (
 	routeParamScriptValueID  = "script_value_id"
 	routeParamCommandValueID = "command_value_id"
 
+	// routeNameCommandResult is a name of a route that compresses its response on its own, stored gzip compressed
+	// results are passed through as is
+	routeNameCommandResult = "command-result"
+	// names of long-lived routes that are not limited by the API request timeout
+	routeNameDiagnostics    = "diagnostics"
+	routeNameCommandsWS     = "commands-ws"
+	routeNameScriptsWS      = "scripts-ws"
+	routeNameTestCommandUI  = "test-commands-ui"
+	routeNameTestScriptsUI  = "test-scripts-ui"
+	routeNameClientsExport  = "clients-export"
+	routeNameCommandsExport = "commands-export"
+	routeNameCommandOutput  = "command-output-ws"
+
 	ErrCodeMissingRouteVar = "ERR_CODE_MISSING_ROUTE_VAR"
 	ErrCodeInvalidRequest  = "ERR_CODE_INVALID_REQUEST"
 	ErrCodeAlreadyExist    = "ERR_CODE_ALREADY_EXIST"
@@ -72,15 +93,23 @@ var apiUpgrader = websocket.Upgrader{
 
 type JobProvider interface {
 	GetByJID(clientID, jid string) (*models.Job, error)
-	GetSummariesByClientID(clientID string) ([]*models.JobSummary, error)
+	GetSummariesByClientID(clientID string, opts jobs.SummariesOptions) ([]*models.JobSummary, error)
 	GetByMultiJobID(jid string) ([]*models.Job, error)
+	GetRawResult(clientID, jid string) (*jobs.RawResult, error)
+	GetLastFinishedByCommand(clientID, command string, startedBefore time.Time) (*models.Job, error)
 	// SaveJob creates or updates a job
 	SaveJob(job *models.Job) error
 	// CreateJob creates a new job. If already exist with a given JID - do nothing and return nil
 	CreateJob(job *models.Job) error
 	GetMultiJob(jid string) (*models.MultiJob, error)
-	GetAllMultiJobSummaries() ([]*models.MultiJobSummary, error)
+	GetAllMultiJobSummaries(opts jobs.MultiJobSummariesOptions) ([]*models.MultiJobSummary, error)
+	ListMultiJobStatusSummaries(opts jobs.MultiJobSummariesOptions, pagination *query.Pagination) ([]*models.MultiJobStatusSummary, int, error)
+	SearchByCommand(opts jobs.SearchOptions) ([]*models.ClientJobSummary, int, error)
+	ForEachClientJob(opts jobs.SearchOptions, fn func(*models.ClientJobSummary) error) error
 	SaveMultiJob(multiJob *models.MultiJob) error
+	CountByStatus() (map[string]int, error)
+	// FailRunning marks all running jobs as failed with a given error
+	FailRunning(errMsg string, finishedAt time.Time) (int, error)
 	Close() error
 }
 
@@ -92,6 +121,10 @@ func (al *APIListener) wrapWithAuthMiddleware(f http.Handler) http.HandlerFunc {
 				al.jsonErrorResponse(w, http.StatusTooManyRequests, err)
 				return
 			}
+			if errors.Is(err, errInsufficientScope) {
+				al.jsonErrorResponse(w, http.StatusForbidden, err)
+				return
+			}
 			al.jsonErrorResponse(w, http.StatusInternalServerError, err)
 			return
 		}
@@ -168,19 +201,40 @@ func (al *APIListener) initRouter() {
 	api.HandleFunc("/me/ip", al.handleGetIP).Methods(http.MethodGet)
 	api.HandleFunc("/me/token", al.handlePostToken).Methods(http.MethodPost)
 	api.HandleFunc("/me/token", al.handleDeleteToken).Methods(http.MethodDelete)
+	api.HandleFunc("/me/totp", al.handlePostTOTP).Methods(http.MethodPost)
+	api.HandleFunc("/me/apikeys", al.handleGetAPIKeys).Methods(http.MethodGet)
+	api.HandleFunc("/me/apikeys", al.handlePostAPIKey).Methods(http.MethodPost)
+	api.HandleFunc("/me/apikeys/{"+routeParamAPIKeyID+"}", al.handleDeleteAPIKey).Methods(http.MethodDelete)
+	api.HandleFunc("/me/sessions", al.handleGetSessions).Methods(http.MethodGet)
+	api.HandleFunc("/me/sessions/{"+routeParamSessionID+"}", al.handleDeleteSession).Methods(http.MethodDelete)
 	api.HandleFunc("/clients", al.handleGetClients).Methods(http.MethodGet)
+	api.HandleFunc("/clients/tags", al.wrapAdminAccessMiddleware(al.handlePostClientsTags)).Methods(http.MethodPost)
+	api.HandleFunc("/clients/export", al.handleExportClients).Methods(http.MethodGet).Name(routeNameClientsExport)
 	api.HandleFunc("/clients/{client_id}", al.wrapClientAccessMiddleware(al.handleGetClient)).Methods(http.MethodGet)
 	api.HandleFunc("/clients/{client_id}", al.wrapClientAccessMiddleware(al.handleDeleteClient)).Methods(http.MethodDelete)
+	api.HandleFunc("/clients/{client_id}/config", al.wrapClientAccessMiddleware(al.handleGetClientConfig)).Methods(http.MethodGet)
 	api.HandleFunc("/clients/{client_id}/acl", al.wrapAdminAccessMiddleware(al.handlePostClientACL)).Methods(http.MethodPost)
+	api.HandleFunc("/clients/{client_id}/reconnect", al.wrapAdminAccessMiddleware(al.handlePostClientReconnect)).Methods(http.MethodPost)
+	api.HandleFunc("/clients/{client_id}/unpark", al.wrapAdminAccessMiddleware(al.handlePostClientUnpark)).Methods(http.MethodPost)
 	api.HandleFunc("/clients/{client_id}/tunnels", al.wrapClientAccessMiddleware(al.handlePutClientTunnel)).Methods(http.MethodPut)
 	api.HandleFunc("/clients/{client_id}/tunnels/{tunnel_id}", al.wrapClientAccessMiddleware(al.handleDeleteClientTunnel)).Methods(http.MethodDelete)
 	api.HandleFunc("/clients/{client_id}/commands", al.wrapClientAccessMiddleware(al.handlePostCommand)).Methods(http.MethodPost)
+	api.HandleFunc("/clients/{client_id}/commands/validate", al.wrapClientAccessMiddleware(al.handleValidateCommand)).Methods(http.MethodPost)
+	api.HandleFunc("/clients/{client_id}/commands/library/{"+routeParamCommandValueID+"}", al.wrapClientAccessMiddleware(al.handlePostLibraryCommand)).Methods(http.MethodPost)
 	api.HandleFunc("/clients/{client_id}/commands", al.wrapClientAccessMiddleware(al.handleGetCommands)).Methods(http.MethodGet)
 	api.HandleFunc("/clients/{client_id}/commands/{job_id}", al.wrapClientAccessMiddleware(al.handleGetCommand)).Methods(http.MethodGet)
+	api.HandleFunc("/clients/{client_id}/commands/{job_id}", al.wrapClientAccessMiddleware(al.handleCancelCommand)).Methods(http.MethodDelete)
+	api.HandleFunc("/clients/{client_id}/commands/{job_id}/result", al.wrapClientAccessMiddleware(al.handleGetCommandResult)).Methods(http.MethodGet).Name(routeNameCommandResult)
+	api.HandleFunc("/clients/{client_id}/commands/{job_id}/diff", al.wrapClientAccessMiddleware(al.handleGetCommandDiff)).Methods(http.MethodGet)
 	api.HandleFunc("/clients/{client_id}/scripts", al.wrapClientAccessMiddleware(al.handleExecuteScript)).Methods(http.MethodPost)
 	api.HandleFunc("/clients/{client_id}/updates-status", al.wrapClientAccessMiddleware(al.handleRefreshUpdatesStatus)).Methods(http.MethodPost)
+	api.HandleFunc("/clients/{client_id}/updates", al.wrapAdminAccessMiddleware(al.handlePostUpdates)).Methods(http.MethodPost)
+	api.HandleFunc("/tunnels/conflicts", al.wrapAdminAccessMiddleware(al.handleGetTunnelConflicts)).Methods(http.MethodGet)
+	api.HandleFunc("/admin/diagnostics", al.wrapAdminAccessMiddleware(al.handleGetDiagnostics)).Methods(http.MethodGet).Name(routeNameDiagnostics)
 	api.HandleFunc("/client-groups", al.handleGetClientGroups).Methods(http.MethodGet)
 	api.HandleFunc("/client-groups", al.wrapAdminAccessMiddleware(al.handlePostClientGroups)).Methods(http.MethodPost)
+	api.HandleFunc("/client-groups/export", al.wrapAdminAccessMiddleware(al.handleExportClientGroups)).Methods(http.MethodGet)
+	api.HandleFunc("/client-groups/import", al.wrapAdminAccessMiddleware(al.handleImportClientGroups)).Methods(http.MethodPost)
 	api.HandleFunc("/client-groups/{group_id}", al.wrapAdminAccessMiddleware(al.handlePutClientGroup)).Methods(http.MethodPut)
 	api.HandleFunc("/client-groups/{group_id}", al.handleGetClientGroup).Methods(http.MethodGet)
 	api.HandleFunc("/client-groups/{group_id}", al.wrapAdminAccessMiddleware(al.handleDeleteClientGroup)).Methods(http.MethodDelete)
@@ -189,11 +243,14 @@ func (al *APIListener) initRouter() {
 	api.HandleFunc("/users/{user_id}", al.wrapStaticPassModeMiddleware(al.wrapAdminAccessMiddleware(al.handleChangeUser))).Methods(http.MethodPut)
 	api.HandleFunc("/users/{user_id}", al.wrapStaticPassModeMiddleware(al.wrapAdminAccessMiddleware(al.handleDeleteUser))).Methods(http.MethodDelete)
 	api.HandleFunc("/commands", al.handlePostMultiClientCommand).Methods(http.MethodPost)
+	api.HandleFunc("/commands", al.handleExportCommands).Methods(http.MethodGet).MatcherFunc(isCommandsExportRequest).Name(routeNameCommandsExport)
 	api.HandleFunc("/commands", al.handleGetMultiClientCommands).Methods(http.MethodGet)
+	api.HandleFunc("/commands/multi", al.handleListMultiClientCommands).Methods(http.MethodGet)
 	api.HandleFunc("/commands/{job_id}", al.handleGetMultiClientCommand).Methods(http.MethodGet)
 	api.HandleFunc("/clients-auth", al.wrapAdminAccessMiddleware(al.handleGetClientsAuth)).Methods(http.MethodGet)
 	api.HandleFunc("/clients-auth", al.wrapAdminAccessMiddleware(al.handlePostClientsAuth)).Methods(http.MethodPost)
 	api.HandleFunc("/clients-auth/{client_auth_id}", al.wrapAdminAccessMiddleware(al.handleDeleteClientAuth)).Methods(http.MethodDelete)
+	api.HandleFunc("/clients-auth/purge", al.wrapAdminAccessMiddleware(al.handlePurgeClientsAuth)).Methods(http.MethodPost)
 	api.HandleFunc("/vault-admin", al.handleGetVaultStatus).Methods(http.MethodGet)
 	api.HandleFunc("/vault-admin/sesame", al.wrapAdminAccessMiddleware(al.handleVaultUnlock)).Methods(http.MethodPost)
 	api.HandleFunc("/vault-admin/init", al.wrapAdminAccessMiddleware(al.handleVaultInit)).Methods(http.MethodPost)
@@ -214,6 +271,19 @@ func (al *APIListener) initRouter() {
 	api.HandleFunc("/library/commands/{"+routeParamCommandValueID+"}", al.handleReadCommand).Methods(http.MethodGet)
 	api.HandleFunc("/library/commands/{"+routeParamCommandValueID+"}", al.handleDeleteCommand).Methods(http.MethodDelete)
 	api.HandleFunc("/scripts", al.handlePostMultiClientScript).Methods(http.MethodPost)
+	api.HandleFunc("/schedules", al.handleListSchedules).Methods(http.MethodGet)
+	api.HandleFunc("/schedules", al.handlePostSchedule).Methods(http.MethodPost)
+	api.HandleFunc("/schedules/{"+routeParamScheduleID+"}", al.handleGetSchedule).Methods(http.MethodGet)
+	api.HandleFunc("/schedules/{"+routeParamScheduleID+"}", al.handleDeleteSchedule).Methods(http.MethodDelete)
+	api.HandleFunc("/audit", al.wrapAdminAccessMiddleware(al.handleGetAuditLog)).Methods(http.MethodGet)
+
+	if al.auditLogProvider != nil {
+		// add audit log middleware, it's wrapped by the authorization middleware to know the user
+		_ = api.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+			route.HandlerFunc(al.wrapWithAuditLog(route.GetHandler()))
+			return nil
+		})
+	}
 
 	// add authorization middleware
 	if !al.insecureForTests {
@@ -228,15 +298,24 @@ func (al *APIListener) initRouter() {
 	api.HandleFunc("/login", al.handlePostLogin).Methods(http.MethodPost)
 	api.HandleFunc("/logout", al.handleDeleteLogout).Methods(http.MethodDelete)
 	api.HandleFunc("/verify-2fa", al.handlePostVerify2FAToken).Methods(http.MethodPost)
+	api.HandleFunc("/login/totp", al.handlePostLoginTOTP).Methods(http.MethodPost)
+	// is used by orchestrators that can't provide credentials
+	api.HandleFunc("/health", al.handleGetHealth).Methods(http.MethodGet)
 
 	// web sockets
 	// common auth middleware is not used due to JS issue https://stackoverflow.com/questions/22383089/is-it-possible-to-use-bearer-authentication-for-websocket-upgrade-requests
-	api.HandleFunc("/ws/commands", al.wsAuth(http.HandlerFunc(al.handleCommandsWS))).Methods(http.MethodGet)
-	api.HandleFunc("/ws/scripts", al.wsAuth(http.HandlerFunc(al.handleScriptsWS))).Methods(http.MethodGet)
+	// websockets that execute commands and scripts are recorded to the audit log when they are started
+	commandsWS, scriptsWS := http.Handler(http.HandlerFunc(al.handleCommandsWS)), http.Handler(http.HandlerFunc(al.handleScriptsWS))
+	if al.auditLogProvider != nil {
+		commandsWS, scriptsWS = al.wrapWithAuditLog(commandsWS), al.wrapWithAuditLog(scriptsWS)
+	}
+	api.HandleFunc("/ws/commands", al.wsAuth(commandsWS)).Methods(http.MethodGet).Name(routeNameCommandsWS)
+	api.HandleFunc("/ws/scripts", al.wsAuth(scriptsWS)).Methods(http.MethodGet).Name(routeNameScriptsWS)
+	api.HandleFunc("/clients/{client_id}/commands/{job_id}/ws", al.wsAuth(al.wrapClientAccessMiddleware(al.handleCommandOutputWS))).Methods(http.MethodGet).Name(routeNameCommandOutput)
 
 	if al.config.Server.EnableWsTestEndpoints {
-		api.HandleFunc("/test/commands/ui", al.wsCommands)
-		api.HandleFunc("/test/scripts/ui", al.wsScripts)
+		api.HandleFunc("/test/commands/ui", al.wsCommands).Name(routeNameTestCommandUI)
+		api.HandleFunc("/test/scripts/ui", al.wsScripts).Name(routeNameTestScriptsUI)
 	}
 
 	if al.bannedIPs != nil {
@@ -253,6 +332,15 @@ func (al *APIListener) initRouter() {
 		return nil
 	})
 
+	if al.metrics != nil {
+		al.metrics.instrumentRoutes(api)
+		metricsHandler := al.metrics.handler()
+		if !al.insecureForTests {
+			metricsHandler = al.wrapWithAuthMiddleware(metricsHandler)
+		}
+		r.Handle("/metrics", metricsHandler).Methods(http.MethodGet)
+	}
+
 	docRoot := al.config.API.DocRoot
 	if docRoot != "" {
 		r.PathPrefix("/").Handler(middleware.Rewrite404(http.FileServer(http.Dir(docRoot)), "/"))
@@ -265,11 +353,22 @@ func (al *APIListener) initRouter() {
 		r.Use(func(next http.Handler) http.Handler { return handlers.CombinedLoggingHandler(al.accessLogFile, next) })
 	}
 
-	r.Use(handlers.CompressHandler)
+	r.Use(middleware.CompressExcept(routeNameCommandResult))
 	r.Use(handlers.RecoveryHandler(
 		handlers.PrintRecoveryStack(true),
 		handlers.RecoveryLogger(middleware.NewRecoveryLogger(al.Logger)),
 	))
+	r.Use(middleware.TimeoutExcept(
+		al.config.API.RequestTimeout,
+		routeNameDiagnostics,
+		routeNameCommandsWS,
+		routeNameScriptsWS,
+		routeNameClientsExport,
+		routeNameCommandsExport,
+		routeNameCommandOutput,
+		routeNameTestCommandUI,
+		routeNameTestScriptsUI,
+	))
 
 	al.router = r
 }
@@ -334,6 +433,10 @@ func (al *APIListener) jsonErrorResponseWithError(w http.ResponseWriter, statusC
 type twoFAResponse struct {
 	SendTo         string `json:"send_to"`
 	DeliveryMethod string `json:"delivery_method"`
+	// LoginToken is set only with totp, it's required to verify the code of the authenticator app
+	LoginToken string `json:"login_token,omitempty"`
+	// TOTPEnrollmentRequired is true if the user has to enroll an authenticator app before verifying a code
+	TOTPEnrollmentRequired bool `json:"totp_enrollment_required,omitempty"`
 }
 
 type loginResponse struct {
@@ -383,6 +486,11 @@ func (al *APIListener) handleLogin(username, pwd string, w http.ResponseWriter,
 		return
 	}
 
+	if al.config.API.IsTOTPOn() {
+		al.startTOTPLogin(username, w)
+		return
+	}
+
 	if al.config.API.IsTwoFAOn() {
 		sendTo, err := al.twoFASrv.SendToken(req.Context(), username)
 		if err != nil {
@@ -393,7 +501,7 @@ func (al *APIListener) handleLogin(username, pwd string, w http.ResponseWriter,
 		al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(loginResponse{
 			TwoFA: &twoFAResponse{
 				SendTo:         sendTo,
-				DeliveryMethod: al.twoFASrv.MsgSrv.DeliveryMethod(),
+				DeliveryMethod: al.twoFASrv.DeliveryMethod(),
 			},
 		}))
 		return
@@ -409,7 +517,7 @@ func (al *APIListener) sendJWTToken(username string, w http.ResponseWriter, req
 		return
 	}
 
-	tokenStr, err := al.createAuthToken(lifetime, username)
+	tokenStr, err := al.createAuthToken(req, lifetime, username)
 	if err != nil {
 		al.jsonErrorResponse(w, http.StatusInternalServerError, err)
 		return
@@ -528,6 +636,10 @@ func (al *APIListener) handlePostVerify2FAToken(w http.ResponseWriter, req *http
 		if !al.handleBannedIPs(w, req, false) {
 			return
 		}
+		var apiErr errors2.APIError
+		if username != "" && errors.As(err, &apiErr) && apiErr.HTTPStatus == http.StatusUnauthorized {
+			al.bannedUsers.Add(username)
+		}
 		al.jsonError(w, err)
 		return
 	}
@@ -544,8 +656,9 @@ func (al *APIListener) parseAndValidate2FATokenRequest(req *http.Request) (usern
 	}
 
 	var reqBody struct {
-		Username string `json:"username"`
-		Token    string `json:"token"`
+		Username   string `json:"username"`
+		Token      string `json:"token"`
+		LoginToken string `json:"login_token"`
 	}
 	err = parseRequestBody(req.Body, &reqBody)
 	if err != nil {
@@ -573,6 +686,10 @@ func (al *APIListener) parseAndValidate2FATokenRequest(req *http.Request) (usern
 		}
 	}
 
+	if al.config.API.IsTOTPOn() {
+		return reqBody.Username, al.twoFASrv.ValidateTOTPLogin(reqBody.Username, reqBody.LoginToken, reqBody.Token)
+	}
+
 	return reqBody.Username, al.twoFASrv.ValidateToken(reqBody.Username, reqBody.Token)
 }
 
@@ -589,11 +706,6 @@ func (al *APIListener) handleGetStatus(w http.ResponseWriter, req *http.Request)
 		return
 	}
 
-	var twoFADelivery string
-	if al.twoFASrv.MsgSrv != nil {
-		twoFADelivery = al.twoFASrv.MsgSrv.DeliveryMethod()
-	}
-
 	response := api.NewSuccessPayload(map[string]interface{}{
 		"version":                chshare.BuildVersion,
 		"clients_connected":      countActive,
@@ -604,43 +716,123 @@ func (al *APIListener) handleGetStatus(w http.ResponseWriter, req *http.Request)
 		"clients_auth_mode":      al.getClientsAuthMode(),
 		"users_auth_source":      al.userService.GetProviderType(),
 		"two_fa_enabled":         al.config.API.IsTwoFAOn(),
-		"two_fa_delivery_method": twoFADelivery,
+		"two_fa_delivery_method": al.twoFASrv.DeliveryMethod(),
 	})
 
 	al.writeJSONResponse(w, http.StatusOK, response)
 }
 
+type clientsListMeta struct {
+	Count int `json:"count"`
+}
+
 func (al *APIListener) handleGetClients(w http.ResponseWriter, req *http.Request) {
+	maxLimit := al.config.API.MaxClientsPageLimit
+	if maxLimit == 0 {
+		maxLimit = math.MaxInt32
+	}
+	// no limit by default to return all clients when no page params are given
+	pagination, err := query.ExtractPagination(req, 0, maxLimit)
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	cls, ok := al.getFilteredUserClients(w, req)
+	if !ok {
+		return
+	}
+
+	start, end := pagination.Bounds(len(cls))
+	clientsPayload := convertToClientsPayload(cls[start:end])
+	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayloadWithMeta(clientsPayload, clientsListMeta{Count: len(cls)}))
+}
+
+// getFilteredUserClients returns sorted clients the current user has access to filtered by request params.
+// It writes an error response and returns false on failure.
+func (al *APIListener) getFilteredUserClients(w http.ResponseWriter, req *http.Request) ([]*clients.Client, bool) {
 	var err error
 	sortFunc, desc, err := getCorrespondingSortFunc(req.URL.Query().Get(queryParamSort))
 	if err != nil {
 		al.jsonErrorResponse(w, http.StatusBadRequest, err)
-		return
+		return nil, false
 	}
 
 	filterOptions := query.ExtractFilterOptions(req)
-	filterErr := query.ValidateFilterOptions(filterOptions, clientsSupportedFields)
+	filterErr := validateClientsFilterOptions(filterOptions)
 	if filterErr != nil {
 		al.jsonError(w, filterErr)
-		return
+		return nil, false
 	}
 
 	curUser, err := al.getUserModelForAuth(req.Context())
 	if err != nil {
 		al.jsonError(w, err)
-		return
+		return nil, false
 	}
 
-	cls, err := al.clientService.GetUserClients(curUser, filterOptions)
+	var cls []*clients.Client
+	switch state := req.URL.Query().Get(queryParamState); state {
+	case "":
+		cls, err = al.clientService.GetUserClients(curUser, filterOptions)
+	case string(clients.Parked):
+		cls, err = al.clientService.GetUserParkedClients(curUser, filterOptions)
+	default:
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, fmt.Sprintf("Invalid %s value %q, expected %q.", queryParamState, state, clients.Parked))
+		return nil, false
+	}
 	if err != nil {
 		al.jsonError(w, err)
-		return
+		return nil, false
+	}
+
+	if groupID := req.URL.Query().Get(queryParamGroup); groupID != "" {
+		group, err := al.clientGroupProvider.Get(req.Context(), groupID)
+		if err != nil {
+			al.jsonErrorResponseWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to find client group[id=%q].", groupID), err)
+			return nil, false
+		}
+		if group == nil {
+			al.jsonErrorResponseWithTitle(w, http.StatusNotFound, fmt.Sprintf("Client Group[id=%q] not found.", groupID))
+			return nil, false
+		}
+		cls = filterClientsByGroup(cls, group)
+	}
+
+	if olderThan := req.URL.Query().Get(queryParamUpdatesStatusOlderThan); olderThan != "" {
+		d, err := time.ParseDuration(olderThan)
+		if err != nil || d < 0 {
+			al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, fmt.Sprintf("Invalid %s value %q, expected a duration like 24h.", queryParamUpdatesStatusOlderThan, olderThan))
+			return nil, false
+		}
+		cls = filterClientsByStaleUpdatesStatus(cls, time.Now().Add(-d))
 	}
 
 	sortFunc(cls, desc)
 
-	clientsPayload := convertToClientsPayload(cls)
-	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(clientsPayload))
+	return cls, true
+}
+
+// filterClientsByGroup returns clients that belong to a given group.
+func filterClientsByGroup(cls []*clients.Client, group *cgroups.ClientGroup) []*clients.Client {
+	res := make([]*clients.Client, 0, len(cls))
+	for _, cur := range cls {
+		if cur.BelongsTo(group) {
+			res = append(res, cur)
+		}
+	}
+	return res
+}
+
+// filterClientsByStaleUpdatesStatus returns clients which updates status was refreshed before a given time or never.
+func filterClientsByStaleUpdatesStatus(cls []*clients.Client, refreshedBefore time.Time) []*clients.Client {
+	res := make([]*clients.Client, 0, len(cls))
+	for _, cur := range cls {
+		if cur.UpdatesStatus == nil || cur.UpdatesStatus.Refreshed.Before(refreshedBefore) {
+			res = append(res, cur)
+		}
+	}
+	return res
 }
 
 func (al *APIListener) handleGetClient(w http.ResponseWriter, req *http.Request) {
@@ -661,6 +853,69 @@ func (al *APIListener) handleGetClient(w http.ResponseWriter, req *http.Request)
 	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(clientPayload))
 }
 
+// ClientConfigPayload is a client configuration as seen by the server.
+type ClientConfigPayload struct {
+	// Client holds the persisted details, both reported by the client and set on the server.
+	Client ClientPayload `json:"client"`
+	// Groups are IDs of client groups the client belongs to.
+	Groups []string `json:"groups"`
+	// KeepDisconnectedSec is how long the client is kept after a disconnect, nil if it's kept forever.
+	KeepDisconnectedSec *int64 `json:"keep_disconnected_sec"`
+	// ObsoleteAt is a time when the disconnected client is removed, nil if it's connected or kept forever.
+	ObsoleteAt      *time.Time        `json:"obsolete_at"`
+	TunnelConflicts []*TunnelConflict `json:"tunnel_conflicts"`
+}
+
+func (al *APIListener) handleGetClientConfig(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	clientID := vars[routeParamClientID]
+
+	client, err := al.clientService.GetByID(clientID)
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+	if client == nil {
+		al.jsonErrorResponseWithTitle(w, http.StatusNotFound, fmt.Sprintf("client with id %q not found", clientID))
+		return
+	}
+
+	groups, err := al.clientGroupProvider.GetAll(req.Context())
+	if err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, "Failed to get client groups.", err)
+		return
+	}
+
+	client.Lock()
+	payload := ClientConfigPayload{
+		Client:          convertToClientPayload(client),
+		Groups:          make([]string, 0),
+		TunnelConflicts: make([]*TunnelConflict, 0),
+	}
+	for _, group := range groups {
+		if client.BelongsTo(group) {
+			payload.Groups = append(payload.Groups, group.ID)
+		}
+	}
+	if keep := al.clientService.repo.KeepLostClients; keep != nil {
+		keepSec := int64(keep.Seconds())
+		payload.KeepDisconnectedSec = &keepSec
+		if client.DisconnectedAt != nil {
+			obsoleteAt := client.DisconnectedAt.Add(*keep)
+			payload.ObsoleteAt = &obsoleteAt
+		}
+	}
+	client.Unlock()
+
+	for _, conflict := range al.clientService.GetTunnelConflicts() {
+		if conflict.ClientID == clientID {
+			payload.TunnelConflicts = append(payload.TunnelConflicts, conflict)
+		}
+	}
+
+	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(payload))
+}
+
 type UserPayload struct {
 	Username    string   `json:"username"`
 	Groups      []string `json:"groups"`
@@ -746,6 +1001,7 @@ type ClientPayload struct {
 	OSKernel               string                  `json:"os_kernel"`
 	OSVirtualizationSystem string                  `json:"os_virtualization_system"`
 	OSVirtualizationRole   string                  `json:"os_virtualization_role"`
+	OSRaw                  *clients.OSRaw          `json:"os_raw"`
 	NumCPUs                int                     `json:"num_cpus"`
 	CPUFamily              string                  `json:"cpu_family"`
 	CPUModel               string                  `json:"cpu_model"`
@@ -756,13 +1012,24 @@ type ClientPayload struct {
 	ClientAuthID           string                  `json:"client_auth_id"`
 	Version                string                  `json:"version"`
 	DisconnectedAt         *time.Time              `json:"disconnected_at"`
+	DisconnectReason       string                  `json:"disconnect_reason"`
+	ParkedAt               *time.Time              `json:"parked_at"`
 	ConnectionState        clients.ConnectionState `json:"connection_state"`
 	IPv4                   []string                `json:"ipv4"`
 	IPv6                   []string                `json:"ipv6"`
 	Tags                   []string                `json:"tags"`
+	AutoTags               []string                `json:"auto_tags"`
+	Environment            string                  `json:"environment"`
+	CommandsDisabled       bool                    `json:"commands_disabled"`
+	PackageManager         string                  `json:"package_manager"`
+	Interpreters           []string                `json:"interpreters"`
 	AllowedUserGroups      []string                `json:"allowed_user_groups"`
 	Tunnels                []*clients.Tunnel       `json:"tunnels"`
 	UpdatesStatus          *models.UpdatesStatus   `json:"updates_status"`
+	Health                 string                  `json:"health"`
+	HealthStatus           *models.HealthStatus    `json:"health_status"`
+	BootTime               *time.Time              `json:"boot_time"`
+	PreviousBootTime       *time.Time              `json:"previous_boot_time"`
 }
 
 func convertToClientsPayload(clients []*clients.Client) []ClientPayload {
@@ -785,16 +1052,24 @@ func convertToClientPayload(client *clients.Client) ClientPayload {
 		IPv4:                   client.IPv4,
 		IPv6:                   client.IPv6,
 		Tags:                   client.Tags,
+		AutoTags:               client.AutoTags,
+		Environment:            client.Environment,
+		CommandsDisabled:       client.CommandsDisabled,
+		PackageManager:         client.PackageManager,
+		Interpreters:           client.Interpreters,
 		Version:                client.Version,
 		Address:                client.Address,
 		Tunnels:                client.Tunnels,
 		DisconnectedAt:         client.DisconnectedAt,
+		DisconnectReason:       string(client.DisconnectReason),
+		ParkedAt:               client.ParkedAt,
 		ConnectionState:        client.ConnectionState(),
 		ClientAuthID:           client.ClientAuthID,
 		OSFullName:             client.OSFullName,
 		OSVersion:              client.OSVersion,
 		OSVirtualizationSystem: client.OSVirtualizationSystem,
 		OSVirtualizationRole:   client.OSVirtualizationRole,
+		OSRaw:                  client.OSRaw,
 		CPUFamily:              client.CPUFamily,
 		CPUModel:               client.CPUModel,
 		CPUModelName:           client.CPUModelName,
@@ -804,6 +1079,10 @@ func convertToClientPayload(client *clients.Client) ClientPayload {
 		MemoryTotal:            client.MemoryTotal,
 		AllowedUserGroups:      client.AllowedUserGroups,
 		UpdatesStatus:          client.UpdatesStatus,
+		Health:                 client.Health,
+		HealthStatus:           client.HealthStatus,
+		BootTime:               client.BootTime,
+		PreviousBootTime:       client.PreviousBootTime,
 	}
 }
 
@@ -829,6 +1108,14 @@ func getCorrespondingSortFunc(sortStr string) (sortFunc func(a []*clients.Client
 		sortFunc = clients.SortByHostname
 	case "version":
 		sortFunc = clients.SortByVersion
+	case "timezone":
+		sortFunc = clients.SortByTimezone
+	case "environment":
+		sortFunc = clients.SortByEnvironment
+	case "updates_available":
+		sortFunc = clients.SortByUpdatesAvailable
+	case "security_updates_available":
+		sortFunc = clients.SortBySecurityUpdatesAvailable
 	default:
 		err = fmt.Errorf("incorrect format of %q query param", queryParamSort)
 	}
@@ -848,6 +1135,20 @@ func (al *APIListener) handleDeleteClient(w http.ResponseWriter, req *http.Reque
 	al.Debugf("Client %q deleted.", clientID)
 }
 
+func (al *APIListener) handlePostClientUnpark(w http.ResponseWriter, req *http.Request) {
+	cid := mux.Vars(req)[routeParamClientID]
+
+	client, err := al.clientService.Unpark(cid)
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	al.Infof("Client[id=%q] unparked by %q.", cid, api.GetUser(req.Context(), al.Logger))
+
+	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(convertToClientPayload(client)))
+}
+
 type clientACLRequest struct {
 	AllowedUserGroups []string `json:"allowed_user_groups"`
 }
@@ -882,11 +1183,114 @@ func (al *APIListener) handlePostClientACL(w http.ResponseWriter, req *http.Requ
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// handlePostClientReconnect asks an active client to disconnect and connect to another server, e.g. for load balancing or maintenance.
+func (al *APIListener) handlePostClientReconnect(w http.ResponseWriter, req *http.Request) {
+	cid := mux.Vars(req)[routeParamClientID]
+
+	var reqBody comm.ReconnectRequest
+	if err := parseRequestBody(req.Body, &reqBody); err != nil {
+		al.jsonError(w, err)
+		return
+	}
+	if err := reqBody.Validate(); err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusBadRequest, "Invalid reconnect request.", err)
+		return
+	}
+
+	client, err := al.clientService.GetActiveByID(cid)
+	if err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to find an active client with id=%q.", cid), err)
+		return
+	}
+	if client == nil {
+		al.jsonErrorResponseWithTitle(w, http.StatusNotFound, fmt.Sprintf("Active client with id=%q not found.", cid))
+		return
+	}
+
+	err = comm.SendRequestAndGetResponse(client.Connection, comm.RequestTypeReconnect, reqBody, nil)
+	if err != nil {
+		if _, ok := err.(*comm.ClientError); ok {
+			al.jsonErrorResponseWithTitle(w, http.StatusConflict, err.Error())
+		} else {
+			al.jsonErrorResponseWithError(w, http.StatusInternalServerError, "Failed to send the reconnect request.", err)
+		}
+		return
+	}
+
+	al.Infof("Client[id=%q] asked to reconnect to %s by %q.", cid, reqBody.ServerURL, api.GetUser(req.Context(), al.Logger))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type clientTagsResult struct {
+	ClientID string   `json:"client_id"`
+	Tags     []string `json:"tags,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// handlePostClientsTags adds and removes tags of all connected clients that match given filters.
+func (al *APIListener) handlePostClientsTags(w http.ResponseWriter, req *http.Request) {
+	filterOptions := query.ExtractFilterOptions(req)
+	if len(filterOptions) == 0 {
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, "At least one filter should be specified.")
+		return
+	}
+	if err := validateClientsFilterOptions(filterOptions); err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	var reqBody comm.UpdateTagsRequest
+	if err := parseRequestBody(req.Body, &reqBody); err != nil {
+		al.jsonError(w, err)
+		return
+	}
+	if err := reqBody.Validate(); err != nil {
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	curUser, err := al.getUserModelForAuth(req.Context())
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	cls, err := al.clientService.GetUserClients(curUser, filterOptions)
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	results := make([]clientTagsResult, 0, len(cls))
+	for _, cur := range cls {
+		if cur.DisconnectedAt != nil {
+			continue
+		}
+		res := clientTagsResult{ClientID: cur.ID}
+		resp := &comm.UpdateTagsResponse{}
+		err := comm.SendRequestAndGetResponse(cur.Connection, comm.RequestTypeUpdateTags, reqBody, resp)
+		if err == nil {
+			err = al.clientService.SetTags(cur.ID, resp.Tags)
+		}
+		if err != nil {
+			al.Errorf("client_id=%q, Failed to update tags: %v", cur.ID, err)
+			res.Error = err.Error()
+		} else {
+			res.Tags = resp.Tags
+		}
+		results = append(results, res)
+	}
+
+	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(results))
+}
+
 const (
 	URISchemeMaxLength = 15
 
 	idleTimeoutMinutesQueryParam = "idle-timeout-minutes"
 	skipIdleTimeoutQueryParam    = "skip-idle-timeout"
+	maxLifetimeMinutesQueryParam = "max-lifetime-minutes"
 
 	ErrCodeLocalPortInUse        = "ERR_CODE_LOCAL_PORT_IN_USE"
 	ErrCodeRemotePortNotOpen     = "ERR_CODE_REMOTE_PORT_NOT_OPEN"
@@ -894,6 +1298,7 @@ const (
 	ErrCodeTunnelToPortExist     = "ERR_CODE_TUNNEL_TO_PORT_EXIST"
 	ErrCodeURISchemeLengthExceed = "ERR_CODE_URI_SCHEME_LENGTH_EXCEED"
 	ErrCodeInvalidACL            = "ERR_CODE_INVALID_ACL"
+	ErrCodeInvalidTunnelAuth     = "ERR_CODE_INVALID_TUNNEL_AUTH"
 )
 
 func (al *APIListener) handlePutClientTunnel(w http.ResponseWriter, req *http.Request) {
@@ -915,10 +1320,13 @@ func (al *APIListener) handlePutClientTunnel(w http.ResponseWriter, req *http.Re
 	}
 
 	localAddr := req.URL.Query().Get("local")
-	remoteAddr := req.URL.Query().Get("remote")
-	remoteStr := localAddr + ":" + remoteAddr
+	remoteAddrs := req.URL.Query()["remote"]
+	if len(remoteAddrs) == 0 {
+		remoteAddrs = []string{""}
+	}
+	remoteStr := localAddr + ":" + remoteAddrs[0]
 	if localAddr == "" {
-		remoteStr = remoteAddr
+		remoteStr = remoteAddrs[0]
 	}
 	remote, err := chshare.DecodeRemote(remoteStr)
 	if err != nil {
@@ -926,6 +1334,11 @@ func (al *APIListener) handlePutClientTunnel(w http.ResponseWriter, req *http.Re
 		return
 	}
 
+	if err := setTunnelBackends(remote, remoteAddrs, req.URL.Query().Get("weights")); err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
 	idleTimeoutMinutesStr := req.URL.Query().Get(idleTimeoutMinutesQueryParam)
 	skipIdleTimeout, err := strconv.ParseBool(req.URL.Query().Get(skipIdleTimeoutQueryParam))
 	if err != nil {
@@ -940,6 +1353,17 @@ func (al *APIListener) handlePutClientTunnel(w http.ResponseWriter, req *http.Re
 
 	remote.IdleTimeoutMinutes = int(idleTimeout.Minutes())
 
+	maxLifetime, err := validation.ResolveTunnelMaxLifetimeValue(req.URL.Query().Get(maxLifetimeMinutesQueryParam))
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+	remote.MaxLifetimeMinutes = int(maxLifetime.Minutes())
+	if maxLifetime > 0 {
+		expiresAt := time.Now().UTC().Add(maxLifetime)
+		remote.ExpiresAt = &expiresAt
+	}
+
 	aclStr := req.URL.Query().Get("acl")
 	if _, err = clients.ParseTunnelACL(aclStr); err != nil {
 		al.jsonErrorResponseWithErrCode(w, http.StatusBadRequest, ErrCodeInvalidACL, fmt.Sprintf("Invalid ACL: %s", err))
@@ -958,20 +1382,31 @@ func (al *APIListener) handlePutClientTunnel(w http.ResponseWriter, req *http.Re
 		remote.Scheme = &schemeStr
 	}
 
+	auth, err := parseTunnelAuth(req)
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+	if err := setTunnelBasicAuth(remote, auth.User, auth.Password, al.clientService.tunnelProxyTLS != nil); err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
 	if existing := client.FindTunnelByRemote(remote); existing != nil {
 		al.jsonErrorResponseWithErrCode(w, http.StatusBadRequest, ErrCodeTunnelExist, "Tunnel already exist.")
 		return
 	}
 
 	for _, t := range client.Tunnels {
-		if t.Remote.Remote() == remote.Remote() && t.EqualACL(remote.ACL) {
+		if t.Remote.Remote() == remote.Remote() && t.Protocol == remote.Protocol && t.EqualACL(remote.ACL) {
 			al.jsonErrorResponseWithErrCode(w, http.StatusBadRequest, ErrCodeTunnelToPortExist, fmt.Sprintf("Tunnel to port %s already exist.", remote.RemotePort))
 			return
 		}
 	}
 
-	if checkPortStr := req.URL.Query().Get("check_port"); checkPortStr != "0" {
-		if !al.checkRemotePort(w, *remote, client.Connection) {
+	// UDP ports can't be checked, they don't accept connections
+	if checkPortStr := req.URL.Query().Get("check_port"); checkPortStr != "0" && !remote.IsUDP() {
+		if !al.checkRemotePorts(w, *remote, client.Connection) {
 			return
 		}
 	}
@@ -993,68 +1428,224 @@ func (al *APIListener) handlePutClientTunnel(w http.ResponseWriter, req *http.Re
 	al.writeJSONResponse(w, http.StatusOK, response)
 }
 
-// TODO: remove this check, do it in client srv in startClientTunnels when https://github.com/cloudradar-monitoring/rport/pull/252 will be in master.
-// APIError needs both httpStatusCode and errorCode. To avoid too many merge conflicts with PR252 temporarily use this check to avoid breaking UI
-func (al *APIListener) checkLocalPort(w http.ResponseWriter, localPort string) bool {
-	lport, err := strconv.Atoi(localPort)
-	if err != nil {
-		al.jsonErrorResponseWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid port: %s.", localPort), err)
-		return false
+// setTunnelBackends sets all given remote addresses as tunnel backends. Additional remotes must not contain a local part.
+func setTunnelBackends(remote *chshare.Remote, remoteAddrs []string, weightsStr string) error {
+	remotes := []*chshare.Remote{remote}
+	for _, remoteAddr := range remoteAddrs[1:] {
+		cur, err := chshare.DecodeRemote(remoteAddr)
+		if err != nil {
+			return errors2.APIError{
+				Message:    fmt.Sprintf("failed to decode %q: %v", remoteAddr, err),
+				HTTPStatus: http.StatusBadRequest,
+			}
+		}
+		if cur.IsLocalSpecified() {
+			return errors2.APIError{
+				Message:    fmt.Sprintf("Invalid remote %q: only the first remote can have a local part.", remoteAddr),
+				HTTPStatus: http.StatusBadRequest,
+			}
+		}
+		remotes = append(remotes, cur)
 	}
 
-	busyPorts, err := ports.ListBusyPorts()
-	if err != nil {
-		al.jsonErrorResponse(w, http.StatusInternalServerError, err)
-		return false
+	var weights []int
+	if weightsStr != "" {
+		for _, weightStr := range strings.Split(weightsStr, ",") {
+			weight, err := strconv.Atoi(strings.TrimSpace(weightStr))
+			if err != nil {
+				return errors2.APIError{
+					Message:    fmt.Sprintf("Invalid weight %q.", weightStr),
+					Err:        err,
+					HTTPStatus: http.StatusBadRequest,
+				}
+			}
+			weights = append(weights, weight)
+		}
 	}
 
-	if busyPorts.Contains(lport) {
-		al.jsonErrorResponseWithErrCode(w, http.StatusBadRequest, ErrCodeLocalPortInUse, fmt.Sprintf("Port %d already in use.", lport))
-		return false
+	if err := remote.SetBackends(remotes, weights); err != nil {
+		return errors2.APIError{
+			Message:    "Invalid tunnel backends.",
+			Err:        err,
+			HTTPStatus: http.StatusBadRequest,
+		}
 	}
+	return nil
+}
 
-	return true
+// tunnelAuthRequest holds HTTP basic auth credentials of a new tunnel.
+type tunnelAuthRequest struct {
+	User     string `json:"auth_user"`
+	Password string `json:"auth_password"`
 }
 
-func (al *APIListener) checkRemotePort(w http.ResponseWriter, remote chshare.Remote, conn ssh.Conn) bool {
-	req := &comm.CheckPortRequest{
-		HostPort: remote.Remote(),
-		Timeout:  al.config.Server.CheckPortTimeout,
-	}
-	resp := &comm.CheckPortResponse{}
-	err := comm.SendRequestAndGetResponse(conn, comm.RequestTypeCheckPort, req, resp)
-	if err != nil {
-		if _, ok := err.(*comm.ClientError); ok {
-			al.jsonErrorResponse(w, http.StatusConflict, err)
-		} else {
-			al.jsonErrorResponse(w, http.StatusInternalServerError, err)
+// parseTunnelAuth returns basic auth credentials from an optional JSON body of a request to create a tunnel. Credentials
+// in query params are rejected, because URLs end up in access logs, proxies and browser history.
+func parseTunnelAuth(req *http.Request) (tunnelAuthRequest, error) {
+	var res tunnelAuthRequest
+	query := req.URL.Query()
+	for _, param := range []string{"auth_user", "auth_password"} {
+		if _, ok := query[param]; ok {
+			return res, errors2.APIError{
+				Message:    "Basic auth credentials must be sent in the request body, not in the URL.",
+				HTTPStatus: http.StatusBadRequest,
+				ErrCode:    ErrCodeInvalidTunnelAuth,
+			}
 		}
-		return false
 	}
 
-	if !resp.Open {
-		al.jsonErrorResponseWithDetail(
-			w,
-			http.StatusBadRequest,
-			ErrCodeRemotePortNotOpen,
-			fmt.Sprintf("Port %s is not in listening state.", remote.RemotePort),
-			resp.ErrMsg,
-		)
-		return false
+	dec := json.NewDecoder(req.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&res); err != nil && err != io.EOF {
+		return res, errors2.APIError{
+			Message:    "Invalid JSON data.",
+			Err:        err,
+			HTTPStatus: http.StatusBadRequest,
+		}
 	}
-
-	return true
+	return res, nil
 }
 
-func (al *APIListener) handleDeleteClientTunnel(w http.ResponseWriter, req *http.Request) {
-	vars := mux.Vars(req)
-	clientID := vars[routeParamClientID]
-	if clientID == "" {
-		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, "client id is missing")
-		return
+// setTunnelBasicAuth sets HTTP basic auth credentials that the tunnel proxy requires. Only a hash of the password is kept.
+func setTunnelBasicAuth(remote *chshare.Remote, user, password string, tlsConfigured bool) error {
+	if user == "" && password == "" {
+		return nil
 	}
-
-	force := false
+	if user == "" || password == "" {
+		return errors2.APIError{
+			Message:    "Both auth_user and auth_password are required for basic auth.",
+			HTTPStatus: http.StatusBadRequest,
+			ErrCode:    ErrCodeInvalidTunnelAuth,
+		}
+	}
+	if remote.Scheme == nil || !clients.IsHTTPScheme(*remote.Scheme) || remote.IsUDP() {
+		return errors2.APIError{
+			Message:    "Basic auth is supported only by TCP tunnels with http or https scheme.",
+			HTTPStatus: http.StatusBadRequest,
+			ErrCode:    ErrCodeInvalidTunnelAuth,
+		}
+	}
+	if *remote.Scheme == "https" && !tlsConfigured {
+		return errors2.APIError{
+			Message:    "Basic auth on https tunnels requires 'cert_file' and 'key_file' in the [api] section.",
+			HTTPStatus: http.StatusBadRequest,
+			ErrCode:    ErrCodeInvalidTunnelAuth,
+		}
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	remote.AuthUser = user
+	remote.AuthPasswordHash = string(hash)
+	return nil
+}
+
+// checkRemotePorts checks all tunnel backends. It succeeds if at least one of them is open.
+func (al *APIListener) checkRemotePorts(w http.ResponseWriter, remote chshare.Remote, conn ssh.Conn) bool {
+	backends := remote.GetBackends()
+	if len(backends) == 1 {
+		return al.checkRemotePort(w, remote, conn)
+	}
+
+	for _, backend := range backends {
+		req := &comm.CheckPortRequest{
+			HostPort: backend.Address(),
+			Timeout:  al.config.Server.CheckPortTimeout,
+		}
+		resp := &comm.CheckPortResponse{}
+		err := comm.SendRequestAndGetResponse(conn, comm.RequestTypeCheckPort, req, resp)
+		if err != nil {
+			if _, ok := err.(*comm.ClientError); ok {
+				al.jsonErrorResponse(w, http.StatusConflict, err)
+			} else {
+				al.jsonErrorResponse(w, http.StatusInternalServerError, err)
+			}
+			return false
+		}
+		if resp.Open {
+			return true
+		}
+	}
+
+	al.jsonErrorResponseWithDetail(
+		w,
+		http.StatusBadRequest,
+		ErrCodeRemotePortNotOpen,
+		"Remote ports are not in listening state.",
+		"None of the tunnel backends is open.",
+	)
+	return false
+}
+
+// handleGetTunnelConflicts returns tunnels requested by clients that failed to start because their server local port is taken.
+func (al *APIListener) handleGetTunnelConflicts(w http.ResponseWriter, req *http.Request) {
+	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(al.clientService.GetTunnelConflicts()))
+}
+
+// TODO: remove this check, do it in client srv in startClientTunnels when https://github.com/cloudradar-monitoring/rport/pull/252 will be in master.
+// APIError needs both httpStatusCode and errorCode. To avoid too many merge conflicts with PR252 temporarily use this check to avoid breaking UI
+func (al *APIListener) checkLocalPort(w http.ResponseWriter, localPort string) bool {
+	lport, err := strconv.Atoi(localPort)
+	if err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid port: %s.", localPort), err)
+		return false
+	}
+
+	busyPorts, err := ports.ListBusyPorts()
+	if err != nil {
+		al.jsonErrorResponse(w, http.StatusInternalServerError, err)
+		return false
+	}
+
+	if busyPorts.Contains(lport) {
+		al.jsonErrorResponseWithErrCode(w, http.StatusBadRequest, ErrCodeLocalPortInUse, fmt.Sprintf("Port %d already in use.", lport))
+		return false
+	}
+
+	return true
+}
+
+func (al *APIListener) checkRemotePort(w http.ResponseWriter, remote chshare.Remote, conn ssh.Conn) bool {
+	req := &comm.CheckPortRequest{
+		HostPort: remote.Remote(),
+		Timeout:  al.config.Server.CheckPortTimeout,
+	}
+	resp := &comm.CheckPortResponse{}
+	err := comm.SendRequestAndGetResponse(conn, comm.RequestTypeCheckPort, req, resp)
+	if err != nil {
+		if _, ok := err.(*comm.ClientError); ok {
+			al.jsonErrorResponse(w, http.StatusConflict, err)
+		} else {
+			al.jsonErrorResponse(w, http.StatusInternalServerError, err)
+		}
+		return false
+	}
+
+	if !resp.Open {
+		al.jsonErrorResponseWithDetail(
+			w,
+			http.StatusBadRequest,
+			ErrCodeRemotePortNotOpen,
+			fmt.Sprintf("Port %s is not in listening state.", remote.RemotePort),
+			resp.ErrMsg,
+		)
+		return false
+	}
+
+	return true
+}
+
+func (al *APIListener) handleDeleteClientTunnel(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	clientID := vars[routeParamClientID]
+	if clientID == "" {
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, "client id is missing")
+		return
+	}
+
+	force := false
 	forceStr := req.URL.Query().Get("force")
 	if forceStr != "" {
 		var err error
@@ -1245,13 +1836,8 @@ func (al *APIListener) handlePostClientsAuth(w http.ResponseWriter, req *http.Re
 		return
 	}
 
-	if len(newClient.ID) < MinCredentialsLength {
-		al.jsonErrorResponseWithDetail(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid or missing ID.", fmt.Sprintf("Min size is %d.", MinCredentialsLength))
-		return
-	}
-
-	if len(newClient.Password) < MinCredentialsLength {
-		al.jsonErrorResponseWithDetail(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Invalid or missing password.", fmt.Sprintf("Min size is %d.", MinCredentialsLength))
+	if err := validateInputClientAuth(&newClient); err != nil {
+		al.jsonError(w, err)
 		return
 	}
 
@@ -1270,6 +1856,34 @@ func (al *APIListener) handlePostClientsAuth(w http.ResponseWriter, req *http.Re
 	w.WriteHeader(http.StatusCreated)
 }
 
+// validateInputClientAuth returns errors of all invalid fields of a given client auth or nil if it's valid.
+func validateInputClientAuth(clientAuth *clientsauth.ClientAuth) error {
+	errs := errors2.APIErrors{}
+	minSizeDetail := fmt.Sprintf("Min size is %d.", MinCredentialsLength)
+
+	if len(clientAuth.ID) < MinCredentialsLength {
+		errs = append(errs, errors2.APIError{
+			Message:    "Invalid or missing ID.",
+			Err:        errors.New(minSizeDetail),
+			HTTPStatus: http.StatusBadRequest,
+			ErrCode:    ErrCodeInvalidRequest,
+		})
+	}
+	if len(clientAuth.Password) < MinCredentialsLength {
+		errs = append(errs, errors2.APIError{
+			Message:    "Invalid or missing password.",
+			Err:        errors.New(minSizeDetail),
+			HTTPStatus: http.StatusBadRequest,
+			ErrCode:    ErrCodeInvalidRequest,
+		})
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
 func (al *APIListener) handleDeleteClientAuth(w http.ResponseWriter, req *http.Request) {
 	if !al.allowClientAuthWrite(w) {
 		return
@@ -1326,6 +1940,36 @@ func (al *APIListener) handleDeleteClientAuth(w http.ResponseWriter, req *http.R
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// handlePurgeClientsAuth deletes client auth entries that have no bound clients for longer than a grace period.
+// The grace period can be given in a query param, otherwise the configured one is used. If none is configured,
+// the param is required, so all unused entries are never purged by accident.
+func (al *APIListener) handlePurgeClientsAuth(w http.ResponseWriter, req *http.Request) {
+	if !al.allowClientAuthWrite(w) {
+		return
+	}
+
+	gracePeriod := al.config.Server.PurgeClientsAuthAfter
+	if v := req.URL.Query().Get("older_than"); v != "" {
+		var err error
+		gracePeriod, err = time.ParseDuration(v)
+		if err != nil || gracePeriod < 0 {
+			al.jsonErrorResponseWithErrCode(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Invalid older_than param %v.", v))
+			return
+		}
+	} else if gracePeriod == 0 {
+		al.jsonErrorResponseWithErrCode(w, http.StatusBadRequest, ErrCodeInvalidRequest, "Missing older_than param, 'purge_clients_auth_after' is not configured.")
+		return
+	}
+
+	purged, err := al.clientsAuthPurge.Purge(gracePeriod)
+	if err != nil {
+		al.jsonErrorResponse(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(purged))
+}
+
 type clientsAuthMode string
 
 const (
@@ -1378,13 +2022,99 @@ func (al *APIListener) handlePostCommand(w http.ResponseWriter, req *http.Reques
 	al.handleExecuteCommand(req.Context(), w, execCmdInput)
 }
 
-func (al *APIListener) handleExecuteCommand(ctx context.Context, w http.ResponseWriter, executeInput *api.ExecuteInput) {
-	if executeInput.Command == "" {
-		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, "Command cannot be empty.")
+// handlePostLibraryCommand executes a library command on a given client filling its params from the request.
+// Interpreter and timeout of the library command are used unless they are given in the request.
+func (al *APIListener) handlePostLibraryCommand(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	cid := vars[routeParamClientID]
+	id := vars[routeParamCommandValueID]
+
+	execCmdInput := &api.ExecuteInput{}
+	err := parseRequestBody(req.Body, &execCmdInput)
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+	if execCmdInput.Command != "" || execCmdInput.Script != "" {
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, "Command is taken from the library, 'command' and 'script' should not be specified.")
+		return
+	}
+
+	libCmd, found, err := al.commandManager.GetByID(req.Context(), id)
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+	if !found {
+		al.jsonErrorResponseWithTitle(w, http.StatusNotFound, fmt.Sprintf("Cannot find a command by the provided id: %s", id))
+		return
+	}
+	if err := libCmd.ValidateParamValues(execCmdInput.Params); err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusBadRequest, "Invalid params.", err)
 		return
 	}
+
+	execCmdInput.Command = libCmd.Cmd
+	if execCmdInput.Interpreter == "" {
+		execCmdInput.Interpreter = libCmd.Interpreter
+	}
+	if execCmdInput.TimeoutSec <= 0 {
+		execCmdInput.TimeoutSec = libCmd.TimeoutSec
+	}
+	execCmdInput.ClientID = cid
+	execCmdInput.IsScript = false
+	execCmdInput.IsTemplate = true
+
+	al.handleExecuteCommand(req.Context(), w, execCmdInput)
+}
+
+// validateExecuteInput returns errors of all invalid fields of a given command input or nil if it's valid.
+func validateExecuteInput(executeInput *api.ExecuteInput) error {
+	errs := errors2.APIErrors{}
+	addErr := func(title string, err error) {
+		errs = append(errs, errors2.APIError{
+			Message:    title,
+			Err:        err,
+			HTTPStatus: http.StatusBadRequest,
+		})
+	}
+
+	if executeInput.Command == "" {
+		addErr("Command cannot be empty.", nil)
+	} else if err := validateCommandTemplate(executeInput.Command, executeInput.IsTemplate, executeInput.Params); err != nil {
+		addErr("Invalid command.", err)
+	}
 	if err := validation.ValidateInterpreter(executeInput.Interpreter, executeInput.IsScript); err != nil {
-		al.jsonErrorResponseWithError(w, http.StatusBadRequest, "Invalid interpreter.", err)
+		addErr("Invalid interpreter.", err)
+	}
+	if executeInput.Umask != "" {
+		if _, err := models.ParseUmask(executeInput.Umask); err != nil {
+			addErr("Invalid umask.", err)
+		}
+	}
+	if err := models.ValidateEnv(executeInput.Env); err != nil {
+		addErr("Invalid env.", err)
+	}
+	if executeInput.RunAs != "" {
+		if err := models.ValidateRunAs(executeInput.RunAs); err != nil {
+			addErr("Invalid run_as.", err)
+		}
+	}
+	if stdin, err := executeInput.GetStdin(); err != nil {
+		addErr("Invalid stdin.", err)
+	} else if err := models.ValidateStdin(stdin); err != nil {
+		addErr("Invalid stdin.", err)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func (al *APIListener) handleExecuteCommand(ctx context.Context, w http.ResponseWriter, executeInput *api.ExecuteInput) {
+	if err := validateExecuteInput(executeInput); err != nil {
+		al.jsonError(w, err)
 		return
 	}
 
@@ -1401,6 +2131,22 @@ func (al *APIListener) handleExecuteCommand(ctx context.Context, w http.Response
 		al.jsonErrorResponseWithTitle(w, http.StatusNotFound, fmt.Sprintf("Active client with id=%q not found.", executeInput.ClientID))
 		return
 	}
+	if err := checkCommandsEnabled(client); err != nil {
+		al.jsonErrorResponseWithTitle(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err := checkInterpreterAvailable(client, executeInput.Interpreter); err != nil {
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if executeInput.Umask != "" && client.OSKernel == "windows" {
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, "Umask is not supported on Windows clients.")
+		return
+	}
+	if executeInput.RunAs != "" && client.OSKernel == "windows" {
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, "Running as another user is not supported on Windows clients.")
+		return
+	}
 
 	// send the command to the client
 	// Send a job with all possible info in order to get the full-populated job back (in client-listener) when it's done.
@@ -1410,6 +2156,14 @@ func (al *APIListener) handleExecuteCommand(ctx context.Context, w http.Response
 		al.jsonError(w, err)
 		return
 	}
+	createdBy := api.GetUser(ctx, al.Logger)
+	cmd, err := renderCommand(executeInput.Command, executeInput.IsTemplate, createdBy, jid, nil, executeInput.Params, client)
+	if err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusBadRequest, "Invalid command.", err)
+		return
+	}
+	// stdin is already validated
+	stdin, _ := executeInput.GetStdin()
 	curJob := models.Job{
 		JobSummary: models.JobSummary{
 			JID:        jid,
@@ -1417,19 +2171,36 @@ func (al *APIListener) handleExecuteCommand(ctx context.Context, w http.Response
 		},
 		ClientID:    executeInput.ClientID,
 		ClientName:  client.Name,
-		Command:     executeInput.Command,
+		Command:     cmd,
 		Interpreter: executeInput.Interpreter,
-		CreatedBy:   api.GetUser(ctx, al.Logger),
+		CreatedBy:   createdBy,
 		TimeoutSec:  executeInput.TimeoutSec,
 		Result:      nil,
 		Cwd:         executeInput.Cwd,
 		IsSudo:      executeInput.IsSudo,
 		IsScript:    executeInput.IsScript,
+		Umask:       executeInput.Umask,
+		RunAs:       executeInput.RunAs,
+		Env:         executeInput.Env,
+		EnvKeys:     models.SortedEnvKeys(executeInput.Env),
+		Stdin:       stdin,
 	}
 	sshResp := &comm.RunCmdResponse{}
-	err = comm.SendRequestAndGetResponse(client.Connection, comm.RequestTypeRunCmd, curJob, sshResp)
+	err = al.sendRunCmdRequest(client.Connection, &curJob, sshResp)
+	// env values are secrets, only their names are stored, stdin is not stored as well
+	curJob.Env = nil
+	curJob.Stdin = ""
 	if err != nil {
 		if _, ok := err.(*comm.ClientError); ok {
+			// the client refused the command, keep it as a failed job
+			curJob.Status = models.JobStatusFailed
+			now := time.Now()
+			curJob.StartedAt = now
+			curJob.FinishedAt = &now
+			curJob.Error = err.Error()
+			if dbErr := al.jobProvider.CreateJob(&curJob); dbErr != nil {
+				al.Errorf("client_id=%q, Failed to persist a failed job: %v", curJob.ClientID, dbErr)
+			}
 			al.jsonErrorResponseWithTitle(w, http.StatusConflict, err.Error())
 		} else {
 			al.jsonErrorResponseWithError(w, http.StatusInternalServerError, "Failed to execute remote command.", err)
@@ -1457,6 +2228,88 @@ func (al *APIListener) handleExecuteCommand(ctx context.Context, w http.Response
 	al.Debugf("Job[id=%q] created to execute remote command on client with id=%q: %q.", curJob.JID, executeInput.ClientID, executeInput.Command)
 }
 
+// handleValidateCommand runs all the checks of a given command without executing it.
+func (al *APIListener) handleValidateCommand(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	cid := vars[routeParamClientID]
+	if cid == "" {
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, fmt.Sprintf("Missing %q route param.", routeParamClientID))
+		return
+	}
+
+	execCmdInput := &api.ExecuteInput{}
+	err := parseRequestBody(req.Body, &execCmdInput)
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	client, err := al.clientService.GetActiveByID(cid)
+	if err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to find an active client with id=%q.", cid), err)
+		return
+	}
+	if client == nil {
+		al.jsonErrorResponseWithTitle(w, http.StatusNotFound, fmt.Sprintf("Active client with id=%q not found.", cid))
+		return
+	}
+
+	if denied := validateCommandPolicy(execCmdInput.Command, execCmdInput.Interpreter, execCmdInput.IsTemplate, execCmdInput.Params); denied != nil {
+		al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(denied))
+		return
+	}
+	if err := checkCommandsEnabled(client); err != nil {
+		al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(comm.NewCmdDenied(comm.CmdRuleRemoteCommands, err.Error())))
+		return
+	}
+	if err := checkInterpreterAvailable(client, execCmdInput.Interpreter); err != nil {
+		al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(comm.NewCmdDenied(comm.CmdRuleInterpreter, err.Error())))
+		return
+	}
+
+	createdBy := api.GetUser(req.Context(), al.Logger)
+	cmd, err := renderCommand(execCmdInput.Command, execCmdInput.IsTemplate, createdBy, "", nil, execCmdInput.Params, client)
+	if err != nil {
+		al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(comm.NewCmdDenied(comm.CmdRuleTemplate, err.Error())))
+		return
+	}
+	job := models.Job{
+		ClientID:    cid,
+		ClientName:  client.Name,
+		Command:     cmd,
+		Interpreter: execCmdInput.Interpreter,
+		CreatedBy:   createdBy,
+		Cwd:         execCmdInput.Cwd,
+		IsSudo:      execCmdInput.IsSudo,
+	}
+	resp := &comm.ValidateCmdResponse{}
+	err = comm.SendRequestAndGetResponse(client.Connection, comm.RequestTypeValidateCmd, job, resp)
+	if err != nil {
+		if _, ok := err.(*comm.ClientError); ok {
+			al.jsonErrorResponseWithTitle(w, http.StatusConflict, err.Error())
+		} else {
+			al.jsonErrorResponseWithError(w, http.StatusInternalServerError, "Failed to validate remote command.", err)
+		}
+		return
+	}
+
+	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(resp))
+}
+
+// validateCommandPolicy runs the server side checks of a given command. Returns nil if the command passes all of them.
+func validateCommandPolicy(cmd, interpreter string, isTemplate bool, params map[string]string) *comm.ValidateCmdResponse {
+	if cmd == "" {
+		return comm.NewCmdDenied(comm.CmdRuleCommand, "Command cannot be empty.")
+	}
+	if err := validateCommandTemplate(cmd, isTemplate, params); err != nil {
+		return comm.NewCmdDenied(comm.CmdRuleTemplate, err.Error())
+	}
+	if err := validation.ValidateInterpreter(interpreter, false); err != nil {
+		return comm.NewCmdDenied(comm.CmdRuleInterpreter, err.Error())
+	}
+	return nil
+}
+
 func (al *APIListener) handleExecuteScript(w http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	cid := vars[routeParamClientID]
@@ -1485,6 +2338,8 @@ func (al *APIListener) handleExecuteScript(w http.ResponseWriter, req *http.Requ
 
 	execCmdInput.ClientID = cid
 	execCmdInput.IsScript = true
+	// scripts are sent as is
+	execCmdInput.IsTemplate = false
 
 	al.handleExecuteCommand(req.Context(), w, execCmdInput)
 }
@@ -1497,16 +2352,59 @@ func (al *APIListener) handleGetCommands(w http.ResponseWriter, req *http.Reques
 		return
 	}
 
-	res, err := al.jobProvider.GetSummariesByClientID(cid)
+	filters := query.ExtractFilterOptions(req)
+	if err := query.ValidateFilterOptions(filters, jobs.SummariesFilters); err != nil {
+		al.jsonError(w, err)
+		return
+	}
+	if err := jobs.ValidateDurationFilters(filters); err != nil {
+		al.jsonError(w, err)
+		return
+	}
+	sorts := query.ExtractSortOptions(req)
+	if err := query.ValidateSortOptions(sorts, jobs.SummariesSorts); err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	includeRunning, err := parseIncludeRunning(req)
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	res, err := al.jobProvider.GetSummariesByClientID(cid, jobs.SummariesOptions{
+		Filters:        filters,
+		Sorts:          sorts,
+		IncludeRunning: includeRunning,
+	})
 	if err != nil {
 		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to get client jobs: client_id=%q.", cid), err)
 		return
 	}
 
-	jobs.SortByFinishedAt(res, true)
+	if len(sorts) == 0 {
+		jobs.SortByFinishedAt(res, true)
+	}
 	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(res))
 }
 
+// parseIncludeRunning returns a value of the include_running query param, false if it's not set.
+func parseIncludeRunning(req *http.Request) (bool, error) {
+	includeRunningStr := req.URL.Query().Get("include_running")
+	if includeRunningStr == "" {
+		return false, nil
+	}
+	includeRunning, err := strconv.ParseBool(includeRunningStr)
+	if err != nil {
+		return false, errors2.APIError{
+			Message:    fmt.Sprintf("Invalid include_running param %v.", includeRunningStr),
+			HTTPStatus: http.StatusBadRequest,
+		}
+	}
+	return includeRunning, nil
+}
+
 func (al *APIListener) handleGetCommand(w http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	cid := vars[routeParamClientID]
@@ -1533,6 +2431,144 @@ func (al *APIListener) handleGetCommand(w http.ResponseWriter, req *http.Request
 	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(job))
 }
 
+const jobCanceledByUserErr = "cancelled by user"
+
+// handleCancelCommand cancels a running job by killing its command on the client.
+func (al *APIListener) handleCancelCommand(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	cid := vars[routeParamClientID]
+	jid := vars[routeParamJobID]
+
+	job, err := al.jobProvider.GetByJID(cid, jid)
+	if err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to find a job[id=%q].", jid), err)
+		return
+	}
+	if job == nil {
+		al.jsonErrorResponseWithTitle(w, http.StatusNotFound, fmt.Sprintf("Job[id=%q] not found.", jid))
+		return
+	}
+	if job.Status != models.JobStatusRunning || job.PID == nil {
+		al.jsonErrorResponseWithTitle(w, http.StatusConflict, fmt.Sprintf("Job[id=%q] is not running, status: %s.", jid, job.Status))
+		return
+	}
+
+	client, err := al.clientService.GetActiveByID(cid)
+	if err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to find an active client with id=%q.", cid), err)
+		return
+	}
+	if client == nil {
+		al.jsonErrorResponseWithTitle(w, http.StatusNotFound, fmt.Sprintf("Active client with id=%q not found.", cid))
+		return
+	}
+
+	cancelReq := &comm.CancelJobRequest{
+		JID: job.JID,
+		PID: *job.PID,
+	}
+	err = comm.SendRequestAndGetResponse(client.Connection, comm.RequestTypeCancelJob, cancelReq, nil)
+	if err != nil {
+		if _, ok := err.(*comm.ClientError); ok {
+			al.jsonErrorResponseWithTitle(w, http.StatusConflict, err.Error())
+		} else {
+			al.jsonErrorResponseWithError(w, http.StatusInternalServerError, "Failed to cancel the job.", err)
+		}
+		return
+	}
+
+	now := time.Now()
+	job.Status = models.JobStatusFailed
+	job.FinishedAt = &now
+	job.Error = jobCanceledByUserErr
+	al.dispatchedJobs.Del(job.JID)
+	if err := al.jobProvider.SaveJob(job); err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, "Failed to persist the canceled job.", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	al.Debugf("Job[id=%q] on client with id=%q canceled by %q.", jid, cid, api.GetUser(req.Context(), al.Logger))
+}
+
+const ErrCodeResultChecksumMismatch = "ERR_CODE_RESULT_CHECKSUM_MISMATCH"
+
+// handleGetCommandResult returns a job result. If it's stored compressed and the API client accepts gzip,
+// the stored bytes are passed through without decompression. If verify param is set, the result is checked against
+// the checksum computed when it was stored and a mismatch is reported as an error.
+func (al *APIListener) handleGetCommandResult(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	cid := vars[routeParamClientID]
+	if cid == "" {
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, fmt.Sprintf("Missing %q route param.", routeParamClientID))
+		return
+	}
+	jid := vars[routeParamJobID]
+	if jid == "" {
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, fmt.Sprintf("Missing %q route param.", routeParamJobID))
+		return
+	}
+
+	verify := false
+	if verifyStr := req.URL.Query().Get("verify"); verifyStr != "" {
+		var err error
+		verify, err = strconv.ParseBool(verifyStr)
+		if err != nil {
+			al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, fmt.Sprintf("Invalid verify param %v.", verifyStr))
+			return
+		}
+	}
+
+	res, err := al.jobProvider.GetRawResult(cid, jid)
+	if err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to find a result of job[id=%q].", jid), err)
+		return
+	}
+	if res == nil {
+		al.jsonErrorResponseWithTitle(w, http.StatusNotFound, fmt.Sprintf("Result of job[id=%q] not found.", jid))
+		return
+	}
+	if verify {
+		if err := res.Verify(); err != nil {
+			al.Errorf("Result of job[id=%q] on client with id=%q is corrupted: %v", jid, cid, err)
+			al.jsonErrorResponseWithDetail(w, http.StatusInternalServerError, ErrCodeResultChecksumMismatch,
+				fmt.Sprintf("Result of job[id=%q] doesn't match its checksum.", jid), err.Error())
+			return
+		}
+	}
+
+	if res.Gzipped && res.Payload && acceptsGzip(req) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Header().Set("Content-Length", strconv.Itoa(len(res.Data)))
+		w.WriteHeader(http.StatusOK)
+		if _, err := w.Write(res.Data); err != nil {
+			al.Errorf("error writing response: %s", err)
+		}
+		return
+	}
+
+	b, err := res.JSON()
+	if err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to read a result of job[id=%q].", jid), err)
+		return
+	}
+	handlers.CompressHandler(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(json.RawMessage(b)))
+	})).ServeHTTP(w, req)
+}
+
+func acceptsGzip(req *http.Request) bool {
+	for _, enc := range strings.Split(req.Header.Get("Accept-Encoding"), ",") {
+		if strings.TrimSpace(strings.SplitN(enc, ";", 2)[0]) == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
 type newJobResponse struct {
 	JID string `json:"jid"`
 }
@@ -1542,6 +2578,7 @@ type multiClientCmdRequest struct {
 	ClientIDCommandMap  map[string]string
 	OrderedClients      []*clients.Client
 	GroupIDs            []string `json:"group_ids"`
+	Tags                []string `json:"tags"`
 	Command             string   `json:"command"`
 	Script              string   `json:"script"`
 	Cwd                 string   `json:"cwd"`
@@ -1550,7 +2587,11 @@ type multiClientCmdRequest struct {
 	TimeoutSec          int      `json:"timeout_sec"`
 	ExecuteConcurrently bool     `json:"execute_concurrently"`
 	AbortOnError        *bool    `json:"abort_on_error"` // pointer is used because it's default value is true. Otherwise it would be more difficult to check whether this field is missing or not
-	IsScript            bool
+	BatchTimeoutSec     int      `json:"batch_timeout_sec"`
+	IsTemplate          bool     `json:"is_template"`
+	// Params are values substituted into a template command as {{.Params.<name>}}
+	Params   map[string]string `json:"params"`
+	IsScript bool
 }
 
 // TODO: refactor to reuse similar code for REST API and WebSocket to execute cmds if both will be supported
@@ -1566,6 +2607,10 @@ func (al *APIListener) handlePostMultiClientCommand(w http.ResponseWriter, req *
 		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, "Command cannot be empty.")
 		return
 	}
+	if err := validateCommandTemplate(reqBody.Command, reqBody.IsTemplate, reqBody.Params); err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusBadRequest, "Invalid command.", err)
+		return
+	}
 	if err := validation.ValidateInterpreter(reqBody.Interpreter, reqBody.IsScript); err != nil {
 		al.jsonErrorResponseWithError(w, http.StatusBadRequest, "Invalid interpreter.", err)
 		return
@@ -1574,15 +2619,19 @@ func (al *APIListener) handlePostMultiClientCommand(w http.ResponseWriter, req *
 	if reqBody.TimeoutSec <= 0 {
 		reqBody.TimeoutSec = al.config.Server.RunRemoteCmdTimeoutSec
 	}
+	if reqBody.BatchTimeoutSec < 0 {
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, "Batch timeout cannot be negative.")
+		return
+	}
 
-	orderedClients, groupClientsCount, err := al.getOrderedClients(ctx, reqBody.ClientIDs, reqBody.GroupIDs)
+	orderedClients, groupClientsCount, err := al.getOrderedClients(ctx, reqBody.ClientIDs, reqBody.GroupIDs, reqBody.Tags)
 	if err != nil {
 		al.jsonError(w, err)
 		return
 	}
 
-	if len(reqBody.GroupIDs) > 0 && groupClientsCount == 0 && len(reqBody.ClientIDs) == 0 {
-		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, "No active clients belong to the selected group(s).")
+	if msg := noSelectedClientsMsg(reqBody, groupClientsCount); msg != "" {
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, msg)
 		return
 	}
 
@@ -1591,6 +2640,10 @@ func (al *APIListener) handlePostMultiClientCommand(w http.ResponseWriter, req *
 		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, fmt.Sprintf("At least %d clients should be specified.", minClients))
 		return
 	}
+	if len(reqBody.Tags) > 0 && len(orderedClients) < minClients {
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, fmt.Sprintf("At least %d clients should be specified, the selected clients, groups and tags resolve to %d active client(s).", minClients, len(orderedClients)))
+		return
+	}
 
 	// by default abortOnErr is true
 	abortOnErr := true
@@ -1621,17 +2674,27 @@ func (al *APIListener) handlePostMultiClientCommand(w http.ResponseWriter, req *
 			StartedAt: time.Now(),
 			CreatedBy: curUser.Username,
 		},
-		ClientIDs:   reqBody.ClientIDs,
-		GroupIDs:    reqBody.GroupIDs,
-		Command:     reqBody.Command,
-		Interpreter: reqBody.Interpreter,
-		Cwd:         reqBody.Cwd,
-		IsSudo:      reqBody.IsSudo,
-		TimeoutSec:  reqBody.TimeoutSec,
-		Concurrent:  reqBody.ExecuteConcurrently,
-		AbortOnErr:  abortOnErr,
+		ClientIDs:       reqBody.ClientIDs,
+		GroupIDs:        reqBody.GroupIDs,
+		Tags:            reqBody.Tags,
+		Command:         reqBody.Command,
+		Interpreter:     reqBody.Interpreter,
+		Cwd:             reqBody.Cwd,
+		IsSudo:          reqBody.IsSudo,
+		IsTemplate:      reqBody.IsTemplate,
+		Params:          reqBody.Params,
+		TimeoutSec:      reqBody.TimeoutSec,
+		Concurrent:      reqBody.ExecuteConcurrently,
+		AbortOnErr:      abortOnErr,
+		BatchTimeoutSec: reqBody.BatchTimeoutSec,
+	}
+	done, err := al.jobsDoneChannel.Add(multiJob.JID, len(orderedClients))
+	if err != nil {
+		al.jsonErrorResponseWithTitle(w, http.StatusTooManyRequests, err.Error())
+		return
 	}
 	if err := al.jobProvider.SaveMultiJob(multiJob); err != nil {
+		al.jobsDoneChannel.Del(multiJob.JID)
 		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, "Failed to persist a new multi-client job.", err)
 		return
 	}
@@ -1641,14 +2704,33 @@ func (al *APIListener) handlePostMultiClientCommand(w http.ResponseWriter, req *
 	}
 	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(resp))
 
-	al.Debugf("Multi-client Job[id=%q] created to execute remote command on clients %s, groups %s: %q.", multiJob.JID, reqBody.ClientIDs, reqBody.GroupIDs, reqBody.Command)
+	al.Debugf("Multi-client Job[id=%q] created to execute remote command on clients %s, groups %s, tags %s: %q.", multiJob.JID, reqBody.ClientIDs, reqBody.GroupIDs, reqBody.Tags, reqBody.Command)
 
-	go al.executeMultiClientJob(multiJob, orderedClients)
+	go al.executeMultiClientJob(multiJob, orderedClients, done)
+}
+
+// noSelectedClientsMsg returns an error message if a multi-client request selects clients only by groups or tags
+// and none of them matched, empty otherwise.
+func noSelectedClientsMsg(req multiClientCmdRequest, groupClientsCount int) string {
+	if len(req.ClientIDs) > 0 || groupClientsCount > 0 {
+		return ""
+	}
+	switch {
+	case len(req.GroupIDs) > 0 && len(req.Tags) > 0:
+		return "No active clients belong to the selected group(s) or have the selected tag(s)."
+	case len(req.GroupIDs) > 0:
+		return "No active clients belong to the selected group(s)."
+	case len(req.Tags) > 0:
+		return "No active clients have the selected tag(s)."
+	}
+	return ""
 }
 
+// getOrderedClients returns clients with given ids followed by active clients of given groups and active clients
+// having any of given tags without duplicates. groupClientsFoundCount is a number of clients found by groups and tags.
 func (al *APIListener) getOrderedClients(
 	ctx context.Context,
-	clientIDs, groupIDs []string) (
+	clientIDs, groupIDs, tags []string) (
 	orderedClients []*clients.Client,
 	groupClientsFoundCount int,
 	err error,
@@ -1675,7 +2757,21 @@ func (al *APIListener) getOrderedClients(
 		groups = append(groups, group)
 	}
 	groupClients := al.clientService.GetActiveByGroups(groups)
-	groupClientsFoundCount = len(groupClients)
+	tagClients, err := al.clientService.GetActiveByTags(tags)
+	if err != nil {
+		err = errors2.APIError{
+			Message:    "Failed to find clients by tags.",
+			Err:        err,
+			HTTPStatus: http.StatusInternalServerError,
+		}
+		return orderedClients, 0, err
+	}
+	// tag clients are sorted to run a job in a predictable order
+	sort.Slice(tagClients, func(i, j int) bool {
+		return tagClients[i].ID < tagClients[j].ID
+	})
+	groupClients = append(groupClients, tagClients...)
+	groupClientsFoundCount = countUniqueClients(groupClients)
 
 	orderedClients = make([]*clients.Client, 0)
 	usedClientIDs := make(map[string]bool)
@@ -1723,33 +2819,58 @@ func (al *APIListener) getOrderedClients(
 	return orderedClients, groupClientsFoundCount, nil
 }
 
+func countUniqueClients(cls []*clients.Client) int {
+	ids := make(map[string]bool, len(cls))
+	for _, cur := range cls {
+		ids[cur.ID] = true
+	}
+	return len(ids)
+}
+
+// executeMultiClientJob runs a given multi-client job. A given done channel is used in sequential execution
+// and with a batch timeout to get job results.
 func (al *APIListener) executeMultiClientJob(
 	job *models.MultiJob,
 	orderedClients []*clients.Client,
+	done chan *models.Job,
 ) {
-	// for sequential execution - create a channel to get the job result
-	var curJobDoneChannel chan *models.Job
-	if !job.Concurrent {
-		curJobDoneChannel = make(chan *models.Job)
-		al.jobsDoneChannel.Set(job.JID, curJobDoneChannel)
-		defer func() {
-			close(curJobDoneChannel)
-			al.jobsDoneChannel.Del(job.JID)
-		}()
-	}
-	for _, client := range orderedClients {
+	ctx := context.Background()
+	if job.BatchTimeoutSec > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(job.BatchTimeoutSec)*time.Second)
+		defer cancel()
+	}
+
+	// started counts jobs sent to clients in concurrent execution
+	var started int32
+	wg := sync.WaitGroup{}
+	// pending are clients the job wasn't sent to before the batch timeout
+	var pending []*clients.Client
+	for i, client := range orderedClients {
+		if ctx.Err() != nil {
+			pending = orderedClients[i:]
+			break
+		}
 		if job.Concurrent {
-			go al.createAndRunJob(
-				job.JID,
-				job.Command,
-				job.Interpreter,
-				job.CreatedBy,
-				job.Cwd,
-				job.TimeoutSec,
-				job.IsSudo,
-				job.IsScript,
-				client,
-			)
+			wg.Add(1)
+			go func(client *clients.Client) {
+				defer wg.Done()
+				if al.createAndRunJob(
+					job.JID,
+					job.Command,
+					job.Interpreter,
+					job.CreatedBy,
+					job.Cwd,
+					job.TimeoutSec,
+					job.IsSudo,
+					job.IsScript,
+					job.IsTemplate,
+					job.Params,
+					client,
+				) {
+					atomic.AddInt32(&started, 1)
+				}
+			}(client)
 		} else {
 			success := al.createAndRunJob(
 				job.JID,
@@ -1760,6 +2881,8 @@ func (al *APIListener) executeMultiClientJob(
 				job.TimeoutSec,
 				job.IsSudo,
 				job.IsScript,
+				job.IsTemplate,
+				job.Params,
 				client,
 			)
 			if !success {
@@ -1775,21 +2898,151 @@ func (al *APIListener) executeMultiClientJob(
 			}
 
 			// wait until command is finished
-			jobResult := <-curJobDoneChannel
+			jobResult := waitForJobResult(ctx, done, job.TimeoutSec)
+			if jobResult == nil {
+				if ctx.Err() != nil {
+					continue
+				}
+				al.Errorf("multi_client_id=%q, client_id=%q, Timed out waiting for job result.", job.JID, client.ID)
+				if job.AbortOnErr {
+					break
+				}
+				continue
+			}
 			if job.AbortOnErr && jobResult.Status == models.JobStatusFailed {
 				break
 			}
 		}
 	}
+
+	if job.Concurrent {
+		// the job stays in-flight until results of all started jobs come, so the limit of in-flight jobs applies
+		wg.Wait()
+		for i := int32(0); i < atomic.LoadInt32(&started); i++ {
+			if waitForJobResult(ctx, done, job.TimeoutSec) == nil {
+				break
+			}
+		}
+	}
+	if job.BatchTimeoutSec > 0 {
+		if ctx.Err() != nil {
+			al.cancelMultiClientJob(job, pending)
+		}
+		al.finishMultiClientJob(job)
+	}
+	al.jobsDoneChannel.Del(job.JID)
 	if al.testDone != nil {
 		al.testDone <- true
 	}
 }
 
+// jobResultWaitGrace is added to a job timeout to wait for its result, to let the client report it.
+var jobResultWaitGrace = time.Minute
+
+// waitForJobResult waits for a next job result. Returns nil if the result didn't come in time or ctx is done.
+func waitForJobResult(ctx context.Context, done chan *models.Job, timeoutSec int) *models.Job {
+	select {
+	case jobResult := <-done:
+		return jobResult
+	case <-ctx.Done():
+		return nil
+	case <-time.After(time.Duration(timeoutSec)*time.Second + jobResultWaitGrace):
+		return nil
+	}
+}
+
+// cancelMultiClientJob kills running jobs of a given multi-client job on their clients and marks them and jobs of given
+// pending clients as canceled once its batch timeout is reached.
+func (al *APIListener) cancelMultiClientJob(job *models.MultiJob, pending []*clients.Client) {
+	errMsg := fmt.Sprintf("batch timeout (%d sec) is reached", job.BatchTimeoutSec)
+	al.Infof("multi_client_id=%q, %s, canceling unfinished jobs", job.JID, errMsg)
+
+	jobs, err := al.jobProvider.GetByMultiJobID(job.JID)
+	if err != nil {
+		al.Errorf("multi_client_id=%q, Failed to get child jobs: %v", job.JID, err)
+	}
+	now := time.Now()
+	for _, cur := range jobs {
+		if cur.Status != models.JobStatusRunning {
+			continue
+		}
+		if cur.PID != nil {
+			al.sendCancelJobRequest(job.JID, cur)
+		}
+		al.dispatchedJobs.Del(cur.JID)
+		cur.Status = models.JobStatusCanceled
+		cur.FinishedAt = &now
+		cur.Error = errMsg
+		if err := al.jobProvider.SaveJob(cur); err != nil {
+			al.Errorf("multi_client_id=%q, client_id=%q, Failed to cancel a child job: %v", job.JID, cur.ClientID, err)
+		}
+	}
+
+	for _, client := range pending {
+		jid, err := generateNewJobID()
+		if err != nil {
+			al.Errorf("multi_client_id=%q, client_id=%q, Could not generate job id: %v", job.JID, client.ID, err)
+			continue
+		}
+		canceled := models.Job{
+			JobSummary: models.JobSummary{
+				JID:        jid,
+				Status:     models.JobStatusCanceled,
+				FinishedAt: &now,
+			},
+			StartedAt:   now,
+			ClientID:    client.ID,
+			ClientName:  client.Name,
+			Command:     job.Command,
+			Cwd:         job.Cwd,
+			IsSudo:      job.IsSudo,
+			IsScript:    job.IsScript,
+			Interpreter: job.Interpreter,
+			CreatedBy:   job.CreatedBy,
+			TimeoutSec:  job.TimeoutSec,
+			MultiJobID:  &job.JID,
+			Error:       errMsg,
+		}
+		if err := al.jobProvider.CreateJob(&canceled); err != nil {
+			al.Errorf("multi_client_id=%q, client_id=%q, Failed to persist a canceled child job: %v", job.JID, client.ID, err)
+		}
+	}
+}
+
+// sendCancelJobRequest asks a client to kill a running command of a child job of a given multi-client job.
+func (al *APIListener) sendCancelJobRequest(multiJobID string, job *models.Job) {
+	client, err := al.clientService.GetActiveByID(job.ClientID)
+	if err != nil {
+		al.Errorf("multi_client_id=%q, client_id=%q, Failed to find an active client: %v", multiJobID, job.ClientID, err)
+		return
+	}
+	if client == nil {
+		al.Debugf("multi_client_id=%q, client_id=%q, Client is not active, its job is not canceled", multiJobID, job.ClientID)
+		return
+	}
+	cancelReq := &comm.CancelJobRequest{
+		JID: job.JID,
+		PID: *job.PID,
+	}
+	if err := comm.SendRequestAndGetResponse(client.Connection, comm.RequestTypeCancelJob, cancelReq, nil); err != nil {
+		al.Errorf("multi_client_id=%q, client_id=%q, Failed to cancel a running child job: %v", multiJobID, job.ClientID, err)
+	}
+}
+
+// finishMultiClientJob saves the finish time of a given multi-client job.
+func (al *APIListener) finishMultiClientJob(job *models.MultiJob) {
+	now := time.Now()
+	job.FinishedAt = &now
+	if err := al.jobProvider.SaveMultiJob(job); err != nil {
+		al.Errorf("multi_client_id=%q, Failed to save a finished multi-client job: %v", job.JID, err)
+	}
+}
+
 func (al *APIListener) createAndRunJob(
 	multiJobID, cmd, interpreter, createdBy, cwd string,
 	timeoutSec int,
-	isSudo, isScript bool,
+	isSudo, isScript, isTemplate bool,
+	params map[string]string,
 	client *clients.Client,
 ) bool {
 	jid, err := generateNewJobID()
@@ -1815,7 +3068,16 @@ func (al *APIListener) createAndRunJob(
 		MultiJobID:  &multiJobID,
 	}
 	sshResp := &comm.RunCmdResponse{}
-	err = comm.SendRequestAndGetResponse(client.Connection, comm.RequestTypeRunCmd, curJob, sshResp)
+	curJob.Command, err = renderCommand(cmd, isTemplate, createdBy, jid, &multiJobID, params, client)
+	if err == nil {
+		err = checkCommandsEnabled(client)
+	}
+	if err == nil {
+		err = checkInterpreterAvailable(client, interpreter)
+	}
+	if err == nil {
+		err = al.sendRunCmdRequest(client.Connection, &curJob, sshResp)
+	}
 	// return an error after saving the job
 	if err != nil {
 		// failure, set fields to mark it as failed
@@ -1857,7 +3119,7 @@ func (al *APIListener) handleCommandsWS(w http.ResponseWriter, req *http.Request
 		return
 	}
 
-	orderedClients, clientsInGroupsCount, err := al.getOrderedClients(ctx, inboundMsg.ClientIDs, inboundMsg.GroupIDs)
+	orderedClients, clientsInGroupsCount, err := al.getOrderedClients(ctx, inboundMsg.ClientIDs, inboundMsg.GroupIDs, inboundMsg.Tags)
 	if err != nil {
 		uiConnTS.WriteError("", err)
 		return
@@ -1894,8 +3156,10 @@ func (al *APIListener) enrichScriptInput(
 
 	inboundMsg.Command = string(decodedScriptBytes)
 	inboundMsg.IsScript = true
+	// scripts are sent as is
+	inboundMsg.IsTemplate = false
 
-	orderedClients, clientsInGroupsCount, err := al.getOrderedClients(ctx, inboundMsg.ClientIDs, inboundMsg.GroupIDs)
+	orderedClients, clientsInGroupsCount, err := al.getOrderedClients(ctx, inboundMsg.ClientIDs, inboundMsg.GroupIDs, inboundMsg.Tags)
 	if err != nil {
 		return 0, err
 	}
@@ -1947,6 +3211,10 @@ func (al *APIListener) handleCommandsExecutionWS(
 		uiConnTS.WriteError("Command cannot be empty.", nil)
 		return
 	}
+	if err := validateCommandTemplate(inboundMsg.Command, inboundMsg.IsTemplate, inboundMsg.Params); err != nil {
+		uiConnTS.WriteError("Invalid command.", err)
+		return
+	}
 	if err := validation.ValidateInterpreter(inboundMsg.Interpreter, inboundMsg.IsScript); err != nil {
 		uiConnTS.WriteError("Invalid interpreter", err)
 		return
@@ -1955,9 +3223,13 @@ func (al *APIListener) handleCommandsExecutionWS(
 	if inboundMsg.TimeoutSec <= 0 {
 		inboundMsg.TimeoutSec = al.config.Server.RunRemoteCmdTimeoutSec
 	}
+	if inboundMsg.BatchTimeoutSec != 0 {
+		uiConnTS.WriteError("Batch timeout is supported only by the REST API.", nil)
+		return
+	}
 
-	if len(inboundMsg.GroupIDs) > 0 && clientsInGroupsCount == 0 && len(inboundMsg.ClientIDs) == 0 {
-		uiConnTS.WriteError("No active clients belong to the selected group(s).", nil)
+	if msg := noSelectedClientsMsg(*inboundMsg, clientsInGroupsCount); msg != "" {
+		uiConnTS.WriteError(msg, nil)
 		return
 	}
 
@@ -2010,7 +3282,16 @@ func (al *APIListener) handleCommandsExecutionWS(
 			AbortOnErr:  abortOnErr,
 			IsSudo:      inboundMsg.IsSudo,
 			IsScript:    inboundMsg.IsScript,
+			IsTemplate:  inboundMsg.IsTemplate,
+			Params:      inboundMsg.Params,
+		}
+		done, err := al.jobsDoneChannel.Add(multiJob.JID, len(inboundMsg.OrderedClients))
+		if err != nil {
+			uiConnTS.WriteError(err.Error(), nil)
+			return
 		}
+		defer al.jobsDoneChannel.Del(multiJob.JID)
+
 		if err := al.jobProvider.SaveMultiJob(multiJob); err != nil {
 			uiConnTS.WriteError("Failed to persist a new multi-client job.", err)
 			return
@@ -2019,17 +3300,6 @@ func (al *APIListener) handleCommandsExecutionWS(
 		al.Debugf("Multi-client Job[id=%q] created to execute remote command on clients %s, groups %s: %q.", multiJob.JID, inboundMsg.ClientIDs, inboundMsg.GroupIDs, inboundMsg.Command)
 		uiConnTS.SetWritesBeforeClose(len(inboundMsg.OrderedClients))
 
-		// for sequential execution - create a channel to get the job result
-		var curJobDoneChannel chan *models.Job
-		if !multiJob.Concurrent {
-			curJobDoneChannel = make(chan *models.Job)
-			al.jobsDoneChannel.Set(multiJob.JID, curJobDoneChannel)
-			defer func() {
-				close(curJobDoneChannel)
-				al.jobsDoneChannel.Del(multiJob.JID)
-			}()
-		}
-
 		for _, client := range inboundMsg.OrderedClients {
 			curJID, err := generateNewJobID()
 			if err != nil {
@@ -2048,6 +3318,8 @@ func (al *APIListener) handleCommandsExecutionWS(
 					multiJob.TimeoutSec,
 					multiJob.IsSudo,
 					multiJob.IsScript,
+					multiJob.IsTemplate,
+					multiJob.Params,
 					client,
 				)
 			} else {
@@ -2062,6 +3334,8 @@ func (al *APIListener) handleCommandsExecutionWS(
 					multiJob.TimeoutSec,
 					multiJob.IsSudo,
 					multiJob.IsScript,
+					multiJob.IsTemplate,
+					multiJob.Params,
 					client,
 				)
 				if !success {
@@ -2072,7 +3346,15 @@ func (al *APIListener) handleCommandsExecutionWS(
 					continue
 				}
 				// wait until command is finished
-				jobResult := <-curJobDoneChannel
+				jobResult := waitForJobResult(context.Background(), done, multiJob.TimeoutSec)
+				if jobResult == nil {
+					al.Errorf("multi_client_id=%q, client_id=%q, Timed out waiting for job result.", multiJob.JID, client.ID)
+					if multiJob.AbortOnErr {
+						uiConnTS.Close()
+						return
+					}
+					continue
+				}
 				if multiJob.AbortOnErr && jobResult.Status == models.JobStatusFailed {
 					uiConnTS.Close()
 					return
@@ -2092,6 +3374,8 @@ func (al *APIListener) handleCommandsExecutionWS(
 			inboundMsg.TimeoutSec,
 			inboundMsg.IsSudo,
 			inboundMsg.IsScript,
+			inboundMsg.IsTemplate,
+			inboundMsg.Params,
 			client,
 		)
 	}
@@ -2116,7 +3400,8 @@ func (al *APIListener) createAndRunJobWS(
 	multiJobID *string,
 	jid, cmd, interpreter, createdBy, cwd string,
 	timeoutSec int,
-	isSudo, isScript bool,
+	isSudo, isScript, isTemplate bool,
+	params map[string]string,
 	client *clients.Client,
 ) bool {
 	curJob := models.Job{
@@ -2139,7 +3424,17 @@ func (al *APIListener) createAndRunJobWS(
 
 	// send the command to the client
 	sshResp := &comm.RunCmdResponse{}
-	err := comm.SendRequestAndGetResponse(client.Connection, comm.RequestTypeRunCmd, curJob, sshResp)
+	var err error
+	curJob.Command, err = renderCommand(cmd, isTemplate, createdBy, jid, multiJobID, params, client)
+	if err == nil {
+		err = checkCommandsEnabled(client)
+	}
+	if err == nil {
+		err = checkInterpreterAvailable(client, interpreter)
+	}
+	if err == nil {
+		err = al.sendRunCmdRequest(client.Connection, &curJob, sshResp)
+	}
 	if err != nil {
 		al.Errorf("%s, Error on execute remote command: %v", logPrefix, err)
 
@@ -2172,6 +3467,86 @@ func (al *APIListener) createAndRunJobWS(
 	return err == nil
 }
 
+// sendRunCmdRequest sends a given job to a client, the job is signed beforehand if command signing is enabled.
+func (al *APIListener) sendRunCmdRequest(conn ssh.Conn, job *models.Job, resp *comm.RunCmdResponse) error {
+	if err := al.prepareJobToSend(job); err != nil {
+		return err
+	}
+	if err := comm.SendRequestAndGetResponse(conn, comm.RequestTypeRunCmd, job, resp); err != nil {
+		return err
+	}
+	al.dispatchedJobs.Add(job.JID)
+	return nil
+}
+
+// commandSignatureTTL is how long clients accept a signed command after it's sent. It tolerates a small clock drift.
+const commandSignatureTTL = 5 * time.Minute
+
+// prepareJobToSend sets the server limits of a job and signs it if command signing is enabled.
+func (al *APIListener) prepareJobToSend(job *models.Job) error {
+	job.MaxResultSize = al.config.Server.MaxJobResultSizeBytes
+	if al.commandSigningKey != nil {
+		if err := job.Sign(al.commandSigningKey, time.Now().Add(commandSignatureTTL)); err != nil {
+			return fmt.Errorf("failed to sign command: %v", err)
+		}
+	}
+	return nil
+}
+
+// checkCommandsEnabled returns an error if a given client reported it doesn't execute commands.
+func checkCommandsEnabled(client *clients.Client) error {
+	if client.CommandsDisabled {
+		return fmt.Errorf("command execution is disabled on client with id=%q", client.ID)
+	}
+	return nil
+}
+
+// checkInterpreterAvailable returns an error if a given client reported a given interpreter is not installed.
+func checkInterpreterAvailable(client *clients.Client, interpreter string) error {
+	if !client.HasInterpreter(interpreter) {
+		return fmt.Errorf("interpreter %q is not available on client with id=%q, available: %q", interpreter, client.ID, client.Interpreters)
+	}
+	return nil
+}
+
+// validateCommandTemplate validates template variables and given param values in commands marked as templates.
+func validateCommandTemplate(cmd string, isTemplate bool, params map[string]string) error {
+	if !isTemplate {
+		if len(params) > 0 {
+			return errors.New("params can be used only in template commands")
+		}
+		return nil
+	}
+	if err := jobs.ValidateParamValues(params); err != nil {
+		return err
+	}
+	return jobs.ValidateCommandTemplateWithParams(cmd, paramNames(params))
+}
+
+// renderCommand substitutes run metadata into a given command if it's marked as a template, otherwise it's sent as is,
+// so commands containing "{{", e.g. docker --format, keep their meaning.
+func renderCommand(cmd string, isTemplate bool, createdBy, jid string, multiJobID *string, params map[string]string, client *clients.Client) (string, error) {
+	if !isTemplate {
+		return cmd, nil
+	}
+	vars := jobs.NewCommandVars(time.Now(), createdBy, jid)
+	if multiJobID != nil {
+		vars.MultiJobID = *multiJobID
+	}
+	vars.Params = params
+	vars.ClientID = client.ID
+	vars.ClientName = client.Name
+	return jobs.RenderCommand(cmd, vars)
+}
+
+func paramNames(params map[string]string) []string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	return names
+}
+
 func (al *APIListener) handleGetMultiClientCommand(w http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	jid := vars[routeParamJobID]
@@ -2194,7 +3569,33 @@ func (al *APIListener) handleGetMultiClientCommand(w http.ResponseWriter, req *h
 }
 
 func (al *APIListener) handleGetMultiClientCommands(w http.ResponseWriter, req *http.Request) {
-	res, err := al.jobProvider.GetAllMultiJobSummaries()
+	// CSV exports are served by the commands export route
+	if format := req.URL.Query().Get("format"); format != "" && format != exportFormatJSON {
+		al.jsonErrorResponseWithErrCode(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Invalid format %q, expected %q or %q.", format, exportFormatJSON, exportFormatCSV))
+		return
+	}
+
+	if _, ok := req.URL.Query()[queryParamSearch]; ok {
+		al.handleSearchCommands(w, req)
+		return
+	}
+
+	filters := query.ExtractFilterOptions(req)
+	if err := query.ValidateFilterOptions(filters, jobs.MultiJobFilters); err != nil {
+		al.jsonError(w, err)
+		return
+	}
+	if err := jobs.ValidateDurationFilters(filters); err != nil {
+		al.jsonError(w, err)
+		return
+	}
+	includeRunning, err := parseIncludeRunning(req)
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	res, err := al.jobProvider.GetAllMultiJobSummaries(jobs.MultiJobSummariesOptions{Filters: filters, IncludeRunning: includeRunning})
 	if err != nil {
 		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, "Failed to get multi-client jobs.", err)
 		return
@@ -2203,6 +3604,122 @@ func (al *APIListener) handleGetMultiClientCommands(w http.ResponseWriter, req *
 	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(res))
 }
 
+const (
+	multiJobsDefaultLimit = 50
+	multiJobsMaxLimit     = 500
+)
+
+type multiJobsListMeta struct {
+	Count int `json:"count"`
+}
+
+// handleListMultiClientCommands returns a page of multi-client jobs with a rollup of their clients' jobs statuses.
+func (al *APIListener) handleListMultiClientCommands(w http.ResponseWriter, req *http.Request) {
+	filters := query.ExtractFilterOptions(req)
+	if err := query.ValidateFilterOptions(filters, jobs.MultiJobStatusFilters); err != nil {
+		al.jsonError(w, err)
+		return
+	}
+	if err := jobs.ValidateDurationFilters(filters); err != nil {
+		al.jsonError(w, err)
+		return
+	}
+	includeRunning, err := parseIncludeRunning(req)
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	pagination, err := query.ExtractPagination(req, multiJobsDefaultLimit, multiJobsMaxLimit)
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	res, total, err := al.jobProvider.ListMultiJobStatusSummaries(jobs.MultiJobSummariesOptions{Filters: filters, IncludeRunning: includeRunning}, pagination)
+	if err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, "Failed to get multi-client jobs.", err)
+		return
+	}
+
+	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayloadWithMeta(res, multiJobsListMeta{Count: total}))
+}
+
+const (
+	queryParamSearch = "search"
+
+	jobsSearchDefaultLimit = 50
+	jobsSearchMaxLimit     = 500
+)
+
+type jobsSearchMeta struct {
+	// Count is a total number of found jobs regardless of pagination
+	Count int `json:"count"`
+}
+
+// handleSearchCommands returns a page of jobs of all clients the current user has access to which command contains a given text.
+func (al *APIListener) handleSearchCommands(w http.ResponseWriter, req *http.Request) {
+	text := req.URL.Query().Get(queryParamSearch)
+	if strings.TrimSpace(text) == "" {
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, fmt.Sprintf("Param %q cannot be empty.", queryParamSearch))
+		return
+	}
+
+	sorts := query.ExtractSortOptions(req)
+	if err := query.ValidateSortOptions(sorts, jobs.SearchSorts); err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	pagination, err := query.ExtractPagination(req, jobsSearchDefaultLimit, jobsSearchMaxLimit)
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	clientIDs, err := al.allowedClientIDs(req)
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	opts := jobs.SearchOptions{
+		Text:       text,
+		ClientIDs:  clientIDs,
+		Sorts:      sorts,
+		Pagination: pagination,
+	}
+	res, total, err := al.jobProvider.SearchByCommand(opts)
+	if err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, "Failed to search jobs.", err)
+		return
+	}
+
+	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayloadWithMeta(res, jobsSearchMeta{Count: total}))
+}
+
+// allowedClientIDs returns ids of clients the current user has access to or nil if the user has access to all of them.
+// Jobs of deleted clients are visible to admins only.
+func (al *APIListener) allowedClientIDs(req *http.Request) ([]string, error) {
+	curUser, err := al.getUserModelForAuth(req.Context())
+	if err != nil {
+		return nil, err
+	}
+	if curUser.IsAdmin() {
+		return nil, nil
+	}
+
+	cls, err := al.clientService.GetUserClients(curUser, nil)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(cls))
+	for _, c := range cls {
+		ids = append(ids, c.ID)
+	}
+	return ids, nil
+}
+
 func (al *APIListener) handlePostClientGroups(w http.ResponseWriter, req *http.Request) {
 	var group cgroups.ClientGroup
 	err := parseRequestBody(req.Body, &group)
@@ -2829,6 +4346,40 @@ func (al *APIListener) handleRefreshUpdatesStatus(w http.ResponseWriter, req *ht
 		return
 	}
 
+	refreshReq := &comm.RefreshUpdatesStatusRequest{}
+	if forceStr := req.URL.Query().Get("force"); forceStr != "" {
+		force, err := strconv.ParseBool(forceStr)
+		if err != nil {
+			al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, fmt.Sprintf("Invalid force param %v.", forceStr))
+			return
+		}
+		refreshReq.Force = force
+	}
+
+	var wait bool
+	if waitStr := req.URL.Query().Get("wait"); waitStr != "" {
+		var err error
+		wait, err = strconv.ParseBool(waitStr)
+		if err != nil {
+			al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, fmt.Sprintf("Invalid wait param %v.", waitStr))
+			return
+		}
+	}
+
+	timeout := defaultUpdatesStatusWaitTimeout * time.Second
+	if timeoutStr := req.URL.Query().Get("timeout_sec"); timeoutStr != "" {
+		timeoutSec, err := strconv.Atoi(timeoutStr)
+		if err != nil || timeoutSec <= 0 {
+			al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, fmt.Sprintf("Invalid timeout_sec param %v.", timeoutStr))
+			return
+		}
+		if timeoutSec > maxUpdatesStatusWaitTimeout {
+			al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, fmt.Sprintf("timeout_sec param can not be greater than %d.", maxUpdatesStatusWaitTimeout))
+			return
+		}
+		timeout = time.Duration(timeoutSec) * time.Second
+	}
+
 	client, err := al.clientService.GetActiveByID(clientID)
 	if err != nil {
 		al.jsonErrorResponse(w, http.StatusInternalServerError, err)
@@ -2839,13 +4390,34 @@ func (al *APIListener) handleRefreshUpdatesStatus(w http.ResponseWriter, req *ht
 		return
 	}
 
-	err = comm.SendRequestAndGetResponse(client.Connection, comm.RequestTypeRefreshUpdatesStatus, nil, nil)
+	if !wait {
+		err = comm.SendRequestAndGetResponse(client.Connection, comm.RequestTypeRefreshUpdatesStatus, refreshReq, nil)
+		if err != nil {
+			al.jsonErrorResponse(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// subscribe before sending the request to not miss a fast response
+	statusChan := al.updatesStatusChans.Add(clientID)
+	defer al.updatesStatusChans.Del(clientID, statusChan)
+
+	err = comm.SendRequestAndGetResponse(client.Connection, comm.RequestTypeRefreshUpdatesStatus, refreshReq, nil)
 	if err != nil {
 		al.jsonErrorResponse(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	select {
+	case status := <-statusChan:
+		al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(status))
+	case <-time.After(timeout):
+		al.jsonErrorResponseWithTitle(w, http.StatusGatewayTimeout, fmt.Sprintf("client did not return updates status within %v", timeout))
+	case <-req.Context().Done():
+	}
 }
 
 func (al *APIListener) handlePostMultiClientScript(w http.ResponseWriter, req *http.Request) {
@@ -2863,8 +4435,13 @@ func (al *APIListener) handlePostMultiClientScript(w http.ResponseWriter, req *h
 		return
 	}
 
-	if len(inboundMsg.GroupIDs) > 0 && clientsInGroupsCount == 0 && len(inboundMsg.ClientIDs) == 0 {
-		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, "No active clients belong to the selected group(s).")
+	if inboundMsg.BatchTimeoutSec < 0 {
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, "Batch timeout cannot be negative.")
+		return
+	}
+
+	if msg := noSelectedClientsMsg(*inboundMsg, clientsInGroupsCount); msg != "" {
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, msg)
 		return
 	}
 
@@ -2904,17 +4481,25 @@ func (al *APIListener) handlePostMultiClientScript(w http.ResponseWriter, req *h
 			StartedAt: time.Now(),
 			CreatedBy: curUser.Username,
 		},
-		ClientIDs:   inboundMsg.ClientIDs,
-		GroupIDs:    inboundMsg.GroupIDs,
-		Command:     inboundMsg.Command,
-		Interpreter: inboundMsg.Interpreter,
-		Cwd:         inboundMsg.Cwd,
-		IsSudo:      inboundMsg.IsSudo,
-		TimeoutSec:  inboundMsg.TimeoutSec,
-		Concurrent:  inboundMsg.ExecuteConcurrently,
-		AbortOnErr:  abortOnErr,
+		ClientIDs:       inboundMsg.ClientIDs,
+		GroupIDs:        inboundMsg.GroupIDs,
+		Command:         inboundMsg.Command,
+		Interpreter:     inboundMsg.Interpreter,
+		Cwd:             inboundMsg.Cwd,
+		IsSudo:          inboundMsg.IsSudo,
+		IsTemplate:      inboundMsg.IsTemplate,
+		TimeoutSec:      inboundMsg.TimeoutSec,
+		Concurrent:      inboundMsg.ExecuteConcurrently,
+		AbortOnErr:      abortOnErr,
+		BatchTimeoutSec: inboundMsg.BatchTimeoutSec,
+	}
+	done, err := al.jobsDoneChannel.Add(multiJob.JID, len(inboundMsg.OrderedClients))
+	if err != nil {
+		al.jsonErrorResponseWithTitle(w, http.StatusTooManyRequests, err.Error())
+		return
 	}
 	if err := al.jobProvider.SaveMultiJob(multiJob); err != nil {
+		al.jobsDoneChannel.Del(multiJob.JID)
 		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, "Failed to persist a new multi-client job.", err)
 		return
 	}
@@ -2926,7 +4511,7 @@ func (al *APIListener) handlePostMultiClientScript(w http.ResponseWriter, req *h
 
 	al.Debugf("Multi-client Job[id=%q] created to execute remote command on clients %s, groups %s: %q.", multiJob.JID, inboundMsg.ClientIDs, inboundMsg.GroupIDs, inboundMsg.Command)
 
-	go al.executeMultiClientJob(multiJob, inboundMsg.OrderedClients)
+	go al.executeMultiClientJob(multiJob, inboundMsg.OrderedClients, done)
 }
 
 type postTokenResponse struct {
@@ -23,13 +23,16 @@ var supportedSortAndFilters = map[string]bool{
 
 var supportedFields = map[string]map[string]bool{
 	"commands": map[string]bool{
-		"id":         true,
-		"name":       true,
-		"created_by": true,
-		"created_at": true,
-		"updated_by": true,
-		"updated_at": true,
-		"cmd":        true,
+		"id":          true,
+		"name":        true,
+		"created_by":  true,
+		"created_at":  true,
+		"updated_by":  true,
+		"updated_at":  true,
+		"cmd":         true,
+		"interpreter": true,
+		"timeout_sec": true,
+		"params":      true,
 	},
 }
 
@@ -82,6 +85,11 @@ func (m *Manager) GetOne(ctx context.Context, re *http.Request, id string) (*Com
 	return val, true, nil
 }
 
+// GetByID returns a command with all its fields, it's used to execute library commands.
+func (m *Manager) GetByID(ctx context.Context, id string) (*Command, bool, error) {
+	return m.db.GetByID(ctx, id, &query.RetrieveOptions{})
+}
+
 func (m *Manager) Create(ctx context.Context, valueToStore *InputCommand, username string) (*Command, error) {
 	err := Validate(valueToStore)
 	if err != nil {
@@ -108,12 +116,15 @@ func (m *Manager) Create(ctx context.Context, valueToStore *InputCommand, userna
 
 	now := time.Now()
 	commandToSave := &Command{
-		Name:      valueToStore.Name,
-		CreatedBy: username,
-		CreatedAt: &now,
-		UpdatedBy: username,
-		UpdatedAt: &now,
-		Cmd:       valueToStore.Cmd,
+		Name:        valueToStore.Name,
+		CreatedBy:   username,
+		CreatedAt:   &now,
+		UpdatedBy:   username,
+		UpdatedAt:   &now,
+		Cmd:         valueToStore.Cmd,
+		Interpreter: valueToStore.Interpreter,
+		TimeoutSec:  valueToStore.TimeoutSec,
+		Params:      valueToStore.Params,
 	}
 	commandToSave.ID, err = m.db.Save(ctx, commandToSave)
 	if err != nil {
@@ -162,13 +173,16 @@ func (m *Manager) Update(ctx context.Context, existingID string, valueToStore *I
 
 	now := time.Now()
 	commandToSave := &Command{
-		ID:        existingID,
-		Name:      valueToStore.Name,
-		CreatedBy: existing.CreatedBy,
-		CreatedAt: existing.CreatedAt,
-		UpdatedBy: username,
-		UpdatedAt: &now,
-		Cmd:       valueToStore.Cmd,
+		ID:          existingID,
+		Name:        valueToStore.Name,
+		CreatedBy:   existing.CreatedBy,
+		CreatedAt:   existing.CreatedAt,
+		UpdatedBy:   username,
+		UpdatedAt:   &now,
+		Cmd:         valueToStore.Cmd,
+		Interpreter: valueToStore.Interpreter,
+		TimeoutSec:  valueToStore.TimeoutSec,
+		Params:      valueToStore.Params,
 	}
 	_, err = m.db.Save(ctx, commandToSave)
 	if err != nil {
@@ -1,6 +1,12 @@
 package command
 
-import "time"
+import (
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
 
 // To support sparse fieldsets, the fields that can have zero value,
 // use pointers so they're omitted only when they're nil not when they're zero value
@@ -12,9 +18,74 @@ type Command struct {
 	UpdatedBy string     `json:"updated_by,omitempty" db:"updated_by"`
 	UpdatedAt *time.Time `json:"updated_at,omitempty" db:"updated_at"`
 	Cmd       string     `json:"cmd,omitempty" db:"cmd"`
+	// Interpreter and TimeoutSec are defaults used to execute the command, empty to use defaults of the client and server
+	Interpreter string `json:"interpreter,omitempty" db:"interpreter"`
+	TimeoutSec  int    `json:"timeout_sec,omitempty" db:"timeout_sec"`
+	// Params are names of parameters the command template uses as {{.Params.<name>}}, values are given on execution
+	Params Params `json:"params,omitempty" db:"params"`
 }
 
 type InputCommand struct {
-	Name string `json:"name" db:"name"`
-	Cmd  string `json:"cmd" db:"script"`
+	Name        string   `json:"name" db:"name"`
+	Cmd         string   `json:"cmd" db:"script"`
+	Interpreter string   `json:"interpreter"`
+	TimeoutSec  int      `json:"timeout_sec"`
+	Params      []string `json:"params"`
+}
+
+const paramsSeparator = ","
+
+// Params are names of command parameters stored as a comma separated list.
+type Params []string
+
+func (p *Params) Scan(value interface{}) error {
+	if p == nil {
+		return fmt.Errorf("'params' cannot be nil")
+	}
+	str, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("expected to have string, got %T", value)
+	}
+	if str == "" {
+		*p = nil
+		return nil
+	}
+	*p = strings.Split(str, paramsSeparator)
+	return nil
+}
+
+func (p Params) Value() (driver.Value, error) {
+	return strings.Join(p, paramsSeparator), nil
+}
+
+// ValidateParamValues returns an error if given param values miss any of the command params or have unknown ones.
+func (c *Command) ValidateParamValues(values map[string]string) error {
+	declared := make(map[string]bool, len(c.Params))
+	var missing []string
+	for _, name := range c.Params {
+		declared[name] = true
+		if _, ok := values[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	var unknown []string
+	for name := range values {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(unknown)
+
+	var msgs []string
+	if len(missing) > 0 {
+		msgs = append(msgs, fmt.Sprintf("missing params: %s", strings.Join(missing, ", ")))
+	}
+	if len(unknown) > 0 {
+		msgs = append(msgs, fmt.Sprintf("unknown params: %s", strings.Join(unknown, ", ")))
+	}
+	if len(msgs) > 0 {
+		return fmt.Errorf("%s", strings.Join(msgs, "; "))
+	}
+	return nil
 }
@@ -73,7 +73,7 @@ func (p *SqliteProvider) Save(ctx context.Context, s *Command) (string, error) {
 
 		_, err = p.db.ExecContext(
 			ctx,
-			"INSERT INTO `commands` (`id`, `name`, `created_at`, `created_by`, `updated_at`, `updated_by`, `cmd`) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			"INSERT INTO `commands` (`id`, `name`, `created_at`, `created_by`, `updated_at`, `updated_by`, `cmd`, `interpreter`, `timeout_sec`, `params`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
 			commandID,
 			s.Name,
 			s.CreatedAt.Format(time.RFC3339),
@@ -81,17 +81,23 @@ func (p *SqliteProvider) Save(ctx context.Context, s *Command) (string, error) {
 			s.UpdatedAt.Format(time.RFC3339),
 			s.UpdatedBy,
 			s.Cmd,
+			s.Interpreter,
+			s.TimeoutSec,
+			s.Params,
 		)
 
 		return commandID, err
 	}
 
-	q := "UPDATE `commands` SET `name` = ?, `updated_at` = ?, `updated_by` = ?, `cmd` = ? WHERE id = ?"
+	q := "UPDATE `commands` SET `name` = ?, `updated_at` = ?, `updated_by` = ?, `cmd` = ?, `interpreter` = ?, `timeout_sec` = ?, `params` = ? WHERE id = ?"
 	params := []interface{}{
 		s.Name,
 		s.UpdatedAt.Format(time.RFC3339),
 		s.UpdatedBy,
 		s.Cmd,
+		s.Interpreter,
+		s.TimeoutSec,
+		s.Params,
 		s.ID,
 	}
 	_, err := p.db.ExecContext(ctx, q, params...)
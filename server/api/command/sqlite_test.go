@@ -239,7 +239,10 @@ func TestUpdate(t *testing.T) {
 	require.NoError(t, err)
 
 	itemToSave := demoData[0]
-	itemToSave.Cmd = "awk"
+	itemToSave.Cmd = "awk {{.Params.script}} {{.Params.file}}"
+	itemToSave.Interpreter = "powershell"
+	itemToSave.TimeoutSec = 90
+	itemToSave.Params = Params{"script", "file"}
 
 	id, err := dbProv.Save(ctx, &itemToSave)
 	require.NoError(t, err)
@@ -247,17 +250,25 @@ func TestUpdate(t *testing.T) {
 
 	expectedRows := []map[string]interface{}{
 		{
-			"id":         "1",
-			"name":       itemToSave.Name,
-			"created_at": *itemToSave.CreatedAt,
-			"created_by": itemToSave.CreatedBy,
-			"updated_at": *itemToSave.UpdatedAt,
-			"updated_by": itemToSave.UpdatedBy,
-			"cmd":        itemToSave.Cmd,
+			"id":          "1",
+			"name":        itemToSave.Name,
+			"created_at":  *itemToSave.CreatedAt,
+			"created_by":  itemToSave.CreatedBy,
+			"updated_at":  *itemToSave.UpdatedAt,
+			"updated_by":  itemToSave.UpdatedBy,
+			"cmd":         itemToSave.Cmd,
+			"interpreter": "powershell",
+			"timeout_sec": int64(90),
+			"params":      "script,file",
 		},
 	}
 	q := "SELECT * FROM `commands` where id = ?"
 	test.AssertRowsEqual(t, dbProv.db, expectedRows, q, []interface{}{id})
+
+	actual, found, err := dbProv.GetByID(ctx, id, &query.RetrieveOptions{})
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, itemToSave, *actual)
 }
 
 func TestDelete(t *testing.T) {
@@ -279,13 +290,16 @@ func TestDelete(t *testing.T) {
 
 	expectedRows := []map[string]interface{}{
 		{
-			"id":         "1",
-			"name":       demoData[0].Name,
-			"created_at": *demoData[0].CreatedAt,
-			"created_by": demoData[0].CreatedBy,
-			"updated_at": *demoData[0].UpdatedAt,
-			"updated_by": demoData[0].UpdatedBy,
-			"cmd":        demoData[0].Cmd,
+			"id":          "1",
+			"name":        demoData[0].Name,
+			"created_at":  *demoData[0].CreatedAt,
+			"created_by":  demoData[0].CreatedBy,
+			"updated_at":  *demoData[0].UpdatedAt,
+			"updated_by":  demoData[0].UpdatedBy,
+			"cmd":         demoData[0].Cmd,
+			"interpreter": "",
+			"timeout_sec": int64(0),
+			"params":      "",
 		},
 	}
 	q := "SELECT * FROM `commands`"
@@ -1,11 +1,17 @@
 package command
 
 import (
+	"fmt"
 	"net/http"
+	"regexp"
 
 	errors2 "github.com/cloudradar-monitoring/rport/server/api/errors"
+	"github.com/cloudradar-monitoring/rport/server/api/jobs"
+	"github.com/cloudradar-monitoring/rport/server/validation"
 )
 
+var paramNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 func Validate(iv *InputCommand) error {
 	errs := errors2.APIErrors{}
 
@@ -21,6 +27,34 @@ func Validate(iv *InputCommand) error {
 			HTTPStatus: http.StatusBadRequest,
 		})
 	}
+	if err := validateParams(iv.Params); err != nil {
+		errs = append(errs, errors2.APIError{
+			Message:    "invalid params",
+			Err:        err,
+			HTTPStatus: http.StatusBadRequest,
+		})
+	} else if iv.Cmd != "" {
+		if err := jobs.ValidateCommandTemplateWithParams(iv.Cmd, iv.Params); err != nil {
+			errs = append(errs, errors2.APIError{
+				Message:    "invalid cmd",
+				Err:        err,
+				HTTPStatus: http.StatusBadRequest,
+			})
+		}
+	}
+	if err := validation.ValidateInterpreter(iv.Interpreter, false); err != nil {
+		errs = append(errs, errors2.APIError{
+			Message:    "invalid interpreter",
+			Err:        err,
+			HTTPStatus: http.StatusBadRequest,
+		})
+	}
+	if iv.TimeoutSec < 0 {
+		errs = append(errs, errors2.APIError{
+			Message:    "timeout_sec cannot be negative",
+			HTTPStatus: http.StatusBadRequest,
+		})
+	}
 
 	if len(errs) == 0 {
 		return nil
@@ -28,3 +62,18 @@ func Validate(iv *InputCommand) error {
 
 	return errs
 }
+
+// validateParams returns an error if any of given parameter names can't be used in a command template or is duplicated.
+func validateParams(params []string) error {
+	seen := make(map[string]bool, len(params))
+	for _, name := range params {
+		if !paramNameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid param name %q, expected letters, digits and underscores not starting with a digit", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("duplicate param name %q", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
@@ -35,6 +35,49 @@ func TestValidate(t *testing.T) {
 				Cmd:  "val1",
 			},
 			expectedError: "",
+		}, {
+			name: "template with params",
+			input: &InputCommand{
+				Name:        "some name",
+				Cmd:         "tail -n {{.Params.lines}} /var/log/{{.ClientName}}.log",
+				Interpreter: "powershell",
+				TimeoutSec:  30,
+				Params:      []string{"lines"},
+			},
+			expectedError: "",
+		}, {
+			name: "undeclared param",
+			input: &InputCommand{
+				Name:   "some name",
+				Cmd:    "tail -n {{.Params.lines}} {{.Params.path}}",
+				Params: []string{"lines"},
+			},
+			expectedError: `failed to render command template: template: command:1:35: executing "command" at <.Params.path>: map has no entry for key "path"`,
+		}, {
+			name: "invalid template",
+			input: &InputCommand{
+				Name: "some name",
+				Cmd:  "tail {{.Unknown",
+			},
+			expectedError: "invalid command template: template: command:1: unclosed action",
+		}, {
+			name: "invalid params, interpreter and timeout",
+			input: &InputCommand{
+				Name:        "some name",
+				Cmd:         "tail {{.Params.path}}",
+				Interpreter: "tacoscript",
+				TimeoutSec:  -1,
+				Params:      []string{"path", "1path", "path"},
+			},
+			expectedError: `invalid param name "1path", expected letters, digits and underscores not starting with a digit, tacoscript interpreter can't be used for commands execution, timeout_sec cannot be negative`,
+		}, {
+			name: "duplicate param",
+			input: &InputCommand{
+				Name:   "some name",
+				Cmd:    "tail {{.Params.path}}",
+				Params: []string{"path", "path"},
+			},
+			expectedError: `duplicate param name "path"`,
 		},
 	}
 
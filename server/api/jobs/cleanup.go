@@ -0,0 +1,37 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	chshare "github.com/cloudradar-monitoring/rport/share"
+)
+
+type CleanupTask struct {
+	log      *chshare.Logger
+	provider *SQLProvider
+	keepJobs time.Duration
+}
+
+// NewCleanupTask returns a task to delete jobs that finished longer than a given duration ago.
+func NewCleanupTask(log *chshare.Logger, provider *SQLProvider, keepJobs time.Duration) *CleanupTask {
+	return &CleanupTask{
+		log:      log,
+		provider: provider,
+		keepJobs: keepJobs,
+	}
+}
+
+func (t *CleanupTask) Run(ctx context.Context) error {
+	deleted, err := t.provider.DeleteFinishedBefore(time.Now().Add(-t.keepJobs))
+	if err != nil {
+		return fmt.Errorf("failed to delete old jobs: %v", err)
+	}
+
+	if deleted > 0 {
+		t.log.Debugf("Deleted %d old job(s).", deleted)
+	}
+
+	return nil
+}
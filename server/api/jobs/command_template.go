@@ -0,0 +1,90 @@
+package jobs
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// CommandVars are server-provided variables that can be used in a command, e.g. "echo {{.JobID}} {{.Operator}}".
+type CommandVars struct {
+	// Now is the time the command is dispatched in RFC3339 format, UTC
+	Now string
+	// Operator is the username of a user who issued the command
+	Operator   string
+	JobID      string
+	MultiJobID string
+	ClientID   string
+	ClientName string
+	// Params are values of command parameters given by a user, e.g. "echo {{.Params.path}}"
+	Params map[string]string
+}
+
+func NewCommandVars(now time.Time, operator, jid string) *CommandVars {
+	return &CommandVars{
+		Now:      now.UTC().Format(time.RFC3339),
+		Operator: operator,
+		JobID:    jid,
+	}
+}
+
+// RenderCommand substitutes given variables into a given command. Commands without template actions are returned as is.
+func RenderCommand(cmd string, vars *CommandVars) (string, error) {
+	if !strings.Contains(cmd, "{{") {
+		return cmd, nil
+	}
+
+	tmpl, err := template.New("command").Option("missingkey=error").Parse(cmd)
+	if err != nil {
+		return "", fmt.Errorf("invalid command template: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("failed to render command template: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// ValidateCommandTemplate returns an error if a given command contains invalid template actions or unknown variables.
+func ValidateCommandTemplate(cmd string) error {
+	return ValidateCommandTemplateWithParams(cmd, nil)
+}
+
+// ValidateCommandTemplateWithParams returns an error if a given command contains invalid template actions,
+// unknown variables or parameters that are not in a given list.
+func ValidateCommandTemplateWithParams(cmd string, params []string) error {
+	vars := &CommandVars{}
+	if len(params) > 0 {
+		vars.Params = make(map[string]string, len(params))
+		for _, name := range params {
+			vars.Params[name] = ""
+		}
+	}
+	_, err := RenderCommand(cmd, vars)
+	return err
+}
+
+// paramValueRegexp matches values that have no special meaning in shells, so they can be substituted into commands
+// without quoting.
+var paramValueRegexp = regexp.MustCompile(`^[A-Za-z0-9_@+=:,./-]*$`)
+
+// ValidateParamValues returns an error if any of given param values contains characters that are not allowed,
+// so params can't inject other commands.
+func ValidateParamValues(params map[string]string) error {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !paramValueRegexp.MatchString(params[name]) {
+			return fmt.Errorf("invalid value of param %q, only letters, digits and _@+=:,./- are allowed", name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderCommand(t *testing.T) {
+	now := time.Date(2021, 5, 10, 14, 30, 0, 0, time.FixedZone("CEST", 2*60*60))
+	vars := NewCommandVars(now, "admin", "jid-1234")
+	vars.MultiJobID = "multi-jid-1234"
+	vars.ClientID = "cid-1234"
+	vars.ClientName = "client-1"
+
+	testCases := []struct {
+		name    string
+		cmd     string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "no template",
+			cmd:  "/bin/date;foo;whoami",
+			want: "/bin/date;foo;whoami",
+		},
+		{
+			name: "run metadata",
+			cmd:  "echo {{.Now}} {{.Operator}} {{.JobID}}",
+			want: "echo 2021-05-10T12:30:00Z admin jid-1234",
+		},
+		{
+			name: "client fields",
+			cmd:  "echo {{.MultiJobID}} {{.ClientID}} {{.ClientName}}",
+			want: "echo multi-jid-1234 cid-1234 client-1",
+		},
+		{
+			name:    "unknown variable",
+			cmd:     "echo {{.Unknown}}",
+			wantErr: "failed to render command template",
+		},
+		{
+			name:    "invalid template",
+			cmd:     "echo {{.JobID",
+			wantErr: "invalid command template",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := RenderCommand(tc.cmd, vars)
+
+			if tc.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.wantErr)
+				assert.Error(t, ValidateCommandTemplate(tc.cmd))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+			assert.NoError(t, ValidateCommandTemplate(tc.cmd))
+		})
+	}
+}
+
+func TestRenderCommandWithParams(t *testing.T) {
+	vars := NewCommandVars(time.Now(), "admin", "jid-1234")
+	vars.ClientName = "client-1"
+	vars.Params = map[string]string{"path": "/var/log", "lines": "10"}
+
+	got, err := RenderCommand("tail -n {{.Params.lines}} {{.Params.path}}/{{.ClientName}}.log", vars)
+	require.NoError(t, err)
+	assert.Equal(t, "tail -n 10 /var/log/client-1.log", got)
+
+	_, err = RenderCommand("tail {{.Params.unknown}}", vars)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `map has no entry for key "unknown"`)
+}
+
+func TestValidateCommandTemplateWithParams(t *testing.T) {
+	testCases := []struct {
+		name    string
+		cmd     string
+		params  []string
+		wantErr bool
+	}{
+		{
+			name:   "declared params",
+			cmd:    "tail -n {{.Params.lines}} {{.Params.path}} {{.ClientID}}",
+			params: []string{"lines", "path"},
+		},
+		{
+			name:   "unused params",
+			cmd:    "/bin/date",
+			params: []string{"lines"},
+		},
+		{
+			name:    "undeclared param",
+			cmd:     "tail -n {{.Params.lines}} {{.Params.path}}",
+			params:  []string{"lines"},
+			wantErr: true,
+		},
+		{
+			name:    "no params declared",
+			cmd:     "tail {{.Params.path}}",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateCommandTemplateWithParams(tc.cmd, tc.params)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateParamValues(t *testing.T) {
+	testCases := []struct {
+		name    string
+		params  map[string]string
+		wantErr string
+	}{
+		{
+			name: "no params",
+		},
+		{
+			name:   "valid values",
+			params: map[string]string{"path": "/var/log/syslog", "lines": "10", "user": "admin@example.com", "opt": "--level=info,debug", "empty": ""},
+		},
+		{
+			name:    "command separator",
+			params:  map[string]string{"path": "syslog; rm -rf /"},
+			wantErr: `invalid value of param "path", only letters, digits and _@+=:,./- are allowed`,
+		},
+		{
+			name:    "command substitution",
+			params:  map[string]string{"path": "$(whoami)"},
+			wantErr: `invalid value of param "path", only letters, digits and _@+=:,./- are allowed`,
+		},
+		{
+			name:    "quotes",
+			params:  map[string]string{"path": `"a"`},
+			wantErr: `invalid value of param "path", only letters, digits and _@+=:,./- are allowed`,
+		},
+		{
+			name:    "windows env variable",
+			params:  map[string]string{"path": "%PATH%"},
+			wantErr: `invalid value of param "path", only letters, digits and _@+=:,./- are allowed`,
+		},
+		{
+			name:    "first invalid param by name",
+			params:  map[string]string{"b": "`id`", "a": "a b"},
+			wantErr: `invalid value of param "a", only letters, digits and _@+=:,./- are allowed`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateParamValues(tc.params)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package jobs
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	errors2 "github.com/cloudradar-monitoring/rport/server/api/errors"
+
+	"github.com/cloudradar-monitoring/rport/share/query"
+)
+
+const durationColumn = "duration"
+
+// SupportedFilters are fields job lists can be filtered by.
+var SupportedFilters = map[string]bool{
+	"interpreter": true,
+}
+
+// MultiJobFilters are fields multi-client job lists can be filtered by, duration is given in seconds.
+var MultiJobFilters = map[string]bool{
+	"interpreter":  true,
+	"duration[gt]": true,
+	"duration[lt]": true,
+}
+
+// SummariesFilters are fields job summaries of a client can be filtered by, duration is given in seconds.
+var SummariesFilters = map[string]bool{
+	"interpreter":  true,
+	"duration[gt]": true,
+	"duration[lt]": true,
+}
+
+// SummariesSorts are fields job summaries of a client can be sorted by.
+var SummariesSorts = map[string]bool{
+	durationColumn: true,
+}
+
+// SearchSorts are fields found jobs of all clients can be sorted by.
+var SearchSorts = map[string]bool{
+	"started_at":  true,
+	"finished_at": true,
+}
+
+// ValidateDurationFilters returns an error if values of duration filters are not numbers of seconds.
+func ValidateDurationFilters(filters []query.FilterOption) error {
+	for _, f := range filters {
+		if f.Column != durationColumn {
+			continue
+		}
+		for _, v := range f.Values {
+			if _, err := strconv.ParseFloat(v, 64); err != nil {
+				return errors2.APIError{
+					Message:    fmt.Sprintf("invalid duration filter value %q, expected a number of seconds", v),
+					HTTPStatus: http.StatusBadRequest,
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// addFilters appends conditions of given filters to a given query that already has a WHERE clause.
+// Values of the same filter are OR-ed, different filters are AND-ed. Filters are expected to be validated.
+func addFilters(q string, params []interface{}, filters []query.FilterOption) (string, []interface{}) {
+	return addSupportedFilters(q, params, filters, SupportedFilters)
+}
+
+// addSupportedFilters is the same as addFilters, but only given supported filters are applied.
+func addSupportedFilters(q string, params []interface{}, filters []query.FilterOption, supported map[string]bool) (string, []interface{}) {
+	for _, f := range filters {
+		if !supported[f.Column] || len(f.Values) == 0 {
+			continue
+		}
+		orParts := make([]string, 0, len(f.Values))
+		for _, v := range f.Values {
+			orParts = append(orParts, fmt.Sprintf("%s = ?", f.Column))
+			params = append(params, v)
+		}
+		q += fmt.Sprintf(" AND (%s)", strings.Join(orParts, " OR "))
+	}
+	return q, params
+}
+
+// addDurationFilters appends conditions of duration filters to a given query that already has a WHERE clause.
+// durationExpr is an expression of a job duration in seconds. Filters are expected to be validated.
+func addDurationFilters(q string, params []interface{}, filters []query.FilterOption, durationExpr string) (string, []interface{}) {
+	for _, f := range filters {
+		if f.Column != durationColumn || len(f.Values) == 0 {
+			continue
+		}
+		op := ">"
+		if f.Operator == query.FilterOperatorLessThan {
+			op = "<"
+		}
+		orParts := make([]string, 0, len(f.Values))
+		for _, v := range f.Values {
+			seconds, _ := strconv.ParseFloat(v, 64)
+			orParts = append(orParts, fmt.Sprintf("%s %s ?", durationExpr, op))
+			params = append(params, seconds)
+		}
+		q += fmt.Sprintf(" AND (%s)", strings.Join(orParts, " OR "))
+	}
+	return q, params
+}
+
+// hasDuration returns true if given filters or sorts use a job duration.
+func hasDuration(filters []query.FilterOption, sorts []query.SortOption) bool {
+	for _, f := range filters {
+		if f.Column == durationColumn {
+			return true
+		}
+	}
+	for _, s := range sorts {
+		if s.Column == durationColumn {
+			return true
+		}
+	}
+	return false
+}
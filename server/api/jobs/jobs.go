@@ -6,66 +6,428 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
-	"github.com/mattn/go-sqlite3"
 
 	"github.com/cloudradar-monitoring/rport/db/migration/jobs"
+	"github.com/cloudradar-monitoring/rport/db/migration/jobs_postgres"
+	"github.com/cloudradar-monitoring/rport/db/postgres"
 	"github.com/cloudradar-monitoring/rport/db/sqlite"
 	chshare "github.com/cloudradar-monitoring/rport/share"
 	"github.com/cloudradar-monitoring/rport/share/models"
+	"github.com/cloudradar-monitoring/rport/share/query"
 )
 
-type SqliteProvider struct {
+const (
+	DBDriverSqlite   = "sqlite"
+	DBDriverPostgres = "postgres"
+)
+
+// SQLProvider stores jobs in a SQL DB. Queries are written with "?" placeholders and rebound to a DB driver,
+// so the same provider works with both sqlite and PostgreSQL.
+type SQLProvider struct {
 	log *chshare.Logger
 	db  *sqlx.DB
+	// results is set when job results are stored on disk instead of the DB
+	results *fileResultStore
+	// nodeID identifies a server that saves jobs, so it fails only its own running jobs in a shared DB
+	nodeID string
 }
 
-func NewSqliteProvider(dbPath string, log *chshare.Logger) (*SqliteProvider, error) {
+func NewSqliteProvider(dbPath string, log *chshare.Logger) (*SQLProvider, error) {
 	db, err := sqlite.New(dbPath, jobs.AssetNames(), jobs.Asset)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create jobs DB instance: %v", err)
 	}
-	return &SqliteProvider{db: db, log: log}, nil
+	return newSQLProvider(db, log)
+}
+
+// NewPostgresProvider returns a provider that stores jobs in a PostgreSQL DB with a given DSN, so several servers can share them.
+func NewPostgresProvider(dsn string, log *chshare.Logger) (*SQLProvider, error) {
+	db, err := postgres.New(dsn, jobs_postgres.AssetNames(), jobs_postgres.Asset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create jobs DB instance: %v", err)
+	}
+	return newSQLProvider(db, log)
+}
+
+func newSQLProvider(db *sqlx.DB, log *chshare.Logger) (*SQLProvider, error) {
+	p := &SQLProvider{db: db, log: log}
+	if err := p.fillCommands(); err != nil {
+		return nil, fmt.Errorf("failed to fill commands of existing jobs: %v", err)
+	}
+	return p, nil
+}
+
+// durationExpr returns an expression of a job duration in seconds, running jobs last until now.
+func (p *SQLProvider) durationExpr() string {
+	if p.db.DriverName() == "sqlite3" {
+		return "((JULIANDAY(COALESCE(finished_at, 'now')) - JULIANDAY(started_at)) * 86400)"
+	}
+	return "EXTRACT(EPOCH FROM (COALESCE(finished_at, NOW()) - started_at))"
+}
+
+// timeExpr returns an expression to compare a given time column or placeholder by. sqlite stores times as text
+// in different formats, so they are normalized, while PostgreSQL compares timestamps natively.
+func (p *SQLProvider) timeExpr(expr string) string {
+	if p.db.DriverName() == "sqlite3" {
+		return "DATETIME(" + expr + ")"
+	}
+	return expr
+}
+
+// fillCommands sets the command column of jobs that were created before it was added.
+func (p *SQLProvider) fillCommands() error {
+	var res []*jobSqlite
+	err := p.db.Select(&res, "SELECT * FROM jobs WHERE command IS NULL")
+	if err != nil {
+		return err
+	}
+	for _, cur := range res {
+		if _, err := p.db.Exec(p.db.Rebind("UPDATE jobs SET command=? WHERE jid=?"), cur.Details.Command, cur.JID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewSqliteProviderWithResultsDir returns a provider that stores job results in a given dir, while the DB keeps only a reference to a file.
+func NewSqliteProviderWithResultsDir(dbPath, resultsDir string, log *chshare.Logger) (*SQLProvider, error) {
+	p, err := NewSqliteProvider(dbPath, log)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.WithResultsDir(resultsDir); err != nil {
+		p.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// WithNodeID makes a given provider save jobs with a given server node id. FailRunning fails only jobs of this node.
+func (p *SQLProvider) WithNodeID(nodeID string) {
+	p.nodeID = nodeID
+}
+
+// WithResultsDir makes a given provider store job results in a given dir, while the DB keeps only a reference to a file.
+func (p *SQLProvider) WithResultsDir(resultsDir string) error {
+	results, err := newFileResultStore(resultsDir)
+	if err != nil {
+		return err
+	}
+	p.results = results
+	return nil
 }
 
-func (p *SqliteProvider) GetByJID(clientID, jid string) (*models.Job, error) {
+func (p *SQLProvider) GetByJID(clientID, jid string) (*models.Job, error) {
 	res := &jobSqlite{}
-	err := p.db.Get(res, "SELECT * FROM jobs WHERE jid=?", jid)
+	err := p.db.Get(res, p.db.Rebind("SELECT * FROM jobs WHERE jid=?"), jid)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
 		return nil, err
 	}
+	if err := p.loadResult(res); err != nil {
+		return nil, err
+	}
 	return res.convert(), nil
 }
 
+// RawResult is a JSON encoded job result as it's stored.
+type RawResult struct {
+	Data    []byte
+	Gzipped bool
+	// Payload is true if the result is wrapped into an API success payload
+	Payload bool
+	// Checksum is a checksum of the result computed when it was stored, empty for results stored by older versions
+	Checksum string
+}
+
+// JSON returns a decompressed JSON encoded job result unwrapped from a payload.
+func (r *RawResult) JSON() ([]byte, error) {
+	b := r.Data
+	if r.Gzipped {
+		var err error
+		if b, err = gunzip(r.Data); err != nil {
+			return nil, fmt.Errorf("failed to decompress job result: %v", err)
+		}
+	}
+	if !r.Payload {
+		return b, nil
+	}
+	payload := struct {
+		Data json.RawMessage `json:"data"`
+	}{}
+	if err := json.Unmarshal(b, &payload); err != nil {
+		return nil, fmt.Errorf("failed to decode job result payload: %v", err)
+	}
+	return payload.Data, nil
+}
+
+// Verify returns an error if the result doesn't match the checksum computed when it was stored.
+// Results stored without a checksum are not verified.
+func (r *RawResult) Verify() error {
+	if r.Checksum == "" {
+		return nil
+	}
+	b, err := r.JSON()
+	if err != nil {
+		return err
+	}
+	res := &models.JobResult{}
+	if err := json.Unmarshal(b, res); err != nil {
+		return fmt.Errorf("failed to decode job result: %v", err)
+	}
+	if got := res.Checksum(); got != r.Checksum {
+		return fmt.Errorf("job result checksum mismatch: stored %s, actual %s", r.Checksum, got)
+	}
+	return nil
+}
+
+// GetRawResult returns a result of a given job without decoding it. If results are stored on disk gzip compressed,
+// the compressed bytes are returned as is. Returns nil if the job is not found or doesn't have a result yet.
+func (p *SQLProvider) GetRawResult(clientID, jid string) (*RawResult, error) {
+	res := &jobSqlite{}
+	err := p.db.Get(res, p.db.Rebind("SELECT * FROM jobs WHERE jid=? AND client_id=?"), jid, clientID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if res.Details.ResultFile != "" {
+		if p.results == nil {
+			return nil, fmt.Errorf("result of job %s is stored in a file, but job results dir is not configured", jid)
+		}
+		raw, err := p.results.LoadRaw(res.Details.ResultFile)
+		if err != nil {
+			return nil, err
+		}
+		raw.Checksum = res.Details.ResultChecksum
+		return raw, nil
+	}
+	if res.Details.Result == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(res.Details.Result)
+	if err != nil {
+		return nil, err
+	}
+	return &RawResult{Data: data, Checksum: res.Details.ResultChecksum}, nil
+}
+
 // GetByMultiJobID returns a list of all jobs that belongs to a multi-client job with a given ID sorted by started_at(desc), jid order.
-func (p *SqliteProvider) GetByMultiJobID(jid string) ([]*models.Job, error) {
+func (p *SQLProvider) GetByMultiJobID(jid string) ([]*models.Job, error) {
 	var res []*jobSqlite
-	err := p.db.Select(&res, "SELECT * FROM jobs WHERE multi_job_id=? ORDER BY DATETIME(started_at) DESC, jid", jid)
+	err := p.db.Select(&res, p.db.Rebind("SELECT * FROM jobs WHERE multi_job_id=? ORDER BY "+p.timeExpr("started_at")+" DESC, jid"), jid)
 	if err != nil {
 		return nil, err
 	}
+	for _, cur := range res {
+		if err := p.loadResult(cur); err != nil {
+			return nil, err
+		}
+	}
 	return convertJobs(res), nil
 }
 
-func (p *SqliteProvider) GetSummariesByClientID(clientID string) ([]*models.JobSummary, error) {
+// SummariesOptions are options to list job summaries of a client.
+type SummariesOptions struct {
+	Filters []query.FilterOption
+	// Sorts are applied by the DB, job summaries are returned in no particular order if empty
+	Sorts []query.SortOption
+	// IncludeRunning makes duration filters and sorts treat running jobs as ongoing with a duration until now,
+	// otherwise running jobs are excluded if a duration is used
+	IncludeRunning bool
+}
+
+// GetSummariesByClientID returns summaries of all jobs of a given client that match given filters.
+func (p *SQLProvider) GetSummariesByClientID(clientID string, opts SummariesOptions) ([]*models.JobSummary, error) {
 	var res []*jobSummarySqlite
-	err := p.db.Select(&res, "SELECT jid, finished_at, status FROM jobs WHERE client_id=?", clientID)
+	q, params := addFilters("SELECT jid, finished_at, status FROM jobs WHERE client_id=?", []interface{}{clientID}, opts.Filters)
+	q, params = addDurationFilters(q, params, opts.Filters, p.durationExpr())
+	if !opts.IncludeRunning && hasDuration(opts.Filters, opts.Sorts) {
+		q += " AND finished_at IS NOT NULL"
+	}
+	if len(opts.Sorts) > 0 {
+		orderBy := make([]string, 0, len(opts.Sorts)+1)
+		for _, sort := range opts.Sorts {
+			col := sort.Column
+			if col == durationColumn {
+				col = p.durationExpr()
+			}
+			direction := "ASC"
+			if !sort.IsASC {
+				direction = "DESC"
+			}
+			orderBy = append(orderBy, col+" "+direction)
+		}
+		q += " ORDER BY " + strings.Join(append(orderBy, "jid"), ", ")
+	}
+	err := p.db.Select(&res, p.db.Rebind(q), params...)
 	if err != nil {
 		return nil, err
 	}
 	return convertJSs(res), nil
 }
 
+// SearchOptions are options to search jobs of all clients by a command text.
+type SearchOptions struct {
+	// Text is a case-insensitive substring of a job command, all jobs match if empty
+	Text string
+	// Filters are applied the same way as to job lists, see SupportedFilters
+	Filters []query.FilterOption
+	// ClientIDs limits results to jobs of given clients, jobs of all clients are searched if nil
+	ClientIDs []string
+	// Sorts are applied in a given order, started_at(desc) by default
+	Sorts []query.SortOption
+	// Pagination limits results if set
+	Pagination *query.Pagination
+}
+
+// SearchByCommand returns a page of summaries of jobs of all clients which command contains a given text sorted by
+// given sorts, started_at(desc) by default. It also returns a total number of matching jobs.
+func (p *SQLProvider) SearchByCommand(opts SearchOptions) ([]*models.ClientJobSummary, int, error) {
+	if opts.ClientIDs != nil && len(opts.ClientIDs) == 0 {
+		return []*models.ClientJobSummary{}, 0, nil
+	}
+
+	q, params := p.clientJobsQuery(opts)
+
+	var total int
+	if err := p.db.Get(&total, p.db.Rebind("SELECT COUNT(*) FROM ("+q+") AS filtered"), params...); err != nil {
+		return nil, 0, err
+	}
+
+	var res []*clientJobSummarySqlite
+	q, params = p.orderAndLimit(q, params, opts)
+	if err := p.db.Select(&res, p.db.Rebind(q), params...); err != nil {
+		return nil, 0, err
+	}
+
+	list := make([]*models.ClientJobSummary, 0, len(res))
+	for _, cur := range res {
+		list = append(list, cur.convert())
+	}
+	return list, total, nil
+}
+
+// ForEachClientJob calls a given func for summaries of jobs of all clients that match given options one by one,
+// rows are read from the DB as they are consumed, so any number of jobs can be exported. It stops on the first error.
+func (p *SQLProvider) ForEachClientJob(opts SearchOptions, fn func(*models.ClientJobSummary) error) error {
+	if opts.ClientIDs != nil && len(opts.ClientIDs) == 0 {
+		return nil
+	}
+
+	q, params := p.clientJobsQuery(opts)
+	q, params = p.orderAndLimit(q, params, opts)
+	rows, err := p.db.Queryx(p.db.Rebind(q), params...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		res := &clientJobSummarySqlite{}
+		if err := rows.StructScan(res); err != nil {
+			return err
+		}
+		if err := fn(res.convert()); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// clientJobsQuery returns an unordered query of summaries of jobs of all clients that match given options.
+func (p *SQLProvider) clientJobsQuery(opts SearchOptions) (string, []interface{}) {
+	q := "SELECT jid, status, finished_at, client_id, started_at, command, interpreter, created_by FROM jobs WHERE 1=1"
+	var params []interface{}
+	if opts.Text != "" {
+		q += ` AND LOWER(command) LIKE LOWER(?) ESCAPE '\'`
+		params = append(params, "%"+escapeLike(opts.Text)+"%")
+	}
+	if opts.ClientIDs != nil {
+		q += " AND client_id IN (?" + strings.Repeat(", ?", len(opts.ClientIDs)-1) + ")"
+		for _, id := range opts.ClientIDs {
+			params = append(params, id)
+		}
+	}
+	return addFilters(q, params, opts.Filters)
+}
+
+// orderAndLimit appends ORDER BY of given sorts, started_at(desc) by default, and a given pagination to a given query.
+func (p *SQLProvider) orderAndLimit(q string, params []interface{}, opts SearchOptions) (string, []interface{}) {
+	sorts := opts.Sorts
+	if len(sorts) == 0 {
+		sorts = []query.SortOption{{Column: "started_at"}}
+	}
+	orderBy := make([]string, 0, len(sorts)+1)
+	for _, sort := range sorts {
+		direction := "ASC"
+		if !sort.IsASC {
+			direction = "DESC"
+		}
+		if sort.Column == "finished_at" {
+			// the same as SortByFinishedAt: running jobs go first in desc order and last in asc order
+			orderBy = append(orderBy, "(finished_at IS NULL) "+direction)
+		}
+		orderBy = append(orderBy, p.timeExpr(sort.Column)+" "+direction)
+	}
+	q += " ORDER BY " + strings.Join(append(orderBy, "jid"), ", ")
+
+	if opts.Pagination != nil {
+		q += " LIMIT ? OFFSET ?"
+		params = append(params, opts.Pagination.Limit, opts.Pagination.Offset)
+	}
+	return q, params
+}
+
+// escapeLike escapes wildcards of a LIKE pattern with a backslash.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+// GetLastFinishedByCommand returns the latest finished job of a given client that ran a given command and started
+// before a given time. Returns nil if there is no such job.
+func (p *SQLProvider) GetLastFinishedByCommand(clientID, command string, startedBefore time.Time) (*models.Job, error) {
+	// ordered by finished_at to walk idx_jobs_client_id_time from the latest job of the client
+	res := &jobSqlite{}
+	err := p.db.Get(
+		res,
+		p.db.Rebind("SELECT * FROM jobs WHERE client_id=? AND command=? AND finished_at IS NOT NULL AND "+
+			p.timeExpr("started_at")+" < "+p.timeExpr("?")+" ORDER BY finished_at DESC LIMIT 1"),
+		clientID,
+		command,
+		startedBefore,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if err := p.loadResult(res); err != nil {
+		return nil, err
+	}
+	return res.convert(), nil
+}
+
 // SaveJob creates a new or updates an existing job.
-func (p *SqliteProvider) SaveJob(job *models.Job) error {
-	_, err := p.db.NamedExec(`INSERT OR REPLACE INTO jobs (jid, status, started_at, finished_at, created_by, client_id, multi_job_id, details)
-														VALUES (:jid, :status, :started_at, :finished_at, :created_by, :client_id, :multi_job_id, :details)`,
-		convertToSqlite(job))
+func (p *SQLProvider) SaveJob(job *models.Job) error {
+	res, err := p.toSqlite(job)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.NamedExec(`INSERT INTO jobs (jid, status, started_at, finished_at, created_by, client_id, multi_job_id, interpreter, command, node_id, details)
+											VALUES (:jid, :status, :started_at, :finished_at, :created_by, :client_id, :multi_job_id, :interpreter, :command, :node_id, :details)
+											ON CONFLICT (jid) DO UPDATE SET status=excluded.status, started_at=excluded.started_at,
+											finished_at=excluded.finished_at, created_by=excluded.created_by, client_id=excluded.client_id,
+											multi_job_id=excluded.multi_job_id, interpreter=excluded.interpreter, command=excluded.command, node_id=excluded.node_id, details=excluded.details`,
+		res)
 	if err == nil {
 		p.log.Debugf("Job saved successfully: %v", *job)
 	}
@@ -73,34 +435,154 @@ func (p *SqliteProvider) SaveJob(job *models.Job) error {
 }
 
 // CreateJob creates a new job. If already exists with the same ID - does nothing and returns nil.
-func (p *SqliteProvider) CreateJob(job *models.Job) error {
-	_, err := p.db.NamedExec(`INSERT INTO jobs (jid, status, started_at, finished_at, created_by, client_id, multi_job_id, details)
-											VALUES (:jid, :status, :started_at, :finished_at, :created_by, :client_id, :multi_job_id, :details)`,
-		convertToSqlite(job))
-	if err != nil {
-		// check if it's "already exist" err
-		typeErr, ok := err.(sqlite3.Error)
-		if ok && typeErr.Code == sqlite3.ErrConstraint {
-			p.log.Debugf("Job already exist with ID: %s", job.JID)
-			return nil
-		}
-	} else {
-		p.log.Debugf("Job saved successfully: %v", *job)
+func (p *SQLProvider) CreateJob(job *models.Job) error {
+	res, err := p.toSqlite(job)
+	if err != nil {
+		return err
 	}
-	return err
+	result, err := p.db.NamedExec(`INSERT INTO jobs (jid, status, started_at, finished_at, created_by, client_id, multi_job_id, interpreter, command, node_id, details)
+											VALUES (:jid, :status, :started_at, :finished_at, :created_by, :client_id, :multi_job_id, :interpreter, :command, :node_id, :details)
+											ON CONFLICT (jid) DO NOTHING`,
+		res)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		p.log.Debugf("Job already exist with ID: %s", job.JID)
+		return nil
+	}
+	p.log.Debugf("Job saved successfully: %v", *job)
+	return nil
+}
+
+// DeleteFinishedBefore deletes all jobs that finished before a given time together with their stored results.
+// Returns a number of deleted jobs.
+func (p *SQLProvider) DeleteFinishedBefore(before time.Time) (int, error) {
+	var res []*jobSqlite
+	cond := "finished_at IS NOT NULL AND " + p.timeExpr("finished_at") + " < " + p.timeExpr("?")
+	err := p.db.Select(&res, p.db.Rebind("SELECT * FROM jobs WHERE "+cond), before)
+	if err != nil {
+		return 0, err
+	}
+	if len(res) == 0 {
+		return 0, nil
+	}
+
+	_, err = p.db.Exec(p.db.Rebind("DELETE FROM jobs WHERE "+cond), before)
+	if err != nil {
+		return 0, err
+	}
+
+	if p.results != nil {
+		for _, cur := range res {
+			if cur.Details.ResultFile == "" {
+				continue
+			}
+			if err := p.results.Delete(cur.Details.ResultFile); err != nil {
+				p.log.Errorf("Failed to delete result of job %s: %v", cur.JID, err)
+			}
+		}
+	}
+	return len(res), nil
+}
+
+// CountByStatus returns a number of jobs per job status.
+func (p *SQLProvider) CountByStatus() (map[string]int, error) {
+	var res []struct {
+		Status string `db:"status"`
+		Count  int    `db:"count"`
+	}
+	err := p.db.Select(&res, "SELECT status, COUNT(*) AS count FROM jobs GROUP BY status")
+	if err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int, len(res))
+	for _, cur := range res {
+		counts[cur.Status] = cur.Count
+	}
+	return counts, nil
+}
+
+// FailRunning marks all running jobs saved by this node as failed with a given error. Jobs saved before node ids
+// were stored are failed too. Returns a number of updated jobs.
+func (p *SQLProvider) FailRunning(errMsg string, finishedAt time.Time) (int, error) {
+	var res []*jobSqlite
+	err := p.db.Select(&res, p.db.Rebind("SELECT * FROM jobs WHERE status=? AND (node_id=? OR node_id IS NULL)"), models.JobStatusRunning, p.nodeID)
+	if err != nil {
+		return 0, err
+	}
+	for _, cur := range res {
+		if err := p.loadResult(cur); err != nil {
+			return 0, err
+		}
+		job := cur.convert()
+		job.Status = models.JobStatusFailed
+		job.Error = errMsg
+		job.FinishedAt = &finishedAt
+		if err := p.SaveJob(job); err != nil {
+			return 0, err
+		}
+	}
+	return len(res), nil
 }
 
-func (p *SqliteProvider) Close() error {
+func (p *SQLProvider) Close() error {
 	return p.db.Close()
 }
 
+// toSqlite converts a given job to a DB model. If results are stored on disk, the job result is written to a file.
+// A checksum of the job result is set to the given job.
+func (p *SQLProvider) toSqlite(job *models.Job) (*jobSqlite, error) {
+	if job.Result != nil {
+		job.ResultChecksum = job.Result.Checksum()
+	}
+	res := convertToSqlite(job)
+	res.NodeID = sql.NullString{String: p.nodeID, Valid: true}
+	if p.results == nil || job.Result == nil {
+		return res, nil
+	}
+	name, err := p.results.Save(job.JID, job.Result)
+	if err != nil {
+		return nil, err
+	}
+	res.Details.Result = nil
+	res.Details.ResultFile = name
+	return res, nil
+}
+
+// loadResult reads a job result from disk, if it was stored there.
+func (p *SQLProvider) loadResult(job *jobSqlite) error {
+	if job.Details.ResultFile == "" {
+		return nil
+	}
+	if p.results == nil {
+		return fmt.Errorf("result of job %s is stored in a file, but job results dir is not configured", job.JID)
+	}
+	result, err := p.results.Load(job.Details.ResultFile)
+	if err != nil {
+		return err
+	}
+	job.Details.Result = result
+	return nil
+}
+
 type jobSqlite struct {
 	jobSummarySqlite
 	StartedAt  time.Time      `db:"started_at"`
 	CreatedBy  string         `db:"created_by"`
 	ClientID   string         `db:"client_id"`
 	MultiJobID sql.NullString `db:"multi_job_id"`
-	Details    *jobDetails    `db:"details"`
+	// Interpreter duplicates the one from details to be able to filter by it
+	Interpreter sql.NullString `db:"interpreter"`
+	// Command duplicates the one from details to be able to search by it
+	Command sql.NullString `db:"command"`
+	// NodeID is an id of a server that saved the job
+	NodeID  sql.NullString `db:"node_id"`
+	Details *jobDetails    `db:"details"`
 }
 
 type jobSummarySqlite struct {
@@ -115,11 +597,17 @@ type jobDetails struct {
 	IsSudo      bool              `json:"is_sudo"`
 	IsScript    bool              `json:"is_script"`
 	Interpreter string            `json:"interpreter"`
+	Umask       string            `json:"umask,omitempty"`
 	PID         *int              `json:"pid"`
 	TimeoutSec  int               `json:"timeout_sec"`
 	Error       string            `json:"error"`
 	Result      *models.JobResult `json:"result"`
+	ResultFile  string            `json:"result_file,omitempty"` // set instead of Result when results are stored on disk
 	ClientName  string            `json:"client_name"`
+	// ResultChecksum is computed when the result is stored to detect its corruption
+	ResultChecksum string `json:"result_checksum,omitempty"`
+
+	ExecutionMetadata *models.ExecutionMetadata `json:"execution_metadata,omitempty"`
 }
 
 func (d *jobDetails) Scan(value interface{}) error {
@@ -159,6 +647,26 @@ func (js *jobSummarySqlite) convert() *models.JobSummary {
 	return res
 }
 
+type clientJobSummarySqlite struct {
+	jobSummarySqlite
+	ClientID    string         `db:"client_id"`
+	StartedAt   time.Time      `db:"started_at"`
+	Command     sql.NullString `db:"command"`
+	Interpreter sql.NullString `db:"interpreter"`
+	CreatedBy   string         `db:"created_by"`
+}
+
+func (js *clientJobSummarySqlite) convert() *models.ClientJobSummary {
+	return &models.ClientJobSummary{
+		JobSummary:  *js.jobSummarySqlite.convert(),
+		ClientID:    js.ClientID,
+		StartedAt:   js.StartedAt,
+		Command:     js.Command.String,
+		Interpreter: js.Interpreter.String,
+		CreatedBy:   js.CreatedBy,
+	}
+}
+
 func convertJSs(list []*jobSummarySqlite) []*models.JobSummary {
 	res := make([]*models.JobSummary, 0, len(list))
 	for _, cur := range list {
@@ -184,6 +692,10 @@ func (j *jobSqlite) convert() *models.Job {
 		Cwd:         j.Details.Cwd,
 		IsSudo:      j.Details.IsSudo,
 		IsScript:    j.Details.IsScript,
+		Umask:       j.Details.Umask,
+
+		ExecutionMetadata: j.Details.ExecutionMetadata,
+		ResultChecksum:    j.Details.ResultChecksum,
 	}
 	if j.MultiJobID.Valid {
 		res.MultiJobID = &j.MultiJobID.String
@@ -205,9 +717,11 @@ func convertToSqlite(job *models.Job) *jobSqlite {
 			JID:    job.JID,
 			Status: job.Status,
 		},
-		StartedAt: job.StartedAt,
-		CreatedBy: job.CreatedBy,
-		ClientID:  job.ClientID,
+		StartedAt:   job.StartedAt,
+		CreatedBy:   job.CreatedBy,
+		ClientID:    job.ClientID,
+		Interpreter: sql.NullString{String: job.Interpreter, Valid: true},
+		Command:     sql.NullString{String: job.Command, Valid: true},
 		Details: &jobDetails{
 			Command:     job.Command,
 			Interpreter: job.Interpreter,
@@ -219,6 +733,10 @@ func convertToSqlite(job *models.Job) *jobSqlite {
 			Cwd:         job.Cwd,
 			IsSudo:      job.IsSudo,
 			IsScript:    job.IsScript,
+			Umask:       job.Umask,
+
+			ExecutionMetadata: job.ExecutionMetadata,
+			ResultChecksum:    job.ResultChecksum,
 		},
 	}
 	if job.MultiJobID != nil {
@@ -1,7 +1,14 @@
 package jobs
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -9,9 +16,12 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/cloudradar-monitoring/rport/db/migration/jobs"
+	"github.com/cloudradar-monitoring/rport/db/sqlite"
 	"github.com/cloudradar-monitoring/rport/server/test/jb"
 	chshare "github.com/cloudradar-monitoring/rport/share"
 	"github.com/cloudradar-monitoring/rport/share/models"
+	"github.com/cloudradar-monitoring/rport/share/query"
 )
 
 var testLog = chshare.NewLogger("api-listener-test", chshare.LogOutput{File: os.Stdout}, chshare.LogLevelDebug)
@@ -23,7 +33,7 @@ func TestJobsSqliteProvider(t *testing.T) {
 
 	// add jobs
 	job1 := jb.New(t).Status(models.JobStatusRunning).Result(nil).IsSudo().Build()
-	job2 := jb.New(t).ClientID(job1.ClientID).Cwd("/root").Build()
+	job2 := jb.New(t).ClientID(job1.ClientID).Cwd("/root").Umask("0027").Build()
 	job3 := jb.New(t).Build() // different client ID
 	require.NoError(t, p.SaveJob(job1))
 	require.NoError(t, p.SaveJob(job2))
@@ -51,16 +61,16 @@ func TestJobsSqliteProvider(t *testing.T) {
 	require.Nil(t, gotJob4)
 
 	// verify job summaries
-	gotJSc1, err := p.GetSummariesByClientID(job1.ClientID)
+	gotJSc1, err := p.GetSummariesByClientID(job1.ClientID, SummariesOptions{})
 	require.NoError(t, err)
 	assert.ElementsMatch(t, []*models.JobSummary{&job1.JobSummary, &job2.JobSummary}, gotJSc1)
 
-	gotJSc2, err := p.GetSummariesByClientID(job3.ClientID)
+	gotJSc2, err := p.GetSummariesByClientID(job3.ClientID, SummariesOptions{})
 	require.NoError(t, err)
 	assert.ElementsMatch(t, []*models.JobSummary{&job3.JobSummary}, gotJSc2)
 
 	// verify job summaries not found
-	gotJSc3, err := p.GetSummariesByClientID("unknown-cid")
+	gotJSc3, err := p.GetSummariesByClientID("unknown-cid", SummariesOptions{})
 	require.NoError(t, err)
 	require.Empty(t, gotJSc3)
 
@@ -79,7 +89,7 @@ func TestJobsSqliteProvider(t *testing.T) {
 	require.NotNil(t, gotJob1)
 	assert.Equal(t, job1, gotJob1)
 
-	gotJSc1, err = p.GetSummariesByClientID(job1.ClientID)
+	gotJSc1, err = p.GetSummariesByClientID(job1.ClientID, SummariesOptions{})
 	require.NoError(t, err)
 	assert.ElementsMatch(t, []*models.JobSummary{&job1.JobSummary, &job2.JobSummary}, gotJSc1)
 }
@@ -129,3 +139,716 @@ func TestCreateJob(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, job, gotJob)
 }
+
+func TestJobResultsStoredOnDisk(t *testing.T) {
+	dir, err := ioutil.TempDir("", "job-results")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	p, err := NewSqliteProviderWithResultsDir(":memory:", dir, testLog)
+	require.NoError(t, err)
+	defer p.Close()
+
+	largeResult := &models.JobResult{
+		StdOut: strings.Repeat("some std out\n", 100000),
+		StdErr: "some std err",
+	}
+	job := jb.New(t).Result(largeResult).Build()
+	require.NoError(t, p.SaveJob(job))
+
+	// verify the result is not stored in the DB
+	var details string
+	require.NoError(t, p.db.Get(&details, "SELECT details FROM jobs WHERE jid=?", job.JID))
+	assert.NotContains(t, details, "some std out")
+	assert.FileExists(t, filepath.Join(dir, job.JID+payloadExt))
+
+	gotJob, err := p.GetByJID(job.ClientID, job.JID)
+	require.NoError(t, err)
+	assert.Equal(t, job, gotJob)
+}
+
+func TestJobResultChecksum(t *testing.T) {
+	result := &models.JobResult{StdOut: "some std out", StdErr: "some std err"}
+	wantChecksum := result.Checksum()
+
+	testCases := []struct {
+		name   string
+		onDisk bool
+		// corrupt changes a stored result of a given job
+		corrupt func(t *testing.T, p *SQLProvider, dir string, job *models.Job)
+	}{
+		{
+			name: "stored in DB",
+			corrupt: func(t *testing.T, p *SQLProvider, dir string, job *models.Job) {
+				var details string
+				require.NoError(t, p.db.Get(&details, "SELECT details FROM jobs WHERE jid=?", job.JID))
+				details = strings.Replace(details, "some std out", "some std 0ut", 1)
+				_, err := p.db.Exec("UPDATE jobs SET details=? WHERE jid=?", details, job.JID)
+				require.NoError(t, err)
+			},
+		},
+		{
+			name:   "stored on disk",
+			onDisk: true,
+			corrupt: func(t *testing.T, p *SQLProvider, dir string, job *models.Job) {
+				_, err := p.results.Save(job.JID, &models.JobResult{StdOut: "some std 0ut", StdErr: "some std err"})
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			p, err := NewSqliteProvider(":memory:", testLog)
+			require.NoError(t, err)
+			defer p.Close()
+			if tc.onDisk {
+				require.NoError(t, p.WithResultsDir(dir))
+			}
+
+			job := jb.New(t).Result(result).Build()
+			require.NoError(t, p.SaveJob(job))
+
+			// checksum is computed and stored
+			assert.Equal(t, wantChecksum, job.ResultChecksum)
+			var details string
+			require.NoError(t, p.db.Get(&details, "SELECT details FROM jobs WHERE jid=?", job.JID))
+			assert.Contains(t, details, `"result_checksum":"`+wantChecksum+`"`)
+			gotJob, err := p.GetByJID(job.ClientID, job.JID)
+			require.NoError(t, err)
+			assert.Equal(t, wantChecksum, gotJob.ResultChecksum)
+
+			raw, err := p.GetRawResult(job.ClientID, job.JID)
+			require.NoError(t, err)
+			assert.Equal(t, wantChecksum, raw.Checksum)
+			assert.NoError(t, raw.Verify())
+
+			// when
+			tc.corrupt(t, p, dir, job)
+
+			// then
+			raw, err = p.GetRawResult(job.ClientID, job.JID)
+			require.NoError(t, err)
+			err = raw.Verify()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "job result checksum mismatch: stored "+wantChecksum)
+		})
+	}
+}
+
+func TestVerifyRawResultWithoutChecksum(t *testing.T) {
+	// results stored by older versions don't have a checksum
+	raw := &RawResult{Data: []byte(`{"stdout":"out","stderr":""}`)}
+
+	assert.NoError(t, raw.Verify())
+}
+
+func TestRawResultJSON(t *testing.T) {
+	wantJSON := `{"stdout":"out","stderr":""}`
+	testCases := []struct {
+		name string
+		raw  *RawResult
+	}{
+		{
+			name: "plain",
+			raw:  &RawResult{Data: []byte(wantJSON)},
+		},
+		{
+			name: "gzipped",
+			raw:  &RawResult{Data: gzipped(t, wantJSON), Gzipped: true},
+		},
+		{
+			name: "gzipped payload",
+			raw:  &RawResult{Data: gzipped(t, `{"data":`+wantJSON+`}`), Gzipped: true, Payload: true},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.raw.JSON()
+
+			require.NoError(t, err)
+			assert.JSONEq(t, wantJSON, string(got))
+		})
+	}
+}
+
+func TestLoadLegacyResultFile(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newFileResultStore(dir)
+	require.NoError(t, err)
+	// results stored by older versions are not wrapped into a payload
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "job-1.json.gz"), gzipped(t, `{"stdout":"out","stderr":"err"}`), 0600))
+
+	got, err := s.Load("job-1.json.gz")
+
+	require.NoError(t, err)
+	assert.Equal(t, &models.JobResult{StdOut: "out", StdErr: "err"}, got)
+}
+
+func gzipped(t *testing.T, s string) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, err := zw.Write([]byte(s))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	return buf.Bytes()
+}
+
+func TestDeleteFinishedBefore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "job-results")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	p, err := NewSqliteProviderWithResultsDir(":memory:", dir, testLog)
+	require.NoError(t, err)
+	defer p.Close()
+
+	now := time.Date(2020, 11, 5, 12, 0, 0, 0, time.UTC)
+	oldJob := jb.New(t).FinishedAt(now.Add(-2 * time.Hour)).Build()
+	newJob := jb.New(t).FinishedAt(now.Add(-time.Minute)).Build()
+	runningJob := jb.New(t).Status(models.JobStatusRunning).Result(nil).Build()
+	runningJob.FinishedAt = nil
+	require.NoError(t, p.SaveJob(oldJob))
+	require.NoError(t, p.SaveJob(newJob))
+	require.NoError(t, p.SaveJob(runningJob))
+	oldJobFile := filepath.Join(dir, oldJob.JID+payloadExt)
+	require.FileExists(t, oldJobFile)
+
+	deleted, err := p.DeleteFinishedBefore(now.Add(-time.Hour))
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, deleted)
+	gotJob, err := p.GetByJID(oldJob.ClientID, oldJob.JID)
+	require.NoError(t, err)
+	assert.Nil(t, gotJob)
+	_, err = os.Stat(oldJobFile)
+	assert.True(t, os.IsNotExist(err))
+
+	gotJob, err = p.GetByJID(newJob.ClientID, newJob.JID)
+	require.NoError(t, err)
+	assert.Equal(t, newJob, gotJob)
+	assert.FileExists(t, filepath.Join(dir, newJob.JID+payloadExt))
+
+	gotJob, err = p.GetByJID(runningJob.ClientID, runningJob.JID)
+	require.NoError(t, err)
+	assert.Equal(t, runningJob, gotJob)
+}
+
+func TestGetLastFinishedByCommand(t *testing.T) {
+	p, err := NewSqliteProvider(":memory:", testLog)
+	require.NoError(t, err)
+	defer p.Close()
+
+	cid := "client-1"
+	now := time.Date(2020, 11, 5, 12, 0, 0, 0, time.UTC)
+	oldJob := jb.New(t).ClientID(cid).Command("cat /etc/hosts").StartedAt(now.Add(-2 * time.Hour)).FinishedAt(now.Add(-2 * time.Hour)).Build()
+	lastJob := jb.New(t).ClientID(cid).Command("cat /etc/hosts").StartedAt(now.Add(-time.Hour)).FinishedAt(now.Add(-time.Hour)).Build()
+	otherCmdJob := jb.New(t).ClientID(cid).Command("date").StartedAt(now.Add(-30 * time.Minute)).FinishedAt(now.Add(-30 * time.Minute)).Build()
+	runningJob := jb.New(t).ClientID(cid).Command("cat /etc/hosts").StartedAt(now.Add(-10 * time.Minute)).Status(models.JobStatusRunning).Build()
+	otherClientJob := jb.New(t).Command("cat /etc/hosts").StartedAt(now.Add(-10 * time.Minute)).FinishedAt(now.Add(-10 * time.Minute)).Build()
+	for _, j := range []*models.Job{oldJob, lastJob, otherCmdJob, runningJob, otherClientJob} {
+		require.NoError(t, p.SaveJob(j))
+	}
+
+	testCases := []struct {
+		name          string
+		command       string
+		startedBefore time.Time
+		want          *models.Job
+	}{
+		{
+			name:          "latest job with the same command",
+			command:       "cat /etc/hosts",
+			startedBefore: now,
+			want:          lastJob,
+		},
+		{
+			name:          "started before a given time",
+			command:       "cat /etc/hosts",
+			startedBefore: now.Add(-time.Hour),
+			want:          oldJob,
+		},
+		{
+			name:          "no previous job",
+			command:       "cat /etc/hosts",
+			startedBefore: now.Add(-2 * time.Hour),
+		},
+		{
+			name:          "unknown command",
+			command:       "uptime",
+			startedBefore: now,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := p.GetLastFinishedByCommand(cid, tc.command, tc.startedBefore)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestCountByStatus(t *testing.T) {
+	p, err := NewSqliteProvider(":memory:", testLog)
+	require.NoError(t, err)
+	defer p.Close()
+
+	gotCounts, err := p.CountByStatus()
+	require.NoError(t, err)
+	assert.Empty(t, gotCounts)
+
+	require.NoError(t, p.SaveJob(jb.New(t).Status(models.JobStatusSuccessful).Build()))
+	require.NoError(t, p.SaveJob(jb.New(t).Status(models.JobStatusSuccessful).Build()))
+	require.NoError(t, p.SaveJob(jb.New(t).Status(models.JobStatusFailed).Build()))
+
+	gotCounts, err = p.CountByStatus()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{
+		models.JobStatusSuccessful: 2,
+		models.JobStatusFailed:     1,
+	}, gotCounts)
+}
+
+func TestFailRunning(t *testing.T) {
+	p, err := NewSqliteProvider(":memory:", testLog)
+	require.NoError(t, err)
+	defer p.Close()
+
+	running := jb.New(t).JID("running-1").Status(models.JobStatusRunning).Build()
+	successful := jb.New(t).JID("successful-1").Status(models.JobStatusSuccessful).Build()
+	require.NoError(t, p.SaveJob(running))
+	require.NoError(t, p.SaveJob(successful))
+	finishedAt := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	n, err := p.FailRunning("server shutting down", finishedAt)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	got, err := p.GetByJID(running.ClientID, running.JID)
+	require.NoError(t, err)
+	running.Status = models.JobStatusFailed
+	running.Error = "server shutting down"
+	running.FinishedAt = &finishedAt
+	assert.Equal(t, running, got)
+
+	got, err = p.GetByJID(successful.ClientID, successful.JID)
+	require.NoError(t, err)
+	assert.Equal(t, successful, got)
+}
+
+func TestFailRunningOnlyOfNode(t *testing.T) {
+	// two servers sharing one DB
+	dbPath := filepath.Join(t.TempDir(), "jobs.db")
+	p1, err := NewSqliteProvider(dbPath, testLog)
+	require.NoError(t, err)
+	defer p1.Close()
+	p1.WithNodeID("node-1")
+	p2, err := NewSqliteProvider(dbPath, testLog)
+	require.NoError(t, err)
+	defer p2.Close()
+	p2.WithNodeID("node-2")
+
+	running1 := jb.New(t).JID("running-1").Status(models.JobStatusRunning).Build()
+	running2 := jb.New(t).JID("running-2").Status(models.JobStatusRunning).Build()
+	legacy := jb.New(t).JID("legacy-1").Status(models.JobStatusRunning).Build()
+	require.NoError(t, p1.SaveJob(running1))
+	require.NoError(t, p2.SaveJob(running2))
+	require.NoError(t, p2.SaveJob(legacy))
+	_, err = p2.db.Exec("UPDATE jobs SET node_id=NULL WHERE jid=?", legacy.JID)
+	require.NoError(t, err)
+
+	n, err := p1.FailRunning("server shutting down", time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	for jid, wantStatus := range map[string]string{
+		running1.JID: models.JobStatusFailed,
+		running2.JID: models.JobStatusRunning,
+		legacy.JID:   models.JobStatusFailed,
+	} {
+		got, err := p2.GetByJID("", jid)
+		require.NoError(t, err)
+		assert.Equal(t, wantStatus, got.Status, jid)
+	}
+}
+
+func TestGetSummariesByClientIDFilteredByInterpreter(t *testing.T) {
+	p, err := NewSqliteProvider(":memory:", testLog)
+	require.NoError(t, err)
+	defer p.Close()
+
+	cid := "client-1"
+	shJob := jb.New(t).ClientID(cid).Interpreter("/bin/sh").Build()
+	tacoJob := jb.New(t).ClientID(cid).Interpreter("tacoscript").Build()
+	psJob := jb.New(t).ClientID(cid).Interpreter("powershell").Build()
+	otherClientTacoJob := jb.New(t).Interpreter("tacoscript").Build()
+	for _, j := range []*models.Job{shJob, tacoJob, psJob, otherClientTacoJob} {
+		require.NoError(t, p.SaveJob(j))
+	}
+
+	testCases := []struct {
+		name    string
+		filters []query.FilterOption
+		want    []*models.JobSummary
+	}{
+		{
+			name: "no filters",
+			want: []*models.JobSummary{&shJob.JobSummary, &tacoJob.JobSummary, &psJob.JobSummary},
+		},
+		{
+			name:    "single interpreter",
+			filters: []query.FilterOption{{Column: "interpreter", Values: []string{"tacoscript"}}},
+			want:    []*models.JobSummary{&tacoJob.JobSummary},
+		},
+		{
+			name:    "multiple interpreters",
+			filters: []query.FilterOption{{Column: "interpreter", Values: []string{"tacoscript", "powershell"}}},
+			want:    []*models.JobSummary{&tacoJob.JobSummary, &psJob.JobSummary},
+		},
+		{
+			name:    "no match",
+			filters: []query.FilterOption{{Column: "interpreter", Values: []string{"cmd"}}},
+			want:    []*models.JobSummary{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := p.GetSummariesByClientID(cid, SummariesOptions{Filters: tc.filters})
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tc.want, got)
+		})
+	}
+}
+
+func TestMigrateInterpretersOfExistingJobs(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "jobs.db")
+	// mimic a DB created before the interpreter column was added
+	db, err := sqlite.New(dbFile, []string{"001_init.up.sql", "001_init.down.sql"}, jobs.Asset)
+	require.NoError(t, err)
+	multiJob := jb.NewMulti(t).Interpreter("tacoscript").Build()
+	multiDetails, err := json.Marshal(convertMultiJobToSqlite(multiJob).Details)
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO multi_jobs (jid, started_at, created_by, details) VALUES (?, ?, ?, ?)",
+		multiJob.JID, multiJob.StartedAt, multiJob.CreatedBy, string(multiDetails))
+	require.NoError(t, err)
+	job := jb.New(t).Interpreter("tacoscript").Command(`echo '"interpreter":"cmd"'`).Build()
+	otherJob := jb.New(t).ClientID(job.ClientID).Interpreter("").Build()
+	for _, j := range []*models.Job{job, otherJob} {
+		details, err := json.Marshal(convertToSqlite(j).Details)
+		require.NoError(t, err)
+		_, err = db.Exec("INSERT INTO jobs (jid, status, started_at, finished_at, created_by, client_id, details) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			j.JID, j.Status, j.StartedAt, j.FinishedAt, j.CreatedBy, j.ClientID, string(details))
+		require.NoError(t, err)
+	}
+	require.NoError(t, db.Close())
+
+	// when
+	p, err := NewSqliteProvider(dbFile, testLog)
+	require.NoError(t, err)
+	defer p.Close()
+
+	// then
+	filters := []query.FilterOption{{Column: "interpreter", Values: []string{"tacoscript"}}}
+	gotJSs, err := p.GetSummariesByClientID(job.ClientID, SummariesOptions{Filters: filters})
+	require.NoError(t, err)
+	assert.Equal(t, []*models.JobSummary{&job.JobSummary}, gotJSs)
+	gotMultiJSs, err := p.GetAllMultiJobSummaries(MultiJobSummariesOptions{Filters: filters})
+	require.NoError(t, err)
+	assert.Equal(t, []*models.MultiJobSummary{&multiJob.MultiJobSummary}, gotMultiJSs)
+	var gotInterpreter string
+	require.NoError(t, p.db.Get(&gotInterpreter, "SELECT interpreter FROM jobs WHERE jid=?", otherJob.JID))
+	assert.Equal(t, "", gotInterpreter)
+}
+
+func TestGetSummariesByClientIDByDuration(t *testing.T) {
+	p, err := NewSqliteProvider(":memory:", testLog)
+	require.NoError(t, err)
+	defer p.Close()
+
+	cid := "client-1"
+	t0 := time.Date(2021, 5, 10, 10, 0, 0, 0, time.UTC)
+	fast := jb.New(t).ClientID(cid).StartedAt(t0).FinishedAt(t0.Add(10 * time.Second)).Build()
+	medium := jb.New(t).ClientID(cid).StartedAt(t0).FinishedAt(t0.Add(400 * time.Second)).Build()
+	slow := jb.New(t).ClientID(cid).StartedAt(t0).FinishedAt(t0.Add(1000 * time.Second)).Build()
+	running := jb.New(t).ClientID(cid).Status(models.JobStatusRunning).StartedAt(time.Now().Add(-700 * time.Second)).Build()
+	running.FinishedAt = nil
+	otherClientSlow := jb.New(t).StartedAt(t0).FinishedAt(t0.Add(1000 * time.Second)).Build()
+	for _, j := range []*models.Job{fast, medium, slow, running, otherClientSlow} {
+		require.NoError(t, p.SaveJob(j))
+	}
+
+	testCases := []struct {
+		name   string
+		opts   SummariesOptions
+		want   []*models.JobSummary
+		sorted bool
+	}{
+		{
+			name: "longer than",
+			opts: SummariesOptions{
+				Filters: []query.FilterOption{{Column: "duration", Operator: "gt", Values: []string{"300"}}},
+			},
+			want: []*models.JobSummary{&medium.JobSummary, &slow.JobSummary},
+		},
+		{
+			name: "longer than including running",
+			opts: SummariesOptions{
+				Filters:        []query.FilterOption{{Column: "duration", Operator: "gt", Values: []string{"300"}}},
+				IncludeRunning: true,
+			},
+			want: []*models.JobSummary{&medium.JobSummary, &slow.JobSummary, &running.JobSummary},
+		},
+		{
+			name: "shorter than",
+			opts: SummariesOptions{
+				Filters: []query.FilterOption{{Column: "duration", Operator: "lt", Values: []string{"500"}}},
+			},
+			want: []*models.JobSummary{&fast.JobSummary, &medium.JobSummary},
+		},
+		{
+			name: "range",
+			opts: SummariesOptions{
+				Filters: []query.FilterOption{
+					{Column: "duration", Operator: "gt", Values: []string{"300"}},
+					{Column: "duration", Operator: "lt", Values: []string{"900.5"}},
+				},
+				IncludeRunning: true,
+			},
+			want: []*models.JobSummary{&medium.JobSummary, &running.JobSummary},
+		},
+		{
+			name: "sort desc",
+			opts: SummariesOptions{
+				Sorts: []query.SortOption{{Column: "duration", IsASC: false}},
+			},
+			want:   []*models.JobSummary{&slow.JobSummary, &medium.JobSummary, &fast.JobSummary},
+			sorted: true,
+		},
+		{
+			name: "sort asc including running",
+			opts: SummariesOptions{
+				Sorts:          []query.SortOption{{Column: "duration", IsASC: true}},
+				IncludeRunning: true,
+			},
+			want:   []*models.JobSummary{&fast.JobSummary, &medium.JobSummary, &running.JobSummary, &slow.JobSummary},
+			sorted: true,
+		},
+		{
+			name: "without duration running jobs are included",
+			opts: SummariesOptions{},
+			want: []*models.JobSummary{&fast.JobSummary, &medium.JobSummary, &slow.JobSummary, &running.JobSummary},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := p.GetSummariesByClientID(cid, tc.opts)
+			require.NoError(t, err)
+			if tc.sorted {
+				assert.Equal(t, tc.want, got)
+			} else {
+				assert.ElementsMatch(t, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestFillCommandsOfExistingJobs(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "jobs.db")
+	p, err := NewSqliteProvider(dbFile, testLog)
+	require.NoError(t, err)
+
+	job := jb.New(t).Command("/usr/bin/uptime").Build()
+	require.NoError(t, p.SaveJob(job))
+	// mimic jobs created before the command column was added
+	_, err = p.db.Exec("UPDATE jobs SET command=NULL")
+	require.NoError(t, err)
+	require.NoError(t, p.Close())
+
+	// when
+	p, err = NewSqliteProvider(dbFile, testLog)
+	require.NoError(t, err)
+	defer p.Close()
+
+	// then
+	got, total, err := p.SearchByCommand(SearchOptions{Text: "uptime"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	require.Len(t, got, 1)
+	assert.Equal(t, job.JID, got[0].JID)
+}
+
+func TestSearchByCommand(t *testing.T) {
+	p, err := NewSqliteProvider(":memory:", testLog)
+	require.NoError(t, err)
+	defer p.Close()
+
+	t0 := time.Date(2021, 5, 10, 10, 0, 0, 0, time.UTC)
+	job1 := jb.New(t).ClientID("client-1").Command("/usr/bin/uptime").StartedAt(t0).FinishedAt(t0.Add(time.Minute)).Build()
+	job2 := jb.New(t).ClientID("client-2").Command("UPTIME -p").StartedAt(t0.Add(time.Hour)).FinishedAt(t0.Add(time.Hour + time.Second)).Build()
+	job3 := jb.New(t).ClientID("client-1").Command("echo 100%_done").StartedAt(t0.Add(2 * time.Hour)).Build()
+	running := jb.New(t).ClientID("client-3").Command("uptime; sleep 100").Status(models.JobStatusRunning).StartedAt(t0.Add(-time.Hour)).Build()
+	running.FinishedAt = nil
+	for _, j := range []*models.Job{job1, job2, job3, running} {
+		require.NoError(t, p.SaveJob(j))
+	}
+
+	testCases := []struct {
+		name      string
+		opts      SearchOptions
+		wantJIDs  []string
+		wantTotal int
+	}{
+		{
+			name:      "case-insensitive, started_at desc by default",
+			opts:      SearchOptions{Text: "uptime"},
+			wantJIDs:  []string{job2.JID, job1.JID, running.JID},
+			wantTotal: 3,
+		},
+		{
+			name:      "wildcards are escaped",
+			opts:      SearchOptions{Text: "0%_d"},
+			wantJIDs:  []string{job3.JID},
+			wantTotal: 1,
+		},
+		{
+			name:      "no wildcard match",
+			opts:      SearchOptions{Text: "u_time"},
+			wantJIDs:  []string{},
+			wantTotal: 0,
+		},
+		{
+			name:      "restricted to clients",
+			opts:      SearchOptions{Text: "uptime", ClientIDs: []string{"client-1", "client-3"}},
+			wantJIDs:  []string{job1.JID, running.JID},
+			wantTotal: 2,
+		},
+		{
+			name:      "no allowed clients",
+			opts:      SearchOptions{Text: "uptime", ClientIDs: []string{}},
+			wantJIDs:  []string{},
+			wantTotal: 0,
+		},
+		{
+			name:      "sort by finished_at desc puts running first",
+			opts:      SearchOptions{Text: "uptime", Sorts: []query.SortOption{{Column: "finished_at"}}},
+			wantJIDs:  []string{running.JID, job2.JID, job1.JID},
+			wantTotal: 3,
+		},
+		{
+			name:      "sort by finished_at asc puts running last",
+			opts:      SearchOptions{Text: "uptime", Sorts: []query.SortOption{{Column: "finished_at", IsASC: true}}},
+			wantJIDs:  []string{job1.JID, job2.JID, running.JID},
+			wantTotal: 3,
+		},
+		{
+			name: "paginated",
+			opts: SearchOptions{
+				Text:       "uptime",
+				Sorts:      []query.SortOption{{Column: "started_at", IsASC: true}},
+				Pagination: &query.Pagination{Limit: 1, Offset: 1},
+			},
+			wantJIDs:  []string{job1.JID},
+			wantTotal: 3,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, total, err := p.SearchByCommand(tc.opts)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantTotal, total)
+			gotJIDs := make([]string, 0, len(got))
+			for _, js := range got {
+				gotJIDs = append(gotJIDs, js.JID)
+			}
+			assert.Equal(t, tc.wantJIDs, gotJIDs)
+		})
+	}
+
+	got, _, err := p.SearchByCommand(SearchOptions{Text: "-p"})
+	require.NoError(t, err)
+	want := []*models.ClientJobSummary{{
+		JobSummary:  job2.JobSummary,
+		ClientID:    "client-2",
+		Command:     "UPTIME -p",
+		Interpreter: job2.Interpreter,
+		CreatedBy:   job2.CreatedBy,
+		StartedAt:   job2.StartedAt,
+	}}
+	assert.Equal(t, want, got)
+}
+
+func TestForEachClientJob(t *testing.T) {
+	p, err := NewSqliteProvider(":memory:", testLog)
+	require.NoError(t, err)
+	defer p.Close()
+
+	t0 := time.Date(2021, 5, 10, 10, 0, 0, 0, time.UTC)
+	job1 := jb.New(t).ClientID("client-1").Interpreter("powershell").StartedAt(t0).Build()
+	job2 := jb.New(t).ClientID("client-2").Interpreter("tacoscript").StartedAt(t0.Add(time.Hour)).Build()
+	job3 := jb.New(t).ClientID("client-1").Command("uptime").Interpreter("tacoscript").StartedAt(t0.Add(2 * time.Hour)).Build()
+	for _, j := range []*models.Job{job1, job2, job3} {
+		require.NoError(t, p.SaveJob(j))
+	}
+
+	testCases := []struct {
+		name     string
+		opts     SearchOptions
+		wantJIDs []string
+	}{
+		{
+			name:     "all",
+			opts:     SearchOptions{},
+			wantJIDs: []string{job3.JID, job2.JID, job1.JID},
+		},
+		{
+			name: "filtered by interpreter and sorted",
+			opts: SearchOptions{
+				Filters: []query.FilterOption{{Column: "interpreter", Values: []string{"tacoscript"}}},
+				Sorts:   []query.SortOption{{Column: "started_at", IsASC: true}},
+			},
+			wantJIDs: []string{job2.JID, job3.JID},
+		},
+		{
+			name:     "by text and clients",
+			opts:     SearchOptions{Text: "uptime", ClientIDs: []string{"client-1"}},
+			wantJIDs: []string{job3.JID},
+		},
+		{
+			name:     "no allowed clients",
+			opts:     SearchOptions{ClientIDs: []string{}},
+			wantJIDs: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			gotJIDs := []string{}
+			err := p.ForEachClientJob(tc.opts, func(js *models.ClientJobSummary) error {
+				gotJIDs = append(gotJIDs, js.JID)
+				return nil
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantJIDs, gotJIDs)
+		})
+	}
+
+	// stops on error
+	wantErr := errors.New("write failed")
+	calls := 0
+	err = p.ForEachClientJob(SearchOptions{}, func(js *models.ClientJobSummary) error {
+		calls++
+		return wantErr
+	})
+	assert.Equal(t, wantErr, err)
+	assert.Equal(t, 1, calls)
+}
@@ -9,12 +9,13 @@ import (
 	"time"
 
 	"github.com/cloudradar-monitoring/rport/share/models"
+	"github.com/cloudradar-monitoring/rport/share/query"
 )
 
 // GetMultiJob returns a multi-client job with fetched all clients' jobs.
-func (p *SqliteProvider) GetMultiJob(jid string) (*models.MultiJob, error) {
+func (p *SQLProvider) GetMultiJob(jid string) (*models.MultiJob, error) {
 	res := &multiJobSqlite{}
-	err := p.db.Get(res, "SELECT * FROM multi_jobs WHERE jid=?", jid)
+	err := p.db.Get(res, p.db.Rebind("SELECT * FROM multi_jobs WHERE jid=?"), jid)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -33,20 +34,102 @@ func (p *SqliteProvider) GetMultiJob(jid string) (*models.MultiJob, error) {
 	return multiJob, nil
 }
 
-// GetAllMultiJobSummaries returns a list of summaries of all multi-clients jobs sorted by started_at(desc), jid order.
-func (p *SqliteProvider) GetAllMultiJobSummaries() ([]*models.MultiJobSummary, error) {
+// MultiJobSummariesOptions are options to list multi-client job summaries.
+type MultiJobSummariesOptions struct {
+	Filters []query.FilterOption
+	// IncludeRunning makes duration filters treat running clients' jobs as ongoing with a duration until now,
+	// otherwise multi-client jobs with running clients' jobs are excluded if a duration is used
+	IncludeRunning bool
+}
+
+// GetAllMultiJobSummaries returns a list of summaries of all multi-clients jobs that match given filters
+// sorted by started_at(desc), jid order.
+func (p *SQLProvider) GetAllMultiJobSummaries(opts MultiJobSummariesOptions) ([]*models.MultiJobSummary, error) {
 	var res []*multiJobSummarySqlite
-	err := p.db.Select(&res, "SELECT jid, started_at, created_by FROM multi_jobs ORDER BY DATETIME(started_at) DESC, jid")
+	q, params := addFilters("SELECT jid, started_at, created_by FROM multi_jobs WHERE 1=1", nil, opts.Filters)
+	q, params = p.addMultiJobDurationFilters(q, params, "multi_jobs.jid", opts)
+	err := p.db.Select(&res, p.db.Rebind(q+" ORDER BY "+p.timeExpr("started_at")+" DESC, jid"), params...)
 	if err != nil {
 		return nil, err
 	}
 	return convertMultiJSs(res), nil
 }
 
+// MultiJobStatusFilters are fields multi-client job status summaries can be filtered by, duration is given in seconds.
+var MultiJobStatusFilters = map[string]bool{
+	"created_by":   true,
+	"status":       true,
+	"duration[gt]": true,
+	"duration[lt]": true,
+}
+
+// multiJobStatusQuery selects multi-client jobs with a number of child jobs by status and a status rollup.
+const multiJobStatusQuery = `SELECT * FROM (
+	SELECT *, CASE
+		WHEN running > 0 THEN 'running'
+		WHEN failed + canceled > 0 THEN 'failed'
+		WHEN job_count > 0 AND successful = job_count THEN 'successful'
+		ELSE 'unknown'
+	END AS status FROM (
+		SELECT m.jid, m.started_at, m.created_by,
+			COUNT(DISTINCT j.client_id) AS client_count,
+			COUNT(j.jid) AS job_count,
+			COUNT(CASE WHEN j.status = 'running' THEN 1 END) AS running,
+			COUNT(CASE WHEN j.status = 'successful' THEN 1 END) AS successful,
+			COUNT(CASE WHEN j.status = 'failed' THEN 1 END) AS failed,
+			COUNT(CASE WHEN j.status = 'canceled' THEN 1 END) AS canceled,
+			COUNT(CASE WHEN j.status = 'unknown' THEN 1 END) AS unknown
+		FROM multi_jobs m LEFT JOIN jobs j ON j.multi_job_id = m.jid
+		GROUP BY m.jid
+	) AS counts
+) AS summaries WHERE 1=1`
+
+// ListMultiJobStatusSummaries returns a page of multi-client job summaries with a rollup of clients' jobs statuses
+// that match given filters sorted by started_at(desc), jid order. It also returns a total number of matching jobs.
+func (p *SQLProvider) ListMultiJobStatusSummaries(opts MultiJobSummariesOptions, pagination *query.Pagination) ([]*models.MultiJobStatusSummary, int, error) {
+	q, params := addSupportedFilters(multiJobStatusQuery, nil, opts.Filters, MultiJobStatusFilters)
+	q, params = p.addMultiJobDurationFilters(q, params, "summaries.jid", opts)
+
+	var total int
+	if err := p.db.Get(&total, p.db.Rebind("SELECT COUNT(*) FROM ("+q+") AS filtered"), params...); err != nil {
+		return nil, 0, err
+	}
+
+	var res []*multiJobStatusSummarySqlite
+	q += " ORDER BY " + p.timeExpr("started_at") + " DESC, jid LIMIT ? OFFSET ?"
+	params = append(params, pagination.Limit, pagination.Offset)
+	if err := p.db.Select(&res, p.db.Rebind(q), params...); err != nil {
+		return nil, 0, err
+	}
+
+	list := make([]*models.MultiJobStatusSummary, 0, len(res))
+	for _, cur := range res {
+		list = append(list, cur.convert())
+	}
+	return list, total, nil
+}
+
+// addMultiJobDurationFilters appends conditions of duration filters to a given query of multi-client jobs.
+// A duration of a multi-client job is the longest duration of its clients' jobs. jidExpr is an expression of
+// a multi-client job id in the query.
+func (p *SQLProvider) addMultiJobDurationFilters(q string, params []interface{}, jidExpr string, opts MultiJobSummariesOptions) (string, []interface{}) {
+	if !hasDuration(opts.Filters, nil) {
+		return q, params
+	}
+	durationExpr := "(SELECT MAX(" + p.durationExpr() + ") FROM jobs WHERE jobs.multi_job_id = " + jidExpr + ")"
+	q, params = addDurationFilters(q, params, opts.Filters, durationExpr)
+	if !opts.IncludeRunning {
+		q += " AND NOT EXISTS (SELECT 1 FROM jobs WHERE jobs.multi_job_id = " + jidExpr + " AND jobs.finished_at IS NULL)"
+	}
+	return q, params
+}
+
 // SaveMultiJob creates a new or updates an existing multi-client job (without child jobs).
-func (p *SqliteProvider) SaveMultiJob(job *models.MultiJob) error {
-	_, err := p.db.NamedExec(`INSERT OR REPLACE INTO multi_jobs (jid, started_at, created_by, details)
-															  VALUES (:jid, :started_at, :created_by, :details)`,
+func (p *SQLProvider) SaveMultiJob(job *models.MultiJob) error {
+	_, err := p.db.NamedExec(`INSERT INTO multi_jobs (jid, started_at, created_by, interpreter, details)
+													VALUES (:jid, :started_at, :created_by, :interpreter, :details)
+													ON CONFLICT (jid) DO UPDATE SET started_at=excluded.started_at, created_by=excluded.created_by,
+													interpreter=excluded.interpreter, details=excluded.details`,
 		convertMultiJobToSqlite(job))
 	if err == nil {
 		p.log.Debugf("Multi-client Job saved successfully: %v", *job)
@@ -56,7 +139,9 @@ func (p *SqliteProvider) SaveMultiJob(job *models.MultiJob) error {
 
 type multiJobSqlite struct {
 	multiJobSummarySqlite
-	Details *multiJobDetailSqlite `db:"details"`
+	// Interpreter duplicates the one from details to be able to filter by it
+	Interpreter sql.NullString        `db:"interpreter"`
+	Details     *multiJobDetailSqlite `db:"details"`
 }
 
 type multiJobSummarySqlite struct {
@@ -65,16 +150,48 @@ type multiJobSummarySqlite struct {
 	CreatedBy string    `db:"created_by"`
 }
 
+type multiJobStatusSummarySqlite struct {
+	multiJobSummarySqlite
+	ClientCount int    `db:"client_count"`
+	JobCount    int    `db:"job_count"`
+	Running     int    `db:"running"`
+	Successful  int    `db:"successful"`
+	Failed      int    `db:"failed"`
+	Canceled    int    `db:"canceled"`
+	Unknown     int    `db:"unknown"`
+	Status      string `db:"status"`
+}
+
+func (s *multiJobStatusSummarySqlite) convert() *models.MultiJobStatusSummary {
+	return &models.MultiJobStatusSummary{
+		MultiJobSummary: *s.multiJobSummarySqlite.convert(),
+		ClientCount:     s.ClientCount,
+		Status:          s.Status,
+		StatusCounts: map[string]int{
+			models.JobStatusRunning:    s.Running,
+			models.JobStatusSuccessful: s.Successful,
+			models.JobStatusFailed:     s.Failed,
+			models.JobStatusCanceled:   s.Canceled,
+			models.JobStatusUnknown:    s.Unknown,
+		},
+	}
+}
+
 type multiJobDetailSqlite struct {
-	ClientIDs   []string `json:"client_ids"`
-	GroupIDs    []string `json:"group_ids"`
-	Command     string   `json:"command"`
-	Interpreter string   `json:"interpreter"`
-	Cwd         string   `json:"cwd"`
-	IsSudo      bool     `json:"is_sudo"`
-	TimeoutSec  int      `json:"timeout_sec"`
-	Concurrent  bool     `json:"concurrent"`
-	AbortOnErr  bool     `json:"abort_on_err"`
+	ClientIDs       []string          `json:"client_ids"`
+	GroupIDs        []string          `json:"group_ids"`
+	Tags            []string          `json:"tags,omitempty"`
+	Command         string            `json:"command"`
+	Interpreter     string            `json:"interpreter"`
+	Cwd             string            `json:"cwd"`
+	IsSudo          bool              `json:"is_sudo"`
+	IsTemplate      bool              `json:"is_template,omitempty"`
+	Params          map[string]string `json:"params,omitempty"`
+	TimeoutSec      int               `json:"timeout_sec"`
+	Concurrent      bool              `json:"concurrent"`
+	AbortOnErr      bool              `json:"abort_on_err"`
+	BatchTimeoutSec int               `json:"batch_timeout_sec,omitempty"`
+	FinishedAt      *time.Time        `json:"finished_at,omitempty"`
 }
 
 func (d *multiJobDetailSqlite) Scan(value interface{}) error {
@@ -126,13 +243,18 @@ func (j *multiJobSqlite) convert() *models.MultiJob {
 		MultiJobSummary: *js,
 		ClientIDs:       d.ClientIDs,
 		GroupIDs:        d.GroupIDs,
+		Tags:            d.Tags,
 		Command:         d.Command,
 		Cwd:             d.Cwd,
 		IsSudo:          d.IsSudo,
+		IsTemplate:      d.IsTemplate,
+		Params:          d.Params,
 		Interpreter:     d.Interpreter,
 		TimeoutSec:      d.TimeoutSec,
 		Concurrent:      d.Concurrent,
 		AbortOnErr:      d.AbortOnErr,
+		BatchTimeoutSec: d.BatchTimeoutSec,
+		FinishedAt:      d.FinishedAt,
 	}
 }
 
@@ -143,16 +265,22 @@ func convertMultiJobToSqlite(job *models.MultiJob) *multiJobSqlite {
 			StartedAt: job.StartedAt,
 			CreatedBy: job.CreatedBy,
 		},
+		Interpreter: sql.NullString{String: job.Interpreter, Valid: true},
 		Details: &multiJobDetailSqlite{
-			ClientIDs:   job.ClientIDs,
-			GroupIDs:    job.GroupIDs,
-			Command:     job.Command,
-			Interpreter: job.Interpreter,
-			Cwd:         job.Cwd,
-			IsSudo:      job.IsSudo,
-			TimeoutSec:  job.TimeoutSec,
-			Concurrent:  job.Concurrent,
-			AbortOnErr:  job.AbortOnErr,
+			ClientIDs:       job.ClientIDs,
+			GroupIDs:        job.GroupIDs,
+			Tags:            job.Tags,
+			Command:         job.Command,
+			Interpreter:     job.Interpreter,
+			Cwd:             job.Cwd,
+			IsSudo:          job.IsSudo,
+			IsTemplate:      job.IsTemplate,
+			Params:          job.Params,
+			TimeoutSec:      job.TimeoutSec,
+			Concurrent:      job.Concurrent,
+			AbortOnErr:      job.AbortOnErr,
+			BatchTimeoutSec: job.BatchTimeoutSec,
+			FinishedAt:      job.FinishedAt,
 		},
 	}
 }
@@ -9,6 +9,7 @@ import (
 
 	"github.com/cloudradar-monitoring/rport/server/test/jb"
 	"github.com/cloudradar-monitoring/rport/share/models"
+	"github.com/cloudradar-monitoring/rport/share/query"
 )
 
 func TestMultiJobsSqliteProvider(t *testing.T) {
@@ -17,7 +18,7 @@ func TestMultiJobsSqliteProvider(t *testing.T) {
 	defer p.Close()
 
 	// verify job summaries not found
-	gotJSs, err := p.GetAllMultiJobSummaries()
+	gotJSs, err := p.GetAllMultiJobSummaries(MultiJobSummariesOptions{})
 	require.NoError(t, err)
 	require.Empty(t, gotJSs)
 
@@ -60,7 +61,7 @@ func TestMultiJobsSqliteProvider(t *testing.T) {
 	require.Nil(t, gotJob4)
 
 	// verify job summaries
-	gotJSs, err = p.GetAllMultiJobSummaries()
+	gotJSs, err = p.GetAllMultiJobSummaries(MultiJobSummariesOptions{})
 	require.NoError(t, err)
 	assert.EqualValues(t, []*models.MultiJobSummary{&job2.MultiJobSummary, &job3.MultiJobSummary, &job1.MultiJobSummary}, gotJSs)
 
@@ -75,7 +76,265 @@ func TestMultiJobsSqliteProvider(t *testing.T) {
 	require.NotNil(t, gotJob1)
 	assert.Equal(t, job1, gotJob1)
 
-	gotJSs, err = p.GetAllMultiJobSummaries()
+	gotJSs, err = p.GetAllMultiJobSummaries(MultiJobSummariesOptions{})
 	require.NoError(t, err)
 	assert.EqualValues(t, []*models.MultiJobSummary{&job1.MultiJobSummary, &job2.MultiJobSummary, &job3.MultiJobSummary}, gotJSs)
 }
+
+func TestGetAllMultiJobSummariesFilteredByInterpreter(t *testing.T) {
+	p, err := NewSqliteProvider(":memory:", testLog)
+	require.NoError(t, err)
+	defer p.Close()
+
+	t1 := time.Date(2020, 10, 10, 10, 10, 10, 0, time.UTC)
+	shJob := jb.NewMulti(t).JID("1111").StartedAt(t1).Build()
+	tacoJob := jb.NewMulti(t).JID("2222").StartedAt(t1.Add(time.Minute)).Interpreter("tacoscript").Build()
+	psJob := jb.NewMulti(t).JID("3333").StartedAt(t1.Add(2 * time.Minute)).Interpreter("powershell").Build()
+	for _, j := range []*models.MultiJob{shJob, tacoJob, psJob} {
+		require.NoError(t, p.SaveMultiJob(j))
+	}
+
+	testCases := []struct {
+		name    string
+		filters []query.FilterOption
+		want    []*models.MultiJobSummary
+	}{
+		{
+			name: "no filters",
+			want: []*models.MultiJobSummary{&psJob.MultiJobSummary, &tacoJob.MultiJobSummary, &shJob.MultiJobSummary},
+		},
+		{
+			name:    "single interpreter",
+			filters: []query.FilterOption{{Column: "interpreter", Values: []string{"tacoscript"}}},
+			want:    []*models.MultiJobSummary{&tacoJob.MultiJobSummary},
+		},
+		{
+			name:    "multiple interpreters",
+			filters: []query.FilterOption{{Column: "interpreter", Values: []string{"tacoscript", "powershell"}}},
+			want:    []*models.MultiJobSummary{&psJob.MultiJobSummary, &tacoJob.MultiJobSummary},
+		},
+		{
+			name:    "no match",
+			filters: []query.FilterOption{{Column: "interpreter", Values: []string{"cmd"}}},
+			want:    []*models.MultiJobSummary{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := p.GetAllMultiJobSummaries(MultiJobSummariesOptions{Filters: tc.filters})
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestListMultiJobStatusSummaries(t *testing.T) {
+	p, err := NewSqliteProvider(":memory:", testLog)
+	require.NoError(t, err)
+	defer p.Close()
+
+	t1 := time.Date(2020, 10, 10, 10, 10, 10, 0, time.UTC)
+	succeededJob := jb.NewMulti(t).JID("1111").StartedAt(t1).CreatedBy("admin").Build()
+	runningJob := jb.NewMulti(t).JID("2222").StartedAt(t1.Add(time.Minute)).CreatedBy("admin").Build()
+	failedJob := jb.NewMulti(t).JID("3333").StartedAt(t1.Add(2 * time.Minute)).CreatedBy("bob").Build()
+	canceledJob := jb.NewMulti(t).JID("4444").StartedAt(t1.Add(3 * time.Minute)).CreatedBy("bob").Build()
+	noJobsJob := jb.NewMulti(t).JID("5555").StartedAt(t1.Add(4 * time.Minute)).CreatedBy("admin").Build()
+	childStatuses := map[*models.MultiJob][]string{
+		succeededJob: {models.JobStatusSuccessful, models.JobStatusSuccessful},
+		runningJob:   {models.JobStatusRunning, models.JobStatusSuccessful},
+		failedJob:    {models.JobStatusFailed, models.JobStatusSuccessful},
+		canceledJob:  {models.JobStatusCanceled, models.JobStatusSuccessful, models.JobStatusSuccessful},
+		noJobsJob:    nil,
+	}
+	for multiJob, statuses := range childStatuses {
+		require.NoError(t, p.SaveMultiJob(multiJob))
+		for _, status := range statuses {
+			require.NoError(t, p.SaveJob(jb.New(t).MultiJobID(multiJob.JID).Status(status).Build()))
+		}
+	}
+	// a client with several jobs in a multi-client job is counted once
+	require.NoError(t, p.SaveJob(jb.New(t).ClientID("client-1").MultiJobID(runningJob.JID).Status(models.JobStatusSuccessful).Build()))
+	require.NoError(t, p.SaveJob(jb.New(t).ClientID("client-1").MultiJobID(runningJob.JID).Status(models.JobStatusSuccessful).Build()))
+	// a single client job is not counted
+	require.NoError(t, p.SaveJob(jb.New(t).Status(models.JobStatusRunning).Build()))
+
+	summary := func(job *models.MultiJob, status string, running, successful, failed, canceled int) *models.MultiJobStatusSummary {
+		return &models.MultiJobStatusSummary{
+			MultiJobSummary: job.MultiJobSummary,
+			ClientCount:     running + successful + failed + canceled,
+			Status:          status,
+			StatusCounts: map[string]int{
+				models.JobStatusRunning:    running,
+				models.JobStatusSuccessful: successful,
+				models.JobStatusFailed:     failed,
+				models.JobStatusCanceled:   canceled,
+				models.JobStatusUnknown:    0,
+			},
+		}
+	}
+	succeeded := summary(succeededJob, models.JobStatusSuccessful, 0, 2, 0, 0)
+	running := summary(runningJob, models.JobStatusRunning, 1, 3, 0, 0)
+	running.ClientCount = 3
+	failed := summary(failedJob, models.JobStatusFailed, 0, 1, 1, 0)
+	canceled := summary(canceledJob, models.JobStatusFailed, 0, 2, 0, 1)
+	noJobs := summary(noJobsJob, models.JobStatusUnknown, 0, 0, 0, 0)
+
+	testCases := []struct {
+		name       string
+		filters    []query.FilterOption
+		pagination query.Pagination
+		want       []*models.MultiJobStatusSummary
+		wantTotal  int
+	}{
+		{
+			name:       "no filters",
+			pagination: query.Pagination{Limit: 10},
+			want:       []*models.MultiJobStatusSummary{noJobs, canceled, failed, running, succeeded},
+			wantTotal:  5,
+		},
+		{
+			name:       "first page",
+			pagination: query.Pagination{Limit: 2},
+			want:       []*models.MultiJobStatusSummary{noJobs, canceled},
+			wantTotal:  5,
+		},
+		{
+			name:       "last page",
+			pagination: query.Pagination{Limit: 2, Offset: 4},
+			want:       []*models.MultiJobStatusSummary{succeeded},
+			wantTotal:  5,
+		},
+		{
+			name:       "offset out of range",
+			pagination: query.Pagination{Limit: 2, Offset: 10},
+			want:       []*models.MultiJobStatusSummary{},
+			wantTotal:  5,
+		},
+		{
+			name:       "by creator",
+			filters:    []query.FilterOption{{Column: "created_by", Values: []string{"bob"}}},
+			pagination: query.Pagination{Limit: 10},
+			want:       []*models.MultiJobStatusSummary{canceled, failed},
+			wantTotal:  2,
+		},
+		{
+			name:       "by status",
+			filters:    []query.FilterOption{{Column: "status", Values: []string{"failed", "running"}}},
+			pagination: query.Pagination{Limit: 10},
+			want:       []*models.MultiJobStatusSummary{canceled, failed, running},
+			wantTotal:  3,
+		},
+		{
+			name: "by creator and status with pagination",
+			filters: []query.FilterOption{
+				{Column: "created_by", Values: []string{"admin"}},
+				{Column: "status", Values: []string{"successful", "running"}},
+			},
+			pagination: query.Pagination{Limit: 1, Offset: 1},
+			want:       []*models.MultiJobStatusSummary{succeeded},
+			wantTotal:  2,
+		},
+		{
+			name:       "no match",
+			filters:    []query.FilterOption{{Column: "created_by", Values: []string{"unknown"}}},
+			pagination: query.Pagination{Limit: 10},
+			want:       []*models.MultiJobStatusSummary{},
+			wantTotal:  0,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, gotTotal, err := p.ListMultiJobStatusSummaries(MultiJobSummariesOptions{Filters: tc.filters}, &tc.pagination)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+			assert.Equal(t, tc.wantTotal, gotTotal)
+		})
+	}
+}
+
+func TestMultiJobSummariesByDuration(t *testing.T) {
+	p, err := NewSqliteProvider(":memory:", testLog)
+	require.NoError(t, err)
+	defer p.Close()
+
+	t0 := time.Date(2021, 5, 10, 10, 0, 0, 0, time.UTC)
+	fast := jb.NewMulti(t).JID("1111").StartedAt(t0).Build()
+	slow := jb.NewMulti(t).JID("2222").StartedAt(t0.Add(time.Minute)).Build()
+	running := jb.NewMulti(t).JID("3333").StartedAt(t0.Add(2 * time.Minute)).Build()
+	childDurations := map[*models.MultiJob][]time.Duration{
+		fast:    {5 * time.Second, 10 * time.Second},
+		slow:    {10 * time.Second, 1000 * time.Second},
+		running: {10 * time.Second},
+	}
+	for multiJob, durations := range childDurations {
+		require.NoError(t, p.SaveMultiJob(multiJob))
+		for _, d := range durations {
+			require.NoError(t, p.SaveJob(jb.New(t).MultiJobID(multiJob.JID).StartedAt(t0).FinishedAt(t0.Add(d)).Build()))
+		}
+	}
+	runningChild := jb.New(t).MultiJobID(running.JID).Status(models.JobStatusRunning).StartedAt(time.Now().Add(-700 * time.Second)).Build()
+	runningChild.FinishedAt = nil
+	require.NoError(t, p.SaveJob(runningChild))
+
+	testCases := []struct {
+		name string
+		opts MultiJobSummariesOptions
+		want []*models.MultiJob
+	}{
+		{
+			name: "longer than",
+			opts: MultiJobSummariesOptions{
+				Filters: []query.FilterOption{{Column: "duration", Operator: "gt", Values: []string{"300"}}},
+			},
+			want: []*models.MultiJob{slow},
+		},
+		{
+			name: "longer than including running",
+			opts: MultiJobSummariesOptions{
+				Filters:        []query.FilterOption{{Column: "duration", Operator: "gt", Values: []string{"300"}}},
+				IncludeRunning: true,
+			},
+			want: []*models.MultiJob{running, slow},
+		},
+		{
+			name: "shorter than",
+			opts: MultiJobSummariesOptions{
+				Filters: []query.FilterOption{{Column: "duration", Operator: "lt", Values: []string{"500"}}},
+			},
+			want: []*models.MultiJob{fast},
+		},
+		{
+			name: "without duration running jobs are included",
+			want: []*models.MultiJob{running, slow, fast},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			gotAll, err := p.GetAllMultiJobSummaries(tc.opts)
+			require.NoError(t, err)
+			gotList, gotTotal, err := p.ListMultiJobStatusSummaries(tc.opts, &query.Pagination{Limit: 10})
+			require.NoError(t, err)
+
+			wantJIDs := make([]string, 0, len(tc.want))
+			for _, j := range tc.want {
+				wantJIDs = append(wantJIDs, j.JID)
+			}
+			gotAllJIDs := make([]string, 0, len(gotAll))
+			for _, j := range gotAll {
+				gotAllJIDs = append(gotAllJIDs, j.JID)
+			}
+			gotListJIDs := make([]string, 0, len(gotList))
+			for _, j := range gotList {
+				gotListJIDs = append(gotListJIDs, j.JID)
+			}
+			assert.Equal(t, wantJIDs, gotAllJIDs)
+			assert.Equal(t, wantJIDs, gotListJIDs)
+			assert.Equal(t, len(wantJIDs), gotTotal)
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package jobs
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/rport/server/test/jb"
+	"github.com/cloudradar-monitoring/rport/share/models"
+)
+
+// testPostgresDSNEnv is an env var with a DSN of a PostgreSQL DB to run Postgres provider tests against.
+const testPostgresDSNEnv = "RPORT_TEST_POSTGRES_DSN"
+
+func newTestPostgresProvider(t *testing.T) *SQLProvider {
+	dsn := os.Getenv(testPostgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", testPostgresDSNEnv)
+	}
+	p, err := NewPostgresProvider(dsn, testLog)
+	require.NoError(t, err)
+	return p
+}
+
+func TestJobsPostgresProvider(t *testing.T) {
+	p := newTestPostgresProvider(t)
+	defer p.Close()
+
+	// add jobs
+	job1 := jb.New(t).Status(models.JobStatusRunning).Result(nil).IsSudo().Build()
+	job2 := jb.New(t).ClientID(job1.ClientID).Cwd("/root").Build()
+	require.NoError(t, p.SaveJob(job1))
+	require.NoError(t, p.CreateJob(job2))
+	// creating an existing job does nothing
+	require.NoError(t, p.CreateJob(job2))
+
+	gotJob1, err := p.GetByJID(job1.ClientID, job1.JID)
+	require.NoError(t, err)
+	require.NotNil(t, gotJob1)
+	assertJobEqual(t, job1, gotJob1)
+
+	gotJob2, err := p.GetByJID(job2.ClientID, job2.JID)
+	require.NoError(t, err)
+	require.NotNil(t, gotJob2)
+	assertJobEqual(t, job2, gotJob2)
+
+	gotJob3, err := p.GetByJID(job1.ClientID, "unknown-jid")
+	require.NoError(t, err)
+	assert.Nil(t, gotJob3)
+
+	// update a job
+	job1.Status = models.JobStatusSuccessful
+	job1.Result = &models.JobResult{StdOut: "some std out"}
+	ft := time.Date(2020, 11, 5, 12, 11, 20, 0, time.UTC)
+	job1.FinishedAt = &ft
+	require.NoError(t, p.SaveJob(job1))
+
+	gotJSs, err := p.GetSummariesByClientID(job1.ClientID, SummariesOptions{})
+	require.NoError(t, err)
+	require.Len(t, gotJSs, 2)
+	for _, js := range gotJSs {
+		if js.JID == job1.JID {
+			assert.Equal(t, models.JobStatusSuccessful, js.Status)
+			require.NotNil(t, js.FinishedAt)
+			assert.True(t, ft.Equal(*js.FinishedAt))
+		}
+	}
+
+	found, total, err := p.SearchByCommand(SearchOptions{Text: strings.ToUpper(job2.Command), ClientIDs: []string{job1.ClientID}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+	assert.Len(t, found, 2)
+}
+
+func TestMultiJobsPostgresProvider(t *testing.T) {
+	p := newTestPostgresProvider(t)
+	defer p.Close()
+
+	multiJob := jb.NewMulti(t).StartedAt(time.Now().UTC().Truncate(time.Microsecond)).WithJobs().Build()
+	require.NoError(t, p.SaveMultiJob(multiJob))
+	for _, j := range multiJob.Jobs {
+		require.NoError(t, p.SaveJob(j))
+	}
+
+	got, err := p.GetMultiJob(multiJob.JID)
+	require.NoError(t, err)
+	require.NotNil(t, got)
+	assert.Equal(t, multiJob.JID, got.JID)
+	assert.True(t, multiJob.StartedAt.Equal(got.StartedAt))
+	assert.Equal(t, multiJob.ClientIDs, got.ClientIDs)
+	require.Len(t, got.Jobs, len(multiJob.Jobs))
+	for i := range multiJob.Jobs {
+		assertJobEqual(t, multiJob.Jobs[i], got.Jobs[i])
+	}
+
+	got, err = p.GetMultiJob("unknown-jid")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+// assertJobEqual compares jobs ignoring time zones, PostgreSQL returns times in a zone of a DB session.
+func assertJobEqual(t *testing.T, want, got *models.Job) {
+	t.Helper()
+	assert.True(t, want.StartedAt.Equal(got.StartedAt), "started_at: want %v, got %v", want.StartedAt, got.StartedAt)
+	wantCopy, gotCopy := *want, *got
+	wantCopy.StartedAt, gotCopy.StartedAt = time.Time{}, time.Time{}
+	if want.FinishedAt != nil && got.FinishedAt != nil {
+		assert.True(t, want.FinishedAt.Equal(*got.FinishedAt), "finished_at: want %v, got %v", *want.FinishedAt, *got.FinishedAt)
+		wantCopy.FinishedAt, gotCopy.FinishedAt = nil, nil
+	}
+	assert.Equal(t, wantCopy, gotCopy)
+}
@@ -0,0 +1,103 @@
+package jobs
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/cloudradar-monitoring/rport/server/api"
+	"github.com/cloudradar-monitoring/rport/share/models"
+)
+
+const (
+	gzipExt = ".gz"
+	// payloadExt is an extension of result files that are stored wrapped into an API success payload
+	payloadExt = ".payload.json" + gzipExt
+)
+
+// fileResultStore stores job results on disk, one gzip compressed file per job. Results are stored wrapped into
+// an API success payload, so they can be passed through to API clients as is.
+type fileResultStore struct {
+	dir string
+}
+
+func newFileResultStore(dir string) (*fileResultStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create job results dir %q: %v", dir, err)
+	}
+	return &fileResultStore{dir: dir}, nil
+}
+
+// Save writes a given job result to a file and returns its name relative to the store dir.
+func (s *fileResultStore) Save(jid string, result *models.JobResult) (string, error) {
+	b, err := json.Marshal(api.NewSuccessPayload(result))
+	if err != nil {
+		return "", fmt.Errorf("failed to encode job result: %v", err)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(b); err != nil {
+		return "", fmt.Errorf("failed to compress job result: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		return "", fmt.Errorf("failed to compress job result: %v", err)
+	}
+	name := filepath.Base(jid) + payloadExt
+	if err := ioutil.WriteFile(filepath.Join(s.dir, name), buf.Bytes(), 0600); err != nil {
+		return "", fmt.Errorf("failed to write job result: %v", err)
+	}
+	return name, nil
+}
+
+func (s *fileResultStore) Load(name string) (*models.JobResult, error) {
+	raw, err := s.LoadRaw(name)
+	if err != nil {
+		return nil, err
+	}
+	b, err := raw.JSON()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job result %q: %v", name, err)
+	}
+	res := &models.JobResult{}
+	if err := json.Unmarshal(b, res); err != nil {
+		return nil, fmt.Errorf("failed to decode job result %q: %v", name, err)
+	}
+	return res, nil
+}
+
+// LoadRaw returns a job result as it's stored on disk. Results stored by older versions are not wrapped into
+// a payload and may be not compressed.
+func (s *fileResultStore) LoadRaw(name string) (*RawResult, error) {
+	b, err := ioutil.ReadFile(filepath.Join(s.dir, filepath.Base(name)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job result: %v", err)
+	}
+	return &RawResult{
+		Data:    b,
+		Gzipped: strings.HasSuffix(name, gzipExt),
+		Payload: strings.HasSuffix(name, payloadExt),
+	}, nil
+}
+
+// Delete removes a job result file. A missing file is not an error.
+func (s *fileResultStore) Delete(name string) error {
+	err := os.Remove(filepath.Join(s.dir, filepath.Base(name)))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func gunzip(b []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return ioutil.ReadAll(zr)
+}
@@ -0,0 +1,162 @@
+package jobs
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cloudradar-monitoring/rport/share/models"
+)
+
+// ListSchedules returns all schedules ordered by creation time.
+func (p *SQLProvider) ListSchedules() ([]*models.Schedule, error) {
+	var res []*scheduleSqlite
+	err := p.db.Select(&res, "SELECT * FROM schedules ORDER BY created_at, id")
+	if err != nil {
+		return nil, err
+	}
+	list := make([]*models.Schedule, 0, len(res))
+	for _, cur := range res {
+		list = append(list, cur.convert())
+	}
+	return list, nil
+}
+
+// GetSchedule returns a schedule by a given ID or nil if it's not found.
+func (p *SQLProvider) GetSchedule(id string) (*models.Schedule, error) {
+	res := &scheduleSqlite{}
+	err := p.db.Get(res, p.db.Rebind("SELECT * FROM schedules WHERE id=?"), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return res.convert(), nil
+}
+
+// SaveSchedule creates a new or updates an existing schedule.
+func (p *SQLProvider) SaveSchedule(schedule *models.Schedule) error {
+	_, err := p.db.NamedExec(`INSERT INTO schedules (id, created_at, created_by, details)
+													VALUES (:id, :created_at, :created_by, :details)
+													ON CONFLICT (id) DO UPDATE SET created_at=excluded.created_at, created_by=excluded.created_by,
+													details=excluded.details`,
+		convertScheduleToSqlite(schedule))
+	if err == nil {
+		p.log.Debugf("Schedule saved successfully: %v", *schedule)
+	}
+	return err
+}
+
+// DeleteSchedule deletes a schedule by a given ID. Returns false if it's not found.
+func (p *SQLProvider) DeleteSchedule(id string) (bool, error) {
+	res, err := p.db.Exec(p.db.Rebind("DELETE FROM schedules WHERE id=?"), id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+type scheduleSqlite struct {
+	ID        string                 `db:"id"`
+	CreatedAt time.Time              `db:"created_at"`
+	CreatedBy string                 `db:"created_by"`
+	Details   *scheduleDetailsSqlite `db:"details"`
+}
+
+type scheduleDetailsSqlite struct {
+	Cron           string     `json:"cron"`
+	ClientIDs      []string   `json:"client_ids"`
+	GroupIDs       []string   `json:"group_ids"`
+	Command        string     `json:"command"`
+	Interpreter    string     `json:"interpreter"`
+	Cwd            string     `json:"cwd"`
+	IsSudo         bool       `json:"is_sudo"`
+	IsScript       bool       `json:"is_script"`
+	IsTemplate     bool       `json:"is_template,omitempty"`
+	TimeoutSec     int        `json:"timeout_sec"`
+	Concurrent     bool       `json:"concurrent"`
+	AbortOnErr     bool       `json:"abort_on_err"`
+	LastRunAt      *time.Time `json:"last_run_at,omitempty"`
+	LastMultiJobID string     `json:"last_multi_job_id,omitempty"`
+}
+
+func (d *scheduleDetailsSqlite) Scan(value interface{}) error {
+	if d == nil {
+		return errors.New("'details' cannot be nil")
+	}
+	valueStr, ok := value.(string)
+	if !ok {
+		return fmt.Errorf("expected to have string, got %T", value)
+	}
+	err := json.Unmarshal([]byte(valueStr), d)
+	if err != nil {
+		return fmt.Errorf("failed to decode 'details' field: %v", err)
+	}
+	return nil
+}
+
+func (d *scheduleDetailsSqlite) Value() (driver.Value, error) {
+	if d == nil {
+		return nil, errors.New("'details' cannot be nil")
+	}
+	b, err := json.Marshal(d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode 'details' field: %v", err)
+	}
+	return string(b), nil
+}
+
+func (s *scheduleSqlite) convert() *models.Schedule {
+	d := s.Details
+	return &models.Schedule{
+		ID:             s.ID,
+		CreatedAt:      s.CreatedAt,
+		CreatedBy:      s.CreatedBy,
+		Cron:           d.Cron,
+		ClientIDs:      d.ClientIDs,
+		GroupIDs:       d.GroupIDs,
+		Command:        d.Command,
+		Interpreter:    d.Interpreter,
+		Cwd:            d.Cwd,
+		IsSudo:         d.IsSudo,
+		IsScript:       d.IsScript,
+		IsTemplate:     d.IsTemplate,
+		TimeoutSec:     d.TimeoutSec,
+		Concurrent:     d.Concurrent,
+		AbortOnErr:     d.AbortOnErr,
+		LastRunAt:      d.LastRunAt,
+		LastMultiJobID: d.LastMultiJobID,
+	}
+}
+
+func convertScheduleToSqlite(s *models.Schedule) *scheduleSqlite {
+	return &scheduleSqlite{
+		ID:        s.ID,
+		CreatedAt: s.CreatedAt,
+		CreatedBy: s.CreatedBy,
+		Details: &scheduleDetailsSqlite{
+			Cron:           s.Cron,
+			ClientIDs:      s.ClientIDs,
+			GroupIDs:       s.GroupIDs,
+			Command:        s.Command,
+			Interpreter:    s.Interpreter,
+			Cwd:            s.Cwd,
+			IsSudo:         s.IsSudo,
+			IsScript:       s.IsScript,
+			IsTemplate:     s.IsTemplate,
+			TimeoutSec:     s.TimeoutSec,
+			Concurrent:     s.Concurrent,
+			AbortOnErr:     s.AbortOnErr,
+			LastRunAt:      s.LastRunAt,
+			LastMultiJobID: s.LastMultiJobID,
+		},
+	}
+}
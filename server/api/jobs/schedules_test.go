@@ -0,0 +1,76 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/rport/share/models"
+)
+
+func TestSchedulesSqliteProvider(t *testing.T) {
+	p, err := NewSqliteProvider(":memory:", testLog)
+	require.NoError(t, err)
+	defer p.Close()
+
+	// verify schedules not found
+	gotList, err := p.ListSchedules()
+	require.NoError(t, err)
+	assert.Empty(t, gotList)
+	got, err := p.GetSchedule("1")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	// add schedules
+	t1 := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+	s1 := &models.Schedule{
+		ID:          "1",
+		CreatedAt:   t1,
+		CreatedBy:   "admin",
+		Cron:        "*/5 * * * *",
+		ClientIDs:   []string{"client-1", "client-2"},
+		Command:     "/usr/bin/uptime",
+		Interpreter: "/bin/sh",
+		TimeoutSec:  60,
+		AbortOnErr:  true,
+	}
+	s2 := &models.Schedule{
+		ID:         "2",
+		CreatedAt:  t1.Add(-time.Hour),
+		CreatedBy:  "admin",
+		Cron:       "0 * * * *",
+		GroupIDs:   []string{"group-1"},
+		Command:    "date",
+		IsScript:   true,
+		Concurrent: true,
+	}
+	require.NoError(t, p.SaveSchedule(s1))
+	require.NoError(t, p.SaveSchedule(s2))
+
+	gotList, err = p.ListSchedules()
+	require.NoError(t, err)
+	assert.Equal(t, []*models.Schedule{s2, s1}, gotList)
+
+	// update
+	lastRun := t1.Add(time.Minute)
+	s1.LastRunAt = &lastRun
+	s1.LastMultiJobID = "job-1"
+	require.NoError(t, p.SaveSchedule(s1))
+	got, err = p.GetSchedule("1")
+	require.NoError(t, err)
+	assert.Equal(t, s1, got)
+
+	// delete
+	deleted, err := p.DeleteSchedule("1")
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	deleted, err = p.DeleteSchedule("1")
+	require.NoError(t, err)
+	assert.False(t, deleted)
+
+	gotList, err = p.ListSchedules()
+	require.NoError(t, err)
+	assert.Equal(t, []*models.Schedule{s2}, gotList)
+}
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gorilla/handlers"
+	"github.com/gorilla/mux"
+)
+
+// CompressExcept gzip compresses responses the same way as handlers.CompressHandler except routes with given names.
+// These routes are expected to encode their responses on their own.
+func CompressExcept(routeNames ...string) mux.MiddlewareFunc {
+	skip := make(map[string]bool, len(routeNames))
+	for _, name := range routeNames {
+		skip[name] = true
+	}
+	return func(next http.Handler) http.Handler {
+		compressed := handlers.CompressHandler(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if route := mux.CurrentRoute(r); route != nil && skip[route.GetName()] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			compressed.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/cloudradar-monitoring/rport/server/api"
+)
+
+// TimeoutExcept responds with 503 if a handler doesn't finish within a given timeout, the handler's context is canceled then.
+// Routes with given names are not limited, it's intended for long-lived endpoints like web sockets and streamed downloads.
+// A zero timeout disables it.
+func TimeoutExcept(timeout time.Duration, routeNames ...string) mux.MiddlewareFunc {
+	skip := make(map[string]bool, len(routeNames))
+	for _, name := range routeNames {
+		skip[name] = true
+	}
+	body, _ := json.Marshal(api.NewErrAPIPayloadFromMessage("", fmt.Sprintf("Request timeout (%s) is exceeded.", timeout), ""))
+	return func(next http.Handler) http.Handler {
+		if timeout <= 0 {
+			return next
+		}
+		limited := http.TimeoutHandler(next, timeout, string(body))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if route := mux.CurrentRoute(r); route != nil && skip[route.GetName()] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			limited.ServeHTTP(&timeoutResponseWriter{ResponseWriter: w}, r)
+		})
+	}
+}
+
+// timeoutResponseWriter sets a JSON content type to the timeout response, http.TimeoutHandler doesn't set any.
+type timeoutResponseWriter struct {
+	http.ResponseWriter
+}
+
+func (w *timeoutResponseWriter) WriteHeader(statusCode int) {
+	if statusCode == http.StatusServiceUnavailable && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
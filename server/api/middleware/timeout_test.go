@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeoutExcept(t *testing.T) {
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(300 * time.Millisecond):
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	fast := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("done"))
+	}
+
+	testCases := []struct {
+		name            string
+		timeout         time.Duration
+		path            string
+		wantStatus      int
+		wantContentType string
+		wantBody        string
+	}{
+		{
+			name:            "slow handler times out",
+			timeout:         50 * time.Millisecond,
+			path:            "/slow",
+			wantStatus:      http.StatusServiceUnavailable,
+			wantContentType: "application/json",
+			wantBody:        `{"errors":[{"code":"","title":"Request timeout (50ms) is exceeded.","detail":""}]}`,
+		},
+		{
+			name:            "fast handler succeeds",
+			timeout:         50 * time.Millisecond,
+			path:            "/fast",
+			wantStatus:      http.StatusCreated,
+			wantContentType: "text/plain",
+			wantBody:        "done",
+		},
+		{
+			name:       "excluded route is not limited",
+			timeout:    50 * time.Millisecond,
+			path:       "/slow-excluded",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "disabled",
+			timeout:    0,
+			path:       "/slow",
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			r := mux.NewRouter()
+			r.HandleFunc("/slow", slow)
+			r.HandleFunc("/fast", fast)
+			r.HandleFunc("/slow-excluded", slow).Name("excluded")
+			r.Use(TimeoutExcept(tc.timeout, "excluded"))
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			assert.Equal(t, tc.wantStatus, w.Code)
+			assert.Equal(t, tc.wantContentType, w.Header().Get("Content-Type"))
+			assert.Equal(t, tc.wantBody, w.Body.String())
+		})
+	}
+}
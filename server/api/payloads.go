@@ -1,7 +1,9 @@
 package api
 
 import (
+	"encoding/base64"
 	"errors"
+	"fmt"
 
 	errors2 "github.com/cloudradar-monitoring/rport/server/api/errors"
 )
@@ -18,6 +20,13 @@ func NewSuccessPayload(data interface{}) SuccessPayload {
 	}
 }
 
+func NewSuccessPayloadWithMeta(data, meta interface{}) SuccessPayload {
+	return SuccessPayload{
+		Data: data,
+		Meta: meta,
+	}
+}
+
 // ErrorPayload represents a uniform format for all error API responses.
 type ErrorPayload struct {
 	Errors []ErrorPayloadItem `json:"errors"`
@@ -64,11 +73,13 @@ func newAPIErrorPayload(err errors2.APIError) ErrorPayload {
 func newAPIErrorPayloadItem(err errors2.APIError) ErrorPayloadItem {
 	if err.Err != nil && err.Message != "" {
 		return ErrorPayloadItem{
+			Code:   err.ErrCode,
 			Title:  err.Message,
 			Detail: err.Err.Error(),
 		}
 	}
 	return ErrorPayloadItem{
+		Code:   err.ErrCode,
 		Title:  err.Error(),
 		Detail: "",
 	}
@@ -91,6 +102,33 @@ type ExecuteInput struct {
 	Cwd         string `json:"cwd"`
 	IsSudo      bool   `json:"is_sudo"`
 	TimeoutSec  int    `json:"timeout_sec"`
-	ClientID    string
-	IsScript    bool
+	Umask       string `json:"umask"`
+	// Env holds environment variables to run the command with
+	Env map[string]string `json:"env"`
+	// RunAs is an OS user to run the command as
+	RunAs string `json:"run_as"`
+	// Stdin is a plain text written to the command stdin, StdinBase64 is an alternative for binary data
+	Stdin       string `json:"stdin"`
+	StdinBase64 string `json:"stdin_base64"`
+	// IsTemplate enables substitution of template variables, e.g. {{.JobID}}, into the command
+	IsTemplate bool `json:"is_template"`
+	// Params are values substituted into the command as {{.Params.<name>}}
+	Params   map[string]string `json:"params"`
+	ClientID string
+	IsScript bool
+}
+
+// GetStdin returns the command stdin decoding it from base64 if needed.
+func (e *ExecuteInput) GetStdin() (string, error) {
+	if e.StdinBase64 == "" {
+		return e.Stdin, nil
+	}
+	if e.Stdin != "" {
+		return "", errors.New("either stdin or stdin_base64 should be specified, not both")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(e.StdinBase64)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode stdin_base64: %v", err)
+	}
+	return string(decoded), nil
 }
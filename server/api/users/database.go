@@ -18,6 +18,7 @@ type UserDatabase struct {
 	groupsTableName string
 	twoFAOn         bool
 	hasTokenColumn  bool
+	hasTOTPColumns  bool
 	logger          *chshare.Logger
 }
 
@@ -43,6 +44,9 @@ func (d *UserDatabase) getSelectClause() string {
 	if d.hasTokenColumn {
 		s += ", token"
 	}
+	if d.hasTOTPColumns {
+		s += ", totp_secret, totp_recovery_codes"
+	}
 	return s
 }
 
@@ -52,6 +56,10 @@ func (d *UserDatabase) checkDatabaseTables() error {
 	if err == nil {
 		d.hasTokenColumn = true
 	}
+	_, err = d.db.Exec(fmt.Sprintf("SELECT totp_secret, totp_recovery_codes FROM `%s` LIMIT 0", d.usersTableName))
+	if err == nil {
+		d.hasTOTPColumns = true
+	}
 	_, err = d.db.Exec(fmt.Sprintf("SELECT %s FROM `%s` LIMIT 0", d.getSelectClause(), d.usersTableName))
 	if err != nil {
 		return err
@@ -207,6 +215,20 @@ func (d *UserDatabase) Update(usr *User, usernameToUpdate string) error {
 		params = append(params, usr.Token)
 	}
 
+	if usr.TOTPSecret != nil || usr.TOTPRecoveryCodes != nil {
+		if !d.hasTOTPColumns {
+			return fmt.Errorf("table `%s` has no totp_secret and totp_recovery_codes columns", d.usersTableName)
+		}
+		if usr.TOTPSecret != nil {
+			statements = append(statements, "`totp_secret` = ?")
+			params = append(params, usr.TOTPSecret)
+		}
+		if usr.TOTPRecoveryCodes != nil {
+			statements = append(statements, "`totp_recovery_codes` = ?")
+			params = append(params, usr.TOTPRecoveryCodes)
+		}
+	}
+
 	tx, err := d.db.Beginx()
 	if err != nil {
 		return err
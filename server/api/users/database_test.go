@@ -539,3 +539,42 @@ func assertGroupTableEquals(t *testing.T, db *sqlx.DB, groupTableName string, ex
 	query := fmt.Sprintf("SELECT `username`, `group` FROM `%s` order by `username`, `group`", groupTableName)
 	test.AssertRowsEqual(t, db, expectedRows, query, []interface{}{})
 }
+
+func TestUpdateTOTP(t *testing.T) {
+	db, err := sqlx.Connect("sqlite3", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	err = prepareTables(db)
+	require.NoError(t, err)
+
+	err = prepareDummyData(db)
+	require.NoError(t, err)
+
+	d, err := NewUserDatabase(db, "users", "groups", false, testLog)
+	require.NoError(t, err)
+
+	err = d.Update(&User{TOTPSecret: Token("secret")}, "user1")
+	assert.EqualError(t, err, "table `users` has no totp_secret and totp_recovery_codes columns")
+
+	_, err = db.Exec("ALTER TABLE `users` ADD COLUMN totp_secret TEXT")
+	require.NoError(t, err)
+	_, err = db.Exec("ALTER TABLE `users` ADD COLUMN totp_recovery_codes TEXT")
+	require.NoError(t, err)
+
+	d, err = NewUserDatabase(db, "users", "groups", false, testLog)
+	require.NoError(t, err)
+
+	err = d.Update(&User{TOTPSecret: Token("secret"), TOTPRecoveryCodes: Token("hash1,hash2")}, "user1")
+	require.NoError(t, err)
+
+	user, err := d.GetByUsername("user1")
+	require.NoError(t, err)
+	assert.Equal(t, Token("secret"), user.TOTPSecret)
+	assert.Equal(t, Token("hash1,hash2"), user.TOTPRecoveryCodes)
+
+	user, err = d.GetByUsername("user2")
+	require.NoError(t, err)
+	assert.Nil(t, user.TOTPSecret)
+	assert.Nil(t, user.TOTPRecoveryCodes)
+}
@@ -125,6 +125,12 @@ func (fa *FileAdapter) Update(dataToChange *User, usernameToFind string) error {
 	if dataToChange.Token != nil {
 		users[userFound].Token = dataToChange.Token
 	}
+	if dataToChange.TOTPSecret != nil {
+		users[userFound].TOTPSecret = dataToChange.TOTPSecret
+	}
+	if dataToChange.TOTPRecoveryCodes != nil {
+		users[userFound].TOTPRecoveryCodes = dataToChange.TOTPRecoveryCodes
+	}
 
 	err = fa.FileProvider.SaveUsersToFile(users)
 	if err != nil {
@@ -0,0 +1,332 @@
+package users
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/cloudradar-monitoring/rport/share/enums"
+)
+
+// LDAPConfig holds settings to authenticate users against an LDAP directory.
+type LDAPConfig struct {
+	// URL of the LDAP server, e.g. ldaps://ldap.example.com:636
+	URL string
+	// StartTLS upgrades a plain ldap:// connection to TLS
+	StartTLS bool
+	// BindDN and BindPassword of a service account used to look up users and their groups
+	BindDN       string
+	BindPassword string
+	// BaseDN to search users and groups in
+	BaseDN string
+	// UserFilter to find a user entry, %s is replaced with the escaped username
+	UserFilter string
+	// GroupFilter to find groups of a user, %s is replaced with the escaped DN of the user
+	GroupFilter string
+	// GroupAttribute holds a group name that is mapped to an rport group
+	GroupAttribute string
+	// Groups maps LDAP group names to rport groups, LDAP group names are case-insensitive
+	Groups map[string]string
+	// Timeout of LDAP requests, 0 means no timeout
+	Timeout time.Duration
+	// BindCacheTTL is how long a successful login is reused without binding again, 0 disables the cache
+	BindCacheTTL time.Duration
+}
+
+// String returns the config with the bind password redacted, so it can be logged.
+func (c LDAPConfig) String() string {
+	type ldapConfig LDAPConfig
+	if c.BindPassword != "" {
+		c.BindPassword = "[redacted]"
+	}
+	return fmt.Sprintf("%+v", ldapConfig(c))
+}
+
+// Authenticator is implemented by providers that verify passwords themselves instead of storing password hashes.
+type Authenticator interface {
+	Authenticate(username, password string) (*User, error)
+}
+
+// ldapConn is a subset of ldap.Client used by LDAPProvider
+type ldapConn interface {
+	Bind(username, password string) error
+	Search(*ldap.SearchRequest) (*ldap.SearchResult, error)
+	Close()
+}
+
+// LDAPProvider verifies user passwords by binding to an LDAP directory as the user. Groups of a user are
+// looked up and mapped to rport groups on each login, users are known until the next login or restart.
+type LDAPProvider struct {
+	*UserCache
+
+	config LDAPConfig
+	groups map[string]string
+	dial   func() (ldapConn, error)
+	now    func() time.Time
+
+	// binds holds successful logins by usernames for BindCacheTTL, passwords are kept as keyed hashes only
+	binds    map[string]*cachedBind
+	bindsMu  sync.Mutex
+	bindsKey []byte
+}
+
+type cachedBind struct {
+	passwordHash []byte
+	user         *User
+	expiry       time.Time
+}
+
+func NewLDAPProvider(config LDAPConfig) *LDAPProvider {
+	p := &LDAPProvider{
+		UserCache: NewUserCache(nil),
+		config:    config,
+		groups:    make(map[string]string, len(config.Groups)),
+		now:       time.Now,
+		binds:     make(map[string]*cachedBind),
+		bindsKey:  make([]byte, sha256.Size),
+	}
+	for ldapGroup, rportGroup := range config.Groups {
+		p.groups[strings.ToLower(ldapGroup)] = rportGroup
+	}
+	if _, err := rand.Read(p.bindsKey); err != nil {
+		// without a random key cached password hashes could be brute-forced offline, so don't cache
+		p.config.BindCacheTTL = 0
+	}
+	p.dial = p.dialLDAP
+	return p
+}
+
+func (p *LDAPProvider) dialLDAP() (ldapConn, error) {
+	conn, err := ldap.DialURL(p.config.URL)
+	if err != nil {
+		return nil, err
+	}
+	if p.config.Timeout > 0 {
+		conn.SetTimeout(p.config.Timeout)
+	}
+	if p.config.StartTLS {
+		if err := conn.StartTLS(nil); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to start tls: %v", err)
+		}
+	}
+	return conn, nil
+}
+
+func (p *LDAPProvider) Type() enums.ProviderSource {
+	return enums.ProviderSourceLDAP
+}
+
+// Authenticate binds as a given user to verify a given password and refreshes groups of the user.
+// Returns nil if credentials are invalid or the user is not a member of any mapped group.
+func (p *LDAPProvider) Authenticate(username, password string) (*User, error) {
+	// an empty password results in an unauthenticated bind which succeeds for any existing user
+	if username == "" || password == "" {
+		return nil, nil
+	}
+
+	if user := p.getCachedBind(username, password); user != nil {
+		return user, nil
+	}
+
+	conn, err := p.dial()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to ldap server: %v", err)
+	}
+	defer conn.Close()
+
+	if err := p.bindServiceAccount(conn); err != nil {
+		return nil, err
+	}
+
+	userDN, err := p.findUserDN(conn, username)
+	if err != nil || userDN == "" {
+		return nil, err
+	}
+
+	err = conn.Bind(userDN, password)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		p.removeCachedBind(username)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to bind as user: %v", err)
+	}
+
+	// user may not be allowed to search groups, so do it as the service account
+	if err := p.bindServiceAccount(conn); err != nil {
+		return nil, err
+	}
+
+	groups, err := p.findGroups(conn, userDN)
+	if err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		p.remove(username)
+		p.removeCachedBind(username)
+		return nil, nil
+	}
+
+	user := &User{
+		Username: username,
+		Groups:   groups,
+	}
+	p.save(user)
+	p.cacheBind(username, password, user)
+	return user, nil
+}
+
+func (p *LDAPProvider) hashPassword(password string) []byte {
+	mac := hmac.New(sha256.New, p.bindsKey)
+	_, _ = mac.Write([]byte(password))
+	return mac.Sum(nil)
+}
+
+// getCachedBind returns a user of a cached successful login with a given password or nil.
+func (p *LDAPProvider) getCachedBind(username, password string) *User {
+	if p.config.BindCacheTTL <= 0 {
+		return nil
+	}
+	p.bindsMu.Lock()
+	defer p.bindsMu.Unlock()
+	bind := p.binds[username]
+	if bind == nil {
+		return nil
+	}
+	if !p.now().Before(bind.expiry) {
+		delete(p.binds, username)
+		return nil
+	}
+	if !hmac.Equal(bind.passwordHash, p.hashPassword(password)) {
+		return nil
+	}
+	return bind.user
+}
+
+func (p *LDAPProvider) cacheBind(username, password string, user *User) {
+	if p.config.BindCacheTTL <= 0 {
+		return
+	}
+	p.bindsMu.Lock()
+	defer p.bindsMu.Unlock()
+	now := p.now()
+	for name, bind := range p.binds {
+		if !now.Before(bind.expiry) {
+			delete(p.binds, name)
+		}
+	}
+	p.binds[username] = &cachedBind{
+		passwordHash: p.hashPassword(password),
+		user:         user,
+		expiry:       now.Add(p.config.BindCacheTTL),
+	}
+}
+
+func (p *LDAPProvider) removeCachedBind(username string) {
+	p.bindsMu.Lock()
+	defer p.bindsMu.Unlock()
+	delete(p.binds, username)
+}
+
+func (p *LDAPProvider) bindServiceAccount(conn ldapConn) error {
+	if p.config.BindDN == "" {
+		return nil
+	}
+	if err := conn.Bind(p.config.BindDN, p.config.BindPassword); err != nil {
+		return fmt.Errorf("failed to bind with 'bind_dn': %v", err)
+	}
+	return nil
+}
+
+func (p *LDAPProvider) findUserDN(conn ldapConn, username string) (string, error) {
+	res, err := conn.Search(ldap.NewSearchRequest(
+		p.config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(p.config.UserFilter, ldap.EscapeFilter(username)),
+		[]string{"dn"},
+		nil,
+	))
+	if err != nil {
+		return "", fmt.Errorf("failed to search user: %v", err)
+	}
+	// ambiguous usernames are rejected
+	if len(res.Entries) != 1 {
+		return "", nil
+	}
+	return res.Entries[0].DN, nil
+}
+
+// findGroups returns sorted rport groups mapped from LDAP groups a given user is a member of
+func (p *LDAPProvider) findGroups(conn ldapConn, userDN string) ([]string, error) {
+	res, err := conn.Search(ldap.NewSearchRequest(
+		p.config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf(p.config.GroupFilter, ldap.EscapeFilter(userDN)),
+		[]string{p.config.GroupAttribute},
+		nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search user groups: %v", err)
+	}
+
+	found := make(map[string]bool)
+	for _, entry := range res.Entries {
+		for _, name := range entry.GetAttributeValues(p.config.GroupAttribute) {
+			if group, ok := p.groups[strings.ToLower(name)]; ok {
+				found[group] = true
+			}
+		}
+	}
+
+	groups := make([]string, 0, len(found))
+	for group := range found {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups, nil
+}
+
+func (p *LDAPProvider) save(user *User) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.byUsername[user.Username] = user
+}
+
+func (p *LDAPProvider) remove(username string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.byUsername, username)
+}
+
+// GetAllGroups returns rport groups that LDAP groups are mapped to.
+func (p *LDAPProvider) GetAllGroups() ([]string, error) {
+	unique := make(map[string]bool, len(p.groups))
+	for _, group := range p.groups {
+		unique[group] = true
+	}
+	groups := make([]string, 0, len(unique))
+	for group := range unique {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups, nil
+}
+
+func (p *LDAPProvider) Add(usr *User) error {
+	return errors.New("operation not supported for LDAP authentication, users are managed in the directory")
+}
+func (p *LDAPProvider) Update(usr *User, username string) error {
+	return errors.New("operation not supported for LDAP authentication, users are managed in the directory")
+}
+func (p *LDAPProvider) Delete(username string) error {
+	return errors.New("operation not supported for LDAP authentication, users are managed in the directory")
+}
@@ -0,0 +1,280 @@
+package users
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeLDAPConn struct {
+	passwords   map[string]string
+	users       map[string][]*ldap.Entry
+	groups      map[string][]*ldap.Entry
+	searchErr   error
+	boundDN     string
+	groupsBound []string
+}
+
+func (c *fakeLDAPConn) Bind(username, password string) error {
+	if c.passwords[username] != password {
+		return ldap.NewError(ldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+	}
+	c.boundDN = username
+	return nil
+}
+
+func (c *fakeLDAPConn) Search(req *ldap.SearchRequest) (*ldap.SearchResult, error) {
+	if c.searchErr != nil {
+		return nil, c.searchErr
+	}
+	if entries, ok := c.users[req.Filter]; ok {
+		return &ldap.SearchResult{Entries: entries}, nil
+	}
+	c.groupsBound = append(c.groupsBound, c.boundDN)
+	return &ldap.SearchResult{Entries: c.groups[req.Filter]}, nil
+}
+
+func (c *fakeLDAPConn) Close() {}
+
+func group(name string) *ldap.Entry {
+	return ldap.NewEntry("cn="+name+",ou=groups,dc=example,dc=com", map[string][]string{"cn": {name}})
+}
+
+func TestLDAPProviderAuthenticate(t *testing.T) {
+	const (
+		serviceDN = "cn=rport,dc=example,dc=com"
+		aliceDN   = "uid=alice,ou=people,dc=example,dc=com"
+		bobDN     = "uid=bob,ou=people,dc=example,dc=com"
+	)
+	newConn := func() *fakeLDAPConn {
+		return &fakeLDAPConn{
+			passwords: map[string]string{
+				serviceDN: "service-pass",
+				aliceDN:   "alice-pass",
+				bobDN:     "bob-pass",
+			},
+			users: map[string][]*ldap.Entry{
+				"(uid=alice)": {ldap.NewEntry(aliceDN, nil)},
+				"(uid=bob)":   {ldap.NewEntry(bobDN, nil)},
+				"(uid=twins)": {ldap.NewEntry("uid=twins,ou=a", nil), ldap.NewEntry("uid=twins,ou=b", nil)},
+				`(uid=\2a)`:   {},
+			},
+			groups: map[string][]*ldap.Entry{
+				"(member=" + aliceDN + ")": {group("Domain Admins"), group("developers"), group("unmapped")},
+				"(member=" + bobDN + ")":   {group("unmapped")},
+			},
+		}
+	}
+	config := LDAPConfig{
+		BindDN:         serviceDN,
+		BindPassword:   "service-pass",
+		BaseDN:         "dc=example,dc=com",
+		UserFilter:     "(uid=%s)",
+		GroupFilter:    "(member=%s)",
+		GroupAttribute: "cn",
+		Groups: map[string]string{
+			"domain admins": Administrators,
+			"Developers":    "devs",
+		},
+	}
+
+	testCases := []struct {
+		name       string
+		username   string
+		password   string
+		searchErr  error
+		wantUser   *User
+		wantErr    string
+		wantCached bool
+	}{
+		{
+			name:       "valid credentials",
+			username:   "alice",
+			password:   "alice-pass",
+			wantUser:   &User{Username: "alice", Groups: []string{Administrators, "devs"}},
+			wantCached: true,
+		},
+		{
+			name:     "wrong password",
+			username: "alice",
+			password: "wrong",
+		},
+		{
+			name:     "empty password",
+			username: "alice",
+			password: "",
+		},
+		{
+			name:     "unknown user",
+			username: "carol",
+			password: "carol-pass",
+		},
+		{
+			name:     "ambiguous user",
+			username: "twins",
+			password: "twins-pass",
+		},
+		{
+			name:     "filter is escaped",
+			username: "*",
+			password: "any",
+		},
+		{
+			name:     "no mapped groups",
+			username: "bob",
+			password: "bob-pass",
+		},
+		{
+			name:      "search error",
+			username:  "alice",
+			password:  "alice-pass",
+			searchErr: errors.New("connection reset"),
+			wantErr:   "failed to search user: connection reset",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conn := newConn()
+			conn.searchErr = tc.searchErr
+			p := NewLDAPProvider(config)
+			p.dial = func() (ldapConn, error) {
+				return conn, nil
+			}
+
+			gotUser, gotErr := p.Authenticate(tc.username, tc.password)
+
+			if tc.wantErr != "" {
+				assert.EqualError(t, gotErr, tc.wantErr)
+			} else {
+				assert.NoError(t, gotErr)
+			}
+			assert.Equal(t, tc.wantUser, gotUser)
+
+			cached, err := p.GetByUsername(tc.username)
+			require.NoError(t, err)
+			if tc.wantCached {
+				assert.Equal(t, tc.wantUser, cached)
+				// groups are searched as the service account
+				assert.Equal(t, []string{serviceDN}, conn.groupsBound)
+			} else {
+				assert.Nil(t, cached)
+			}
+		})
+	}
+}
+
+func TestLDAPProviderRefreshesGroupsPerLogin(t *testing.T) {
+	const userDN = "uid=alice,dc=example,dc=com"
+	conn := &fakeLDAPConn{
+		passwords: map[string]string{userDN: "pass"},
+		users:     map[string][]*ldap.Entry{"(uid=alice)": {ldap.NewEntry(userDN, nil)}},
+		groups:    map[string][]*ldap.Entry{"(member=" + userDN + ")": {group("admins")}},
+	}
+	p := NewLDAPProvider(LDAPConfig{
+		UserFilter:     "(uid=%s)",
+		GroupFilter:    "(member=%s)",
+		GroupAttribute: "cn",
+		Groups:         map[string]string{"admins": Administrators, "ops": "operators"},
+	})
+	p.dial = func() (ldapConn, error) {
+		return conn, nil
+	}
+
+	user, err := p.Authenticate("alice", "pass")
+	require.NoError(t, err)
+	assert.Equal(t, []string{Administrators}, user.Groups)
+
+	conn.groups["(member="+userDN+")"] = []*ldap.Entry{group("ops")}
+	user, err = p.Authenticate("alice", "pass")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"operators"}, user.Groups)
+
+	cached, err := p.GetByUsername("alice")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"operators"}, cached.Groups)
+
+	// removed from all mapped groups
+	conn.groups["(member="+userDN+")"] = nil
+	user, err = p.Authenticate("alice", "pass")
+	require.NoError(t, err)
+	assert.Nil(t, user)
+	cached, err = p.GetByUsername("alice")
+	require.NoError(t, err)
+	assert.Nil(t, cached)
+
+	groups, err := p.GetAllGroups()
+	require.NoError(t, err)
+	assert.Equal(t, []string{Administrators, "operators"}, groups)
+}
+
+func TestLDAPProviderCachesBinds(t *testing.T) {
+	const userDN = "uid=alice,dc=example,dc=com"
+	dials := 0
+	conn := &fakeLDAPConn{
+		passwords: map[string]string{userDN: "pass"},
+		users:     map[string][]*ldap.Entry{"(uid=alice)": {ldap.NewEntry(userDN, nil)}},
+		groups:    map[string][]*ldap.Entry{"(member=" + userDN + ")": {group("admins")}},
+	}
+	p := NewLDAPProvider(LDAPConfig{
+		UserFilter:     "(uid=%s)",
+		GroupFilter:    "(member=%s)",
+		GroupAttribute: "cn",
+		Groups:         map[string]string{"admins": Administrators},
+		BindCacheTTL:   time.Minute,
+	})
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	p.now = func() time.Time { return now }
+	p.dial = func() (ldapConn, error) {
+		dials++
+		return conn, nil
+	}
+
+	user, err := p.Authenticate("alice", "pass")
+	require.NoError(t, err)
+	require.NotNil(t, user)
+	assert.Equal(t, 1, dials)
+
+	user, err = p.Authenticate("alice", "pass")
+	require.NoError(t, err)
+	require.NotNil(t, user)
+	assert.Equal(t, 1, dials, "cached login doesn't bind")
+
+	user, err = p.Authenticate("alice", "wrong")
+	require.NoError(t, err)
+	assert.Nil(t, user)
+	assert.Equal(t, 2, dials, "other password is verified by the directory")
+
+	// the invalid password dropped the cached login
+	user, err = p.Authenticate("alice", "pass")
+	require.NoError(t, err)
+	require.NotNil(t, user)
+	assert.Equal(t, 3, dials)
+
+	now = now.Add(time.Minute)
+	user, err = p.Authenticate("alice", "pass")
+	require.NoError(t, err)
+	require.NotNil(t, user)
+	assert.Equal(t, 4, dials, "expired cached login")
+
+	for _, bind := range p.binds {
+		assert.NotContains(t, string(bind.passwordHash), "pass")
+	}
+}
+
+func TestLDAPConfigStringRedactsBindPassword(t *testing.T) {
+	c := LDAPConfig{
+		BindDN:       "cn=rport,dc=example,dc=com",
+		BindPassword: "secret-pass",
+	}
+
+	got := fmt.Sprint(c)
+
+	assert.NotContains(t, got, "secret-pass")
+	assert.Contains(t, got, "BindPassword:[redacted]")
+}
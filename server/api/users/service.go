@@ -130,7 +130,8 @@ func (as *APIService) validate(dataToChange *User, usernameToFind string) error
 		}
 	} else {
 		if (dataToChange.Username == "" || dataToChange.Username == usernameToFind) &&
-			dataToChange.Password == "" && dataToChange.Groups == nil && (!as.TwoFAOn || dataToChange.TwoFASendTo == "") && dataToChange.Token == nil {
+			dataToChange.Password == "" && dataToChange.Groups == nil && (!as.TwoFAOn || dataToChange.TwoFASendTo == "") && dataToChange.Token == nil &&
+			dataToChange.TOTPSecret == nil && dataToChange.TOTPRecoveryCodes == nil {
 			errs = append(errs, errors2.APIError{
 				Message:    "nothing to change",
 				HTTPStatus: http.StatusBadRequest,
@@ -11,6 +11,11 @@ type User struct {
 	Groups      []string `json:"groups" db:"-"`
 	TwoFASendTo string   `json:"two_fa_send_to" db:"two_fa_send_to"`
 	Token       *string  `json:"token,omitempty" db:"token"`
+
+	// TOTPSecret is a base32 encoded secret of an enrolled authenticator app.
+	TOTPSecret *string `json:"totp_secret,omitempty" db:"totp_secret"`
+	// TOTPRecoveryCodes is a comma separated list of sha256 hashes of unused one-time recovery codes.
+	TOTPRecoveryCodes *string `json:"totp_recovery_codes,omitempty" db:"totp_recovery_codes"`
 }
 
 func (u User) GetGroups() []string {
@@ -0,0 +1,166 @@
+package chserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/cloudradar-monitoring/rport/server/api"
+	"github.com/cloudradar-monitoring/rport/server/apikeys"
+	"github.com/cloudradar-monitoring/rport/share/random"
+)
+
+const routeParamAPIKeyID = "apikey_id"
+
+var errInsufficientScope = errors.New("api key has insufficient scope")
+
+type postAPIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type postAPIKeyResponse struct {
+	*apikeys.APIKey
+	Key string `json:"key"`
+}
+
+// handlePostAPIKey creates a new API key of the current user, the key value is returned only once.
+func (al *APIListener) handlePostAPIKey(w http.ResponseWriter, req *http.Request) {
+	var reqBody postAPIKeyRequest
+	if err := parseRequestBody(req.Body, &reqBody); err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	reqBody.Name = strings.TrimSpace(reqBody.Name)
+	if reqBody.Name == "" {
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, "Missing API key name.")
+		return
+	}
+	if err := apikeys.ValidateScopes(reqBody.Scopes); err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusBadRequest, "Invalid API key scopes.", err)
+		return
+	}
+	now := time.Now().UTC()
+	if reqBody.ExpiresAt != nil && !reqBody.ExpiresAt.After(now) {
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, "API key expiration time should be in the future.")
+		return
+	}
+
+	username := api.GetUser(req.Context(), al.Logger)
+	existing, err := al.apiKeyProvider.GetAllByUsername(username)
+	if err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, "Failed to get API keys.", err)
+		return
+	}
+	for _, cur := range existing {
+		if cur.Name == reqBody.Name {
+			al.jsonErrorResponseWithTitle(w, http.StatusConflict, fmt.Sprintf("API key with name %q already exists.", reqBody.Name))
+			return
+		}
+	}
+
+	id, err := random.UUID4()
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+	key, err := apikeys.NewKey()
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	apiKey := &apikeys.APIKey{
+		ID:        id,
+		Username:  username,
+		Name:      reqBody.Name,
+		KeyHash:   apikeys.HashKey(key),
+		Scopes:    reqBody.Scopes,
+		CreatedAt: now,
+		ExpiresAt: reqBody.ExpiresAt,
+	}
+	if err := al.apiKeyProvider.Create(apiKey); err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, "Failed to create API key.", err)
+		return
+	}
+
+	al.Debugf("API key[id=%q] created by %q.", id, username)
+
+	al.writeJSONResponse(w, http.StatusCreated, api.NewSuccessPayload(postAPIKeyResponse{
+		APIKey: apiKey,
+		Key:    key,
+	}))
+}
+
+func (al *APIListener) handleGetAPIKeys(w http.ResponseWriter, req *http.Request) {
+	keys, err := al.apiKeyProvider.GetAllByUsername(api.GetUser(req.Context(), al.Logger))
+	if err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, "Failed to get API keys.", err)
+		return
+	}
+
+	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(keys))
+}
+
+func (al *APIListener) handleDeleteAPIKey(w http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)[routeParamAPIKeyID]
+	username := api.GetUser(req.Context(), al.Logger)
+	deleted, err := al.apiKeyProvider.Delete(username, id)
+	if err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to delete API key[id=%q].", id), err)
+		return
+	}
+	if !deleted {
+		al.jsonErrorResponseWithTitle(w, http.StatusNotFound, fmt.Sprintf("API key[id=%q] not found.", id))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	al.Debugf("API key[id=%q] deleted by %q.", id, username)
+}
+
+// handleAPIKey authenticates a request by an API key and checks the key grants a scope of the requested route.
+func (al *APIListener) handleAPIKey(r *http.Request, key string) (bool, string, error) {
+	if al.apiKeyProvider == nil {
+		return false, "", nil
+	}
+
+	apiKey, err := al.apiKeyProvider.GetByHash(apikeys.HashKey(key))
+	if err != nil {
+		return false, "", fmt.Errorf("failed to get api key: %v", err)
+	}
+	if apiKey == nil || apiKey.IsExpired(time.Now()) {
+		return false, "", nil
+	}
+
+	if al.bannedUsers.IsBanned(apiKey.Username) {
+		return false, apiKey.Username, ErrTooManyRequests
+	}
+
+	user, err := al.userService.GetByUsername(apiKey.Username)
+	if err != nil {
+		return false, apiKey.Username, fmt.Errorf("failed to get user: %v", err)
+	}
+	if user == nil {
+		return false, apiKey.Username, nil
+	}
+
+	pathTemplate := r.URL.Path
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			pathTemplate = tmpl
+		}
+	}
+	if !apiKey.Allows(apikeys.RequiredScope(r.Method, pathTemplate)) {
+		return true, apiKey.Username, errInsufficientScope
+	}
+
+	return true, apiKey.Username, nil
+}
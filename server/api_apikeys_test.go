@@ -0,0 +1,245 @@
+package chserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/rport/server/api"
+	"github.com/cloudradar-monitoring/rport/server/api/users"
+	"github.com/cloudradar-monitoring/rport/server/apikeys"
+	"github.com/cloudradar-monitoring/rport/share/security"
+)
+
+func TestHandleAPIKeys(t *testing.T) {
+	apiKeyProvider, err := apikeys.NewSqliteProvider(":memory:")
+	require.NoError(t, err)
+	defer apiKeyProvider.Close()
+
+	al := APIListener{
+		Logger:           testLog,
+		insecureForTests: true,
+		apiKeyProvider:   apiKeyProvider,
+		Server: &Server{
+			config: &Config{
+				Server: ServerConfig{MaxRequestBytes: 1024 * 1024},
+			},
+		},
+	}
+	al.initRouter()
+
+	do := func(method, url, body, username string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req = req.WithContext(api.WithUser(req.Context(), username))
+		al.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// invalid requests
+	w := do(http.MethodPost, "/api/v1/me/apikeys", `{"scopes":["clients:read"]}`, "user1")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = do(http.MethodPost, "/api/v1/me/apikeys", `{"name":"ci","scopes":["clients:delete"]}`, "user1")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), `invalid scope \"clients:delete\"`)
+	w = do(http.MethodPost, "/api/v1/me/apikeys", `{"name":"ci","scopes":["clients:read"],"expires_at":"2020-01-01T00:00:00Z"}`, "user1")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// create
+	w = do(http.MethodPost, "/api/v1/me/apikeys", `{"name":"ci","scopes":["clients:read","commands:write"],"expires_at":"2100-01-01T00:00:00Z"}`, "user1")
+	require.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Data struct {
+			ID        string     `json:"id"`
+			Name      string     `json:"name"`
+			Scopes    []string   `json:"scopes"`
+			ExpiresAt *time.Time `json:"expires_at"`
+			Key       string     `json:"key"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "ci", created.Data.Name)
+	assert.Equal(t, []string{"clients:read", "commands:write"}, created.Data.Scopes)
+	assert.Equal(t, time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC), created.Data.ExpiresAt.UTC())
+	assert.True(t, apikeys.IsKey(created.Data.Key))
+
+	stored, err := apiKeyProvider.GetByHash(apikeys.HashKey(created.Data.Key))
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.Equal(t, created.Data.ID, stored.ID)
+	assert.Equal(t, "user1", stored.Username)
+
+	// duplicate name
+	w = do(http.MethodPost, "/api/v1/me/apikeys", `{"name":"ci","scopes":["clients:read"]}`, "user1")
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// list does not return key values
+	w = do(http.MethodGet, "/api/v1/me/apikeys", "", "user1")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), created.Data.Key)
+	assert.NotContains(t, w.Body.String(), stored.KeyHash)
+	assert.Contains(t, w.Body.String(), `"id":"`+created.Data.ID+`"`)
+
+	w = do(http.MethodGet, "/api/v1/me/apikeys", "", "user2")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"data":[]}`, w.Body.String())
+
+	// keys of other users can't be revoked
+	w = do(http.MethodDelete, "/api/v1/me/apikeys/"+created.Data.ID, "", "user2")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = do(http.MethodDelete, "/api/v1/me/apikeys/"+created.Data.ID, "", "user1")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	stored, err = apiKeyProvider.GetByHash(apikeys.HashKey(created.Data.Key))
+	require.NoError(t, err)
+	assert.Nil(t, stored)
+}
+
+func TestWrapWithAuthMiddlewareAPIKey(t *testing.T) {
+	apiKeyProvider, err := apikeys.NewSqliteProvider(":memory:")
+	require.NoError(t, err)
+	defer apiKeyProvider.Close()
+
+	user := &users.User{Username: "user1"}
+	past := time.Now().Add(-time.Minute)
+	keys := map[string]*apikeys.APIKey{
+		"rpk_valid":        {ID: "1", Username: user.Username, Name: "valid", Scopes: []string{"clients:read", "commands:write"}},
+		"rpk_expired":      {ID: "2", Username: user.Username, Name: "expired", Scopes: []string{"clients:read"}, ExpiresAt: &past},
+		"rpk_deleted_user": {ID: "3", Username: "deleted-user", Name: "valid", Scopes: []string{"clients:read"}},
+		// stored before me:write was rejected
+		"rpk_me_write": {ID: "4", Username: user.Username, Name: "me", Scopes: []string{"me:write"}},
+	}
+	for key, apiKey := range keys {
+		apiKey.KeyHash = apikeys.HashKey(key)
+		apiKey.CreatedAt = time.Now()
+		require.NoError(t, apiKeyProvider.Create(apiKey))
+	}
+
+	al := APIListener{
+		Logger:         testLog,
+		apiSessionRepo: NewAPISessionRepository(),
+		bannedUsers:    security.NewBanList(0),
+		userService:    users.NewAPIService(users.NewStaticProvider([]*users.User{user}), false),
+		apiKeyProvider: apiKeyProvider,
+		Server: &Server{
+			config: &Config{},
+		},
+	}
+	handler := al.wrapWithAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, user.Username, api.GetUser(r.Context(), nil))
+	}))
+	router := mux.NewRouter()
+	router.Handle("/api/v1/clients", handler).Methods(http.MethodGet, http.MethodPost)
+	router.Handle("/api/v1/clients/{client_id}/commands", handler).Methods(http.MethodPost)
+	router.Handle("/api/v1/me/apikeys", handler).Methods(http.MethodPost)
+	router.Handle("/api/v1/me", handler).Methods(http.MethodGet, http.MethodPut)
+	router.Handle("/api/v1/me/token", handler).Methods(http.MethodPost)
+	router.Handle("/api/v1/me/totp", handler).Methods(http.MethodPost)
+
+	testCases := []struct {
+		Name           string
+		Key            string
+		Method         string
+		URL            string
+		ExpectedStatus int
+	}{
+		{
+			Name:           "read scope",
+			Key:            "rpk_valid",
+			Method:         http.MethodGet,
+			URL:            "/api/v1/clients",
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "write scope",
+			Key:            "rpk_valid",
+			Method:         http.MethodPost,
+			URL:            "/api/v1/clients/client-1/commands",
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "missing write scope",
+			Key:            "rpk_valid",
+			Method:         http.MethodPost,
+			URL:            "/api/v1/clients",
+			ExpectedStatus: http.StatusForbidden,
+		},
+		{
+			Name:           "api keys can't be managed by api keys",
+			Key:            "rpk_valid",
+			Method:         http.MethodPost,
+			URL:            "/api/v1/me/apikeys",
+			ExpectedStatus: http.StatusForbidden,
+		},
+		{
+			Name:           "profile can be read",
+			Key:            "rpk_me_write",
+			Method:         http.MethodGet,
+			URL:            "/api/v1/me",
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "profile can't be changed by api keys",
+			Key:            "rpk_me_write",
+			Method:         http.MethodPut,
+			URL:            "/api/v1/me",
+			ExpectedStatus: http.StatusForbidden,
+		},
+		{
+			Name:           "api token can't be created by api keys",
+			Key:            "rpk_me_write",
+			Method:         http.MethodPost,
+			URL:            "/api/v1/me/token",
+			ExpectedStatus: http.StatusForbidden,
+		},
+		{
+			Name:           "totp can't be enrolled by api keys",
+			Key:            "rpk_me_write",
+			Method:         http.MethodPost,
+			URL:            "/api/v1/me/totp",
+			ExpectedStatus: http.StatusForbidden,
+		},
+		{
+			Name:           "expired key",
+			Key:            "rpk_expired",
+			Method:         http.MethodGet,
+			URL:            "/api/v1/clients",
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:           "key of deleted user",
+			Key:            "rpk_deleted_user",
+			Method:         http.MethodGet,
+			URL:            "/api/v1/clients",
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:           "unknown key",
+			Key:            "rpk_unknown",
+			Method:         http.MethodGet,
+			URL:            "/api/v1/clients",
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.Method, tc.URL, nil)
+			req.Header.Set("Authorization", "Bearer "+tc.Key)
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.ExpectedStatus, w.Code)
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package chserver
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+
+	"github.com/cloudradar-monitoring/rport/server/api"
+	"github.com/cloudradar-monitoring/rport/server/auditlog"
+	"github.com/cloudradar-monitoring/rport/share/query"
+)
+
+var routeVarRegex = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+type auditListMeta struct {
+	Count int `json:"count"`
+}
+
+// statusRecorder remembers a status code written to a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	// onHijack is called when the connection is taken over, e.g. by a websocket
+	onHijack func()
+}
+
+// Hijack lets websockets take over the connection, it's recorded as switching protocols.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response writer doesn't support hijacking")
+	}
+	conn, rw, err := h.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	r.status = http.StatusSwitchingProtocols
+	if r.onHijack != nil {
+		r.onHijack()
+	}
+	return conn, rw, nil
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// wrapWithAuditLog records state-changing calls of a given handler to the audit log. It should be applied inside
+// the auth middleware to know the user. Websockets are recorded when they are started, because they run commands
+// until they are closed.
+func (al *APIListener) wrapWithAuditLog(next http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !auditlog.IsAudited(r.Method) && !websocket.IsWebSocketUpgrade(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		saved := false
+		rec := &statusRecorder{ResponseWriter: w}
+		rec.onHijack = func() {
+			saved = true
+			al.saveAuditLogEntry(r, rec.status)
+		}
+		next.ServeHTTP(rec, r)
+		if saved {
+			return
+		}
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		al.saveAuditLogEntry(r, rec.status)
+	}
+}
+
+func (al *APIListener) saveAuditLogEntry(r *http.Request, status int) {
+	entry := &auditlog.Entry{
+		Timestamp: time.Now(),
+		Username:  api.GetUser(r.Context(), al.Logger),
+		Method:    r.Method,
+		Route:     r.URL.Path,
+		Status:    status,
+	}
+	if route := mux.CurrentRoute(r); route != nil {
+		if tmpl, err := route.GetPathTemplate(); err == nil {
+			entry.Route = tmpl
+			entry.TargetID = lastRouteVar(tmpl, mux.Vars(r))
+		}
+	}
+	if err := al.auditLogProvider.Save(entry); err != nil {
+		al.Errorf("Failed to save audit log entry of %s %s: %v", entry.Method, entry.Route, err)
+	}
+}
+
+// lastRouteVar returns a value of the last param in a given path template, it identifies the target of a call.
+func lastRouteVar(tmpl string, vars map[string]string) string {
+	matches := routeVarRegex.FindAllStringSubmatch(tmpl, -1)
+	if len(matches) == 0 {
+		return ""
+	}
+	return vars[matches[len(matches)-1][1]]
+}
+
+func (al *APIListener) handleGetAuditLog(w http.ResponseWriter, req *http.Request) {
+	listOptions := query.GetListOptions(req)
+	if err := query.ValidateListOptions(listOptions, auditlog.SupportedSortAndFilters, nil); err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	pagination, err := query.ExtractPagination(req, auditlog.DefaultLimit, auditlog.MaxLimit)
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	entries, total, err := al.auditLogProvider.List(listOptions, pagination)
+	if err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, "Failed to get audit log.", err)
+		return
+	}
+
+	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayloadWithMeta(entries, auditListMeta{Count: total}))
+}
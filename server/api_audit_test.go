@@ -0,0 +1,157 @@
+package chserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/rport/server/api/users"
+	"github.com/cloudradar-monitoring/rport/server/auditlog"
+	"github.com/cloudradar-monitoring/rport/share/security"
+)
+
+func TestAuditLog(t *testing.T) {
+	admin := &users.User{Username: "admin", Groups: []string{users.Administrators}}
+	user1 := &users.User{Username: "user1"}
+	auditLogProvider, err := auditlog.NewSqliteProvider(":memory:")
+	require.NoError(t, err)
+	defer auditLogProvider.Close()
+	al := APIListener{
+		Logger:           testLog,
+		apiSessionRepo:   NewAPISessionRepository(),
+		bannedUsers:      security.NewBanList(0),
+		userService:      users.NewAPIService(users.NewStaticProvider([]*users.User{admin, user1}), false),
+		auditLogProvider: auditLogProvider,
+		Server: &Server{
+			config: &Config{
+				API: APIConfig{
+					JWTSecret: "secret",
+				},
+				Server: ServerConfig{MaxRequestBytes: 1024 * 1024},
+			},
+		},
+	}
+	al.initRouter()
+
+	login := func(username string) string {
+		token, err := al.createAuthToken(httptest.NewRequest(http.MethodGet, "/api/v1/login", nil), time.Hour, username)
+		require.NoError(t, err)
+		return token
+	}
+	adminToken := login(admin.Username)
+	user1Token := login(user1.Username)
+
+	do := func(method, url, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, url, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		al.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// read-only and unauthenticated calls are not logged
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/v1/me/sessions", user1Token).Code)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodDelete, "/api/v1/me/sessions/some-session", "").Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodGet, "/api/v1/audit", user1Token).Code)
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/api/v1/me/sessions/unknown-session", user1Token).Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/api/v1/clients-auth", user1Token).Code)
+
+	w := do(http.MethodGet, "/api/v1/audit", adminToken)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp struct {
+		Data []*auditlog.Entry `json:"data"`
+		Meta auditListMeta     `json:"meta"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 2, resp.Meta.Count)
+	require.Len(t, resp.Data, 2)
+	for _, e := range resp.Data {
+		assert.Equal(t, user1.Username, e.Username)
+		assert.False(t, e.Timestamp.IsZero())
+	}
+	// newest first
+	assert.Equal(t, http.MethodPost, resp.Data[0].Method)
+	assert.Equal(t, "/api/v1/clients-auth", resp.Data[0].Route)
+	assert.Equal(t, "", resp.Data[0].TargetID)
+	assert.Equal(t, http.StatusForbidden, resp.Data[0].Status)
+	assert.Equal(t, http.MethodDelete, resp.Data[1].Method)
+	assert.Equal(t, "/api/v1/me/sessions/{session_id}", resp.Data[1].Route)
+	assert.Equal(t, "unknown-session", resp.Data[1].TargetID)
+	assert.Equal(t, http.StatusNotFound, resp.Data[1].Status)
+
+	w = do(http.MethodGet, "/api/v1/audit?filter[method]=DELETE", adminToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 1, resp.Meta.Count)
+	require.Len(t, resp.Data, 1)
+	assert.Equal(t, "unknown-session", resp.Data[0].TargetID)
+
+	w = do(http.MethodGet, "/api/v1/audit?filter[unknown]=1", adminToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// websockets executing commands are logged when they are started
+	srv := httptest.NewServer(al.router)
+	defer srv.Close()
+	wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + "/api/v1/ws/commands?" + WebSocketAccessTokenQueryParam + "=" + user1Token
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	w = do(http.MethodGet, "/api/v1/audit?filter[route]=/api/v1/ws/commands", adminToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Data, 1)
+	assert.Equal(t, user1.Username, resp.Data[0].Username)
+	assert.Equal(t, http.MethodGet, resp.Data[0].Method)
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.Data[0].Status)
+}
+
+func TestLastRouteVar(t *testing.T) {
+	testCases := []struct {
+		name string
+		tmpl string
+		vars map[string]string
+		want string
+	}{
+		{
+			name: "no vars",
+			tmpl: "/api/v1/clients-auth",
+			want: "",
+		},
+		{
+			name: "single var",
+			tmpl: "/api/v1/clients/{client_id}/commands",
+			vars: map[string]string{"client_id": "c1"},
+			want: "c1",
+		},
+		{
+			name: "last of multiple vars",
+			tmpl: "/api/v1/clients/{client_id}/tunnels/{tunnel_id}",
+			vars: map[string]string{"client_id": "c1", "tunnel_id": "t1"},
+			want: "t1",
+		},
+		{
+			name: "var with pattern",
+			tmpl: "/api/v1/users/{user_id:[a-z]+}",
+			vars: map[string]string{"user_id": "admin"},
+			want: "admin",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, lastRouteVar(tc.tmpl, tc.vars))
+		})
+	}
+}
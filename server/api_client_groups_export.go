@@ -0,0 +1,181 @@
+package chserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/cloudradar-monitoring/rport/server/api"
+	"github.com/cloudradar-monitoring/rport/server/cgroups"
+)
+
+const (
+	clientGroupImportCreated  = "created"
+	clientGroupImportUpdated  = "updated"
+	clientGroupImportConflict = "conflict"
+)
+
+// clientGroupParamColumns are columns client groups can be filtered by.
+var clientGroupParamColumns = jsonFieldNames(cgroups.ClientParams{})
+
+// clientGroupDefinition is a client group as it's exported and imported, without clients that belong to it.
+type clientGroupDefinition struct {
+	ID          string                `json:"id"`
+	Description string                `json:"description"`
+	Params      *cgroups.ClientParams `json:"params"`
+}
+
+// clientGroupImportResult is an outcome of importing a single client group.
+type clientGroupImportResult struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// handleExportClientGroups returns definitions of all client groups as a JSON file that can be imported on another server.
+func (al *APIListener) handleExportClientGroups(w http.ResponseWriter, req *http.Request) {
+	groups, err := al.clientGroupProvider.GetAll(req.Context())
+	if err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, "Failed to get client groups.", err)
+		return
+	}
+
+	res := make([]clientGroupDefinition, 0, len(groups))
+	for _, cur := range groups {
+		res = append(res, clientGroupDefinition{
+			ID:          cur.ID,
+			Description: cur.Description,
+			Params:      cur.Params,
+		})
+	}
+
+	w.Header().Set("Content-Disposition", "attachment; filename=client-groups.json")
+	al.writeJSONResponse(w, http.StatusOK, res)
+}
+
+// handleImportClientGroups creates client groups from exported definitions. Nothing is imported if any group is invalid.
+// Groups with ids that already exist are reported as conflicts and left as is, unless overwrite param is set.
+func (al *APIListener) handleImportClientGroups(w http.ResponseWriter, req *http.Request) {
+	overwrite := false
+	if v := req.URL.Query().Get("overwrite"); v != "" {
+		var err error
+		overwrite, err = strconv.ParseBool(v)
+		if err != nil {
+			al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, fmt.Sprintf("Invalid overwrite value %q, expected a boolean.", v))
+			return
+		}
+	}
+
+	var raw []json.RawMessage
+	if err := parseRequestBody(req.Body, &raw); err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	groups := make([]*cgroups.ClientGroup, 0, len(raw))
+	seen := make(map[string]bool, len(raw))
+	for i, cur := range raw {
+		group, err := parseImportedClientGroup(cur)
+		if err == nil && seen[group.ID] {
+			err = fmt.Errorf("duplicate group ID %q", group.ID)
+		}
+		if err != nil {
+			al.jsonErrorResponseWithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid client group #%d.", i+1), err)
+			return
+		}
+		seen[group.ID] = true
+		groups = append(groups, group)
+	}
+
+	ctx := req.Context()
+	res := make([]clientGroupImportResult, 0, len(groups))
+	for _, group := range groups {
+		existing, err := al.clientGroupProvider.Get(ctx, group.ID)
+		if err != nil {
+			al.jsonErrorResponseWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to find client group[id=%q].", group.ID), err)
+			return
+		}
+
+		switch {
+		case existing == nil:
+			err = al.clientGroupProvider.Create(ctx, group)
+			res = append(res, clientGroupImportResult{ID: group.ID, Status: clientGroupImportCreated})
+		case overwrite:
+			err = al.clientGroupProvider.Update(ctx, group)
+			res = append(res, clientGroupImportResult{ID: group.ID, Status: clientGroupImportUpdated})
+		default:
+			res = append(res, clientGroupImportResult{
+				ID:     group.ID,
+				Status: clientGroupImportConflict,
+				Error:  fmt.Sprintf("Client group with id=%q already exists.", group.ID),
+			})
+		}
+		if err != nil {
+			al.jsonErrorResponseWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to persist client group[id=%q].", group.ID), err)
+			return
+		}
+	}
+
+	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(res))
+	al.Debugf("%d client group(s) imported.", len(res))
+}
+
+// parseImportedClientGroup decodes and validates an exported client group definition.
+func parseImportedClientGroup(raw json.RawMessage) (*cgroups.ClientGroup, error) {
+	var in struct {
+		ID          string                     `json:"id"`
+		Description string                     `json:"description"`
+		Params      map[string]json.RawMessage `json:"params"`
+		// ClientIDs are accepted to import groups as they are listed, they are populated from params anyway
+		ClientIDs []string `json:"client_ids"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&in); err != nil {
+		return nil, err
+	}
+
+	group := &cgroups.ClientGroup{
+		ID:          in.ID,
+		Description: in.Description,
+		Params:      &cgroups.ClientParams{},
+	}
+	if err := validateInputClientGroup(*group); err != nil {
+		return nil, err
+	}
+
+	columns := make([]string, 0, len(in.Params))
+	for column := range in.Params {
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+	for _, column := range columns {
+		if !isClientGroupParamColumn(column) {
+			return nil, fmt.Errorf("group %q: unsupported filter column %q", group.ID, column)
+		}
+	}
+
+	if len(in.Params) > 0 {
+		b, err := json.Marshal(in.Params)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(b, group.Params); err != nil {
+			return nil, fmt.Errorf("group %q: invalid filter params: %v", group.ID, err)
+		}
+	}
+
+	return group, nil
+}
+
+func isClientGroupParamColumn(column string) bool {
+	for _, cur := range clientGroupParamColumns {
+		if cur == column {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,226 @@
+package chserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/rport/server/api"
+	"github.com/cloudradar-monitoring/rport/server/api/users"
+	"github.com/cloudradar-monitoring/rport/server/cgroups"
+	"github.com/cloudradar-monitoring/rport/server/clients"
+)
+
+func newClientGroupsTestAPIListener(t *testing.T, groups ...*cgroups.ClientGroup) (*APIListener, *cgroups.SqliteProvider) {
+	gp, err := cgroups.NewSqliteProvider(":memory:")
+	require.NoError(t, err)
+	for _, cur := range groups {
+		require.NoError(t, gp.Create(context.Background(), cur))
+	}
+
+	al := &APIListener{
+		insecureForTests: true,
+		Server: &Server{
+			clientService:       NewClientService(nil, clients.NewClientRepository(nil, &hour, testLog)),
+			clientGroupProvider: gp,
+			config: &Config{
+				Server: ServerConfig{MaxRequestBytes: 1024 * 1024},
+			},
+		},
+		userService: users.NewAPIService(users.NewStaticProvider([]*users.User{{Username: "admin", Groups: []string{users.Administrators}}}), false),
+		Logger:      testLog,
+	}
+	al.initRouter()
+	return al, gp
+}
+
+func importClientGroups(t *testing.T, al *APIListener, query, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/client-groups/import"+query, strings.NewReader(body))
+	req = req.WithContext(api.WithUser(req.Context(), "admin"))
+	w := httptest.NewRecorder()
+	al.router.ServeHTTP(w, req)
+	return w
+}
+
+func TestExportImportClientGroups(t *testing.T) {
+	ctx := context.Background()
+	static := &cgroups.ClientGroup{
+		ID:          "static",
+		Description: "listed clients",
+		Params:      &cgroups.ClientParams{ClientID: &cgroups.ParamValues{"client-1", "client-2"}},
+	}
+	dynamic := &cgroups.ClientGroup{
+		ID:          "web-linux",
+		Description: "linux web servers",
+		Params: &cgroups.ClientParams{
+			Tag:      &cgroups.ParamValues{"web*"},
+			OSKernel: &cgroups.ParamValues{"linux"},
+		},
+	}
+	source, sourceProvider := newClientGroupsTestAPIListener(t, static, dynamic)
+	defer sourceProvider.Close()
+
+	// export
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/client-groups/export", nil)
+	req = req.WithContext(api.WithUser(req.Context(), "admin"))
+	w := httptest.NewRecorder()
+	source.router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "attachment; filename=client-groups.json", w.Header().Get("Content-Disposition"))
+	exported := w.Body.String()
+
+	// import to an empty server
+	target, targetProvider := newClientGroupsTestAPIListener(t)
+	defer targetProvider.Close()
+	w = importClientGroups(t, target, "", exported)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"data":[{"id":"static","status":"created"},{"id":"web-linux","status":"created"}]}`, w.Body.String())
+
+	wantGroups, err := sourceProvider.GetAll(ctx)
+	require.NoError(t, err)
+	gotGroups, err := targetProvider.GetAll(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, wantGroups, gotGroups)
+
+	// import again
+	w = importClientGroups(t, target, "", exported)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"data":[
+		{"id":"static","status":"conflict","error":"Client group with id=\"static\" already exists."},
+		{"id":"web-linux","status":"conflict","error":"Client group with id=\"web-linux\" already exists."}
+	]}`, w.Body.String())
+}
+
+func TestImportClientGroupsConflicts(t *testing.T) {
+	ctx := context.Background()
+	existing := &cgroups.ClientGroup{
+		ID:          "web",
+		Description: "existing",
+		Params:      &cgroups.ClientParams{Tag: &cgroups.ParamValues{"web"}},
+	}
+	body := `[
+		{"id":"web","description":"imported","params":{"tag":["nginx"]}},
+		{"id":"db","description":"","params":{"os_family":["debian","ubuntu"]}}
+	]`
+
+	testCases := []struct {
+		name  string
+		query string
+
+		wantResp string
+		wantWeb  *cgroups.ClientGroup
+	}{
+		{
+			name: "existing group is kept",
+			wantResp: `{"data":[
+				{"id":"web","status":"conflict","error":"Client group with id=\"web\" already exists."},
+				{"id":"db","status":"created"}
+			]}`,
+			wantWeb: existing,
+		},
+		{
+			name:     "existing group is overwritten",
+			query:    "?overwrite=true",
+			wantResp: `{"data":[{"id":"web","status":"updated"},{"id":"db","status":"created"}]}`,
+			wantWeb: &cgroups.ClientGroup{
+				ID:          "web",
+				Description: "imported",
+				Params:      &cgroups.ClientParams{Tag: &cgroups.ParamValues{"nginx"}},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			al, gp := newClientGroupsTestAPIListener(t, existing)
+			defer gp.Close()
+
+			w := importClientGroups(t, al, tc.query, body)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.JSONEq(t, tc.wantResp, w.Body.String())
+			gotWeb, err := gp.Get(ctx, "web")
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantWeb, gotWeb)
+			gotDB, err := gp.Get(ctx, "db")
+			require.NoError(t, err)
+			require.NotNil(t, gotDB)
+			assert.Equal(t, &cgroups.ParamValues{"debian", "ubuntu"}, gotDB.Params.OSFamily)
+		})
+	}
+}
+
+func TestImportClientGroupsInvalid(t *testing.T) {
+	testCases := []struct {
+		name  string
+		query string
+		body  string
+
+		wantErrTitle  string
+		wantErrDetail string
+	}{
+		{
+			name:          "invalid group id",
+			body:          `[{"id":"web","params":{}},{"id":"web servers","params":{}}]`,
+			wantErrTitle:  "Invalid client group #2.",
+			wantErrDetail: `invalid group ID "web servers": can contain only "A-Za-z0-9_-*"`,
+		},
+		{
+			name:          "unsupported filter column",
+			body:          `[{"id":"web","params":{"tag":["web"],"cpu_vendor":["intel"]}}]`,
+			wantErrTitle:  "Invalid client group #1.",
+			wantErrDetail: `group "web": unsupported filter column "cpu_vendor"`,
+		},
+		{
+			name:          "invalid filter values",
+			body:          `[{"id":"web","params":{"tag":"web"}}]`,
+			wantErrTitle:  "Invalid client group #1.",
+			wantErrDetail: `group "web": invalid filter params: json: cannot unmarshal string into Go struct field ClientParams.tag of type cgroups.ParamValues`,
+		},
+		{
+			name:          "duplicate group id",
+			body:          `[{"id":"web","params":{}},{"id":"web","params":{}}]`,
+			wantErrTitle:  "Invalid client group #2.",
+			wantErrDetail: `duplicate group ID "web"`,
+		},
+		{
+			name:          "unknown field",
+			body:          `[{"id":"web","filters":{}}]`,
+			wantErrTitle:  "Invalid client group #1.",
+			wantErrDetail: `json: unknown field "filters"`,
+		},
+		{
+			name:         "invalid overwrite",
+			query:        "?overwrite=maybe",
+			body:         `[]`,
+			wantErrTitle: `Invalid overwrite value "maybe", expected a boolean.`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			al, gp := newClientGroupsTestAPIListener(t)
+			defer gp.Close()
+
+			w := importClientGroups(t, al, tc.query, tc.body)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			wantResp := api.NewErrAPIPayloadFromMessage("", tc.wantErrTitle, tc.wantErrDetail)
+			wantRespBytes, err := json.Marshal(wantResp)
+			require.NoError(t, err)
+			assert.JSONEq(t, string(wantRespBytes), w.Body.String())
+			// nothing is imported
+			gotGroups, err := gp.GetAll(context.Background())
+			require.NoError(t, err)
+			assert.Empty(t, gotGroups)
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package chserver
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/cloudradar-monitoring/rport/server/clients"
+)
+
+const (
+	exportFormatJSON = "json"
+	exportFormatCSV  = "csv"
+)
+
+// clientExportFields are fields of ClientPayload that can be exported, in the order of declaration.
+var clientExportFields = jsonFieldNames(ClientPayload{})
+
+func jsonFieldNames(v interface{}) []string {
+	t := reflect.TypeOf(v)
+	res := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			res = append(res, name)
+		}
+	}
+	return res
+}
+
+// handleExportClients streams clients the current user has access to in JSON or CSV format with selected fields only.
+// Supports the same filter, sort and group params as the clients list.
+func (al *APIListener) handleExportClients(w http.ResponseWriter, req *http.Request) {
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = exportFormatJSON
+	}
+	if format != exportFormatJSON && format != exportFormatCSV {
+		al.jsonErrorResponseWithErrCode(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Invalid format %q, expected %q or %q.", format, exportFormatJSON, exportFormatCSV))
+		return
+	}
+
+	fields, unsupported := parseExportFields(req.URL.Query().Get("fields"))
+	if unsupported != "" {
+		al.jsonErrorResponseWithErrCode(w, http.StatusBadRequest, ErrCodeInvalidRequest, fmt.Sprintf("Unsupported field %q.", unsupported))
+		return
+	}
+
+	cls, ok := al.getFilteredUserClients(w, req)
+	if !ok {
+		return
+	}
+
+	var err error
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=clients.%s", format))
+	if format == exportFormatCSV {
+		w.Header().Set("Content-Type", "text/csv; charset=UTF-8")
+		err = writeClientsCSV(w, cls, fields)
+	} else {
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+		err = writeClientsJSON(w, cls, fields)
+	}
+	if err != nil {
+		// the response is already partially sent
+		al.Errorf("Failed to export clients: %v", err)
+	}
+}
+
+// parseExportFields returns requested fields, all by default, or the first unsupported one.
+func parseExportFields(raw string) (fields []string, unsupported string) {
+	if raw == "" {
+		return clientExportFields, ""
+	}
+
+	supported := make(map[string]bool, len(clientExportFields))
+	for _, f := range clientExportFields {
+		supported[f] = true
+	}
+
+	fields = strings.Split(raw, ",")
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+		if !supported[fields[i]] {
+			return nil, fields[i]
+		}
+	}
+	return fields, ""
+}
+
+// exportedClientFields returns JSON values of given fields of a given client.
+func exportedClientFields(client *clients.Client, fields []string) ([]json.RawMessage, error) {
+	b, err := json.Marshal(convertToClientPayload(client))
+	if err != nil {
+		return nil, err
+	}
+	all := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(b, &all); err != nil {
+		return nil, err
+	}
+
+	res := make([]json.RawMessage, len(fields))
+	for i, f := range fields {
+		res[i] = all[f]
+	}
+	return res, nil
+}
+
+// writeClientsJSON writes clients as a JSON array of objects, one client at a time.
+func writeClientsJSON(w http.ResponseWriter, cls []*clients.Client, fields []string) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("[")
+	for i, client := range cls {
+		values, err := exportedClientFields(client, fields)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			bw.WriteString(",")
+		}
+		bw.WriteString("{")
+		for j, f := range fields {
+			if j > 0 {
+				bw.WriteString(",")
+			}
+			name, _ := json.Marshal(f)
+			bw.Write(name)
+			bw.WriteString(":")
+			bw.Write(values[j])
+		}
+		bw.WriteString("}")
+	}
+	bw.WriteString("]")
+	return bw.Flush()
+}
+
+// writeClientsCSV writes clients as CSV with a header, one client at a time.
+func writeClientsCSV(w http.ResponseWriter, cls []*clients.Client, fields []string) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(fields); err != nil {
+		return err
+	}
+	record := make([]string, len(fields))
+	for _, client := range cls {
+		values, err := exportedClientFields(client, fields)
+		if err != nil {
+			return err
+		}
+		for i, v := range values {
+			record[i] = escapeCSVFormula(csvValue(v))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// escapeCSVFormula prefixes a given CSV cell with a quote if it starts with a character that makes spreadsheet apps
+// evaluate it as a formula, so exported values can't run formulas when the file is opened.
+func escapeCSVFormula(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+// csvValue converts a JSON value to a CSV cell. Strings are unquoted, lists of strings are joined by a comma,
+// null is an empty cell, other values are kept as JSON.
+func csvValue(v json.RawMessage) string {
+	if len(v) == 0 || bytes.Equal(v, []byte("null")) {
+		return ""
+	}
+
+	var str string
+	if err := json.Unmarshal(v, &str); err == nil {
+		return str
+	}
+
+	var list []string
+	if err := json.Unmarshal(v, &list); err == nil {
+		return strings.Join(list, ",")
+	}
+
+	return string(v)
+}
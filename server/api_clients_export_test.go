@@ -0,0 +1,155 @@
+package chserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudradar-monitoring/rport/server/api"
+	"github.com/cloudradar-monitoring/rport/server/api/users"
+	"github.com/cloudradar-monitoring/rport/server/clients"
+)
+
+func TestHandleExportClients(t *testing.T) {
+	admin := &users.User{
+		Username: "admin",
+		Groups:   []string{users.Administrators},
+	}
+	operator := &users.User{
+		Username: "operator",
+		Groups:   []string{"group1"},
+	}
+	c1 := clients.New(t).ID("client-1").ClientAuthID(cl1.ID).AllowedUserGroups([]string{"group1"}).Build()
+	c2 := clients.New(t).ID("client-2").ClientAuthID(cl1.ID).DisconnectedDuration(5 * time.Minute).Build()
+	c2.IPv4 = []string{"192.168.122.112", "10.0.0.2"}
+	c2.Name = "=1+2"
+	al := APIListener{
+		insecureForTests: true,
+		Server: &Server{
+			clientService: NewClientService(nil, clients.NewClientRepository([]*clients.Client{c1, c2}, &hour, testLog)),
+			config: &Config{
+				Server: ServerConfig{MaxRequestBytes: 1024 * 1024},
+			},
+		},
+		userService: users.NewAPIService(users.NewStaticProvider([]*users.User{admin, operator}), false),
+		Logger:      testLog,
+	}
+	al.initRouter()
+
+	testCases := []struct {
+		name     string
+		user     *users.User
+		query    string
+		wantCode int
+		wantType string
+		wantBody string
+	}{
+		{
+			name:     "json with selected fields",
+			user:     admin,
+			query:    "?format=json&fields=id,name,ipv4",
+			wantCode: http.StatusOK,
+			wantType: "application/json; charset=UTF-8",
+			wantBody: `[{"id":"client-1","name":"Random Rport Client","ipv4":["192.168.122.111"]},` +
+				`{"id":"client-2","name":"=1+2","ipv4":["192.168.122.112","10.0.0.2"]}]`,
+		},
+		{
+			name:     "csv with selected fields",
+			user:     admin,
+			query:    "?format=csv&fields=id,os_family,ipv4,disconnected_at",
+			wantCode: http.StatusOK,
+			wantType: "text/csv; charset=UTF-8",
+			wantBody: "id,os_family,ipv4,disconnected_at\n" +
+				"client-1,alpine,192.168.122.111,\n" +
+				"client-2,alpine,\"192.168.122.112,10.0.0.2\"," + c2.DisconnectedAt.Format(time.RFC3339Nano) + "\n",
+		},
+		{
+			name:     "csv with escaped formulas",
+			user:     admin,
+			query:    "?format=csv&fields=id,name",
+			wantCode: http.StatusOK,
+			wantType: "text/csv; charset=UTF-8",
+			wantBody: "id,name\nclient-1,Random Rport Client\nclient-2,'=1+2\n",
+		},
+		{
+			name:     "only accessible clients",
+			user:     operator,
+			query:    "?format=csv&fields=id,name",
+			wantCode: http.StatusOK,
+			wantType: "text/csv; charset=UTF-8",
+			wantBody: "id,name\nclient-1,Random Rport Client\n",
+		},
+		{
+			name:     "filtered and sorted",
+			user:     admin,
+			query:    "?fields=id&sort=-id&filter[os_family]=alpine",
+			wantCode: http.StatusOK,
+			wantType: "application/json; charset=UTF-8",
+			wantBody: `[{"id":"client-2"},{"id":"client-1"}]`,
+		},
+		{
+			name:     "no clients",
+			user:     admin,
+			query:    "?fields=id&filter[environment]=unknown",
+			wantCode: http.StatusOK,
+			wantType: "application/json; charset=UTF-8",
+			wantBody: `[]`,
+		},
+		{
+			name:     "unsupported field",
+			user:     admin,
+			query:    "?format=csv&fields=id,password",
+			wantCode: http.StatusBadRequest,
+			wantType: "application/json; charset=UTF-8",
+			wantBody: `{"errors":[{"code":"ERR_CODE_INVALID_REQUEST","title":"Unsupported field \"password\".","detail":""}]}`,
+		},
+		{
+			name:     "invalid format",
+			user:     admin,
+			query:    "?format=xml",
+			wantCode: http.StatusBadRequest,
+			wantType: "application/json; charset=UTF-8",
+			wantBody: `{"errors":[{"code":"ERR_CODE_INVALID_REQUEST","title":"Invalid format \"xml\", expected \"json\" or \"csv\".","detail":""}]}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/clients/export"+tc.query, nil)
+			req = req.WithContext(api.WithUser(context.Background(), tc.user.Username))
+
+			al.router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.wantCode, w.Code)
+			assert.Equal(t, tc.wantType, w.Header().Get("Content-Type"))
+			assert.Equal(t, tc.wantBody, w.Body.String())
+		})
+	}
+}
+
+func TestEscapeCSVFormula(t *testing.T) {
+	testCases := []struct {
+		cell string
+		want string
+	}{
+		{cell: "", want: ""},
+		{cell: "uptime", want: "uptime"},
+		{cell: "a=b", want: "a=b"},
+		{cell: "=1+2", want: "'=1+2"},
+		{cell: "+1", want: "'+1"},
+		{cell: "-1", want: "'-1"},
+		{cell: "@SUM(A1)", want: "'@SUM(A1)"},
+		{cell: "\t=1", want: "'\t=1"},
+		{cell: "\r=1", want: "'\r=1"},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.want, escapeCSVFormula(tc.cell), tc.cell)
+	}
+}
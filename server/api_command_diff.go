@@ -0,0 +1,160 @@
+package chserver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/pmezard/go-difflib/difflib"
+
+	"github.com/cloudradar-monitoring/rport/server/api"
+	"github.com/cloudradar-monitoring/rport/share/models"
+)
+
+const (
+	queryParamPreviousJobID = "previous_job_id"
+	// commandDiffMaxOutputBytes limits the size of each compared output, the rest is not compared
+	commandDiffMaxOutputBytes = 512 * 1024
+	commandDiffContextLines   = 3
+)
+
+type commandDiff struct {
+	JID         string `json:"jid"`
+	PreviousJID string `json:"previous_jid"`
+	Command     string `json:"command"`
+	// StdOutDiff and StdErrDiff are unified diffs of the outputs, empty if the outputs are identical
+	StdOutDiff string `json:"stdout_diff"`
+	StdErrDiff string `json:"stderr_diff"`
+	// Truncated is set if any of the outputs exceeded the size limit and was compared partially
+	Truncated bool `json:"truncated"`
+}
+
+// handleGetCommandDiff compares the output of a job with the output of a previous job of the same command and client.
+// By default the latest finished job started before the given one is used.
+func (al *APIListener) handleGetCommandDiff(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	cid := vars[routeParamClientID]
+	if cid == "" {
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, fmt.Sprintf("Missing %q route param.", routeParamClientID))
+		return
+	}
+	jid := vars[routeParamJobID]
+	if jid == "" {
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, fmt.Sprintf("Missing %q route param.", routeParamJobID))
+		return
+	}
+
+	job, ok := al.getFinishedClientJob(w, cid, jid)
+	if !ok {
+		return
+	}
+
+	var prevJob *models.Job
+	if prevJID := req.URL.Query().Get(queryParamPreviousJobID); prevJID != "" {
+		prevJob, ok = al.getFinishedClientJob(w, cid, prevJID)
+		if !ok {
+			return
+		}
+		if prevJob.Command != job.Command {
+			al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, fmt.Sprintf("Job[id=%q] ran a different command than job[id=%q].", prevJID, jid))
+			return
+		}
+	} else {
+		var err error
+		prevJob, err = al.jobProvider.GetLastFinishedByCommand(cid, job.Command, job.StartedAt)
+		if err != nil {
+			al.jsonErrorResponseWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to find a previous job of job[id=%q].", jid), err)
+			return
+		}
+		if prevJob == nil {
+			al.jsonErrorResponseWithTitle(w, http.StatusNotFound, fmt.Sprintf("Previous job of job[id=%q] with the same command not found.", jid))
+			return
+		}
+	}
+
+	res, err := diffJobResults(prevJob, job)
+	if err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, "Failed to compare job results.", err)
+		return
+	}
+
+	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(res))
+}
+
+// getFinishedClientJob returns a finished job of a given client. It writes an error response and returns false on failure.
+func (al *APIListener) getFinishedClientJob(w http.ResponseWriter, cid, jid string) (*models.Job, bool) {
+	job, err := al.jobProvider.GetByJID(cid, jid)
+	if err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to find a job[id=%q].", jid), err)
+		return nil, false
+	}
+	if job == nil || job.ClientID != cid {
+		al.jsonErrorResponseWithTitle(w, http.StatusNotFound, fmt.Sprintf("Job[id=%q] not found.", jid))
+		return nil, false
+	}
+	if job.FinishedAt == nil {
+		al.jsonErrorResponseWithTitle(w, http.StatusConflict, fmt.Sprintf("Job[id=%q] is not finished yet.", jid))
+		return nil, false
+	}
+	return job, true
+}
+
+// diffJobResults returns unified diffs of outputs of two jobs.
+func diffJobResults(prevJob, job *models.Job) (*commandDiff, error) {
+	var prevResult, result models.JobResult
+	if prevJob.Result != nil {
+		prevResult = *prevJob.Result
+	}
+	if job.Result != nil {
+		result = *job.Result
+	}
+
+	res := &commandDiff{
+		JID:         job.JID,
+		PreviousJID: prevJob.JID,
+		Command:     job.Command,
+	}
+	var err error
+	res.StdOutDiff, err = diffOutputs(prevResult.StdOut, result.StdOut, prevJob.JID, job.JID, &res.Truncated)
+	if err != nil {
+		return nil, err
+	}
+	res.StdErrDiff, err = diffOutputs(prevResult.StdErr, result.StdErr, prevJob.JID, job.JID, &res.Truncated)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func diffOutputs(prev, cur, prevName, curName string, truncated *bool) (string, error) {
+	if len(prev) > commandDiffMaxOutputBytes {
+		prev = prev[:commandDiffMaxOutputBytes]
+		*truncated = true
+	}
+	if len(cur) > commandDiffMaxOutputBytes {
+		cur = cur[:commandDiffMaxOutputBytes]
+		*truncated = true
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitOutputLines(prev),
+		B:        splitOutputLines(cur),
+		FromFile: prevName,
+		ToFile:   curName,
+		Context:  commandDiffContextLines,
+	})
+}
+
+// splitOutputLines splits an output into lines keeping line breaks. Unlike difflib.SplitLines,
+// a trailing line break doesn't produce an extra empty line.
+func splitOutputLines(output string) []string {
+	if output == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(output, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n"
+	return lines
+}
@@ -0,0 +1,163 @@
+package chserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/rport/server/api"
+	"github.com/cloudradar-monitoring/rport/server/api/jobs"
+	"github.com/cloudradar-monitoring/rport/server/test/jb"
+	"github.com/cloudradar-monitoring/rport/share/models"
+)
+
+func TestHandleGetCommandDiff(t *testing.T) {
+	jp, err := jobs.NewSqliteProvider(":memory:", testLog)
+	require.NoError(t, err)
+	defer jp.Close()
+
+	cid := "client-1"
+	cmd := "cat /etc/hosts"
+	startedAt := time.Date(2020, 11, 5, 12, 0, 0, 0, time.UTC)
+	newJob := func(jid string, started time.Time, stdout string) *models.Job {
+		return jb.New(t).JID(jid).ClientID(cid).Command(cmd).StartedAt(started).FinishedAt(started.Add(time.Second)).
+			Result(&models.JobResult{StdOut: stdout}).Build()
+	}
+	job1 := newJob("job-1", startedAt, "127.0.0.1 localhost\n10.0.0.1 db\n")
+	job2 := newJob("job-2", startedAt.Add(time.Hour), "127.0.0.1 localhost\n10.0.0.2 db\n")
+	job3 := newJob("job-3", startedAt.Add(2*time.Hour), "127.0.0.1 localhost\n10.0.0.2 db\n")
+	otherCmdJob := jb.New(t).JID("job-other").ClientID(cid).Command("date").StartedAt(startedAt).FinishedAt(startedAt).Build()
+	runningJob := jb.New(t).JID("job-running").ClientID(cid).Command(cmd).StartedAt(startedAt.Add(3 * time.Hour)).Status(models.JobStatusRunning).Result(nil).Build()
+	bigJob1 := newJob("job-big-1", startedAt.Add(4*time.Hour), strings.Repeat("a", commandDiffMaxOutputBytes)+"b")
+	bigJob2 := newJob("job-big-2", startedAt.Add(5*time.Hour), strings.Repeat("a", commandDiffMaxOutputBytes)+"c")
+	for _, j := range []*models.Job{job1, job2, job3, otherCmdJob, runningJob, bigJob1, bigJob2} {
+		require.NoError(t, jp.SaveJob(j))
+	}
+
+	testCases := []struct {
+		name  string
+		jid   string
+		query string
+
+		wantStatusCode int
+		wantErrTitle   string
+		wantDiff       *commandDiff
+	}{
+		{
+			name:           "outputs differ",
+			jid:            "job-2",
+			wantStatusCode: http.StatusOK,
+			wantDiff: &commandDiff{
+				JID:         "job-2",
+				PreviousJID: "job-1",
+				Command:     cmd,
+				StdOutDiff: "--- job-1\n" +
+					"+++ job-2\n" +
+					"@@ -1,2 +1,2 @@\n" +
+					" 127.0.0.1 localhost\n" +
+					"-10.0.0.1 db\n" +
+					"+10.0.0.2 db\n",
+			},
+		},
+		{
+			name:           "identical outputs",
+			jid:            "job-3",
+			wantStatusCode: http.StatusOK,
+			wantDiff: &commandDiff{
+				JID:         "job-3",
+				PreviousJID: "job-2",
+				Command:     cmd,
+			},
+		},
+		{
+			name:           "given previous job",
+			jid:            "job-3",
+			query:          "?previous_job_id=job-1",
+			wantStatusCode: http.StatusOK,
+			wantDiff: &commandDiff{
+				JID:         "job-3",
+				PreviousJID: "job-1",
+				Command:     cmd,
+				StdOutDiff: "--- job-1\n" +
+					"+++ job-3\n" +
+					"@@ -1,2 +1,2 @@\n" +
+					" 127.0.0.1 localhost\n" +
+					"-10.0.0.1 db\n" +
+					"+10.0.0.2 db\n",
+			},
+		},
+		{
+			name:           "outputs exceeding the size limit",
+			jid:            "job-big-2",
+			query:          "?previous_job_id=job-big-1",
+			wantStatusCode: http.StatusOK,
+			wantDiff: &commandDiff{
+				JID:         "job-big-2",
+				PreviousJID: "job-big-1",
+				Command:     cmd,
+				Truncated:   true,
+			},
+		},
+		{
+			name:           "no previous job",
+			jid:            "job-1",
+			wantStatusCode: http.StatusNotFound,
+			wantErrTitle:   `Previous job of job[id="job-1"] with the same command not found.`,
+		},
+		{
+			name:           "previous job with a different command",
+			jid:            "job-2",
+			query:          "?previous_job_id=job-other",
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   `Job[id="job-other"] ran a different command than job[id="job-2"].`,
+		},
+		{
+			name:           "running job",
+			jid:            "job-running",
+			wantStatusCode: http.StatusConflict,
+			wantErrTitle:   `Job[id="job-running"] is not finished yet.`,
+		},
+		{
+			name:           "unknown job",
+			jid:            "unknown",
+			wantStatusCode: http.StatusNotFound,
+			wantErrTitle:   `Job[id="unknown"] not found.`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			al := APIListener{
+				insecureForTests: true,
+				Server: &Server{
+					config:      &Config{},
+					jobProvider: jp,
+				},
+				Logger: testLog,
+			}
+			al.initRouter()
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/clients/"+cid+"/commands/"+tc.jid+"/diff"+tc.query, nil)
+			w := httptest.NewRecorder()
+			al.router.ServeHTTP(w, req)
+
+			require.Equal(t, tc.wantStatusCode, w.Code)
+			var wantResp interface{}
+			if tc.wantErrTitle != "" {
+				wantResp = api.NewErrAPIPayloadFromMessage("", tc.wantErrTitle, "")
+			} else {
+				wantResp = api.NewSuccessPayload(tc.wantDiff)
+			}
+			wantJSON, err := json.Marshal(wantResp)
+			require.NoError(t, err)
+			assert.JSONEq(t, string(wantJSON), w.Body.String())
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package chserver
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/mux"
+
+	"github.com/cloudradar-monitoring/rport/share/comm"
+	"github.com/cloudradar-monitoring/rport/share/models"
+	"github.com/cloudradar-monitoring/rport/share/ws"
+)
+
+// jobOutputChanSize is a number of output messages buffered for a single subscriber, the rest is dropped if it's slow
+const jobOutputChanSize = 1000
+
+// jobOutputMessage is sent to websocket subscribers of a running job. It holds a chunk of the output
+// or the status of the job when it's finished.
+type jobOutputMessage struct {
+	StdOut   string `json:"stdout,omitempty"`
+	StdErr   string `json:"stderr,omitempty"`
+	Finished bool   `json:"finished"`
+	Status   string `json:"status,omitempty"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+func newJobFinishedMessage(job *models.Job) *jobOutputMessage {
+	msg := &jobOutputMessage{
+		Finished: true,
+		Status:   job.Status,
+		Error:    job.Error,
+	}
+	if job.ExecutionMetadata != nil {
+		msg.ExitCode = job.ExecutionMetadata.ExitCode
+	}
+	return msg
+}
+
+// jobOutputChanMap is thread safe map with [jobID, subscriber channels] pairs.
+// It holds an entry for each running job which output is streamed to websocket subscribers.
+type jobOutputChanMap struct {
+	m  map[string]map[chan *jobOutputMessage]bool
+	mu sync.RWMutex
+}
+
+// Add registers a new subscriber of a given job.
+func (m *jobOutputChanMap) Add(jobID string) chan *jobOutputMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.m == nil {
+		m.m = make(map[string]map[chan *jobOutputMessage]bool)
+	}
+	if m.m[jobID] == nil {
+		m.m[jobID] = make(map[chan *jobOutputMessage]bool)
+	}
+	output := make(chan *jobOutputMessage, jobOutputChanSize)
+	m.m[jobID][output] = true
+	return output
+}
+
+// Del removes a subscriber of a given job. The channel is not closed to let late messages be dropped safely.
+func (m *jobOutputChanMap) Del(jobID string, output chan *jobOutputMessage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.m[jobID], output)
+	if len(m.m[jobID]) == 0 {
+		delete(m.m, jobID)
+	}
+}
+
+// Send passes a message to all subscribers of a given job without blocking. Returns false if there are no subscribers.
+func (m *jobOutputChanMap) Send(jobID string, msg *jobOutputMessage) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	subscribers := m.m[jobID]
+	for output := range subscribers {
+		select {
+		case output <- msg:
+		default:
+		}
+	}
+	return len(subscribers) > 0
+}
+
+// handleCommandOutputWS streams the output of a running job to a websocket. When the job is finished
+// a final message with its status is sent and the websocket is closed.
+func (al *APIListener) handleCommandOutputWS(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	cid := vars[routeParamClientID]
+	jid := vars[routeParamJobID]
+
+	job, err := al.jobProvider.GetByJID(cid, jid)
+	if err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to find a job[id=%q].", jid), err)
+		return
+	}
+	if job == nil {
+		al.jsonErrorResponseWithTitle(w, http.StatusNotFound, fmt.Sprintf("Job[id=%q] not found.", jid))
+		return
+	}
+
+	uiConn, err := apiUpgrader.Upgrade(w, req, nil)
+	if err != nil {
+		al.Errorf("Failed to establish WS connection: %v", err)
+		return
+	}
+	uiConnTS := ws.NewConcurrentWebSocket(uiConn, al.Logger)
+	// the websocket is closed explicitly when the job is finished
+	uiConnTS.SetWritesBeforeClose(-1)
+	defer uiConnTS.Close()
+
+	if job.Status != models.JobStatusRunning {
+		al.writeFinishedJobOutput(uiConnTS, job)
+		return
+	}
+
+	// subscribe before requesting the output to not miss any of it
+	output := al.jobOutputChannels.Add(jid)
+	defer al.jobOutputChannels.Del(jid, output)
+
+	if err := al.requestJobOutput(cid, jid); err != nil {
+		// the job could be finished in the meantime
+		job, dbErr := al.jobProvider.GetByJID(cid, jid)
+		if dbErr == nil && job != nil && job.Status != models.JobStatusRunning {
+			al.writeFinishedJobOutput(uiConnTS, job)
+			return
+		}
+		uiConnTS.WriteError("Failed to stream the command output.", err)
+		return
+	}
+
+	// nothing is expected from a subscriber, reading only detects that it's gone
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := uiConn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case msg := <-output:
+			if err := uiConnTS.WriteJSON(msg); err != nil || msg.Finished {
+				return
+			}
+		case <-closed:
+			al.Debugf("Job[id=%q] output subscriber is gone.", jid)
+			return
+		}
+	}
+}
+
+func (al *APIListener) requestJobOutput(cid, jid string) error {
+	client, err := al.clientService.GetActiveByID(cid)
+	if err != nil {
+		return err
+	}
+	if client == nil {
+		return fmt.Errorf("active client with id=%q not found", cid)
+	}
+	return comm.SendRequestAndGetResponse(client.Connection, comm.RequestTypeStreamCmdOutput, &comm.StreamCmdOutputRequest{JID: jid}, nil)
+}
+
+// writeFinishedJobOutput sends the whole output of a finished job followed by its status.
+func (al *APIListener) writeFinishedJobOutput(uiConnTS *ws.ConcurrentWebSocket, job *models.Job) {
+	if job.Result != nil && (job.Result.StdOut != "" || job.Result.StdErr != "") {
+		msg := &jobOutputMessage{
+			StdOut: job.Result.StdOut,
+			StdErr: job.Result.StdErr,
+		}
+		if err := uiConnTS.WriteJSON(msg); err != nil {
+			return
+		}
+	}
+	_ = uiConnTS.WriteJSON(newJobFinishedMessage(job))
+}
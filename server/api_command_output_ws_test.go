@@ -0,0 +1,163 @@
+package chserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/rport/server/api"
+	"github.com/cloudradar-monitoring/rport/server/clients"
+	"github.com/cloudradar-monitoring/rport/share/comm"
+	"github.com/cloudradar-monitoring/rport/share/models"
+	"github.com/cloudradar-monitoring/rport/share/test"
+)
+
+func TestHandleCommandOutputWS(t *testing.T) {
+	connMock := test.NewConnMock()
+	c1 := clients.New(t).Connection(connMock).Build()
+	exitCode := 1
+	runningJob := &models.Job{
+		JobSummary: models.JobSummary{JID: "job-1", Status: models.JobStatusRunning},
+		ClientID:   c1.ID,
+	}
+	finishedJob := &models.Job{
+		JobSummary:        models.JobSummary{JID: "job-1", Status: models.JobStatusFailed},
+		ClientID:          c1.ID,
+		Error:             "exit status 1",
+		Result:            &models.JobResult{StdOut: "line 1\n", StdErr: "error\n"},
+		ExecutionMetadata: &models.ExecutionMetadata{ExitCode: &exitCode},
+	}
+
+	testCases := []struct {
+		name            string
+		job             *models.Job
+		streamed        []*jobOutputMessage
+		connReturnNotOk bool
+
+		wantMessages []string
+	}{
+		{
+			name: "running job",
+			job:  runningJob,
+			streamed: []*jobOutputMessage{
+				{StdOut: "line 1\n"},
+				{StdOut: "line 2\n", StdErr: "error\n"},
+				newJobFinishedMessage(finishedJob),
+			},
+			wantMessages: []string{
+				`{"stdout":"line 1\n","finished":false}`,
+				`{"stdout":"line 2\n","stderr":"error\n","finished":false}`,
+				`{"finished":true,"status":"failed","exit_code":1,"error":"exit status 1"}`,
+			},
+		},
+		{
+			name: "finished job",
+			job:  finishedJob,
+			wantMessages: []string{
+				`{"stdout":"line 1\n","stderr":"error\n","finished":false}`,
+				`{"finished":true,"status":"failed","exit_code":1,"error":"exit status 1"}`,
+			},
+		},
+		{
+			name:            "refused by client",
+			job:             runningJob,
+			connReturnNotOk: true,
+			wantMessages: []string{
+				`{"errors":[{"code":"","title":"Failed to stream the command output.","detail":"client error: no running command of job \"job-1\""}]}`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			al := APIListener{
+				Server: &Server{
+					clientService: NewClientService(nil, clients.NewClientRepository([]*clients.Client{c1}, &hour, testLog)),
+					config:        &Config{},
+				},
+				Logger: testLog,
+			}
+			jp := NewJobProviderMock()
+			jp.ReturnJob = tc.job
+			al.jobProvider = jp
+
+			connMock.ReturnOk = !tc.connReturnNotOk
+			connMock.ReturnResponsePayload = nil
+			connMock.DoneChannel = nil
+			if tc.connReturnNotOk {
+				connMock.ReturnResponsePayload = []byte(`no running command of job "job-1"`)
+			}
+			if tc.streamed != nil {
+				done := make(chan bool)
+				connMock.DoneChannel = done
+				go func() {
+					<-done
+					for _, msg := range tc.streamed {
+						al.jobOutputChannels.Send("job-1", msg)
+					}
+				}()
+			}
+
+			r := mux.NewRouter()
+			r.HandleFunc("/clients/{client_id}/commands/{job_id}/ws", al.handleCommandOutputWS)
+			srv := httptest.NewServer(r)
+			defer srv.Close()
+
+			wsURL := "ws" + strings.TrimPrefix(srv.URL, "http") + fmt.Sprintf("/clients/%s/commands/job-1/ws", c1.ID)
+			conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			var gotMessages []string
+			for {
+				_, msg, err := conn.ReadMessage()
+				if err != nil {
+					break
+				}
+				gotMessages = append(gotMessages, strings.TrimSpace(string(msg)))
+			}
+
+			assert.Equal(t, tc.wantMessages, gotMessages)
+			if tc.streamed != nil {
+				name, _, payload := connMock.InputSendRequest()
+				assert.Equal(t, comm.RequestTypeStreamCmdOutput, name)
+				assert.JSONEq(t, `{"jid":"job-1"}`, string(payload))
+			}
+		})
+	}
+}
+
+func TestHandleCommandOutputWSJobNotFound(t *testing.T) {
+	al := APIListener{
+		Server: &Server{
+			config: &Config{},
+		},
+		Logger: testLog,
+	}
+	al.jobProvider = NewJobProviderMock()
+
+	r := mux.NewRouter()
+	r.HandleFunc("/clients/{client_id}/commands/{job_id}/ws", al.handleCommandOutputWS)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/clients/client-1/commands/job-1/ws")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	wantRespBytes, err := json.Marshal(api.NewErrAPIPayloadFromMessage("", `Job[id="job-1"] not found.`, ""))
+	require.NoError(t, err)
+	assert.JSONEq(t, string(wantRespBytes), string(body))
+}
@@ -0,0 +1,101 @@
+package chserver
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/cloudradar-monitoring/rport/server/api/jobs"
+	"github.com/cloudradar-monitoring/rport/share/models"
+	"github.com/cloudradar-monitoring/rport/share/query"
+)
+
+// commandExportFields are CSV columns of exported commands.
+var commandExportFields = []string{"jid", "client_id", "command", "interpreter", "created_by", "status", "started_at", "finished_at"}
+
+// acceptsCSV returns true if a given request accepts CSV.
+func acceptsCSV(req *http.Request) bool {
+	return strings.Contains(req.Header.Get("Accept"), "text/csv")
+}
+
+// isCommandsExportRequest matches requests of commands that ask for CSV. They are served by a separate route, so the export
+// is not limited by the API request timeout.
+func isCommandsExportRequest(req *http.Request, _ *mux.RouteMatch) bool {
+	format := req.URL.Query().Get("format")
+	return format == exportFormatCSV || format == "" && acceptsCSV(req)
+}
+
+// handleExportCommands streams jobs of all clients the current user has access to as CSV, row by row from the storage.
+// Supports the same filter and search params as the commands list.
+func (al *APIListener) handleExportCommands(w http.ResponseWriter, req *http.Request) {
+	filters := query.ExtractFilterOptions(req)
+	if err := query.ValidateFilterOptions(filters, jobs.SupportedFilters); err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	sorts := query.ExtractSortOptions(req)
+	if err := query.ValidateSortOptions(sorts, jobs.SearchSorts); err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	opts := jobs.SearchOptions{
+		Filters: filters,
+		Sorts:   sorts,
+	}
+	if _, ok := req.URL.Query()[queryParamSearch]; ok {
+		opts.Text = req.URL.Query().Get(queryParamSearch)
+		if strings.TrimSpace(opts.Text) == "" {
+			al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, fmt.Sprintf("Param %q cannot be empty.", queryParamSearch))
+			return
+		}
+	}
+
+	clientIDs, err := al.allowedClientIDs(req)
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+	opts.ClientIDs = clientIDs
+
+	w.Header().Set("Content-Type", "text/csv; charset=UTF-8")
+	w.Header().Set("Content-Disposition", "attachment; filename=commands.csv")
+	if err := writeCommandsCSV(w, al.jobProvider, opts); err != nil {
+		// the response is already partially sent
+		al.Errorf("Failed to export commands: %v", err)
+	}
+}
+
+// writeCommandsCSV writes jobs that match given options as CSV with a header, one job at a time.
+func writeCommandsCSV(w http.ResponseWriter, jp JobProvider, opts jobs.SearchOptions) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(commandExportFields); err != nil {
+		return err
+	}
+	err := jp.ForEachClientJob(opts, func(js *models.ClientJobSummary) error {
+		finishedAt := ""
+		if js.FinishedAt != nil {
+			finishedAt = js.FinishedAt.UTC().Format(time.RFC3339)
+		}
+		return cw.Write([]string{
+			js.JID,
+			escapeCSVFormula(js.ClientID),
+			escapeCSVFormula(js.Command),
+			escapeCSVFormula(js.Interpreter),
+			escapeCSVFormula(js.CreatedBy),
+			js.Status,
+			js.StartedAt.UTC().Format(time.RFC3339),
+			finishedAt,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
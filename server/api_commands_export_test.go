@@ -0,0 +1,222 @@
+package chserver
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/rport/server/api"
+	"github.com/cloudradar-monitoring/rport/server/api/jobs"
+	"github.com/cloudradar-monitoring/rport/server/api/users"
+	"github.com/cloudradar-monitoring/rport/server/clients"
+	"github.com/cloudradar-monitoring/rport/server/test/jb"
+	"github.com/cloudradar-monitoring/rport/share/models"
+)
+
+func TestHandleExportCommands(t *testing.T) {
+	jp, err := jobs.NewSqliteProvider(":memory:", testLog)
+	require.NoError(t, err)
+	defer jp.Close()
+
+	t1 := time.Date(2020, 10, 10, 10, 10, 10, 0, time.UTC)
+	job1 := jb.New(t).JID("1111").ClientID("client-1").Command(`@echo "a,b"`).Interpreter("/bin/sh").StartedAt(t1).FinishedAt(t1.Add(time.Second)).Build()
+	job2 := jb.New(t).JID("2222").ClientID("client-2").Command("uptime").Interpreter("tacoscript").StartedAt(t1.Add(time.Minute)).Build()
+	job2.Status = models.JobStatusRunning
+	job2.FinishedAt = nil
+	for _, j := range []*models.Job{job1, job2} {
+		require.NoError(t, jp.SaveJob(j))
+	}
+
+	admin := &users.User{
+		Username: "admin",
+		Groups:   []string{users.Administrators},
+	}
+	user := &users.User{
+		Username: "user",
+		Groups:   []string{"group-1"},
+	}
+	c1 := clients.New(t).ID("client-1").AllowedUserGroups([]string{"group-1"}).Build()
+	c2 := clients.New(t).ID("client-2").Build()
+
+	al := APIListener{
+		insecureForTests: true,
+		Logger:           testLog,
+		Server: &Server{
+			config: &Config{
+				Server: ServerConfig{MaxRequestBytes: 1024 * 1024},
+			},
+			jobProvider:   jp,
+			clientService: NewClientService(nil, clients.NewClientRepository([]*clients.Client{c1, c2}, &hour, testLog)),
+		},
+		userService: users.NewAPIService(users.NewStaticProvider([]*users.User{admin, user}), false),
+	}
+	al.initRouter()
+
+	header := "jid,client_id,command,interpreter,created_by,status,started_at,finished_at\n"
+	// a command starting with a formula char is escaped
+	job1CSV := `1111,client-1,"'@echo ""a,b""",/bin/sh,test-user,successful,2020-10-10T10:10:10Z,2020-10-10T10:10:11Z` + "\n"
+	job2CSV := "2222,client-2,uptime,tacoscript,test-user,running,2020-10-10T10:11:10Z,\n"
+
+	testCases := []struct {
+		name           string
+		user           string
+		query          string
+		accept         string
+		wantStatusCode int
+		wantResp       string
+	}{
+		{
+			name:           "all by format",
+			user:           admin.Username,
+			query:          "?format=csv",
+			wantStatusCode: http.StatusOK,
+			wantResp:       header + job2CSV + job1CSV,
+		},
+		{
+			name:           "all by accept header",
+			user:           admin.Username,
+			accept:         "text/csv",
+			wantStatusCode: http.StatusOK,
+			wantResp:       header + job2CSV + job1CSV,
+		},
+		{
+			name:           "filtered and sorted",
+			user:           admin.Username,
+			query:          "?format=csv&filter[interpreter]=/bin/sh,tacoscript&sort=started_at",
+			wantStatusCode: http.StatusOK,
+			wantResp:       header + job1CSV + job2CSV,
+		},
+		{
+			name:           "search",
+			user:           admin.Username,
+			query:          "?format=csv&search=UPTIME",
+			wantStatusCode: http.StatusOK,
+			wantResp:       header + job2CSV,
+		},
+		{
+			name:           "user sees jobs of allowed clients",
+			user:           user.Username,
+			query:          "?format=csv",
+			wantStatusCode: http.StatusOK,
+			wantResp:       header + job1CSV,
+		},
+		{
+			name:           "unsupported filter",
+			user:           admin.Username,
+			query:          "?format=csv&filter[status]=running",
+			wantStatusCode: http.StatusBadRequest,
+			wantResp:       `{"errors":[{"code":"","title":"unsupported filter field 'status'","detail":""}]}`,
+		},
+		{
+			name:           "invalid format",
+			user:           admin.Username,
+			query:          "?format=xml",
+			wantStatusCode: http.StatusBadRequest,
+			wantResp:       `{"errors":[{"code":"ERR_CODE_INVALID_REQUEST","title":"Invalid format \"xml\", expected \"json\" or \"csv\".","detail":""}]}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/commands"+tc.query, nil)
+			req = req.WithContext(api.WithUser(req.Context(), tc.user))
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+
+			w := httptest.NewRecorder()
+			al.router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.wantStatusCode, w.Code)
+			assert.Equal(t, tc.wantResp, w.Body.String())
+			if tc.wantStatusCode == http.StatusOK {
+				assert.Equal(t, "text/csv; charset=UTF-8", w.Header().Get("Content-Type"))
+				assert.Equal(t, "attachment; filename=commands.csv", w.Header().Get("Content-Disposition"))
+			}
+		})
+	}
+}
+
+func TestHandleExportCommandsIsNotLimitedByRequestTimeout(t *testing.T) {
+	jp, err := jobs.NewSqliteProvider(":memory:", testLog)
+	require.NoError(t, err)
+	defer jp.Close()
+
+	const jobsCount = 1000
+	t1 := time.Date(2020, 10, 10, 10, 10, 10, 0, time.UTC)
+	for i := 0; i < jobsCount; i++ {
+		job := jb.New(t).JID(fmt.Sprintf("jid-%d", i)).ClientID("client-1").StartedAt(t1.Add(time.Duration(i) * time.Second)).Build()
+		require.NoError(t, jp.SaveJob(job))
+	}
+
+	admin := &users.User{
+		Username: "admin",
+		Groups:   []string{users.Administrators},
+	}
+	al := APIListener{
+		insecureForTests: true,
+		Logger:           testLog,
+		Server: &Server{
+			config: &Config{
+				Server: ServerConfig{MaxRequestBytes: 1024 * 1024},
+				// any request limited by the timeout exceeds it
+				API: APIConfig{RequestTimeout: time.Nanosecond},
+			},
+			jobProvider:   jp,
+			clientService: NewClientService(nil, clients.NewClientRepository(nil, &hour, testLog)),
+		},
+		userService: users.NewAPIService(users.NewStaticProvider([]*users.User{admin}), false),
+	}
+	al.initRouter()
+
+	testCases := []struct {
+		name           string
+		query          string
+		accept         string
+		wantStatusCode int
+	}{
+		{
+			name:           "export by format",
+			query:          "?format=csv",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "export by accept header",
+			accept:         "text/csv",
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "list is limited",
+			wantStatusCode: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/commands"+tc.query, nil)
+			req = req.WithContext(api.WithUser(req.Context(), admin.Username))
+			if tc.accept != "" {
+				req.Header.Set("Accept", tc.accept)
+			}
+
+			w := httptest.NewRecorder()
+			al.router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.wantStatusCode, w.Code)
+			if tc.wantStatusCode != http.StatusOK {
+				return
+			}
+			lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+			require.Len(t, lines, jobsCount+1, "header and all jobs are expected")
+			assert.True(t, strings.HasPrefix(lines[jobsCount], "jid-0,"), lines[jobsCount])
+		})
+	}
+}
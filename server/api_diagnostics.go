@@ -0,0 +1,211 @@
+package chserver
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+
+	chshare "github.com/cloudradar-monitoring/rport/share"
+)
+
+const redactedValue = "[redacted]"
+
+// secretConfigNameParts are parts of config names which values are redacted in the diagnostics bundle,
+// so newly added secrets are redacted without listing them.
+var secretConfigNameParts = []string{"password", "secret", "dsn", "key"}
+
+// secretConfigKeys are config keys which values are redacted in the diagnostics bundle
+// although their names don't contain any of secretConfigNameParts.
+var secretConfigKeys = map[string]bool{
+	"server.auth":        true,
+	"api.auth":           true,
+	"pushover.api_token": true,
+}
+
+func isSecretConfigKey(key string) bool {
+	if secretConfigKeys[key] {
+		return true
+	}
+	name := strings.ToLower(key[strings.LastIndex(key, ".")+1:])
+	for _, part := range secretConfigNameParts {
+		if strings.Contains(name, part) {
+			return true
+		}
+	}
+	return false
+}
+
+type diagnosticsVersion struct {
+	Version     string    `json:"version"`
+	GoVersion   string    `json:"go_version"`
+	OS          string    `json:"os"`
+	Arch        string    `json:"arch"`
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+type diagnosticsCounts struct {
+	ClientsConnected    int            `json:"clients_connected"`
+	ClientsDisconnected int            `json:"clients_disconnected"`
+	Tunnels             int            `json:"tunnels"`
+	Jobs                map[string]int `json:"jobs"`
+}
+
+// handleGetDiagnostics streams a zip bundle with the server diagnostics: version info, redacted effective config,
+// clients, tunnels and jobs counts and recent error logs.
+func (al *APIListener) handleGetDiagnostics(w http.ResponseWriter, req *http.Request) {
+	counts, err := al.getDiagnosticsCounts()
+	if err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, "Failed to collect diagnostics.", err)
+		return
+	}
+
+	now := time.Now()
+	version := diagnosticsVersion{
+		Version:     chshare.BuildVersion,
+		GoVersion:   runtime.Version(),
+		OS:          runtime.GOOS,
+		Arch:        runtime.GOARCH,
+		GeneratedAt: now,
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="rportd-diagnostics-%s.zip"`, now.Format("20060102-150405")))
+	w.WriteHeader(http.StatusOK)
+
+	zw := zip.NewWriter(w)
+	err = writeZipJSON(zw, "version.json", version)
+	if err == nil {
+		err = writeZipJSON(zw, "config.json", redactedConfig(al.config))
+	}
+	if err == nil {
+		err = writeZipJSON(zw, "counts.json", counts)
+	}
+	if err == nil {
+		err = writeZipLines(zw, "errors.log", chshare.RecentErrors())
+	}
+	if err == nil {
+		err = zw.Close()
+	}
+	if err != nil {
+		// the response is already started, so the error can only be logged
+		al.Errorf("Failed to write diagnostics bundle: %v", err)
+	}
+}
+
+func (al *APIListener) getDiagnosticsCounts() (*diagnosticsCounts, error) {
+	connected, err := al.clientService.CountActive()
+	if err != nil {
+		return nil, err
+	}
+	disconnected, err := al.clientService.CountDisconnected()
+	if err != nil {
+		return nil, err
+	}
+	tunnels := 0
+	for _, cur := range al.clientService.repo.GetAllActive() {
+		tunnels += len(cur.Tunnels)
+	}
+	jobs, err := al.jobProvider.CountByStatus()
+	if err != nil {
+		return nil, err
+	}
+	return &diagnosticsCounts{
+		ClientsConnected:    connected,
+		ClientsDisconnected: disconnected,
+		Tunnels:             tunnels,
+		Jobs:                jobs,
+	}, nil
+}
+
+func writeZipJSON(zw *zip.Writer, name string, v interface{}) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeZipLines(zw *zip.Writer, name string, lines []string) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(f, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// redactedConfig returns a given config as a map with config file keys where secret values are redacted.
+func redactedConfig(config *Config) interface{} {
+	return configValueToMap(reflect.ValueOf(config), "")
+}
+
+var (
+	durationType  = reflect.TypeOf(time.Duration(0))
+	logOutputType = reflect.TypeOf(chshare.LogOutput{})
+)
+
+func configValueToMap(v reflect.Value, key string) interface{} {
+	if isSecretConfigKey(key) {
+		if v.IsZero() {
+			return ""
+		}
+		return redactedValue
+	}
+
+	switch v.Type() {
+	case durationType:
+		return time.Duration(v.Int()).String()
+	case logOutputType:
+		return v.Interface().(chshare.LogOutput).FilePath()
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return configValueToMap(v.Elem(), key)
+	case reflect.Struct:
+		res := make(map[string]interface{})
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			name := field.Tag.Get("mapstructure")
+			if field.PkgPath != "" || name == "" || name == "-" {
+				continue
+			}
+			fieldKey := name
+			if key != "" {
+				fieldKey = key + "." + name
+			}
+			res[name] = configValueToMap(v.Field(i), fieldKey)
+		}
+		return res
+	case reflect.Slice:
+		res := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			res = append(res, configValueToMap(v.Index(i), key))
+		}
+		return res
+	case reflect.Map:
+		res := make(map[string]interface{}, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			name := fmt.Sprint(iter.Key().Interface())
+			res[name] = configValueToMap(iter.Value(), strings.TrimPrefix(key+"."+name, "."))
+		}
+		return res
+	default:
+		return v.Interface()
+	}
+}
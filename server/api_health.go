@@ -0,0 +1,56 @@
+package chserver
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/cloudradar-monitoring/rport/server/api"
+)
+
+const (
+	healthStatusOK          = "ok"
+	healthStatusUnavailable = "unavailable"
+	healthPingTimeout       = 5 * time.Second
+)
+
+type health struct {
+	Status string `json:"status"`
+	// ClientsDB is "ok" or an error of querying the clients DB
+	ClientsDB     string `json:"clients_db"`
+	ActiveClients int    `json:"active_clients"`
+}
+
+// handleGetHealth reports whether the server is started and its clients DB is available. It responds with 503 otherwise.
+func (al *APIListener) handleGetHealth(w http.ResponseWriter, req *http.Request) {
+	res := health{
+		Status:    healthStatusOK,
+		ClientsDB: healthStatusOK,
+	}
+
+	if atomic.LoadInt32(&al.started) == 0 {
+		res.Status = healthStatusUnavailable
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), healthPingTimeout)
+	defer cancel()
+	if err := al.clientProvider.Ping(ctx); err != nil {
+		res.Status = healthStatusUnavailable
+		res.ClientsDB = err.Error()
+	}
+
+	// counting may need the clients DB, so a failure means the server is not ready rather than an internal error
+	var err error
+	res.ActiveClients, err = al.clientService.CountActive()
+	if err != nil {
+		al.Errorf("Health check: failed to count active clients: %v", err)
+		res.Status = healthStatusUnavailable
+	}
+
+	status := http.StatusOK
+	if res.Status != healthStatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	al.writeJSONResponse(w, status, api.NewSuccessPayload(res))
+}
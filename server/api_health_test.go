@@ -0,0 +1,99 @@
+package chserver
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/rport/server/clients"
+	"github.com/cloudradar-monitoring/rport/share/security"
+)
+
+func TestHandleGetHealth(t *testing.T) {
+	c1 := clients.New(t).ID("client-1").Build()
+	clientService := NewClientService(nil, clients.NewClientRepository([]*clients.Client{c1}, &hour, testLog))
+
+	openDB, err := clients.NewSqliteProvider(":memory:", hour)
+	require.NoError(t, err)
+	defer openDB.Close()
+	closedDB, err := clients.NewSqliteProvider(":memory:", hour)
+	require.NoError(t, err)
+	require.NoError(t, closedDB.Close())
+	// the DB file is overwritten while the DB is open
+	brokenDBPath := filepath.Join(t.TempDir(), "clients.db")
+	brokenDB, err := clients.NewSqliteProvider(brokenDBPath, hour)
+	require.NoError(t, err)
+	defer brokenDB.Close()
+	require.NoError(t, ioutil.WriteFile(brokenDBPath, bytes.Repeat([]byte("x"), 4096), 0600))
+
+	testCases := []struct {
+		name           string
+		started        int32
+		clientProvider clients.ClientProvider
+		wantStatusCode int
+		wantJSON       string
+	}{
+		{
+			name:           "healthy",
+			started:        1,
+			clientProvider: openDB,
+			wantStatusCode: http.StatusOK,
+			wantJSON:       `{"data":{"status":"ok","clients_db":"ok","active_clients":1}}`,
+		},
+		{
+			name:           "not started",
+			started:        0,
+			clientProvider: openDB,
+			wantStatusCode: http.StatusServiceUnavailable,
+			wantJSON:       `{"data":{"status":"unavailable","clients_db":"ok","active_clients":1}}`,
+		},
+		{
+			name:           "clients DB unavailable",
+			started:        1,
+			clientProvider: closedDB,
+			wantStatusCode: http.StatusServiceUnavailable,
+			wantJSON:       `{"data":{"status":"unavailable","clients_db":"sql: database is closed","active_clients":1}}`,
+		},
+		{
+			name:           "clients DB file is broken",
+			started:        1,
+			clientProvider: brokenDB,
+			wantStatusCode: http.StatusServiceUnavailable,
+			wantJSON:       `{"data":{"status":"unavailable","clients_db":"file is not a database","active_clients":1}}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			// auth is enabled to make sure the endpoint doesn't require it
+			al := APIListener{
+				Server: &Server{
+					config: &Config{
+						API: APIConfig{
+							Auth: "admin:foobaz",
+						},
+					},
+					clientService:  clientService,
+					clientProvider: tc.clientProvider,
+					started:        tc.started,
+				},
+				bannedUsers: security.NewBanList(0),
+				Logger:      testLog,
+			}
+			al.initRouter()
+
+			w := httptest.NewRecorder()
+			al.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/health", nil))
+
+			assert.Equal(t, tc.wantStatusCode, w.Code)
+			assert.JSONEq(t, tc.wantJSON, w.Body.String())
+		})
+	}
+}
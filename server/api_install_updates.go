@@ -0,0 +1,125 @@
+package chserver
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/cloudradar-monitoring/rport/server/api"
+	"github.com/cloudradar-monitoring/rport/share/comm"
+	"github.com/cloudradar-monitoring/rport/share/models"
+)
+
+type installUpdatesInput struct {
+	Packages     []string `json:"packages"`
+	SecurityOnly bool     `json:"security_only"`
+	TimeoutSec   int      `json:"timeout_sec"`
+}
+
+// handlePostUpdates starts installing updates on a client. The result is stored as a job like for a command.
+// It requires admin access, since updates are installed with root privileges.
+func (al *APIListener) handlePostUpdates(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	cid := vars[routeParamClientID]
+	if cid == "" {
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, fmt.Sprintf("Missing %q route param.", routeParamClientID))
+		return
+	}
+
+	input := &installUpdatesInput{}
+	err := parseRequestBody(req.Body, input)
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+	installReq := &comm.InstallUpdatesRequest{
+		Packages:     input.Packages,
+		SecurityOnly: input.SecurityOnly,
+	}
+	if err := installReq.Validate(); err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusBadRequest, "Invalid packages.", err)
+		return
+	}
+
+	if input.TimeoutSec <= 0 {
+		input.TimeoutSec = al.config.Server.RunRemoteCmdTimeoutSec
+	}
+
+	client, err := al.clientService.GetActiveByID(cid)
+	if err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to find an active client with id=%q.", cid), err)
+		return
+	}
+	if client == nil {
+		al.jsonErrorResponseWithTitle(w, http.StatusNotFound, fmt.Sprintf("Active client with id=%q not found.", cid))
+		return
+	}
+	if err := checkCommandsEnabled(client); err != nil {
+		al.jsonErrorResponseWithTitle(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	jid, err := generateNewJobID()
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+	// the client replaces the command with the one run by its package manager
+	installReq.Job = models.Job{
+		JobSummary: models.JobSummary{
+			JID: jid,
+		},
+		ClientID:   cid,
+		ClientName: client.Name,
+		Command:    installReq.JobCommand(),
+		CreatedBy:  api.GetUser(req.Context(), al.Logger),
+		TimeoutSec: input.TimeoutSec,
+	}
+	curJob := &installReq.Job
+	if err := al.prepareJobToSend(curJob); err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, "Failed to install updates.", err)
+		return
+	}
+
+	sshResp := &comm.RunCmdResponse{}
+	err = comm.SendRequestAndGetResponse(client.Connection, comm.RequestTypeInstallUpdates, installReq, sshResp)
+	if err != nil {
+		if _, ok := err.(*comm.ClientError); ok {
+			// the client refused to install updates, keep it as a failed job
+			curJob.Status = models.JobStatusFailed
+			now := time.Now()
+			curJob.StartedAt = now
+			curJob.FinishedAt = &now
+			curJob.Error = err.Error()
+			if dbErr := al.jobProvider.CreateJob(curJob); dbErr != nil {
+				al.Errorf("client_id=%q, Failed to persist a failed job: %v", curJob.ClientID, dbErr)
+			}
+			al.jsonErrorResponseWithTitle(w, http.StatusConflict, err.Error())
+		} else {
+			al.jsonErrorResponseWithError(w, http.StatusInternalServerError, "Failed to install updates.", err)
+		}
+		return
+	}
+
+	al.dispatchedJobs.Add(curJob.JID)
+
+	curJob.PID = &sshResp.Pid
+	curJob.StartedAt = sshResp.StartedAt
+	curJob.Status = models.JobStatusRunning
+
+	if err := al.jobProvider.CreateJob(curJob); err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, "Failed to persist a new job.", err)
+		return
+	}
+
+	resp := struct {
+		JID string `json:"jid"`
+	}{
+		JID: curJob.JID,
+	}
+	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(resp))
+
+	al.Debugf("Job[id=%q] created to install updates on client with id=%q.", curJob.JID, cid)
+}
@@ -0,0 +1,198 @@
+package chserver
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/rport/server/api"
+	"github.com/cloudradar-monitoring/rport/server/clients"
+	"github.com/cloudradar-monitoring/rport/share/comm"
+	"github.com/cloudradar-monitoring/rport/share/models"
+	"github.com/cloudradar-monitoring/rport/share/test"
+)
+
+func TestHandlePostUpdates(t *testing.T) {
+	testJID := "test-jid"
+	defaultGenerateNewJobID := generateNewJobID
+	defer func() { generateNewJobID = defaultGenerateNewJobID }()
+	generateNewJobID = func() (string, error) {
+		return testJID, nil
+	}
+	testUser := "test-user"
+	defaultTimeout := 60
+	signingPubKey, signingKey, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	sshSuccessResp := comm.RunCmdResponse{Pid: 123, StartedAt: time.Date(2020, 10, 10, 10, 10, 10, 0, time.UTC)}
+	sshRespBytes, err := json.Marshal(sshSuccessResp)
+	require.NoError(t, err)
+
+	connMock := test.NewConnMock()
+	c1 := clients.New(t).Connection(connMock).Build()
+	c2 := clients.New(t).DisconnectedDuration(5 * time.Minute).Build()
+	c3 := clients.New(t).Connection(connMock).Build()
+	c3.CommandsDisabled = true
+
+	testCases := []struct {
+		name            string
+		cid             string
+		requestBody     string
+		connReturnNotOk bool
+		connReturnResp  []byte
+		signingKey      ed25519.PrivateKey
+
+		wantStatusCode int
+		wantErrTitle   string
+		wantErrDetail  string
+		wantRequest    *comm.InstallUpdatesRequest
+		wantFailedJob  bool
+	}{
+		{
+			name:           "all updates",
+			cid:            c1.ID,
+			requestBody:    `{}`,
+			wantStatusCode: http.StatusOK,
+			wantRequest: &comm.InstallUpdatesRequest{
+				Job: models.Job{Command: "install updates", TimeoutSec: defaultTimeout},
+			},
+		},
+		{
+			name:           "security updates of given packages",
+			cid:            c1.ID,
+			requestBody:    `{"packages": ["openssl", "curl"], "security_only": true, "timeout_sec": 600}`,
+			wantStatusCode: http.StatusOK,
+			wantRequest: &comm.InstallUpdatesRequest{
+				Job:          models.Job{Command: "install security updates openssl curl", TimeoutSec: 600},
+				Packages:     []string{"openssl", "curl"},
+				SecurityOnly: true,
+			},
+		},
+		{
+			name:           "signed",
+			cid:            c1.ID,
+			requestBody:    `{"packages": ["openssl"]}`,
+			signingKey:     signingKey,
+			wantStatusCode: http.StatusOK,
+			wantRequest: &comm.InstallUpdatesRequest{
+				Job:      models.Job{Command: "install updates openssl", TimeoutSec: defaultTimeout},
+				Packages: []string{"openssl"},
+			},
+		},
+		{
+			name:           "invalid package",
+			cid:            c1.ID,
+			requestBody:    `{"packages": ["-y"]}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "Invalid packages.",
+			wantErrDetail:  `package name "-y" is invalid: it should start with a letter or digit, only letters, digits and '_.+:~@-' are allowed`,
+		},
+		{
+			name:           "disconnected client",
+			cid:            c2.ID,
+			requestBody:    `{}`,
+			wantStatusCode: http.StatusNotFound,
+			wantErrTitle:   fmt.Sprintf("Active client with id=%q not found.", c2.ID),
+		},
+		{
+			name:           "commands disabled on client",
+			cid:            c3.ID,
+			requestBody:    `{}`,
+			wantStatusCode: http.StatusConflict,
+			wantErrTitle:   fmt.Sprintf("command execution is disabled on client with id=%q", c3.ID),
+		},
+		{
+			name:            "refused by client",
+			cid:             c1.ID,
+			requestBody:     `{}`,
+			connReturnNotOk: true,
+			connReturnResp:  []byte("installing updates is not supported by zypper"),
+			wantStatusCode:  http.StatusConflict,
+			wantErrTitle:    "client error: installing updates is not supported by zypper",
+			wantFailedJob:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			al := APIListener{
+				insecureForTests: true,
+				Server: &Server{
+					clientService: NewClientService(nil, clients.NewClientRepository([]*clients.Client{c1, c2, c3}, &hour, testLog)),
+					config: &Config{
+						Server: ServerConfig{
+							RunRemoteCmdTimeoutSec: defaultTimeout,
+							MaxRequestBytes:        1024 * 1024,
+						},
+					},
+				},
+				Logger: testLog,
+			}
+			al.commandSigningKey = tc.signingKey
+			al.initRouter()
+			jp := NewJobProviderMock()
+			al.jobProvider = jp
+
+			connMock.ReturnOk = !tc.connReturnNotOk
+			connMock.ReturnResponsePayload = sshRespBytes
+			if len(tc.connReturnResp) > 0 {
+				connMock.ReturnResponsePayload = tc.connReturnResp
+			}
+
+			ctx := api.WithUser(context.Background(), testUser)
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/clients/%s/updates", tc.cid), strings.NewReader(tc.requestBody))
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			al.router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.wantStatusCode, w.Code)
+			if tc.wantErrTitle != "" {
+				wantResp := api.NewErrAPIPayloadFromMessage("", tc.wantErrTitle, tc.wantErrDetail)
+				wantRespBytes, err := json.Marshal(wantResp)
+				require.NoError(t, err)
+				assert.Equal(t, string(wantRespBytes), w.Body.String())
+				if tc.wantFailedJob {
+					require.NotNil(t, jp.InputCreateJob)
+					assert.Equal(t, models.JobStatusFailed, jp.InputCreateJob.Status)
+					assert.Equal(t, tc.wantErrTitle, jp.InputCreateJob.Error)
+				}
+				return
+			}
+
+			assert.Equal(t, `{"data":{"jid":"test-jid"}}`, w.Body.String())
+
+			name, _, payload := connMock.InputSendRequest()
+			assert.Equal(t, comm.RequestTypeInstallUpdates, name)
+			gotRequest := &comm.InstallUpdatesRequest{}
+			require.NoError(t, json.Unmarshal(payload, gotRequest))
+			wantRequest := tc.wantRequest
+			wantRequest.Job.JID = testJID
+			wantRequest.Job.ClientID = c1.ID
+			wantRequest.Job.ClientName = c1.Name
+			wantRequest.Job.CreatedBy = testUser
+			if tc.signingKey != nil {
+				assert.NoError(t, gotRequest.Job.VerifySignature(signingPubKey, time.Now()))
+				gotRequest.Job.Signature = ""
+				gotRequest.Job.SignatureExpiresAt = nil
+			}
+			assert.Equal(t, wantRequest, gotRequest)
+
+			gotJob := jp.InputCreateJob
+			require.NotNil(t, gotJob)
+			assert.Equal(t, models.JobStatusRunning, gotJob.Status)
+			assert.Equal(t, &sshSuccessResp.Pid, gotJob.PID)
+			assert.Equal(t, sshSuccessResp.StartedAt, gotJob.StartedAt)
+			assert.Equal(t, wantRequest.Job.Command, gotJob.Command)
+		})
+	}
+}
@@ -25,6 +25,9 @@ import (
 	"github.com/cloudradar-monitoring/rport/server/api/command"
 	"github.com/cloudradar-monitoring/rport/server/api/message"
 	"github.com/cloudradar-monitoring/rport/server/api/users"
+	"github.com/cloudradar-monitoring/rport/server/apikeys"
+	"github.com/cloudradar-monitoring/rport/server/auditlog"
+	"github.com/cloudradar-monitoring/rport/server/bans"
 	"github.com/cloudradar-monitoring/rport/server/vault"
 	chshare "github.com/cloudradar-monitoring/rport/share"
 	"github.com/cloudradar-monitoring/rport/share/enums"
@@ -48,7 +51,12 @@ type APIListener struct {
 	insecureForTests  bool
 	bannedUsers       *security.BanList
 	bannedIPs         *security.MaxBadAttemptsBanList
+	bansProvider      *bans.SqliteProvider
+	apiKeyProvider    *apikeys.SqliteProvider
+	auditLogProvider  *auditlog.SqliteProvider
 	twoFASrv          TwoFAService
+	// authenticator verifies passwords if users are managed by an external directory, nil otherwise
+	authenticator users.Authenticator
 
 	testDone chan bool // is used only in tests to be able to wait until async task is done
 
@@ -74,8 +82,28 @@ func NewAPIListener(
 	config := server.config
 
 	var usersProvider users.Provider
+	var authenticator users.Authenticator
 	var err error
-	if config.API.AuthFile != "" {
+	if config.LDAP.URL != "" {
+		ldapProvider := users.NewLDAPProvider(users.LDAPConfig{
+			URL:            config.LDAP.URL,
+			StartTLS:       config.LDAP.StartTLS,
+			BindDN:         config.LDAP.BindDN,
+			BindPassword:   config.LDAP.BindPassword,
+			BaseDN:         config.LDAP.BaseDN,
+			UserFilter:     config.LDAP.UserFilter,
+			GroupFilter:    config.LDAP.GroupFilter,
+			GroupAttribute: config.LDAP.GroupAttribute,
+			Groups:         config.LDAP.Groups,
+			Timeout:        config.LDAP.Timeout,
+			BindCacheTTL:   config.LDAP.BindCacheTTL,
+		})
+		if config.LDAP.AllowInsecure && !config.LDAP.StartTLS && strings.HasPrefix(strings.ToLower(config.LDAP.URL), "ldap://") {
+			server.Infof("LDAP passwords are sent in plain text, use ldaps:// or start_tls")
+		}
+		usersProvider = ldapProvider
+		authenticator = ldapProvider
+	} else if config.API.AuthFile != "" {
 		logger := chshare.NewLogger("auth-file", config.Logging.LogOutput, config.Logging.LogLevel)
 		usersProvider, err = users.NewFileAdapter(logger, users.NewFileManager(config.API.AuthFile))
 		if err != nil {
@@ -91,7 +119,7 @@ func NewAPIListener(
 		usersProvider = users.NewStaticProvider([]*users.User{authUser})
 	} else if config.API.AuthUserTable != "" {
 		logger := chshare.NewLogger("database", config.Logging.LogOutput, config.Logging.LogLevel)
-		usersProvider, err = users.NewUserDatabase(server.db, config.API.AuthUserTable, config.API.AuthGroupTable, config.API.IsTwoFAOn(), logger)
+		usersProvider, err = users.NewUserDatabase(server.db, config.API.AuthUserTable, config.API.AuthGroupTable, config.API.IsTwoFAOn() && !config.API.IsTOTPOn(), logger)
 		if err != nil {
 			return nil, err
 		}
@@ -135,23 +163,67 @@ func NewAPIListener(
 	commandProvider := command.NewSqliteProvider(libraryDb)
 	commandManager := command.NewManager(commandProvider)
 
-	userService := users.NewAPIService(usersProvider, config.API.IsTwoFAOn())
+	userService := users.NewAPIService(usersProvider, config.API.IsTwoFAOn() && !config.API.IsTOTPOn())
+
+	bansLogger := chshare.NewLogger("bans", config.Logging.LogOutput, config.Logging.LogLevel)
+	bansProvider, err := bans.NewSqliteProvider(path.Join(config.Server.DataDir, "bans.db"))
+	if err != nil {
+		return nil, err
+	}
+	pruned, err := bansProvider.DeleteExpired(time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to prune expired bans: %v", err)
+	}
+	bansLogger.Debugf("Pruned %d expired bans", pruned)
+	bannedUsers, err := security.NewPersistentBanList(time.Duration(config.API.UserLoginWait)*time.Second, bansProvider.Users(), bansLogger)
+	if err != nil {
+		return nil, err
+	}
+
+	apiKeyProvider, err := apikeys.NewSqliteProvider(path.Join(config.Server.DataDir, "api_keys.db"))
+	if err != nil {
+		return nil, err
+	}
+
+	apiSessionRepo := NewAPISessionRepository()
+	if config.API.PersistSessions {
+		apiSessionProvider, err := NewAPISessionSqliteProvider(path.Join(config.Server.DataDir, "api_sessions.db"))
+		if err != nil {
+			return nil, err
+		}
+		apiSessionRepo, err = InitAPISessionRepository(apiSessionProvider, time.Now())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	auditLogProvider, err := auditlog.NewSqliteProvider(path.Join(config.Server.DataDir, "audit_log.db"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create audit log DB instance: %v", err)
+	}
 
 	a := &APIListener{
 		Server:            server,
 		Logger:            chshare.NewLogger("api-listener", config.Logging.LogOutput, config.Logging.LogLevel),
 		fingerprint:       fingerprint,
-		apiSessionRepo:    NewAPISessionRepository(),
+		apiSessionRepo:    apiSessionRepo,
 		httpServer:        chshare.NewHTTPServer(int(config.Server.MaxRequestBytes), chshare.WithTLS(config.API.CertFile, config.API.KeyFile)),
 		requestLogOptions: config.InitRequestLogOptions(),
-		bannedUsers:       security.NewBanList(time.Duration(config.API.UserLoginWait) * time.Second),
+		bannedUsers:       bannedUsers,
+		bansProvider:      bansProvider,
+		apiKeyProvider:    apiKeyProvider,
+		auditLogProvider:  auditLogProvider,
 		userService:       userService,
+		authenticator:     authenticator,
 		vaultManager:      vault.NewManager(vaultDBProviderFactory, &vault.Aes256PassManager{}, vaultLogger),
 		scriptManager:     scriptManager,
 		commandManager:    commandManager,
 	}
 
-	if config.API.IsTwoFAOn() {
+	if config.API.IsTOTPOn() {
+		a.twoFASrv = NewTOTPTwoFAService(config.API.TwoFATokenTTLSeconds, userService)
+		a.Logger.Infof("2FA is enabled via using authenticator apps (totp)")
+	} else if config.API.IsTwoFAOn() {
 		var msgSrv message.Service
 		switch config.API.TwoFATokenDelivery {
 		case "pushover":
@@ -186,11 +258,15 @@ func NewAPIListener(
 	}
 
 	if config.API.MaxFailedLogin > 0 && config.API.BanTime > 0 {
-		a.bannedIPs = security.NewMaxBadAttemptsBanList(
+		a.bannedIPs, err = security.NewPersistentMaxBadAttemptsBanList(
 			config.API.MaxFailedLogin,
 			time.Duration(config.API.BanTime)*time.Second,
+			bansProvider.IPs(),
 			a.Logger,
 		)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	if config.API.AccessLogFile != "" {
@@ -242,6 +318,18 @@ func (al *APIListener) Close() error {
 	if al.commandManager != nil {
 		g.Go(al.commandManager.Close)
 	}
+	if al.bansProvider != nil {
+		g.Go(al.bansProvider.Close)
+	}
+	if al.apiKeyProvider != nil {
+		g.Go(al.apiKeyProvider.Close)
+	}
+	if al.auditLogProvider != nil {
+		g.Go(al.auditLogProvider.Close)
+	}
+	if al.apiSessionRepo != nil {
+		g.Go(al.apiSessionRepo.Close)
+	}
 
 	return g.Wait()
 }
@@ -256,6 +344,9 @@ func (al *APIListener) lookupUser(r *http.Request) (authorized bool, username st
 	}
 
 	if bearerToken, bearerAuthProvided := getBearerToken(r); bearerAuthProvided {
+		if apikeys.IsKey(bearerToken) {
+			return al.handleAPIKey(r, bearerToken)
+		}
 		return al.handleBearerToken(bearerToken)
 	}
 
@@ -276,6 +367,11 @@ func (al *APIListener) handleBasicAuth(username, password string) (authorized bo
 	if username == "" {
 		return false, "", nil
 	}
+
+	if al.authenticator != nil {
+		return al.authenticate(username, password)
+	}
+
 	user, err := al.userService.GetByUsername(username)
 	if err != nil {
 		return false, username, fmt.Errorf("failed to get user: %v", err)
@@ -325,6 +421,11 @@ func (al *APIListener) validateCredentials(username, password string) (bool, err
 		return false, nil
 	}
 
+	if al.authenticator != nil {
+		authorized, _, err := al.authenticate(username, password)
+		return authorized, err
+	}
+
 	user, err := al.userService.GetByUsername(username)
 	if err != nil {
 		return false, fmt.Errorf("failed to get user: %v", err)
@@ -336,6 +437,15 @@ func (al *APIListener) validateCredentials(username, password string) (bool, err
 	return verifyPassword(user.Password, password), nil
 }
 
+// authenticate verifies a password of a given user by the external directory, it refreshes groups of the user as well.
+func (al *APIListener) authenticate(username, password string) (authorized bool, name string, err error) {
+	user, err := al.authenticator.Authenticate(username, password)
+	if err != nil {
+		return false, username, fmt.Errorf("failed to authenticate user: %v", err)
+	}
+	return user != nil, username, nil
+}
+
 func verifyPassword(saved, provided string) bool {
 	// bcrypt hashed password
 	if strings.HasPrefix(saved, htpasswdBcryptPrefix) {
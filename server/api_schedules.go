@@ -0,0 +1,440 @@
+package chserver
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/cloudradar-monitoring/rport/server/api"
+	errors2 "github.com/cloudradar-monitoring/rport/server/api/errors"
+	"github.com/cloudradar-monitoring/rport/server/cgroups"
+	"github.com/cloudradar-monitoring/rport/server/clients"
+	"github.com/cloudradar-monitoring/rport/server/scheduler"
+	"github.com/cloudradar-monitoring/rport/server/validation"
+	"github.com/cloudradar-monitoring/rport/share/models"
+	"github.com/cloudradar-monitoring/rport/share/random"
+)
+
+const (
+	routeParamScheduleID = "schedule_id"
+
+	// schedulesCheckInterval is how often schedules are checked whether they should be triggered
+	schedulesCheckInterval = 10 * time.Second
+)
+
+var generateNewScheduleID = func() (string, error) {
+	return random.UUID4()
+}
+
+type ScheduleProvider interface {
+	ListSchedules() ([]*models.Schedule, error)
+	// GetSchedule returns nil if a schedule is not found
+	GetSchedule(id string) (*models.Schedule, error)
+	// SaveSchedule creates or updates a schedule
+	SaveSchedule(schedule *models.Schedule) error
+	// DeleteSchedule returns false if a schedule is not found
+	DeleteSchedule(id string) (bool, error)
+}
+
+type scheduleRequest struct {
+	Cron                string   `json:"cron"`
+	ClientIDs           []string `json:"client_ids"`
+	GroupIDs            []string `json:"group_ids"`
+	Command             string   `json:"command"`
+	Script              string   `json:"script"`
+	Cwd                 string   `json:"cwd"`
+	IsSudo              bool     `json:"is_sudo"`
+	Interpreter         string   `json:"interpreter"`
+	IsTemplate          bool     `json:"is_template"`
+	TimeoutSec          int      `json:"timeout_sec"`
+	ExecuteConcurrently bool     `json:"execute_concurrently"`
+	AbortOnError        *bool    `json:"abort_on_error"` // pointer is used because it's default value is true
+}
+
+func (al *APIListener) handlePostSchedule(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	var reqBody scheduleRequest
+	err := parseRequestBody(req.Body, &reqBody)
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	if _, err := scheduler.ParseCron(reqBody.Cron); err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusBadRequest, "Invalid cron expression.", err)
+		return
+	}
+
+	isScript := false
+	switch {
+	case reqBody.Command != "" && reqBody.Script != "":
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, "Either command or script should be specified, not both.")
+		return
+	case reqBody.Script != "":
+		decoded, err := base64.StdEncoding.DecodeString(reqBody.Script)
+		if err != nil {
+			al.jsonErrorResponseWithError(w, http.StatusBadRequest, "Failed to decode script payload from base64.", err)
+			return
+		}
+		reqBody.Command = string(decoded)
+		isScript = true
+		// scripts are sent as is
+		reqBody.IsTemplate = false
+	case reqBody.Command == "":
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, "Command cannot be empty.")
+		return
+	}
+	if err := validateCommandTemplate(reqBody.Command, reqBody.IsTemplate, nil); err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusBadRequest, "Invalid command.", err)
+		return
+	}
+	if err := validation.ValidateInterpreter(reqBody.Interpreter, isScript); err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusBadRequest, "Invalid interpreter.", err)
+		return
+	}
+
+	if len(reqBody.ClientIDs) == 0 && len(reqBody.GroupIDs) == 0 {
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, "At least one client or group should be specified.")
+		return
+	}
+
+	// clients of the schedule don't need to be connected now, so only their access is checked
+	var scheduleClients []*clients.Client
+	for _, cid := range reqBody.ClientIDs {
+		client, err := al.clientService.GetByID(cid)
+		if err != nil {
+			al.jsonErrorResponseWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to find a client with id=%q.", cid), err)
+			return
+		}
+		if client == nil {
+			al.jsonErrorResponseWithTitle(w, http.StatusNotFound, fmt.Sprintf("Client with id=%q not found.", cid))
+			return
+		}
+		scheduleClients = append(scheduleClients, client)
+	}
+	groupClients, err := al.getGroupsActiveClients(ctx, reqBody.GroupIDs)
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+	scheduleClients = append(scheduleClients, groupClients...)
+
+	curUser, err := al.getUserModelForAuth(ctx)
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+	err = al.clientService.CheckClientsAccess(scheduleClients, curUser)
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	if reqBody.TimeoutSec <= 0 {
+		reqBody.TimeoutSec = al.config.Server.RunRemoteCmdTimeoutSec
+	}
+	// by default abortOnErr is true
+	abortOnErr := true
+	if reqBody.AbortOnError != nil {
+		abortOnErr = *reqBody.AbortOnError
+	}
+
+	id, err := generateNewScheduleID()
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+	schedule := &models.Schedule{
+		ID:          id,
+		CreatedAt:   time.Now().UTC(),
+		CreatedBy:   curUser.Username,
+		Cron:        reqBody.Cron,
+		ClientIDs:   reqBody.ClientIDs,
+		GroupIDs:    reqBody.GroupIDs,
+		Command:     reqBody.Command,
+		Interpreter: reqBody.Interpreter,
+		Cwd:         reqBody.Cwd,
+		IsSudo:      reqBody.IsSudo,
+		IsScript:    isScript,
+		IsTemplate:  reqBody.IsTemplate,
+		TimeoutSec:  reqBody.TimeoutSec,
+		Concurrent:  reqBody.ExecuteConcurrently,
+		AbortOnErr:  abortOnErr,
+	}
+	if err := al.scheduleProvider.SaveSchedule(schedule); err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, "Failed to persist a new schedule.", err)
+		return
+	}
+
+	al.writeJSONResponse(w, http.StatusCreated, api.NewSuccessPayload(schedule))
+
+	al.Debugf("Schedule[id=%q] created to execute remote command %q on clients %s, groups %s by %q.", schedule.ID, schedule.Command, schedule.ClientIDs, schedule.GroupIDs, schedule.Cron)
+}
+
+// getGroupsActiveClients returns active clients of given groups. Returns an error if a group is not found.
+func (al *APIListener) getGroupsActiveClients(ctx context.Context, groupIDs []string) ([]*clients.Client, error) {
+	if len(groupIDs) == 0 {
+		return nil, nil
+	}
+	var groups []*cgroups.ClientGroup
+	for _, groupID := range groupIDs {
+		group, err := al.clientGroupProvider.Get(ctx, groupID)
+		if err != nil {
+			return nil, errors2.APIError{
+				Message:    fmt.Sprintf("Failed to get a client group with id=%q.", groupID),
+				Err:        err,
+				HTTPStatus: http.StatusInternalServerError,
+			}
+		}
+		if group == nil {
+			return nil, errors2.APIError{
+				Message:    fmt.Sprintf("Unknown group with id=%q.", groupID),
+				HTTPStatus: http.StatusBadRequest,
+			}
+		}
+		groups = append(groups, group)
+	}
+	return al.clientService.GetActiveByGroups(groups), nil
+}
+
+// handleListSchedules returns all schedules to admins and only own schedules to other users.
+func (al *APIListener) handleListSchedules(w http.ResponseWriter, req *http.Request) {
+	curUser, err := al.getUserModelForAuth(req.Context())
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	schedules, err := al.scheduleProvider.ListSchedules()
+	if err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, "Failed to get schedules.", err)
+		return
+	}
+
+	if !curUser.IsAdmin() {
+		own := make([]*models.Schedule, 0, len(schedules))
+		for _, schedule := range schedules {
+			if schedule.CreatedBy == curUser.Username {
+				own = append(own, schedule)
+			}
+		}
+		schedules = own
+	}
+
+	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(schedules))
+}
+
+// getAccessibleSchedule returns a schedule by a given id if the current user created it or is an admin.
+func (al *APIListener) getAccessibleSchedule(req *http.Request, id string) (*models.Schedule, error) {
+	curUser, err := al.getUserModelForAuth(req.Context())
+	if err != nil {
+		return nil, err
+	}
+
+	schedule, err := al.scheduleProvider.GetSchedule(id)
+	if err != nil {
+		return nil, errors2.APIError{
+			Message:    fmt.Sprintf("Failed to find a schedule[id=%q].", id),
+			Err:        err,
+			HTTPStatus: http.StatusInternalServerError,
+		}
+	}
+	if schedule == nil {
+		return nil, errors2.APIError{
+			Message:    fmt.Sprintf("Schedule[id=%q] not found.", id),
+			HTTPStatus: http.StatusNotFound,
+		}
+	}
+	if schedule.CreatedBy != curUser.Username && !curUser.IsAdmin() {
+		return nil, errors2.APIError{
+			Message:    fmt.Sprintf("Access denied to schedule[id=%q].", id),
+			HTTPStatus: http.StatusForbidden,
+		}
+	}
+	return schedule, nil
+}
+
+func (al *APIListener) handleGetSchedule(w http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)[routeParamScheduleID]
+	schedule, err := al.getAccessibleSchedule(req, id)
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(schedule))
+}
+
+func (al *APIListener) handleDeleteSchedule(w http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)[routeParamScheduleID]
+	if _, err := al.getAccessibleSchedule(req, id); err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	deleted, err := al.scheduleProvider.DeleteSchedule(id)
+	if err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to delete a schedule[id=%q].", id), err)
+		return
+	}
+	if !deleted {
+		al.jsonErrorResponseWithTitle(w, http.StatusNotFound, fmt.Sprintf("Schedule[id=%q] not found.", id))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	al.Debugf("Schedule[id=%q] deleted by %q.", id, api.GetUser(req.Context(), al.Logger))
+}
+
+// scheduleTask triggers schedules which cron expression matches the server local time.
+type scheduleTask struct {
+	al *APIListener
+	// checkedUntil is the last minute that was checked
+	checkedUntil time.Time
+	// now is used to stub time.Now in tests
+	now func() time.Time
+}
+
+func newScheduleTask(al *APIListener) *scheduleTask {
+	return &scheduleTask{
+		al:  al,
+		now: time.Now,
+	}
+}
+
+// Run triggers schedules that match any minute since the previous run. Each schedule is triggered once at most.
+func (t *scheduleTask) Run(ctx context.Context) error {
+	now := t.now().Truncate(time.Minute)
+	if t.checkedUntil.IsZero() {
+		t.checkedUntil = now.Add(-time.Minute)
+	}
+	if !now.After(t.checkedUntil) {
+		return nil
+	}
+	from := t.checkedUntil.Add(time.Minute)
+	t.checkedUntil = now
+
+	schedules, err := t.al.scheduleProvider.ListSchedules()
+	if err != nil {
+		return err
+	}
+	for _, schedule := range schedules {
+		cron, err := scheduler.ParseCron(schedule.Cron)
+		if err != nil {
+			t.al.Errorf("Schedule[id=%q] has invalid cron expression: %v", schedule.ID, err)
+			continue
+		}
+		for m := from; !m.After(now); m = m.Add(time.Minute) {
+			if cron.Match(m) {
+				t.al.runSchedule(schedule)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// runSchedule creates a multi-client job of a given schedule and executes it on its clients that are connected now.
+func (al *APIListener) runSchedule(schedule *models.Schedule) {
+	orderedClients := al.getScheduleActiveClients(schedule)
+	if len(orderedClients) == 0 {
+		al.Infof("Schedule[id=%q] skipped: no active clients.", schedule.ID)
+		return
+	}
+
+	// permissions of the creator may have changed since the schedule was created
+	creator, err := al.userService.GetByUsername(schedule.CreatedBy)
+	if err != nil {
+		al.Errorf("Schedule[id=%q]: failed to find its creator %q: %v", schedule.ID, schedule.CreatedBy, err)
+		return
+	}
+	if creator == nil {
+		al.Infof("Schedule[id=%q] skipped: its creator %q no longer exists.", schedule.ID, schedule.CreatedBy)
+		return
+	}
+	if err := al.clientService.CheckClientsAccess(orderedClients, creator); err != nil {
+		al.Infof("Schedule[id=%q] skipped: %v", schedule.ID, err)
+		return
+	}
+
+	jid, err := generateNewJobID()
+	if err != nil {
+		al.Errorf("Schedule[id=%q]: failed to generate a job id: %v", schedule.ID, err)
+		return
+	}
+	now := time.Now()
+	multiJob := &models.MultiJob{
+		MultiJobSummary: models.MultiJobSummary{
+			JID:       jid,
+			StartedAt: now,
+			CreatedBy: schedule.CreatedBy,
+		},
+		ClientIDs:   schedule.ClientIDs,
+		GroupIDs:    schedule.GroupIDs,
+		Command:     schedule.Command,
+		Interpreter: schedule.Interpreter,
+		Cwd:         schedule.Cwd,
+		IsSudo:      schedule.IsSudo,
+		IsScript:    schedule.IsScript,
+		IsTemplate:  schedule.IsTemplate,
+		TimeoutSec:  schedule.TimeoutSec,
+		Concurrent:  schedule.Concurrent,
+		AbortOnErr:  schedule.AbortOnErr,
+	}
+	done, err := al.jobsDoneChannel.Add(multiJob.JID, len(orderedClients))
+	if err != nil {
+		al.Errorf("Schedule[id=%q] skipped: %v", schedule.ID, err)
+		return
+	}
+	if err := al.jobProvider.SaveMultiJob(multiJob); err != nil {
+		al.jobsDoneChannel.Del(multiJob.JID)
+		al.Errorf("Schedule[id=%q]: failed to persist a new multi-client job: %v", schedule.ID, err)
+		return
+	}
+
+	schedule.LastRunAt = &now
+	schedule.LastMultiJobID = multiJob.JID
+	if err := al.scheduleProvider.SaveSchedule(schedule); err != nil {
+		al.Errorf("Schedule[id=%q]: failed to save the last run: %v", schedule.ID, err)
+	}
+
+	al.Debugf("Multi-client Job[id=%q] created by schedule[id=%q] to execute remote command on %d client(s): %q.", multiJob.JID, schedule.ID, len(orderedClients), schedule.Command)
+
+	go al.executeMultiClientJob(multiJob, orderedClients, done)
+}
+
+// getScheduleActiveClients returns clients of a given schedule that are connected now. Disconnected ones are skipped.
+func (al *APIListener) getScheduleActiveClients(schedule *models.Schedule) []*clients.Client {
+	var res []*clients.Client
+	usedClientIDs := make(map[string]bool)
+	for _, cid := range schedule.ClientIDs {
+		client, err := al.clientService.GetActiveByID(cid)
+		if err != nil {
+			al.Errorf("Schedule[id=%q]: failed to find a client with id=%q: %v", schedule.ID, cid, err)
+			continue
+		}
+		if client == nil {
+			al.Debugf("Schedule[id=%q]: client with id=%q is not active, skipped.", schedule.ID, cid)
+			continue
+		}
+		usedClientIDs[cid] = true
+		res = append(res, client)
+	}
+
+	groupClients, err := al.getGroupsActiveClients(context.Background(), schedule.GroupIDs)
+	if err != nil {
+		al.Errorf("Schedule[id=%q]: failed to get clients of groups %s: %v", schedule.ID, schedule.GroupIDs, err)
+	}
+	for _, client := range groupClients {
+		if !usedClientIDs[client.ID] {
+			usedClientIDs[client.ID] = true
+			res = append(res, client)
+		}
+	}
+	return res
+}
@@ -0,0 +1,349 @@
+package chserver
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/rport/server/api"
+	"github.com/cloudradar-monitoring/rport/server/api/jobs"
+	"github.com/cloudradar-monitoring/rport/server/api/users"
+	"github.com/cloudradar-monitoring/rport/server/clients"
+	"github.com/cloudradar-monitoring/rport/share/comm"
+	"github.com/cloudradar-monitoring/rport/share/models"
+	"github.com/cloudradar-monitoring/rport/share/test"
+)
+
+func newScheduleTestAPIListener(t *testing.T, list []*clients.Client) (*APIListener, *jobs.SQLProvider) {
+	curUser := &users.User{
+		Username: "test-user",
+		Groups:   []string{users.Administrators},
+	}
+	otherUser := &users.User{
+		Username: "other-user",
+		Groups:   []string{"operators"},
+	}
+	jp, err := jobs.NewSqliteProvider("file::memory:?cache=shared", testLog)
+	require.NoError(t, err)
+	t.Cleanup(func() { jp.Close() })
+
+	al := &APIListener{
+		insecureForTests: true,
+		Server: &Server{
+			clientService: NewClientService(nil, clients.NewClientRepository(list, &hour, testLog)),
+			config: &Config{
+				Server: ServerConfig{
+					RunRemoteCmdTimeoutSec: 60,
+					MaxRequestBytes:        1024 * 1024,
+				},
+			},
+			jobsDoneChannel: jobResultChanMap{
+				m: make(map[string]chan *models.Job),
+			},
+			jobProvider:      jp,
+			scheduleProvider: jp,
+		},
+		userService: users.NewAPIService(users.NewStaticProvider([]*users.User{curUser, otherUser}), false),
+		Logger:      testLog,
+	}
+	al.initRouter()
+	return al, jp
+}
+
+func TestHandlePostSchedule(t *testing.T) {
+	defaultGenerateNewScheduleID := generateNewScheduleID
+	defer func() { generateNewScheduleID = defaultGenerateNewScheduleID }()
+	generateNewScheduleID = func() (string, error) {
+		return "schedule-1", nil
+	}
+
+	c1 := clients.New(t).ID("client-1").Connection(test.NewConnMock()).Build()
+	c2 := clients.New(t).ID("client-2").DisconnectedDuration(5 * time.Minute).Build()
+
+	testCases := []struct {
+		name        string
+		requestBody string
+
+		wantStatusCode int
+		wantErrTitle   string
+		wantErrDetail  string
+		wantSchedule   *models.Schedule
+	}{
+		{
+			name: "command",
+			requestBody: `{
+				"cron": "*/5 * * * *",
+				"client_ids": ["client-1", "client-2"],
+				"command": "/usr/bin/uptime",
+				"execute_concurrently": true
+			}`,
+			wantStatusCode: http.StatusCreated,
+			wantSchedule: &models.Schedule{
+				ID:         "schedule-1",
+				CreatedBy:  "test-user",
+				Cron:       "*/5 * * * *",
+				ClientIDs:  []string{"client-1", "client-2"},
+				Command:    "/usr/bin/uptime",
+				TimeoutSec: 60,
+				Concurrent: true,
+				AbortOnErr: true,
+			},
+		},
+		{
+			name: "script",
+			requestBody: `{
+				"cron": "0 3 * * *",
+				"client_ids": ["client-1"],
+				"script": "` + base64.StdEncoding.EncodeToString([]byte("uptime")) + `",
+				"timeout_sec": 10,
+				"abort_on_error": false
+			}`,
+			wantStatusCode: http.StatusCreated,
+			wantSchedule: &models.Schedule{
+				ID:         "schedule-1",
+				CreatedBy:  "test-user",
+				Cron:       "0 3 * * *",
+				ClientIDs:  []string{"client-1"},
+				Command:    "uptime",
+				IsScript:   true,
+				TimeoutSec: 10,
+			},
+		},
+		{
+			name:           "invalid cron",
+			requestBody:    `{"cron": "* * *", "client_ids": ["client-1"], "command": "/usr/bin/uptime"}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "Invalid cron expression.",
+			wantErrDetail:  `invalid cron expression "* * *": expected 5 fields, got 3`,
+		},
+		{
+			name:           "command and script",
+			requestBody:    `{"cron": "* * * * *", "client_ids": ["client-1"], "command": "/usr/bin/uptime", "script": "dXB0aW1l"}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "Either command or script should be specified, not both.",
+		},
+		{
+			name:           "empty command",
+			requestBody:    `{"cron": "* * * * *", "client_ids": ["client-1"]}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "Command cannot be empty.",
+		},
+		{
+			name:           "no clients",
+			requestBody:    `{"cron": "* * * * *", "command": "/usr/bin/uptime"}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "At least one client or group should be specified.",
+		},
+		{
+			name:           "unknown client",
+			requestBody:    `{"cron": "* * * * *", "client_ids": ["client-3"], "command": "/usr/bin/uptime"}`,
+			wantStatusCode: http.StatusNotFound,
+			wantErrTitle:   `Client with id="client-3" not found.`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			al, jp := newScheduleTestAPIListener(t, []*clients.Client{c1, c2})
+
+			ctx := api.WithUser(context.Background(), "test-user")
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/schedules", strings.NewReader(tc.requestBody))
+			req = req.WithContext(ctx)
+			w := httptest.NewRecorder()
+			al.router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.wantStatusCode, w.Code)
+			gotSchedules, err := jp.ListSchedules()
+			require.NoError(t, err)
+			if tc.wantErrTitle != "" {
+				wantResp := api.NewErrAPIPayloadFromMessage("", tc.wantErrTitle, tc.wantErrDetail)
+				wantRespBytes, err := json.Marshal(wantResp)
+				require.NoError(t, err)
+				assert.JSONEq(t, string(wantRespBytes), w.Body.String())
+				assert.Empty(t, gotSchedules)
+				return
+			}
+
+			require.Len(t, gotSchedules, 1)
+			assert.WithinDuration(t, time.Now(), gotSchedules[0].CreatedAt, time.Minute)
+			tc.wantSchedule.CreatedAt = gotSchedules[0].CreatedAt
+			assert.Equal(t, tc.wantSchedule, gotSchedules[0])
+			wantRespBytes, err := json.Marshal(api.NewSuccessPayload(tc.wantSchedule))
+			require.NoError(t, err)
+			assert.JSONEq(t, string(wantRespBytes), w.Body.String())
+		})
+	}
+}
+
+func TestHandleGetAndDeleteSchedules(t *testing.T) {
+	al, jp := newScheduleTestAPIListener(t, nil)
+	schedule := &models.Schedule{
+		ID:        "schedule-1",
+		CreatedAt: time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC),
+		CreatedBy: "test-user",
+		Cron:      "* * * * *",
+		ClientIDs: []string{"client-1"},
+		Command:   "/usr/bin/uptime",
+	}
+	require.NoError(t, jp.SaveSchedule(schedule))
+	wantScheduleBytes, err := json.Marshal(api.NewSuccessPayload(schedule))
+	require.NoError(t, err)
+	wantListBytes, err := json.Marshal(api.NewSuccessPayload([]*models.Schedule{schedule}))
+	require.NoError(t, err)
+	wantNotFoundBytes, err := json.Marshal(api.NewErrAPIPayloadFromMessage("", `Schedule[id="schedule-1"] not found.`, ""))
+	require.NoError(t, err)
+
+	wantForbiddenBytes, err := json.Marshal(api.NewErrAPIPayloadFromMessage("", `Access denied to schedule[id="schedule-1"].`, ""))
+	require.NoError(t, err)
+
+	steps := []struct {
+		user           string
+		method         string
+		url            string
+		wantStatusCode int
+		wantBody       string
+	}{
+		{user: "other-user", method: http.MethodGet, url: "/api/v1/schedules", wantStatusCode: http.StatusOK, wantBody: `{"data":[]}`},
+		{user: "other-user", method: http.MethodGet, url: "/api/v1/schedules/schedule-1", wantStatusCode: http.StatusForbidden, wantBody: string(wantForbiddenBytes)},
+		{user: "other-user", method: http.MethodDelete, url: "/api/v1/schedules/schedule-1", wantStatusCode: http.StatusForbidden, wantBody: string(wantForbiddenBytes)},
+		{method: http.MethodGet, url: "/api/v1/schedules", wantStatusCode: http.StatusOK, wantBody: string(wantListBytes)},
+		{method: http.MethodGet, url: "/api/v1/schedules/schedule-1", wantStatusCode: http.StatusOK, wantBody: string(wantScheduleBytes)},
+		{method: http.MethodDelete, url: "/api/v1/schedules/schedule-1", wantStatusCode: http.StatusNoContent},
+		{method: http.MethodDelete, url: "/api/v1/schedules/schedule-1", wantStatusCode: http.StatusNotFound, wantBody: string(wantNotFoundBytes)},
+		{method: http.MethodGet, url: "/api/v1/schedules/schedule-1", wantStatusCode: http.StatusNotFound, wantBody: string(wantNotFoundBytes)},
+		{method: http.MethodGet, url: "/api/v1/schedules", wantStatusCode: http.StatusOK, wantBody: `{"data":[]}`},
+	}
+
+	for _, step := range steps {
+		if step.user == "" {
+			step.user = "test-user"
+		}
+		req := httptest.NewRequest(step.method, step.url, nil)
+		req = req.WithContext(api.WithUser(req.Context(), step.user))
+		w := httptest.NewRecorder()
+		al.router.ServeHTTP(w, req)
+
+		assert.Equal(t, step.wantStatusCode, w.Code, "%s %s by %s", step.method, step.url, step.user)
+		if step.wantBody != "" {
+			assert.JSONEq(t, step.wantBody, w.Body.String(), "%s %s by %s", step.method, step.url, step.user)
+		}
+	}
+}
+
+func TestScheduleTaskRun(t *testing.T) {
+	connMock := test.NewConnMock()
+	connMock.ReturnOk = true
+	sshRespBytes, err := json.Marshal(comm.RunCmdResponse{Pid: 1, StartedAt: time.Date(2021, 3, 1, 10, 30, 1, 0, time.UTC)})
+	require.NoError(t, err)
+	connMock.ReturnResponsePayload = sshRespBytes
+	c1 := clients.New(t).ID("client-1").Connection(connMock).Build()
+	c2 := clients.New(t).ID("client-2").DisconnectedDuration(5 * time.Minute).Build()
+
+	al, jp := newScheduleTestAPIListener(t, []*clients.Client{c1, c2})
+	done := make(chan bool)
+	al.testDone = done
+
+	every30 := &models.Schedule{
+		ID:         "every-30",
+		CreatedBy:  "test-user",
+		Cron:       "*/30 * * * *",
+		ClientIDs:  []string{"client-1", "client-2"},
+		Command:    "/usr/bin/uptime",
+		TimeoutSec: 60,
+		Concurrent: true,
+	}
+	yearly := &models.Schedule{
+		ID:         "yearly",
+		CreatedBy:  "test-user",
+		Cron:       "0 0 1 1 *",
+		ClientIDs:  []string{"client-1"},
+		Command:    "/usr/bin/date",
+		TimeoutSec: 60,
+	}
+	disconnected := &models.Schedule{
+		ID:         "disconnected",
+		CreatedBy:  "test-user",
+		Cron:       "* * * * *",
+		ClientIDs:  []string{"client-2"},
+		Command:    "/usr/bin/date",
+		TimeoutSec: 60,
+	}
+	noAccess := &models.Schedule{
+		ID:         "no-access",
+		CreatedBy:  "other-user",
+		Cron:       "* * * * *",
+		ClientIDs:  []string{"client-1"},
+		Command:    "/usr/bin/date",
+		TimeoutSec: 60,
+	}
+	deletedUser := &models.Schedule{
+		ID:         "deleted-user",
+		CreatedBy:  "deleted-user",
+		Cron:       "* * * * *",
+		ClientIDs:  []string{"client-1"},
+		Command:    "/usr/bin/date",
+		TimeoutSec: 60,
+	}
+	require.NoError(t, jp.SaveSchedule(every30))
+	require.NoError(t, jp.SaveSchedule(yearly))
+	require.NoError(t, jp.SaveSchedule(disconnected))
+	require.NoError(t, jp.SaveSchedule(noAccess))
+	require.NoError(t, jp.SaveSchedule(deletedUser))
+
+	now := time.Date(2021, 3, 1, 10, 29, 50, 0, time.Local)
+	task := newScheduleTask(al)
+	task.now = func() time.Time { return now }
+
+	// nothing matches at 10:29
+	require.NoError(t, task.Run(context.Background()))
+
+	// 10:30 matches
+	now = now.Add(20 * time.Second)
+	require.NoError(t, task.Run(context.Background()))
+
+	gotSchedule, err := jp.GetSchedule("every-30")
+	require.NoError(t, err)
+	require.NotNil(t, gotSchedule.LastRunAt)
+	require.NotEmpty(t, gotSchedule.LastMultiJobID)
+	// emulate the client that reports its result, the concurrent job is in-flight until then
+	var childJobs []*models.Job
+	require.Eventually(t, func() bool {
+		childJobs, err = jp.GetByMultiJobID(gotSchedule.LastMultiJobID)
+		require.NoError(t, err)
+		return len(childJobs) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.True(t, al.jobsDoneChannel.Send(gotSchedule.LastMultiJobID, childJobs[0]))
+	<-done
+
+	gotMultiJob, err := jp.GetMultiJob(gotSchedule.LastMultiJobID)
+	require.NoError(t, err)
+	require.NotNil(t, gotMultiJob)
+	assert.Equal(t, "test-user", gotMultiJob.CreatedBy)
+	assert.Equal(t, "/usr/bin/uptime", gotMultiJob.Command)
+	assert.Equal(t, []string{"client-1", "client-2"}, gotMultiJob.ClientIDs)
+	// the disconnected client is skipped
+	require.Len(t, gotMultiJob.Jobs, 1)
+	assert.Equal(t, "client-1", gotMultiJob.Jobs[0].ClientID)
+	assert.Equal(t, models.JobStatusRunning, gotMultiJob.Jobs[0].Status)
+
+	// not matching, no active clients, the creator has no access to the client or no longer exists
+	for _, id := range []string{"yearly", "disconnected", "no-access", "deleted-user"} {
+		gotSchedule, err := jp.GetSchedule(id)
+		require.NoError(t, err)
+		assert.Nil(t, gotSchedule.LastRunAt, id)
+	}
+
+	// the same minute is not triggered again
+	require.NoError(t, task.Run(context.Background()))
+	gotSchedule2, err := jp.GetSchedule("every-30")
+	require.NoError(t, err)
+	assert.Equal(t, gotSchedule.LastMultiJobID, gotSchedule2.LastMultiJobID)
+}
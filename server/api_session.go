@@ -1,46 +1,242 @@
 package chserver
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
 	"sync"
 	"time"
+
+	chshare "github.com/cloudradar-monitoring/rport/share"
 )
 
 type APISession struct {
-	Token     string
+	// TokenHash is a hex encoded sha256 of the JWT token, tokens themselves are never stored
+	TokenHash string
 	ExpiresAt time.Time
+	// ID is the id of the JWT token
+	ID       string
+	Username string
+	IssuedAt time.Time
+	// UserAgent and IP are of the login request, empty if unknown
+	UserAgent string
+	IP        string
+}
+
+// hashAPISessionToken returns a value of APISession.TokenHash for a given JWT token.
+func hashAPISessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
+// APISessionProvider stores API sessions, so they survive server restarts.
+type APISessionProvider interface {
+	GetAll() ([]*APISession, error)
+	// Save creates a new or updates an existing session by its token hash
+	Save(session *APISession) error
+	// UpdateExpiresAt changes the expiration time of a session by its token hash, nothing is changed if it doesn't exist
+	UpdateExpiresAt(tokenHash string, expiresAt time.Time) error
+	Delete(tokenHash string) error
+	// DeleteExpired deletes all sessions that expired before a given time. Returns a number of deleted sessions
+	DeleteExpired(now time.Time) (int64, error)
+	Close() error
+}
+
+// apiSessionSaveInterval is a min extension of a session lifetime that is written to the storage. Smaller extensions
+// are kept in memory only, so not every request writes to the storage.
+const apiSessionSaveInterval = time.Minute
+
 type APISessionRepository struct {
+	// sessions are by token hashes
 	sessions map[string]*APISession
 	mu       sync.RWMutex
+	// provider is optional, if set all changes are written through to it
+	provider APISessionProvider
+	// savedExpiresAt are expiration times of sessions in the storage by token hashes
+	savedExpiresAt map[string]time.Time
 }
 
 func NewAPISessionRepository() *APISessionRepository {
 	return &APISessionRepository{
-		sessions: make(map[string]*APISession),
+		sessions:       make(map[string]*APISession),
+		savedExpiresAt: make(map[string]time.Time),
+	}
+}
+
+// InitAPISessionRepository returns a repository that persists sessions in a given storage. It's populated with
+// stored sessions that are not expired at a given time, expired ones are deleted.
+func InitAPISessionRepository(provider APISessionProvider, now time.Time) (*APISessionRepository, error) {
+	if _, err := provider.DeleteExpired(now); err != nil {
+		return nil, fmt.Errorf("failed to delete expired API sessions: %v", err)
+	}
+	stored, err := provider.GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API sessions: %v", err)
+	}
+	r := NewAPISessionRepository()
+	r.provider = provider
+	for _, s := range stored {
+		r.sessions[s.TokenHash] = s
+		r.savedExpiresAt[s.TokenHash] = s.ExpiresAt
 	}
+	return r, nil
 }
 
 func (r *APISessionRepository) Save(session *APISession) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	r.sessions[session.Token] = session
+	if r.provider != nil {
+		if err := r.provider.Save(session); err != nil {
+			return err
+		}
+		r.savedExpiresAt[session.TokenHash] = session.ExpiresAt
+	}
+	r.sessions[session.TokenHash] = session
 	return nil
 }
 
+// ExtendLifetime extends a session by a given lifetime. An expired session is extended from a given time.
+// A session that is deleted in the meantime is not recreated, false is returned in that case.
+// The new expiration time is written to the storage only if it's at least apiSessionSaveInterval later
+// than the stored one, so a session can expire up to that interval earlier after a restart.
+func (r *APISessionRepository) ExtendLifetime(tokenHash string, lifetime time.Duration, now time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s, exists := r.sessions[tokenHash]
+	if !exists {
+		return false, nil
+	}
+	newExpiresAt := s.ExpiresAt.Add(lifetime)
+	if now.After(s.ExpiresAt) {
+		newExpiresAt = now.Add(lifetime)
+	}
+	if r.provider != nil && newExpiresAt.Sub(r.savedExpiresAt[tokenHash]) >= apiSessionSaveInterval {
+		if err := r.provider.UpdateExpiresAt(tokenHash, newExpiresAt); err != nil {
+			return false, err
+		}
+		r.savedExpiresAt[tokenHash] = newExpiresAt
+	}
+	// a copy is saved to not change a session that can be read concurrently
+	updated := *s
+	updated.ExpiresAt = newExpiresAt
+	r.sessions[tokenHash] = &updated
+	return true, nil
+}
+
 func (r *APISessionRepository) Delete(session *APISession) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	delete(r.sessions, session.Token)
+	return r.delete(session.TokenHash)
+}
+
+func (r *APISessionRepository) delete(tokenHash string) error {
+	if r.provider != nil {
+		if err := r.provider.Delete(tokenHash); err != nil {
+			return err
+		}
+	}
+	delete(r.sessions, tokenHash)
+	delete(r.savedExpiresAt, tokenHash)
 	return nil
 }
 
-func (r *APISessionRepository) FindOne(id string) (*APISession, error) {
+// DeleteExpired deletes all sessions that expired before a given time. Returns a number of deleted sessions.
+func (r *APISessionRepository) DeleteExpired(now time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.provider != nil {
+		if _, err := r.provider.DeleteExpired(now); err != nil {
+			return 0, err
+		}
+	}
+	var deleted int64
+	for tokenHash, s := range r.sessions {
+		if !s.ExpiresAt.After(now) {
+			delete(r.sessions, tokenHash)
+			delete(r.savedExpiresAt, tokenHash)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// DeleteByID deletes a session of a given user by its id. Returns false if it's not found.
+func (r *APISessionRepository) DeleteByID(username, id string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for tokenHash, s := range r.sessions {
+		if s.Username == username && s.ID == id {
+			if err := r.delete(tokenHash); err != nil {
+				return false, err
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// FindOne returns a session of a given JWT token, nil if it's not found.
+func (r *APISessionRepository) FindOne(token string) (*APISession, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
-	c, exists := r.sessions[id]
+	c, exists := r.sessions[hashAPISessionToken(token)]
 	if !exists {
 		return nil, nil
 	}
 	return c, nil
 }
+
+// FindAllActive returns sessions of a given user that are not expired at a given time ordered by issue time.
+func (r *APISessionRepository) FindAllActive(username string, now time.Time) ([]*APISession, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	res := []*APISession{}
+	for _, s := range r.sessions {
+		if s.Username == username && s.ExpiresAt.After(now) {
+			res = append(res, s)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].IssuedAt.Equal(res[j].IssuedAt) {
+			return res[i].ID < res[j].ID
+		}
+		return res[i].IssuedAt.Before(res[j].IssuedAt)
+	})
+	return res, nil
+}
+
+// Close closes the storage of sessions if any.
+func (r *APISessionRepository) Close() error {
+	if r.provider == nil {
+		return nil
+	}
+	return r.provider.Close()
+}
+
+// APISessionsCleanupTask deletes expired API sessions.
+type APISessionsCleanupTask struct {
+	log  *chshare.Logger
+	repo *APISessionRepository
+}
+
+func NewAPISessionsCleanupTask(log *chshare.Logger, repo *APISessionRepository) *APISessionsCleanupTask {
+	return &APISessionsCleanupTask{
+		log:  log,
+		repo: repo,
+	}
+}
+
+func (t *APISessionsCleanupTask) Run(ctx context.Context) error {
+	deleted, err := t.repo.DeleteExpired(time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to delete expired API sessions: %v", err)
+	}
+
+	if deleted > 0 {
+		t.log.Debugf("Deleted %d expired API session(s).", deleted)
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package chserver
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/cloudradar-monitoring/rport/db/migration/api_sessions"
+	"github.com/cloudradar-monitoring/rport/db/sqlite"
+)
+
+// APISessionSqliteProvider stores API sessions in a sqlite DB.
+type APISessionSqliteProvider struct {
+	db *sqlx.DB
+}
+
+func NewAPISessionSqliteProvider(dbPath string) (*APISessionSqliteProvider, error) {
+	db, err := sqlite.New(dbPath, api_sessions.AssetNames(), api_sessions.Asset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API sessions DB instance: %v", err)
+	}
+	return &APISessionSqliteProvider{db: db}, nil
+}
+
+type apiSessionSqlite struct {
+	TokenHash string    `db:"token_hash"`
+	ID        string    `db:"id"`
+	Username  string    `db:"username"`
+	IssuedAt  time.Time `db:"issued_at"`
+	ExpiresAt time.Time `db:"expires_at"`
+	UserAgent string    `db:"user_agent"`
+	IP        string    `db:"ip"`
+}
+
+func (p *APISessionSqliteProvider) GetAll() ([]*APISession, error) {
+	var res []*apiSessionSqlite
+	err := p.db.Select(&res, "SELECT * FROM api_sessions")
+	if err != nil {
+		return nil, err
+	}
+	sessions := make([]*APISession, 0, len(res))
+	for _, cur := range res {
+		sessions = append(sessions, &APISession{
+			TokenHash: cur.TokenHash,
+			ExpiresAt: cur.ExpiresAt.UTC(),
+			ID:        cur.ID,
+			Username:  cur.Username,
+			IssuedAt:  cur.IssuedAt.UTC(),
+			UserAgent: cur.UserAgent,
+			IP:        cur.IP,
+		})
+	}
+	return sessions, nil
+}
+
+func (p *APISessionSqliteProvider) Save(s *APISession) error {
+	_, err := p.db.Exec(
+		"INSERT OR REPLACE INTO api_sessions (token_hash, id, username, issued_at, expires_at, user_agent, ip) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		s.TokenHash,
+		s.ID,
+		s.Username,
+		s.IssuedAt.UTC(),
+		s.ExpiresAt.UTC(),
+		s.UserAgent,
+		s.IP,
+	)
+	return err
+}
+
+func (p *APISessionSqliteProvider) UpdateExpiresAt(tokenHash string, expiresAt time.Time) error {
+	_, err := p.db.Exec("UPDATE api_sessions SET expires_at = ? WHERE token_hash = ?", expiresAt.UTC(), tokenHash)
+	return err
+}
+
+func (p *APISessionSqliteProvider) Delete(tokenHash string) error {
+	_, err := p.db.Exec("DELETE FROM api_sessions WHERE token_hash = ?", tokenHash)
+	return err
+}
+
+func (p *APISessionSqliteProvider) DeleteExpired(now time.Time) (int64, error) {
+	res, err := p.db.Exec("DELETE FROM api_sessions WHERE DATETIME(expires_at) <= DATETIME(?)", now.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (p *APISessionSqliteProvider) Close() error {
+	return p.db.Close()
+}
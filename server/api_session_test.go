@@ -0,0 +1,249 @@
+package chserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/rport/server/api/users"
+	"github.com/cloudradar-monitoring/rport/share/security"
+)
+
+func TestAPISessionSqliteProvider(t *testing.T) {
+	p, err := NewAPISessionSqliteProvider(":memory:")
+	require.NoError(t, err)
+	defer p.Close()
+
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	s1 := &APISession{TokenHash: hashAPISessionToken("t1"), ID: "1", Username: "user1", IssuedAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour), UserAgent: "browser", IP: "192.0.2.1"}
+	s2 := &APISession{TokenHash: hashAPISessionToken("t2"), ID: "2", Username: "user2", IssuedAt: now.Add(-time.Hour), ExpiresAt: now.Add(-time.Minute)}
+	require.NoError(t, p.Save(s1))
+	require.NoError(t, p.Save(s2))
+
+	// update
+	s1.ExpiresAt = now.Add(2 * time.Hour)
+	require.NoError(t, p.Save(s1))
+	s2.ExpiresAt = now.Add(-2 * time.Minute)
+	require.NoError(t, p.UpdateExpiresAt(s2.TokenHash, s2.ExpiresAt))
+	// not existing sessions are not created
+	require.NoError(t, p.UpdateExpiresAt(hashAPISessionToken("t3"), now.Add(time.Hour)))
+
+	got, err := p.GetAll()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []*APISession{s1, s2}, got)
+
+	deleted, err := p.DeleteExpired(now)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, deleted)
+
+	got, err = p.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, []*APISession{s1}, got)
+
+	require.NoError(t, p.Delete(s1.TokenHash))
+	got, err = p.GetAll()
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestInitAPISessionRepository(t *testing.T) {
+	p, err := NewAPISessionSqliteProvider(":memory:")
+	require.NoError(t, err)
+	defer p.Close()
+
+	now := time.Now().UTC().Truncate(time.Second)
+	active := &APISession{TokenHash: hashAPISessionToken("t1"), ID: "1", Username: "user1", IssuedAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour)}
+	expired := &APISession{TokenHash: hashAPISessionToken("t2"), ID: "2", Username: "user1", IssuedAt: now.Add(-time.Hour), ExpiresAt: now.Add(-time.Minute)}
+	require.NoError(t, p.Save(active))
+	require.NoError(t, p.Save(expired))
+
+	repo, err := InitAPISessionRepository(p, now)
+	require.NoError(t, err)
+
+	got, err := repo.FindOne("t1")
+	require.NoError(t, err)
+	assert.Equal(t, active, got)
+	got, err = repo.FindOne("t2")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	// changes are written through
+	s := &APISession{TokenHash: hashAPISessionToken("t3"), ID: "3", Username: "user2", IssuedAt: now, ExpiresAt: now.Add(time.Hour)}
+	require.NoError(t, repo.Save(s))
+	deleted, err := repo.DeleteByID(active.Username, active.ID)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+
+	stored, err := p.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, []*APISession{s}, stored)
+}
+
+func TestAPISessionRepositoryExtendLifetime(t *testing.T) {
+	p, err := NewAPISessionSqliteProvider(":memory:")
+	require.NoError(t, err)
+	defer p.Close()
+
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	repo, err := InitAPISessionRepository(p, now)
+	require.NoError(t, err)
+	active := &APISession{TokenHash: hashAPISessionToken("t1"), ID: "1", Username: "user1", IssuedAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Minute)}
+	expired := &APISession{TokenHash: hashAPISessionToken("t2"), ID: "2", Username: "user1", IssuedAt: now.Add(-time.Hour), ExpiresAt: now.Add(-time.Minute)}
+	revoked := &APISession{TokenHash: hashAPISessionToken("t3"), ID: "3", Username: "user1", IssuedAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Minute)}
+	for _, s := range []*APISession{active, expired, revoked} {
+		require.NoError(t, repo.Save(s))
+	}
+	require.NoError(t, repo.Delete(revoked))
+
+	testCases := []struct {
+		name          string
+		token         string
+		wantOK        bool
+		wantExpiresAt time.Time
+	}{
+		{
+			name:          "active",
+			token:         "t1",
+			wantOK:        true,
+			wantExpiresAt: now.Add(11 * time.Minute),
+		},
+		{
+			name:          "expired",
+			token:         "t2",
+			wantOK:        true,
+			wantExpiresAt: now.Add(10 * time.Minute),
+		},
+		{
+			name:  "revoked",
+			token: "t3",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ok, err := repo.ExtendLifetime(hashAPISessionToken(tc.token), 10*time.Minute, now)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantOK, ok)
+
+			got, err := repo.FindOne(tc.token)
+			require.NoError(t, err)
+			if !tc.wantOK {
+				assert.Nil(t, got)
+				return
+			}
+			require.NotNil(t, got)
+			assert.Equal(t, tc.wantExpiresAt, got.ExpiresAt)
+		})
+	}
+
+	// the original session is not changed
+	assert.Equal(t, now.Add(time.Minute), active.ExpiresAt)
+
+	stored, err := p.GetAll()
+	require.NoError(t, err)
+	require.Len(t, stored, 2)
+	for _, s := range stored {
+		assert.NotEqual(t, revoked.TokenHash, s.TokenHash)
+	}
+
+	// small extensions are not written to the storage
+	ok, err := repo.ExtendLifetime(active.TokenHash, 30*time.Second, now)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	got, err := repo.FindOne("t1")
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(11*time.Minute+30*time.Second), got.ExpiresAt)
+	ok, err = repo.ExtendLifetime(active.TokenHash, 30*time.Second, now)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	stored, err = p.GetAll()
+	require.NoError(t, err)
+	for _, s := range stored {
+		if s.TokenHash == active.TokenHash {
+			assert.Equal(t, now.Add(12*time.Minute), s.ExpiresAt)
+		}
+	}
+}
+
+func TestAPISessionRepositoryDeleteExpired(t *testing.T) {
+	p, err := NewAPISessionSqliteProvider(":memory:")
+	require.NoError(t, err)
+	defer p.Close()
+
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	repo, err := InitAPISessionRepository(p, now)
+	require.NoError(t, err)
+	active := &APISession{TokenHash: hashAPISessionToken("t1"), ID: "1", Username: "user1", IssuedAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Minute)}
+	expired := &APISession{TokenHash: hashAPISessionToken("t2"), ID: "2", Username: "user1", IssuedAt: now.Add(-time.Hour), ExpiresAt: now.Add(-time.Minute)}
+	require.NoError(t, repo.Save(active))
+	require.NoError(t, repo.Save(expired))
+
+	deleted, err := repo.DeleteExpired(now)
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, deleted)
+
+	got, err := repo.FindOne("t2")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+	stored, err := p.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, []*APISession{active}, stored)
+}
+
+func TestAPISessionsSurviveRestart(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "api_sessions.db")
+	user := &users.User{Username: "user1"}
+	newAPIListener := func() *APIListener {
+		p, err := NewAPISessionSqliteProvider(dbPath)
+		require.NoError(t, err)
+		repo, err := InitAPISessionRepository(p, time.Now())
+		require.NoError(t, err)
+		al := &APIListener{
+			Logger:         testLog,
+			apiSessionRepo: repo,
+			bannedUsers:    security.NewBanList(0),
+			userService:    users.NewAPIService(users.NewStaticProvider([]*users.User{user}), false),
+			Server: &Server{
+				config: &Config{
+					API: APIConfig{
+						JWTSecret:       "secret",
+						PersistSessions: true,
+					},
+					Server: ServerConfig{MaxRequestBytes: 1024 * 1024},
+				},
+			},
+		}
+		al.initRouter()
+		return al
+	}
+	getMe := func(al *APIListener, token string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		al.router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	al := newAPIListener()
+	token, err := al.createAuthToken(httptest.NewRequest(http.MethodGet, "/api/v1/login", nil), time.Hour, user.Username)
+	require.NoError(t, err)
+	revokedToken, err := al.createAuthToken(httptest.NewRequest(http.MethodGet, "/api/v1/login", nil), time.Hour, user.Username)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, getMe(al, token))
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+revokedToken)
+	al.router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.NoError(t, al.apiSessionRepo.Close())
+
+	// simulate a restart
+	al = newAPIListener()
+	defer al.apiSessionRepo.Close()
+	assert.Equal(t, http.StatusOK, getMe(al, token))
+	assert.Equal(t, http.StatusUnauthorized, getMe(al, revokedToken))
+}
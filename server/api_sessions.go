@@ -0,0 +1,67 @@
+package chserver
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/cloudradar-monitoring/rport/server/api"
+)
+
+const routeParamSessionID = "session_id"
+
+type sessionPayload struct {
+	ID        string    `json:"id"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UserAgent string    `json:"user_agent"`
+	IP        string    `json:"ip"`
+	// Current is true for the session the request is authorized with
+	Current bool `json:"current"`
+}
+
+// handleGetSessions returns active sessions of the current user, tokens are never returned.
+func (al *APIListener) handleGetSessions(w http.ResponseWriter, req *http.Request) {
+	sessions, err := al.apiSessionRepo.FindAllActive(api.GetUser(req.Context(), al.Logger), time.Now())
+	if err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, "Failed to get sessions.", err)
+		return
+	}
+
+	curToken, _ := getBearerToken(req)
+	curTokenHash := hashAPISessionToken(curToken)
+	res := make([]sessionPayload, 0, len(sessions))
+	for _, s := range sessions {
+		res = append(res, sessionPayload{
+			ID:        s.ID,
+			IssuedAt:  s.IssuedAt,
+			ExpiresAt: s.ExpiresAt,
+			UserAgent: s.UserAgent,
+			IP:        s.IP,
+			Current:   curToken != "" && s.TokenHash == curTokenHash,
+		})
+	}
+
+	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(res))
+}
+
+// handleDeleteSession revokes a session of the current user, so its token is rejected by further requests.
+func (al *APIListener) handleDeleteSession(w http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)[routeParamSessionID]
+	username := api.GetUser(req.Context(), al.Logger)
+	deleted, err := al.apiSessionRepo.DeleteByID(username, id)
+	if err != nil {
+		al.jsonErrorResponseWithError(w, http.StatusInternalServerError, fmt.Sprintf("Failed to delete session[id=%q].", id), err)
+		return
+	}
+	if !deleted {
+		al.jsonErrorResponseWithTitle(w, http.StatusNotFound, fmt.Sprintf("Session[id=%q] not found.", id))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+
+	al.Debugf("Session[id=%q] deleted by %q.", id, username)
+}
@@ -0,0 +1,118 @@
+package chserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/rport/server/api/users"
+	"github.com/cloudradar-monitoring/rport/share/security"
+)
+
+func TestHandleSessions(t *testing.T) {
+	user1 := &users.User{Username: "user1"}
+	user2 := &users.User{Username: "user2"}
+	al := APIListener{
+		Logger:         testLog,
+		apiSessionRepo: NewAPISessionRepository(),
+		bannedUsers:    security.NewBanList(0),
+		userService:    users.NewAPIService(users.NewStaticProvider([]*users.User{user1, user2}), false),
+		Server: &Server{
+			config: &Config{
+				API: APIConfig{
+					JWTSecret: "secret",
+				},
+				Server: ServerConfig{MaxRequestBytes: 1024 * 1024},
+			},
+		},
+	}
+	al.initRouter()
+
+	login := func(username, userAgent, remoteAddr string) string {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/login", nil)
+		req.Header.Set("User-Agent", userAgent)
+		req.RemoteAddr = remoteAddr
+		token, err := al.createAuthToken(req, time.Hour, username)
+		require.NoError(t, err)
+		return token
+	}
+	laptopToken := login(user1.Username, "laptop-browser", "192.0.2.1:1234")
+	phoneToken := login(user1.Username, "phone-browser", "192.0.2.2:1234")
+	otherUserToken := login(user2.Username, "other-browser", "192.0.2.3:1234")
+
+	do := func(method, url, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, url, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		al.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodGet, "/api/v1/me/sessions", phoneToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Data []sessionPayload `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Data, 2)
+	sessions := map[string]sessionPayload{}
+	for _, s := range resp.Data {
+		sessions[s.UserAgent] = s
+		assert.NotEmpty(t, s.ID)
+		assert.False(t, s.IssuedAt.IsZero())
+		assert.True(t, s.ExpiresAt.After(s.IssuedAt))
+	}
+	laptop := sessions["laptop-browser"]
+	assert.Equal(t, "192.0.2.1", laptop.IP)
+	assert.False(t, laptop.Current)
+	phone := sessions["phone-browser"]
+	assert.Equal(t, "192.0.2.2", phone.IP)
+	assert.True(t, phone.Current)
+	assert.NotContains(t, w.Body.String(), laptopToken)
+
+	// sessions of other users can't be revoked
+	w = do(http.MethodDelete, "/api/v1/me/sessions/"+laptop.ID, otherUserToken)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = do(http.MethodDelete, "/api/v1/me/sessions/"+laptop.ID, phoneToken)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	// the revoked token is rejected, others still work
+	w = do(http.MethodGet, "/api/v1/me/sessions", laptopToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = do(http.MethodGet, "/api/v1/me/sessions", phoneToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp.Data, 1)
+	assert.Equal(t, phone.ID, resp.Data[0].ID)
+	w = do(http.MethodGet, "/api/v1/me/sessions", otherUserToken)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = do(http.MethodDelete, "/api/v1/me/sessions/"+laptop.ID, phoneToken)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAPISessionRepositoryFindAllActive(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	repo := NewAPISessionRepository()
+	s1 := &APISession{TokenHash: hashAPISessionToken("t1"), ID: "1", Username: "user1", IssuedAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour)}
+	s2 := &APISession{TokenHash: hashAPISessionToken("t2"), ID: "2", Username: "user1", IssuedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(time.Minute)}
+	expired := &APISession{TokenHash: hashAPISessionToken("t3"), ID: "3", Username: "user1", IssuedAt: now.Add(-time.Hour), ExpiresAt: now}
+	otherUser := &APISession{TokenHash: hashAPISessionToken("t4"), ID: "4", Username: "user2", IssuedAt: now, ExpiresAt: now.Add(time.Hour)}
+	for _, s := range []*APISession{s1, s2, expired, otherUser} {
+		require.NoError(t, repo.Save(s))
+	}
+
+	got, err := repo.FindAllActive("user1", now)
+	require.NoError(t, err)
+	assert.Equal(t, []*APISession{s2, s1}, got)
+
+	got, err = repo.FindAllActive("unknown", now)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
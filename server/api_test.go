@@ -2,14 +2,19 @@ package chserver
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
 	"reflect"
 	"runtime"
 	"strconv"
@@ -17,21 +22,28 @@ import (
 	"testing"
 	"time"
 
+	mapset "github.com/deckarep/golang-set"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
 	"golang.org/x/crypto/ssh"
 
+	"github.com/cloudradar-monitoring/rport/db/migration/library"
+	"github.com/cloudradar-monitoring/rport/db/sqlite"
 	"github.com/cloudradar-monitoring/rport/server/api"
+	"github.com/cloudradar-monitoring/rport/server/api/command"
 	"github.com/cloudradar-monitoring/rport/server/api/jobs"
 	"github.com/cloudradar-monitoring/rport/server/api/users"
 	"github.com/cloudradar-monitoring/rport/server/cgroups"
 	"github.com/cloudradar-monitoring/rport/server/clients"
 	"github.com/cloudradar-monitoring/rport/server/clientsauth"
+	"github.com/cloudradar-monitoring/rport/server/ports"
 	"github.com/cloudradar-monitoring/rport/server/test/jb"
 	chshare "github.com/cloudradar-monitoring/rport/share"
 	"github.com/cloudradar-monitoring/rport/share/comm"
 	"github.com/cloudradar-monitoring/rport/share/models"
 	"github.com/cloudradar-monitoring/rport/share/ptr"
+	"github.com/cloudradar-monitoring/rport/share/query"
 	"github.com/cloudradar-monitoring/rport/share/random"
 	"github.com/cloudradar-monitoring/rport/share/security"
 	"github.com/cloudradar-monitoring/rport/share/test"
@@ -46,10 +58,12 @@ type JobProviderMock struct {
 	ReturnJobSummaries []*models.JobSummary
 	ReturnErr          error
 
-	InputCID       string
-	InputJID       string
-	InputSaveJob   *models.Job
-	InputCreateJob *models.Job
+	InputCID              string
+	InputJID              string
+	InputFilters          []query.FilterOption
+	InputSummariesOptions jobs.SummariesOptions
+	InputSaveJob          *models.Job
+	InputCreateJob        *models.Job
 }
 
 func NewJobProviderMock() *JobProviderMock {
@@ -62,8 +76,10 @@ func (p *JobProviderMock) GetByJID(cid, jid string) (*models.Job, error) {
 	return p.ReturnJob, p.ReturnErr
 }
 
-func (p *JobProviderMock) GetSummariesByClientID(cid string) ([]*models.JobSummary, error) {
+func (p *JobProviderMock) GetSummariesByClientID(cid string, opts jobs.SummariesOptions) ([]*models.JobSummary, error) {
 	p.InputCID = cid
+	p.InputFilters = opts.Filters
+	p.InputSummariesOptions = opts
 	return p.ReturnJobSummaries, p.ReturnErr
 }
 
@@ -138,6 +154,46 @@ func TestGetCorrespondingSortFuncPositive(t *testing.T) {
 			wantFunc: clients.SortByOS,
 			wantDesc: true,
 		},
+		{
+			sortStr:  "version",
+			wantFunc: clients.SortByVersion,
+			wantDesc: false,
+		},
+		{
+			sortStr:  "-version",
+			wantFunc: clients.SortByVersion,
+			wantDesc: true,
+		},
+		{
+			sortStr:  "timezone",
+			wantFunc: clients.SortByTimezone,
+			wantDesc: false,
+		},
+		{
+			sortStr:  "-timezone",
+			wantFunc: clients.SortByTimezone,
+			wantDesc: true,
+		},
+		{
+			sortStr:  "environment",
+			wantFunc: clients.SortByEnvironment,
+			wantDesc: false,
+		},
+		{
+			sortStr:  "-environment",
+			wantFunc: clients.SortByEnvironment,
+			wantDesc: true,
+		},
+		{
+			sortStr:  "updates_available",
+			wantFunc: clients.SortByUpdatesAvailable,
+			wantDesc: false,
+		},
+		{
+			sortStr:  "-security_updates_available",
+			wantFunc: clients.SortBySecurityUpdatesAvailable,
+			wantDesc: true,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -266,6 +322,8 @@ func TestHandlePostClients(t *testing.T) {
 		wantErrCode     string
 		wantErrTitle    string
 		wantErrDetail   string
+		// wantErrs is used instead of a single error when multiple errors are expected
+		wantErrs []api.ErrorPayloadItem
 	}{
 		{
 			descr:           "auth file, new valid client",
@@ -370,6 +428,26 @@ func TestHandlePostClients(t *testing.T) {
 			wantErrDetail:   fmt.Sprintf("Min size is %d.", MinCredentialsLength),
 			wantClientsAuth: initCacheState,
 		},
+		{
+			descr:           "auth file, invalid request, id and password too short",
+			provider:        clientsauth.NewMockProvider(initCacheState),
+			clientAuthWrite: true,
+			requestBody:     composeRequestBody("12", "34"),
+			wantStatusCode:  http.StatusBadRequest,
+			wantErrs: []api.ErrorPayloadItem{
+				{
+					Code:   ErrCodeInvalidRequest,
+					Title:  "Invalid or missing ID.",
+					Detail: fmt.Sprintf("Min size is %d.", MinCredentialsLength),
+				},
+				{
+					Code:   ErrCodeInvalidRequest,
+					Title:  "Invalid or missing password.",
+					Detail: fmt.Sprintf("Min size is %d.", MinCredentialsLength),
+				},
+			},
+			wantClientsAuth: initCacheState,
+		},
 		{
 			descr:           "auth file, client already exist",
 			provider:        clientsauth.NewMockProvider(initCacheState),
@@ -428,7 +506,11 @@ func TestHandlePostClients(t *testing.T) {
 
 		// then
 		require.Equalf(tc.wantStatusCode, w.Code, msg)
-		if tc.wantErrTitle == "" {
+		if len(tc.wantErrs) > 0 {
+			wantRespBytes, err := json.Marshal(api.ErrorPayload{Errors: tc.wantErrs})
+			require.NoErrorf(err, msg)
+			require.Equalf(string(wantRespBytes), w.Body.String(), msg)
+		} else if tc.wantErrTitle == "" {
 			// success case
 			assert.Emptyf(w.Body.String(), msg)
 		} else {
@@ -656,6 +738,12 @@ func TestHandlePostCommand(t *testing.T) {
 
 	c1 := clients.New(t).Connection(connMock).Build()
 	c2 := clients.New(t).DisconnectedDuration(5 * time.Minute).Build()
+	c3 := clients.New(t).Connection(connMock).Build()
+	c3.CommandsDisabled = true
+	c4 := clients.New(t).Connection(connMock).Build()
+	c4.OSKernel = "windows"
+	c5 := clients.New(t).Connection(connMock).Build()
+	c5.Interpreters = []string{"cmd"}
 
 	testCases := []struct {
 		name string
@@ -675,6 +763,11 @@ func TestHandlePostCommand(t *testing.T) {
 		wantErrTitle    string
 		wantErrDetail   string
 		wantInterpreter string
+		wantUmask       string
+		wantEnv         map[string]string
+		wantRunAs       string
+		wantStdin       string
+		wantFailedJob   bool
 	}{
 		{
 			name:           "valid cmd",
@@ -702,6 +795,121 @@ func TestHandlePostCommand(t *testing.T) {
 			wantErrTitle:   "Invalid interpreter.",
 			wantErrDetail:  "expected interpreter to be one of: [cmd powershell tacoscript], actual: unsupported",
 		},
+		{
+			name:           "valid cmd with umask",
+			requestBody:    `{"command": "` + gotCmd + `","umask": "0027"}`,
+			cid:            c1.ID,
+			clients:        []*clients.Client{c1},
+			wantStatusCode: http.StatusOK,
+			wantTimeout:    defaultTimeout,
+			wantUmask:      "0027",
+		},
+		{
+			name:           "invalid umask",
+			requestBody:    `{"command": "` + gotCmd + `","umask": "0778"}`,
+			cid:            c1.ID,
+			clients:        []*clients.Client{c1},
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "Invalid umask.",
+			wantErrDetail:  `invalid umask "0778", expected an octal value from 0000 to 0777`,
+		},
+		{
+			name:           "valid cmd with env",
+			requestBody:    `{"command": "` + gotCmd + `","env": {"FOO": "bar", "_SECRET1": "s3cret"}}`,
+			cid:            c1.ID,
+			clients:        []*clients.Client{c1},
+			wantStatusCode: http.StatusOK,
+			wantTimeout:    defaultTimeout,
+			wantEnv:        map[string]string{"FOO": "bar", "_SECRET1": "s3cret"},
+		},
+		{
+			name:           "invalid env",
+			requestBody:    `{"command": "` + gotCmd + `","env": {"FOO": "bar", "1FOO": "baz"}}`,
+			cid:            c1.ID,
+			clients:        []*clients.Client{c1},
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "Invalid env.",
+			wantErrDetail:  `invalid environment variable name "1FOO", expected letters, digits and underscores not starting with a digit`,
+		},
+		{
+			name:           "valid cmd with run_as",
+			requestBody:    `{"command": "` + gotCmd + `","run_as": "www-data"}`,
+			cid:            c1.ID,
+			clients:        []*clients.Client{c1},
+			wantStatusCode: http.StatusOK,
+			wantTimeout:    defaultTimeout,
+			wantRunAs:      "www-data",
+		},
+		{
+			name:           "invalid run_as",
+			requestBody:    `{"command": "` + gotCmd + `","run_as": "root; rm -rf /"}`,
+			cid:            c1.ID,
+			clients:        []*clients.Client{c1},
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "Invalid run_as.",
+			wantErrDetail:  `invalid user name "root; rm -rf /", expected up to 32 letters, digits, '_', '.' and '-' not starting with a digit, '.' or '-'`,
+		},
+		{
+			name:           "valid cmd with stdin",
+			requestBody:    `{"command": "` + gotCmd + `","stdin": "line1\nline2\n"}`,
+			cid:            c1.ID,
+			clients:        []*clients.Client{c1},
+			wantStatusCode: http.StatusOK,
+			wantTimeout:    defaultTimeout,
+			wantStdin:      "line1\nline2\n",
+		},
+		{
+			name:           "valid cmd with base64 stdin",
+			requestBody:    `{"command": "` + gotCmd + `","stdin_base64": "AAFiaW5hcnk="}`,
+			cid:            c1.ID,
+			clients:        []*clients.Client{c1},
+			wantStatusCode: http.StatusOK,
+			wantTimeout:    defaultTimeout,
+			wantStdin:      "\x00\x01binary",
+		},
+		{
+			name:           "invalid base64 stdin",
+			requestBody:    `{"command": "` + gotCmd + `","stdin_base64": "not base64"}`,
+			cid:            c1.ID,
+			clients:        []*clients.Client{c1},
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "Invalid stdin.",
+			wantErrDetail:  "failed to decode stdin_base64: illegal base64 data at input byte 3",
+		},
+		{
+			name:           "stdin and base64 stdin",
+			requestBody:    `{"command": "` + gotCmd + `","stdin": "data","stdin_base64": "ZGF0YQ=="}`,
+			cid:            c1.ID,
+			clients:        []*clients.Client{c1},
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "Invalid stdin.",
+			wantErrDetail:  "either stdin or stdin_base64 should be specified, not both",
+		},
+		{
+			name:           "oversize stdin",
+			requestBody:    `{"command": "` + gotCmd + `","stdin": "` + strings.Repeat("a", models.MaxStdinSize+1) + `"}`,
+			cid:            c1.ID,
+			clients:        []*clients.Client{c1},
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "Invalid stdin.",
+			wantErrDetail:  fmt.Sprintf("stdin size %d exceeds the limit of %d bytes", models.MaxStdinSize+1, models.MaxStdinSize),
+		},
+		{
+			name:           "run_as on windows client",
+			requestBody:    `{"command": "` + gotCmd + `","run_as": "admin"}`,
+			cid:            c4.ID,
+			clients:        []*clients.Client{c4},
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "Running as another user is not supported on Windows clients.",
+		},
+		{
+			name:           "umask on windows client",
+			requestBody:    `{"command": "` + gotCmd + `","umask": "077"}`,
+			cid:            c4.ID,
+			clients:        []*clients.Client{c4},
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "Umask is not supported on Windows clients.",
+		},
 		{
 			name:           "valid cmd with no timeout",
 			requestBody:    `{"command": "/bin/date;foo;whoami"}`,
@@ -776,6 +984,31 @@ func TestHandlePostCommand(t *testing.T) {
 			wantStatusCode: http.StatusNotFound,
 			wantErrTitle:   fmt.Sprintf("Active client with id=%q not found.", c2.ID),
 		},
+		{
+			name:           "commands disabled on client",
+			requestBody:    validReqBody,
+			cid:            c3.ID,
+			clients:        []*clients.Client{c1, c3},
+			wantStatusCode: http.StatusConflict,
+			wantErrTitle:   fmt.Sprintf("command execution is disabled on client with id=%q", c3.ID),
+		},
+		{
+			name:            "interpreter available on client",
+			requestBody:     `{"command": "` + gotCmd + `","interpreter": "cmd"}`,
+			cid:             c5.ID,
+			clients:         []*clients.Client{c5},
+			wantStatusCode:  http.StatusOK,
+			wantTimeout:     defaultTimeout,
+			wantInterpreter: "cmd",
+		},
+		{
+			name:           "interpreter not available on client",
+			requestBody:    `{"command": "` + gotCmd + `","interpreter": "powershell"}`,
+			cid:            c5.ID,
+			clients:        []*clients.Client{c5},
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   fmt.Sprintf(`interpreter "powershell" is not available on client with id=%q, available: ["cmd"]`, c5.ID),
+		},
 		{
 			name:            "error on save job",
 			requestBody:     validReqBody,
@@ -814,6 +1047,7 @@ func TestHandlePostCommand(t *testing.T) {
 			clients:         []*clients.Client{c1},
 			wantStatusCode:  http.StatusConflict,
 			wantErrTitle:    "client error: fake failure msg",
+			wantFailedJob:   true,
 		},
 	}
 
@@ -827,7 +1061,7 @@ func TestHandlePostCommand(t *testing.T) {
 					config: &Config{
 						Server: ServerConfig{
 							RunRemoteCmdTimeoutSec: defaultTimeout,
-							MaxRequestBytes:        1024 * 1024,
+							MaxRequestBytes:        2 * 1024 * 1024,
 						},
 					},
 				},
@@ -870,144 +1104,1291 @@ func TestHandlePostCommand(t *testing.T) {
 				assert.Equal(t, sshSuccessResp.StartedAt, gotRunningJob.StartedAt)
 				assert.Equal(t, testUser, gotRunningJob.CreatedBy)
 				assert.Equal(t, tc.wantTimeout, gotRunningJob.TimeoutSec)
+				assert.Equal(t, tc.wantUmask, gotRunningJob.Umask)
+				assert.Equal(t, tc.wantRunAs, gotRunningJob.RunAs)
 				assert.Nil(t, gotRunningJob.Result)
+				// env is sent to the client, but only its keys are stored
+				assert.Nil(t, gotRunningJob.Env)
+				assert.Equal(t, models.SortedEnvKeys(tc.wantEnv), gotRunningJob.EnvKeys)
+				_, _, payload := connMock.InputSendRequest()
+				sentJob := models.Job{}
+				require.NoError(t, json.Unmarshal(payload, &sentJob))
+				assert.Equal(t, tc.wantEnv, sentJob.Env)
+				assert.Equal(t, tc.wantRunAs, sentJob.RunAs)
+				// stdin is sent to the client, but not stored
+				assert.Equal(t, tc.wantStdin, sentJob.Stdin)
+				assert.Empty(t, gotRunningJob.Stdin)
 			} else {
 				// failure case
 				wantResp := api.NewErrAPIPayloadFromMessage(tc.wantErrCode, tc.wantErrTitle, tc.wantErrDetail)
 				wantRespBytes, err := json.Marshal(wantResp)
 				require.NoError(t, err)
 				require.Equal(t, string(wantRespBytes), w.Body.String())
+				if tc.wantFailedJob {
+					gotFailedJob := jp.InputCreateJob
+					require.NotNil(t, gotFailedJob)
+					assert.Equal(t, models.JobStatusFailed, gotFailedJob.Status)
+					assert.Equal(t, tc.wantErrTitle, gotFailedJob.Error)
+					assert.NotNil(t, gotFailedJob.FinishedAt)
+				}
 			}
 		})
 	}
 }
 
-func TestHandleGetCommand(t *testing.T) {
-	wantJob := jb.New(t).ClientID("cid-1234").JID("jid-1234").Build()
-	wantJobResp := api.NewSuccessPayload(wantJob)
-	b, err := json.Marshal(wantJobResp)
-	require.NoError(t, err)
-	wantJobRespJSON := string(b)
-
+func TestValidateExecuteInput(t *testing.T) {
 	testCases := []struct {
-		name string
+		name     string
+		input    *api.ExecuteInput
+		wantErrs []api.ErrorPayloadItem
+	}{
+		{
+			name:  "valid",
+			input: &api.ExecuteInput{Command: "/bin/date", Umask: "0027", Env: map[string]string{"FOO": "bar"}, RunAs: "www-data"},
+		},
+		{
+			name:  "all fields invalid",
+			input: &api.ExecuteInput{Umask: "0778", Env: map[string]string{"1FOO": "bar"}, RunAs: "root; rm -rf /"},
+			wantErrs: []api.ErrorPayloadItem{
+				{
+					Title: "Command cannot be empty.",
+				},
+				{
+					Title:  "Invalid umask.",
+					Detail: `invalid umask "0778", expected an octal value from 0000 to 0777`,
+				},
+				{
+					Title:  "Invalid env.",
+					Detail: `invalid environment variable name "1FOO", expected letters, digits and underscores not starting with a digit`,
+				},
+				{
+					Title:  "Invalid run_as.",
+					Detail: `invalid user name "root; rm -rf /", expected up to 32 letters, digits, '_', '.' and '-' not starting with a digit, '.' or '-'`,
+				},
+			},
+		},
+	}
 
-		jpReturnErr error
-		jpReturnJob *models.Job
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateExecuteInput(tc.input)
+
+			if tc.wantErrs == nil {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, api.ErrorPayload{Errors: tc.wantErrs}, api.NewErrAPIPayloadFromError(err, "", ""))
+		})
+	}
+}
+
+func TestHandleCancelCommand(t *testing.T) {
+	connMock := test.NewConnMock()
+	c1 := clients.New(t).Connection(connMock).Build()
+	pid := 123
+	runningJob := func() *models.Job {
+		return &models.Job{
+			JobSummary: models.JobSummary{JID: "job-1", Status: models.JobStatusRunning},
+			ClientID:   c1.ID,
+			PID:        &pid,
+		}
+	}
+	finishedJob := runningJob()
+	finishedJob.Status = models.JobStatusSuccessful
+
+	testCases := []struct {
+		name            string
+		job             *models.Job
+		clients         []*clients.Client
+		connReturnNotOk bool
 
 		wantStatusCode int
-		wantErrCode    string
 		wantErrTitle   string
-		wantErrDetail  string
+		wantCanceled   bool
 	}{
 		{
-			name:           "job found",
-			jpReturnJob:    wantJob,
-			wantStatusCode: http.StatusOK,
+			name:           "running job",
+			job:            runningJob(),
+			clients:        []*clients.Client{c1},
+			wantStatusCode: http.StatusNoContent,
+			wantCanceled:   true,
 		},
 		{
-			name:           "not found",
-			jpReturnJob:    nil,
+			name:           "unknown job",
+			clients:        []*clients.Client{c1},
 			wantStatusCode: http.StatusNotFound,
-			wantErrTitle:   fmt.Sprintf("Job[id=%q] not found.", wantJob.JID),
+			wantErrTitle:   `Job[id="job-1"] not found.`,
 		},
 		{
-			name:           "error on get job",
-			jpReturnErr:    errors.New("get job fake error"),
-			wantStatusCode: http.StatusInternalServerError,
-			wantErrTitle:   fmt.Sprintf("Failed to find a job[id=%q].", wantJob.JID),
-			wantErrDetail:  "get job fake error",
+			name:           "finished job",
+			job:            finishedJob,
+			clients:        []*clients.Client{c1},
+			wantStatusCode: http.StatusConflict,
+			wantErrTitle:   `Job[id="job-1"] is not running, status: successful.`,
+		},
+		{
+			name:           "disconnected client",
+			job:            runningJob(),
+			wantStatusCode: http.StatusNotFound,
+			wantErrTitle:   fmt.Sprintf("Active client with id=%q not found.", c1.ID),
+		},
+		{
+			name:            "refused by client",
+			job:             runningJob(),
+			clients:         []*clients.Client{c1},
+			connReturnNotOk: true,
+			wantStatusCode:  http.StatusConflict,
+			wantErrTitle:    "client error: no running command with pid 123",
 		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			// given
 			al := APIListener{
 				insecureForTests: true,
-				Logger:           testLog,
 				Server: &Server{
-					config: &Config{
-						Server: ServerConfig{MaxRequestBytes: 1024 * 1024},
-					},
+					clientService: NewClientService(nil, clients.NewClientRepository(tc.clients, &hour, testLog)),
+					config:        &Config{},
 				},
+				Logger: testLog,
 			}
 			al.initRouter()
-
 			jp := NewJobProviderMock()
-			jp.ReturnErr = tc.jpReturnErr
-			jp.ReturnJob = tc.jpReturnJob
+			jp.ReturnJob = tc.job
 			al.jobProvider = jp
 
-			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/clients/%s/commands/%s", wantJob.ClientID, wantJob.JID), nil)
+			connMock.ReturnOk = !tc.connReturnNotOk
+			connMock.ReturnResponsePayload = nil
+			if tc.connReturnNotOk {
+				connMock.ReturnResponsePayload = []byte("no running command with pid 123")
+			}
 
-			// when
+			req := httptest.NewRequest(http.MethodDelete, fmt.Sprintf("/api/v1/clients/%s/commands/job-1", c1.ID), nil)
 			w := httptest.NewRecorder()
 			al.router.ServeHTTP(w, req)
 
-			// then
 			assert.Equal(t, tc.wantStatusCode, w.Code)
-			if tc.wantErrTitle == "" {
-				// success case
-				assert.Equal(t, wantJobRespJSON, w.Body.String())
-				assert.Equal(t, wantJob.ClientID, jp.InputCID)
-				assert.Equal(t, wantJob.JID, jp.InputJID)
-			} else {
-				// failure case
-				wantResp := api.NewErrAPIPayloadFromMessage(tc.wantErrCode, tc.wantErrTitle, tc.wantErrDetail)
+			assert.Equal(t, c1.ID, jp.InputCID)
+			assert.Equal(t, "job-1", jp.InputJID)
+			if tc.wantErrTitle != "" {
+				wantResp := api.NewErrAPIPayloadFromMessage("", tc.wantErrTitle, "")
 				wantRespBytes, err := json.Marshal(wantResp)
 				require.NoError(t, err)
-				require.Equal(t, string(wantRespBytes), w.Body.String())
+				assert.Equal(t, string(wantRespBytes), w.Body.String())
+			}
+			if !tc.wantCanceled {
+				assert.Nil(t, jp.InputSaveJob)
+				return
 			}
+
+			name, _, payload := connMock.InputSendRequest()
+			assert.Equal(t, comm.RequestTypeCancelJob, name)
+			assert.JSONEq(t, `{"jid":"job-1","pid":123}`, string(payload))
+			require.NotNil(t, jp.InputSaveJob)
+			assert.Equal(t, models.JobStatusFailed, jp.InputSaveJob.Status)
+			assert.Equal(t, "cancelled by user", jp.InputSaveJob.Error)
+			assert.NotNil(t, jp.InputSaveJob.FinishedAt)
 		})
 	}
 }
 
-func TestHandleGetCommands(t *testing.T) {
-	ft := time.Date(2020, 10, 10, 10, 10, 10, 0, time.UTC)
-	testCID := "cid-1234"
-	jb := jb.New(t).ClientID(testCID)
-	job1 := jb.Status(models.JobStatusSuccessful).FinishedAt(ft).Build().JobSummary
-	job2 := jb.Status(models.JobStatusUnknown).FinishedAt(ft.Add(-time.Hour)).Build().JobSummary
-	job3 := jb.Status(models.JobStatusFailed).FinishedAt(ft.Add(time.Minute)).Build().JobSummary
-	job4 := jb.Status(models.JobStatusRunning).Build().JobSummary
-	jpSuccessReturnJobSummaries := []*models.JobSummary{&job1, &job2, &job3, &job4}
-	wantSuccessResp := api.NewSuccessPayload([]*models.JobSummary{&job4, &job3, &job1, &job2}) // sorted in desc
-	b, err := json.Marshal(wantSuccessResp)
-	require.NoError(t, err)
-	wantSuccessRespJobsJSON := string(b)
+func TestHandlePostClientReconnect(t *testing.T) {
+	admin := &users.User{
+		Username: "admin",
+		Groups:   []string{users.Administrators},
+	}
+	connMock := test.NewConnMock()
+	c1 := clients.New(t).Connection(connMock).Build()
 
 	testCases := []struct {
-		name string
-
-		jpReturnErr          error
-		jpReturnJobSummaries []*models.JobSummary
+		name            string
+		requestBody     string
+		clients         []*clients.Client
+		connReturnNotOk bool
 
-		wantStatusCode  int
-		wantSuccessResp string
-		wantErrCode     string
-		wantErrTitle    string
-		wantErrDetail   string
+		wantStatusCode int
+		wantErrTitle   string
+		wantErrDetail  string
+		wantSent       bool
 	}{
 		{
-			name:                 "found few jobs",
-			jpReturnJobSummaries: jpSuccessReturnJobSummaries,
-			wantSuccessResp:      wantSuccessRespJobsJSON,
-			wantStatusCode:       http.StatusOK,
+			name:           "reconnect",
+			requestBody:    `{"server_url":"https://rport2.example.com"}`,
+			clients:        []*clients.Client{c1},
+			wantStatusCode: http.StatusNoContent,
+			wantSent:       true,
 		},
 		{
-			name:                 "not found",
-			jpReturnJobSummaries: []*models.JobSummary{},
-			wantSuccessResp:      `{"data":[]}`,
-			wantStatusCode:       http.StatusOK,
+			name:           "invalid url",
+			requestBody:    `{"server_url":"rport2.example.com"}`,
+			clients:        []*clients.Client{c1},
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "Invalid reconnect request.",
+			wantErrDetail:  `invalid server_url "rport2.example.com": expected an http, https, ws or wss URL`,
 		},
 		{
-			name:           "error on get job summaries",
-			jpReturnErr:    errors.New("get job summaries fake error"),
-			wantStatusCode: http.StatusInternalServerError,
-			wantErrTitle:   fmt.Sprintf("Failed to get client jobs: client_id=%q.", testCID),
-			wantErrDetail:  "get job summaries fake error",
-		},
+			name:           "disconnected client",
+			requestBody:    `{"server_url":"https://rport2.example.com"}`,
+			wantStatusCode: http.StatusNotFound,
+			wantErrTitle:   fmt.Sprintf("Active client with id=%q not found.", c1.ID),
+		},
+		{
+			name:            "refused by client",
+			requestBody:     `{"server_url":"https://rport2.example.com"}`,
+			clients:         []*clients.Client{c1},
+			connReturnNotOk: true,
+			wantStatusCode:  http.StatusConflict,
+			wantErrTitle:    "client error: unknown request",
+			wantSent:        true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			al := APIListener{
+				insecureForTests: true,
+				Server: &Server{
+					clientService: NewClientService(nil, clients.NewClientRepository(tc.clients, &hour, testLog)),
+					config: &Config{
+						Server: ServerConfig{MaxRequestBytes: 1024 * 1024},
+					},
+				},
+				userService: users.NewAPIService(users.NewStaticProvider([]*users.User{admin}), false),
+				Logger:      testLog,
+			}
+			al.initRouter()
+
+			connMock.ReturnOk = !tc.connReturnNotOk
+			connMock.ReturnResponsePayload = nil
+			if tc.connReturnNotOk {
+				connMock.ReturnResponsePayload = []byte("unknown request")
+			}
+
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/clients/%s/reconnect", c1.ID), strings.NewReader(tc.requestBody))
+			req = req.WithContext(api.WithUser(req.Context(), admin.Username))
+			w := httptest.NewRecorder()
+			al.router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.wantStatusCode, w.Code)
+			if tc.wantErrTitle != "" {
+				wantResp := api.NewErrAPIPayloadFromMessage("", tc.wantErrTitle, tc.wantErrDetail)
+				wantRespBytes, err := json.Marshal(wantResp)
+				require.NoError(t, err)
+				assert.Equal(t, string(wantRespBytes), w.Body.String())
+			}
+			if tc.wantSent {
+				name, _, payload := connMock.InputSendRequest()
+				assert.Equal(t, comm.RequestTypeReconnect, name)
+				assert.JSONEq(t, `{"server_url":"https://rport2.example.com"}`, string(payload))
+			}
+		})
+	}
+}
+
+func TestHandlePutClientTunnelInvalidACL(t *testing.T) {
+	c1 := clients.New(t).ID("client-1").Build()
+	tunnelsCount := len(c1.Tunnels)
+	al := APIListener{
+		insecureForTests: true,
+		Server: &Server{
+			clientService: NewClientService(nil, clients.NewClientRepository([]*clients.Client{c1}, &hour, testLog)),
+			config: &Config{
+				Server: ServerConfig{MaxRequestBytes: 1024 * 1024},
+			},
+		},
+		Logger: testLog,
+	}
+	al.initRouter()
+
+	testCases := []struct {
+		acl       string
+		wantTitle string
+	}{
+		{
+			acl:       "10.0.0.0/33",
+			wantTitle: "Invalid ACL: invalid CIDR address: 10.0.0.0/33",
+		},
+		{
+			acl:       "2001:db8::/129",
+			wantTitle: "Invalid ACL: invalid CIDR address: 2001:db8::/129",
+		},
+		{
+			acl:       "10.0.0.1,example.com",
+			wantTitle: "Invalid ACL: invalid IP addr: example.com",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.acl, func(t *testing.T) {
+			reqURL := "/api/v1/clients/client-1/tunnels?local=4000&remote=22&acl=" + url.QueryEscape(tc.acl)
+			req := httptest.NewRequest(http.MethodPut, reqURL, nil)
+			w := httptest.NewRecorder()
+			al.router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			wantResp := api.NewErrAPIPayloadFromMessage(ErrCodeInvalidACL, tc.wantTitle, "")
+			wantRespBytes, err := json.Marshal(wantResp)
+			require.NoError(t, err)
+			assert.JSONEq(t, string(wantRespBytes), w.Body.String())
+			assert.Len(t, c1.Tunnels, tunnelsCount)
+		})
+	}
+}
+
+func TestHandlePutClientTunnelInvalidBasicAuth(t *testing.T) {
+	c1 := clients.New(t).ID("client-1").Build()
+	tunnelsCount := len(c1.Tunnels)
+	al := APIListener{
+		insecureForTests: true,
+		Server: &Server{
+			clientService: NewClientService(nil, clients.NewClientRepository([]*clients.Client{c1}, &hour, testLog)),
+			config: &Config{
+				Server: ServerConfig{MaxRequestBytes: 1024 * 1024},
+			},
+		},
+		Logger: testLog,
+	}
+	al.initRouter()
+
+	testCases := []struct {
+		name      string
+		query     string
+		body      string
+		wantTitle string
+	}{
+		{
+			name:      "missing password",
+			query:     "&scheme=http",
+			body:      `{"auth_user":"admin"}`,
+			wantTitle: "Both auth_user and auth_password are required for basic auth.",
+		},
+		{
+			name:      "missing user",
+			query:     "&scheme=http",
+			body:      `{"auth_password":"secret"}`,
+			wantTitle: "Both auth_user and auth_password are required for basic auth.",
+		},
+		{
+			name:      "no scheme",
+			body:      `{"auth_user":"admin","auth_password":"secret"}`,
+			wantTitle: "Basic auth is supported only by TCP tunnels with http or https scheme.",
+		},
+		{
+			name:      "ssh scheme",
+			query:     "&scheme=ssh",
+			body:      `{"auth_user":"admin","auth_password":"secret"}`,
+			wantTitle: "Basic auth is supported only by TCP tunnels with http or https scheme.",
+		},
+		{
+			name:      "https without certificate",
+			query:     "&scheme=https",
+			body:      `{"auth_user":"admin","auth_password":"secret"}`,
+			wantTitle: "Basic auth on https tunnels requires 'cert_file' and 'key_file' in the [api] section.",
+		},
+		{
+			name:      "credentials in query",
+			query:     "&scheme=http&auth_user=admin&auth_password=secret",
+			wantTitle: "Basic auth credentials must be sent in the request body, not in the URL.",
+		},
+		{
+			name:      "password in query",
+			query:     "&scheme=http&auth_password=secret",
+			body:      `{"auth_user":"admin"}`,
+			wantTitle: "Basic auth credentials must be sent in the request body, not in the URL.",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPut, "/api/v1/clients/client-1/tunnels?local=4000&remote=80"+tc.query, strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+			al.router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			wantResp := api.NewErrAPIPayloadFromMessage(ErrCodeInvalidTunnelAuth, tc.wantTitle, "")
+			wantRespBytes, err := json.Marshal(wantResp)
+			require.NoError(t, err)
+			assert.JSONEq(t, string(wantRespBytes), w.Body.String())
+			assert.Len(t, c1.Tunnels, tunnelsCount)
+		})
+	}
+}
+
+func TestHandlePutClientTunnelOnRandomPort(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, l.Close())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c1 := clients.New(t).ID("client-1").Connection(test.NewConnMock()).Build()
+	c1.Context = ctx
+	c1.Logger = testLog
+	portDistributor := ports.NewPortDistributor(mapset.NewThreadUnsafeSetFromSlice([]interface{}{port}))
+	al := APIListener{
+		insecureForTests: true,
+		Server: &Server{
+			clientService: NewClientService(portDistributor, clients.NewClientRepository([]*clients.Client{c1}, &hour, testLog)),
+			config: &Config{
+				Server: ServerConfig{MaxRequestBytes: 1024 * 1024},
+			},
+		},
+		Logger: testLog,
+	}
+	al.initRouter()
+
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/clients/client-1/tunnels?remote=8080&check_port=0", nil)
+	w := httptest.NewRecorder()
+	al.router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp struct {
+		Data struct {
+			LocalHost       string `json:"lhost"`
+			LocalPort       string `json:"lport"`
+			LocalPortRandom bool   `json:"lport_random"`
+		} `json:"data"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "0.0.0.0", resp.Data.LocalHost)
+	assert.Equal(t, strconv.Itoa(port), resp.Data.LocalPort)
+	assert.True(t, resp.Data.LocalPortRandom)
+	// the port is bound by the tunnel
+	_, err = net.Listen("tcp", "127.0.0.1:"+resp.Data.LocalPort)
+	assert.Error(t, err)
+	tunnel := c1.FindTunnelByRemote(&chshare.Remote{
+		LocalHost:  "0.0.0.0",
+		LocalPort:  resp.Data.LocalPort,
+		RemoteHost: "0.0.0.0",
+		RemotePort: "8080",
+		Protocol:   chshare.ProtocolTCP,
+	})
+	require.NotNil(t, tunnel)
+	require.NoError(t, tunnel.Terminate(true))
+}
+
+type bufferWriteCloser struct {
+	bytes.Buffer
+}
+
+func (b *bufferWriteCloser) Close() error {
+	return nil
+}
+
+func TestHandlePutClientTunnelBasicAuthNotInAccessLog(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, l.Close())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c1 := clients.New(t).ID("client-1").Connection(test.NewConnMock()).Build()
+	c1.Context = ctx
+	c1.Logger = testLog
+	portDistributor := ports.NewPortDistributor(mapset.NewThreadUnsafeSetFromSlice([]interface{}{port}))
+	accessLog := &bufferWriteCloser{}
+	al := APIListener{
+		insecureForTests: true,
+		Server: &Server{
+			clientService: NewClientService(portDistributor, clients.NewClientRepository([]*clients.Client{c1}, &hour, testLog)),
+			config: &Config{
+				Server: ServerConfig{MaxRequestBytes: 1024 * 1024},
+			},
+		},
+		Logger:        testLog,
+		accessLogFile: accessLog,
+	}
+	al.initRouter()
+
+	body := strings.NewReader(`{"auth_user":"admin","auth_password":"top-secret-password"}`)
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/clients/client-1/tunnels?remote=8080&scheme=http&check_port=0", body)
+	w := httptest.NewRecorder()
+	al.router.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, accessLog.String(), "PUT /api/v1/clients/client-1/tunnels?remote=8080&scheme=http&check_port=0")
+	assert.NotContains(t, accessLog.String(), "top-secret-password")
+	assert.NotContains(t, w.Body.String(), "top-secret-password")
+
+	tunnel := c1.FindTunnelByRemote(&chshare.Remote{
+		LocalHost:  "0.0.0.0",
+		LocalPort:  strconv.Itoa(port),
+		RemoteHost: "0.0.0.0",
+		RemotePort: "8080",
+		Protocol:   chshare.ProtocolTCP,
+	})
+	require.NotNil(t, tunnel)
+	assert.True(t, tunnel.Remote.HasBasicAuth())
+	require.NoError(t, tunnel.Terminate(true))
+}
+
+func TestSetTunnelBasicAuth(t *testing.T) {
+	scheme := "http"
+	remote := &chshare.Remote{Scheme: &scheme, Protocol: chshare.ProtocolTCP}
+
+	require.NoError(t, setTunnelBasicAuth(remote, "admin", "secret", false))
+
+	assert.Equal(t, "admin", remote.AuthUser)
+	assert.NotContains(t, remote.AuthPasswordHash, "secret")
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(remote.AuthPasswordHash), []byte("secret")))
+}
+
+func TestHandlePostCommandWithTemplateVars(t *testing.T) {
+	testJID := "test-jid"
+	defaultGenerateNewJobID := generateNewJobID
+	defer func() { generateNewJobID = defaultGenerateNewJobID }()
+	generateNewJobID = func() (string, error) {
+		return testJID, nil
+	}
+	testUser := "test-user"
+
+	connMock := test.NewConnMock()
+	connMock.ReturnOk = true
+	sshRespBytes, err := json.Marshal(comm.RunCmdResponse{Pid: 123, StartedAt: time.Date(2020, 10, 10, 10, 10, 10, 0, time.UTC)})
+	require.NoError(t, err)
+	connMock.ReturnResponsePayload = sshRespBytes
+	c1 := clients.New(t).Connection(connMock).Build()
+
+	testCases := []struct {
+		name        string
+		requestBody string
+
+		wantStatusCode int
+		wantCmd        string
+	}{
+		{
+			name:           "run metadata",
+			requestBody:    `{"command": "echo {{.JobID}} {{.Operator}} {{.ClientID}}", "is_template": true}`,
+			wantStatusCode: http.StatusOK,
+			wantCmd:        fmt.Sprintf("echo %s %s %s", testJID, testUser, c1.ID),
+		},
+		{
+			name:           "command is not a template",
+			requestBody:    `{"command": "docker ps --format '{{.ID}} {{.Unknown}}'"}`,
+			wantStatusCode: http.StatusOK,
+			wantCmd:        "docker ps --format '{{.ID}} {{.Unknown}}'",
+		},
+		{
+			name:           "operator cannot be set in request body",
+			requestBody:    `{"command": "echo {{.Operator}}", "is_template": true, "operator": "other-user"}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+		{
+			name:           "unknown variable",
+			requestBody:    `{"command": "echo {{.Unknown}}", "is_template": true}`,
+			wantStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			al := APIListener{
+				insecureForTests: true,
+				Server: &Server{
+					clientService: NewClientService(nil, clients.NewClientRepository([]*clients.Client{c1}, &hour, testLog)),
+					config: &Config{
+						Server: ServerConfig{
+							RunRemoteCmdTimeoutSec: 60,
+							MaxRequestBytes:        1024 * 1024,
+						},
+					},
+				},
+				Logger: testLog,
+			}
+			al.initRouter()
+			jp := NewJobProviderMock()
+			al.jobProvider = jp
+
+			ctx := api.WithUser(context.Background(), testUser)
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/clients/%s/commands", c1.ID), strings.NewReader(tc.requestBody))
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			al.router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.wantStatusCode, w.Code)
+			if tc.wantCmd == "" {
+				return
+			}
+			require.NotNil(t, jp.InputCreateJob)
+			assert.Equal(t, tc.wantCmd, jp.InputCreateJob.Command)
+			_, _, payload := connMock.InputSendRequest()
+			sentJob := &models.Job{}
+			require.NoError(t, json.Unmarshal(payload, sentJob))
+			assert.Equal(t, tc.wantCmd, sentJob.Command)
+		})
+	}
+}
+
+func TestHandlePostLibraryCommand(t *testing.T) {
+	testJID := "test-jid"
+	defaultGenerateNewJobID := generateNewJobID
+	defer func() { generateNewJobID = defaultGenerateNewJobID }()
+	generateNewJobID = func() (string, error) {
+		return testJID, nil
+	}
+	testUser := "test-user"
+
+	connMock := test.NewConnMock()
+	connMock.ReturnOk = true
+	sshRespBytes, err := json.Marshal(comm.RunCmdResponse{Pid: 123, StartedAt: time.Date(2020, 10, 10, 10, 10, 10, 0, time.UTC)})
+	require.NoError(t, err)
+	connMock.ReturnResponsePayload = sshRespBytes
+	c1 := clients.New(t).Connection(connMock).Build()
+
+	db, err := sqlite.New(":memory:", library.AssetNames(), library.Asset)
+	require.NoError(t, err)
+	commandManager := command.NewManager(command.NewSqliteProvider(db))
+	defer commandManager.Close()
+	libCmd, err := commandManager.Create(context.Background(), &command.InputCommand{
+		Name:        "tail log",
+		Cmd:         "tail -n {{.Params.lines}} /var/log/{{.Params.file}} # {{.ClientName}}",
+		Interpreter: "powershell",
+		TimeoutSec:  90,
+		Params:      []string{"lines", "file"},
+	}, testUser)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name        string
+		commandID   string
+		requestBody string
+
+		wantStatusCode  int
+		wantErrTitle    string
+		wantErrDetail   string
+		wantCmd         string
+		wantInterpreter string
+		wantTimeout     int
+	}{
+		{
+			name:            "library defaults",
+			commandID:       libCmd.ID,
+			requestBody:     `{"params": {"lines": "10", "file": "syslog"}}`,
+			wantStatusCode:  http.StatusOK,
+			wantCmd:         "tail -n 10 /var/log/syslog # " + c1.Name,
+			wantInterpreter: "powershell",
+			wantTimeout:     90,
+		},
+		{
+			name:            "overridden interpreter and timeout",
+			commandID:       libCmd.ID,
+			requestBody:     `{"params": {"lines": "5", "file": "messages"}, "interpreter": "cmd", "timeout_sec": 10}`,
+			wantStatusCode:  http.StatusOK,
+			wantCmd:         "tail -n 5 /var/log/messages # " + c1.Name,
+			wantInterpreter: "cmd",
+			wantTimeout:     10,
+		},
+		{
+			name:           "missing and unknown params",
+			commandID:      libCmd.ID,
+			requestBody:    `{"params": {"lines": "10", "path": "syslog"}}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "Invalid params.",
+			wantErrDetail:  "missing params: file; unknown params: path",
+		},
+		{
+			name:           "missing params are sorted",
+			commandID:      libCmd.ID,
+			requestBody:    `{}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "Invalid params.",
+			wantErrDetail:  "missing params: file, lines",
+		},
+		{
+			name:           "param value with shell metacharacters",
+			commandID:      libCmd.ID,
+			requestBody:    `{"params": {"lines": "10", "file": "syslog; rm -rf /"}}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "Invalid command.",
+			wantErrDetail:  `invalid value of param "file", only letters, digits and _@+=:,./- are allowed`,
+		},
+		{
+			name:           "command in request",
+			commandID:      libCmd.ID,
+			requestBody:    `{"command": "whoami", "params": {"lines": "10", "file": "syslog"}}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "Command is taken from the library, 'command' and 'script' should not be specified.",
+		},
+		{
+			name:           "unknown library command",
+			commandID:      "unknown-id",
+			requestBody:    `{}`,
+			wantStatusCode: http.StatusNotFound,
+			wantErrTitle:   "Cannot find a command by the provided id: unknown-id",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			al := APIListener{
+				insecureForTests: true,
+				Server: &Server{
+					clientService: NewClientService(nil, clients.NewClientRepository([]*clients.Client{c1}, &hour, testLog)),
+					config: &Config{
+						Server: ServerConfig{
+							RunRemoteCmdTimeoutSec: 60,
+							MaxRequestBytes:        1024 * 1024,
+						},
+					},
+				},
+				Logger:         testLog,
+				commandManager: commandManager,
+			}
+			al.initRouter()
+			jp := NewJobProviderMock()
+			al.jobProvider = jp
+
+			ctx := api.WithUser(context.Background(), testUser)
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/clients/%s/commands/library/%s", c1.ID, tc.commandID), strings.NewReader(tc.requestBody))
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			al.router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.wantStatusCode, w.Code)
+			if tc.wantErrTitle != "" {
+				wantResp := api.NewErrAPIPayloadFromMessage("", tc.wantErrTitle, tc.wantErrDetail)
+				wantRespBytes, err := json.Marshal(wantResp)
+				require.NoError(t, err)
+				assert.Equal(t, string(wantRespBytes), w.Body.String())
+				return
+			}
+			require.NotNil(t, jp.InputCreateJob)
+			assert.Equal(t, tc.wantCmd, jp.InputCreateJob.Command)
+			assert.Equal(t, tc.wantInterpreter, jp.InputCreateJob.Interpreter)
+			assert.Equal(t, tc.wantTimeout, jp.InputCreateJob.TimeoutSec)
+			_, _, payload := connMock.InputSendRequest()
+			sentJob := &models.Job{}
+			require.NoError(t, json.Unmarshal(payload, sentJob))
+			assert.Equal(t, tc.wantCmd, sentJob.Command)
+		})
+	}
+}
+
+func TestHandlePostCommandWithTemplateNow(t *testing.T) {
+	connMock := test.NewConnMock()
+	connMock.ReturnOk = true
+	sshRespBytes, err := json.Marshal(comm.RunCmdResponse{Pid: 123})
+	require.NoError(t, err)
+	connMock.ReturnResponsePayload = sshRespBytes
+	c1 := clients.New(t).Connection(connMock).Build()
+
+	al := APIListener{
+		insecureForTests: true,
+		Server: &Server{
+			clientService: NewClientService(nil, clients.NewClientRepository([]*clients.Client{c1}, &hour, testLog)),
+			config: &Config{
+				Server: ServerConfig{
+					RunRemoteCmdTimeoutSec: 60,
+					MaxRequestBytes:        1024 * 1024,
+				},
+			},
+		},
+		Logger: testLog,
+	}
+	al.initRouter()
+	jp := NewJobProviderMock()
+	al.jobProvider = jp
+
+	before := time.Now().UTC().Truncate(time.Second)
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/clients/%s/commands", c1.ID), strings.NewReader(`{"command": "{{.Now}}", "is_template": true}`))
+	req = req.WithContext(api.WithUser(context.Background(), "test-user"))
+	w := httptest.NewRecorder()
+	al.router.ServeHTTP(w, req)
+	after := time.Now().UTC()
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NotNil(t, jp.InputCreateJob)
+	gotNow, err := time.Parse(time.RFC3339, jp.InputCreateJob.Command)
+	require.NoError(t, err)
+	assert.False(t, gotNow.Before(before))
+	assert.False(t, gotNow.After(after))
+}
+
+func TestHandleValidateCommand(t *testing.T) {
+	testCases := []struct {
+		name string
+
+		requestBody    string
+		connReturnResp *comm.ValidateCmdResponse
+		connReturnErr  error
+
+		wantStatusCode  int
+		wantResp        *comm.ValidateCmdResponse
+		wantErrTitle    string
+		wantSentCommand string
+	}{
+		{
+			name:            "allowed",
+			requestBody:     `{"command": "/bin/date"}`,
+			connReturnResp:  &comm.ValidateCmdResponse{Allowed: true},
+			wantStatusCode:  http.StatusOK,
+			wantResp:        &comm.ValidateCmdResponse{Allowed: true},
+			wantSentCommand: "/bin/date",
+		},
+		{
+			name:            "rendered template is sent to client",
+			requestBody:     `{"command": "echo {{.ClientID}}", "is_template": true}`,
+			connReturnResp:  &comm.ValidateCmdResponse{Allowed: true},
+			wantStatusCode:  http.StatusOK,
+			wantResp:        &comm.ValidateCmdResponse{Allowed: true},
+			wantSentCommand: "echo client-1",
+		},
+		{
+			name:           "empty command",
+			requestBody:    `{"command": ""}`,
+			wantStatusCode: http.StatusOK,
+			wantResp:       comm.NewCmdDenied(comm.CmdRuleCommand, "Command cannot be empty."),
+		},
+		{
+			name:           "invalid template",
+			requestBody:    `{"command": "echo {{.Unknown", "is_template": true}`,
+			wantStatusCode: http.StatusOK,
+			wantResp:       &comm.ValidateCmdResponse{Rule: comm.CmdRuleTemplate},
+		},
+		{
+			name:           "invalid interpreter",
+			requestBody:    `{"command": "/bin/date", "interpreter": "unknown"}`,
+			wantStatusCode: http.StatusOK,
+			wantResp:       &comm.ValidateCmdResponse{Rule: comm.CmdRuleInterpreter},
+		},
+		{
+			name:            "denied by client",
+			requestBody:     `{"command": "/bin/date", "cwd": "/not/existing"}`,
+			connReturnResp:  comm.NewCmdDenied(comm.CmdRuleWorkingDir, "invalid working directory"),
+			wantStatusCode:  http.StatusOK,
+			wantResp:        comm.NewCmdDenied(comm.CmdRuleWorkingDir, "invalid working directory"),
+			wantSentCommand: "/bin/date",
+		},
+		{
+			name:           "client failure",
+			requestBody:    `{"command": "/bin/date"}`,
+			connReturnErr:  errors.New("send fake error"),
+			wantStatusCode: http.StatusInternalServerError,
+			wantErrTitle:   "Failed to validate remote command.",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// given
+			connMock := test.NewConnMock()
+			connMock.ReturnOk = true
+			connMock.ReturnErr = tc.connReturnErr
+			if tc.connReturnResp != nil {
+				respBytes, err := json.Marshal(tc.connReturnResp)
+				require.NoError(t, err)
+				connMock.ReturnResponsePayload = respBytes
+			}
+			c1 := clients.New(t).ID("client-1").Connection(connMock).Build()
+
+			al := APIListener{
+				insecureForTests: true,
+				Server: &Server{
+					clientService: NewClientService(nil, clients.NewClientRepository([]*clients.Client{c1}, &hour, testLog)),
+					config: &Config{
+						Server: ServerConfig{
+							MaxRequestBytes: 1024 * 1024,
+						},
+					},
+				},
+				Logger: testLog,
+			}
+			al.initRouter()
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/clients/client-1/commands/validate", strings.NewReader(tc.requestBody))
+			req = req.WithContext(api.WithUser(context.Background(), "test-user"))
+
+			// when
+			w := httptest.NewRecorder()
+			al.router.ServeHTTP(w, req)
+
+			// then
+			require.Equal(t, tc.wantStatusCode, w.Code)
+			if tc.wantErrTitle != "" {
+				assert.Contains(t, w.Body.String(), tc.wantErrTitle)
+				return
+			}
+			gotResp := &comm.ValidateCmdResponse{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &api.SuccessPayload{Data: gotResp}))
+			if tc.wantResp.Allowed || tc.wantResp.Reason != "" {
+				assert.Equal(t, tc.wantResp, gotResp)
+			} else {
+				assert.False(t, gotResp.Allowed)
+				assert.Equal(t, tc.wantResp.Rule, gotResp.Rule)
+				assert.NotEmpty(t, gotResp.Reason)
+			}
+
+			gotReqName, _, gotPayload := connMock.InputSendRequest()
+			if tc.wantSentCommand == "" {
+				assert.Empty(t, gotReqName)
+				return
+			}
+			assert.Equal(t, comm.RequestTypeValidateCmd, gotReqName)
+			gotJob := &models.Job{}
+			require.NoError(t, json.Unmarshal(gotPayload, gotJob))
+			assert.Equal(t, tc.wantSentCommand, gotJob.Command)
+		})
+	}
+}
+
+func TestHandleGetCommandResult(t *testing.T) {
+	result := &models.JobResult{StdOut: strings.Repeat("some output\n", 1000), StdErr: "some error"}
+	wantJSON, err := json.Marshal(api.NewSuccessPayload(result))
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	diskJP, err := jobs.NewSqliteProviderWithResultsDir(":memory:", dir, testLog)
+	require.NoError(t, err)
+	defer diskJP.Close()
+	dbJP, err := jobs.NewSqliteProvider(":memory:", testLog)
+	require.NoError(t, err)
+	defer dbJP.Close()
+
+	job := jb.New(t).ClientID("client-1").JID("job-1").Result(result).Build()
+	require.NoError(t, diskJP.SaveJob(job))
+	require.NoError(t, dbJP.SaveJob(job))
+	storedBytes, err := ioutil.ReadFile(filepath.Join(dir, "job-1.payload.json.gz"))
+	require.NoError(t, err)
+	// a result that doesn't match its checksum
+	corrupted := jb.New(t).ClientID("client-1").JID("job-2").Result(result).Build()
+	require.NoError(t, diskJP.SaveJob(corrupted))
+	var corruptedBytes bytes.Buffer
+	zw := gzip.NewWriter(&corruptedBytes)
+	_, err = zw.Write([]byte(`{"data":{"stdout":"changed","stderr":""}}`))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "job-2.payload.json.gz"), corruptedBytes.Bytes(), 0600))
+
+	testCases := []struct {
+		name string
+
+		jp             JobProvider
+		jid            string
+		acceptEncoding string
+		query          string
+
+		wantStatusCode      int
+		wantContentEncoding string
+		// wantPassThrough is true if stored compressed bytes are expected to be returned as is
+		wantPassThrough bool
+		wantBody        []byte
+		wantErrCode     string
+	}{
+		{
+			name:                "stored compressed, gzip client",
+			jp:                  diskJP,
+			jid:                 "job-1",
+			acceptEncoding:      "gzip, deflate",
+			wantStatusCode:      http.StatusOK,
+			wantContentEncoding: "gzip",
+			wantPassThrough:     true,
+			wantBody:            wantJSON,
+		},
+		{
+			name:           "stored compressed, plain client",
+			jp:             diskJP,
+			jid:            "job-1",
+			wantStatusCode: http.StatusOK,
+			wantBody:       wantJSON,
+		},
+		{
+			name:                "stored in DB, gzip client",
+			jp:                  dbJP,
+			jid:                 "job-1",
+			acceptEncoding:      "gzip",
+			wantStatusCode:      http.StatusOK,
+			wantContentEncoding: "gzip",
+			wantBody:            wantJSON,
+		},
+		{
+			name:           "not found",
+			jp:             diskJP,
+			jid:            "unknown",
+			wantStatusCode: http.StatusNotFound,
+		},
+		{
+			name:                "verified, gzip client",
+			jp:                  diskJP,
+			jid:                 "job-1",
+			acceptEncoding:      "gzip",
+			query:               "?verify=true",
+			wantStatusCode:      http.StatusOK,
+			wantContentEncoding: "gzip",
+			wantPassThrough:     true,
+			wantBody:            wantJSON,
+		},
+		{
+			name:           "verified, stored in DB",
+			jp:             dbJP,
+			jid:            "job-1",
+			query:          "?verify=1",
+			wantStatusCode: http.StatusOK,
+			wantBody:       wantJSON,
+		},
+		{
+			name:           "corrupted, not verified",
+			jp:             diskJP,
+			jid:            "job-2",
+			wantStatusCode: http.StatusOK,
+			wantBody:       []byte(`{"data":{"stdout":"changed","stderr":""}}`),
+		},
+		{
+			name:           "corrupted, verified",
+			jp:             diskJP,
+			jid:            "job-2",
+			query:          "?verify=true",
+			wantStatusCode: http.StatusInternalServerError,
+			wantErrCode:    ErrCodeResultChecksumMismatch,
+		},
+		{
+			name:           "invalid verify param",
+			jp:             diskJP,
+			jid:            "job-1",
+			query:          "?verify=maybe",
+			wantStatusCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// given
+			al := APIListener{
+				insecureForTests: true,
+				Server: &Server{
+					config:      &Config{},
+					jobProvider: tc.jp,
+				},
+				Logger: testLog,
+			}
+			al.initRouter()
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/clients/client-1/commands/"+tc.jid+"/result"+tc.query, nil)
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+
+			// when
+			w := httptest.NewRecorder()
+			al.router.ServeHTTP(w, req)
+
+			// then
+			require.Equal(t, tc.wantStatusCode, w.Code)
+			if tc.wantErrCode != "" {
+				assert.Contains(t, w.Body.String(), `"code":"`+tc.wantErrCode+`"`)
+			}
+			if tc.wantBody == nil {
+				return
+			}
+			assert.Equal(t, tc.wantContentEncoding, w.Header().Get("Content-Encoding"))
+			assert.Contains(t, w.Header().Values("Vary"), "Accept-Encoding")
+			if tc.wantPassThrough {
+				assert.Equal(t, storedBytes, w.Body.Bytes())
+			}
+			gotBody := w.Body.Bytes()
+			if tc.wantContentEncoding == "gzip" {
+				zr, err := gzip.NewReader(w.Body)
+				require.NoError(t, err)
+				gotBody, err = ioutil.ReadAll(zr)
+				require.NoError(t, err)
+			}
+			assert.JSONEq(t, string(tc.wantBody), string(gotBody))
+		})
+	}
+}
+
+func TestHandleGetCommand(t *testing.T) {
+	wantJob := jb.New(t).ClientID("cid-1234").JID("jid-1234").Build()
+	wantJobResp := api.NewSuccessPayload(wantJob)
+	b, err := json.Marshal(wantJobResp)
+	require.NoError(t, err)
+	wantJobRespJSON := string(b)
+
+	testCases := []struct {
+		name string
+
+		jpReturnErr error
+		jpReturnJob *models.Job
+
+		wantStatusCode int
+		wantErrCode    string
+		wantErrTitle   string
+		wantErrDetail  string
+	}{
+		{
+			name:           "job found",
+			jpReturnJob:    wantJob,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "not found",
+			jpReturnJob:    nil,
+			wantStatusCode: http.StatusNotFound,
+			wantErrTitle:   fmt.Sprintf("Job[id=%q] not found.", wantJob.JID),
+		},
+		{
+			name:           "error on get job",
+			jpReturnErr:    errors.New("get job fake error"),
+			wantStatusCode: http.StatusInternalServerError,
+			wantErrTitle:   fmt.Sprintf("Failed to find a job[id=%q].", wantJob.JID),
+			wantErrDetail:  "get job fake error",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// given
+			al := APIListener{
+				insecureForTests: true,
+				Logger:           testLog,
+				Server: &Server{
+					config: &Config{
+						Server: ServerConfig{MaxRequestBytes: 1024 * 1024},
+					},
+				},
+			}
+			al.initRouter()
+
+			jp := NewJobProviderMock()
+			jp.ReturnErr = tc.jpReturnErr
+			jp.ReturnJob = tc.jpReturnJob
+			al.jobProvider = jp
+
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/clients/%s/commands/%s", wantJob.ClientID, wantJob.JID), nil)
+
+			// when
+			w := httptest.NewRecorder()
+			al.router.ServeHTTP(w, req)
+
+			// then
+			assert.Equal(t, tc.wantStatusCode, w.Code)
+			if tc.wantErrTitle == "" {
+				// success case
+				assert.Equal(t, wantJobRespJSON, w.Body.String())
+				assert.Equal(t, wantJob.ClientID, jp.InputCID)
+				assert.Equal(t, wantJob.JID, jp.InputJID)
+			} else {
+				// failure case
+				wantResp := api.NewErrAPIPayloadFromMessage(tc.wantErrCode, tc.wantErrTitle, tc.wantErrDetail)
+				wantRespBytes, err := json.Marshal(wantResp)
+				require.NoError(t, err)
+				require.Equal(t, string(wantRespBytes), w.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandleGetCommands(t *testing.T) {
+	ft := time.Date(2020, 10, 10, 10, 10, 10, 0, time.UTC)
+	testCID := "cid-1234"
+	jb := jb.New(t).ClientID(testCID)
+	job1 := jb.Status(models.JobStatusSuccessful).FinishedAt(ft).Build().JobSummary
+	job2 := jb.Status(models.JobStatusUnknown).FinishedAt(ft.Add(-time.Hour)).Build().JobSummary
+	job3 := jb.Status(models.JobStatusFailed).FinishedAt(ft.Add(time.Minute)).Build().JobSummary
+	job4 := jb.Status(models.JobStatusRunning).Build().JobSummary
+	jpSuccessReturnJobSummaries := []*models.JobSummary{&job1, &job2, &job3, &job4}
+	wantSuccessResp := api.NewSuccessPayload([]*models.JobSummary{&job4, &job3, &job1, &job2}) // sorted in desc
+	b, err := json.Marshal(wantSuccessResp)
+	require.NoError(t, err)
+	wantSuccessRespJobsJSON := string(b)
+	b, err = json.Marshal(api.NewSuccessPayload([]*models.JobSummary{&job2, &job1}))
+	require.NoError(t, err)
+	wantDurationSortedRespJSON := string(b)
+
+	testCases := []struct {
+		name string
+
+		query                string
+		jpReturnErr          error
+		jpReturnJobSummaries []*models.JobSummary
+
+		wantStatusCode     int
+		wantSuccessResp    string
+		wantFilters        []query.FilterOption
+		wantSorts          []query.SortOption
+		wantIncludeRunning bool
+		wantErrCode        string
+		wantErrTitle       string
+		wantErrDetail      string
+	}{
+		{
+			name:                 "found few jobs",
+			jpReturnJobSummaries: jpSuccessReturnJobSummaries,
+			wantSuccessResp:      wantSuccessRespJobsJSON,
+			wantStatusCode:       http.StatusOK,
+			wantFilters:          []query.FilterOption{},
+		},
+		{
+			name:                 "filter by interpreter",
+			query:                "?filter[interpreter]=tacoscript,powershell",
+			jpReturnJobSummaries: []*models.JobSummary{},
+			wantSuccessResp:      `{"data":[]}`,
+			wantStatusCode:       http.StatusOK,
+			wantFilters:          []query.FilterOption{{Column: "interpreter", Values: []string{"tacoscript", "powershell"}}},
+		},
+		{
+			name:                 "filter and sort by duration",
+			query:                "?filter[duration][gt]=300&sort=-duration&include_running=true",
+			jpReturnJobSummaries: []*models.JobSummary{&job2, &job1},
+			wantSuccessResp:      wantDurationSortedRespJSON, // order of the provider is kept
+			wantStatusCode:       http.StatusOK,
+			wantFilters:          []query.FilterOption{{Column: "duration", Operator: "gt", Values: []string{"300"}}},
+			wantSorts:            []query.SortOption{{Column: "duration", IsASC: false}},
+			wantIncludeRunning:   true,
+		},
+		{
+			name:           "invalid duration filter",
+			query:          "?filter[duration][lt]=5m",
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   `invalid duration filter value "5m", expected a number of seconds`,
+		},
+		{
+			name:           "duration filter without operator",
+			query:          "?filter[duration]=300",
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "unsupported filter field 'duration'",
+		},
+		{
+			name:           "unsupported sort",
+			query:          "?sort=status",
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "unsupported sort field 'status'",
+		},
+		{
+			name:           "invalid include_running",
+			query:          "?include_running=maybe",
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "Invalid include_running param maybe.",
+		},
+		{
+			name:           "unsupported filter",
+			query:          "?filter[command]=date",
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "unsupported filter field 'command'",
+		},
+		{
+			name:                 "not found",
+			jpReturnJobSummaries: []*models.JobSummary{},
+			wantSuccessResp:      `{"data":[]}`,
+			wantStatusCode:       http.StatusOK,
+			wantFilters:          []query.FilterOption{},
+		},
+		{
+			name:           "error on get job summaries",
+			jpReturnErr:    errors.New("get job summaries fake error"),
+			wantStatusCode: http.StatusInternalServerError,
+			wantErrTitle:   fmt.Sprintf("Failed to get client jobs: client_id=%q.", testCID),
+			wantErrDetail:  "get job summaries fake error",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -1029,7 +2410,7 @@ func TestHandleGetCommands(t *testing.T) {
 			jp.ReturnJobSummaries = tc.jpReturnJobSummaries
 			al.jobProvider = jp
 
-			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/clients/%s/commands", testCID), nil)
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/api/v1/clients/%s/commands", testCID)+tc.query, nil)
 
 			// when
 			w := httptest.NewRecorder()
@@ -1041,6 +2422,9 @@ func TestHandleGetCommands(t *testing.T) {
 				// success case
 				assert.Equal(t, tc.wantSuccessResp, w.Body.String())
 				assert.Equal(t, testCID, jp.InputCID)
+				assert.Equal(t, tc.wantFilters, jp.InputFilters)
+				assert.ElementsMatch(t, tc.wantSorts, jp.InputSummariesOptions.Sorts)
+				assert.Equal(t, tc.wantIncludeRunning, jp.InputSummariesOptions.IncludeRunning)
 			} else {
 				// failure case
 				wantResp := api.NewErrAPIPayloadFromMessage(tc.wantErrCode, tc.wantErrTitle, tc.wantErrDetail)
@@ -1091,6 +2475,7 @@ func TestHandleGetClients(t *testing.T) {
          "os_kernel":"linux",
          "os_version":"18.0",
          "os_virtualization_role":"guest",
+         "os_raw":null,
          "os_virtualization_system":"LVM",
          "hostname":"alpine-3-10-tk-01",
          "ipv4":[
@@ -1103,6 +2488,10 @@ func TestHandleGetClients(t *testing.T) {
             "Linux",
             "Datacenter 1"
          ],
+         "environment":"",
+         "commands_disabled":false,
+         "package_manager":"",
+         "interpreters":null,
          "version":"0.1.12",
          "address":"88.198.189.161:50078",
          "timezone":"UTC-0",
@@ -1112,6 +2501,7 @@ func TestHandleGetClients(t *testing.T) {
                "lport":"2222",
                "rhost":"0.0.0.0",
                "rport":"22",
+               "protocol":"tcp",
                "lport_random":false,
                "scheme":null,
                "acl":null,
@@ -1123,6 +2513,7 @@ func TestHandleGetClients(t *testing.T) {
                "lport":"4000",
                "rhost":"0.0.0.0",
                "rport":"80",
+               "protocol":"tcp",
                "lport_random":false,
                "scheme":null,
                "acl":null,
@@ -1136,9 +2527,16 @@ func TestHandleGetClients(t *testing.T) {
          "cpu_model_name":"",
          "cpu_vendor":"GenuineIntel",
          "disconnected_at":null,
+         "disconnect_reason":"",
+         "parked_at":null,
          "client_auth_id":"user1",
 		 "allowed_user_groups":null,
-		 "updates_status":null
+		 "auto_tags":null,
+		 "updates_status":null,
+		 "health":"",
+		 "health_status":null,
+		 "boot_time":null,
+		 "previous_boot_time":null
       },
       {
          "id":"client-2",
@@ -1152,6 +2550,7 @@ func TestHandleGetClients(t *testing.T) {
          "os_kernel":"linux",
          "os_version": "18.0",
 		 "os_virtualization_role":"guest",
+		 "os_raw":null,
 		 "os_virtualization_system":"LVM",
          "hostname":"alpine-3-10-tk-01",
          "ipv4":[
@@ -1164,6 +2563,10 @@ func TestHandleGetClients(t *testing.T) {
             "Linux",
             "Datacenter 1"
          ],
+         "environment":"",
+         "commands_disabled":false,
+         "package_manager":"",
+         "interpreters":null,
          "version":"0.1.12",
          "address":"88.198.189.161:50078",
          "timezone":"UTC-0",
@@ -1173,6 +2576,7 @@ func TestHandleGetClients(t *testing.T) {
                "lport":"2222",
                "rhost":"0.0.0.0",
                "rport":"22",
+               "protocol":"tcp",
                "lport_random":false,
                "scheme":null,
                "acl":null,
@@ -1184,6 +2588,7 @@ func TestHandleGetClients(t *testing.T) {
                "lport":"4000",
                "rhost":"0.0.0.0",
                "rport":"80",
+               "protocol":"tcp",
                "lport_random":false,
                "scheme":null,
                "acl":null,
@@ -1197,16 +2602,120 @@ func TestHandleGetClients(t *testing.T) {
          "cpu_model_name":"",
 		 "cpu_vendor":"GenuineIntel",
          "disconnected_at":"2020-08-19T13:04:23+03:00",
+         "disconnect_reason":"",
+         "parked_at":null,
          "client_auth_id":"user1",
 		 "allowed_user_groups":null,
-		 "updates_status":null
+		 "auto_tags":null,
+		 "updates_status":null,
+		 "health":"",
+		 "health_status":null,
+		 "boot_time":null,
+		 "previous_boot_time":null
       }
-   ]
+   ],
+   "meta":{
+      "count":2
+   }
 }`
 	assert.Equal(t, 200, w.Code)
 	assert.JSONEq(t, expectedJSON, w.Body.String())
 }
 
+func TestHandleGetClientsPagination(t *testing.T) {
+	curUser := &users.User{
+		Username: "admin",
+		Groups:   []string{users.Administrators},
+	}
+	var cls []*clients.Client
+	for _, id := range []string{"client-3", "client-1", "client-4", "client-2", "client-5"} {
+		cls = append(cls, clients.New(t).ID(id).Build())
+	}
+	al := APIListener{
+		insecureForTests: true,
+		Server: &Server{
+			clientService: NewClientService(nil, clients.NewClientRepository(cls, &hour, testLog)),
+			config: &Config{
+				Server: ServerConfig{MaxRequestBytes: 1024 * 1024},
+				API:    APIConfig{MaxClientsPageLimit: 3},
+			},
+		},
+		userService: users.NewAPIService(users.NewStaticProvider([]*users.User{curUser}), false),
+	}
+	al.initRouter()
+
+	testCases := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantIDs    []string
+		wantErr    string
+	}{
+		{
+			name:       "no pagination",
+			wantStatus: http.StatusOK,
+			wantIDs:    []string{"client-1", "client-2", "client-3", "client-4", "client-5"},
+		},
+		{
+			name:       "first page",
+			query:      "page[limit]=2",
+			wantStatus: http.StatusOK,
+			wantIDs:    []string{"client-1", "client-2"},
+		},
+		{
+			name:       "page after filtering and sorting",
+			query:      "sort=-id&page[limit]=2&page[offset]=1",
+			wantStatus: http.StatusOK,
+			wantIDs:    []string{"client-4", "client-3"},
+		},
+		{
+			name:       "offset beyond total",
+			query:      "page[offset]=10",
+			wantStatus: http.StatusOK,
+			wantIDs:    []string{},
+		},
+		{
+			name:       "limit exceeds max",
+			query:      "page[limit]=4",
+			wantStatus: http.StatusBadRequest,
+			wantErr:    `invalid page[limit] "4", expected a number from 1 to 3`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/api/v1/clients?"+tc.query, nil)
+			req = req.WithContext(api.WithUser(context.Background(), curUser.Username))
+
+			al.router.ServeHTTP(w, req)
+
+			require.Equal(t, tc.wantStatus, w.Code)
+			if tc.wantErr != "" {
+				wantResp := api.NewErrAPIPayloadFromMessage("", tc.wantErr, "")
+				wantJSON, err := json.Marshal(wantResp)
+				require.NoError(t, err)
+				assert.JSONEq(t, string(wantJSON), w.Body.String())
+				return
+			}
+			var resp struct {
+				Data []struct {
+					ID string `json:"id"`
+				} `json:"data"`
+				Meta clientsListMeta `json:"meta"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			gotIDs := make([]string, 0, len(resp.Data))
+			for _, cl := range resp.Data {
+				gotIDs = append(gotIDs, cl.ID)
+			}
+			assert.Equal(t, tc.wantIDs, gotIDs)
+			assert.Equal(t, 5, resp.Meta.Count)
+		})
+	}
+}
+
 func TestHandlePostMultiClientCommand(t *testing.T) {
 	testUser := "test-user"
 	curUser := &users.User{
@@ -1233,6 +2742,13 @@ func TestHandlePostMultiClientCommand(t *testing.T) {
 	c1 := clients.New(t).ID("client-1").Connection(connMock1).Build()
 	c2 := clients.New(t).ID("client-2").Connection(connMock2).Build()
 	c3 := clients.New(t).ID("client-3").DisconnectedDuration(5 * time.Minute).Build()
+	c5 := clients.New(t).ID("client-5").Connection(test.NewConnMock()).Build()
+	c5.CommandsDisabled = true
+	c6 := clients.New(t).ID("client-6").Connection(test.NewConnMock()).Build()
+	c6.Interpreters = []string{"tacoscript"}
+	c1.Tags = []string{"prod", "web"}
+	c2.Tags = []string{"prod", "db"}
+	c3.Tags = []string{"prod"}
 
 	defaultTimeout := 60
 	gotCmd := "/bin/date;foo;whoami"
@@ -1257,6 +2773,7 @@ func TestHandlePostMultiClientCommand(t *testing.T) {
 		wantErrTitle   string
 		wantErrDetail  string
 		wantJobErr     string
+		wantCommands   []string
 	}{
 		{
 			name:           "valid cmd",
@@ -1264,15 +2781,98 @@ func TestHandlePostMultiClientCommand(t *testing.T) {
 			wantStatusCode: http.StatusOK,
 		},
 		{
-			name: "only one client",
+			name: "template with params",
+			requestBody: `
+		{
+			"command": "tail -n {{.Params.lines}} /var/log/{{.ClientID}}.log",
+			"is_template": true,
+			"params": {"lines": "5"},
+			"client_ids": ["client-1", "client-2"],
+			"abort_on_error": false
+		}`,
+			wantStatusCode: http.StatusOK,
+			wantCommands:   []string{"tail -n 5 /var/log/client-1.log", "tail -n 5 /var/log/client-2.log"},
+		},
+		{
+			name: "param value with shell metacharacters",
+			requestBody: `
+		{
+			"command": "tail -n {{.Params.lines}} /var/log/syslog",
+			"is_template": true,
+			"params": {"lines": "5 $(whoami)"},
+			"client_ids": ["client-1", "client-2"]
+		}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "Invalid command.",
+			wantErrDetail:  `invalid value of param "lines", only letters, digits and _@+=:,./- are allowed`,
+		},
+		{
+			name: "params without template",
+			requestBody: `
+		{
+			"command": "/bin/date",
+			"params": {"lines": "5"},
+			"client_ids": ["client-1", "client-2"]
+		}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "Invalid command.",
+			wantErrDetail:  "params can be used only in template commands",
+		},
+		{
+			name: "only one client",
+			requestBody: `
+		{
+			"command": "/bin/date;foo;whoami",
+			"timeout_sec": 30,
+			"client_ids": ["client-1"]
+		}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "At least 2 clients should be specified.",
+		},
+		{
+			name: "clients by tag",
+			requestBody: `
+		{
+			"command": "/bin/date;foo;whoami",
+			"timeout_sec": 30,
+			"tags": ["prod"],
+			"abort_on_error": false
+		}`,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name: "client ids and tags",
+			requestBody: `
+		{
+			"command": "/bin/date;foo;whoami",
+			"timeout_sec": 30,
+			"client_ids": ["client-1"],
+			"tags": ["db"],
+			"abort_on_error": false
+		}`,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name: "no clients with tags",
+			requestBody: `
+		{
+			"command": "/bin/date;foo;whoami",
+			"timeout_sec": 30,
+			"tags": ["unknown"]
+		}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   "No active clients have the selected tag(s).",
+		},
+		{
+			name: "tags resolve to one client",
 			requestBody: `
 		{
 			"command": "/bin/date;foo;whoami",
 			"timeout_sec": 30,
-			"client_ids": ["client-1"]
+			"tags": ["web"]
 		}`,
 			wantStatusCode: http.StatusBadRequest,
-			wantErrTitle:   "At least 2 clients should be specified.",
+			wantErrTitle:   "At least 2 clients should be specified, the selected clients, groups and tags resolve to 1 active client(s).",
 		},
 		{
 			name: "disconnected client",
@@ -1303,6 +2903,31 @@ func TestHandlePostMultiClientCommand(t *testing.T) {
 			wantStatusCode: http.StatusOK,
 			wantJobErr:     "failed to send request: send fake error",
 		},
+		{
+			name: "commands disabled on client",
+			requestBody: `
+		{
+			"command": "/bin/date;foo;whoami",
+			"timeout_sec": 30,
+			"client_ids": ["client-5", "client-2"],
+			"abort_on_error": false
+		}`,
+			wantStatusCode: http.StatusOK,
+			wantJobErr:     `command execution is disabled on client with id="client-5"`,
+		},
+		{
+			name: "interpreter not available on client",
+			requestBody: `
+		{
+			"command": "/bin/date;foo;whoami",
+			"interpreter": "powershell",
+			"timeout_sec": 30,
+			"client_ids": ["client-6", "client-2"],
+			"abort_on_error": false
+		}`,
+			wantStatusCode: http.StatusOK,
+			wantJobErr:     `interpreter "powershell" is not available on client with id="client-6", available: ["tacoscript"]`,
+		},
 		{
 			name: "error on send request, abort on err",
 			requestBody: `
@@ -1326,7 +2951,7 @@ func TestHandlePostMultiClientCommand(t *testing.T) {
 			al := APIListener{
 				insecureForTests: true,
 				Server: &Server{
-					clientService: NewClientService(nil, clients.NewClientRepository([]*clients.Client{c1, c2, c3}, &hour, testLog)),
+					clientService: NewClientService(nil, clients.NewClientRepository([]*clients.Client{c1, c2, c3, c5, c6}, &hour, testLog)),
 					config: &Config{
 						Server: ServerConfig{
 							RunRemoteCmdTimeoutSec: defaultTimeout,
@@ -1368,6 +2993,7 @@ func TestHandlePostMultiClientCommand(t *testing.T) {
 			if tc.wantStatusCode == http.StatusOK {
 				// wait until async task executeMultiClientJob finishes
 				<-al.testDone
+				assert.Equal(t, 0, al.jobsDoneChannel.Len())
 			}
 			if tc.wantErrTitle == "" {
 				// success case
@@ -1382,30 +3008,531 @@ func TestHandlePostMultiClientCommand(t *testing.T) {
 				require.True(t, ok)
 				require.NotEmpty(t, gotJID)
 
-				gotMultiJob, err := jp.GetMultiJob(gotJID)
-				require.NoError(t, err)
-				require.NotNil(t, gotMultiJob)
-				if tc.abortOnErr {
-					require.Len(t, gotMultiJob.Jobs, 1)
-				} else {
-					require.Len(t, gotMultiJob.Jobs, 2)
-				}
-				if tc.connReturnErr != nil {
-					assert.Equal(t, models.JobStatusFailed, gotMultiJob.Jobs[0].Status)
-					assert.Equal(t, tc.wantJobErr, gotMultiJob.Jobs[0].Error)
-				} else {
-					assert.Equal(t, models.JobStatusRunning, gotMultiJob.Jobs[0].Status)
-				}
-				if !tc.abortOnErr {
-					assert.Equal(t, models.JobStatusRunning, gotMultiJob.Jobs[1].Status)
-				}
-			} else {
-				// failure case
-				wantResp := api.NewErrAPIPayloadFromMessage(tc.wantErrCode, tc.wantErrTitle, tc.wantErrDetail)
-				wantRespBytes, err := json.Marshal(wantResp)
-				require.NoError(t, err)
-				require.Equal(t, string(wantRespBytes), w.Body.String())
-			}
+				gotMultiJob, err := jp.GetMultiJob(gotJID)
+				require.NoError(t, err)
+				require.NotNil(t, gotMultiJob)
+				if tc.abortOnErr {
+					require.Len(t, gotMultiJob.Jobs, 1)
+				} else {
+					require.Len(t, gotMultiJob.Jobs, 2)
+				}
+				if tc.wantJobErr != "" {
+					assert.Equal(t, models.JobStatusFailed, gotMultiJob.Jobs[0].Status)
+					assert.Equal(t, tc.wantJobErr, gotMultiJob.Jobs[0].Error)
+				} else {
+					assert.Equal(t, models.JobStatusRunning, gotMultiJob.Jobs[0].Status)
+				}
+				if !tc.abortOnErr {
+					assert.Equal(t, models.JobStatusRunning, gotMultiJob.Jobs[1].Status)
+				}
+				if tc.wantCommands != nil {
+					var gotCommands []string
+					for _, job := range gotMultiJob.Jobs {
+						gotCommands = append(gotCommands, job.Command)
+					}
+					assert.ElementsMatch(t, tc.wantCommands, gotCommands)
+				}
+			} else {
+				// failure case
+				wantResp := api.NewErrAPIPayloadFromMessage(tc.wantErrCode, tc.wantErrTitle, tc.wantErrDetail)
+				wantRespBytes, err := json.Marshal(wantResp)
+				require.NoError(t, err)
+				require.Equal(t, string(wantRespBytes), w.Body.String())
+			}
+		})
+	}
+}
+
+func TestExecuteMultiClientJobBatchTimeout(t *testing.T) {
+	defaultGenerateNewJobID := generateNewJobID
+	defer func() { generateNewJobID = defaultGenerateNewJobID }()
+	generateNewJobID = random.UUID4
+
+	sshRespBytes, err := json.Marshal(comm.RunCmdResponse{Pid: 1, StartedAt: time.Now()})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		concurrent bool
+		// finishClient is a client that reports its result before the batch timeout
+		finishClient string
+		wantStatuses map[string]string
+		// wantKilled are clients that are asked to kill their running job
+		wantKilled []string
+	}{
+		{
+			name: "sequential, slow first job cancels the rest",
+			wantStatuses: map[string]string{
+				"client-1": models.JobStatusCanceled,
+				"client-2": models.JobStatusCanceled,
+				"client-3": models.JobStatusCanceled,
+			},
+			wantKilled: []string{"client-1"},
+		},
+		{
+			name:         "concurrent, unfinished jobs are canceled",
+			concurrent:   true,
+			finishClient: "client-2",
+			wantStatuses: map[string]string{
+				"client-1": models.JobStatusCanceled,
+				"client-2": models.JobStatusSuccessful,
+				"client-3": models.JobStatusCanceled,
+			},
+			wantKilled: []string{"client-1", "client-3"},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var testClients []*clients.Client
+			conns := make(map[string]*test.ConnMock)
+			for _, id := range []string{"client-1", "client-2", "client-3"} {
+				connMock := test.NewConnMock()
+				connMock.ReturnOk = true
+				connMock.ReturnResponsePayload = sshRespBytes
+				conns[id] = connMock
+				testClients = append(testClients, clients.New(t).ID(id).Connection(connMock).Build())
+			}
+			al := APIListener{
+				Server: &Server{
+					config:        &Config{},
+					clientService: NewClientService(nil, clients.NewClientRepository(testClients, &hour, testLog)),
+					jobsDoneChannel: jobResultChanMap{
+						m: make(map[string]chan *models.Job),
+					},
+				},
+				Logger: testLog,
+			}
+			jp, err := jobs.NewSqliteProvider(":memory:", testLog)
+			require.NoError(t, err)
+			defer jp.Close()
+			al.jobProvider = jp
+
+			multiJob := &models.MultiJob{
+				MultiJobSummary: models.MultiJobSummary{
+					JID:       "multi-job-" + strconv.FormatBool(tc.concurrent),
+					StartedAt: time.Now(),
+					CreatedBy: "admin",
+				},
+				ClientIDs:       []string{"client-1", "client-2", "client-3"},
+				Command:         "/bin/sleep 60",
+				TimeoutSec:      60,
+				Concurrent:      tc.concurrent,
+				AbortOnErr:      false,
+				BatchTimeoutSec: 1,
+			}
+			require.NoError(t, jp.SaveMultiJob(multiJob))
+			done, err := al.jobsDoneChannel.Add(multiJob.JID, 3)
+			require.NoError(t, err)
+
+			if tc.finishClient != "" {
+				go func() {
+					// emulate a client that reports its result
+					for i := 0; i < 100; i++ {
+						jobs, err := jp.GetByMultiJobID(multiJob.JID)
+						require.NoError(t, err)
+						for _, cur := range jobs {
+							if cur.ClientID == tc.finishClient {
+								now := time.Now()
+								cur.Status = models.JobStatusSuccessful
+								cur.FinishedAt = &now
+								require.NoError(t, jp.SaveJob(cur))
+								al.jobsDoneChannel.Send(multiJob.JID, cur)
+								return
+							}
+						}
+						time.Sleep(10 * time.Millisecond)
+					}
+				}()
+			}
+
+			start := time.Now()
+			al.executeMultiClientJob(multiJob, testClients, done)
+
+			assert.Less(t, int64(time.Since(start)), int64(3*time.Second))
+			assert.Equal(t, 0, al.jobsDoneChannel.Len())
+			gotMultiJob, err := jp.GetMultiJob(multiJob.JID)
+			require.NoError(t, err)
+			require.NotNil(t, gotMultiJob.FinishedAt)
+			gotStatuses := make(map[string]string)
+			for _, cur := range gotMultiJob.Jobs {
+				gotStatuses[cur.ClientID] = cur.Status
+				if cur.Status == models.JobStatusCanceled {
+					assert.Equal(t, "batch timeout (1 sec) is reached", cur.Error)
+					assert.NotNil(t, cur.FinishedAt)
+				}
+			}
+			assert.Equal(t, tc.wantStatuses, gotStatuses)
+			var gotKilled []string
+			for id, connMock := range conns {
+				name, _, payload := connMock.InputSendRequest()
+				if name != comm.RequestTypeCancelJob {
+					continue
+				}
+				gotKilled = append(gotKilled, id)
+				cancelReq := &comm.CancelJobRequest{}
+				require.NoError(t, json.Unmarshal(payload, cancelReq))
+				assert.Equal(t, 1, cancelReq.PID)
+			}
+			assert.ElementsMatch(t, tc.wantKilled, gotKilled)
+		})
+	}
+}
+
+func TestExecuteMultiClientJobConcurrentHoldsLimit(t *testing.T) {
+	defaultGenerateNewJobID := generateNewJobID
+	defer func() { generateNewJobID = defaultGenerateNewJobID }()
+	generateNewJobID = random.UUID4
+
+	connMock := test.NewConnMock()
+	connMock.ReturnOk = true
+	sshRespBytes, err := json.Marshal(comm.RunCmdResponse{Pid: 1, StartedAt: time.Now()})
+	require.NoError(t, err)
+	connMock.ReturnResponsePayload = sshRespBytes
+	c1 := clients.New(t).ID("client-1").Connection(connMock).Build()
+	c2 := clients.New(t).ID("client-2").Connection(connMock).Build()
+
+	al := APIListener{
+		Server: &Server{
+			config: &Config{},
+			jobsDoneChannel: jobResultChanMap{
+				m:     make(map[string]chan *models.Job),
+				limit: 1,
+			},
+		},
+		Logger: testLog,
+	}
+	jp, err := jobs.NewSqliteProvider(":memory:", testLog)
+	require.NoError(t, err)
+	defer jp.Close()
+	al.jobProvider = jp
+
+	multiJob := &models.MultiJob{
+		MultiJobSummary: models.MultiJobSummary{
+			JID:       "multi-job",
+			StartedAt: time.Now(),
+			CreatedBy: "admin",
+		},
+		ClientIDs:  []string{c1.ID, c2.ID},
+		Command:    "/bin/date",
+		TimeoutSec: 60,
+		Concurrent: true,
+	}
+	require.NoError(t, jp.SaveMultiJob(multiJob))
+	done, err := al.jobsDoneChannel.Add(multiJob.JID, 2)
+	require.NoError(t, err)
+
+	finished := make(chan struct{})
+	go func() {
+		al.executeMultiClientJob(multiJob, []*clients.Client{c1, c2}, done)
+		close(finished)
+	}()
+
+	var childJobs []*models.Job
+	require.Eventually(t, func() bool {
+		childJobs, err = jp.GetByMultiJobID(multiJob.JID)
+		require.NoError(t, err)
+		return len(childJobs) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the job is in-flight until its results come
+	_, err = al.jobsDoneChannel.Add("other-multi-job", 2)
+	assert.Equal(t, ErrTooManyMultiJobs, err)
+
+	for _, cur := range childJobs {
+		assert.True(t, al.jobsDoneChannel.Send(multiJob.JID, cur))
+	}
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("multi-client job is not finished")
+	}
+	assert.Equal(t, 0, al.jobsDoneChannel.Len())
+}
+
+func TestHandlePostMultiClientCommandTooManyJobs(t *testing.T) {
+	curUser := &users.User{
+		Username: "test-user",
+		Groups:   []string{users.Administrators},
+	}
+	connMock := test.NewConnMock()
+	connMock.ReturnOk = true
+	c1 := clients.New(t).ID("client-1").Connection(connMock).Build()
+	c2 := clients.New(t).ID("client-2").Connection(connMock).Build()
+
+	al := APIListener{
+		insecureForTests: true,
+		Server: &Server{
+			clientService: NewClientService(nil, clients.NewClientRepository([]*clients.Client{c1, c2}, &hour, testLog)),
+			config: &Config{
+				Server: ServerConfig{
+					RunRemoteCmdTimeoutSec: 60,
+					MaxRequestBytes:        1024 * 1024,
+				},
+			},
+			jobsDoneChannel: jobResultChanMap{
+				m:     make(map[string]chan *models.Job),
+				limit: 1,
+			},
+		},
+		userService: users.NewAPIService(users.NewStaticProvider([]*users.User{curUser}), false),
+		Logger:      testLog,
+	}
+	al.initRouter()
+
+	jp, err := jobs.NewSqliteProvider("file::memory:?cache=shared", testLog)
+	require.NoError(t, err)
+	defer jp.Close()
+	al.jobProvider = jp
+
+	_, err = al.jobsDoneChannel.Add("running-multi-job", 2)
+	require.NoError(t, err)
+
+	ctx := api.WithUser(context.Background(), curUser.Username)
+	reqBody := `{"command": "/bin/date", "client_ids": ["client-1", "client-2"]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/commands", strings.NewReader(reqBody)).WithContext(ctx)
+
+	// when
+	w := httptest.NewRecorder()
+	al.router.ServeHTTP(w, req)
+
+	// then
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	wantResp := api.NewErrAPIPayloadFromMessage("", ErrTooManyMultiJobs.Error(), "")
+	wantRespBytes, err := json.Marshal(wantResp)
+	require.NoError(t, err)
+	assert.Equal(t, string(wantRespBytes), w.Body.String())
+	assert.Equal(t, 1, al.jobsDoneChannel.Len())
+	name, _, _ := connMock.InputSendRequest()
+	assert.Empty(t, name)
+}
+
+func TestHandleListMultiClientCommands(t *testing.T) {
+	jp, err := jobs.NewSqliteProvider(":memory:", testLog)
+	require.NoError(t, err)
+	defer jp.Close()
+
+	t1 := time.Date(2020, 10, 10, 10, 10, 10, 0, time.UTC)
+	job1 := jb.NewMulti(t).JID("1111").StartedAt(t1).CreatedBy("admin").Build()
+	job2 := jb.NewMulti(t).JID("2222").StartedAt(t1.Add(time.Minute)).CreatedBy("admin").Build()
+	job3 := jb.NewMulti(t).JID("3333").StartedAt(t1.Add(2 * time.Minute)).CreatedBy("bob").Build()
+	for _, j := range []*models.MultiJob{job1, job2, job3} {
+		require.NoError(t, jp.SaveMultiJob(j))
+	}
+	require.NoError(t, jp.SaveJob(jb.New(t).MultiJobID(job1.JID).Status(models.JobStatusSuccessful).Build()))
+	require.NoError(t, jp.SaveJob(jb.New(t).MultiJobID(job1.JID).Status(models.JobStatusSuccessful).Build()))
+	require.NoError(t, jp.SaveJob(jb.New(t).MultiJobID(job2.JID).Status(models.JobStatusSuccessful).Build()))
+	require.NoError(t, jp.SaveJob(jb.New(t).MultiJobID(job2.JID).Status(models.JobStatusFailed).Build()))
+	require.NoError(t, jp.SaveJob(jb.New(t).MultiJobID(job3.JID).Status(models.JobStatusRunning).Build()))
+
+	al := APIListener{
+		insecureForTests: true,
+		Logger:           testLog,
+		Server: &Server{
+			config: &Config{
+				Server: ServerConfig{MaxRequestBytes: 1024 * 1024},
+			},
+			jobProvider: jp,
+		},
+	}
+	al.initRouter()
+
+	job1JSON := `{"jid":"1111","started_at":"2020-10-10T10:10:10Z","created_by":"admin","client_count":2,"status":"successful","status_counts":{"canceled":0,"failed":0,"running":0,"successful":2,"unknown":0}}`
+	job2JSON := `{"jid":"2222","started_at":"2020-10-10T10:11:10Z","created_by":"admin","client_count":2,"status":"failed","status_counts":{"canceled":0,"failed":1,"running":0,"successful":1,"unknown":0}}`
+	job3JSON := `{"jid":"3333","started_at":"2020-10-10T10:12:10Z","created_by":"bob","client_count":1,"status":"running","status_counts":{"canceled":0,"failed":0,"running":1,"successful":0,"unknown":0}}`
+
+	testCases := []struct {
+		name           string
+		query          string
+		wantStatusCode int
+		wantResp       string
+	}{
+		{
+			name:           "all",
+			wantStatusCode: http.StatusOK,
+			wantResp:       `{"data":[` + job3JSON + `,` + job2JSON + `,` + job1JSON + `],"meta":{"count":3}}`,
+		},
+		{
+			name:           "filter by creator",
+			query:          "?filter[created_by]=admin",
+			wantStatusCode: http.StatusOK,
+			wantResp:       `{"data":[` + job2JSON + `,` + job1JSON + `],"meta":{"count":2}}`,
+		},
+		{
+			name:           "filter by status",
+			query:          "?filter[status]=running,successful",
+			wantStatusCode: http.StatusOK,
+			wantResp:       `{"data":[` + job3JSON + `,` + job1JSON + `],"meta":{"count":2}}`,
+		},
+		{
+			name:           "pagination",
+			query:          "?page[limit]=1&page[offset]=1",
+			wantStatusCode: http.StatusOK,
+			wantResp:       `{"data":[` + job2JSON + `],"meta":{"count":3}}`,
+		},
+		{
+			name:           "no match",
+			query:          "?filter[created_by]=unknown",
+			wantStatusCode: http.StatusOK,
+			wantResp:       `{"data":[],"meta":{"count":0}}`,
+		},
+		{
+			name:           "filter by duration including running",
+			query:          "?filter[duration][gt]=60&include_running=true",
+			wantStatusCode: http.StatusOK,
+			wantResp:       `{"data":[` + job3JSON + `,` + job2JSON + `,` + job1JSON + `],"meta":{"count":3}}`,
+		},
+		{
+			name:           "filter by duration excludes running",
+			query:          "?filter[duration][gt]=60",
+			wantStatusCode: http.StatusOK,
+			wantResp:       `{"data":[],"meta":{"count":0}}`,
+		},
+		{
+			name:           "invalid duration",
+			query:          "?filter[duration][gt]=long",
+			wantStatusCode: http.StatusBadRequest,
+			wantResp:       `{"errors":[{"code":"","title":"invalid duration filter value \"long\", expected a number of seconds","detail":""}]}`,
+		},
+		{
+			name:           "unsupported filter",
+			query:          "?filter[interpreter]=cmd",
+			wantStatusCode: http.StatusBadRequest,
+			wantResp:       `{"errors":[{"code":"","title":"unsupported filter field 'interpreter'","detail":""}]}`,
+		},
+		{
+			name:           "invalid limit",
+			query:          "?page[limit]=1000",
+			wantStatusCode: http.StatusBadRequest,
+			wantResp:       `{"errors":[{"code":"","title":"invalid page[limit] \"1000\", expected a number from 1 to 500","detail":""}]}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/commands/multi"+tc.query, nil)
+
+			w := httptest.NewRecorder()
+			al.router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.wantStatusCode, w.Code)
+			assert.Equal(t, tc.wantResp, w.Body.String())
+		})
+	}
+}
+
+func TestHandleSearchCommands(t *testing.T) {
+	jp, err := jobs.NewSqliteProvider(":memory:", testLog)
+	require.NoError(t, err)
+	defer jp.Close()
+
+	t1 := time.Date(2020, 10, 10, 10, 10, 10, 0, time.UTC)
+	job1 := jb.New(t).JID("1111").ClientID("client-1").Command("uptime").StartedAt(t1).FinishedAt(t1.Add(time.Second)).Build()
+	job2 := jb.New(t).JID("2222").ClientID("client-2").Command("/usr/bin/uptime -p").StartedAt(t1.Add(time.Minute)).FinishedAt(t1.Add(2 * time.Minute)).Build()
+	job3 := jb.New(t).JID("3333").ClientID("client-1").Command("whoami").StartedAt(t1.Add(2 * time.Minute)).FinishedAt(t1.Add(3 * time.Minute)).Build()
+	for _, j := range []*models.Job{job1, job2, job3} {
+		require.NoError(t, jp.SaveJob(j))
+	}
+
+	admin := &users.User{
+		Username: "admin",
+		Groups:   []string{users.Administrators},
+	}
+	user := &users.User{
+		Username: "user",
+		Groups:   []string{"group-1"},
+	}
+	c1 := clients.New(t).ID("client-1").AllowedUserGroups([]string{"group-1"}).Build()
+	c2 := clients.New(t).ID("client-2").Build()
+
+	al := APIListener{
+		insecureForTests: true,
+		Logger:           testLog,
+		Server: &Server{
+			config: &Config{
+				Server: ServerConfig{MaxRequestBytes: 1024 * 1024},
+			},
+			jobProvider:   jp,
+			clientService: NewClientService(nil, clients.NewClientRepository([]*clients.Client{c1, c2}, &hour, testLog)),
+		},
+		userService: users.NewAPIService(users.NewStaticProvider([]*users.User{admin, user}), false),
+	}
+	al.initRouter()
+
+	job1JSON := `{"jid":"1111","status":"successful","finished_at":"2020-10-10T10:10:11Z","client_id":"client-1","command":"uptime","interpreter":"","created_by":"test-user","started_at":"2020-10-10T10:10:10Z"}`
+	job2JSON := `{"jid":"2222","status":"successful","finished_at":"2020-10-10T10:12:10Z","client_id":"client-2","command":"/usr/bin/uptime -p","interpreter":"","created_by":"test-user","started_at":"2020-10-10T10:11:10Z"}`
+
+	testCases := []struct {
+		name           string
+		user           string
+		query          string
+		wantStatusCode int
+		wantResp       string
+	}{
+		{
+			name:           "admin sees jobs of all clients",
+			user:           admin.Username,
+			query:          "?search=UPTIME",
+			wantStatusCode: http.StatusOK,
+			wantResp:       `{"data":[` + job2JSON + `,` + job1JSON + `],"meta":{"count":2}}`,
+		},
+		{
+			name:           "user sees jobs of allowed clients",
+			user:           user.Username,
+			query:          "?search=uptime",
+			wantStatusCode: http.StatusOK,
+			wantResp:       `{"data":[` + job1JSON + `],"meta":{"count":1}}`,
+		},
+		{
+			name:           "sort and pagination",
+			user:           admin.Username,
+			query:          "?search=uptime&sort=started_at&page[limit]=1",
+			wantStatusCode: http.StatusOK,
+			wantResp:       `{"data":[` + job1JSON + `],"meta":{"count":2}}`,
+		},
+		{
+			name:           "no match",
+			user:           admin.Username,
+			query:          "?search=unknown",
+			wantStatusCode: http.StatusOK,
+			wantResp:       `{"data":[],"meta":{"count":0}}`,
+		},
+		{
+			name:           "empty search",
+			user:           admin.Username,
+			query:          "?search=",
+			wantStatusCode: http.StatusBadRequest,
+			wantResp:       `{"errors":[{"code":"","title":"Param \"search\" cannot be empty.","detail":""}]}`,
+		},
+		{
+			name:           "unsupported sort",
+			user:           admin.Username,
+			query:          "?search=uptime&sort=duration",
+			wantStatusCode: http.StatusBadRequest,
+			wantResp:       `{"errors":[{"code":"","title":"unsupported sort field 'duration'","detail":""}]}`,
+		},
+		{
+			name:           "invalid limit",
+			user:           admin.Username,
+			query:          "?search=uptime&page[limit]=1000",
+			wantStatusCode: http.StatusBadRequest,
+			wantResp:       `{"errors":[{"code":"","title":"invalid page[limit] \"1000\", expected a number from 1 to 500","detail":""}]}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/commands"+tc.query, nil)
+			req = req.WithContext(api.WithUser(req.Context(), tc.user))
+
+			w := httptest.NewRecorder()
+			al.router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.wantStatusCode, w.Code)
+			assert.Equal(t, tc.wantResp, w.Body.String())
 		})
 	}
 }
@@ -1472,80 +3599,649 @@ func TestValidateInputClientGroup(t *testing.T) {
 			wantErr: errors.New("invalid group ID: max length 30, got 31"),
 		},
 	}
-	for _, tc := range testCases {
-		t.Run(tc.name, func(t *testing.T) {
-			// when
-			gotErr := validateInputClientGroup(cgroups.ClientGroup{ID: tc.groupID})
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// when
+			gotErr := validateInputClientGroup(cgroups.ClientGroup{ID: tc.groupID})
+
+			// then
+			assert.Equal(t, tc.wantErr, gotErr)
+		})
+	}
+}
+
+func TestHandleRefreshUpdatesStatus(t *testing.T) {
+	c1 := clients.New(t).Build()
+	c2 := clients.New(t).DisconnectedDuration(5 * time.Minute).Build()
+
+	testCases := []struct {
+		Name                   string
+		ClientID               string
+		Query                  string
+		SSHError               bool
+		ExpectedStatus         int
+		ExpectedRequestName    string
+		ExpectedRequestPayload string
+	}{
+		{
+			Name:                   "Connected client",
+			ClientID:               c1.ID,
+			ExpectedStatus:         http.StatusNoContent,
+			ExpectedRequestName:    comm.RequestTypeRefreshUpdatesStatus,
+			ExpectedRequestPayload: `{"force":false}`,
+		},
+		{
+			Name:                   "Forced refresh",
+			ClientID:               c1.ID,
+			Query:                  "?force=true",
+			ExpectedStatus:         http.StatusNoContent,
+			ExpectedRequestName:    comm.RequestTypeRefreshUpdatesStatus,
+			ExpectedRequestPayload: `{"force":true}`,
+		},
+		{
+			Name:           "Invalid force param",
+			ClientID:       c1.ID,
+			Query:          "?force=abc",
+			ExpectedStatus: http.StatusBadRequest,
+		},
+		{
+			Name:           "Disconnected client",
+			ClientID:       c2.ID,
+			ExpectedStatus: http.StatusNotFound,
+		},
+		{
+			Name:           "Non-existing client",
+			ClientID:       "non-existing-client",
+			ExpectedStatus: http.StatusNotFound,
+		},
+		{
+			Name:                "SSH error",
+			ClientID:            c1.ID,
+			SSHError:            true,
+			ExpectedRequestName: comm.RequestTypeRefreshUpdatesStatus,
+			ExpectedStatus:      http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			connMock := test.NewConnMock()
+			// by default set to return success
+			connMock.ReturnOk = !tc.SSHError
+			c1.Connection = connMock
+
+			al := APIListener{
+				insecureForTests: true,
+				Server: &Server{
+					clientService: NewClientService(nil, clients.NewClientRepository([]*clients.Client{c1, c2}, &hour, testLog)),
+					config:        &Config{},
+				},
+				Logger: testLog,
+			}
+			al.initRouter()
+
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/clients/%s/updates-status%s", tc.ClientID, tc.Query), nil)
+
+			w := httptest.NewRecorder()
+			al.router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.ExpectedStatus, w.Code)
+			if tc.ExpectedRequestName != "" {
+				name, _, payload := connMock.InputSendRequest()
+				assert.Equal(t, tc.ExpectedRequestName, name)
+				if tc.ExpectedRequestPayload != "" {
+					assert.JSONEq(t, tc.ExpectedRequestPayload, string(payload))
+				}
+			}
+		})
+	}
+}
+
+func TestHandleRefreshUpdatesStatusWait(t *testing.T) {
+	c1 := clients.New(t).Build()
+	freshStatus := &models.UpdatesStatus{
+		Refreshed:        time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC),
+		UpdatesAvailable: 3,
+		RebootPending:    true,
+	}
+
+	testCases := []struct {
+		Name           string
+		Query          string
+		ClientResponds bool
+		ExpectedStatus int
+		ExpectedJSON   string
+	}{
+		{
+			Name:           "fresh status returned",
+			Query:          "?wait=true",
+			ClientResponds: true,
+			ExpectedStatus: http.StatusOK,
+			ExpectedJSON: `{"data":{
+				"refreshed":"2021-06-01T12:00:00Z",
+				"updates_available":3,
+				"security_updates_available":0,
+				"update_summaries":null,
+				"reboot_pending":true
+			}}`,
+		},
+		{
+			Name:           "client does not respond in time",
+			Query:          "?wait=true&timeout_sec=1",
+			ExpectedStatus: http.StatusGatewayTimeout,
+			ExpectedJSON:   `{"errors":[{"code":"","title":"client did not return updates status within 1s","detail":""}]}`,
+		},
+		{
+			Name:           "invalid wait param",
+			Query:          "?wait=abc",
+			ExpectedStatus: http.StatusBadRequest,
+			ExpectedJSON:   `{"errors":[{"code":"","title":"Invalid wait param abc.","detail":""}]}`,
+		},
+		{
+			Name:           "invalid timeout param",
+			Query:          "?wait=true&timeout_sec=0",
+			ExpectedStatus: http.StatusBadRequest,
+			ExpectedJSON:   `{"errors":[{"code":"","title":"Invalid timeout_sec param 0.","detail":""}]}`,
+		},
+		{
+			Name:           "too big timeout param",
+			Query:          "?wait=true&timeout_sec=301",
+			ExpectedStatus: http.StatusBadRequest,
+			ExpectedJSON:   `{"errors":[{"code":"","title":"timeout_sec param can not be greater than 300.","detail":""}]}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			connMock := test.NewConnMock()
+			connMock.ReturnOk = true
+			connMock.DoneChannel = make(chan bool)
+			c1.Connection = connMock
+
+			al := APIListener{
+				insecureForTests: true,
+				Server: &Server{
+					clientService: NewClientService(nil, clients.NewClientRepository([]*clients.Client{c1}, &hour, testLog)),
+					config:        &Config{},
+				},
+				Logger: testLog,
+			}
+			al.initRouter()
+
+			// simulate the client sending its updates status after receiving the refresh request
+			if tc.ExpectedStatus != http.StatusBadRequest {
+				go func(responds bool) {
+					<-connMock.DoneChannel
+					if responds {
+						al.updatesStatusChans.Send(c1.ID, freshStatus)
+					}
+				}(tc.ClientResponds)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/clients/%s/updates-status%s", c1.ID, tc.Query), nil)
+			w := httptest.NewRecorder()
+			al.router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.ExpectedStatus, w.Code)
+			assert.JSONEq(t, tc.ExpectedJSON, w.Body.String())
+			if tc.ExpectedStatus != http.StatusBadRequest {
+				name, _, _ := connMock.InputSendRequest()
+				assert.Equal(t, comm.RequestTypeRefreshUpdatesStatus, name)
+			}
+		})
+	}
+}
+
+func TestHandleGetClientsByGroup(t *testing.T) {
+	admin := &users.User{
+		Username: "admin",
+		Groups:   []string{users.Administrators},
+	}
+	operator := &users.User{
+		Username: "operator",
+		Groups:   []string{"operators"},
+	}
+	c1 := clients.New(t).ID("client-1").AllowedUserGroups([]string{"operators"}).Build()
+	c1.Tags = []string{"web"}
+	c2 := clients.New(t).ID("client-2").AllowedUserGroups([]string{"operators"}).Build()
+	c2.Tags = []string{"db"}
+	c3 := clients.New(t).ID("client-3").Build()
+	c3.Tags = []string{"web"}
+
+	gp, err := cgroups.NewSqliteProvider(":memory:")
+	require.NoError(t, err)
+	defer gp.Close()
+	ctx := context.Background()
+	require.NoError(t, gp.Create(ctx, &cgroups.ClientGroup{
+		ID:     "static",
+		Params: &cgroups.ClientParams{ClientID: &cgroups.ParamValues{"client-1", "client-2"}},
+	}))
+	require.NoError(t, gp.Create(ctx, &cgroups.ClientGroup{
+		ID:     "web",
+		Params: &cgroups.ClientParams{ClientID: &cgroups.ParamValues{"client-*"}, Tag: &cgroups.ParamValues{"web"}},
+	}))
+
+	al := APIListener{
+		insecureForTests: true,
+		Server: &Server{
+			clientService:       NewClientService(nil, clients.NewClientRepository([]*clients.Client{c1, c2, c3}, &hour, testLog)),
+			clientGroupProvider: gp,
+			config: &Config{
+				Server: ServerConfig{MaxRequestBytes: 1024 * 1024},
+			},
+		},
+		userService: users.NewAPIService(users.NewStaticProvider([]*users.User{admin, operator}), false),
+		Logger:      testLog,
+	}
+	al.initRouter()
+
+	testCases := []struct {
+		name string
+
+		user  string
+		group string
+
+		wantStatusCode int
+		wantClientIDs  []string
+		wantErrTitle   string
+	}{
+		{
+			name:           "static members",
+			user:           admin.Username,
+			group:          "static",
+			wantStatusCode: http.StatusOK,
+			wantClientIDs:  []string{"client-1", "client-2"},
+		},
+		{
+			name:           "dynamic members",
+			user:           admin.Username,
+			group:          "web",
+			wantStatusCode: http.StatusOK,
+			wantClientIDs:  []string{"client-1", "client-3"},
+		},
+		{
+			name:           "dynamic members, limited access",
+			user:           operator.Username,
+			group:          "web",
+			wantStatusCode: http.StatusOK,
+			wantClientIDs:  []string{"client-1"},
+		},
+		{
+			name:           "unknown group",
+			user:           admin.Username,
+			group:          "unknown",
+			wantStatusCode: http.StatusNotFound,
+			wantErrTitle:   `Client Group[id="unknown"] not found.`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/api/v1/clients?group="+tc.group, nil)
+			req = req.WithContext(api.WithUser(context.Background(), tc.user))
+
+			al.router.ServeHTTP(w, req)
+
+			require.Equal(t, tc.wantStatusCode, w.Code)
+			if tc.wantErrTitle != "" {
+				wantResp := api.NewErrAPIPayloadFromMessage("", tc.wantErrTitle, "")
+				wantRespBytes, err := json.Marshal(wantResp)
+				require.NoError(t, err)
+				assert.Equal(t, string(wantRespBytes), w.Body.String())
+				return
+			}
+			var gotResp struct {
+				Data []ClientPayload `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &gotResp))
+			var gotClientIDs []string
+			for _, cur := range gotResp.Data {
+				gotClientIDs = append(gotClientIDs, cur.ID)
+			}
+			assert.ElementsMatch(t, tc.wantClientIDs, gotClientIDs)
+		})
+	}
+}
+
+func TestHandleGetClientsByStaleUpdatesStatus(t *testing.T) {
+	c1 := clients.New(t).ID("client-recent").Build()
+	c1.UpdatesStatus = &models.UpdatesStatus{Refreshed: time.Now().Add(-time.Hour)}
+	c2 := clients.New(t).ID("client-stale").Build()
+	c2.UpdatesStatus = &models.UpdatesStatus{Refreshed: time.Now().Add(-3 * 24 * time.Hour)}
+	c3 := clients.New(t).ID("client-never").Build()
+
+	al := APIListener{
+		insecureForTests: true,
+		Server: &Server{
+			clientService: NewClientService(nil, clients.NewClientRepository([]*clients.Client{c1, c2, c3}, &hour, testLog)),
+			config: &Config{
+				Server: ServerConfig{MaxRequestBytes: 1024 * 1024},
+			},
+		},
+		userService: users.NewAPIService(users.NewStaticProvider([]*users.User{{Username: "admin", Groups: []string{users.Administrators}}}), false),
+		Logger:      testLog,
+	}
+	al.initRouter()
+
+	testCases := []struct {
+		name      string
+		olderThan string
+
+		wantStatusCode int
+		wantClientIDs  []string
+		wantErrTitle   string
+	}{
+		{
+			name:           "one day",
+			olderThan:      "24h",
+			wantStatusCode: http.StatusOK,
+			wantClientIDs:  []string{"client-stale", "client-never"},
+		},
+		{
+			name:           "ten minutes",
+			olderThan:      "10m",
+			wantStatusCode: http.StatusOK,
+			wantClientIDs:  []string{"client-recent", "client-stale", "client-never"},
+		},
+		{
+			name:           "one week",
+			olderThan:      "168h",
+			wantStatusCode: http.StatusOK,
+			wantClientIDs:  []string{"client-never"},
+		},
+		{
+			name:           "invalid",
+			olderThan:      "1day",
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   `Invalid updates_status_older_than value "1day", expected a duration like 24h.`,
+		},
+		{
+			name:           "negative",
+			olderThan:      "-1h",
+			wantStatusCode: http.StatusBadRequest,
+			wantErrTitle:   `Invalid updates_status_older_than value "-1h", expected a duration like 24h.`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/api/v1/clients?updates_status_older_than="+tc.olderThan, nil)
+			req = req.WithContext(api.WithUser(context.Background(), "admin"))
+
+			al.router.ServeHTTP(w, req)
+
+			require.Equal(t, tc.wantStatusCode, w.Code)
+			if tc.wantErrTitle != "" {
+				wantResp := api.NewErrAPIPayloadFromMessage("", tc.wantErrTitle, "")
+				wantRespBytes, err := json.Marshal(wantResp)
+				require.NoError(t, err)
+				assert.JSONEq(t, string(wantRespBytes), w.Body.String())
+				return
+			}
+			var gotResp struct {
+				Data []ClientPayload `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &gotResp))
+			var gotClientIDs []string
+			for _, cur := range gotResp.Data {
+				gotClientIDs = append(gotClientIDs, cur.ID)
+			}
+			assert.ElementsMatch(t, tc.wantClientIDs, gotClientIDs)
+		})
+	}
+}
+
+func TestHandleParkedClients(t *testing.T) {
+	c1 := clients.New(t).ID("client-active").Build()
+	c2 := clients.New(t).ID("client-lost").DisconnectedDuration(2 * time.Hour).Build()
+	repo := clients.NewClientRepository([]*clients.Client{c1, c2}, &hour, testLog)
+	repo.ParkLostClients = true
+	parked, err := repo.ParkObsolete(0)
+	require.NoError(t, err)
+	require.Len(t, parked, 1)
+
+	al := APIListener{
+		insecureForTests: true,
+		Server: &Server{
+			clientService: NewClientService(nil, repo),
+			config: &Config{
+				Server: ServerConfig{MaxRequestBytes: 1024 * 1024},
+			},
+		},
+		userService: users.NewAPIService(users.NewStaticProvider([]*users.User{{Username: "admin", Groups: []string{users.Administrators}}}), false),
+		Logger:      testLog,
+	}
+	al.initRouter()
 
-			// then
-			assert.Equal(t, tc.wantErr, gotErr)
-		})
+	getClients := func(t *testing.T, url string) []ClientPayload {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		req = req.WithContext(api.WithUser(context.Background(), "admin"))
+		al.router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var gotResp struct {
+			Data []ClientPayload `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &gotResp))
+		return gotResp.Data
+	}
+	unpark := func(t *testing.T, clientID string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/clients/%s/unpark", clientID), nil)
+		req = req.WithContext(api.WithUser(context.Background(), "admin"))
+		al.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// parked clients are hidden by default
+	gotClients := getClients(t, "/api/v1/clients")
+	require.Len(t, gotClients, 1)
+	assert.Equal(t, "client-active", gotClients[0].ID)
+
+	gotClients = getClients(t, "/api/v1/clients?state=parked")
+	require.Len(t, gotClients, 1)
+	assert.Equal(t, "client-lost", gotClients[0].ID)
+	assert.Equal(t, clients.Parked, gotClients[0].ConnectionState)
+	assert.NotNil(t, gotClients[0].ParkedAt)
+
+	// invalid state
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/clients?state=lost", nil)
+	req = req.WithContext(api.WithUser(context.Background(), "admin"))
+	al.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	wantResp := api.NewErrAPIPayloadFromMessage("", `Invalid state value "lost", expected "parked".`, "")
+	wantRespBytes, err := json.Marshal(wantResp)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(wantRespBytes), w.Body.String())
+
+	// not parked client
+	w = unpark(t, "client-active")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	wantResp = api.NewErrAPIPayloadFromMessage("", `Parked client with id="client-active" not found.`, "")
+	wantRespBytes, err = json.Marshal(wantResp)
+	require.NoError(t, err)
+	assert.JSONEq(t, string(wantRespBytes), w.Body.String())
+
+	// restore the parked client
+	w = unpark(t, "client-lost")
+	require.Equal(t, http.StatusOK, w.Code)
+	var gotResp struct {
+		Data ClientPayload `json:"data"`
 	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &gotResp))
+	assert.Equal(t, "client-lost", gotResp.Data.ID)
+	assert.Equal(t, clients.Disconnected, gotResp.Data.ConnectionState)
+	assert.Nil(t, gotResp.Data.ParkedAt)
+
+	gotClients = getClients(t, "/api/v1/clients")
+	assert.Len(t, gotClients, 2)
+	gotClients = getClients(t, "/api/v1/clients?state=parked")
+	assert.Empty(t, gotClients)
 }
 
-func TestHandleRefreshUpdatesStatus(t *testing.T) {
-	c1 := clients.New(t).Build()
-	c2 := clients.New(t).DisconnectedDuration(5 * time.Minute).Build()
+func TestHandleGetClientConfig(t *testing.T) {
+	curUser := &users.User{
+		Username: "admin",
+		Groups:   []string{users.Administrators},
+	}
+	c1 := clients.New(t).ID("client-1").DisconnectedDuration(5 * time.Minute).AllowedUserGroups([]string{"operators"}).Build()
+	c1.Tags = []string{"web"}
+	c1.Environment = "production"
+	c2 := clients.New(t).ID("client-2").Build()
+
+	gp, err := cgroups.NewSqliteProvider(":memory:")
+	require.NoError(t, err)
+	defer gp.Close()
+	ctx := context.Background()
+	require.NoError(t, gp.Create(ctx, &cgroups.ClientGroup{
+		ID:     "web",
+		Params: &cgroups.ClientParams{Tag: &cgroups.ParamValues{"web"}},
+	}))
+	require.NoError(t, gp.Create(ctx, &cgroups.ClientGroup{
+		ID:     "db",
+		Params: &cgroups.ClientParams{Tag: &cgroups.ParamValues{"db"}},
+	}))
+
+	clientService := NewClientService(nil, clients.NewClientRepository([]*clients.Client{c1, c2}, &hour, testLog))
+	conflict := &TunnelConflict{ClientID: "client-1", LocalPort: "4000", Remote: "127.0.0.1:80", OwnerClientID: "client-2", Error: "Local port 4000 already in use."}
+	clientService.tunnelConflicts.Add(conflict)
+	clientService.tunnelConflicts.Add(&TunnelConflict{ClientID: "client-2", LocalPort: "5000", Remote: "127.0.0.1:22"})
+	al := APIListener{
+		insecureForTests: true,
+		Server: &Server{
+			clientService:       clientService,
+			clientGroupProvider: gp,
+			config: &Config{
+				Server: ServerConfig{MaxRequestBytes: 1024 * 1024},
+			},
+		},
+		userService: users.NewAPIService(users.NewStaticProvider([]*users.User{curUser}), false),
+		Logger:      testLog,
+	}
+	al.initRouter()
+
+	t.Run("existing client", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/api/v1/clients/client-1/config", nil)
+		req = req.WithContext(api.WithUser(ctx, curUser.Username))
+
+		al.router.ServeHTTP(w, req)
+
+		require.Equal(t, http.StatusOK, w.Code)
+		var gotResp struct {
+			Data ClientConfigPayload `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &gotResp))
+		got := gotResp.Data
+		// client-reported
+		assert.Equal(t, "client-1", got.Client.ID)
+		assert.Equal(t, []string{"web"}, got.Client.Tags)
+		assert.Equal(t, "production", got.Client.Environment)
+		// server-applied
+		assert.Equal(t, []string{"operators"}, got.Client.AllowedUserGroups)
+		assert.Equal(t, clients.Disconnected, got.Client.ConnectionState)
+		assert.Equal(t, []string{"web"}, got.Groups)
+		require.NotNil(t, got.KeepDisconnectedSec)
+		assert.EqualValues(t, hour.Seconds(), *got.KeepDisconnectedSec)
+		require.NotNil(t, got.ObsoleteAt)
+		assert.True(t, c1.DisconnectedAt.Add(hour).Equal(*got.ObsoleteAt))
+		require.Len(t, got.TunnelConflicts, 1)
+		assert.Equal(t, conflict.LocalPort, got.TunnelConflicts[0].LocalPort)
+		assert.Equal(t, conflict.OwnerClientID, got.TunnelConflicts[0].OwnerClientID)
+	})
+
+	t.Run("unknown client", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/api/v1/clients/unknown/config", nil)
+		req = req.WithContext(api.WithUser(ctx, curUser.Username))
+
+		al.router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestHandlePostClientsTags(t *testing.T) {
+	curUser := &users.User{
+		Username: "admin",
+		Groups:   []string{users.Administrators},
+	}
+	connMock1 := test.NewConnMock()
+	connMock1.ReturnOk = true
+	connMock1.ReturnResponsePayload = []byte(`{"tags":["Linux","web"]}`)
+	connMock3 := test.NewConnMock()
+	connMock3.ReturnOk = true
 
 	testCases := []struct {
-		Name                string
-		ClientID            string
-		SSHError            bool
-		ExpectedStatus      int
-		ExpectedRequestName string
+		name        string
+		url         string
+		requestBody string
+
+		wantStatusCode int
+		wantResp       string
+		wantC1Tags     []string
 	}{
 		{
-			Name:                "Connected client",
-			ClientID:            c1.ID,
-			ExpectedStatus:      http.StatusNoContent,
-			ExpectedRequestName: comm.RequestTypeRefreshUpdatesStatus,
-		},
-		{
-			Name:           "Disconnected client",
-			ClientID:       c2.ID,
-			ExpectedStatus: http.StatusNotFound,
+			name:           "add tag to matching clients",
+			url:            "/api/v1/clients/tags?filter[os_version]=20.04",
+			requestBody:    `{"add":["web"],"remove":["Datacenter 1"]}`,
+			wantStatusCode: http.StatusOK,
+			wantResp:       `{"data":[{"client_id":"client-1","tags":["Linux","web"]}]}`,
+			wantC1Tags:     []string{"Linux", "web"},
 		},
 		{
-			Name:           "Non-existing client",
-			ClientID:       "non-existing-client",
-			ExpectedStatus: http.StatusNotFound,
+			name:           "no filter",
+			url:            "/api/v1/clients/tags",
+			requestBody:    `{"add":["web"]}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantResp:       `{"errors":[{"code":"","title":"At least one filter should be specified.","detail":""}]}`,
+			wantC1Tags:     []string{"Linux", "Datacenter 1"},
 		},
 		{
-			Name:                "SSH error",
-			ClientID:            c1.ID,
-			SSHError:            true,
-			ExpectedRequestName: comm.RequestTypeRefreshUpdatesStatus,
-			ExpectedStatus:      http.StatusInternalServerError,
+			name:           "invalid tag",
+			url:            "/api/v1/clients/tags?filter[os_version]=20.04",
+			requestBody:    `{"add":["web;rm"]}`,
+			wantStatusCode: http.StatusBadRequest,
+			wantResp:       `{"errors":[{"code":"","title":"tag \"web;rm\" is invalid: only letters, digits, spaces and '_.:/@-' are allowed","detail":""}]}`,
+			wantC1Tags:     []string{"Linux", "Datacenter 1"},
 		},
 	}
 
 	for _, tc := range testCases {
-		t.Run(tc.Name, func(t *testing.T) {
-			connMock := test.NewConnMock()
-			// by default set to return success
-			connMock.ReturnOk = !tc.SSHError
-			c1.Connection = connMock
-
+		t.Run(tc.name, func(t *testing.T) {
+			c1 := clients.New(t).ID("client-1").Connection(connMock1).Build()
+			c1.OSVersion = "20.04"
+			c2 := clients.New(t).ID("client-2").DisconnectedDuration(time.Minute).Build()
+			c2.OSVersion = "20.04"
+			c3 := clients.New(t).ID("client-3").Connection(connMock3).Build()
 			al := APIListener{
 				insecureForTests: true,
 				Server: &Server{
-					clientService: NewClientService(nil, clients.NewClientRepository([]*clients.Client{c1, c2}, &hour, testLog)),
-					config:        &Config{},
+					clientService: NewClientService(nil, clients.NewClientRepository([]*clients.Client{c1, c2, c3}, &hour, testLog)),
+					config: &Config{
+						Server: ServerConfig{MaxRequestBytes: 1024 * 1024},
+					},
 				},
-				Logger: testLog,
+				userService: users.NewAPIService(users.NewStaticProvider([]*users.User{curUser}), false),
+				Logger:      testLog,
 			}
 			al.initRouter()
 
-			req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/v1/clients/%s/updates-status", tc.ClientID), nil)
-
+			req := httptest.NewRequest(http.MethodPost, tc.url, strings.NewReader(tc.requestBody))
+			req = req.WithContext(api.WithUser(context.Background(), curUser.Username))
 			w := httptest.NewRecorder()
 			al.router.ServeHTTP(w, req)
 
-			assert.Equal(t, tc.ExpectedStatus, w.Code)
-			if tc.ExpectedRequestName != "" {
-				name, _, _ := connMock.InputSendRequest()
-				assert.Equal(t, tc.ExpectedRequestName, name)
-			}
+			assert.Equal(t, tc.wantStatusCode, w.Code)
+			assert.JSONEq(t, tc.wantResp, w.Body.String())
+			assert.Equal(t, tc.wantC1Tags, c1.Tags)
+			assert.Equal(t, []string{"Linux", "Datacenter 1"}, c2.Tags)
+			assert.Equal(t, []string{"Linux", "Datacenter 1"}, c3.Tags)
+			name, _, _ := connMock3.InputSendRequest()
+			assert.Empty(t, name)
 		})
 	}
 }
@@ -1601,6 +4297,7 @@ func TestHandleGetClient(t *testing.T) {
         "os_kernel":"linux",
         "os_version":"18.0",
         "os_virtualization_role":"guest",
+        "os_raw":null,
         "os_virtualization_system":"LVM",
         "hostname":"alpine-3-10-tk-01",
         "ipv4":[
@@ -1613,6 +4310,10 @@ func TestHandleGetClient(t *testing.T) {
             "Linux",
             "Datacenter 1"
         ],
+        "environment":"",
+        "commands_disabled":false,
+        "package_manager":"",
+        "interpreters":null,
         "version":"0.1.12",
         "address":"88.198.189.161:50078",
         "timezone":"UTC-0",
@@ -1622,6 +4323,7 @@ func TestHandleGetClient(t *testing.T) {
                 "lport":"2222",
                 "rhost":"0.0.0.0",
                 "rport":"22",
+                "protocol":"tcp",
                 "lport_random":false,
                 "scheme":null,
                 "acl":null,
@@ -1633,6 +4335,7 @@ func TestHandleGetClient(t *testing.T) {
                 "lport":"4000",
                 "rhost":"0.0.0.0",
                 "rport":"80",
+                "protocol":"tcp",
                 "lport_random":false,
                 "scheme":null,
                 "acl":null,
@@ -1646,9 +4349,16 @@ func TestHandleGetClient(t *testing.T) {
         "cpu_model_name":"",
         "cpu_vendor":"GenuineIntel",
         "disconnected_at":null,
+        "disconnect_reason":"",
+        "parked_at":null,
         "client_auth_id":"user1",
         "allowed_user_groups":null,
-        "updates_status":null
+        "auto_tags":null,
+        "updates_status":null,
+        "health":"",
+        "health_status":null,
+        "boot_time":null,
+        "previous_boot_time":null
     }
 }`
 			assert.Equal(t, tc.ExpectedStatus, w.Code)
@@ -1766,7 +4476,7 @@ func TestWrapWithAuthMiddleware(t *testing.T) {
 			config: &Config{},
 		},
 	}
-	jwt, err := al.createAuthToken(time.Hour, user.Username)
+	jwt, err := al.createAuthToken(httptest.NewRequest("GET", "/api/v1/login", nil), time.Hour, user.Username)
 	require.NoError(t, err)
 
 	testCases := []struct {
@@ -1866,3 +4576,318 @@ func TestWrapWithAuthMiddleware(t *testing.T) {
 		})
 	}
 }
+
+func TestPostTOTP(t *testing.T) {
+	secret, err := security.NewTOTPSecret()
+	require.NoError(t, err)
+	user := &users.User{
+		Username:   "test-user",
+		Password:   "$2y$05$cIOk1IlsdgdUeZpV464d6OXKI1tF2Yc3MWo55xDu4XhopEJmGb2KC",
+		TOTPSecret: &secret,
+	}
+	currentCode, err := security.TOTPCode(secret, time.Now())
+	require.NoError(t, err)
+
+	testCases := []struct {
+		Name               string
+		TwoFATokenDelivery string
+		RequestBody        string
+		ExpectedStatus     int
+		ExpectedBanned     bool
+	}{
+		{
+			Name:               "valid password",
+			TwoFATokenDelivery: "totp",
+			RequestBody:        `{"password": "foobaz"}`,
+			ExpectedStatus:     http.StatusOK,
+		},
+		{
+			Name:               "current code",
+			TwoFATokenDelivery: "totp",
+			RequestBody:        `{"token": "` + currentCode + `"}`,
+			ExpectedStatus:     http.StatusOK,
+		},
+		{
+			Name:               "invalid password",
+			TwoFATokenDelivery: "totp",
+			RequestBody:        `{"password": "wrong"}`,
+			ExpectedStatus:     http.StatusUnauthorized,
+			ExpectedBanned:     true,
+		},
+		{
+			Name:               "invalid code",
+			TwoFATokenDelivery: "totp",
+			RequestBody:        `{"token": "000000"}`,
+			ExpectedStatus:     http.StatusUnauthorized,
+			ExpectedBanned:     true,
+		},
+		{
+			Name:               "no password or code",
+			TwoFATokenDelivery: "totp",
+			RequestBody:        `{}`,
+			ExpectedStatus:     http.StatusBadRequest,
+		},
+		{
+			Name:               "totp disabled",
+			TwoFATokenDelivery: "smtp",
+			RequestBody:        `{"password": "foobaz"}`,
+			ExpectedStatus:     http.StatusConflict,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			mockUsersService := &MockUsersService{
+				UserService: users.NewAPIService(users.NewStaticProvider([]*users.User{user}), false),
+			}
+			al := APIListener{
+				insecureForTests: true,
+				Server: &Server{
+					config: &Config{
+						API: APIConfig{
+							TwoFATokenDelivery: tc.TwoFATokenDelivery,
+						},
+						Server: ServerConfig{MaxRequestBytes: 1024 * 1024},
+					},
+				},
+				userService: mockUsersService,
+				twoFASrv:    NewTOTPTwoFAService(600, mockUsersService),
+				bannedUsers: security.NewBanList(time.Minute),
+			}
+			al.initRouter()
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("POST", "/api/v1/me/totp", strings.NewReader(tc.RequestBody))
+			ctx := api.WithUser(req.Context(), user.Username)
+			req = req.WithContext(ctx)
+			al.router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.ExpectedStatus, w.Code)
+			assert.Equal(t, tc.ExpectedBanned, al.bannedUsers.IsBanned(user.Username))
+			if tc.ExpectedStatus != http.StatusOK {
+				assert.Nil(t, mockUsersService.ChangeUser)
+				return
+			}
+
+			var resp struct {
+				Data postTOTPResponse `json:"data"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, security.TOTPURI("Rport", user.Username, resp.Data.Secret), resp.Data.URI)
+			require.Len(t, resp.Data.RecoveryCodes, 10)
+
+			hashes := make([]string, 0, len(resp.Data.RecoveryCodes))
+			for _, code := range resp.Data.RecoveryCodes {
+				hashes = append(hashes, hashRecoveryCode(code))
+			}
+			assert.Equal(t, user.Username, mockUsersService.ChangeUsername)
+			assert.Equal(t, &users.User{
+				TOTPSecret:        &resp.Data.Secret,
+				TOTPRecoveryCodes: users.Token(strings.Join(hashes, ",")),
+			}, mockUsersService.ChangeUser)
+		})
+	}
+}
+
+func TestTOTPLogin(t *testing.T) {
+	secret, err := security.NewTOTPSecret()
+	require.NoError(t, err)
+	enrolledUser := &users.User{
+		Username:   "enrolled",
+		Password:   "$2y$05$cIOk1IlsdgdUeZpV464d6OXKI1tF2Yc3MWo55xDu4XhopEJmGb2KC",
+		TOTPSecret: &secret,
+	}
+	notEnrolledUser := &users.User{
+		Username: "not-enrolled",
+		Password: "$2y$05$cIOk1IlsdgdUeZpV464d6OXKI1tF2Yc3MWo55xDu4XhopEJmGb2KC",
+	}
+	mockUsersService := &MockUsersService{
+		UserService: users.NewAPIService(users.NewStaticProvider([]*users.User{enrolledUser, notEnrolledUser}), false),
+	}
+	al := APIListener{
+		apiSessionRepo: NewAPISessionRepository(),
+		Server: &Server{
+			config: &Config{
+				API: APIConfig{
+					TwoFATokenDelivery: "totp",
+				},
+				Server: ServerConfig{MaxRequestBytes: 1024 * 1024},
+			},
+		},
+		userService: mockUsersService,
+		twoFASrv:    NewTOTPTwoFAService(600, mockUsersService),
+		bannedUsers: security.NewBanList(0),
+	}
+	al.initRouter()
+
+	login := func(t *testing.T, username string) *twoFAResponse {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/api/v1/login", strings.NewReader(`{"username": "`+username+`", "password": "foobaz"}`))
+		req.Header.Set("Content-Type", "application/json")
+		al.router.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var resp struct {
+			Data loginResponse `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+		assert.Nil(t, resp.Data.Token)
+		require.NotNil(t, resp.Data.TwoFA)
+		assert.Equal(t, "totp", resp.Data.TwoFA.DeliveryMethod)
+		assert.NotEmpty(t, resp.Data.TwoFA.LoginToken)
+		return resp.Data.TwoFA
+	}
+	post := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		al.router.ServeHTTP(w, httptest.NewRequest("POST", path, strings.NewReader(body)))
+		return w
+	}
+
+	t.Run("enrolled user", func(t *testing.T) {
+		twoFA := login(t, enrolledUser.Username)
+		assert.False(t, twoFA.TOTPEnrollmentRequired)
+		code, err := security.TOTPCode(secret, time.Now())
+		require.NoError(t, err)
+
+		w := post("/api/v1/verify-2fa", `{"username": "enrolled", "token": "`+code+`"}`)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, "login token is required")
+
+		w = post("/api/v1/verify-2fa", `{"username": "not-enrolled", "token": "`+code+`", "login_token": "`+twoFA.LoginToken+`"}`)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, "login token of another user")
+
+		w = post("/api/v1/login/totp", `{"username": "enrolled", "login_token": "`+twoFA.LoginToken+`"}`)
+		assert.Equal(t, http.StatusConflict, w.Code, "enrolled app can't be replaced without the current code")
+
+		w = post("/api/v1/verify-2fa", `{"username": "enrolled", "token": "`+code+`", "login_token": "`+twoFA.LoginToken+`"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), `"token":"`)
+
+		w = post("/api/v1/verify-2fa", `{"username": "enrolled", "token": "`+code+`", "login_token": "`+twoFA.LoginToken+`"}`)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, "login token is valid only once")
+
+		twoFA = login(t, enrolledUser.Username)
+		w = post("/api/v1/verify-2fa", `{"username": "enrolled", "token": "`+code+`", "login_token": "`+twoFA.LoginToken+`"}`)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, "code is valid only once")
+		assert.Contains(t, w.Body.String(), "token has already been used")
+	})
+
+	t.Run("too many invalid codes", func(t *testing.T) {
+		twoFA := login(t, enrolledUser.Username)
+		for i := 0; i < totpMaxFailedAttempts; i++ {
+			w := post("/api/v1/verify-2fa", `{"username": "enrolled", "token": "000000", "login_token": "`+twoFA.LoginToken+`"}`)
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+		}
+		assert.Error(t, al.twoFASrv.checkTOTPLogin(enrolledUser.Username, twoFA.LoginToken), "pending login is discarded")
+	})
+
+	t.Run("not enrolled user", func(t *testing.T) {
+		twoFA := login(t, notEnrolledUser.Username)
+		assert.True(t, twoFA.TOTPEnrollmentRequired)
+
+		w := post("/api/v1/login/totp", `{"username": "not-enrolled", "login_token": "invalid"}`)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		w = post("/api/v1/login/totp", `{"username": "not-enrolled", "login_token": "`+twoFA.LoginToken+`"}`)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, notEnrolledUser.Username, mockUsersService.ChangeUsername)
+		require.NotNil(t, mockUsersService.ChangeUser)
+		assert.NotNil(t, mockUsersService.ChangeUser.TOTPSecret)
+	})
+}
+
+type fakeAuthenticator struct {
+	passwords map[string]string
+	err       error
+}
+
+func (a *fakeAuthenticator) Authenticate(username, password string) (*users.User, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+	if pwd, ok := a.passwords[username]; !ok || pwd != password {
+		return nil, nil
+	}
+	return &users.User{Username: username}, nil
+}
+
+func TestWrapWithAuthMiddlewareAuthenticator(t *testing.T) {
+	// stored password and token are ignored when passwords are verified by the authenticator
+	user := &users.User{
+		Username: "user1",
+		Password: "$2y$05$ep2DdPDeLDDhwRrED9q/vuVEzRpZtB5WHCFT7YbcmH9r9oNmlsZOm",
+		Token:    ptr.String("$2y$05$/D7g/d0sDkNSOh.e6Jzc9OWClcpZ1ieE8Dx.WUaWgayd3Ab0rRdxu"),
+	}
+
+	testCases := []struct {
+		Name           string
+		Password       string
+		AuthErr        error
+		ExpectedStatus int
+	}{
+		{
+			Name:           "valid directory password",
+			Password:       "ldap-pwd",
+			ExpectedStatus: http.StatusOK,
+		},
+		{
+			Name:           "wrong password",
+			Password:       "wrong",
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:           "stored password",
+			Password:       "pwd",
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:           "stored token",
+			Password:       "token",
+			ExpectedStatus: http.StatusUnauthorized,
+		},
+		{
+			Name:           "directory unavailable",
+			Password:       "ldap-pwd",
+			AuthErr:        errors.New("connection refused"),
+			ExpectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			al := APIListener{
+				Logger:         testLog,
+				apiSessionRepo: NewAPISessionRepository(),
+				bannedUsers:    security.NewBanList(0),
+				userService:    users.NewAPIService(users.NewStaticProvider([]*users.User{user}), false),
+				authenticator: &fakeAuthenticator{
+					passwords: map[string]string{user.Username: "ldap-pwd"},
+					err:       tc.AuthErr,
+				},
+				Server: &Server{
+					config: &Config{},
+				},
+			}
+
+			handler := al.wrapWithAuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, user.Username, api.GetUser(r.Context(), nil))
+			}))
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest("GET", "/some-endpoint", nil)
+			req.SetBasicAuth(user.Username, tc.Password)
+
+			handler(w, req)
+
+			assert.Equal(t, tc.ExpectedStatus, w.Code)
+
+			authorized, err := al.validateCredentials(user.Username, tc.Password)
+			assert.Equal(t, tc.ExpectedStatus == http.StatusOK, authorized)
+			if tc.AuthErr != nil {
+				assert.EqualError(t, err, "failed to authenticate user: connection refused")
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package chserver
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/cloudradar-monitoring/rport/server/api"
+	errors2 "github.com/cloudradar-monitoring/rport/server/api/errors"
+	"github.com/cloudradar-monitoring/rport/share/security"
+)
+
+const totpIssuer = "Rport"
+
+type postTOTPResponse struct {
+	Secret        string   `json:"secret"`
+	URI           string   `json:"uri"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// startTOTPLogin responds to a login with a valid password with a login token that is required to verify the code
+// of the authenticator app. Users who haven't enrolled an authenticator app yet, have to enroll it first.
+func (al *APIListener) startTOTPLogin(username string, w http.ResponseWriter) {
+	totpEnrolled, err := al.isTOTPEnrolled(username)
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	loginToken, err := al.twoFASrv.StartTOTPLogin(username)
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(loginResponse{
+		TwoFA: &twoFAResponse{
+			DeliveryMethod:         al.twoFASrv.DeliveryMethod(),
+			LoginToken:             loginToken,
+			TOTPEnrollmentRequired: !totpEnrolled,
+		},
+	}))
+}
+
+// handlePostLoginTOTP enrolls an authenticator app during a login of a user who hasn't enrolled one yet.
+func (al *APIListener) handlePostLoginTOTP(w http.ResponseWriter, req *http.Request) {
+	if !al.config.API.IsTOTPOn() {
+		al.jsonErrorResponseWithTitle(w, http.StatusConflict, "totp is disabled")
+		return
+	}
+
+	var reqBody struct {
+		Username   string `json:"username"`
+		LoginToken string `json:"login_token"`
+	}
+	if err := parseRequestBody(req.Body, &reqBody); err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	if al.bannedUsers.IsBanned(reqBody.Username) {
+		al.jsonErrorResponseWithTitle(w, http.StatusTooManyRequests, ErrTooManyRequests.Error())
+		return
+	}
+
+	secret, recoveryCodes, err := al.twoFASrv.EnrollTOTPLogin(reqBody.Username, reqBody.LoginToken)
+	if err != nil {
+		var apiErr errors2.APIError
+		if errors.As(err, &apiErr) && apiErr.HTTPStatus == http.StatusUnauthorized {
+			if !al.handleBannedIPs(w, req, false) {
+				return
+			}
+			al.bannedUsers.Add(reqBody.Username)
+		}
+		al.jsonError(w, err)
+		return
+	}
+
+	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(postTOTPResponse{
+		Secret:        secret,
+		URI:           security.TOTPURI(totpIssuer, reqBody.Username, secret),
+		RecoveryCodes: recoveryCodes,
+	}))
+}
+
+// handlePostTOTP enrolls a new authenticator app for the current user. It requires the password or the current code
+// of the enrolled authenticator app, so a stolen session can't replace it.
+func (al *APIListener) handlePostTOTP(w http.ResponseWriter, req *http.Request) {
+	if !al.config.API.IsTOTPOn() {
+		al.jsonErrorResponseWithTitle(w, http.StatusConflict, "totp is disabled")
+		return
+	}
+
+	curUser, err := al.getUserModelForAuth(req.Context())
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	var reqBody struct {
+		Password string `json:"password"`
+		Token    string `json:"token"`
+	}
+	if err := parseRequestBody(req.Body, &reqBody); err != nil {
+		al.jsonError(w, err)
+		return
+	}
+	if reqBody.Password == "" && reqBody.Token == "" {
+		al.jsonErrorResponseWithTitle(w, http.StatusBadRequest, "password or token is required")
+		return
+	}
+
+	if al.bannedUsers.IsBanned(curUser.Username) {
+		al.jsonErrorResponseWithTitle(w, http.StatusTooManyRequests, ErrTooManyRequests.Error())
+		return
+	}
+
+	authorized := false
+	if reqBody.Password != "" {
+		authorized, err = al.validateCredentials(curUser.Username, reqBody.Password)
+		if err != nil {
+			al.jsonError(w, err)
+			return
+		}
+	} else {
+		var apiErr errors2.APIError
+		err = al.twoFASrv.ValidateToken(curUser.Username, reqBody.Token)
+		if err != nil && !(errors.As(err, &apiErr) && apiErr.HTTPStatus == http.StatusUnauthorized) {
+			al.jsonError(w, err)
+			return
+		}
+		authorized = err == nil
+	}
+	if !authorized {
+		al.bannedUsers.Add(curUser.Username)
+		al.jsonErrorResponseWithTitle(w, http.StatusUnauthorized, "invalid password or token")
+		return
+	}
+
+	secret, recoveryCodes, err := al.twoFASrv.EnrollTOTP(curUser.Username)
+	if err != nil {
+		al.jsonError(w, err)
+		return
+	}
+
+	resp := postTOTPResponse{
+		Secret:        secret,
+		URI:           security.TOTPURI(totpIssuer, curUser.Username, secret),
+		RecoveryCodes: recoveryCodes,
+	}
+	al.writeJSONResponse(w, http.StatusOK, api.NewSuccessPayload(resp))
+}
+
+func (al *APIListener) isTOTPEnrolled(username string) (bool, error) {
+	if !al.config.API.IsTOTPOn() {
+		return false, nil
+	}
+
+	user, err := al.userService.GetByUsername(username)
+	if err != nil {
+		return false, err
+	}
+
+	return user != nil && IsTOTPEnrolled(user), nil
+}
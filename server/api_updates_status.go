@@ -0,0 +1,60 @@
+package chserver
+
+import (
+	"sync"
+
+	"github.com/cloudradar-monitoring/rport/share/models"
+)
+
+// defaultUpdatesStatusWaitTimeout is used when a client's fresh updates status is awaited and no timeout is given
+const defaultUpdatesStatusWaitTimeout = 30
+
+// maxUpdatesStatusWaitTimeout is a max time in seconds an API request can wait for a client's fresh updates status
+const maxUpdatesStatusWaitTimeout = 300
+
+// updatesChanMap is thread safe map with [clientID, subscriber channels] pairs.
+// It holds an entry for each client which fresh updates status is awaited by API requests.
+type updatesChanMap struct {
+	m  map[string]map[chan *models.UpdatesStatus]bool
+	mu sync.RWMutex
+}
+
+// Add registers a new subscriber of a given client. The returned channel is buffered to hold a single status,
+// so sending never blocks.
+func (m *updatesChanMap) Add(clientID string) chan *models.UpdatesStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.m == nil {
+		m.m = make(map[string]map[chan *models.UpdatesStatus]bool)
+	}
+	if m.m[clientID] == nil {
+		m.m[clientID] = make(map[chan *models.UpdatesStatus]bool)
+	}
+	status := make(chan *models.UpdatesStatus, 1)
+	m.m[clientID][status] = true
+	return status
+}
+
+// Del removes a subscriber of a given client. The channel is not closed to let late statuses be dropped safely.
+func (m *updatesChanMap) Del(clientID string, status chan *models.UpdatesStatus) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.m[clientID], status)
+	if len(m.m[clientID]) == 0 {
+		delete(m.m, clientID)
+	}
+}
+
+// Send passes a status to all subscribers of a given client without blocking. Returns false if there are no subscribers.
+func (m *updatesChanMap) Send(clientID string, status *models.UpdatesStatus) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	subscribers := m.m[clientID]
+	for sub := range subscribers {
+		select {
+		case sub <- status:
+		default:
+		}
+	}
+	return len(subscribers) > 0
+}
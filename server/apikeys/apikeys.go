@@ -0,0 +1,165 @@
+package apikeys
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// KeyPrefix distinguishes API keys from JWT tokens in "Authorization: Bearer" headers.
+const KeyPrefix = "rpk_"
+
+const keySize = 32
+
+const (
+	ScopeRead  = "read"
+	ScopeWrite = "write"
+)
+
+// Resources lists API resources that can be granted to API keys, resources of routes are resolved by Resource.
+var Resources = []string{
+	"admin",
+	"audit",
+	"client-groups",
+	"clients",
+	"clients-auth",
+	"commands",
+	"library",
+	"me",
+	"metrics",
+	"schedules",
+	"scripts",
+	"status",
+	"tunnels",
+	"users",
+	"vault",
+	"vault-admin",
+}
+
+// clientSubresources are resources of a single client that have own scopes, e.g. /clients/{client_id}/commands.
+var clientSubresources = map[string]bool{
+	"commands": true,
+	"scripts":  true,
+	"tunnels":  true,
+}
+
+// APIKey is a long-lived named key a user can authenticate API requests with, its access is limited by scopes.
+type APIKey struct {
+	ID        string     `json:"id" db:"id"`
+	Username  string     `json:"-" db:"username"`
+	Name      string     `json:"name" db:"name"`
+	KeyHash   string     `json:"-" db:"key_hash"`
+	Scopes    []string   `json:"scopes" db:"-"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at" db:"expires_at"`
+}
+
+// IsExpired returns true if the key can't be used anymore at a given time.
+func (k *APIKey) IsExpired(now time.Time) bool {
+	return k.ExpiresAt != nil && !now.Before(*k.ExpiresAt)
+}
+
+// Allows returns true if the key grants a given scope, a write scope grants a read scope of the same resource as well.
+func (k *APIKey) Allows(scope string) bool {
+	resource, action := splitScope(scope)
+	for _, cur := range k.Scopes {
+		curResource, curAction := splitScope(cur)
+		if curResource != resource {
+			continue
+		}
+		if curAction == action || curAction == ScopeWrite {
+			return true
+		}
+	}
+	return false
+}
+
+// IsKey returns true if a given bearer token looks like an API key.
+func IsKey(token string) bool {
+	return strings.HasPrefix(token, KeyPrefix)
+}
+
+// NewKey returns a new random API key.
+func NewKey() (string, error) {
+	b := make([]byte, keySize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return KeyPrefix + hex.EncodeToString(b), nil
+}
+
+// HashKey returns a hash of a given key to store and look it up by, keys are random so a salt is not needed.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// ValidateScopes returns an error if any of given scopes is not in "<resource>:<read|write>" format.
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		resource, action := splitScope(scope)
+		if action != ScopeRead && action != ScopeWrite {
+			return fmt.Errorf("invalid scope %q, expected format: <resource>:<read|write>", scope)
+		}
+		if !isResource(resource) {
+			return fmt.Errorf("invalid scope %q, unknown resource %q, expected one of: %s", scope, resource, strings.Join(Resources, ", "))
+		}
+		if resource == "me" && action == ScopeWrite {
+			return fmt.Errorf("invalid scope %q, API keys can't change the profile or credentials of the user, use \"me:read\"", scope)
+		}
+	}
+	return nil
+}
+
+// RequiredScope returns a scope an API key needs to call a given method of a route with a given path template.
+func RequiredScope(method, pathTemplate string) string {
+	action := ScopeWrite
+	if method == http.MethodGet || method == http.MethodHead {
+		action = ScopeRead
+	}
+	resource := Resource(pathTemplate)
+	if resource == "me" && action == ScopeWrite {
+		// changing the profile, the API token or the 2FA of the user can't be granted, otherwise a leaked key
+		// could be turned into credentials that are not limited by scopes
+		resource = "credentials"
+	}
+	return resource + ":" + action
+}
+
+// Resource returns a resource of a route with a given path template, e.g. "commands" for /api/v1/clients/{client_id}/commands.
+func Resource(pathTemplate string) string {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(pathTemplate, "/api/v1"), "/"), "/")
+	resource := parts[0]
+	switch {
+	case resource == "clients" && len(parts) > 2 && clientSubresources[parts[2]]:
+		return parts[2]
+	case resource == "me" && len(parts) > 1 && parts[1] == "apikeys":
+		// API keys can be managed only by users themselves, so it is not in Resources and can't be granted
+		return "apikeys"
+	}
+	return resource
+}
+
+func isResource(resource string) bool {
+	for _, cur := range Resources {
+		if cur == resource {
+			return true
+		}
+	}
+	return false
+}
+
+func splitScope(scope string) (resource, action string) {
+	i := strings.LastIndex(scope, ":")
+	if i < 0 {
+		return scope, ""
+	}
+	return scope[:i], scope[i+1:]
+}
@@ -0,0 +1,175 @@
+package apikeys
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequiredScope(t *testing.T) {
+	testCases := []struct {
+		Method   string
+		Path     string
+		Expected string
+	}{
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/clients",
+			Expected: "clients:read",
+		},
+		{
+			Method:   http.MethodDelete,
+			Path:     "/api/v1/clients/{client_id}",
+			Expected: "clients:write",
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/api/v1/clients/{client_id}/commands",
+			Expected: "commands:write",
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/clients/{client_id}/commands/{job_id}/result",
+			Expected: "commands:read",
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/clients/{client_id}/config",
+			Expected: "clients:read",
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/api/v1/commands",
+			Expected: "commands:write",
+		},
+		{
+			Method:   http.MethodPut,
+			Path:     "/api/v1/library/scripts/{script_id}",
+			Expected: "library:write",
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/api/v1/me/apikeys",
+			Expected: "apikeys:write",
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/api/v1/me",
+			Expected: "me:read",
+		},
+		{
+			Method:   http.MethodPut,
+			Path:     "/api/v1/me",
+			Expected: "credentials:write",
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/api/v1/me/token",
+			Expected: "credentials:write",
+		},
+		{
+			Method:   http.MethodPost,
+			Path:     "/api/v1/me/totp",
+			Expected: "credentials:write",
+		},
+		{
+			Method:   http.MethodGet,
+			Path:     "/metrics",
+			Expected: "metrics:read",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Method+" "+tc.Path, func(t *testing.T) {
+			assert.Equal(t, tc.Expected, RequiredScope(tc.Method, tc.Path))
+		})
+	}
+}
+
+func TestAllows(t *testing.T) {
+	k := &APIKey{Scopes: []string{"clients:read", "commands:write"}}
+
+	assert.True(t, k.Allows("clients:read"))
+	assert.False(t, k.Allows("clients:write"))
+	assert.True(t, k.Allows("commands:read"))
+	assert.True(t, k.Allows("commands:write"))
+	assert.False(t, k.Allows("scripts:read"))
+	assert.False(t, k.Allows("apikeys:write"))
+
+	// even keys stored with me:write before it was rejected can't change credentials
+	k = &APIKey{Scopes: []string{"me:write"}}
+	assert.False(t, k.Allows(RequiredScope(http.MethodPost, "/api/v1/me/token")))
+	assert.False(t, k.Allows(RequiredScope(http.MethodPut, "/api/v1/me")))
+}
+
+func TestValidateScopes(t *testing.T) {
+	testCases := []struct {
+		Name          string
+		Scopes        []string
+		ExpectedError error
+	}{
+		{
+			Name:   "valid",
+			Scopes: []string{"clients:read", "commands:write", "me:read"},
+		},
+		{
+			Name:          "me write",
+			Scopes:        []string{"me:write"},
+			ExpectedError: errors.New(`invalid scope "me:write", API keys can't change the profile or credentials of the user, use "me:read"`),
+		},
+		{
+			Name:          "empty",
+			ExpectedError: errors.New("at least one scope is required"),
+		},
+		{
+			Name:          "invalid action",
+			Scopes:        []string{"clients:delete"},
+			ExpectedError: errors.New(`invalid scope "clients:delete", expected format: <resource>:<read|write>`),
+		},
+		{
+			Name:          "no action",
+			Scopes:        []string{"clients"},
+			ExpectedError: errors.New(`invalid scope "clients", expected format: <resource>:<read|write>`),
+		},
+		{
+			Name:          "unknown resource",
+			Scopes:        []string{"apikeys:write"},
+			ExpectedError: errors.New(`invalid scope "apikeys:write", unknown resource "apikeys", expected one of: admin, audit, client-groups, clients, clients-auth, commands, library, me, metrics, schedules, scripts, status, tunnels, users, vault, vault-admin`),
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			assert.Equal(t, tc.ExpectedError, ValidateScopes(tc.Scopes))
+		})
+	}
+}
+
+func TestNewKey(t *testing.T) {
+	key1, err := NewKey()
+	require.NoError(t, err)
+	key2, err := NewKey()
+	require.NoError(t, err)
+
+	assert.True(t, IsKey(key1))
+	assert.Len(t, key1, len(KeyPrefix)+2*keySize)
+	assert.NotEqual(t, key1, key2)
+	assert.NotEqual(t, HashKey(key1), HashKey(key2))
+	assert.Equal(t, HashKey(key1), HashKey(key1))
+}
+
+func TestIsExpired(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	past := now.Add(-time.Second)
+	future := now.Add(time.Second)
+
+	assert.False(t, (&APIKey{}).IsExpired(now))
+	assert.True(t, (&APIKey{ExpiresAt: &past}).IsExpired(now))
+	assert.False(t, (&APIKey{ExpiresAt: &future}).IsExpired(now))
+}
@@ -0,0 +1,109 @@
+package apikeys
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/cloudradar-monitoring/rport/db/migration/api_keys"
+	"github.com/cloudradar-monitoring/rport/db/sqlite"
+)
+
+const scopesSeparator = ","
+
+// apiKeySqlite is a db representation of APIKey.
+type apiKeySqlite struct {
+	APIKey
+	Scopes string `db:"scopes"`
+}
+
+func (k *apiKeySqlite) convert() *APIKey {
+	res := k.APIKey
+	res.Scopes = strings.Split(k.Scopes, scopesSeparator)
+	res.CreatedAt = res.CreatedAt.UTC()
+	if res.ExpiresAt != nil {
+		expiresAt := res.ExpiresAt.UTC()
+		res.ExpiresAt = &expiresAt
+	}
+	return &res
+}
+
+// SqliteProvider stores API keys in a sqlite DB.
+type SqliteProvider struct {
+	db *sqlx.DB
+}
+
+func NewSqliteProvider(dbPath string) (*SqliteProvider, error) {
+	db, err := sqlite.New(dbPath, api_keys.AssetNames(), api_keys.Asset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create api keys DB instance: %v", err)
+	}
+	return &SqliteProvider{db: db}, nil
+}
+
+// Create stores a new API key, it fails if a user already has a key with the same name.
+func (p *SqliteProvider) Create(k *APIKey) error {
+	var expiresAt *time.Time
+	if k.ExpiresAt != nil {
+		v := k.ExpiresAt.UTC()
+		expiresAt = &v
+	}
+	_, err := p.db.Exec(
+		"INSERT INTO api_keys (id, username, name, key_hash, scopes, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		k.ID,
+		k.Username,
+		k.Name,
+		k.KeyHash,
+		strings.Join(k.Scopes, scopesSeparator),
+		k.CreatedAt.UTC(),
+		expiresAt,
+	)
+	return err
+}
+
+// GetByHash returns an API key by a hash of its value, nil if not found.
+func (p *SqliteProvider) GetByHash(keyHash string) (*APIKey, error) {
+	res := &apiKeySqlite{}
+	err := p.db.Get(res, "SELECT * FROM api_keys WHERE key_hash = ?", keyHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return res.convert(), nil
+}
+
+// GetAllByUsername returns all API keys of a given user ordered by creation time.
+func (p *SqliteProvider) GetAllByUsername(username string) ([]*APIKey, error) {
+	var res []*apiKeySqlite
+	err := p.db.Select(&res, "SELECT * FROM api_keys WHERE username = ? ORDER BY created_at, name", username)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]*APIKey, 0, len(res))
+	for _, cur := range res {
+		keys = append(keys, cur.convert())
+	}
+	return keys, nil
+}
+
+// Delete deletes an API key of a given user. Returns false if it's not found.
+func (p *SqliteProvider) Delete(username, id string) (bool, error) {
+	res, err := p.db.Exec("DELETE FROM api_keys WHERE username = ? AND id = ?", username, id)
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (p *SqliteProvider) Close() error {
+	return p.db.Close()
+}
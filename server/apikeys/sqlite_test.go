@@ -0,0 +1,73 @@
+package apikeys
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSqliteProvider(t *testing.T) {
+	p, err := NewSqliteProvider(":memory:")
+	require.NoError(t, err)
+	defer p.Close()
+
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	expiresAt := now.Add(time.Hour)
+	key1 := &APIKey{
+		ID:        "id-1",
+		Username:  "user1",
+		Name:      "ci",
+		KeyHash:   "hash-1",
+		Scopes:    []string{"clients:read", "commands:write"},
+		CreatedAt: now,
+		ExpiresAt: &expiresAt,
+	}
+	key2 := &APIKey{
+		ID:        "id-2",
+		Username:  "user1",
+		Name:      "backup",
+		KeyHash:   "hash-2",
+		Scopes:    []string{"vault:read"},
+		CreatedAt: now.Add(time.Minute),
+	}
+	key3 := &APIKey{
+		ID:        "id-3",
+		Username:  "user2",
+		Name:      "ci",
+		KeyHash:   "hash-3",
+		Scopes:    []string{"clients:read"},
+		CreatedAt: now,
+	}
+	require.NoError(t, p.Create(key1))
+	require.NoError(t, p.Create(key2))
+	require.NoError(t, p.Create(key3))
+
+	// duplicate name of the same user
+	assert.Error(t, p.Create(&APIKey{ID: "id-4", Username: "user1", Name: "ci", KeyHash: "hash-4", CreatedAt: now}))
+
+	got, err := p.GetByHash("hash-1")
+	require.NoError(t, err)
+	assert.Equal(t, key1, got)
+
+	got, err = p.GetByHash("unknown")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	all, err := p.GetAllByUsername("user1")
+	require.NoError(t, err)
+	assert.Equal(t, []*APIKey{key1, key2}, all)
+
+	deleted, err := p.Delete("user2", "id-1")
+	require.NoError(t, err)
+	assert.False(t, deleted)
+
+	deleted, err = p.Delete("user1", "id-1")
+	require.NoError(t, err)
+	assert.True(t, deleted)
+
+	all, err = p.GetAllByUsername("user1")
+	require.NoError(t, err)
+	assert.Equal(t, []*APIKey{key2}, all)
+}
@@ -0,0 +1,119 @@
+package auditlog
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/cloudradar-monitoring/rport/db/migration/audit_log"
+	"github.com/cloudradar-monitoring/rport/db/sqlite"
+	"github.com/cloudradar-monitoring/rport/share/query"
+)
+
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// SupportedSortAndFilters are fields entries can be sorted and filtered by.
+var SupportedSortAndFilters = map[string]bool{
+	"id":        true,
+	"timestamp": true,
+	"username":  true,
+	"method":    true,
+	"route":     true,
+	"target_id": true,
+	"status":    true,
+}
+
+// Entry is a record of a state-changing API call.
+type Entry struct {
+	ID        int64     `json:"id" db:"id"`
+	Timestamp time.Time `json:"timestamp" db:"timestamp"`
+	Username  string    `json:"username" db:"username"`
+	Method    string    `json:"method" db:"method"`
+	// Route is a path template of the called route, e.g. /api/v1/clients/{client_id}/commands
+	Route string `json:"route" db:"route"`
+	// TargetID is a value of the last route param, e.g. a client ID, empty if the route has no params
+	TargetID string `json:"target_id" db:"target_id"`
+	// Status is an HTTP status code of the response
+	Status int `json:"status" db:"status"`
+}
+
+// IsAudited returns true if calls with a given method change state and should be logged.
+func IsAudited(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// SqliteProvider stores audit log entries in a sqlite DB.
+type SqliteProvider struct {
+	db *sqlx.DB
+}
+
+func NewSqliteProvider(dbPath string) (*SqliteProvider, error) {
+	db, err := sqlite.New(dbPath, audit_log.AssetNames(), audit_log.Asset)
+	if err != nil {
+		return nil, err
+	}
+	return &SqliteProvider{db: db}, nil
+}
+
+func (p *SqliteProvider) Save(e *Entry) error {
+	res, err := p.db.Exec(
+		"INSERT INTO audit_log (timestamp, username, method, route, target_id, status) VALUES (?, ?, ?, ?, ?, ?)",
+		e.Timestamp.UTC(),
+		e.Username,
+		e.Method,
+		e.Route,
+		e.TargetID,
+		e.Status,
+	)
+	if err != nil {
+		return err
+	}
+	e.ID, err = res.LastInsertId()
+	return err
+}
+
+// List returns a page of entries matching given filters and the total number of matching entries.
+// Entries are sorted by the newest first unless other sorts are given.
+func (p *SqliteProvider) List(lo *query.ListOptions, pagination *query.Pagination) ([]*Entry, int, error) {
+	if len(lo.Sorts) == 0 {
+		lo.Sorts = []query.SortOption{{Column: "timestamp"}, {Column: "id"}}
+	}
+	q, params := query.ConvertListOptionsToQuery(lo, "SELECT * FROM audit_log ")
+
+	var total int
+	if err := p.db.Get(&total, "SELECT COUNT(*) FROM ("+q+")", params...); err != nil {
+		return nil, 0, err
+	}
+
+	res := []*Entry{}
+	q += " LIMIT ? OFFSET ?"
+	params = append(params, pagination.Limit, pagination.Offset)
+	if err := p.db.Select(&res, q, params...); err != nil {
+		return nil, 0, err
+	}
+	for _, e := range res {
+		e.Timestamp = e.Timestamp.UTC()
+	}
+	return res, total, nil
+}
+
+// DeleteBefore deletes all entries recorded before a given time. Returns a number of deleted entries.
+func (p *SqliteProvider) DeleteBefore(t time.Time) (int64, error) {
+	res, err := p.db.Exec("DELETE FROM audit_log WHERE DATETIME(timestamp) < DATETIME(?)", t.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (p *SqliteProvider) Close() error {
+	return p.db.Close()
+}
@@ -0,0 +1,100 @@
+package auditlog
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/rport/share/query"
+)
+
+func TestSqliteProvider(t *testing.T) {
+	p, err := NewSqliteProvider(":memory:")
+	require.NoError(t, err)
+	defer p.Close()
+
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	e1 := &Entry{Timestamp: now, Username: "admin", Method: http.MethodPost, Route: "/api/v1/clients-auth", Status: http.StatusCreated}
+	e2 := &Entry{Timestamp: now.Add(time.Minute), Username: "user1", Method: http.MethodPost, Route: "/api/v1/clients/{client_id}/commands", TargetID: "c1", Status: http.StatusOK}
+	e3 := &Entry{Timestamp: now.Add(2 * time.Minute), Username: "admin", Method: http.MethodDelete, Route: "/api/v1/users/{user_id}", TargetID: "user1", Status: http.StatusNoContent}
+	for _, e := range []*Entry{e1, e2, e3} {
+		require.NoError(t, p.Save(e))
+		assert.NotZero(t, e.ID)
+	}
+
+	testCases := []struct {
+		name       string
+		lo         *query.ListOptions
+		pagination *query.Pagination
+		wantTotal  int
+		want       []*Entry
+	}{
+		{
+			name:       "newest first by default",
+			lo:         &query.ListOptions{},
+			pagination: &query.Pagination{Limit: 10},
+			wantTotal:  3,
+			want:       []*Entry{e3, e2, e1},
+		},
+		{
+			name:       "page",
+			lo:         &query.ListOptions{},
+			pagination: &query.Pagination{Limit: 1, Offset: 1},
+			wantTotal:  3,
+			want:       []*Entry{e2},
+		},
+		{
+			name: "filter and sort",
+			lo: &query.ListOptions{
+				Filters: []query.FilterOption{{Column: "username", Values: []string{"admin"}}},
+				Sorts:   []query.SortOption{{Column: "timestamp", IsASC: true}},
+			},
+			pagination: &query.Pagination{Limit: 10},
+			wantTotal:  2,
+			want:       []*Entry{e1, e3},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, total, err := p.List(tc.lo, tc.pagination)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantTotal, total)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestSqliteProviderDeleteBefore(t *testing.T) {
+	p, err := NewSqliteProvider(":memory:")
+	require.NoError(t, err)
+	defer p.Close()
+
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	old := &Entry{Timestamp: now.Add(-2 * time.Hour), Username: "admin", Method: http.MethodPost, Route: "/api/v1/clients-auth", Status: http.StatusCreated}
+	recent := &Entry{Timestamp: now, Username: "admin", Method: http.MethodDelete, Route: "/api/v1/users/{user_id}", TargetID: "user1", Status: http.StatusNoContent}
+	require.NoError(t, p.Save(old))
+	require.NoError(t, p.Save(recent))
+
+	deleted, err := p.DeleteBefore(now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, deleted)
+
+	got, total, err := p.List(&query.ListOptions{}, &query.Pagination{Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	assert.Equal(t, []*Entry{recent}, got)
+}
+
+func TestIsAudited(t *testing.T) {
+	assert.False(t, IsAudited(http.MethodGet))
+	assert.False(t, IsAudited(http.MethodHead))
+	assert.False(t, IsAudited(http.MethodOptions))
+	assert.True(t, IsAudited(http.MethodPost))
+	assert.True(t, IsAudited(http.MethodPut))
+	assert.True(t, IsAudited(http.MethodDelete))
+}
@@ -0,0 +1,37 @@
+package auditlog
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	chshare "github.com/cloudradar-monitoring/rport/share"
+)
+
+type CleanupTask struct {
+	log      *chshare.Logger
+	provider *SqliteProvider
+	keep     time.Duration
+}
+
+// NewCleanupTask returns a task to delete audit log entries recorded longer than a given duration ago.
+func NewCleanupTask(log *chshare.Logger, provider *SqliteProvider, keep time.Duration) *CleanupTask {
+	return &CleanupTask{
+		log:      log,
+		provider: provider,
+		keep:     keep,
+	}
+}
+
+func (t *CleanupTask) Run(ctx context.Context) error {
+	deleted, err := t.provider.DeleteBefore(time.Now().Add(-t.keep))
+	if err != nil {
+		return fmt.Errorf("failed to delete old audit log entries: %v", err)
+	}
+
+	if deleted > 0 {
+		t.log.Debugf("Deleted %d old audit log entries.", deleted)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package bans
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/cloudradar-monitoring/rport/db/migration/bans"
+	"github.com/cloudradar-monitoring/rport/db/sqlite"
+)
+
+const (
+	usersTable = "bans"
+	ipsTable   = "ip_bans"
+)
+
+// SqliteProvider stores bans in a sqlite DB, so they survive server restarts.
+type SqliteProvider struct {
+	db *sqlx.DB
+}
+
+func NewSqliteProvider(dbPath string) (*SqliteProvider, error) {
+	db, err := sqlite.New(dbPath, bans.AssetNames(), bans.Asset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bans DB instance: %v", err)
+	}
+	return &SqliteProvider{db: db}, nil
+}
+
+// Users returns a store of bans of usernames.
+func (p *SqliteProvider) Users() *Store {
+	return &Store{db: p.db, table: usersTable}
+}
+
+// IPs returns a store of bans of IP addresses.
+func (p *SqliteProvider) IPs() *Store {
+	return &Store{db: p.db, table: ipsTable}
+}
+
+// DeleteExpired deletes all bans that expired before a given time. Returns a number of deleted bans.
+func (p *SqliteProvider) DeleteExpired(now time.Time) (int64, error) {
+	var total int64
+	for _, table := range []string{usersTable, ipsTable} {
+		res, err := p.db.Exec("DELETE FROM "+table+" WHERE DATETIME(expires_at) <= DATETIME(?)", now.UTC())
+		if err != nil {
+			return total, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+		total += n
+	}
+	return total, nil
+}
+
+func (p *SqliteProvider) Close() error {
+	return p.db.Close()
+}
+
+// Store keeps bans of a single kind of visitors.
+type Store struct {
+	db    *sqlx.DB
+	table string
+}
+
+// GetAll returns expiry times of all stored bans by visitor keys.
+func (s *Store) GetAll() (map[string]time.Time, error) {
+	var res []struct {
+		VisitorKey string    `db:"visitor_key"`
+		ExpiresAt  time.Time `db:"expires_at"`
+	}
+	err := s.db.Select(&res, "SELECT visitor_key, expires_at FROM "+s.table)
+	if err != nil {
+		return nil, err
+	}
+	bans := make(map[string]time.Time, len(res))
+	for _, cur := range res {
+		bans[cur.VisitorKey] = cur.ExpiresAt
+	}
+	return bans, nil
+}
+
+// Save creates a new or updates an existing ban of a given visitor.
+func (s *Store) Save(visitorKey string, expiresAt time.Time) error {
+	_, err := s.db.Exec("INSERT OR REPLACE INTO "+s.table+" (visitor_key, expires_at) VALUES (?, ?)", visitorKey, expiresAt.UTC())
+	return err
+}
+
+// Delete removes a ban of a given visitor if it exists.
+func (s *Store) Delete(visitorKey string) error {
+	_, err := s.db.Exec("DELETE FROM "+s.table+" WHERE visitor_key = ?", visitorKey)
+	return err
+}
@@ -0,0 +1,58 @@
+package bans
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSqliteProvider(t *testing.T) {
+	p, err := NewSqliteProvider(":memory:")
+	require.NoError(t, err)
+	defer p.Close()
+
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	users, ips := p.Users(), p.IPs()
+	require.NoError(t, users.Save("user1", now.Add(time.Hour)))
+	require.NoError(t, users.Save("user2", now.Add(-time.Minute)))
+	require.NoError(t, users.Save("user3", now.Add(time.Minute)))
+	// update an existing ban
+	require.NoError(t, users.Save("user3", now.Add(2*time.Hour)))
+	require.NoError(t, ips.Save("1.1.1.1", now.Add(time.Hour)))
+	require.NoError(t, ips.Save("2.2.2.2", now.Add(-time.Minute)))
+	require.NoError(t, ips.Save("3.3.3.3", now.Add(time.Hour)))
+
+	got, err := users.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]time.Time{
+		"user1": now.Add(time.Hour),
+		"user2": now.Add(-time.Minute),
+		"user3": now.Add(2 * time.Hour),
+	}, got)
+
+	require.NoError(t, ips.Delete("3.3.3.3"))
+	got, err = ips.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]time.Time{
+		"1.1.1.1": now.Add(time.Hour),
+		"2.2.2.2": now.Add(-time.Minute),
+	}, got)
+
+	deleted, err := p.DeleteExpired(now)
+	require.NoError(t, err)
+	assert.EqualValues(t, 2, deleted)
+
+	got, err = users.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]time.Time{
+		"user1": now.Add(time.Hour),
+		"user3": now.Add(2 * time.Hour),
+	}, got)
+	got, err = ips.GetAll()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]time.Time{
+		"1.1.1.1": now.Add(time.Hour),
+	}, got)
+}
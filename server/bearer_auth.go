@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/tomasen/realip"
 )
 
 const (
@@ -21,7 +22,8 @@ type Token struct {
 	jwt.StandardClaims
 }
 
-func (al *APIListener) createAuthToken(lifetime time.Duration, username string) (string, error) {
+// createAuthToken creates a new session of a given user logged in by a given request.
+func (al *APIListener) createAuthToken(req *http.Request, lifetime time.Duration, username string) (string, error) {
 	if username == "" {
 		return "", errors.New("username cannot be empty")
 	}
@@ -38,8 +40,16 @@ func (al *APIListener) createAuthToken(lifetime time.Duration, username string)
 		return "", err
 	}
 
-	expiresAt := time.Now().Add(lifetime)
-	err = al.apiSessionRepo.Save(&APISession{tokenStr, expiresAt})
+	now := time.Now()
+	err = al.apiSessionRepo.Save(&APISession{
+		TokenHash: hashAPISessionToken(tokenStr),
+		ExpiresAt: now.Add(lifetime),
+		ID:        claims.Id,
+		Username:  username,
+		IssuedAt:  now,
+		UserAgent: req.UserAgent(),
+		IP:        realip.FromRequest(req),
+	})
 	if err != nil {
 		return "", err
 	}
@@ -47,13 +57,10 @@ func (al *APIListener) createAuthToken(lifetime time.Duration, username string)
 	return tokenStr, nil
 }
 
+// increaseSessionLifetime extends a session unless it was revoked in the meantime.
 func (al *APIListener) increaseSessionLifetime(s *APISession) error {
-	newExpirationDate := s.ExpiresAt.Add(defaultTokenLifetime)
-	if time.Now().After(s.ExpiresAt) {
-		newExpirationDate = time.Now().Add(defaultTokenLifetime)
-	}
-	s.ExpiresAt = newExpirationDate
-	return al.apiSessionRepo.Save(s)
+	_, err := al.apiSessionRepo.ExtendLifetime(s.TokenHash, defaultTokenLifetime, time.Now())
+	return err
 }
 
 func (al *APIListener) validateBearerToken(tokenStr string) (bool, string, *APISession, error) {
@@ -18,6 +18,7 @@ import (
 	"github.com/jpillora/requestlog"
 	"golang.org/x/crypto/ssh"
 
+	"github.com/cloudradar-monitoring/rport/server/api"
 	"github.com/cloudradar-monitoring/rport/server/api/middleware"
 	"github.com/cloudradar-monitoring/rport/server/clients"
 	chshare "github.com/cloudradar-monitoring/rport/share"
@@ -37,6 +38,8 @@ type ClientListener struct {
 	requestLogOptions *requestlog.Options
 	bannedClientAuths *security.BanList
 	bannedIPs         *security.MaxBadAttemptsBanList
+	rateLimitedIPs    *security.MaxRateBanList
+	fingerprint       string
 
 	clientIndexAutoIncrement int32
 }
@@ -55,6 +58,7 @@ func NewClientListener(server *Server, privateKey ssh.Signer) (*ClientListener,
 		Logger:            chshare.NewLogger("client-listener", config.Logging.LogOutput, config.Logging.LogLevel),
 		requestLogOptions: config.InitRequestLogOptions(),
 		bannedClientAuths: security.NewBanList(time.Duration(config.Server.ClientLoginWait) * time.Second),
+		fingerprint:       chshare.FingerprintKey(privateKey.PublicKey()),
 	}
 
 	if config.Server.MaxFailedLogin > 0 && config.Server.BanTime > 0 {
@@ -65,6 +69,15 @@ func NewClientListener(server *Server, privateKey ssh.Signer) (*ClientListener,
 		)
 	}
 
+	if config.Server.MaxConnAttemptsPerIP > 0 {
+		cl.rateLimitedIPs = security.NewMaxRateBanList(
+			config.Server.MaxConnAttemptsPerIP,
+			config.Server.ConnAttemptsInterval,
+			config.Server.ConnRateBanTime,
+			cl.Logger,
+		)
+	}
+
 	//create ssh config
 	cl.sshConfig = &ssh.ServerConfig{
 		ServerVersion:    "SSH-" + chshare.ProtocolVersion + "-server",
@@ -127,6 +140,44 @@ func (cl *ClientListener) authUser(c ssh.ConnMetadata, password []byte) (*ssh.Pe
 	return nil, nil
 }
 
+// checkWebsocketOrigin verifies the Host and Origin headers of a websocket upgrade against 'allowed_hosts' and
+// 'allowed_origins' to prevent DNS rebinding and cross-site websocket hijacking. Empty lists allow everything.
+// Upgrades without Origin are allowed, only browsers send it, rport clients don't.
+func (cl *ClientListener) checkWebsocketOrigin(req *http.Request) error {
+	if allowed := cl.config.Server.AllowedHosts; len(allowed) > 0 && !isAllowedHost(req.Host, allowed) {
+		return fmt.Errorf("host %q is not allowed", req.Host)
+	}
+
+	origin := req.Header.Get("Origin")
+	if allowed := cl.config.Server.AllowedOrigins; origin != "" && len(allowed) > 0 && !isAllowedOrigin(origin, allowed) {
+		return fmt.Errorf("origin %q is not allowed", origin)
+	}
+	return nil
+}
+
+// isAllowedHost returns true if a given host matches one of allowed hosts. Allowed hosts without a port match any port.
+func isAllowedHost(host string, allowed []string) bool {
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	for _, cur := range allowed {
+		if strings.EqualFold(cur, host) || strings.EqualFold(cur, hostname) {
+			return true
+		}
+	}
+	return false
+}
+
+func isAllowedOrigin(origin string, allowed []string) bool {
+	for _, cur := range allowed {
+		if strings.EqualFold(strings.TrimSuffix(cur, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
 func (cl *ClientListener) getIP(addr net.Addr) string {
 	addrStr := addr.String()
 	host, _, err := net.SplitHostPort(addrStr)
@@ -147,6 +198,9 @@ func (cl *ClientListener) Start(listenAddr string) error {
 	if cl.bannedIPs != nil {
 		h = http.Handler(security.RejectBannedIPs(h, cl.bannedIPs))
 	}
+	if cl.rateLimitedIPs != nil {
+		h = http.Handler(security.RejectRateLimitedIPs(h, cl.rateLimitedIPs))
+	}
 	h = requestlog.WrapWith(h, *cl.requestLogOptions)
 	return cl.httpServer.GoListenAndServe(listenAddr, h)
 }
@@ -174,6 +228,10 @@ func (cl *ClientListener) handleClient(w http.ResponseWriter, r *http.Request) {
 		cl.Infof("ignored client connection using protocol '%s', expected '%s'",
 			protocol, chshare.ProtocolVersion)
 	}
+	if r.Method == http.MethodGet && r.URL.Path == comm.ServerInfoPath {
+		cl.handleServerInfo(w)
+		return
+	}
 	//proxy target was provided
 	if cl.reverseProxy != nil {
 		cl.reverseProxy.ServeHTTP(w, r)
@@ -184,12 +242,48 @@ func (cl *ClientListener) handleClient(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write([]byte{})
 }
 
+// handleServerInfo returns the server build and features, so clients can check the compatibility without connecting.
+func (cl *ClientListener) handleServerInfo(w http.ResponseWriter) {
+	info := comm.ServerInfo{
+		Version:         chshare.BuildVersion,
+		ProtocolVersion: chshare.ProtocolVersion,
+		Fingerprint:     cl.fingerprint,
+		Features:        []string{},
+	}
+	if cl.config.Server.CommandSigningKey != "" {
+		info.Features = append(info.Features, comm.FeatureCommandSigning)
+	}
+	if !cl.config.PushedClientConfig.Payload().IsEmpty() {
+		info.Features = append(info.Features, comm.FeaturePushedClientConfig)
+	}
+	if cl.config.Server.MaxJobResultSizeBytes > 0 {
+		info.Features = append(info.Features, comm.FeatureMaxJobResultSize)
+	}
+
+	b, err := json.Marshal(api.NewSuccessPayload(info))
+	if err != nil {
+		cl.Errorf("Failed to encode server info: %v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	if _, err := w.Write(b); err != nil {
+		cl.Errorf("Failed to write server info: %v", err)
+	}
+}
+
 func (cl *ClientListener) nextClientIndex() int32 {
 	return atomic.AddInt32(&cl.clientIndexAutoIncrement, 1)
 }
 
 // handleWebsocket is responsible for handling the websocket connection
 func (cl *ClientListener) handleWebsocket(w http.ResponseWriter, req *http.Request) {
+	if err := cl.checkWebsocketOrigin(req); err != nil {
+		cl.Infof("Rejected websocket upgrade from %s: %v", req.RemoteAddr, err)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
 	clog := cl.Fork("client#%d", cl.nextClientIndex())
 	wsConn, err := upgrader.Upgrade(w, req, nil)
 	if err != nil {
@@ -253,19 +347,52 @@ func (cl *ClientListener) handleWebsocket(w http.ResponseWriter, req *http.Reque
 		return
 	}
 
-	cl.replyConnectionSuccess(r, connRequest.Remotes)
+	cl.replyConnectionSuccess(r, connRequest)
 
 	clientBanner := client.Banner()
 	clog.Debugf("Open %s", clientBanner)
-	go cl.handleSSHRequests(clog, cid, reqs)
+	idleTimer := closeOnIdle(client, cl.config.Server.ClientIdleTimeout)
+	defer idleTimer.Stop()
+	go cl.handleSSHRequests(clog, cid, reqs, idleTimer.Reset)
 	go cl.handleSSHChannels(clog, chans)
 	_ = sshConn.Wait()
-	clog.Debugf("Close %s", clientBanner)
 
 	err = cl.clientService.Terminate(client)
 	if err != nil {
 		cl.Errorf("could not terminate client: %s", err)
 	}
+	clog.Debugf("Close %s, reason: %s", clientBanner, client.DisconnectReason)
+}
+
+// idleTimer closes a client connection if it's not reset within a timeout.
+type idleTimer struct {
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+// closeOnIdle returns an idle timer that closes a given client with DisconnectReasonIdleTimeout
+// if it's not reset within a given timeout. Zero timeout disables it.
+func closeOnIdle(client *clients.Client, timeout time.Duration) *idleTimer {
+	t := &idleTimer{timeout: timeout}
+	if timeout > 0 {
+		t.timer = time.AfterFunc(timeout, func() {
+			client.Logger.Infof("No requests from client within %v, closing the connection", timeout)
+			_ = client.CloseWithReason(clients.DisconnectReasonIdleTimeout)
+		})
+	}
+	return t
+}
+
+func (t *idleTimer) Reset() {
+	if t.timer != nil {
+		t.timer.Reset(t.timeout)
+	}
+}
+
+func (t *idleTimer) Stop() {
+	if t.timer != nil {
+		t.timer.Stop()
+	}
 }
 
 // checkVersions print if client and server versions dont match.
@@ -342,10 +469,10 @@ loop2:
 		}
 	}
 
-	// add tunnels that left among old
+	// add tunnels that left among old, except the ones whose max lifetime has ended
 	var res []*chshare.Remote
 	for i, marked := range oldMarked {
-		if !marked {
+		if !marked && !old[i].IsExpired() {
 			r := *old[i]
 			// if it was random then set up zero values
 			if r.LocalPortRandom {
@@ -359,8 +486,19 @@ loop2:
 	return res
 }
 
-func (cl *ClientListener) replyConnectionSuccess(r *ssh.Request, remotes []*chshare.Remote) {
-	replyPayload, err := json.Marshal(remotes)
+func (cl *ClientListener) replyConnectionSuccess(r *ssh.Request, connRequest *chshare.ConnectionRequest) {
+	var reply interface{} = connRequest.Remotes
+	if connRequest.AcceptsPushedConfig {
+		resp, err := cl.newConnectionResponse(connRequest.Remotes)
+		if err != nil {
+			cl.Errorf("can't encode pushed client config")
+			cl.replyConnectionError(r, err)
+			return
+		}
+		reply = resp
+	}
+
+	replyPayload, err := json.Marshal(reply)
 	if err != nil {
 		cl.Errorf("can't encode success reply payload")
 		cl.replyConnectionError(r, err)
@@ -370,15 +508,32 @@ func (cl *ClientListener) replyConnectionSuccess(r *ssh.Request, remotes []*chsh
 	_ = r.Reply(true, replyPayload)
 }
 
+func (cl *ClientListener) newConnectionResponse(remotes []*chshare.Remote) (*chshare.ConnectionResponse, error) {
+	resp := &chshare.ConnectionResponse{Remotes: remotes}
+	pushed := cl.config.PushedClientConfig.Payload()
+	if pushed.IsEmpty() {
+		return resp, nil
+	}
+	config, err := json.Marshal(pushed)
+	if err != nil {
+		return nil, err
+	}
+	resp.Config = config
+	return resp, nil
+}
+
 func (cl *ClientListener) replyConnectionError(r *ssh.Request, err error) {
 	_ = r.Reply(false, []byte(err.Error()))
 }
 
-func (cl *ClientListener) handleSSHRequests(clientLog *chshare.Logger, clientID string, reqs <-chan *ssh.Request) {
+// handleSSHRequests handles requests sent by a client, onRequest is called for each of them.
+func (cl *ClientListener) handleSSHRequests(clientLog *chshare.Logger, clientID string, reqs <-chan *ssh.Request, onRequest func()) {
 	for r := range reqs {
+		onRequest()
 		switch r.Type {
 		case comm.RequestTypePing:
-			_ = r.Reply(true, nil)
+			// echo the payload back, so the client can match the response to its ping
+			_ = r.Reply(true, r.Payload)
 		case comm.RequestTypeCmdResult:
 			job, err := cl.saveCmdResult(r.Payload)
 			if err != nil {
@@ -387,14 +542,19 @@ func (cl *ClientListener) handleSSHRequests(clientLog *chshare.Logger, clientID
 			}
 			clientLog.Debugf("%s, Command result saved successfully.", job.LogPrefix())
 
-			if job.MultiJobID != nil {
-				done := cl.jobsDoneChannel.Get(*job.MultiJobID)
-				if done != nil {
-					// to avoid blocking the exec - send job result in a new goroutine
-					go func(done2 chan *models.Job, job2 *models.Job) {
-						done2 <- job2
-					}(done, job)
-				}
+			if job.MultiJobID != nil && !cl.jobsDoneChannel.Send(*job.MultiJobID, job) {
+				clientLog.Debugf("%s, Result is not awaited by multi-client job.", job.LogPrefix())
+			}
+			cl.jobOutputChannels.Send(job.JID, newJobFinishedMessage(job))
+		case comm.RequestTypeCmdOutput:
+			output := &comm.CmdOutput{}
+			err := json.Unmarshal(r.Payload, output)
+			if err != nil {
+				clientLog.Errorf("Failed to unmarshal cmd output: %s", err)
+				continue
+			}
+			if !cl.jobOutputChannels.Send(output.JID, &jobOutputMessage{StdOut: output.StdOut, StdErr: output.StdErr}) {
+				clientLog.Debugf("Output of job[id=%q] has no subscribers.", output.JID)
 			}
 		case comm.RequestTypeUpdatesStatus:
 			updatesStatus := &models.UpdatesStatus{}
@@ -408,6 +568,19 @@ func (cl *ClientListener) handleSSHRequests(clientLog *chshare.Logger, clientID
 				clientLog.Errorf("Failed to save updates status: %s", err)
 				continue
 			}
+			cl.updatesStatusChans.Send(clientID, updatesStatus)
+		case comm.RequestTypeHealthStatus:
+			healthStatus := &models.HealthStatus{}
+			err := json.Unmarshal(r.Payload, healthStatus)
+			if err != nil {
+				clientLog.Errorf("Failed to unmarshal health status: %s", err)
+				continue
+			}
+			err = cl.clientService.SetHealthStatus(clientID, healthStatus)
+			if err != nil {
+				clientLog.Errorf("Failed to save health status: %s", err)
+				continue
+			}
 		default:
 			clientLog.Debugf("Unknown request: %s", r.Type)
 		}
@@ -420,6 +593,15 @@ func (cl *ClientListener) saveCmdResult(respBytes []byte) (*models.Job, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode cmd result request: %s", err)
 	}
+	cl.dispatchedJobs.Del(resp.JID)
+	// env values are secrets and stdin is not stored, drop them if a client sends them back
+	if resp.Env != nil || resp.Stdin != "" {
+		resp.Env = nil
+		resp.Stdin = ""
+		if respBytes, err = json.Marshal(resp); err != nil {
+			return nil, fmt.Errorf("failed to encode cmd result: %s", err)
+		}
+	}
 
 	var wsJID string
 	if resp.MultiJobID != nil {
@@ -438,6 +620,18 @@ func (cl *ClientListener) saveCmdResult(respBytes []byte) (*models.Job, error) {
 		cl.Debugf("%s, WS conn not found", resp.LogPrefix())
 	}
 
+	// keep jobs canceled by a batch timeout marked, but save their late result
+	if resp.MultiJobID != nil {
+		existing, err := cl.jobProvider.GetByJID(resp.ClientID, resp.JID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get job: %s", err)
+		}
+		if existing != nil && existing.Status == models.JobStatusCanceled {
+			resp.Status = existing.Status
+			resp.Error = existing.Error
+		}
+	}
+
 	err = cl.jobProvider.SaveJob(&resp)
 	if err != nil {
 		return nil, fmt.Errorf("failed to save job result: %s", err)
@@ -446,18 +640,26 @@ func (cl *ClientListener) saveCmdResult(respBytes []byte) (*models.Job, error) {
 	return &resp, nil
 }
 
+// handleSSHChannels handles channels opened by a client. Channels beyond {max_channels_per_client} are rejected.
 func (cl *ClientListener) handleSSHChannels(clientLog *chshare.Logger, chans <-chan ssh.NewChannel) {
+	maxChannels := int32(cl.config.Server.MaxChannelsPerClient)
+	// only decremented concurrently, so checking and incrementing it in this loop is safe
+	var openChannels int32
 	for ch := range chans {
-		remote := string(ch.ExtraData())
-		//accept rest
-		stream, reqs, err := ch.Accept()
-		if err != nil {
-			clientLog.Debugf("Failed to accept stream: %s", err)
+		if maxChannels > 0 && atomic.LoadInt32(&openChannels) >= maxChannels {
+			clientLog.Errorf("Channel rejected: max channels per client limit (%d) is reached.", maxChannels)
+			if err := ch.Reject(ssh.ResourceShortage, fmt.Sprintf("max channels limit (%d) is reached", maxChannels)); err != nil {
+				clientLog.Debugf("Failed to reject channel: %s", err)
+			}
 			continue
 		}
-		go ssh.DiscardRequests(reqs)
-		//handle stream type
+
+		atomic.AddInt32(&openChannels, 1)
+		ch := ch
 		connID := cl.connStats.New()
-		go chshare.HandleTCPStream(clientLog.Fork("conn#%d", connID), &cl.connStats, stream, remote)
+		go func() {
+			defer atomic.AddInt32(&openChannels, -1)
+			chshare.HandleTCPChannel(clientLog.Fork("conn#%d", connID), &cl.connStats, ch)
+		}()
 	}
 }
@@ -1,13 +1,32 @@
 package chserver
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
 
+	"github.com/cloudradar-monitoring/rport/server/api"
+	"github.com/cloudradar-monitoring/rport/server/api/jobs"
+	"github.com/cloudradar-monitoring/rport/server/test/jb"
 	chshare "github.com/cloudradar-monitoring/rport/share"
+	"github.com/cloudradar-monitoring/rport/share/comm"
+	"github.com/cloudradar-monitoring/rport/share/models"
+	"github.com/cloudradar-monitoring/rport/share/ws"
 )
 
 func TestGetTunnelsToReestablish(t *testing.T) {
@@ -17,8 +36,10 @@ func TestGetTunnelsToReestablish(t *testing.T) {
 
 		oldStr []string
 		oldACL []string
-		newStr []string
-		newACL []string
+		// oldExpiresIn sets ExpiresAt of old tunnels relative to now, 0 if unlimited
+		oldExpiresIn []time.Duration
+		newStr       []string
+		newACL       []string
 
 		wantResStr []string
 	}{
@@ -28,6 +49,20 @@ func TestGetTunnelsToReestablish(t *testing.T) {
 			newStr:     nil,
 			wantResStr: []string{},
 		},
+		{
+			descr: "expired tunnels",
+			oldStr: []string{
+				"192.168.0.1:3000:google.com:80",
+				"3001:site.com:80",
+				"foobar.com:3000",
+			},
+			oldExpiresIn: []time.Duration{-time.Minute, time.Hour, 0},
+			newStr:       []string{},
+			wantResStr: []string{
+				"0.0.0.0:3001:site.com:80",
+				"::foobar.com:3000",
+			},
+		},
 		{
 			descr: "no new tunnels",
 			oldStr: []string{
@@ -400,6 +435,10 @@ func TestGetTunnelsToReestablish(t *testing.T) {
 			if tc.oldACL != nil && tc.oldACL[i] != "" {
 				r.ACL = &tc.oldACL[i]
 			}
+			if tc.oldExpiresIn != nil && tc.oldExpiresIn[i] != 0 {
+				expiresAt := time.Now().Add(tc.oldExpiresIn[i])
+				r.ExpiresAt = &expiresAt
+			}
 			old = append(old, r)
 		}
 		for i, v := range tc.newStr {
@@ -423,3 +462,314 @@ func TestGetTunnelsToReestablish(t *testing.T) {
 		assert.ElementsMatch(t, tc.wantResStr, gotResStr, msg)
 	}
 }
+
+func TestNewConnectionResponse(t *testing.T) {
+	remotes := []*chshare.Remote{{LocalPort: "3000", RemoteHost: "127.0.0.1", RemotePort: "22"}}
+
+	testCases := []struct {
+		name       string
+		pushed     PushedClientConfig
+		wantConfig string
+	}{
+		{
+			name: "nothing to push",
+		},
+		{
+			name: "keepalive and output limit",
+			pushed: PushedClientConfig{
+				KeepAlive:     30 * time.Second,
+				SendBackLimit: 100,
+			},
+			wantConfig: `{"keep_alive":30000000000,"remote_commands":{"send_back_limit":100}}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			cl := &ClientListener{
+				Server: &Server{
+					config: &Config{PushedClientConfig: tc.pushed},
+				},
+			}
+
+			resp, err := cl.newConnectionResponse(remotes)
+			require.NoError(t, err)
+
+			assert.Equal(t, remotes, resp.Remotes)
+			if tc.wantConfig == "" {
+				assert.Empty(t, resp.Config)
+			} else {
+				assert.JSONEq(t, tc.wantConfig, string(resp.Config))
+			}
+		})
+	}
+}
+
+func TestSaveCmdResultStoresExecutionMetadata(t *testing.T) {
+	jp, err := jobs.NewSqliteProvider(":memory:", testLog)
+	require.NoError(t, err)
+	defer jp.Close()
+
+	startedAt := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	finishedAt := startedAt.Add(time.Second)
+	exitCode := 2
+	job := jb.New(t).ClientID("client-1").Status(models.JobStatusRunning).StartedAt(startedAt).Build()
+	require.NoError(t, jp.CreateJob(job))
+
+	job.Status = models.JobStatusFailed
+	job.FinishedAt = &finishedAt
+	job.ExecutionMetadata = &models.ExecutionMetadata{
+		Hostname:   "host-1",
+		StartedAt:  startedAt,
+		FinishedAt: finishedAt,
+		ExitCode:   &exitCode,
+	}
+	result, err := json.Marshal(job)
+	require.NoError(t, err)
+
+	cl := ClientListener{
+		Logger: testLog,
+		Server: &Server{
+			jobProvider:     jp,
+			uiJobWebSockets: ws.NewWebSocketCache(),
+		},
+	}
+	_, err = cl.saveCmdResult(result)
+	require.NoError(t, err)
+
+	stored, err := jp.GetByJID(job.ClientID, job.JID)
+	require.NoError(t, err)
+	require.NotNil(t, stored)
+	assert.Equal(t, job.ExecutionMetadata, stored.ExecutionMetadata)
+	assert.Equal(t, models.JobStatusFailed, stored.Status)
+}
+
+func TestHandleSSHChannelsLimit(t *testing.T) {
+	// a backend holding accepted connections open, so channels stay open
+	backend, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer backend.Close()
+	go func() {
+		for {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(ioutil.Discard, conn)
+				conn.Close()
+			}()
+		}
+	}()
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	hostKey, err := ssh.NewSignerFromKey(privateKey)
+	require.NoError(t, err)
+	serverConfig := &ssh.ServerConfig{NoClientAuth: true}
+	serverConfig.AddHostKey(hostKey)
+
+	sshListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer sshListener.Close()
+	go func() {
+		serverNetConn, err := sshListener.Accept()
+		if err != nil {
+			return
+		}
+		_, chans, reqs, err := ssh.NewServerConn(serverNetConn, serverConfig)
+		if err != nil {
+			return
+		}
+		go ssh.DiscardRequests(reqs)
+		cl := &ClientListener{
+			Server: &Server{config: &Config{Server: ServerConfig{MaxChannelsPerClient: 2}}},
+			Logger: testLog,
+		}
+		cl.handleSSHChannels(testLog, chans)
+	}()
+
+	clientNetConn, err := net.Dial("tcp", sshListener.Addr().String())
+	require.NoError(t, err)
+	clientConn, _, clientReqs, err := ssh.NewClientConn(clientNetConn, "", &ssh.ClientConfig{
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	require.NoError(t, err)
+	defer clientConn.Close()
+	go ssh.DiscardRequests(clientReqs)
+
+	// open channels up to the cap
+	var channels []ssh.Channel
+	for i := 0; i < 2; i++ {
+		ch, reqs, err := clientConn.OpenChannel("rport", []byte(backend.Addr().String()))
+		require.NoError(t, err)
+		go ssh.DiscardRequests(reqs)
+		channels = append(channels, ch)
+	}
+
+	// the next one is rejected
+	_, _, err = clientConn.OpenChannel("rport", []byte(backend.Addr().String()))
+	require.Error(t, err)
+	var openErr *ssh.OpenChannelError
+	require.True(t, errors.As(err, &openErr))
+	assert.Equal(t, ssh.ResourceShortage, openErr.Reason)
+	assert.Equal(t, "max channels limit (2) is reached", openErr.Message)
+
+	// a closed channel frees a slot
+	require.NoError(t, channels[0].Close())
+	assert.Eventually(t, func() bool {
+		ch, reqs, err := clientConn.OpenChannel("rport", []byte(backend.Addr().String()))
+		if err != nil {
+			return false
+		}
+		go ssh.DiscardRequests(reqs)
+		ch.Close()
+		return true
+	}, 5*time.Second, 50*time.Millisecond)
+	channels[1].Close()
+}
+
+func TestHandleClientServerInfo(t *testing.T) {
+	testCases := []struct {
+		name         string
+		config       *Config
+		wantFeatures []string
+	}{
+		{
+			name:         "no features",
+			config:       &Config{},
+			wantFeatures: []string{},
+		},
+		{
+			name: "all features",
+			config: &Config{
+				Server: ServerConfig{
+					CommandSigningKey:     "/etc/rport/signing.key",
+					MaxJobResultSizeBytes: 1024,
+				},
+				PushedClientConfig: PushedClientConfig{KeepAlive: time.Minute},
+			},
+			wantFeatures: []string{comm.FeatureCommandSigning, comm.FeaturePushedClientConfig, comm.FeatureMaxJobResultSize},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			cl := &ClientListener{
+				Server:      &Server{config: tc.config},
+				Logger:      testLog,
+				fingerprint: "ab:cd",
+			}
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, comm.ServerInfoPath, nil)
+
+			cl.handleClient(w, req)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			wantJSON, err := json.Marshal(api.NewSuccessPayload(comm.ServerInfo{
+				Version:         chshare.BuildVersion,
+				ProtocolVersion: chshare.ProtocolVersion,
+				Fingerprint:     "ab:cd",
+				Features:        tc.wantFeatures,
+			}))
+			require.NoError(t, err)
+			assert.JSONEq(t, string(wantJSON), w.Body.String())
+		})
+	}
+}
+
+func TestWebsocketOriginValidation(t *testing.T) {
+	testCases := []struct {
+		name           string
+		allowedOrigins []string
+		allowedHosts   []string
+		origin         string
+		host           string
+		wantUpgrade    bool
+	}{
+		{
+			name:        "permissive by default",
+			origin:      "https://evil.example.com",
+			host:        "attacker.example.com",
+			wantUpgrade: true,
+		},
+		{
+			name:           "allowed origin",
+			allowedOrigins: []string{"https://rport.example.com/"},
+			origin:         "https://RPORT.example.com",
+			wantUpgrade:    true,
+		},
+		{
+			name:           "disallowed origin",
+			allowedOrigins: []string{"https://rport.example.com"},
+			origin:         "https://evil.example.com",
+		},
+		{
+			name:           "no origin, like rport clients",
+			allowedOrigins: []string{"https://rport.example.com"},
+			wantUpgrade:    true,
+		},
+		{
+			name:         "allowed host with any port",
+			allowedHosts: []string{"rport.example.com"},
+			host:         "rport.example.com:8080",
+			wantUpgrade:  true,
+		},
+		{
+			name:         "allowed host with port",
+			allowedHosts: []string{"rport.example.com:8080"},
+			host:         "rport.example.com:8080",
+			wantUpgrade:  true,
+		},
+		{
+			name:         "disallowed host",
+			allowedHosts: []string{"rport.example.com"},
+			host:         "rebind.attacker.com:8080",
+		},
+		{
+			name:         "disallowed port",
+			allowedHosts: []string{"rport.example.com:8080"},
+			host:         "rport.example.com:9090",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			cl := &ClientListener{
+				Logger: testLog,
+				Server: &Server{
+					config: &Config{
+						Server: ServerConfig{
+							AllowedOrigins: tc.allowedOrigins,
+							AllowedHosts:   tc.allowedHosts,
+						},
+					},
+				},
+				// no host keys, so the SSH handshake fails right after the upgrade
+				sshConfig: &ssh.ServerConfig{},
+			}
+			srv := httptest.NewServer(http.HandlerFunc(cl.handleWebsocket))
+			defer srv.Close()
+
+			header := http.Header{}
+			if tc.origin != "" {
+				header.Set("Origin", tc.origin)
+			}
+			if tc.host != "" {
+				header.Set("Host", tc.host)
+			}
+			conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), header)
+			if tc.wantUpgrade {
+				require.NoError(t, err)
+				conn.Close()
+				assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+			} else {
+				require.Error(t, err)
+				assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+			}
+		})
+	}
+}
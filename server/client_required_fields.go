@@ -0,0 +1,70 @@
+package chserver
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	chshare "github.com/cloudradar-monitoring/rport/share"
+)
+
+const (
+	MissingClientFieldsReject = "reject"
+	MissingClientFieldsWarn   = "warn"
+)
+
+// clientUnknownValue is reported by clients for fields they failed to detect.
+const clientUnknownValue = "unknown"
+
+// requiredClientFieldGetters returns values of connection request fields that can be required, keyed by client json field names.
+var requiredClientFieldGetters = map[string]func(req *chshare.ConnectionRequest) string{
+	"name":                     func(req *chshare.ConnectionRequest) string { return req.Name },
+	"os":                       func(req *chshare.ConnectionRequest) string { return req.OS },
+	"os_full_name":             func(req *chshare.ConnectionRequest) string { return req.OSFullName },
+	"os_version":               func(req *chshare.ConnectionRequest) string { return req.OSVersion },
+	"os_virtualization_system": func(req *chshare.ConnectionRequest) string { return req.OSVirtualizationSystem },
+	"os_virtualization_role":   func(req *chshare.ConnectionRequest) string { return req.OSVirtualizationRole },
+	"os_arch":                  func(req *chshare.ConnectionRequest) string { return req.OSArch },
+	"os_family":                func(req *chshare.ConnectionRequest) string { return req.OSFamily },
+	"os_kernel":                func(req *chshare.ConnectionRequest) string { return req.OSKernel },
+	"version":                  func(req *chshare.ConnectionRequest) string { return req.Version },
+	"hostname":                 func(req *chshare.ConnectionRequest) string { return req.Hostname },
+	"cpu_family":               func(req *chshare.ConnectionRequest) string { return req.CPUFamily },
+	"cpu_model":                func(req *chshare.ConnectionRequest) string { return req.CPUModel },
+	"cpu_model_name":           func(req *chshare.ConnectionRequest) string { return req.CPUModelName },
+	"cpu_vendor":               func(req *chshare.ConnectionRequest) string { return req.CPUVendor },
+	"timezone":                 func(req *chshare.ConnectionRequest) string { return req.Timezone },
+	"environment":              func(req *chshare.ConnectionRequest) string { return req.Environment },
+	"package_manager":          func(req *chshare.ConnectionRequest) string { return req.PackageManager },
+}
+
+// validateRequiredClientFields returns an error if any of given fields can't be required.
+func validateRequiredClientFields(fields []string) error {
+	for _, field := range fields {
+		if _, ok := requiredClientFieldGetters[field]; !ok {
+			supported := make([]string, 0, len(requiredClientFieldGetters))
+			for name := range requiredClientFieldGetters {
+				supported = append(supported, name)
+			}
+			sort.Strings(supported)
+			return fmt.Errorf("unsupported field %q, expected one of: %s", field, strings.Join(supported, ", "))
+		}
+	}
+	return nil
+}
+
+// missingClientFields returns required fields that are empty or unknown in a given connection request.
+func missingClientFields(req *chshare.ConnectionRequest, required []string) []string {
+	var missing []string
+	for _, field := range required {
+		getter, ok := requiredClientFieldGetters[field]
+		if !ok {
+			continue
+		}
+		v := strings.TrimSpace(getter(req))
+		if v == "" || strings.EqualFold(v, clientUnknownValue) {
+			missing = append(missing, field)
+		}
+	}
+	return missing
+}
@@ -2,6 +2,7 @@ package chserver
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
@@ -16,21 +17,53 @@ import (
 	"github.com/cloudradar-monitoring/rport/server/api/errors"
 	"github.com/cloudradar-monitoring/rport/server/cgroups"
 	"github.com/cloudradar-monitoring/rport/server/clients"
+	"github.com/cloudradar-monitoring/rport/server/hooks"
 	"github.com/cloudradar-monitoring/rport/server/ports"
 	chshare "github.com/cloudradar-monitoring/rport/share"
 	"github.com/cloudradar-monitoring/rport/share/models"
 	"github.com/cloudradar-monitoring/rport/share/query"
 )
 
+// ClientRegistry records ids of all clients that have ever connected.
+type ClientRegistry interface {
+	// Register returns true if a given client id is seen for the first time
+	Register(ctx context.Context, id string) (bool, error)
+}
+
 type ClientService struct {
 	repo            *clients.ClientRepository
 	portDistributor *ports.PortDistributor
+	// allowedEnvironments is a list of environments clients can report, if empty - all are allowed
+	allowedEnvironments []string
+	// requiredFields are connection request fields clients must report, see requiredClientFieldGetters
+	requiredFields []string
+	// warnOnMissingFields accepts clients with missing required fields logging a warning instead of rejecting them
+	warnOnMissingFields bool
+	tunnelConflicts     tunnelConflicts
+	// tunnelCopyLimiter bounds data copies of all tunnels, nil if unlimited
+	tunnelCopyLimiter *clients.CopyLimiter
+	// tunnelConnDeadlines are read and write deadlines of tunnel connections to reap half-open ones
+	tunnelConnDeadlines clients.ConnDeadlines
+	// tunnelConnLogging defines how opened and closed tunnel connections are logged
+	tunnelConnLogging clients.ConnLogging
+	// tunnelProxyTLS is used to serve https tunnels guarded by basic auth, nil if the API has no TLS certificate
+	tunnelProxyTLS *tls.Config
+	// autoTagger computes tags of clients by configured rules, nil if there are no rules
+	autoTagger *clients.AutoTagger
+	// registrationHook is fired when a client connects for the first time, nil if not configured
+	registrationHook *hooks.RegistrationHook
+	// stateWebhook is fired when a client connects or disconnects, nil if not configured
+	stateWebhook *hooks.ClientStateWebhook
+	// clientRegistry records ids of clients that have ever connected, nil if not used
+	clientRegistry ClientRegistry
 
 	mu sync.Mutex
 }
 
 var clientsSupportedFields = map[string]bool{
 	"os_full_name":             true,
+	"os_family":                true,
+	"os_kernel":                true,
 	"os_virtualization_system": true,
 	"os_virtualization_role":   true,
 	"cpu_model_name":           true,
@@ -39,6 +72,33 @@ var clientsSupportedFields = map[string]bool{
 	"cpu_family":               true,
 	"cpu_model":                true,
 	"num_cpus":                 true,
+	"environment":              true,
+	"package_manager":          true,
+	"health":                   true,
+	"connection_state":         true,
+}
+
+// validateClientsFilterOptions returns errors of unsupported filter fields and invalid connection state values.
+func validateClientsFilterOptions(filterOptions []query.FilterOption) errors.APIErrors {
+	errs := query.ValidateFilterOptions(filterOptions, clientsSupportedFields)
+	for _, fo := range filterOptions {
+		if fo.Column != clients.ConnectionStateField {
+			continue
+		}
+		for _, v := range fo.Values {
+			if v != string(clients.Connected) && v != string(clients.Disconnected) {
+				errs = append(errs, errors.APIError{
+					Message:    fmt.Sprintf("invalid %s filter value %q, expected %q or %q", clients.ConnectionStateField, v, clients.Connected, clients.Disconnected),
+					HTTPStatus: http.StatusBadRequest,
+				})
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
 }
 
 // NewClientService returns a new instance of client service.
@@ -57,9 +117,10 @@ func InitClientService(
 	portDistributor *ports.PortDistributor,
 	provider clients.ClientProvider,
 	keepLostClients *time.Duration,
+	maxCachedDisconnected int,
 	logger *chshare.Logger,
 ) (*ClientService, error) {
-	repo, err := clients.InitClientRepository(ctx, provider, keepLostClients, logger)
+	repo, err := clients.InitClientRepository(ctx, provider, keepLostClients, maxCachedDisconnected, logger)
 	if err != nil {
 		return nil, fmt.Errorf("failed to init Client Repository: %v", err)
 	}
@@ -126,10 +187,23 @@ func (s *ClientService) GetAll() ([]*clients.Client, error) {
 	return s.repo.GetAll()
 }
 
+// GetActiveByTags returns active clients having any of given tags, wildcards are supported.
+func (s *ClientService) GetActiveByTags(tags []string) ([]*clients.Client, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	return s.repo.GetActiveFiltered([]query.FilterOption{{Column: "tags", Values: tags}})
+}
+
 func (s *ClientService) GetUserClients(user clients.User, filterOptions []query.FilterOption) ([]*clients.Client, error) {
 	return s.repo.GetUserClients(user, filterOptions)
 }
 
+// GetUserParkedClients returns parked clients that a given user has access to, filtered by parameters.
+func (s *ClientService) GetUserParkedClients(user clients.User, filterOptions []query.FilterOption) ([]*clients.Client, error) {
+	return s.repo.GetUserParkedClients(user, filterOptions)
+}
+
 func (s *ClientService) StartClient(
 	ctx context.Context, clientAuthID, clientID string, sshConn ssh.Conn, authMultiuseCreds bool,
 	req *chshare.ConnectionRequest, clog *chshare.Logger,
@@ -142,6 +216,10 @@ func (s *ClientService) StartClient(
 	if err != nil {
 		return nil, fmt.Errorf("failed to get client by id %q", clientID)
 	}
+	if oldClient == nil {
+		// a parked client keeps its state when it reconnects
+		oldClient = s.repo.GetParkedByID(clientID)
+	}
 	if oldClient != nil {
 		if oldClient.DisconnectedAt == nil {
 			return nil, fmt.Errorf("client id %q is already in use", clientID)
@@ -155,6 +233,17 @@ func (s *ClientService) StartClient(
 		}
 	}
 
+	if !s.isEnvironmentAllowed(req.Environment) {
+		return nil, fmt.Errorf("environment %q is not allowed", req.Environment)
+	}
+
+	if missing := missingClientFields(req, s.requiredFields); len(missing) > 0 {
+		if !s.warnOnMissingFields {
+			return nil, fmt.Errorf("missing required fields: %s", strings.Join(missing, ", "))
+		}
+		clog.Infof("Warning: accepting client with missing required fields: %s", strings.Join(missing, ", "))
+	}
+
 	// check if client auth ID is already used by another client
 	if !authMultiuseCreds && s.isClientAuthIDInUse(clientAuthID, clientID) {
 		return nil, fmt.Errorf("client auth ID is already in use: %q", clientAuthID)
@@ -188,6 +277,10 @@ func (s *ClientService) StartClient(
 		IPv4:                   req.IPv4,
 		IPv6:                   req.IPv6,
 		Tags:                   req.Tags,
+		Environment:            req.Environment,
+		CommandsDisabled:       req.CommandsDisabled,
+		PackageManager:         req.PackageManager,
+		Interpreters:           req.Interpreters,
 		Version:                req.Version,
 		Address:                clientHost,
 		Tunnels:                make([]*clients.Tunnel, 0),
@@ -196,23 +289,56 @@ func (s *ClientService) StartClient(
 		Connection:             sshConn,
 		Context:                ctx,
 		Logger:                 clog,
+		AcceptsUDPTunnels:      req.AcceptsUDPTunnels,
+	}
+	client.NormalizeOS()
+	if !req.BootTime.IsZero() {
+		client.BootTime = &req.BootTime
 	}
 	if oldClient != nil {
 		client.UpdatesStatus = oldClient.UpdatesStatus
+		client.PreviousBootTime = oldClient.PreviousBootTime
+		if rebooted(oldClient.BootTime, client.BootTime) {
+			clog.Infof("Client was rebooted, boot time changed from %v to %v", oldClient.BootTime.Format(time.RFC3339), client.BootTime.Format(time.RFC3339))
+			client.PreviousBootTime = oldClient.BootTime
+		}
 	}
+	client.AutoTags = s.autoTagger.Tags(client)
 
 	_, err = s.startClientTunnels(client, req.Remotes)
 	if err != nil {
 		return nil, err
 	}
 
-	err = s.repo.Save(client)
+	// connect-time saves go to the storage in the background if enabled, so reconnect storms don't wait for the DB
+	err = s.repo.SaveAsync(client)
 	if err != nil {
 		return nil, err
 	}
+	s.fireStateWebhook(client, hooks.ClientStateConnected)
+
+	if s.clientRegistry != nil {
+		first, err := s.clientRegistry.Register(ctx, client.ID)
+		if err != nil {
+			clog.Errorf("Failed to register client: %v", err)
+		} else if first && s.registrationHook != nil {
+			s.registrationHook.Fire(client.ID, convertToClientPayload(client))
+		}
+	}
 	return client, nil
 }
 
+// bootTimeTolerance is the max difference of boot times reported by the same system, some systems compute it from uptime
+const bootTimeTolerance = 10 * time.Second
+
+// rebooted returns true if a boot time has advanced, false if any of them is unknown.
+func rebooted(prevBootTime, bootTime *time.Time) bool {
+	if prevBootTime == nil || bootTime == nil {
+		return false
+	}
+	return bootTime.Sub(*prevBootTime) > bootTimeTolerance
+}
+
 // StartClientTunnels returns a new tunnel for each requested remote or nil if error occurred
 func (s *ClientService) StartClientTunnels(client *clients.Client, remotes []*chshare.Remote) ([]*clients.Tunnel, error) {
 	s.mu.Lock()
@@ -236,22 +362,19 @@ func (s *ClientService) startClientTunnels(client *clients.Client, remotes []*ch
 		return nil, err
 	}
 
-	tunnels := make([]*clients.Tunnel, 0, len(remotes))
-	for _, remote := range remotes {
-		if !remote.IsLocalSpecified() {
-			port, err := s.portDistributor.GetRandomPort()
-			if err != nil {
-				return nil, err
-			}
-			remote.LocalPort = strconv.Itoa(port)
-			remote.LocalHost = "0.0.0.0"
-			remote.LocalPortRandom = true
-		} else {
-			if err := s.checkLocalPort(remote.LocalPort); err != nil {
-				return nil, err
+	if !client.AcceptsUDPTunnels {
+		for _, remote := range remotes {
+			if remote.IsUDP() {
+				return nil, errors.APIError{
+					HTTPStatus: http.StatusBadRequest,
+					Message:    fmt.Sprintf("client %s doesn't support UDP tunnels, update it to use them", client.ID),
+				}
 			}
 		}
+	}
 
+	tunnels := make([]*clients.Tunnel, 0, len(remotes))
+	for _, remote := range remotes {
 		var acl *clients.TunnelACL
 		if remote.ACL != nil {
 			var err error
@@ -261,18 +384,102 @@ func (s *ClientService) startClientTunnels(client *clients.Client, remotes []*ch
 			}
 		}
 
-		t, err := client.StartTunnel(remote, acl)
+		var t *clients.Tunnel
+		if !remote.IsLocalSpecified() {
+			t, err = s.startTunnelOnRandomPort(client, remote, acl)
+			if _, ok := err.(errNoRandomPort); ok {
+				return nil, err
+			}
+		} else {
+			if err := s.checkLocalPort(remote.LocalPort); err != nil {
+				if apiErr, ok := err.(errors.APIError); ok && apiErr.HTTPStatus == http.StatusConflict {
+					s.addTunnelConflict(client, remote, apiErr.Message)
+				}
+				return nil, err
+			}
+			t, err = client.StartTunnel(remote, acl, s.tunnelCopyLimiter, s.tunnelConnDeadlines, s.tunnelConnLogging, s.tunnelProxyTLS)
+		}
 		if err != nil {
+			s.addTunnelConflict(client, remote, err.Error())
 			return nil, errors.APIError{
 				HTTPStatus: http.StatusConflict,
 				Err:        fmt.Errorf("can't create tunnel: %s", err),
 			}
 		}
+		s.tunnelConflicts.Resolve(client.ID, remote.LocalPort)
 		tunnels = append(tunnels, t)
 	}
 	return tunnels, nil
 }
 
+// randomPortAttempts is a max number of random ports tried to start a tunnel on.
+const randomPortAttempts = 3
+
+// errNoRandomPort is returned if there are no free allowed ports to start a tunnel on.
+type errNoRandomPort struct {
+	error
+}
+
+// startTunnelOnRandomPort starts a tunnel on a random allowed port. The port is bound by the tunnel listener and set
+// to the tunnel. Another process can take a port after the pool of free ports was refreshed, so a next one is tried then.
+func (s *ClientService) startTunnelOnRandomPort(client *clients.Client, remote *chshare.Remote, acl *clients.TunnelACL) (*clients.Tunnel, error) {
+	var lastErr error
+	for i := 0; i < randomPortAttempts; i++ {
+		port, err := s.portDistributor.GetRandomPort()
+		if err != nil {
+			if lastErr != nil {
+				return nil, lastErr
+			}
+			return nil, errNoRandomPort{err}
+		}
+		remote.LocalPort = strconv.Itoa(port)
+		remote.LocalHost = "0.0.0.0"
+		remote.LocalPortRandom = true
+
+		t, err := client.StartTunnel(remote, acl, s.tunnelCopyLimiter, s.tunnelConnDeadlines, s.tunnelConnLogging, s.tunnelProxyTLS)
+		if err == nil {
+			return t, nil
+		}
+		client.Logger.Debugf("Failed to start tunnel on random port %d: %v", port, err)
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// addTunnelConflict records a tunnel that failed to start on a requested server local port.
+func (s *ClientService) addTunnelConflict(client *clients.Client, remote *chshare.Remote, errMsg string) {
+	conflict := &TunnelConflict{
+		ClientID:      client.ID,
+		LocalPort:     remote.LocalPort,
+		Remote:        remote.Remote(),
+		OwnerClientID: s.findLocalPortOwner(remote.LocalPort),
+		Error:         errMsg,
+		RequestedAt:   time.Now(),
+	}
+	s.tunnelConflicts.Add(conflict)
+
+	if client.Logger != nil {
+		client.Logger.Infof("Tunnel %s conflicts on local port %s, held by client %q: %s", remote, remote.LocalPort, conflict.OwnerClientID, errMsg)
+	}
+}
+
+// findLocalPortOwner returns an ID of an active client that has a tunnel on a given server local port.
+func (s *ClientService) findLocalPortOwner(localPort string) string {
+	for _, cur := range s.repo.GetAllActive() {
+		for _, t := range cur.Tunnels {
+			if t.LocalPort == localPort {
+				return cur.ID
+			}
+		}
+	}
+	return ""
+}
+
+// GetTunnelConflicts returns tunnels that failed to start because their server local port is taken.
+func (s *ClientService) GetTunnelConflicts() []*TunnelConflict {
+	return s.tunnelConflicts.GetAll()
+}
+
 func (s *ClientService) checkLocalPort(port string) error {
 	localPort, err := strconv.Atoi(port)
 	if err != nil {
@@ -303,8 +510,13 @@ func (s *ClientService) checkLocalPort(port string) error {
 func (s *ClientService) Terminate(client *clients.Client) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	client.DisconnectReason = client.CloseReason()
 	if s.repo.KeepLostClients == nil {
-		return s.repo.Delete(client)
+		if err := s.repo.Delete(client); err != nil {
+			return err
+		}
+		s.fireStateWebhook(client, hooks.ClientStateDisconnected)
+		return nil
 	}
 
 	now := time.Now()
@@ -318,7 +530,33 @@ func (s *ClientService) Terminate(client *clients.Client) error {
 	if existing == nil {
 		return nil
 	}
-	return s.repo.Save(client)
+	if err := s.repo.Save(client); err != nil {
+		return err
+	}
+	s.fireStateWebhook(client, hooks.ClientStateDisconnected)
+	return nil
+}
+
+// fireStateWebhook notifies the state webhook about a new state of a given client if it's configured.
+func (s *ClientService) fireStateWebhook(client *clients.Client, state string) {
+	if s.stateWebhook == nil {
+		return
+	}
+	s.stateWebhook.Fire(&hooks.ClientStateEvent{
+		ClientID:   client.ID,
+		ClientName: client.Name,
+		Tags:       client.Tags,
+		AutoTags:   client.AutoTags,
+		State:      state,
+		Timestamp:  time.Now().UTC(),
+	})
+}
+
+// OnObsoleteDeleted notifies the state webhook about given obsolete clients deleted by the cleanup task.
+func (s *ClientService) OnObsoleteDeleted(deleted []*clients.Client) {
+	for _, client := range deleted {
+		s.fireStateWebhook(client, hooks.ClientStateDeleted)
+	}
 }
 
 // ForceDelete deletes client from repo regardless off KeepLostClients setting,
@@ -327,7 +565,7 @@ func (s *ClientService) ForceDelete(client *clients.Client) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	if client.DisconnectedAt == nil {
-		if err := client.Close(); err != nil {
+		if err := client.CloseWithReason(clients.DisconnectReasonForceDeleted); err != nil {
 			return err
 		}
 	}
@@ -335,6 +573,10 @@ func (s *ClientService) ForceDelete(client *clients.Client) error {
 }
 
 func (s *ClientService) DeleteOffline(clientID string) error {
+	if parked := s.repo.GetParkedByID(clientID); parked != nil {
+		return s.repo.Delete(parked)
+	}
+
 	existing, err := s.getExistingByID(clientID)
 	if err != nil {
 		return err
@@ -350,6 +592,23 @@ func (s *ClientService) DeleteOffline(clientID string) error {
 	return s.repo.Delete(existing)
 }
 
+// Unpark restores a parked client with a given id as a disconnected one.
+func (s *ClientService) Unpark(clientID string) (*clients.Client, error) {
+	unparked, err := s.repo.Unpark(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	if unparked == nil {
+		return nil, errors.APIError{
+			Message:    fmt.Sprintf("Parked client with id=%q not found.", clientID),
+			HTTPStatus: http.StatusNotFound,
+		}
+	}
+
+	return unparked, nil
+}
+
 // isClientAuthIDInUse returns true when the client with different id exists for the client auth
 func (s *ClientService) isClientAuthIDInUse(clientAuthID, clientID string) bool {
 	for _, s := range s.repo.GetAllByClientAuthID(clientAuthID) {
@@ -360,6 +619,19 @@ func (s *ClientService) isClientAuthIDInUse(clientAuthID, clientID string) bool
 	return false
 }
 
+// isEnvironmentAllowed returns true when a given environment is in the list of allowed environments or the list is empty
+func (s *ClientService) isEnvironmentAllowed(environment string) bool {
+	if len(s.allowedEnvironments) == 0 {
+		return true
+	}
+	for _, cur := range s.allowedEnvironments {
+		if cur == environment {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *ClientService) SetACL(clientID string, allowedUserGroups []string) error {
 	existing, err := s.getExistingByID(clientID)
 	if err != nil {
@@ -378,18 +650,48 @@ func (s *ClientService) SetUpdatesStatus(clientID string, updatesStatus *models.
 	}
 
 	existing.UpdatesStatus = updatesStatus
+	existing.AutoTags = s.autoTagger.Tags(existing)
 
 	return s.repo.Save(existing)
 }
 
-// CheckClientAccess returns nil if a given user has an access to a given client.
-// Otherwise, APIError with 403 is returned.
-func (s *ClientService) CheckClientAccess(clientID string, user clients.User) error {
+func (s *ClientService) SetTags(clientID string, tags []string) error {
 	existing, err := s.getExistingByID(clientID)
 	if err != nil {
 		return err
 	}
 
+	existing.Tags = tags
+	existing.AutoTags = s.autoTagger.Tags(existing)
+
+	return s.repo.Save(existing)
+}
+
+func (s *ClientService) SetHealthStatus(clientID string, healthStatus *models.HealthStatus) error {
+	existing, err := s.getExistingByID(clientID)
+	if err != nil {
+		return err
+	}
+
+	existing.Health = healthStatus.State
+	existing.HealthStatus = healthStatus
+	existing.AutoTags = s.autoTagger.Tags(existing)
+
+	return s.repo.Save(existing)
+}
+
+// CheckClientAccess returns nil if a given user has an access to a given client.
+// Otherwise, APIError with 403 is returned.
+func (s *ClientService) CheckClientAccess(clientID string, user clients.User) error {
+	existing := s.repo.GetParkedByID(clientID)
+	if existing == nil {
+		var err error
+		existing, err = s.getExistingByID(clientID)
+		if err != nil {
+			return err
+		}
+	}
+
 	return s.CheckClientsAccess([]*clients.Client{existing}, user)
 }
 
@@ -2,10 +2,12 @@ package chserver
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"strconv"
 	"strings"
 	"testing"
@@ -18,8 +20,11 @@ import (
 	errors2 "github.com/cloudradar-monitoring/rport/server/api/errors"
 	"github.com/cloudradar-monitoring/rport/server/api/users"
 	"github.com/cloudradar-monitoring/rport/server/clients"
+	"github.com/cloudradar-monitoring/rport/server/hooks"
 	"github.com/cloudradar-monitoring/rport/server/ports"
 	chshare "github.com/cloudradar-monitoring/rport/share"
+	"github.com/cloudradar-monitoring/rport/share/models"
+	"github.com/cloudradar-monitoring/rport/share/query"
 	"github.com/cloudradar-monitoring/rport/share/test"
 )
 
@@ -98,6 +103,446 @@ func TestStartClient(t *testing.T) {
 	}
 }
 
+func TestStartClientWithEnvironment(t *testing.T) {
+	connMock := test.NewConnMock()
+	connMock.ReturnRemoteAddr = &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 2345}
+
+	testCases := []struct {
+		Name                string
+		AllowedEnvironments []string
+		Environment         string
+		ExpectedError       error
+	}{
+		{
+			Name:        "no allowlist",
+			Environment: "dev",
+		}, {
+			Name:                "allowed environment",
+			AllowedEnvironments: []string{"staging", "prod"},
+			Environment:         "prod",
+		}, {
+			Name:                "not allowed environment",
+			AllowedEnvironments: []string{"staging", "prod"},
+			Environment:         "dev",
+			ExpectedError:       errors.New(`environment "dev" is not allowed`),
+		}, {
+			Name:                "empty environment with allowlist",
+			AllowedEnvironments: []string{"staging", "prod"},
+			ExpectedError:       errors.New(`environment "" is not allowed`),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			cs := &ClientService{
+				repo:                clients.NewClientRepository(nil, nil, testLog),
+				portDistributor:     ports.NewPortDistributor(mapset.NewThreadUnsafeSet()),
+				allowedEnvironments: tc.AllowedEnvironments,
+			}
+			client, err := cs.StartClient(
+				context.Background(), "test-client-auth", "test-client", connMock, false,
+				&chshare.ConnectionRequest{Environment: tc.Environment}, testLog)
+			assert.Equal(t, tc.ExpectedError, err)
+			if tc.ExpectedError != nil {
+				return
+			}
+
+			require.NotNil(t, client)
+			assert.Equal(t, tc.Environment, client.Environment)
+			assert.Equal(t, tc.Environment, convertToClientPayload(client).Environment)
+		})
+	}
+}
+
+func TestStartClientWithRequiredFields(t *testing.T) {
+	connMock := test.NewConnMock()
+	connMock.ReturnRemoteAddr = &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 2345}
+	fullReq := chshare.ConnectionRequest{OS: "Linux host 5.4.0 x86_64 GNU/Linux", Hostname: "host"}
+	unknownHostnameReq := chshare.ConnectionRequest{OS: "Linux host 5.4.0 x86_64 GNU/Linux", Hostname: "unknown"}
+	allUnknownReq := chshare.ConnectionRequest{OS: "unknown", Hostname: "unknown"}
+
+	testCases := []struct {
+		Name          string
+		Required      []string
+		Warn          bool
+		Req           chshare.ConnectionRequest
+		ExpectedError error
+	}{
+		{
+			Name: "nothing required",
+			Req:  allUnknownReq,
+		}, {
+			Name:     "all required fields reported",
+			Required: []string{"os", "hostname"},
+			Req:      fullReq,
+		}, {
+			Name:          "unknown required field",
+			Required:      []string{"os", "hostname"},
+			Req:           unknownHostnameReq,
+			ExpectedError: errors.New("missing required fields: hostname"),
+		}, {
+			Name:          "empty required field",
+			Required:      []string{"os", "hostname", "os_family"},
+			Req:           fullReq,
+			ExpectedError: errors.New("missing required fields: os_family"),
+		}, {
+			Name:          "all required fields unknown",
+			Required:      []string{"os", "hostname"},
+			Req:           allUnknownReq,
+			ExpectedError: errors.New("missing required fields: os, hostname"),
+		}, {
+			Name:     "accept with warning",
+			Required: []string{"os", "hostname"},
+			Warn:     true,
+			Req:      allUnknownReq,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.Name, func(t *testing.T) {
+			cs := &ClientService{
+				repo:                clients.NewClientRepository(nil, nil, testLog),
+				portDistributor:     ports.NewPortDistributor(mapset.NewThreadUnsafeSet()),
+				requiredFields:      tc.Required,
+				warnOnMissingFields: tc.Warn,
+			}
+			client, err := cs.StartClient(
+				context.Background(), "test-client-auth", "test-client", connMock, false, &tc.Req, testLog)
+			assert.Equal(t, tc.ExpectedError, err)
+			if tc.ExpectedError != nil {
+				assert.Nil(t, client)
+				return
+			}
+
+			require.NotNil(t, client)
+			assert.Equal(t, tc.Req.Hostname, client.Hostname)
+		})
+	}
+}
+
+func TestStartClientNormalizesOS(t *testing.T) {
+	connMock := test.NewConnMock()
+	connMock.ReturnRemoteAddr = &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 2345}
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := pc.LocalAddr().(*net.UDPAddr).Port
+	require.NoError(t, pc.Close())
+
+	cs := &ClientService{
+		repo:            clients.NewClientRepository(nil, nil, testLog),
+		portDistributor: ports.NewPortDistributor(mapset.NewThreadUnsafeSetFromSlice([]interface{}{port})),
+	}
+
+	client, err := cs.StartClient(
+		context.Background(), "test-client-auth", "test-client", connMock, false,
+		&chshare.ConnectionRequest{
+			OS:         "Linux host 5.4.0 x86_64 GNU/Linux",
+			OSFamily:   "Debian",
+			OSKernel:   "LINUX",
+			OSFullName: "UBUNTU 18.04",
+			OSVersion:  "18.04",
+		}, testLog)
+	require.NoError(t, err)
+
+	assert.Equal(t, "debian", client.OSFamily)
+	assert.Equal(t, "linux", client.OSKernel)
+	assert.Equal(t, "Ubuntu 18.04", client.OSFullName)
+	require.NotNil(t, client.OSRaw)
+	assert.Equal(t, "UBUNTU 18.04", client.OSRaw.OSFullName)
+
+	admin := &users.User{Groups: []string{users.Administrators}}
+	for _, filter := range []query.FilterOption{
+		{Column: "os_full_name", Values: []string{"Ubuntu 18.04"}},
+		{Column: "os_family", Values: []string{"debian"}},
+		{Column: "os_kernel", Values: []string{"linux"}},
+	} {
+		got, err := cs.GetUserClients(admin, []query.FilterOption{filter})
+		require.NoError(t, err)
+		assert.Equal(t, []*clients.Client{client}, got, filter.Column)
+	}
+}
+
+func TestStartClientDetectsReboot(t *testing.T) {
+	connMock := test.NewConnMock()
+	connMock.ReturnRemoteAddr = &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 2345}
+	cs := &ClientService{
+		repo:            clients.NewClientRepository(nil, &hour, testLog),
+		portDistributor: ports.NewPortDistributor(mapset.NewThreadUnsafeSet()),
+	}
+	bootTime1 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	bootTime2 := time.Date(2021, 1, 5, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name                 string
+		bootTime             time.Time
+		wantBootTime         *time.Time
+		wantPreviousBootTime *time.Time
+	}{
+		{
+			name:         "first connect",
+			bootTime:     bootTime1,
+			wantBootTime: &bootTime1,
+		},
+		{
+			name:         "reconnect without reboot",
+			bootTime:     bootTime1.Add(time.Second),
+			wantBootTime: timePtr(bootTime1.Add(time.Second)),
+		},
+		{
+			name:                 "reconnect after reboot",
+			bootTime:             bootTime2,
+			wantBootTime:         &bootTime2,
+			wantPreviousBootTime: timePtr(bootTime1.Add(time.Second)),
+		},
+		{
+			name:                 "reconnect without reboot keeps the previous boot time",
+			bootTime:             bootTime2,
+			wantBootTime:         &bootTime2,
+			wantPreviousBootTime: timePtr(bootTime1.Add(time.Second)),
+		},
+		{
+			name:                 "unknown boot time",
+			wantPreviousBootTime: timePtr(bootTime1.Add(time.Second)),
+		},
+	}
+
+	for _, tc := range testCases {
+		client, err := cs.StartClient(
+			context.Background(), "test-client-auth", "test-client", connMock, false,
+			&chshare.ConnectionRequest{BootTime: tc.bootTime}, testLog)
+		require.NoError(t, err, tc.name)
+
+		assert.Equal(t, tc.wantBootTime, client.BootTime, tc.name)
+		assert.Equal(t, tc.wantPreviousBootTime, client.PreviousBootTime, tc.name)
+		require.NoError(t, cs.Terminate(client), tc.name)
+	}
+}
+
+func TestStartParkedClient(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, l.Close())
+
+	parkedAt := time.Date(2021, 1, 5, 0, 0, 0, 0, time.UTC)
+	bootTime := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	parked := clients.New(t).ID("client-1").DisconnectedDuration(2 * hour).Build()
+	parked.ParkedAt = &parkedAt
+	parked.PreviousBootTime = &bootTime
+	parked.UpdatesStatus = &models.UpdatesStatus{UpdatesAvailable: 3}
+	parked.Tunnels = []*clients.Tunnel{{
+		ID: "1",
+		Remote: chshare.Remote{
+			LocalHost:  "127.0.0.1",
+			LocalPort:  strconv.Itoa(port),
+			RemoteHost: "127.0.0.1",
+			RemotePort: "22",
+			Protocol:   chshare.ProtocolTCP,
+		},
+	}}
+	connMock := test.NewConnMock()
+	connMock.ReturnRemoteAddr = &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 2345}
+	cs := &ClientService{
+		repo:            clients.NewClientRepository([]*clients.Client{parked}, &hour, testLog),
+		portDistributor: ports.NewPortDistributor(mapset.NewThreadUnsafeSetFromSlice([]interface{}{port})),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client, err := cs.StartClient(ctx, "auth-1", "client-1", connMock, false, &chshare.ConnectionRequest{}, testLog)
+	require.NoError(t, err)
+
+	assert.Nil(t, client.ParkedAt)
+	assert.Equal(t, &bootTime, client.PreviousBootTime)
+	assert.Equal(t, parked.UpdatesStatus, client.UpdatesStatus)
+	require.Len(t, client.Tunnels, 1)
+	assert.Equal(t, "127.0.0.1:22", client.Tunnels[0].Remote.Remote())
+	assert.Nil(t, cs.repo.GetParkedByID(client.ID))
+	got, err := cs.repo.GetByID(client.ID)
+	require.NoError(t, err)
+	assert.Equal(t, client, got)
+	require.NoError(t, cs.Terminate(client))
+}
+
+func timePtr(t time.Time) *time.Time {
+	return &t
+}
+
+func TestStartClientRegistrationHook(t *testing.T) {
+	calls := make(chan ClientPayload, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var got ClientPayload
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		calls <- got
+	}))
+	defer srv.Close()
+
+	registry, err := clients.NewSqliteProvider(":memory:", 0)
+	require.NoError(t, err)
+	defer registry.Close()
+
+	connMock := test.NewConnMock()
+	connMock.ReturnRemoteAddr = &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 2345}
+	cs := &ClientService{
+		// disconnected clients are not kept, so a reconnecting client is unknown to the repo
+		repo:             clients.NewClientRepository(nil, nil, testLog),
+		portDistributor:  ports.NewPortDistributor(mapset.NewThreadUnsafeSet()),
+		registrationHook: hooks.NewRegistrationHook(srv.URL, "", 0, time.Second, testLog),
+		clientRegistry:   registry,
+	}
+	req := &chshare.ConnectionRequest{Name: "Client 1", Hostname: "host-1"}
+
+	// first connect
+	client, err := cs.StartClient(context.Background(), "auth-1", "client-1", connMock, false, req, testLog)
+	require.NoError(t, err)
+	select {
+	case got := <-calls:
+		assert.Equal(t, "client-1", got.ID)
+		assert.Equal(t, "Client 1", got.Name)
+		assert.Equal(t, "host-1", got.Hostname)
+		assert.Equal(t, "192.0.2.1", got.Address)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "registration hook is not called")
+	}
+
+	// reconnect of the same client
+	require.NoError(t, cs.Terminate(client))
+	_, err = cs.StartClient(context.Background(), "auth-1", "client-1", connMock, false, req, testLog)
+	require.NoError(t, err)
+
+	// another new client
+	_, err = cs.StartClient(context.Background(), "auth-1", "client-2", connMock, true, req, testLog)
+	require.NoError(t, err)
+	select {
+	case got := <-calls:
+		assert.Equal(t, "client-2", got.ID)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "registration hook is not called")
+	}
+	assert.Empty(t, calls)
+}
+
+func TestClientStateWebhook(t *testing.T) {
+	events := make(chan hooks.ClientStateEvent, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var got hooks.ClientStateEvent
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		events <- got
+	}))
+	defer srv.Close()
+
+	connMock := test.NewConnMock()
+	connMock.ReturnRemoteAddr = &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 2345}
+	cs := &ClientService{
+		repo:            clients.NewClientRepository(nil, &hour, testLog),
+		portDistributor: ports.NewPortDistributor(mapset.NewThreadUnsafeSet()),
+		stateWebhook:    hooks.NewClientStateWebhook([]string{srv.URL}, "", 0, time.Second, testLog),
+	}
+	req := &chshare.ConnectionRequest{Name: "Client 1", Tags: []string{"prod"}}
+	wantEvent := func(wantState string) {
+		select {
+		case got := <-events:
+			assert.Equal(t, "client-1", got.ClientID)
+			assert.Equal(t, "Client 1", got.ClientName)
+			assert.Equal(t, []string{"prod"}, got.Tags)
+			assert.Equal(t, wantState, got.State)
+			assert.False(t, got.Timestamp.IsZero())
+		case <-time.After(5 * time.Second):
+			require.Fail(t, "client state webhook is not called", wantState)
+		}
+	}
+
+	client, err := cs.StartClient(context.Background(), "auth-1", "client-1", connMock, false, req, testLog)
+	require.NoError(t, err)
+	wantEvent(hooks.ClientStateConnected)
+
+	require.NoError(t, cs.Terminate(client))
+	wantEvent(hooks.ClientStateDisconnected)
+
+	cs.OnObsoleteDeleted([]*clients.Client{client})
+	wantEvent(hooks.ClientStateDeleted)
+	assert.Empty(t, events)
+}
+
+func TestTerminateSetsDisconnectReason(t *testing.T) {
+	testCases := []struct {
+		name       string
+		disconnect func(t *testing.T, cs *ClientService, client *clients.Client, connMock *test.ConnMock)
+		wantReason clients.DisconnectReason
+		wantInRepo bool
+	}{
+		{
+			name:       "connection drop",
+			disconnect: func(*testing.T, *ClientService, *clients.Client, *test.ConnMock) {},
+			wantReason: clients.DisconnectReasonConnectionLost,
+			wantInRepo: true,
+		},
+		{
+			name: "forced delete",
+			disconnect: func(t *testing.T, cs *ClientService, client *clients.Client, connMock *test.ConnMock) {
+				require.NoError(t, cs.ForceDelete(client))
+				assert.True(t, connMock.IsClosed())
+			},
+			wantReason: clients.DisconnectReasonForceDeleted,
+		},
+		{
+			name: "idle timeout",
+			disconnect: func(t *testing.T, cs *ClientService, client *clients.Client, connMock *test.ConnMock) {
+				idleTimer := closeOnIdle(client, 10*time.Millisecond)
+				defer idleTimer.Stop()
+				require.Eventually(t, connMock.IsClosed, 5*time.Second, 10*time.Millisecond)
+			},
+			wantReason: clients.DisconnectReasonIdleTimeout,
+			wantInRepo: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			connMock := test.NewConnMock()
+			connMock.ReturnRemoteAddr = &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 2345}
+			cs := &ClientService{
+				repo:            clients.NewClientRepository(nil, &hour, testLog),
+				portDistributor: ports.NewPortDistributor(mapset.NewThreadUnsafeSet()),
+			}
+			client, err := cs.StartClient(context.Background(), "auth-1", "client-1", connMock, false, &chshare.ConnectionRequest{}, testLog)
+			require.NoError(t, err)
+
+			tc.disconnect(t, cs, client, connMock)
+			require.NoError(t, cs.Terminate(client))
+
+			assert.Equal(t, tc.wantReason, client.DisconnectReason)
+			stored, err := cs.GetByID(client.ID)
+			require.NoError(t, err)
+			if !tc.wantInRepo {
+				assert.Nil(t, stored)
+				return
+			}
+			require.NotNil(t, stored)
+			assert.Equal(t, tc.wantReason, stored.DisconnectReason)
+			assert.NotNil(t, stored.DisconnectedAt)
+		})
+	}
+}
+
+func TestIdleTimerReset(t *testing.T) {
+	connMock := test.NewConnMock()
+	client := clients.New(t).Connection(connMock).Build()
+	client.Logger = testLog
+
+	idleTimer := closeOnIdle(client, 100*time.Millisecond)
+	defer idleTimer.Stop()
+	for i := 0; i < 5; i++ {
+		time.Sleep(40 * time.Millisecond)
+		idleTimer.Reset()
+	}
+	assert.False(t, connMock.IsClosed())
+
+	require.Eventually(t, connMock.IsClosed, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, clients.DisconnectReasonIdleTimeout, client.CloseReason())
+}
+
 func TestDeleteOfflineClient(t *testing.T) {
 	c1Active := clients.New(t).Build()
 	c2Active := clients.New(t).Build()
@@ -166,6 +611,117 @@ func TestDeleteOfflineClient(t *testing.T) {
 	}
 }
 
+func TestStartClientTunnelConflict(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, l.Close())
+
+	connMock := test.NewConnMock()
+	connMock.ReturnRemoteAddr = &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 2345}
+	cs := &ClientService{
+		repo:            clients.NewClientRepository(nil, nil, testLog),
+		portDistributor: ports.NewPortDistributor(mapset.NewThreadUnsafeSetFromSlice([]interface{}{port})),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	newReq := func() *chshare.ConnectionRequest {
+		return &chshare.ConnectionRequest{
+			Remotes: []*chshare.Remote{{
+				LocalHost:  "127.0.0.1",
+				LocalPort:  strconv.Itoa(port),
+				RemoteHost: "127.0.0.1",
+				RemotePort: "22",
+			}},
+		}
+	}
+
+	_, err = cs.StartClient(ctx, "auth-1", "client-1", connMock, false, newReq(), testLog)
+	require.NoError(t, err)
+	assert.Empty(t, cs.GetTunnelConflicts())
+
+	_, err = cs.StartClient(ctx, "auth-2", "client-2", connMock, false, newReq(), testLog)
+	require.Error(t, err)
+
+	conflicts := cs.GetTunnelConflicts()
+	require.Len(t, conflicts, 1)
+	assert.Equal(t, "client-2", conflicts[0].ClientID)
+	assert.Equal(t, strconv.Itoa(port), conflicts[0].LocalPort)
+	assert.Equal(t, "127.0.0.1:22", conflicts[0].Remote)
+	assert.Equal(t, "client-1", conflicts[0].OwnerClientID)
+	assert.Equal(t, fmt.Sprintf("Local port %d already in use.", port), conflicts[0].Error)
+}
+
+func TestStartClientTunnelsOnRandomPort(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	require.NoError(t, l.Close())
+
+	cs := &ClientService{
+		repo:            clients.NewClientRepository(nil, nil, testLog),
+		portDistributor: ports.NewPortDistributor(mapset.NewThreadUnsafeSetFromSlice([]interface{}{port})),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := clients.New(t).Connection(test.NewConnMock()).Build()
+	client.Tunnels = nil
+	client.Context = ctx
+	client.Logger = testLog
+	remote := &chshare.Remote{RemoteHost: "127.0.0.1", RemotePort: "22"}
+
+	tunnels, err := cs.StartClientTunnels(client, []*chshare.Remote{remote})
+	require.NoError(t, err)
+
+	require.Len(t, tunnels, 1)
+	assert.Equal(t, strconv.Itoa(port), tunnels[0].LocalPort)
+	assert.Equal(t, "0.0.0.0", tunnels[0].LocalHost)
+	assert.True(t, tunnels[0].LocalPortRandom)
+	// the port is bound by the tunnel
+	_, err = net.Listen("tcp", "127.0.0.1:"+tunnels[0].LocalPort)
+	assert.Error(t, err)
+
+	// no more ports
+	_, err = cs.StartClientTunnels(client, []*chshare.Remote{{RemoteHost: "127.0.0.1", RemotePort: "80"}})
+	assert.EqualError(t, err, "no ports available")
+	assert.Empty(t, cs.GetTunnelConflicts())
+}
+
+func TestStartClientTunnelsUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := pc.LocalAddr().(*net.UDPAddr).Port
+	require.NoError(t, pc.Close())
+
+	cs := &ClientService{
+		repo:            clients.NewClientRepository(nil, nil, testLog),
+		portDistributor: ports.NewPortDistributor(mapset.NewThreadUnsafeSetFromSlice([]interface{}{port})),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := clients.New(t).Connection(test.NewConnMock()).Build()
+	client.Tunnels = nil
+	client.Context = ctx
+	client.Logger = testLog
+	remote, err := chshare.DecodeRemote(fmt.Sprintf("127.0.0.1:%d/udp:127.0.0.1:53/udp", port))
+	require.NoError(t, err)
+
+	// older clients treat all streams as tcp
+	_, err = cs.StartClientTunnels(client, []*chshare.Remote{remote})
+	assert.Equal(t, errors2.APIError{
+		HTTPStatus: http.StatusBadRequest,
+		Message:    fmt.Sprintf("client %s doesn't support UDP tunnels, update it to use them", client.ID),
+	}, err)
+	assert.Empty(t, client.Tunnels)
+
+	client.AcceptsUDPTunnels = true
+	tunnels, err := cs.StartClientTunnels(client, []*chshare.Remote{remote})
+	require.NoError(t, err)
+	require.Len(t, tunnels, 1)
+	assert.Equal(t, chshare.ProtocolUDP, tunnels[0].Protocol)
+	require.NoError(t, tunnels[0].Terminate(true))
+}
+
 func TestCheckLocalPort(t *testing.T) {
 	srv := ClientService{
 		portDistributor: ports.NewPortDistributorForTests(
@@ -305,3 +861,100 @@ func TestCheckClientsAccess(t *testing.T) {
 		})
 	}
 }
+
+func TestSetHealthStatus(t *testing.T) {
+	c1 := clients.New(t).ID("client-1").Build()
+	c2 := clients.New(t).ID("client-2").Build()
+	cs := NewClientService(nil, clients.NewClientRepository([]*clients.Client{c1, c2}, &hour, testLog))
+	admin := &users.User{
+		Username: "admin",
+		Groups:   []string{users.Administrators},
+	}
+
+	healthStatus := &models.HealthStatus{
+		State:   models.HealthDegraded,
+		Reasons: []string{"disk usage of / is 85.0%"},
+	}
+	err := cs.SetHealthStatus(c1.ID, healthStatus)
+	require.NoError(t, err)
+	require.NoError(t, cs.SetHealthStatus(c2.ID, &models.HealthStatus{State: models.HealthHealthy}))
+
+	assert.Equal(t, models.HealthDegraded, c1.Health)
+	assert.Equal(t, healthStatus, c1.HealthStatus)
+
+	got, err := cs.GetUserClients(admin, []query.FilterOption{{Column: "health", Values: []string{models.HealthDegraded}}})
+	require.NoError(t, err)
+	assert.Equal(t, []*clients.Client{c1}, got)
+}
+
+func TestAutoTags(t *testing.T) {
+	connMock := test.NewConnMock()
+	connMock.ReturnRemoteAddr = &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 2345}
+	autoTagger, err := clients.NewAutoTagger([]clients.AutoTagRule{
+		{Tags: []string{"needs-patch"}, Conditions: []string{"updates_status.security_updates_available > 0"}},
+		{Tags: []string{"debian-prod"}, Conditions: []string{"os_family = debian", "tags = prod*"}},
+	})
+	require.NoError(t, err)
+	cs := &ClientService{
+		repo:            clients.NewClientRepository(nil, nil, testLog),
+		portDistributor: ports.NewPortDistributor(mapset.NewThreadUnsafeSet()),
+		autoTagger:      autoTagger,
+	}
+
+	// at connect
+	client, err := cs.StartClient(
+		context.Background(), "test-client-auth", "test-client", connMock, false,
+		&chshare.ConnectionRequest{OSFamily: "debian", Tags: []string{"production"}}, testLog)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"debian-prod"}, client.AutoTags)
+	assert.Equal(t, []string{"production"}, client.Tags)
+
+	// condition is met on updates status refresh
+	require.NoError(t, cs.SetUpdatesStatus(client.ID, &models.UpdatesStatus{UpdatesAvailable: 3, SecurityUpdatesAvailable: 2}))
+	assert.Equal(t, []string{"debian-prod", "needs-patch"}, client.AutoTags)
+
+	// condition is not met anymore
+	require.NoError(t, cs.SetUpdatesStatus(client.ID, &models.UpdatesStatus{UpdatesAvailable: 1}))
+	assert.Equal(t, []string{"debian-prod"}, client.AutoTags)
+
+	require.NoError(t, cs.SetTags(client.ID, []string{"staging"}))
+	assert.Equal(t, []string{}, client.AutoTags)
+}
+
+func TestValidateClientsFilterOptions(t *testing.T) {
+	testCases := []struct {
+		name    string
+		filters []query.FilterOption
+		wantErr string
+	}{
+		{
+			name:    "connection state",
+			filters: []query.FilterOption{{Column: "connection_state", Values: []string{"connected", "disconnected"}}},
+		},
+		{
+			name:    "invalid connection state",
+			filters: []query.FilterOption{{Column: "connection_state", Values: []string{"connected", "online"}}},
+			wantErr: `invalid connection_state filter value "online", expected "connected" or "disconnected"`,
+		},
+		{
+			name:    "unsupported field",
+			filters: []query.FilterOption{{Column: "unknown", Values: []string{"1"}}},
+			wantErr: "unsupported filter field 'unknown'",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateClientsFilterOptions(tc.filters)
+
+			if tc.wantErr == "" {
+				assert.Nil(t, err)
+				return
+			}
+			require.NotNil(t, err)
+			assert.EqualError(t, err, tc.wantErr)
+			assert.Equal(t, http.StatusBadRequest, err[0].HTTPStatus)
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package clients
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cloudradar-monitoring/rport/share/comm"
+)
+
+// AutoTagRule assigns tags to clients matching all of its conditions.
+// A condition has a form of "<field> <operator> <value>", e.g. "updates_status.security_updates_available > 0".
+// Field is a client field, nested fields are separated by a dot. Supported operators are =, !=, >, <, >= and <=.
+// = and != match strings with '*' wildcards and any element of lists, the others compare numbers.
+type AutoTagRule struct {
+	Tags       []string `mapstructure:"tags"`
+	Conditions []string `mapstructure:"conditions"`
+}
+
+var autoTagConditionRegexp = regexp.MustCompile(`^\s*([a-z0-9_.]+)\s*(>=|<=|!=|=|>|<)\s*(.*?)\s*$`)
+
+type autoTagCondition struct {
+	path     []string
+	operator string
+	value    string
+	valueRe  *regexp.Regexp
+}
+
+type autoTagRule struct {
+	tags       []string
+	conditions []autoTagCondition
+}
+
+// AutoTagger computes tags of clients by configured rules. Computed tags are kept apart from tags reported by clients.
+type AutoTagger struct {
+	rules []autoTagRule
+}
+
+// NewAutoTagger returns a tagger for given rules or an error if a rule is invalid.
+func NewAutoTagger(rules []AutoTagRule) (*AutoTagger, error) {
+	t := &AutoTagger{}
+	for i, rule := range rules {
+		parsed, err := parseAutoTagRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %v", i+1, err)
+		}
+		t.rules = append(t.rules, parsed)
+	}
+	return t, nil
+}
+
+func parseAutoTagRule(rule AutoTagRule) (autoTagRule, error) {
+	if len(rule.Tags) == 0 {
+		return autoTagRule{}, errors.New("at least one tag should be specified")
+	}
+	for _, tag := range rule.Tags {
+		if err := comm.ValidateTag(tag); err != nil {
+			return autoTagRule{}, err
+		}
+	}
+	if len(rule.Conditions) == 0 {
+		return autoTagRule{}, errors.New("at least one condition should be specified")
+	}
+
+	res := autoTagRule{tags: rule.Tags}
+	for _, raw := range rule.Conditions {
+		m := autoTagConditionRegexp.FindStringSubmatch(raw)
+		if m == nil {
+			return autoTagRule{}, fmt.Errorf("invalid condition %q, expected '<field> <operator> <value>'", raw)
+		}
+		cond := autoTagCondition{
+			path:     strings.Split(m[1], "."),
+			operator: m[2],
+			value:    m[3],
+		}
+		switch cond.operator {
+		case "=", "!=":
+			cond.valueRe = regexp.MustCompile("^" + strings.ReplaceAll(regexp.QuoteMeta(cond.value), `\*`, ".*") + "$")
+		default:
+			if _, err := strconv.ParseFloat(cond.value, 64); err != nil {
+				return autoTagRule{}, fmt.Errorf("invalid condition %q, %s requires a number", raw, cond.operator)
+			}
+		}
+		res.conditions = append(res.conditions, cond)
+	}
+	return res, nil
+}
+
+// Tags returns sorted unique tags of all rules matching a given client, nil if no rules are configured.
+func (t *AutoTagger) Tags(client *Client) []string {
+	if t == nil || len(t.rules) == 0 {
+		return nil
+	}
+
+	fields := make(map[string]interface{})
+	// client fields are always serializable, on failure no rule matches
+	if b, err := json.Marshal(client); err == nil {
+		_ = json.Unmarshal(b, &fields)
+	}
+	// rules are applied to reported attributes only
+	delete(fields, "auto_tags")
+
+	seen := make(map[string]bool)
+	res := []string{}
+	for _, rule := range t.rules {
+		if !rule.matches(fields) {
+			continue
+		}
+		for _, tag := range rule.tags {
+			if !seen[tag] {
+				seen[tag] = true
+				res = append(res, tag)
+			}
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+func (r autoTagRule) matches(fields map[string]interface{}) bool {
+	for _, cond := range r.conditions {
+		if !cond.matches(fields) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c autoTagCondition) matches(fields map[string]interface{}) bool {
+	var value interface{} = fields
+	for _, key := range c.path {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			value = nil
+			break
+		}
+		value = m[key]
+	}
+
+	switch c.operator {
+	case "=":
+		return c.matchesValue(value)
+	case "!=":
+		return !c.matchesValue(value)
+	}
+
+	actual, ok := value.(float64)
+	if !ok {
+		return false
+	}
+	expected, _ := strconv.ParseFloat(c.value, 64)
+	switch c.operator {
+	case ">":
+		return actual > expected
+	case "<":
+		return actual < expected
+	case ">=":
+		return actual >= expected
+	default:
+		return actual <= expected
+	}
+}
+
+// matchesValue returns true if a given value or any of its elements if it's a list matches the condition value.
+func (c autoTagCondition) matchesValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return c.value == ""
+	case []interface{}:
+		for _, cur := range v {
+			if c.matchesValue(cur) {
+				return true
+			}
+		}
+		return false
+	case map[string]interface{}:
+		return false
+	case float64:
+		if expected, err := strconv.ParseFloat(c.value, 64); err == nil {
+			return v == expected
+		}
+		return c.valueRe.MatchString(strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		return c.valueRe.MatchString(fmt.Sprint(v))
+	}
+}
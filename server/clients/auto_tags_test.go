@@ -0,0 +1,167 @@
+package clients
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/rport/share/models"
+)
+
+func TestAutoTaggerTags(t *testing.T) {
+	client := New(t).Build()
+	client.Tags = []string{"web", "prod-eu"}
+	client.UpdatesStatus = &models.UpdatesStatus{UpdatesAvailable: 5, SecurityUpdatesAvailable: 1}
+
+	testCases := []struct {
+		name       string
+		conditions []string
+		wantMatch  bool
+	}{
+		{
+			name:       "number greater",
+			conditions: []string{"updates_status.security_updates_available > 0"},
+			wantMatch:  true,
+		},
+		{
+			name:       "number not greater",
+			conditions: []string{"updates_status.security_updates_available > 1"},
+			wantMatch:  false,
+		},
+		{
+			name:       "number greater or equal",
+			conditions: []string{"updates_status.updates_available >= 5"},
+			wantMatch:  true,
+		},
+		{
+			name:       "number less",
+			conditions: []string{"num_cpus < 4"},
+			wantMatch:  true,
+		},
+		{
+			name:       "number equal",
+			conditions: []string{"num_cpus = 2"},
+			wantMatch:  true,
+		},
+		{
+			name:       "string equal",
+			conditions: []string{"os_family = alpine"},
+			wantMatch:  true,
+		},
+		{
+			name:       "string wildcard",
+			conditions: []string{"os_full_name = Debian*"},
+			wantMatch:  true,
+		},
+		{
+			name:       "string not equal",
+			conditions: []string{"os_family != alpine"},
+			wantMatch:  false,
+		},
+		{
+			name:       "any list element",
+			conditions: []string{"tags = prod-*"},
+			wantMatch:  true,
+		},
+		{
+			name:       "no list element",
+			conditions: []string{"tags != db"},
+			wantMatch:  true,
+		},
+		{
+			name:       "all conditions",
+			conditions: []string{"os_family = alpine", "tags = db"},
+			wantMatch:  false,
+		},
+		{
+			name:       "missing nested field",
+			conditions: []string{"health_status.state = healthy"},
+			wantMatch:  false,
+		},
+		{
+			name:       "missing field compared with a number",
+			conditions: []string{"unknown > 0"},
+			wantMatch:  false,
+		},
+		{
+			name:       "empty field",
+			conditions: []string{"environment = "},
+			wantMatch:  true,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tagger, err := NewAutoTagger([]AutoTagRule{
+				{Tags: []string{"matched"}, Conditions: tc.conditions},
+			})
+			require.NoError(t, err)
+
+			got := tagger.Tags(client)
+
+			if tc.wantMatch {
+				assert.Equal(t, []string{"matched"}, got)
+			} else {
+				assert.Empty(t, got)
+			}
+		})
+	}
+}
+
+func TestAutoTaggerTagsMultipleRules(t *testing.T) {
+	tagger, err := NewAutoTagger([]AutoTagRule{
+		{Tags: []string{"linux", "managed"}, Conditions: []string{"os_kernel = linux"}},
+		{Tags: []string{"alpine", "managed"}, Conditions: []string{"os_family = alpine"}},
+		{Tags: []string{"windows"}, Conditions: []string{"os_kernel = windows"}},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"alpine", "linux", "managed"}, tagger.Tags(New(t).Build()))
+
+	var noRules *AutoTagger
+	assert.Nil(t, noRules.Tags(New(t).Build()))
+}
+
+func TestNewAutoTaggerInvalidRules(t *testing.T) {
+	testCases := []struct {
+		name    string
+		rule    AutoTagRule
+		wantErr string
+	}{
+		{
+			name:    "no tags",
+			rule:    AutoTagRule{Conditions: []string{"os_family = alpine"}},
+			wantErr: "rule 1: at least one tag should be specified",
+		},
+		{
+			name:    "invalid tag",
+			rule:    AutoTagRule{Tags: []string{"a|b"}, Conditions: []string{"os_family = alpine"}},
+			wantErr: `rule 1: tag "a|b" is invalid: only letters, digits, spaces and '_.:/@-' are allowed`,
+		},
+		{
+			name:    "no conditions",
+			rule:    AutoTagRule{Tags: []string{"tag"}},
+			wantErr: "rule 1: at least one condition should be specified",
+		},
+		{
+			name:    "invalid condition",
+			rule:    AutoTagRule{Tags: []string{"tag"}, Conditions: []string{"os_family"}},
+			wantErr: `rule 1: invalid condition "os_family", expected '<field> <operator> <value>'`,
+		},
+		{
+			name:    "not a number",
+			rule:    AutoTagRule{Tags: []string{"tag"}, Conditions: []string{"num_cpus > many"}},
+			wantErr: `rule 1: invalid condition "num_cpus > many", > requires a number`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewAutoTagger([]AutoTagRule{tc.rule})
+			require.EqualError(t, err, tc.wantErr)
+		})
+	}
+}
@@ -9,26 +9,52 @@ import (
 )
 
 type CleanupTask struct {
-	log *chshare.Logger
-	cr  *ClientRepository
+	log       *chshare.Logger
+	cr        *ClientRepository
+	batchSize int
+	// onDeleted is called with deleted clients, nil if not needed
+	onDeleted func(deleted []*Client)
 }
 
 // NewCleanupTask returns a task to cleanup Client Repository from obsolete clients.
-func NewCleanupTask(log *chshare.Logger, cr *ClientRepository) *CleanupTask {
+// Obsolete clients are parked instead if the repository has ParkLostClients set.
+// Clients are deleted in batches of a given size, 0 means all at once.
+func NewCleanupTask(log *chshare.Logger, cr *ClientRepository, batchSize int) *CleanupTask {
 	return &CleanupTask{
-		log: log,
-		cr:  cr,
+		log:       log,
+		cr:        cr,
+		batchSize: batchSize,
 	}
 }
 
+// OnDeleted sets a function that is called with clients deleted by the task.
+func (t *CleanupTask) OnDeleted(fn func(deleted []*Client)) *CleanupTask {
+	t.onDeleted = fn
+	return t
+}
+
 func (t *CleanupTask) Run(ctx context.Context) error {
-	deleted, err := t.cr.DeleteObsolete()
+	if t.cr.ParkLostClients {
+		parked, err := t.cr.ParkObsolete(t.batchSize)
+		if err != nil {
+			return fmt.Errorf("failed to park obsolete clients: %v", err)
+		}
+		if len(parked) > 0 {
+			t.log.Debugf("Parked %d obsolete client(s).", len(parked))
+		}
+		return nil
+	}
+
+	deleted, err := t.cr.DeleteObsolete(t.batchSize)
 	if err != nil {
 		return fmt.Errorf("failed to delete obsolete clients: %v", err)
 	}
 
 	if len(deleted) > 0 {
 		t.log.Debugf("Deleted %d obsolete client(s).", len(deleted))
+		if t.onDeleted != nil {
+			t.onDeleted(deleted)
+		}
 	}
 
 	return nil
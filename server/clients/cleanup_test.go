@@ -18,27 +18,207 @@ func TestCleanup(t *testing.T) {
 	clients := []*Client{c1, c2, c3}
 	p := newFakeClientProvider(t, hour, c1, c2, c3)
 	defer p.Close()
-	repo := newClientRepositoryWithDB(clients, &hour, p, testLog)
+	repo := newClientRepositoryWithDB(clients, &hour, p, 0, testLog)
 	require.Len(t, repo.clients, 3)
-	gotObsolete, err := p.get(ctx, c3.ID)
+	gotObsolete, err := p.Get(ctx, c3.ID)
 	require.NoError(t, err)
 	require.EqualValues(t, c3, gotObsolete)
-	task := NewCleanupTask(testLog, repo)
+	var gotDeleted []*Client
+	task := NewCleanupTask(testLog, repo, 1).OnDeleted(func(deleted []*Client) {
+		gotDeleted = append(gotDeleted, deleted...)
+	})
 
 	// when
 	err = task.Run(ctx)
 
 	// then
 	assert.NoError(t, err)
+	assert.Equal(t, []*Client{c3}, gotDeleted)
 	assert.ElementsMatch(t, getValues(repo.clients), []*Client{c1, c2})
 	gotClients, err := p.GetAll(ctx)
 	assert.NoError(t, err)
 	assert.EqualValues(t, []*Client{c1, c2}, gotClients)
-	gotObsolete, err = p.get(ctx, c3.ID)
+	gotObsolete, err = p.Get(ctx, c3.ID)
 	require.NoError(t, err)
 	require.Nil(t, gotObsolete)
 }
 
+func TestCleanupInBatches(t *testing.T) {
+	// given
+	ctx := context.Background()
+	active := New(t).ID("active").Build()
+	var obsolete []*Client
+	for _, id := range []string{"o1", "o2", "o3", "o4"} {
+		obsolete = append(obsolete, New(t).ID(id).DisconnectedDuration(time.Hour+time.Minute).Build())
+	}
+	p := newFakeClientProvider(t, hour, append([]*Client{active}, obsolete...)...)
+	defer p.Close()
+	repo := newClientRepositoryWithDB(append([]*Client{active}, obsolete...), &hour, p, 0, testLog)
+
+	batches := 0
+	var reconnected []string
+	repo.afterObsoleteBatch = func() {
+		batches++
+		if batches > 1 {
+			return
+		}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			// reads proceed between batches
+			_, err := repo.GetAll()
+			assert.NoError(t, err)
+			// clients reconnected between batches are kept
+			for _, cur := range obsolete {
+				if _, ok := repo.clients[cur.ID]; ok {
+					c := shallowCopy(cur)
+					c.DisconnectedAt = nil
+					assert.NoError(t, repo.Save(c))
+					reconnected = append(reconnected, c.ID)
+				}
+			}
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Error("the lock is held between batches")
+		}
+	}
+
+	// when
+	deleted, err := repo.DeleteObsolete(2)
+
+	// then
+	require.NoError(t, err)
+	assert.Equal(t, 2, batches)
+	require.Len(t, reconnected, 2)
+	require.Len(t, deleted, 2)
+	for _, cur := range deleted {
+		assert.NotContains(t, reconnected, cur.ID)
+		gotStored, err := p.Get(ctx, cur.ID)
+		require.NoError(t, err)
+		assert.Nil(t, gotStored)
+	}
+	assert.ElementsMatch(t, append([]string{"active"}, reconnected...), clientIDs(getValues(repo.clients)))
+	for _, id := range reconnected {
+		gotStored, err := p.Get(ctx, id)
+		require.NoError(t, err)
+		assert.NotNil(t, gotStored)
+	}
+}
+
+func TestCleanupParksObsolete(t *testing.T) {
+	// given
+	ctx := context.Background()
+	c1 := New(t).ID("active").Build()
+	c2 := New(t).ID("disconnected").DisconnectedDuration(5 * time.Minute).Build()
+	c3 := New(t).ID("obsolete").DisconnectedDuration(time.Hour + time.Minute).Build()
+	// kept only in the storage
+	c4 := New(t).ID("stored-obsolete").DisconnectedDuration(2 * time.Hour).Build()
+	p := newFakeClientProvider(t, hour, c1, c2, c3, c4)
+	defer p.Close()
+	repo := newClientRepositoryWithDB([]*Client{c1, c2, c3}, &hour, p, 0, testLog)
+	repo.ParkLostClients = true
+	var gotDeleted []*Client
+	task := NewCleanupTask(testLog, repo, 1).OnDeleted(func(deleted []*Client) {
+		gotDeleted = append(gotDeleted, deleted...)
+	})
+
+	// when
+	err := task.Run(ctx)
+
+	// then
+	require.NoError(t, err)
+	assert.Empty(t, gotDeleted)
+	gotClients, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"active", "disconnected"}, clientIDs(gotClients))
+	gotCount, err := repo.Count()
+	require.NoError(t, err)
+	assert.Equal(t, 2, gotCount)
+	gotByID, err := repo.GetByID(c3.ID)
+	require.NoError(t, err)
+	assert.Nil(t, gotByID)
+
+	gotParked, err := repo.GetUserParkedClients(admin, nil)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"obsolete", "stored-obsolete"}, clientIDs(gotParked))
+	for _, cur := range gotParked {
+		assert.Equal(t, Parked, cur.ConnectionState())
+		gotStored, err := p.Get(ctx, cur.ID)
+		require.NoError(t, err)
+		require.NotNil(t, gotStored)
+		assert.NotNil(t, gotStored.ParkedAt)
+	}
+
+	// parked clients are loaded on restart
+	stored, err := p.GetAll(ctx)
+	require.NoError(t, err)
+	restarted := newClientRepositoryWithDB(stored, &hour, p, 0, testLog)
+	gotClients, err = restarted.GetAll()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"active", "disconnected"}, clientIDs(gotClients))
+	gotParked, err = restarted.GetUserParkedClients(admin, nil)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"obsolete", "stored-obsolete"}, clientIDs(gotParked))
+
+	// when
+	unparked, err := repo.Unpark(c3.ID)
+
+	// then
+	require.NoError(t, err)
+	require.NotNil(t, unparked)
+	assert.Equal(t, Disconnected, unparked.ConnectionState())
+	gotByID, err = repo.GetByID(c3.ID)
+	require.NoError(t, err)
+	assert.Equal(t, unparked, gotByID)
+	gotParked, err = repo.GetUserParkedClients(admin, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"stored-obsolete"}, clientIDs(gotParked))
+	gotStored, err := p.Get(ctx, c3.ID)
+	require.NoError(t, err)
+	assert.Nil(t, gotStored.ParkedAt)
+
+	// reconnected client is not parked anymore
+	c4.DisconnectedAt = nil
+	require.NoError(t, repo.Save(c4))
+	gotParked, err = repo.GetUserParkedClients(admin, nil)
+	require.NoError(t, err)
+	assert.Empty(t, gotParked)
+
+	// not parked client can't be unparked
+	unparked, err = repo.Unpark(c1.ID)
+	require.NoError(t, err)
+	assert.Nil(t, unparked)
+}
+
+func TestCleanupDoesNotParkReconnected(t *testing.T) {
+	// given
+	ctx := context.Background()
+	// obsolete in the storage, but reconnected and not saved to the storage yet
+	stored := New(t).ID("reconnected").DisconnectedDuration(2 * time.Hour).Build()
+	p := newFakeClientProvider(t, hour, stored)
+	defer p.Close()
+	repo := newClientRepositoryWithDB(nil, &hour, p, 0, testLog)
+	repo.ParkLostClients = true
+	reconnected := shallowCopy(stored)
+	reconnected.DisconnectedAt = nil
+	repo.clients[reconnected.ID] = reconnected
+
+	// when
+	parked, err := repo.ParkObsolete(0)
+
+	// then
+	require.NoError(t, err)
+	assert.Empty(t, parked)
+	assert.Nil(t, repo.GetParkedByID(reconnected.ID))
+	gotStored, err := p.Get(ctx, reconnected.ID)
+	require.NoError(t, err)
+	require.NotNil(t, gotStored)
+	assert.Nil(t, gotStored.ParkedAt)
+	assert.Nil(t, gotStored.DisconnectedAt)
+}
+
 func getValues(clients map[string]*Client) []*Client {
 	var r []*Client
 	for _, v := range clients {
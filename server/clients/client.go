@@ -2,6 +2,7 @@ package clients
 
 import (
 	"context"
+	"crypto/tls"
 	"strconv"
 	"sync"
 	"sync/atomic"
@@ -25,8 +26,26 @@ type ConnectionState string
 const (
 	Connected    ConnectionState = "connected"
 	Disconnected ConnectionState = "disconnected"
+	Parked       ConnectionState = "parked"
 )
 
+// DisconnectReason categorizes why a client was disconnected.
+type DisconnectReason string
+
+const (
+	// DisconnectReasonConnectionLost is set when a connection was closed not by the server, e.g. a network drop or a client stop.
+	DisconnectReasonConnectionLost DisconnectReason = "connection_lost"
+	// DisconnectReasonForceDeleted is set when a connected client was deleted by an admin.
+	DisconnectReasonForceDeleted DisconnectReason = "force_deleted"
+	// DisconnectReasonIdleTimeout is set when a client sent no requests within 'client_idle_timeout'.
+	DisconnectReasonIdleTimeout DisconnectReason = "idle_timeout"
+	// DisconnectReasonServerShutdown is set when a server was stopped while a client was connected.
+	DisconnectReasonServerShutdown DisconnectReason = "server_shutdown"
+)
+
+// ConnectionStateField is a name of the computed connection state field to filter clients by.
+const ConnectionStateField = "connection_state"
+
 // Client represents client connection
 type Client struct {
 	ID                     string    `json:"id"`
@@ -50,21 +69,43 @@ type Client struct {
 	IPv4                   []string  `json:"ipv4"`
 	IPv6                   []string  `json:"ipv6"`
 	Tags                   []string  `json:"tags"`
+	Environment            string    `json:"environment"`
+	CommandsDisabled       bool      `json:"commands_disabled"`
+	PackageManager         string    `json:"package_manager"`
+	Interpreters           []string  `json:"interpreters"`
 	Version                string    `json:"version"`
 	Address                string    `json:"address"`
 	Tunnels                []*Tunnel `json:"tunnels"`
 	// DisconnectedAt is a time when a client was disconnected. If nil - it's connected.
 	DisconnectedAt    *time.Time            `json:"disconnected_at"`
+	DisconnectReason  DisconnectReason      `json:"disconnect_reason"`
 	ClientAuthID      string                `json:"client_auth_id"`
 	AllowedUserGroups []string              `json:"allowed_user_groups"`
 	UpdatesStatus     *models.UpdatesStatus `json:"updates_status"`
+	// ParkedAt is a time when an obsolete client was parked instead of being deleted. If nil - it's not parked.
+	ParkedAt *time.Time `json:"parked_at"`
+	// AutoTags are computed by the server from client attributes, kept apart from Tags reported by the client
+	AutoTags []string `json:"auto_tags"`
+	// OSRaw holds OS fields as reported by the client, nil if they're already in canonical forms
+	OSRaw *OSRaw `json:"os_raw"`
+	// Health is a health state reported by a client, empty if not reported. HealthStatus holds its details.
+	Health       string               `json:"health"`
+	HealthStatus *models.HealthStatus `json:"health_status"`
+	// BootTime is a time when the client system was booted, nil if unknown.
+	// PreviousBootTime is a boot time before the last detected reboot, nil if no reboot was detected.
+	BootTime         *time.Time `json:"boot_time"`
+	PreviousBootTime *time.Time `json:"previous_boot_time"`
 
 	Connection ssh.Conn        `json:"-"`
 	Context    context.Context `json:"-"`
 	Logger     *chshare.Logger `json:"-"`
+	// AcceptsUDPTunnels is true if the connected client relays datagrams of UDP tunnels.
+	AcceptsUDPTunnels bool `json:"-"`
 
 	tunnelIDAutoIncrement int64
 	lock                  sync.Mutex
+	// closeReason holds a DisconnectReason when the connection was closed by the server
+	closeReason atomic.Value
 }
 
 // Obsolete returns true if a given client was disconnected longer than a given duration.
@@ -91,20 +132,20 @@ func (c *Client) FindTunnelByRemote(r *chshare.Remote) *Tunnel {
 	return nil
 }
 
-func (c *Client) StartTunnel(r *chshare.Remote, acl *TunnelACL) (*Tunnel, error) {
+func (c *Client) StartTunnel(r *chshare.Remote, acl *TunnelACL, copyLimiter *CopyLimiter, deadlines ConnDeadlines, connLogging ConnLogging, proxyTLS *tls.Config) (*Tunnel, error) {
 	t := c.FindTunnelByRemote(r)
 	if t != nil {
 		return t, nil
 	}
 
 	tunnelID := strconv.FormatInt(c.generateNewTunnelID(), 10)
-	t = NewTunnel(c.Logger, c.Connection, tunnelID, r, acl)
+	t = NewTunnel(c.Logger, c.Connection, c.ID, tunnelID, r, acl, copyLimiter, deadlines, connLogging, proxyTLS)
 	autoCloseChan, err := t.Start(c.Context)
 	if err != nil {
 		return nil, err
 	}
 
-	// in case tunnel auto-closed due to inactivity - run background task to remove the tunnel from the list
+	// in case tunnel auto-closed due to inactivity or max lifetime - run background task to remove the tunnel from the list
 	// TODO: in case tunnel would be extended to have active/inactive status this wouldn't be needed
 	if autoCloseChan != nil {
 		go func() {
@@ -175,6 +216,21 @@ func (c *Client) Close() error {
 	return c.Connection.Close()
 }
 
+// CloseWithReason closes the client connection and records why the server closed it.
+func (c *Client) CloseWithReason(reason DisconnectReason) error {
+	c.closeReason.Store(reason)
+	return c.Close()
+}
+
+// CloseReason returns a reason the server closed the client connection for,
+// DisconnectReasonConnectionLost if the connection wasn't closed by the server.
+func (c *Client) CloseReason() DisconnectReason {
+	if reason, ok := c.closeReason.Load().(DisconnectReason); ok {
+		return reason
+	}
+	return DisconnectReasonConnectionLost
+}
+
 func (c *Client) BelongsToOneOf(groups []*cgroups.ClientGroup) bool {
 	for _, cur := range groups {
 		if c.BelongsTo(cur) {
@@ -235,6 +291,9 @@ func (c *Client) ConnectionState() ConnectionState {
 	if c.DisconnectedAt == nil {
 		return Connected
 	}
+	if c.ParkedAt != nil {
+		return Parked
+	}
 	return Disconnected
 }
 
@@ -250,6 +309,20 @@ func (c *Client) HasAccess(userGroups []string) bool {
 	return false
 }
 
+// HasInterpreter returns true if a given interpreter can be used on a current client. The default interpreter is always
+// available, clients that don't report their interpreters are expected to have all of them.
+func (c *Client) HasInterpreter(interpreter string) bool {
+	if interpreter == "" || c.Interpreters == nil {
+		return true
+	}
+	for _, cur := range c.Interpreters {
+		if cur == interpreter {
+			return true
+		}
+	}
+	return false
+}
+
 // NewClientID generates a new client ID.
 func NewClientID() (string, error) {
 	return random.UUID4()
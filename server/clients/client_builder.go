@@ -110,6 +110,7 @@ func (b ClientBuilder) Build() *Client {
 					LocalPort:  "2222",
 					RemoteHost: "0.0.0.0",
 					RemotePort: "22",
+					Protocol:   "tcp",
 				},
 			},
 			{
@@ -119,6 +120,7 @@ func (b ClientBuilder) Build() *Client {
 					LocalPort:  "4000",
 					RemoteHost: "0.0.0.0",
 					RemotePort: "80",
+					Protocol:   "tcp",
 				},
 			},
 		},
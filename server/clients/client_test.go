@@ -323,3 +323,52 @@ func TestHasAccess(t *testing.T) {
 		})
 	}
 }
+
+func TestHasInterpreter(t *testing.T) {
+	testCases := []struct {
+		name         string
+		interpreters []string
+		interpreter  string
+		wantRes      bool
+	}{
+		{
+			name:         "interpreters not reported",
+			interpreters: nil,
+			interpreter:  "powershell",
+			wantRes:      true,
+		},
+		{
+			name:         "default interpreter",
+			interpreters: []string{},
+			interpreter:  "",
+			wantRes:      true,
+		},
+		{
+			name:         "available interpreter",
+			interpreters: []string{"cmd", "tacoscript"},
+			interpreter:  "tacoscript",
+			wantRes:      true,
+		},
+		{
+			name:         "missing interpreter",
+			interpreters: []string{"cmd"},
+			interpreter:  "powershell",
+			wantRes:      false,
+		},
+		{
+			name:         "no interpreters installed",
+			interpreters: []string{},
+			interpreter:  "tacoscript",
+			wantRes:      false,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			c := &Client{Interpreters: tc.interpreters}
+
+			assert.Equal(t, tc.wantRes, c.HasInterpreter(tc.interpreter))
+		})
+	}
+}
@@ -1,10 +1,12 @@
 package clients
 
 import (
+	"container/list"
 	"context"
 	"encoding/json"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -18,9 +20,26 @@ type ClientRepository struct {
 	clients         map[string]*Client
 	mu              sync.RWMutex
 	KeepLostClients *time.Duration
+	// ParkLostClients makes obsolete clients parked instead of being deleted
+	ParkLostClients bool
+	// parked holds parked clients, they are not among clients
+	parked map[string]*Client
+	// disconnected clients in memory, least recently used first, tracked only if the cache is capped
+	disconnected      *list.List
+	disconnectedElems map[string]*list.Element
+	// lruMu guards the order of disconnected clients when they are touched under the read lock
+	lruMu sync.Mutex
+	// evicted holds disconnection time of clients that are kept only in the storage
+	evicted               map[string]time.Time
+	maxCachedDisconnected int
 	// storage
 	provider ClientProvider
-	logger   *chshare.Logger
+	// saver saves clients to the storage in the background, nil if clients are saved synchronously
+	saver  *backgroundSaver
+	logger *chshare.Logger
+	// afterObsoleteBatch is called after each batch of deleted or parked obsolete clients when the lock is released, nil to skip.
+	// It's used in tests
+	afterObsoleteBatch func()
 }
 
 type User interface {
@@ -32,26 +51,60 @@ type User interface {
 // keepLostClients is a duration to keep disconnected clients. If a client was disconnected longer than a given
 // duration it will be treated as obsolete.
 func NewClientRepository(initClients []*Client, keepLostClients *time.Duration, logger *chshare.Logger) *ClientRepository {
-	return newClientRepositoryWithDB(initClients, keepLostClients, nil, logger)
+	return newClientRepositoryWithDB(initClients, keepLostClients, nil, 0, logger)
 }
 
-func newClientRepositoryWithDB(initClients []*Client, keepLostClients *time.Duration, provider ClientProvider, logger *chshare.Logger) *ClientRepository {
+func newClientRepositoryWithDB(
+	initClients []*Client,
+	keepLostClients *time.Duration,
+	provider ClientProvider,
+	maxCachedDisconnected int,
+	logger *chshare.Logger,
+) *ClientRepository {
 	clients := make(map[string]*Client)
+	parked := make(map[string]*Client)
+	var notParked []*Client
 	for i := range initClients {
+		if initClients[i].ParkedAt != nil {
+			parked[initClients[i].ID] = initClients[i]
+			continue
+		}
 		clients[initClients[i].ID] = initClients[i]
+		notParked = append(notParked, initClients[i])
 	}
-	return &ClientRepository{
-		clients:         clients,
-		KeepLostClients: keepLostClients,
-		provider:        provider,
-		logger:          logger,
+	s := &ClientRepository{
+		clients:               clients,
+		parked:                parked,
+		KeepLostClients:       keepLostClients,
+		maxCachedDisconnected: maxCachedDisconnected,
+		provider:              provider,
+		logger:                logger,
 	}
+	if s.capped() {
+		s.disconnected = list.New()
+		s.disconnectedElems = make(map[string]*list.Element)
+		s.evicted = make(map[string]time.Time)
+
+		// keep the most recently disconnected clients in memory
+		sorted := notParked
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return disconnectedBefore(sorted[i], sorted[j])
+		})
+		for _, cur := range sorted {
+			s.touch(cur)
+		}
+	}
+	return s
 }
 
+// InitClientRepository returns a Client Repository populated with clients from a given storage.
+// If maxCachedDisconnected is positive and keepLostClients is set, only up to maxCachedDisconnected
+// recently used disconnected clients are kept in memory, others are loaded from the storage on demand.
 func InitClientRepository(
 	ctx context.Context,
 	provider ClientProvider,
 	keepLostClients *time.Duration,
+	maxCachedDisconnected int,
 	logger *chshare.Logger,
 ) (*ClientRepository, error) {
 	initClients, err := GetInitState(ctx, provider)
@@ -59,12 +112,30 @@ func InitClientRepository(
 		return nil, err
 	}
 
-	return newClientRepositoryWithDB(initClients, keepLostClients, provider, logger), nil
+	return newClientRepositoryWithDB(initClients, keepLostClients, provider, maxCachedDisconnected, logger), nil
+}
+
+// StartBackgroundSave makes SaveAsync persist clients by a given number of workers in batches of a given size.
+// It's a no-op if workers is not positive or there is no storage.
+func (s *ClientRepository) StartBackgroundSave(workers, batchSize int) {
+	if workers <= 0 || s.provider == nil {
+		return
+	}
+	s.saver = newBackgroundSaver(s.provider, workers, batchSize, s.logger)
+}
+
+// Close waits until all clients queued by SaveAsync are saved.
+func (s *ClientRepository) Close() {
+	if s.saver != nil {
+		s.saver.close()
+	}
 }
 
 func (s *ClientRepository) Save(client *Client) error {
 	if s.provider != nil {
-		err := s.provider.Save(context.Background(), client)
+		err := s.storageOp(client.ID, func() error {
+			return s.provider.Save(context.Background(), client)
+		})
 		if err != nil {
 			return fmt.Errorf("failed to save a client: %w", err)
 		}
@@ -73,12 +144,48 @@ func (s *ClientRepository) Save(client *Client) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.clients[client.ID] = client
+	delete(s.parked, client.ID)
+	s.touch(client)
+	return nil
+}
+
+// SaveAsync updates a given client in memory immediately and queues it to be saved to the storage if background save
+// is started, otherwise it's the same as Save. The storage gets a snapshot of the client taken at the time of the call.
+func (s *ClientRepository) SaveAsync(client *Client) error {
+	if s.saver == nil {
+		return s.Save(client)
+	}
+
+	s.saver.enqueue(snapshotOf(client))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients[client.ID] = client
+	delete(s.parked, client.ID)
+	s.touch(client)
 	return nil
 }
 
+// snapshotOf returns a copy of a given client to be saved to the storage while the client keeps changing.
+func snapshotOf(client *Client) *Client {
+	snapshot := convertToSqlite(client).convert()
+	snapshot.Tunnels = append([]*Tunnel(nil), client.Tunnels...)
+	return snapshot
+}
+
+// storageOp runs a given storage operation of a client with a given id, it supersedes saves of the client queued by SaveAsync.
+func (s *ClientRepository) storageOp(id string, op func() error) error {
+	if s.saver == nil {
+		return op()
+	}
+	return s.saver.exclusive(id, op)
+}
+
 func (s *ClientRepository) Delete(client *Client) error {
 	if s.provider != nil {
-		err := s.provider.Delete(context.Background(), client.ID)
+		err := s.storageOp(client.ID, func() error {
+			return s.provider.Delete(context.Background(), client.ID)
+		})
 		if err != nil {
 			return fmt.Errorf("failed to delete a client: %w", err)
 		}
@@ -87,11 +194,37 @@ func (s *ClientRepository) Delete(client *Client) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	delete(s.clients, client.ID)
+	delete(s.parked, client.ID)
+	s.untrack(client.ID)
 	return nil
 }
 
-// DeleteObsolete deletes obsolete disconnected clients and returns them.
-func (s *ClientRepository) DeleteObsolete() ([]*Client, error) {
+// DeleteObsolete deletes obsolete disconnected clients and returns them. Obsolete clients are collected under the read lock
+// and deleted in batches of a given size, the write lock is released between batches so reads don't stall on large fleets.
+// A non-positive batch size deletes all obsolete clients at once.
+func (s *ClientRepository) DeleteObsolete(batchSize int) ([]*Client, error) {
+	ids := s.getObsoleteIDs()
+	if batchSize <= 0 {
+		batchSize = len(ids)
+	}
+
+	var deleted []*Client
+	for len(ids) > 0 {
+		n := batchSize
+		if n > len(ids) {
+			n = len(ids)
+		}
+		batch, err := s.deleteObsoleteBatch(ids[:n])
+		if err != nil {
+			return nil, err
+		}
+		deleted = append(deleted, batch...)
+		ids = ids[n:]
+		if s.afterObsoleteBatch != nil {
+			s.afterObsoleteBatch()
+		}
+	}
+
 	if s.provider != nil {
 		err := s.provider.DeleteObsolete(context.Background())
 		if err != nil {
@@ -99,18 +232,218 @@ func (s *ClientRepository) DeleteObsolete() ([]*Client, error) {
 		}
 	}
 
+	return deleted, nil
+}
+
+// getObsoleteIDs returns ids of obsolete clients both in memory and evicted to the storage.
+func (s *ClientRepository) getObsoleteIDs() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var ids []string
+	for id := range s.evicted {
+		if s.evictedObsolete(id) {
+			ids = append(ids, id)
+		}
+	}
+	for id, client := range s.clients {
+		if client.Obsolete(s.KeepLostClients) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// evictedObsolete returns true if a given client is evicted and obsolete. The caller must hold the lock.
+func (s *ClientRepository) evictedObsolete(id string) bool {
+	disconnectedAt, ok := s.evicted[id]
+	// evicted clients exist only if KeepLostClients is set
+	return ok && disconnectedAt.Add(*s.KeepLostClients).Before(now())
+}
+
+// deleteObsoleteBatch deletes clients with given ids that are still obsolete, a client could reconnect since the ids were collected.
+func (s *ClientRepository) deleteObsoleteBatch(ids []string) ([]*Client, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+
 	var deleted []*Client
-	for _, client := range s.clients {
-		if client.Obsolete(s.KeepLostClients) {
-			delete(s.clients, client.ID)
+	for _, id := range ids {
+		if s.evictedObsolete(id) {
+			client, err := s.provider.Get(context.Background(), id)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get evicted client %q: %w", id, err)
+			}
+			delete(s.evicted, id)
+			if client != nil {
+				deleted = append(deleted, client)
+			}
+			continue
+		}
+
+		client := s.clients[id]
+		if client != nil && client.Obsolete(s.KeepLostClients) {
+			delete(s.clients, id)
+			s.untrack(id)
 			deleted = append(deleted, client)
 		}
 	}
 	return deleted, nil
 }
 
+// ParkObsolete parks obsolete disconnected clients instead of deleting them and returns them. Parked clients are kept
+// in the storage, but not listed among active and disconnected ones. Batches work the same way as in DeleteObsolete.
+func (s *ClientRepository) ParkObsolete(batchSize int) ([]*Client, error) {
+	ids := s.getObsoleteIDs()
+	if batchSize <= 0 {
+		batchSize = len(ids)
+	}
+
+	var parked []*Client
+	for len(ids) > 0 {
+		n := batchSize
+		if n > len(ids) {
+			n = len(ids)
+		}
+		batch, err := s.parkObsoleteBatch(ids[:n])
+		if err != nil {
+			return nil, err
+		}
+		parked = append(parked, batch...)
+		ids = ids[n:]
+		if s.afterObsoleteBatch != nil {
+			s.afterObsoleteBatch()
+		}
+	}
+
+	if s.provider != nil {
+		stored, err := s.provider.ParkObsolete(context.Background(), now())
+		if err != nil {
+			return nil, fmt.Errorf("failed to park obsolete clients: %w", err)
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, client := range stored {
+			if cur, ok := s.clients[client.ID]; ok {
+				// reconnected meanwhile, but not saved to the storage yet, so it's unparked there
+				snapshot := snapshotOf(cur)
+				err := s.storageOp(cur.ID, func() error {
+					return s.provider.Save(context.Background(), snapshot)
+				})
+				if err != nil {
+					return nil, fmt.Errorf("failed to unpark reconnected client %q: %w", cur.ID, err)
+				}
+				continue
+			}
+			s.parked[client.ID] = client
+			parked = append(parked, client)
+		}
+	}
+
+	return parked, nil
+}
+
+// parkObsoleteBatch parks clients with given ids that are still obsolete.
+func (s *ClientRepository) parkObsoleteBatch(ids []string) ([]*Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var parked []*Client
+	for _, id := range ids {
+		var client *Client
+		if s.evictedObsolete(id) {
+			var err error
+			client, err = s.provider.Get(context.Background(), id)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get evicted client %q: %w", id, err)
+			}
+			delete(s.evicted, id)
+		} else if cur := s.clients[id]; cur != nil && cur.Obsolete(s.KeepLostClients) {
+			client = cur
+		}
+		if client == nil {
+			continue
+		}
+
+		parkedAt := now()
+		client.ParkedAt = &parkedAt
+		if s.provider != nil {
+			err := s.storageOp(id, func() error {
+				return s.provider.Save(context.Background(), client)
+			})
+			if err != nil {
+				client.ParkedAt = nil
+				return nil, fmt.Errorf("failed to park client %q: %w", id, err)
+			}
+		}
+		delete(s.clients, id)
+		s.untrack(id)
+		s.parked[id] = client
+		parked = append(parked, client)
+	}
+	return parked, nil
+}
+
+// GetUserParkedClients returns parked clients that current user has access to, filtered by parameters.
+func (s *ClientRepository) GetUserParkedClients(user User, filterOptions []query.FilterOption) ([]*Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	isAdmin := user.IsAdmin()
+	result := make([]*Client, 0, len(s.parked))
+	for _, client := range s.parked {
+		if !isAdmin && !client.HasAccess(user.GetGroups()) {
+			continue
+		}
+
+		matches, err := s.clientMatchesFilters(client, filterOptions)
+		if err != nil {
+			return result, err
+		}
+
+		if matches {
+			result = append(result, client)
+		}
+	}
+	return result, nil
+}
+
+// GetParkedByID returns a parked client by a given id.
+func (s *ClientRepository) GetParkedByID(id string) *Client {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.parked[id]
+}
+
+// Unpark restores a parked client with a given id as a disconnected one and returns it, nil if the client is not parked.
+// The client is treated as disconnected now, so it's kept for KeepLostClients again.
+func (s *ClientRepository) Unpark(id string) (*Client, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client := s.parked[id]
+	if client == nil {
+		return nil, nil
+	}
+
+	parkedAt, disconnectedAt := client.ParkedAt, client.DisconnectedAt
+	unparkedAt := now()
+	client.ParkedAt = nil
+	client.DisconnectedAt = &unparkedAt
+	if s.provider != nil {
+		err := s.storageOp(id, func() error {
+			return s.provider.Save(context.Background(), client)
+		})
+		if err != nil {
+			client.ParkedAt, client.DisconnectedAt = parkedAt, disconnectedAt
+			return nil, fmt.Errorf("failed to unpark client %q: %w", id, err)
+		}
+	}
+	delete(s.parked, id)
+	s.clients[id] = client
+	s.touch(client)
+	return client, nil
+}
+
 // Count returns a number of non-obsolete active and disconnected clients.
 func (s *ClientRepository) Count() (int, error) {
 	s.mu.RLock()
@@ -147,6 +480,10 @@ func (s *ClientRepository) CountDisconnected() (int, error) {
 
 // GetByID returns non-obsolete active or disconnected client by a given id.
 func (s *ClientRepository) GetByID(id string) (*Client, error) {
+	if s.capped() {
+		return s.getByIDCapped(id)
+	}
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	client := s.clients[id]
@@ -205,9 +542,33 @@ func (s *ClientRepository) GetAllActive() []*Client {
 	return result
 }
 
-func (s *ClientRepository) getNonObsolete() ([]*Client, error) {
-	result := make([]*Client, 0, len(s.clients))
+// GetActiveFiltered returns active clients matching given filters.
+func (s *ClientRepository) GetActiveFiltered(filterOptions []query.FilterOption) ([]*Client, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var result []*Client
 	for _, client := range s.clients {
+		if client.DisconnectedAt != nil {
+			continue
+		}
+		matches, err := s.clientMatchesFilters(client, filterOptions)
+		if err != nil {
+			return nil, err
+		}
+		if matches {
+			result = append(result, client)
+		}
+	}
+	return result, nil
+}
+
+func (s *ClientRepository) getNonObsolete() ([]*Client, error) {
+	all, err := s.all()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*Client, 0, len(all))
+	for _, client := range all {
 		if !client.Obsolete(s.KeepLostClients) {
 			result = append(result, client)
 		}
@@ -216,9 +577,13 @@ func (s *ClientRepository) getNonObsolete() ([]*Client, error) {
 }
 
 func (s *ClientRepository) getNonObsoleteFiltered(user User, filterOptions []query.FilterOption) ([]*Client, error) {
+	all, err := s.all()
+	if err != nil {
+		return nil, err
+	}
 	isAdmin := user.IsAdmin()
-	result := make([]*Client, 0, len(s.clients))
-	for _, client := range s.clients {
+	result := make([]*Client, 0, len(all))
+	for _, client := range all {
 		if client.Obsolete(s.KeepLostClients) {
 			continue
 		}
@@ -254,6 +619,17 @@ func (s *ClientRepository) clientMatchesFilters(cl *Client, filterOptions []quer
 }
 
 func (s *ClientRepository) clientMatchesFilter(cl *Client, filter query.FilterOption) (bool, error) {
+	// the connection state is computed, so it's missing in the client map
+	if filter.Column == ConnectionStateField {
+		state := string(cl.ConnectionState())
+		for _, filterValue := range filter.Values {
+			if filterValue == state {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+
 	clientMap, err := s.clientToMap(cl)
 	if err != nil {
 		return false, err
@@ -263,34 +639,62 @@ func (s *ClientRepository) clientMatchesFilter(cl *Client, filter query.FilterOp
 	if !ok {
 		return false, fmt.Errorf("unsupported filter column: %s", filter.Column)
 	}
-	clientFieldValueToMatchStr := fmt.Sprint(clientFieldValueToMatch)
 
-	regx := regexp.MustCompile(`[^\\]\*+`)
-	for _, filterValue := range filter.Values {
-		hasUnescapedWildCard := regx.MatchString(filterValue)
-		if !hasUnescapedWildCard {
-			if filterValue == clientFieldValueToMatchStr {
+	// a list field, e.g. tags, matches if any of its items matches
+	if items, ok := clientFieldValueToMatch.([]interface{}); ok {
+		for _, item := range items {
+			if s.valueMatchesFilter(fmt.Sprint(item), filter) {
 				return true, nil
 			}
-
-			continue
 		}
+		return false, nil
+	}
 
-		filterValueRegex, err := regexp.Compile(strings.ReplaceAll(filterValue, "*", ".*"))
-		if err != nil {
-			s.logger.Errorf("failed to generate regex for '%s': %v", filterValue, err)
-			if filterValue == clientFieldValueToMatchStr {
-				return true, nil
+	return s.valueMatchesFilter(fmt.Sprint(clientFieldValueToMatch), filter), nil
+}
+
+// valueMatchesFilter returns true if a given value equals any of the filter values or matches it with wildcards.
+func (s *ClientRepository) valueMatchesFilter(clientFieldValueToMatchStr string, filter query.FilterOption) bool {
+	for _, filterValue := range filter.Values {
+		literal, filterValueRegex := parseFilterValue(filterValue)
+		if filterValueRegex == nil {
+			if literal == clientFieldValueToMatchStr {
+				return true
 			}
 			continue
 		}
 
 		if filterValueRegex.MatchString(clientFieldValueToMatchStr) {
-			return true, nil
+			return true
 		}
 	}
 
-	return false, nil
+	return false
+}
+
+// parseFilterValue returns a filter value with unescaped '\*' if it doesn't have wildcards,
+// otherwise a regexp that matches whole values where each unescaped '*' matches any chars.
+func parseFilterValue(filterValue string) (string, *regexp.Regexp) {
+	var literal, pattern strings.Builder
+	hasWildcard := false
+	for i := 0; i < len(filterValue); i++ {
+		switch {
+		case filterValue[i] == '\\' && i+1 < len(filterValue) && filterValue[i+1] == '*':
+			literal.WriteByte('*')
+			pattern.WriteString(regexp.QuoteMeta("*"))
+			i++
+		case filterValue[i] == '*':
+			hasWildcard = true
+			pattern.WriteString(".*")
+		default:
+			literal.WriteByte(filterValue[i])
+			pattern.WriteString(regexp.QuoteMeta(filterValue[i : i+1]))
+		}
+	}
+	if !hasWildcard {
+		return literal.String(), nil
+	}
+	return "", regexp.MustCompile("^" + pattern.String() + "$")
 }
 
 func (s *ClientRepository) clientToMap(cl *Client) (map[string]interface{}, error) {
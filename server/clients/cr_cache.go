@@ -0,0 +1,139 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+)
+
+// capped returns true if only a limited number of disconnected clients is kept in memory.
+// Evicted clients are loaded from the storage, it requires KeepLostClients to be set
+// otherwise disconnected clients are not kept in the storage.
+func (s *ClientRepository) capped() bool {
+	return s.maxCachedDisconnected > 0 && s.provider != nil && s.KeepLostClients != nil
+}
+
+// touch marks a given disconnected client as the most recently used and evicts the least recently used
+// ones over the limit. Active clients are not tracked, they are always kept in memory.
+// It's a no-op if the cache is not capped. The caller must hold the write lock, so touchCached can't run meanwhile.
+func (s *ClientRepository) touch(client *Client) {
+	if !s.capped() {
+		return
+	}
+
+	delete(s.evicted, client.ID)
+	if client.DisconnectedAt == nil {
+		s.untrack(client.ID)
+		return
+	}
+
+	if elem, ok := s.disconnectedElems[client.ID]; ok {
+		s.disconnected.MoveToBack(elem)
+	} else {
+		s.disconnectedElems[client.ID] = s.disconnected.PushBack(client.ID)
+	}
+
+	for s.disconnected.Len() > s.maxCachedDisconnected {
+		id := s.disconnected.Remove(s.disconnected.Front()).(string)
+		delete(s.disconnectedElems, id)
+		if evicted := s.clients[id]; evicted != nil && evicted.DisconnectedAt != nil {
+			s.evicted[id] = *evicted.DisconnectedAt
+		}
+		delete(s.clients, id)
+	}
+}
+
+// untrack removes a given client from the disconnected clients bookkeeping. The caller must hold the write lock.
+func (s *ClientRepository) untrack(id string) {
+	if !s.capped() {
+		return
+	}
+
+	if elem, ok := s.disconnectedElems[id]; ok {
+		s.disconnected.Remove(elem)
+		delete(s.disconnectedElems, id)
+	}
+	delete(s.evicted, id)
+}
+
+// touchCached marks a given cached disconnected client as the most recently used one under the read lock.
+// Nothing is evicted, so the cached clients don't change. The caller must hold the read lock.
+func (s *ClientRepository) touchCached(client *Client) {
+	s.lruMu.Lock()
+	defer s.lruMu.Unlock()
+
+	if elem, ok := s.disconnectedElems[client.ID]; ok {
+		s.disconnected.MoveToBack(elem)
+	}
+}
+
+// getByIDCapped returns non-obsolete client by a given id. A cached client is returned under the read lock,
+// an evicted one is loaded from the storage and cached again as the most recently used one under the write lock.
+func (s *ClientRepository) getByIDCapped(id string) (*Client, error) {
+	s.mu.RLock()
+	client := s.clients[id]
+	if client != nil {
+		s.touchCached(client)
+		s.mu.RUnlock()
+		if client.Obsolete(s.KeepLostClients) {
+			return nil, nil
+		}
+		return client, nil
+	}
+	s.mu.RUnlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// could be loaded meanwhile
+	client = s.clients[id]
+	if client == nil {
+		if _, ok := s.evicted[id]; !ok {
+			return nil, nil
+		}
+		var err error
+		client, err = s.provider.Get(context.Background(), id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get evicted client %q: %w", id, err)
+		}
+		if client == nil {
+			delete(s.evicted, id)
+			return nil, nil
+		}
+		s.clients[id] = client
+	}
+	s.touch(client)
+
+	if client.Obsolete(s.KeepLostClients) {
+		return nil, nil
+	}
+	return client, nil
+}
+
+// all returns clients kept in memory and evicted ones loaded from the storage if any. The caller must hold the lock.
+func (s *ClientRepository) all() ([]*Client, error) {
+	result := make([]*Client, 0, len(s.clients)+len(s.evicted))
+	for _, client := range s.clients {
+		result = append(result, client)
+	}
+	if len(s.evicted) == 0 {
+		return result, nil
+	}
+
+	ids := make([]string, 0, len(s.evicted))
+	for id := range s.evicted {
+		ids = append(ids, id)
+	}
+	stored, err := s.provider.GetByIDs(context.Background(), ids)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get evicted clients: %w", err)
+	}
+	return append(result, stored...), nil
+}
+
+// disconnectedBefore returns true if a is disconnected before b, active clients are sorted last.
+func disconnectedBefore(a, b *Client) bool {
+	if a.DisconnectedAt == nil || b.DisconnectedAt == nil {
+		return b.DisconnectedAt == nil && a.DisconnectedAt != nil
+	}
+	return a.DisconnectedAt.Before(*b.DisconnectedAt)
+}
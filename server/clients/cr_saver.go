@@ -0,0 +1,211 @@
+package clients
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	chshare "github.com/cloudradar-monitoring/rport/share"
+)
+
+// batchSaver is implemented by providers that can save several clients at once.
+type batchSaver interface {
+	SaveBatch(ctx context.Context, clients []*Client) error
+}
+
+// saveRetryDelay is a delay before a worker retries to save clients after a failure. var is used to override in tests
+var saveRetryDelay = time.Second
+
+// backgroundSaver saves clients to a storage by a bounded number of workers. Saves of the same client are coalesced,
+// so only its latest state is written. Clients are written in the order they were queued and writes of the same client
+// never overlap, so an older state can't overwrite a newer one.
+type backgroundSaver struct {
+	provider  ClientProvider
+	batchSize int
+	logger    *chshare.Logger
+
+	mu   sync.Mutex
+	cond *sync.Cond
+	// pending holds the latest not written state of queued clients by client id
+	pending map[string]*Client
+	// queue holds ids of pending clients in the order they were queued
+	queue []string
+	// writing holds ids of clients that are being written
+	writing map[string]bool
+	// superseding holds a number of synchronous operations waiting for a client to be written by client id
+	superseding map[string]int
+	closed      bool
+	wg          sync.WaitGroup
+}
+
+func newBackgroundSaver(provider ClientProvider, workers, batchSize int, logger *chshare.Logger) *backgroundSaver {
+	if batchSize <= 0 {
+		batchSize = 1
+	}
+	s := &backgroundSaver{
+		provider:    provider,
+		batchSize:   batchSize,
+		logger:      logger,
+		pending:     make(map[string]*Client),
+		writing:     make(map[string]bool),
+		superseding: make(map[string]int),
+	}
+	s.cond = sync.NewCond(&s.mu)
+	for i := 0; i < workers; i++ {
+		s.wg.Add(1)
+		go s.work()
+	}
+	return s
+}
+
+// enqueue queues a given client to be saved. It replaces a pending state of the same client if any.
+func (s *backgroundSaver) enqueue(client *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.pending[client.ID]; !ok {
+		s.queue = append(s.queue, client.ID)
+	}
+	s.pending[client.ID] = client
+	s.cond.Broadcast()
+}
+
+// exclusive drops a pending state of a client with a given id, waits until the client is not being written and runs
+// a given storage operation. It's used for synchronous saves and deletes that supersede queued saves.
+func (s *backgroundSaver) exclusive(id string, op func() error) error {
+	s.mu.Lock()
+	delete(s.pending, id)
+	s.superseding[id]++
+	for s.writing[id] {
+		s.cond.Wait()
+	}
+	if s.superseding[id]--; s.superseding[id] == 0 {
+		delete(s.superseding, id)
+	}
+	s.writing[id] = true
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.writing, id)
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	}()
+	return op()
+}
+
+// close waits until all pending clients are written and stops the workers.
+func (s *backgroundSaver) close() {
+	s.mu.Lock()
+	s.closed = true
+	s.cond.Broadcast()
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *backgroundSaver) work() {
+	defer s.wg.Done()
+	for {
+		batch, ok := s.next()
+		if !ok {
+			return
+		}
+		failed := s.save(batch)
+		if len(failed) == 0 {
+			s.done(batch)
+			continue
+		}
+		if s.retry(batch, failed) {
+			time.Sleep(saveRetryDelay)
+		}
+	}
+}
+
+// next waits for pending clients that are not being written and returns up to batchSize of them.
+// It returns false if the saver is closed and there is nothing left to write.
+func (s *backgroundSaver) next() ([]*Client, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		var batch []*Client
+		rest := s.queue[:0]
+		for _, id := range s.queue {
+			client, ok := s.pending[id]
+			if !ok {
+				// superseded by a synchronous save or delete
+				continue
+			}
+			if len(batch) == s.batchSize || s.writing[id] {
+				rest = append(rest, id)
+				continue
+			}
+			delete(s.pending, id)
+			s.writing[id] = true
+			batch = append(batch, client)
+		}
+		s.queue = rest
+		if len(batch) > 0 {
+			return batch, true
+		}
+		if s.closed && len(s.pending) == 0 {
+			return nil, false
+		}
+		s.cond.Wait()
+	}
+}
+
+// save writes given clients and returns the ones that failed to be written.
+func (s *backgroundSaver) save(batch []*Client) []*Client {
+	ctx := context.Background()
+	if bs, ok := s.provider.(batchSaver); ok && len(batch) > 1 {
+		err := bs.SaveBatch(ctx, batch)
+		if err == nil {
+			return nil
+		}
+		s.logger.Errorf("Failed to save a batch of %d clients, saving them one by one: %v", len(batch), err)
+	}
+
+	var failed []*Client
+	for _, client := range batch {
+		if err := s.provider.Save(ctx, client); err != nil {
+			s.logger.Errorf("Failed to save client %q: %v", client.ID, err)
+			failed = append(failed, client)
+		}
+	}
+	return failed
+}
+
+// done marks given clients as written.
+func (s *backgroundSaver) done(batch []*Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, client := range batch {
+		delete(s.writing, client.ID)
+	}
+	s.cond.Broadcast()
+}
+
+// retry marks given clients as written and queues failed ones again unless they have a newer pending state
+// or are superseded by a synchronous operation.
+// Failed clients are dropped if the saver is closed. It returns true if any client is queued again.
+func (s *backgroundSaver) retry(batch, failed []*Client) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, client := range batch {
+		delete(s.writing, client.ID)
+	}
+	retried := false
+	for _, client := range failed {
+		if s.closed {
+			s.logger.Errorf("Client %q is not saved, the server is shutting down", client.ID)
+			continue
+		}
+		if _, ok := s.pending[client.ID]; ok || s.superseding[client.ID] > 0 {
+			continue
+		}
+		s.pending[client.ID] = client
+		s.queue = append(s.queue, client.ID)
+		retried = true
+	}
+	s.cond.Broadcast()
+	return retried
+}
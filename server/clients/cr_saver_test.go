@@ -0,0 +1,234 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writesCountingProvider counts writes to a storage, optionally blocks or fails them.
+type writesCountingProvider struct {
+	*SqliteProvider
+
+	mu       sync.Mutex
+	writes   int
+	failures int
+	// started receives a signal when a write starts if set, the write waits for release then
+	started chan struct{}
+	release chan struct{}
+}
+
+func newWritesCountingProvider(t *testing.T) *writesCountingProvider {
+	// a file is used because each connection to an in-memory DB gets its own DB
+	p, err := NewSqliteProvider(filepath.Join(t.TempDir(), "clients.db"), hour)
+	require.NoError(t, err)
+	return &writesCountingProvider{SqliteProvider: p}
+}
+
+func (p *writesCountingProvider) write() error {
+	p.mu.Lock()
+	p.writes++
+	started, release := p.started, p.release
+	fail := p.failures > 0
+	if fail {
+		p.failures--
+	}
+	p.mu.Unlock()
+
+	if started != nil {
+		started <- struct{}{}
+		<-release
+	}
+	if fail {
+		return errors.New("write failed")
+	}
+	return nil
+}
+
+func (p *writesCountingProvider) Save(ctx context.Context, client *Client) error {
+	if err := p.write(); err != nil {
+		return err
+	}
+	return p.SqliteProvider.Save(ctx, client)
+}
+
+func (p *writesCountingProvider) SaveBatch(ctx context.Context, clients []*Client) error {
+	if err := p.write(); err != nil {
+		return err
+	}
+	return p.SqliteProvider.SaveBatch(ctx, clients)
+}
+
+func (p *writesCountingProvider) Writes() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.writes
+}
+
+func TestSaveAsyncReconnectStorm(t *testing.T) {
+	p := newWritesCountingProvider(t)
+	defer p.Close()
+	repo := newClientRepositoryWithDB(nil, &hour, p, 0, testLog)
+	repo.StartBackgroundSave(4, 50)
+
+	const clientsCount = 200
+	const updatesCount = 3
+	// writes are held until all updates are queued, so the result doesn't depend on a speed of the storage
+	p.started = make(chan struct{}, clientsCount*updatesCount)
+	p.release = make(chan struct{})
+	wg := sync.WaitGroup{}
+	for i := 0; i < clientsCount; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("client-%d", i)
+			for j := 1; j <= updatesCount; j++ {
+				client := New(t).ID(id).Build()
+				client.Name = fmt.Sprintf("name-%d", j)
+				assert.NoError(t, repo.SaveAsync(client))
+
+				// the in-memory repository is updated immediately
+				got, err := repo.GetByID(id)
+				assert.NoError(t, err)
+				assert.Equal(t, client, got)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(p.release)
+
+	// when
+	repo.Close()
+
+	// then
+	stored, err := p.GetAll(context.Background())
+	require.NoError(t, err)
+	require.Len(t, stored, clientsCount)
+	for _, c := range stored {
+		assert.Equal(t, fmt.Sprintf("name-%d", updatesCount), c.Name, c.ID)
+	}
+	assert.Less(t, p.Writes(), clientsCount, "saves are expected to be coalesced and batched")
+}
+
+func TestSaveAsyncSupersededBySyncOps(t *testing.T) {
+	testCases := []struct {
+		name        string
+		syncOp      func(repo *ClientRepository, client *Client) error
+		wantStored  bool
+		wantVersion string
+	}{
+		{
+			name: "save",
+			syncOp: func(repo *ClientRepository, client *Client) error {
+				client.Name = "v3"
+				return repo.Save(client)
+			},
+			wantStored:  true,
+			wantVersion: "v3",
+		},
+		{
+			name: "delete",
+			syncOp: func(repo *ClientRepository, client *Client) error {
+				return repo.Delete(client)
+			},
+			wantStored: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			p := newWritesCountingProvider(t)
+			defer p.Close()
+			p.started = make(chan struct{})
+			p.release = make(chan struct{})
+			repo := newClientRepositoryWithDB(nil, &hour, p, 0, testLog)
+			repo.StartBackgroundSave(2, 10)
+
+			v1 := New(t).ID("client-1").Build()
+			v1.Name = "v1"
+			require.NoError(t, repo.SaveAsync(v1))
+			// v1 is being written
+			<-p.started
+			v2 := New(t).ID("client-1").Build()
+			v2.Name = "v2"
+			require.NoError(t, repo.SaveAsync(v2))
+
+			// when
+			syncDone := make(chan error)
+			go func() {
+				syncDone <- tc.syncOp(repo, New(t).ID("client-1").Build())
+			}()
+			// let the sync operation wait for v1 to be written
+			require.Eventually(t, func() bool {
+				repo.saver.mu.Lock()
+				defer repo.saver.mu.Unlock()
+				return repo.saver.superseding["client-1"] > 0
+			}, time.Second, time.Millisecond)
+			p.mu.Lock()
+			p.started = nil
+			p.mu.Unlock()
+			close(p.release)
+			require.NoError(t, <-syncDone)
+			repo.Close()
+
+			// then
+			stored, err := p.Get(context.Background(), "client-1")
+			require.NoError(t, err)
+			if !tc.wantStored {
+				assert.Nil(t, stored)
+				return
+			}
+			require.NotNil(t, stored)
+			assert.Equal(t, tc.wantVersion, stored.Name)
+			// v2 is dropped
+			assert.Equal(t, 2, p.Writes())
+		})
+	}
+}
+
+func TestSaveAsyncRetriesFailedWrites(t *testing.T) {
+	defer func(d time.Duration) { saveRetryDelay = d }(saveRetryDelay)
+	saveRetryDelay = time.Millisecond
+
+	p := newWritesCountingProvider(t)
+	defer p.Close()
+	// the batch and a single save fail
+	p.failures = 2
+	repo := newClientRepositoryWithDB(nil, &hour, p, 0, testLog)
+	repo.StartBackgroundSave(1, 10)
+
+	c1 := New(t).ID("client-1").Build()
+	c2 := New(t).ID("client-2").Build()
+	require.NoError(t, repo.SaveAsync(c1))
+	require.NoError(t, repo.SaveAsync(c2))
+
+	// wait for the retry
+	require.Eventually(t, func() bool {
+		stored, err := p.GetAll(context.Background())
+		return err == nil && len(stored) == 2
+	}, time.Second, 10*time.Millisecond)
+	repo.Close()
+}
+
+func TestSaveAsyncWithoutBackgroundSave(t *testing.T) {
+	p := newWritesCountingProvider(t)
+	defer p.Close()
+	repo := newClientRepositoryWithDB(nil, &hour, p, 0, testLog)
+
+	client := New(t).ID("client-1").Build()
+	require.NoError(t, repo.SaveAsync(client))
+
+	// saved synchronously
+	stored, err := p.Get(context.Background(), client.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, stored)
+	assert.Equal(t, 1, p.Writes())
+}
@@ -1,6 +1,8 @@
 package clients
 
 import (
+	"context"
+	"sync"
 	"testing"
 	"time"
 
@@ -64,7 +66,7 @@ func TestCRWithExpiration(t *testing.T) {
 	assert.NoError(err)
 	assert.Nil(gotClient)
 
-	deleted, err := repo.DeleteObsolete()
+	deleted, err := repo.DeleteObsolete(0)
 	assert.NoError(err)
 	require.Len(t, deleted, 1)
 	assert.Equal(c4, deleted[0])
@@ -114,7 +116,7 @@ func TestCRWithNoExpiration(t *testing.T) {
 	assert.NoError(err)
 	assert.Nil(gotClient)
 
-	deleted, err := repo.DeleteObsolete()
+	deleted, err := repo.DeleteObsolete(0)
 	assert.NoError(err)
 	assert.Len(deleted, 0)
 
@@ -203,6 +205,33 @@ func TestCRWithFilter(t *testing.T) {
 			},
 			expectedClientIDs: []string{},
 		},
+		{
+			filters: []query.FilterOption{
+				{
+					Column: "environment",
+					Values: []string{
+						"prod",
+					},
+				},
+			},
+			expectedClientIDs: []string{
+				"aa1210c7-1899-491e-8e71-564cacaf1df8",
+				"daflkdfjqlkerlkejrqlwedalfdfadfa",
+			},
+		},
+		{
+			filters: []query.FilterOption{
+				{
+					Column: "package_manager",
+					Values: []string{
+						"apt",
+					},
+				},
+			},
+			expectedClientIDs: []string{
+				"aa1210c7-1899-491e-8e71-564cacaf1df8",
+			},
+		},
 		{
 			filters: []query.FilterOption{
 				{
@@ -244,7 +273,7 @@ func TestCRWithFilter(t *testing.T) {
 				{
 					Column: "timezone",
 					Values: []string{
-						"UTC*",
+						"*(UTC-07:00)",
 					},
 				},
 			},
@@ -270,6 +299,64 @@ func TestCRWithFilter(t *testing.T) {
 	}
 }
 
+func TestCRWithWildcardFilter(t *testing.T) {
+	prod := New(t).ID("prod").Build()
+	prod.Environment = "prod"
+	preprod := New(t).ID("preprod").Build()
+	preprod.Environment = "pre-prod"
+	production := New(t).ID("production").Build()
+	production.Environment = "production"
+	star := New(t).ID("star").Build()
+	star.Environment = "prod*"
+	repo := NewClientRepository([]*Client{prod, preprod, production, star}, &hour, testLog)
+
+	testCases := []struct {
+		name    string
+		value   string
+		wantIDs []string
+	}{
+		{
+			name:    "any value",
+			value:   "*",
+			wantIDs: []string{"prod", "preprod", "production", "star"},
+		},
+		{
+			name:    "suffix",
+			value:   "*prod",
+			wantIDs: []string{"prod", "preprod"},
+		},
+		{
+			name:    "prefix",
+			value:   "prod*",
+			wantIDs: []string{"prod", "production", "star"},
+		},
+		{
+			name:    "exact value doesn't match partially",
+			value:   "prod",
+			wantIDs: []string{"prod"},
+		},
+		{
+			name:    "escaped literal asterisk",
+			value:   `prod\*`,
+			wantIDs: []string{"star"},
+		},
+		{
+			name:    "regexp chars are literal",
+			value:   "pr.d*",
+			wantIDs: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := repo.GetUserClients(admin, []query.FilterOption{{Column: "environment", Values: []string{tc.value}}})
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tc.wantIDs, clientIDs(got))
+		})
+	}
+}
+
 func TestCRWithUnsupportedFilter(t *testing.T) {
 	repo := NewClientRepository([]*Client{c1}, nil, testLog)
 	_, err := repo.GetUserClients(admin, []query.FilterOption{
@@ -283,6 +370,48 @@ func TestCRWithUnsupportedFilter(t *testing.T) {
 	require.EqualError(t, err, "unsupported filter column: unknown_field")
 }
 
+func TestCRWithConnectionStateFilter(t *testing.T) {
+	connected := New(t).ID("connected").Build()
+	disconnected := New(t).ID("disconnected").DisconnectedDuration(time.Minute).Build()
+	repo := NewClientRepository([]*Client{connected, disconnected}, &hour, testLog)
+
+	testCases := []struct {
+		name    string
+		values  []string
+		wantIDs []string
+	}{
+		{
+			name:    "connected",
+			values:  []string{"connected"},
+			wantIDs: []string{"connected"},
+		},
+		{
+			name:    "disconnected",
+			values:  []string{"disconnected"},
+			wantIDs: []string{"disconnected"},
+		},
+		{
+			name:    "both states",
+			values:  []string{"connected", "disconnected"},
+			wantIDs: []string{"connected", "disconnected"},
+		},
+		{
+			name:    "no wildcards",
+			values:  []string{"conn*"},
+			wantIDs: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := repo.GetUserClients(admin, []query.FilterOption{{Column: ConnectionStateField, Values: tc.values}})
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tc.wantIDs, clientIDs(got))
+		})
+	}
+}
+
 func TestGetUserClients(t *testing.T) {
 	c1 := New(t).Build()                                                             // no groups
 	c2 := New(t).AllowedUserGroups([]string{users.Administrators}).Build()           // admin
@@ -333,3 +462,160 @@ func TestGetUserClients(t *testing.T) {
 		})
 	}
 }
+
+func TestCRWithMaxCachedDisconnected(t *testing.T) {
+	now = nowMockF
+
+	active := New(t).ID("active").Build()
+	d1 := New(t).ID("d1").DisconnectedDuration(30 * time.Minute).Build()
+	d2 := New(t).ID("d2").DisconnectedDuration(20 * time.Minute).Build()
+	d3 := New(t).ID("d3").DisconnectedDuration(10 * time.Minute).Build()
+	obsolete := New(t).ID("obsolete").DisconnectedDuration(2 * hour).Build()
+	p := newFakeClientProvider(t, hour, active, d1, d2, d3, obsolete)
+	defer p.Close()
+
+	repo := newClientRepositoryWithDB([]*Client{active, d1, d2, d3, obsolete}, &hour, p, 2, testLog)
+
+	cachedIDs := func() []string {
+		var ids []string
+		for id := range repo.clients {
+			ids = append(ids, id)
+		}
+		return ids
+	}
+
+	// the least recently disconnected clients are evicted, active clients are kept
+	assert.ElementsMatch(t, []string{"active", "d2", "d3"}, cachedIDs())
+	gotStored, err := p.Get(context.Background(), d1.ID)
+	require.NoError(t, err)
+	assert.EqualValues(t, d1, gotStored)
+
+	// evicted clients are still listed and counted
+	gotClients, err := repo.GetAll()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"active", "d1", "d2", "d3"}, clientIDs(gotClients))
+	gotCount, err := repo.Count()
+	require.NoError(t, err)
+	assert.Equal(t, 4, gotCount)
+	gotCountDisconnected, err := repo.CountDisconnected()
+	require.NoError(t, err)
+	assert.Equal(t, 3, gotCountDisconnected)
+
+	// an evicted client is loaded on miss and evicts the least recently used one
+	gotClient, err := repo.GetByID(d1.ID)
+	require.NoError(t, err)
+	assert.EqualValues(t, d1, gotClient)
+	assert.ElementsMatch(t, []string{"active", "d1", "d3"}, cachedIDs())
+
+	// a reconnected client is not counted in the cap
+	reconnected := shallowCopy(d3)
+	reconnected.DisconnectedAt = nil
+	require.NoError(t, repo.Save(reconnected))
+	d4 := New(t).ID("d4").DisconnectedDuration(time.Minute).Build()
+	require.NoError(t, repo.Save(d4))
+	assert.ElementsMatch(t, []string{"active", "d1", "d3", "d4"}, cachedIDs())
+
+	// a new disconnected client evicts the least recently used one
+	d5 := New(t).ID("d5").DisconnectedDuration(time.Minute).Build()
+	require.NoError(t, repo.Save(d5))
+	assert.ElementsMatch(t, []string{"active", "d3", "d4", "d5"}, cachedIDs())
+
+	// evicted clients are deleted when obsolete
+	now = func() time.Time { return nowMock.Add(45 * time.Minute) }
+	defer func() { now = nowMockF }()
+	deleted, err := repo.DeleteObsolete(0)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"obsolete", "d1", "d2"}, clientIDs(deleted))
+	gotClient, err = repo.GetByID(d1.ID)
+	require.NoError(t, err)
+	assert.Nil(t, gotClient)
+	gotClients, err = repo.GetAll()
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"active", "d3", "d4", "d5"}, clientIDs(gotClients))
+}
+
+func TestCRWithMaxCachedDisconnectedConcurrentGetByID(t *testing.T) {
+	now = nowMockF
+
+	d1 := New(t).ID("d1").DisconnectedDuration(30 * time.Minute).Build()
+	d2 := New(t).ID("d2").DisconnectedDuration(20 * time.Minute).Build()
+	d3 := New(t).ID("d3").DisconnectedDuration(10 * time.Minute).Build()
+	p := newFakeClientProvider(t, hour, d1, d2, d3)
+	defer p.Close()
+	repo := newClientRepositoryWithDB([]*Client{d1, d2, d3}, &hour, p, 2, testLog)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, id := range []string{"d1", "d2", "d3"} {
+				gotClient, err := repo.GetByID(id)
+				assert.NoError(t, err)
+				if assert.NotNil(t, gotClient) {
+					assert.Equal(t, id, gotClient.ID)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, repo.clients, 2)
+	assert.Equal(t, 2, repo.disconnected.Len())
+	assert.Len(t, repo.evicted, 1)
+}
+
+func clientIDs(clients []*Client) []string {
+	ids := make([]string, 0, len(clients))
+	for _, cur := range clients {
+		ids = append(ids, cur.ID)
+	}
+	return ids
+}
+
+func TestCRGetActiveFilteredByTags(t *testing.T) {
+	web := New(t).ID("web").Build()
+	web.Tags = []string{"prod", "web"}
+	db := New(t).ID("db").Build()
+	db.Tags = []string{"prod-db"}
+	disconnected := New(t).ID("disconnected").DisconnectedDuration(time.Minute).Build()
+	disconnected.Tags = []string{"prod"}
+	untagged := New(t).ID("untagged").Build()
+	repo := NewClientRepository([]*Client{web, db, disconnected, untagged}, &hour, testLog)
+
+	testCases := []struct {
+		name    string
+		tags    []string
+		wantIDs []string
+	}{
+		{
+			name:    "exact tag",
+			tags:    []string{"prod"},
+			wantIDs: []string{"web"},
+		},
+		{
+			name:    "any of tags",
+			tags:    []string{"web", "prod-db"},
+			wantIDs: []string{"web", "db"},
+		},
+		{
+			name:    "wildcard",
+			tags:    []string{"prod*"},
+			wantIDs: []string{"web", "db"},
+		},
+		{
+			name:    "unknown tag",
+			tags:    []string{"unknown"},
+			wantIDs: []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := repo.GetActiveFiltered([]query.FilterOption{{Column: "tags", Values: tc.tags}})
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tc.wantIDs, clientIDs(got))
+		})
+	}
+}
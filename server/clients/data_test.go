@@ -43,6 +43,8 @@ var c1 = &Client{
 	IPv4:                   []string{"192.168.122.111"},
 	IPv6:                   []string{"fe80::b84f:aff:fe59:a0b1"},
 	Tags:                   []string{"Linux", "Datacenter 1"},
+	Environment:            "prod",
+	PackageManager:         "apt",
 	Version:                "0.1.12",
 	Address:                "88.198.189.161:50078",
 	Tunnels: []*Tunnel{
@@ -53,6 +55,7 @@ var c1 = &Client{
 				LocalPort:  "2222",
 				RemoteHost: "0.0.0.0",
 				RemotePort: "22",
+				Protocol:   "tcp",
 			},
 		},
 		{
@@ -62,6 +65,7 @@ var c1 = &Client{
 				LocalPort:  "4000",
 				RemoteHost: "0.0.0.0",
 				RemotePort: "80",
+				Protocol:   "tcp",
 			},
 		},
 	},
@@ -91,6 +95,7 @@ var c2 = &Client{
 	IPv4:                   []string{"192.168.122.112"},
 	IPv6:                   []string{"fe80::b84f:aff:fe59:a0b2"},
 	Tags:                   []string{"Linux", "Datacenter 2"},
+	Environment:            "staging",
 	Version:                "0.1.12",
 	Address:                "88.198.189.162:50078",
 	Tunnels: []*Tunnel{
@@ -101,6 +106,7 @@ var c2 = &Client{
 				LocalPort:  "2222",
 				RemoteHost: "0.0.0.0",
 				RemotePort: "22",
+				Protocol:   "tcp",
 			},
 		},
 	},
@@ -166,6 +172,8 @@ var c5 = &Client{
 	IPv4:                   []string{"192.168.122.124"},
 	IPv6:                   []string{"fe80::b84f:aff:fe56:a0b4"},
 	Tags:                   []string{"Linux", "Datacenter 4"},
+	Environment:            "prod",
+	PackageManager:         "windows_update",
 	Version:                "0.1.12",
 	Address:                "88.198.189.124:50078",
 	Tunnels:                make([]*Tunnel, 0),
@@ -201,6 +209,8 @@ func shallowCopy(c *Client) *Client {
 		IPv4:                   append([]string{}, c.IPv4...),
 		IPv6:                   append([]string{}, c.IPv6...),
 		Tags:                   append([]string{}, c.Tags...),
+		Environment:            c.Environment,
+		PackageManager:         c.PackageManager,
 		Version:                c.Version,
 		Address:                c.Address,
 		Tunnels:                append([]*Tunnel{}, c.Tunnels...),
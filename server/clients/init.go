@@ -17,6 +17,7 @@ func GetInitState(ctx context.Context, p ClientProvider) ([]*Client, error) {
 	for _, cur := range all {
 		if cur.DisconnectedAt == nil {
 			cur.DisconnectedAt = &now
+			cur.DisconnectReason = DisconnectReasonServerShutdown
 			err := p.Save(ctx, cur)
 			if err != nil {
 				return nil, fmt.Errorf("failed to save client: %v", err)
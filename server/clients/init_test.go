@@ -13,6 +13,7 @@ func TestGetInitState(t *testing.T) {
 	c1 := New(t).Build()
 	wantC1 := shallowCopy(c1)
 	wantC1.DisconnectedAt = &nowMock
+	wantC1.DisconnectReason = DisconnectReasonServerShutdown
 	c2 := New(t).DisconnectedDuration(5 * time.Minute).Build()
 	c3 := New(t).DisconnectedDuration(2 * time.Hour).Build()
 
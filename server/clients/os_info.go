@@ -0,0 +1,96 @@
+package clients
+
+import (
+	"strings"
+)
+
+// unknownOSValue is reported by clients when OS info can't be obtained, it's kept as is
+const unknownOSValue = "unknown"
+
+// knownOSNameWords are canonical spellings of words in OS names that are not title case
+var knownOSNameWords = map[string]string{
+	"almalinux": "AlmaLinux",
+	"centos":    "CentOS",
+	"freebsd":   "FreeBSD",
+	"gnu/linux": "GNU/Linux",
+	"lts":       "LTS",
+	"macos":     "macOS",
+	"netbsd":    "NetBSD",
+	"openbsd":   "OpenBSD",
+	"opensuse":  "openSUSE",
+	"os":        "OS",
+	"rhel":      "RHEL",
+	"sles":      "SLES",
+	"suse":      "SUSE",
+}
+
+// OSRaw holds OS fields as reported by a client. It's set only when they differ from the normalized values.
+type OSRaw struct {
+	OS         string `json:"os"`
+	OSFamily   string `json:"os_family"`
+	OSKernel   string `json:"os_kernel"`
+	OSFullName string `json:"os_full_name"`
+	OSVersion  string `json:"os_version"`
+}
+
+// NormalizeOS brings OS fields reported by a client to canonical forms, so they can be filtered by exact values.
+// All fields are trimmed and repeated spaces are collapsed. Besides that:
+//   - os_kernel and os_family are lower case, e.g. "linux", "debian";
+//   - os_full_name is title case, e.g. "Ubuntu 20.04", except known names, e.g. "openSUSE", "macOS",
+//     and words with digits or in mixed case, e.g. "SP2", that are kept as reported;
+//   - os and os_version keep their case.
+//
+// The raw values are kept in OSRaw if any of them is changed.
+func (c *Client) NormalizeOS() {
+	raw := OSRaw{
+		OS:         c.OS,
+		OSFamily:   c.OSFamily,
+		OSKernel:   c.OSKernel,
+		OSFullName: c.OSFullName,
+		OSVersion:  c.OSVersion,
+	}
+
+	c.OS = normalizeSpaces(c.OS)
+	c.OSFamily = strings.ToLower(normalizeSpaces(c.OSFamily))
+	c.OSKernel = strings.ToLower(normalizeSpaces(c.OSKernel))
+	c.OSFullName = normalizeOSName(normalizeSpaces(c.OSFullName))
+	c.OSVersion = normalizeSpaces(c.OSVersion)
+
+	normalized := OSRaw{
+		OS:         c.OS,
+		OSFamily:   c.OSFamily,
+		OSKernel:   c.OSKernel,
+		OSFullName: c.OSFullName,
+		OSVersion:  c.OSVersion,
+	}
+	c.OSRaw = nil
+	if raw != normalized {
+		c.OSRaw = &raw
+	}
+}
+
+func normalizeSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func normalizeOSName(s string) string {
+	if strings.ToLower(s) == unknownOSValue {
+		return unknownOSValue
+	}
+	words := strings.Fields(s)
+	for i, word := range words {
+		words[i] = normalizeOSNameWord(word)
+	}
+	return strings.Join(words, " ")
+}
+
+func normalizeOSNameWord(word string) string {
+	lower := strings.ToLower(word)
+	if known, ok := knownOSNameWords[lower]; ok {
+		return known
+	}
+	if strings.ContainsAny(word, "0123456789") || (word != lower && word != strings.ToUpper(word)) {
+		return word
+	}
+	return strings.Title(lower)
+}
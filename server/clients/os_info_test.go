@@ -0,0 +1,166 @@
+package clients
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeOS(t *testing.T) {
+	testCases := []struct {
+		name    string
+		client  *Client
+		wantOS  OSRaw
+		wantRaw *OSRaw
+	}{
+		{
+			name: "canonical values",
+			client: &Client{
+				OS:         "Linux host 5.4.0-42-generic x86_64 GNU/Linux",
+				OSFamily:   "debian",
+				OSKernel:   "linux",
+				OSFullName: "Ubuntu 18.04",
+				OSVersion:  "18.04",
+			},
+			wantOS: OSRaw{
+				OS:         "Linux host 5.4.0-42-generic x86_64 GNU/Linux",
+				OSFamily:   "debian",
+				OSKernel:   "linux",
+				OSFullName: "Ubuntu 18.04",
+				OSVersion:  "18.04",
+			},
+			wantRaw: nil,
+		},
+		{
+			name: "mixed case and spaces",
+			client: &Client{
+				OS:         " Linux  host 5.4.0-42-generic x86_64 GNU/Linux\n",
+				OSFamily:   "Debian ",
+				OSKernel:   "LINUX",
+				OSFullName: "UBUNTU  18.04",
+				OSVersion:  " 18.04",
+			},
+			wantOS: OSRaw{
+				OS:         "Linux host 5.4.0-42-generic x86_64 GNU/Linux",
+				OSFamily:   "debian",
+				OSKernel:   "linux",
+				OSFullName: "Ubuntu 18.04",
+				OSVersion:  "18.04",
+			},
+			wantRaw: &OSRaw{
+				OS:         " Linux  host 5.4.0-42-generic x86_64 GNU/Linux\n",
+				OSFamily:   "Debian ",
+				OSKernel:   "LINUX",
+				OSFullName: "UBUNTU  18.04",
+				OSVersion:  " 18.04",
+			},
+		},
+		{
+			name: "windows",
+			client: &Client{
+				OS:         "Microsoft Windows Server 2016 Standard 10.0.14393 Build 14393 Server",
+				OSFamily:   "Server",
+				OSKernel:   "windows",
+				OSFullName: "microsoft windows server 2016 standard",
+				OSVersion:  "10.0.14393 Build 14393",
+			},
+			wantOS: OSRaw{
+				OS:         "Microsoft Windows Server 2016 Standard 10.0.14393 Build 14393 Server",
+				OSFamily:   "server",
+				OSKernel:   "windows",
+				OSFullName: "Microsoft Windows Server 2016 Standard",
+				OSVersion:  "10.0.14393 Build 14393",
+			},
+			wantRaw: &OSRaw{
+				OS:         "Microsoft Windows Server 2016 Standard 10.0.14393 Build 14393 Server",
+				OSFamily:   "Server",
+				OSKernel:   "windows",
+				OSFullName: "microsoft windows server 2016 standard",
+				OSVersion:  "10.0.14393 Build 14393",
+			},
+		},
+		{
+			name: "known names",
+			client: &Client{
+				OS:         "Linux host 5.3.18-lp152.19-default x86_64 GNU/Linux",
+				OSFamily:   "suse",
+				OSKernel:   "linux",
+				OSFullName: "OPENSUSE LEAP 15.2",
+				OSVersion:  "15.2",
+			},
+			wantOS: OSRaw{
+				OS:         "Linux host 5.3.18-lp152.19-default x86_64 GNU/Linux",
+				OSFamily:   "suse",
+				OSKernel:   "linux",
+				OSFullName: "openSUSE Leap 15.2",
+				OSVersion:  "15.2",
+			},
+			wantRaw: &OSRaw{
+				OS:         "Linux host 5.3.18-lp152.19-default x86_64 GNU/Linux",
+				OSFamily:   "suse",
+				OSKernel:   "linux",
+				OSFullName: "OPENSUSE LEAP 15.2",
+				OSVersion:  "15.2",
+			},
+		},
+		{
+			name: "mixed case and digits are kept",
+			client: &Client{
+				OS:         "Darwin",
+				OSFamily:   "Standalone Workstation",
+				OSKernel:   "darwin",
+				OSFullName: "macOS big sur 11.2",
+				OSVersion:  "11.2",
+			},
+			wantOS: OSRaw{
+				OS:         "Darwin",
+				OSFamily:   "standalone workstation",
+				OSKernel:   "darwin",
+				OSFullName: "macOS Big Sur 11.2",
+				OSVersion:  "11.2",
+			},
+			wantRaw: &OSRaw{
+				OS:         "Darwin",
+				OSFamily:   "Standalone Workstation",
+				OSKernel:   "darwin",
+				OSFullName: "macOS big sur 11.2",
+				OSVersion:  "11.2",
+			},
+		},
+		{
+			name: "unknown values",
+			client: &Client{
+				OS:         "unknown",
+				OSFamily:   "unknown",
+				OSKernel:   "unknown",
+				OSFullName: "unknown",
+				OSVersion:  "unknown",
+			},
+			wantOS: OSRaw{
+				OS:         "unknown",
+				OSFamily:   "unknown",
+				OSKernel:   "unknown",
+				OSFullName: "unknown",
+				OSVersion:  "unknown",
+			},
+			wantRaw: nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			c := tc.client
+
+			c.NormalizeOS()
+
+			assert.Equal(t, tc.wantOS, OSRaw{
+				OS:         c.OS,
+				OSFamily:   c.OSFamily,
+				OSKernel:   c.OSKernel,
+				OSFullName: c.OSFullName,
+				OSVersion:  c.OSVersion,
+			})
+			assert.Equal(t, tc.wantRaw, c.OSRaw)
+		})
+	}
+}
@@ -2,7 +2,10 @@ package clients
 
 import (
 	"sort"
+	"strconv"
 	"strings"
+
+	"github.com/cloudradar-monitoring/rport/share/models"
 )
 
 func SortByID(a []*Client, desc bool) {
@@ -51,11 +54,122 @@ func SortByHostname(a []*Client, desc bool) {
 	})
 }
 
+// SortByVersion sorts by a semantic version, so 0.1.12 goes after 0.1.9.
 func SortByVersion(a []*Client, desc bool) {
 	sort.Slice(a, func(i, j int) bool {
-		aiVersion := strings.ToLower(a[i].Version)
-		ajVersion := strings.ToLower(a[j].Version)
-		less := aiVersion < ajVersion || aiVersion == ajVersion && strings.ToLower(a[i].ID) < strings.ToLower(a[j].ID)
+		cmp := compareVersions(a[i].Version, a[j].Version)
+		less := cmp < 0 || cmp == 0 && strings.ToLower(a[i].ID) < strings.ToLower(a[j].ID)
+		if desc {
+			return !less
+		}
+		return less
+	})
+}
+
+func SortByTimezone(a []*Client, desc bool) {
+	sort.Slice(a, func(i, j int) bool {
+		aiTimezone := strings.ToLower(a[i].Timezone)
+		ajTimezone := strings.ToLower(a[j].Timezone)
+		less := aiTimezone < ajTimezone || aiTimezone == ajTimezone && strings.ToLower(a[i].ID) < strings.ToLower(a[j].ID)
+		if desc {
+			return !less
+		}
+		return less
+	})
+}
+
+// compareVersions compares versions like "v0.1.12" or "0.2.0-rc1" and returns -1, 0 or 1.
+// Dot separated parts are compared numerically if both are numbers. A pre-release version is lower than the release.
+// Versions that don't follow this format are compared as strings.
+func compareVersions(a, b string) int {
+	aCore, aPre := splitVersion(a)
+	bCore, bPre := splitVersion(b)
+	aParts := strings.Split(aCore, ".")
+	bParts := strings.Split(bCore, ".")
+	for k := 0; k < len(aParts) && k < len(bParts); k++ {
+		if cmp := compareVersionParts(aParts[k], bParts[k]); cmp != 0 {
+			return cmp
+		}
+	}
+	switch {
+	case len(aParts) != len(bParts):
+		return compareInts(len(aParts), len(bParts))
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	return compareVersionParts(aPre, bPre)
+}
+
+// splitVersion returns a version without a "v" prefix and build metadata split into a core and a pre-release part.
+func splitVersion(v string) (core, preRelease string) {
+	v = strings.TrimPrefix(strings.ToLower(v), "v")
+	if i := strings.Index(v, "+"); i >= 0 {
+		v = v[:i]
+	}
+	if i := strings.Index(v, "-"); i >= 0 {
+		return v[:i], v[i+1:]
+	}
+	return v, ""
+}
+
+func compareVersionParts(a, b string) int {
+	aNum, aErr := strconv.Atoi(a)
+	bNum, bErr := strconv.Atoi(b)
+	if aErr == nil && bErr == nil {
+		return compareInts(aNum, bNum)
+	}
+	return strings.Compare(a, b)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func SortByEnvironment(a []*Client, desc bool) {
+	sort.Slice(a, func(i, j int) bool {
+		aiEnvironment := strings.ToLower(a[i].Environment)
+		ajEnvironment := strings.ToLower(a[j].Environment)
+		less := aiEnvironment < ajEnvironment || aiEnvironment == ajEnvironment && strings.ToLower(a[i].ID) < strings.ToLower(a[j].ID)
+		if desc {
+			return !less
+		}
+		return less
+	})
+}
+
+func SortByUpdatesAvailable(a []*Client, desc bool) {
+	sortByUpdatesCount(a, desc, func(s *models.UpdatesStatus) int { return s.UpdatesAvailable })
+}
+
+func SortBySecurityUpdatesAvailable(a []*Client, desc bool) {
+	sortByUpdatesCount(a, desc, func(s *models.UpdatesStatus) int { return s.SecurityUpdatesAvailable })
+}
+
+// sortByUpdatesCount sorts by a count of pending updates, clients without updates status are always last.
+func sortByUpdatesCount(a []*Client, desc bool, count func(*models.UpdatesStatus) int) {
+	sort.Slice(a, func(i, j int) bool {
+		aiStatus := a[i].UpdatesStatus
+		ajStatus := a[j].UpdatesStatus
+		if aiStatus == nil || ajStatus == nil {
+			if aiStatus == nil && ajStatus == nil {
+				return strings.ToLower(a[i].ID) < strings.ToLower(a[j].ID)
+			}
+			return ajStatus == nil
+		}
+
+		aiCount := count(aiStatus)
+		ajCount := count(ajStatus)
+		less := aiCount < ajCount || aiCount == ajCount && strings.ToLower(a[i].ID) < strings.ToLower(a[j].ID)
 		if desc {
 			return !less
 		}
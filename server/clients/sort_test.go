@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/cloudradar-monitoring/rport/share/models"
 )
 
 func TestSortByIDAsc(t *testing.T) {
@@ -123,3 +125,177 @@ func TestSortByHostnameDesc(t *testing.T) {
 	// then
 	assert.ElementsMatch(t, a, []*Client{c7H, c6H, c5H, c4H, c3H, c2H, c1H})
 }
+
+var (
+	c1E = &Client{ID: "a1", Environment: "dev"}
+	c2E = &Client{ID: "a2", Environment: "Prod"}
+	c3E = &Client{ID: "a3", Environment: "prod"}
+	c4E = &Client{ID: "a4", Environment: "staging"}
+	c5E = &Client{ID: "a5"}
+)
+
+func TestSortByEnvironment(t *testing.T) {
+	testCases := []struct {
+		name string
+		desc bool
+		want []*Client
+	}{
+		{
+			name: "asc",
+			want: []*Client{c5E, c1E, c2E, c3E, c4E},
+		},
+		{
+			name: "desc",
+			desc: true,
+			want: []*Client{c4E, c3E, c2E, c1E, c5E},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := []*Client{c3E, c1E, c4E, c5E, c2E}
+
+			SortByEnvironment(a, tc.desc)
+
+			assert.Equal(t, tc.want, a)
+		})
+	}
+}
+
+func TestSortByUpdatesCount(t *testing.T) {
+	c1U := &Client{ID: "a1", UpdatesStatus: &models.UpdatesStatus{UpdatesAvailable: 5, SecurityUpdatesAvailable: 0}}
+	c2U := &Client{ID: "a2", UpdatesStatus: &models.UpdatesStatus{UpdatesAvailable: 0, SecurityUpdatesAvailable: 0}}
+	c3U := &Client{ID: "a3", UpdatesStatus: &models.UpdatesStatus{UpdatesAvailable: 12, SecurityUpdatesAvailable: 3}}
+	c4U := &Client{ID: "a4"}
+	c5U := &Client{ID: "a5", UpdatesStatus: &models.UpdatesStatus{UpdatesAvailable: 5, SecurityUpdatesAvailable: 1}}
+	c6U := &Client{ID: "a6"}
+
+	testCases := []struct {
+		name     string
+		sortFunc func(a []*Client, desc bool)
+		desc     bool
+		want     []*Client
+	}{
+		{
+			name:     "updates available asc",
+			sortFunc: SortByUpdatesAvailable,
+			want:     []*Client{c2U, c1U, c5U, c3U, c4U, c6U},
+		},
+		{
+			name:     "updates available desc",
+			sortFunc: SortByUpdatesAvailable,
+			desc:     true,
+			want:     []*Client{c3U, c5U, c1U, c2U, c4U, c6U},
+		},
+		{
+			name:     "security updates available asc",
+			sortFunc: SortBySecurityUpdatesAvailable,
+			want:     []*Client{c1U, c2U, c5U, c3U, c4U, c6U},
+		},
+		{
+			name:     "security updates available desc",
+			sortFunc: SortBySecurityUpdatesAvailable,
+			desc:     true,
+			want:     []*Client{c3U, c5U, c2U, c1U, c4U, c6U},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := []*Client{c6U, c5U, c4U, c3U, c2U, c1U}
+
+			tc.sortFunc(a, tc.desc)
+
+			assert.Equal(t, tc.want, a)
+		})
+	}
+}
+
+func TestSortByVersion(t *testing.T) {
+	c1V := &Client{ID: "a1", Version: "0.1.9"}
+	c2V := &Client{ID: "a2", Version: "0.1.12"}
+	c3V := &Client{ID: "a3", Version: "0.2.0-rc1"}
+	c4V := &Client{ID: "a4", Version: "0.2.0"}
+	c5V := &Client{ID: "a5", Version: "v0.1.12"}
+	c6V := &Client{ID: "a6"}
+
+	testCases := []struct {
+		name string
+		desc bool
+		want []*Client
+	}{
+		{
+			name: "asc",
+			want: []*Client{c6V, c1V, c2V, c5V, c3V, c4V},
+		},
+		{
+			name: "desc",
+			desc: true,
+			want: []*Client{c4V, c3V, c5V, c2V, c1V, c6V},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := []*Client{c4V, c2V, c6V, c1V, c5V, c3V}
+
+			SortByVersion(a, tc.desc)
+
+			assert.Equal(t, tc.want, a)
+		})
+	}
+}
+
+func TestSortByTimezone(t *testing.T) {
+	c1T := &Client{ID: "a1", Timezone: "CET (UTC+01:00)"}
+	c2T := &Client{ID: "a2", Timezone: "UTC (UTC+00:00)"}
+	c3T := &Client{ID: "a3", Timezone: "utc (UTC+00:00)"}
+	c4T := &Client{ID: "a4"}
+
+	testCases := []struct {
+		name string
+		desc bool
+		want []*Client
+	}{
+		{
+			name: "asc",
+			want: []*Client{c4T, c1T, c2T, c3T},
+		},
+		{
+			name: "desc",
+			desc: true,
+			want: []*Client{c3T, c2T, c1T, c4T},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := []*Client{c3T, c1T, c4T, c2T}
+
+			SortByTimezone(a, tc.desc)
+
+			assert.Equal(t, tc.want, a)
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	testCases := []struct {
+		a, b string
+		want int
+	}{
+		{a: "0.1.12", b: "0.1.9", want: 1},
+		{a: "0.1.9", b: "0.1.12", want: -1},
+		{a: "v0.1.9", b: "0.1.9", want: 0},
+		{a: "1.0", b: "1.0.1", want: -1},
+		{a: "0.2.0-rc1", b: "0.2.0", want: -1},
+		{a: "0.2.0-rc2", b: "0.2.0-rc1", want: 1},
+		{a: "0.2.0+build1", b: "0.2.0", want: 0},
+		{a: "", b: "0.0.1", want: -1},
+		{a: "dev", b: "0.0.1", want: 1},
+	}
+
+	for _, tc := range testCases {
+		assert.Equalf(t, tc.want, compareVersions(tc.a, tc.b), "compareVersions(%q, %q)", tc.a, tc.b)
+	}
+}
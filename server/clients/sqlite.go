@@ -18,9 +18,17 @@ import (
 
 type ClientProvider interface {
 	GetAll(ctx context.Context) ([]*Client, error)
+	// Get returns a client by a given id or nil if not found
+	Get(ctx context.Context, id string) (*Client, error)
+	// GetByIDs returns clients with given ids, missing ones are skipped
+	GetByIDs(ctx context.Context, ids []string) ([]*Client, error)
 	Save(ctx context.Context, client *Client) error
 	DeleteObsolete(ctx context.Context) error
+	// ParkObsolete marks obsolete clients as parked at a given time and returns them
+	ParkObsolete(ctx context.Context, parkedAt time.Time) ([]*Client, error)
 	Delete(ctx context.Context, id string) error
+	// Ping checks whether the underlying DB is available
+	Ping(ctx context.Context) error
 	Close() error
 }
 
@@ -37,13 +45,17 @@ func NewSqliteProvider(dbPath string, keepLostClients time.Duration) (*SqlitePro
 	return &SqliteProvider{db: db, keepLostClients: keepLostClients}, nil
 }
 
+// GetAll returns non-obsolete clients and parked ones.
 func (p *SqliteProvider) GetAll(ctx context.Context) ([]*Client, error) {
+	keepLostClientsStart := p.keepLostClientsStart()
 	var res []*clientSqlite
 	err := p.db.SelectContext(
 		ctx,
 		&res,
-		"SELECT * FROM clients WHERE disconnected_at IS NULL OR DATETIME(disconnected_at) >= DATETIME(?)",
-		p.keepLostClientsStart(),
+		"SELECT * FROM clients WHERE disconnected_at IS NULL OR DATETIME(disconnected_at) >= DATETIME(?) "+
+			"UNION ALL SELECT * FROM clients WHERE DATETIME(disconnected_at) < DATETIME(?) AND parked_at IS NOT NULL",
+		keepLostClientsStart,
+		keepLostClientsStart,
 	)
 	if err != nil {
 		return nil, err
@@ -51,7 +63,7 @@ func (p *SqliteProvider) GetAll(ctx context.Context) ([]*Client, error) {
 	return convertClientList(res), nil
 }
 
-func (p *SqliteProvider) get(ctx context.Context, id string) (*Client, error) {
+func (p *SqliteProvider) Get(ctx context.Context, id string) (*Client, error) {
 	res := &clientSqlite{}
 	err := p.db.GetContext(ctx, res, "SELECT * FROM clients WHERE id = ?", id)
 	if err != nil {
@@ -63,29 +75,129 @@ func (p *SqliteProvider) get(ctx context.Context, id string) (*Client, error) {
 	return res.convert(), nil
 }
 
+// getByIDsBatchSize keeps the number of query params below the sqlite limit.
+const getByIDsBatchSize = 500
+
+func (p *SqliteProvider) GetByIDs(ctx context.Context, ids []string) ([]*Client, error) {
+	var res []*clientSqlite
+	for len(ids) > 0 {
+		n := getByIDsBatchSize
+		if n > len(ids) {
+			n = len(ids)
+		}
+		q, params, err := sqlx.In("SELECT * FROM clients WHERE id IN (?)", ids[:n])
+		if err != nil {
+			return nil, err
+		}
+		var batch []*clientSqlite
+		if err := p.db.SelectContext(ctx, &batch, p.db.Rebind(q), params...); err != nil {
+			return nil, err
+		}
+		res = append(res, batch...)
+		ids = ids[n:]
+	}
+	return convertClientList(res), nil
+}
+
 func (p *SqliteProvider) Save(ctx context.Context, client *Client) error {
 	_, err := p.db.NamedExecContext(
 		ctx,
-		"INSERT OR REPLACE INTO clients (id, client_auth_id, disconnected_at, details) VALUES (:id, :client_auth_id, :disconnected_at, :details)",
+		"INSERT OR REPLACE INTO clients (id, client_auth_id, disconnected_at, parked_at, details) VALUES (:id, :client_auth_id, :disconnected_at, :parked_at, :details)",
 		convertToSqlite(client),
 	)
 	return err
 }
 
+// SaveBatch saves given clients in a single transaction.
+func (p *SqliteProvider) SaveBatch(ctx context.Context, clients []*Client) error {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, client := range clients {
+		_, err := tx.NamedExecContext(
+			ctx,
+			"INSERT OR REPLACE INTO clients (id, client_auth_id, disconnected_at, parked_at, details) VALUES (:id, :client_auth_id, :disconnected_at, :parked_at, :details)",
+			convertToSqlite(client),
+		)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Ping runs a query, since pinging an open sqlite connection succeeds even if the DB file can't be read.
+func (p *SqliteProvider) Ping(ctx context.Context) error {
+	var exists bool
+	return p.db.GetContext(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM clients)")
+}
+
+// DeleteObsolete deletes obsolete clients. Parked clients are kept.
 func (p *SqliteProvider) DeleteObsolete(ctx context.Context) error {
 	_, err := p.db.ExecContext(
 		ctx,
-		"DELETE FROM clients WHERE disconnected_at IS NOT NULL AND DATETIME(disconnected_at) < DATETIME(?)",
+		"DELETE FROM clients WHERE disconnected_at IS NOT NULL AND DATETIME(disconnected_at) < DATETIME(?) AND parked_at IS NULL",
 		p.keepLostClientsStart(),
 	)
 	return err
 }
 
+func (p *SqliteProvider) ParkObsolete(ctx context.Context, parkedAt time.Time) ([]*Client, error) {
+	tx, err := p.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	var res []*clientSqlite
+	err = tx.SelectContext(
+		ctx,
+		&res,
+		"SELECT * FROM clients WHERE disconnected_at IS NOT NULL AND DATETIME(disconnected_at) < DATETIME(?) AND parked_at IS NULL",
+		p.keepLostClientsStart(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	for _, cur := range res {
+		_, err := tx.ExecContext(ctx, "UPDATE clients SET parked_at = ? WHERE id = ?", parkedAt, cur.ID)
+		if err != nil {
+			return nil, err
+		}
+		cur.ParkedAt = sql.NullTime{Time: parkedAt, Valid: true}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return convertClientList(res), nil
+}
+
 func (p *SqliteProvider) Delete(ctx context.Context, id string) error {
 	_, err := p.db.ExecContext(ctx, "DELETE FROM clients WHERE id = ?", id)
 	return err
 }
 
+// Register records that a client with a given id has connected. It returns true if the id is seen for the first time.
+// Registrations are kept when clients are deleted.
+func (p *SqliteProvider) Register(ctx context.Context, id string) (bool, error) {
+	res, err := p.db.ExecContext(ctx, "INSERT OR IGNORE INTO registered_clients (id, registered_at) VALUES (?, ?)", id, now())
+	if err != nil {
+		return false, err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
 func (p *SqliteProvider) keepLostClientsStart() time.Time {
 	return now().Add(-p.keepLostClients)
 }
@@ -110,6 +222,7 @@ func convertToSqlite(v *Client) *clientSqlite {
 			OSVersion:              v.OSVersion,
 			OSVirtualizationSystem: v.OSVirtualizationSystem,
 			OSVirtualizationRole:   v.OSVirtualizationRole,
+			OSRaw:                  v.OSRaw,
 			CPUFamily:              v.CPUFamily,
 			CPUModel:               v.CPUModel,
 			CPUModelName:           v.CPUModelName,
@@ -120,14 +233,22 @@ func convertToSqlite(v *Client) *clientSqlite {
 			IPv4:                   v.IPv4,
 			IPv6:                   v.IPv6,
 			Tags:                   v.Tags,
+			AutoTags:               v.AutoTags,
+			PackageManager:         v.PackageManager,
+			Interpreters:           v.Interpreters,
 			Tunnels:                v.Tunnels,
+			TunnelAuthHashes:       tunnelAuthHashes(v.Tunnels),
 			AllowedUserGroups:      v.AllowedUserGroups,
 			UpdatesStatus:          v.UpdatesStatus,
+			DisconnectReason:       v.DisconnectReason,
 		},
 	}
 	if v.DisconnectedAt != nil {
 		res.DisconnectedAt = sql.NullTime{Time: *v.DisconnectedAt, Valid: true}
 	}
+	if v.ParkedAt != nil {
+		res.ParkedAt = sql.NullTime{Time: *v.ParkedAt, Valid: true}
+	}
 	return res
 }
 
@@ -135,35 +256,43 @@ type clientSqlite struct {
 	ID             string         `db:"id"`
 	ClientAuthID   string         `db:"client_auth_id"`
 	DisconnectedAt sql.NullTime   `db:"disconnected_at"` // DisconnectedAt is a time when a client was disconnected. If nil - it's connected.
+	ParkedAt       sql.NullTime   `db:"parked_at"`
 	Details        *clientDetails `db:"details"`
 }
 
 type clientDetails struct {
-	NumCPUs                int                   `json:"num_cpus"`
-	MemoryTotal            uint64                `json:"mem_total"`
-	Name                   string                `json:"name"`
-	OS                     string                `json:"os"`
-	OSArch                 string                `json:"os_arch"`
-	OSFamily               string                `json:"os_family"`
-	OSKernel               string                `json:"os_kernel"`
-	OSFullName             string                `json:"os_full_name"`
-	OSVersion              string                `json:"os_version"`
-	OSVirtualizationSystem string                `json:"os_virtualization_system"`
-	OSVirtualizationRole   string                `json:"os_virtualization_role"`
-	CPUFamily              string                `json:"cpu_family"`
-	CPUModel               string                `json:"cpu_model"`
-	CPUModelName           string                `json:"cpu_model_name"`
-	CPUVendor              string                `json:"cpu_vendor"`
-	Timezone               string                `json:"timezone"`
-	Hostname               string                `json:"hostname"`
-	Version                string                `json:"version"`
-	Address                string                `json:"address"`
-	IPv4                   []string              `json:"ipv4"`
-	IPv6                   []string              `json:"ipv6"`
-	Tags                   []string              `json:"tags"`
-	Tunnels                []*Tunnel             `json:"tunnels"`
-	AllowedUserGroups      []string              `json:"allowed_user_groups"`
-	UpdatesStatus          *models.UpdatesStatus `json:"updates_status"`
+	NumCPUs                int       `json:"num_cpus"`
+	MemoryTotal            uint64    `json:"mem_total"`
+	Name                   string    `json:"name"`
+	OS                     string    `json:"os"`
+	OSArch                 string    `json:"os_arch"`
+	OSFamily               string    `json:"os_family"`
+	OSKernel               string    `json:"os_kernel"`
+	OSFullName             string    `json:"os_full_name"`
+	OSVersion              string    `json:"os_version"`
+	OSVirtualizationSystem string    `json:"os_virtualization_system"`
+	OSVirtualizationRole   string    `json:"os_virtualization_role"`
+	OSRaw                  *OSRaw    `json:"os_raw"`
+	CPUFamily              string    `json:"cpu_family"`
+	CPUModel               string    `json:"cpu_model"`
+	CPUModelName           string    `json:"cpu_model_name"`
+	CPUVendor              string    `json:"cpu_vendor"`
+	Timezone               string    `json:"timezone"`
+	Hostname               string    `json:"hostname"`
+	Version                string    `json:"version"`
+	Address                string    `json:"address"`
+	IPv4                   []string  `json:"ipv4"`
+	IPv6                   []string  `json:"ipv6"`
+	Tags                   []string  `json:"tags"`
+	AutoTags               []string  `json:"auto_tags"`
+	PackageManager         string    `json:"package_manager"`
+	Interpreters           []string  `json:"interpreters"`
+	Tunnels                []*Tunnel `json:"tunnels"`
+	// TunnelAuthHashes are bcrypt hashes of basic auth passwords by tunnel ids, they are not serialized with tunnels
+	TunnelAuthHashes  map[string]string     `json:"tunnel_auth_hashes,omitempty"`
+	AllowedUserGroups []string              `json:"allowed_user_groups"`
+	UpdatesStatus     *models.UpdatesStatus `json:"updates_status"`
+	DisconnectReason  DisconnectReason      `json:"disconnect_reason"`
 }
 
 func (d *clientDetails) Scan(value interface{}) error {
@@ -178,9 +307,27 @@ func (d *clientDetails) Scan(value interface{}) error {
 	if err != nil {
 		return fmt.Errorf("failed to decode 'details' field: %v", err)
 	}
+	for _, t := range d.Tunnels {
+		t.AuthPasswordHash = d.TunnelAuthHashes[t.ID]
+	}
 	return nil
 }
 
+// tunnelAuthHashes returns bcrypt hashes of basic auth passwords of given tunnels by tunnel ids, nil if none has basic auth.
+func tunnelAuthHashes(tunnels []*Tunnel) map[string]string {
+	var res map[string]string
+	for _, t := range tunnels {
+		if t.AuthPasswordHash == "" {
+			continue
+		}
+		if res == nil {
+			res = make(map[string]string)
+		}
+		res[t.ID] = t.AuthPasswordHash
+	}
+	return res
+}
+
 func (d *clientDetails) Value() (driver.Value, error) {
 	if d == nil {
 		return nil, errors.New("'details' cannot be nil")
@@ -206,6 +353,9 @@ func (s *clientSqlite) convert() *Client {
 		IPv4:                   d.IPv4,
 		IPv6:                   d.IPv6,
 		Tags:                   d.Tags,
+		AutoTags:               d.AutoTags,
+		PackageManager:         d.PackageManager,
+		Interpreters:           d.Interpreters,
 		Version:                d.Version,
 		Address:                d.Address,
 		Tunnels:                d.Tunnels,
@@ -213,6 +363,7 @@ func (s *clientSqlite) convert() *Client {
 		OSVersion:              d.OSVersion,
 		OSVirtualizationSystem: d.OSVirtualizationSystem,
 		OSVirtualizationRole:   d.OSVirtualizationRole,
+		OSRaw:                  d.OSRaw,
 		CPUFamily:              d.CPUFamily,
 		CPUModel:               d.CPUModel,
 		CPUModelName:           d.CPUModelName,
@@ -222,10 +373,14 @@ func (s *clientSqlite) convert() *Client {
 		Timezone:               d.Timezone,
 		AllowedUserGroups:      d.AllowedUserGroups,
 		UpdatesStatus:          d.UpdatesStatus,
+		DisconnectReason:       d.DisconnectReason,
 	}
 	if s.DisconnectedAt.Valid {
 		res.DisconnectedAt = &s.DisconnectedAt.Time
 	}
+	if s.ParkedAt.Valid {
+		res.ParkedAt = &s.ParkedAt.Time
+	}
 	return res
 }
 
@@ -2,6 +2,8 @@ package clients
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -32,13 +34,27 @@ func TestClientsSqliteProvider(t *testing.T) {
 	require.NoError(t, err)
 	assert.ElementsMatch(t, []*Client{c1, c2, c3, c4}, gotAll)
 
+	// verify get clients by ids, obsolete clients are returned too
+	gotByIDs, err := p.GetByIDs(ctx, []string{c2.ID, c5.ID, "unknown"})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []*Client{c2, c5}, gotByIDs)
+	// more ids than fit in a single query
+	manyIDs := []string{c1.ID}
+	for i := 0; i < getByIDsBatchSize; i++ {
+		manyIDs = append(manyIDs, fmt.Sprintf("unknown-%d", i))
+	}
+	manyIDs = append(manyIDs, c3.ID)
+	gotByIDs, err = p.GetByIDs(ctx, manyIDs)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []*Client{c1, c3}, gotByIDs)
+
 	// verify delete obsolete clients
-	gotObsolete, err := p.get(ctx, c5.ID)
+	gotObsolete, err := p.Get(ctx, c5.ID)
 	require.NoError(t, err)
 	require.EqualValues(t, c5, gotObsolete)
 
 	require.NoError(t, p.DeleteObsolete(ctx))
-	gotObsolete, err = p.get(ctx, c5.ID)
+	gotObsolete, err = p.Get(ctx, c5.ID)
 	require.NoError(t, err)
 	require.Nil(t, gotObsolete)
 
@@ -47,7 +63,7 @@ func TestClientsSqliteProvider(t *testing.T) {
 	assert.ElementsMatch(t, []*Client{c1, c2, c3, c4}, gotAll)
 
 	// verify not found
-	gotNone, err := p.get(ctx, "unknown-id")
+	gotNone, err := p.Get(ctx, "unknown-id")
 	require.NoError(t, err)
 	require.Nil(t, gotNone)
 
@@ -55,10 +71,108 @@ func TestClientsSqliteProvider(t *testing.T) {
 	d := time.Date(2020, 11, 5, 12, 11, 20, 0, time.UTC)
 	c1.DisconnectedAt = &d
 	require.NoError(t, p.Save(ctx, c1))
-	gotUpdated, err := p.get(ctx, c1.ID)
+	gotUpdated, err := p.Get(ctx, c1.ID)
 	require.NoError(t, err)
 	require.EqualValues(t, c1, gotUpdated)
 	gotAll, err = p.GetAll(ctx)
 	require.NoError(t, err)
 	assert.ElementsMatch(t, []*Client{c1, c2, c3, c4}, gotAll)
 }
+
+func TestClientsSqliteProviderTunnelAuthHash(t *testing.T) {
+	ctx := context.Background()
+	p := newFakeClientProvider(t, hour)
+	defer p.Close()
+	c1 := New(t).Build()
+	c1.Tunnels[1].AuthUser = "admin"
+	c1.Tunnels[1].AuthPasswordHash = "$2a$10$hash"
+	require.NoError(t, p.Save(ctx, c1))
+
+	got, err := p.Get(ctx, c1.ID)
+	require.NoError(t, err)
+	assert.Equal(t, c1, got)
+
+	// the hash is stored apart from the tunnels
+	var details string
+	require.NoError(t, p.db.GetContext(ctx, &details, "SELECT details FROM clients WHERE id = ?", c1.ID))
+	assert.Contains(t, details, `"tunnel_auth_hashes":{"2":"$2a$10$hash"}`)
+	assert.Equal(t, 1, strings.Count(details, "$2a$10$hash"))
+}
+
+func TestClientsSqliteProviderParkObsolete(t *testing.T) {
+	ctx := context.Background()
+	p := newFakeClientProvider(t, hour)
+	defer p.Close()
+
+	c1 := New(t).Build()                                               // active
+	c2 := New(t).DisconnectedDuration(5 * time.Minute).Build()         // disconnected
+	c3 := New(t).DisconnectedDuration(hour + time.Millisecond).Build() // obsolete
+	require.NoError(t, p.Save(ctx, c1))
+	require.NoError(t, p.Save(ctx, c2))
+	require.NoError(t, p.Save(ctx, c3))
+
+	// verify park obsolete clients
+	parkedAt := time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	gotParked, err := p.ParkObsolete(ctx, parkedAt)
+	require.NoError(t, err)
+	c3.ParkedAt = &parkedAt
+	assert.Equal(t, []*Client{c3}, gotParked)
+
+	gotStored, err := p.Get(ctx, c3.ID)
+	require.NoError(t, err)
+	assert.EqualValues(t, c3, gotStored)
+
+	// verify parked clients are returned and not deleted
+	gotAll, err := p.GetAll(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []*Client{c1, c2, c3}, gotAll)
+
+	require.NoError(t, p.DeleteObsolete(ctx))
+	gotAll, err = p.GetAll(ctx)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []*Client{c1, c2, c3}, gotAll)
+
+	// verify parked clients are not parked again
+	gotParked, err = p.ParkObsolete(ctx, parkedAt.Add(time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, gotParked)
+}
+
+func TestClientsSqliteProviderRegister(t *testing.T) {
+	ctx := context.Background()
+	p := newFakeClientProvider(t, hour)
+	defer p.Close()
+
+	first, err := p.Register(ctx, "client-1")
+	require.NoError(t, err)
+	assert.True(t, first)
+
+	first, err = p.Register(ctx, "client-1")
+	require.NoError(t, err)
+	assert.False(t, first)
+
+	// registrations are kept when clients are deleted
+	require.NoError(t, p.Delete(ctx, "client-1"))
+	first, err = p.Register(ctx, "client-1")
+	require.NoError(t, err)
+	assert.False(t, first)
+
+	first, err = p.Register(ctx, "client-2")
+	require.NoError(t, err)
+	assert.True(t, first)
+}
+
+func TestClientsSqliteProviderPackageManager(t *testing.T) {
+	ctx := context.Background()
+	p := newFakeClientProvider(t, hour)
+	defer p.Close()
+
+	c1 := New(t).Build()
+	c1.PackageManager = "zypper"
+	require.NoError(t, p.Save(ctx, c1))
+
+	gotClient, err := p.Get(ctx, c1.ID)
+	require.NoError(t, err)
+	require.NotNil(t, gotClient)
+	assert.Equal(t, "zypper", gotClient.PackageManager)
+}
@@ -2,14 +2,16 @@ package clients
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"io"
 	"net"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 
-	"github.com/jpillora/sizestr"
 	"golang.org/x/crypto/ssh"
 
 	chshare "github.com/cloudradar-monitoring/rport/share"
@@ -23,42 +25,118 @@ type Tunnel struct {
 
 	ID string `json:"id"`
 
+	clientID                  string
 	sshConn                   ssh.Conn
-	connectionIDAutoIncrement int
+	connectionIDAutoIncrement int32
 	connCount                 int32
-	connCloseChan             chan bool
+	lastActivity              int64 // unix nano time of the last data transferred in either direction
 	stopFn                    func()
 	wg                        sync.WaitGroup // TODO: verify whether wait group is needed here
 	acl                       *TunnelACL     // parsed Remote.ACL field
+	balancer                  *backendBalancer
+	copyLimiter               *CopyLimiter // server-wide limit of data copies, nil if unlimited
+	deadlines                 ConnDeadlines
+	connLogging               ConnLogging
+	proxyTLS                  *tls.Config // used to serve https tunnels guarded by basic auth, nil if not configured
+	udpLimits                 udpLimits
+	autoCloseChan             chan bool
+	autoCloseOnce             sync.Once
 }
 
-func NewTunnel(logger *chshare.Logger, ssh ssh.Conn, id string, remote *chshare.Remote, acl *TunnelACL) *Tunnel {
+func NewTunnel(logger *chshare.Logger, ssh ssh.Conn, clientID, id string, remote *chshare.Remote, acl *TunnelACL, copyLimiter *CopyLimiter, deadlines ConnDeadlines, connLogging ConnLogging, proxyTLS *tls.Config) *Tunnel {
+	if remote.Protocol == "" {
+		// remotes of clients that don't support other protocols
+		remote.Protocol = chshare.ProtocolTCP
+	}
 	return &Tunnel{
-		Logger:  logger.Fork("tunnel#%s:%s", id, remote),
-		Remote:  *remote,
-		ID:      id,
-		sshConn: ssh,
-		acl:     acl,
+		Logger:      logger.Fork("tunnel#%s:%s", id, remote),
+		Remote:      *remote,
+		ID:          id,
+		clientID:    clientID,
+		sshConn:     ssh,
+		acl:         acl,
+		balancer:    newBackendBalancer(remote.GetBackends()),
+		copyLimiter: copyLimiter,
+		deadlines:   deadlines,
+		connLogging: connLogging,
+		proxyTLS:    proxyTLS,
+		udpLimits:   defaultUDPLimits,
 	}
 }
 
 func (t *Tunnel) Start(ctx context.Context) (autoCloseChan chan bool, err error) {
-	// TODO(m-terel): consider to use ListenTCP
-	l, err := net.Listen("tcp4", t.LocalHost+":"+t.LocalPort)
+	if t.HasBasicAuth() && t.proxyScheme() == schemeHTTPS && t.proxyTLS == nil {
+		return nil, fmt.Errorf("%s: https tunnels with basic auth require a TLS certificate", t.Logger.Prefix())
+	}
+
+	var l net.Listener
+	var pc net.PacketConn
+	if t.IsUDP() {
+		pc, err = net.ListenPacket(t.listenNetwork("udp"), t.LocalHost+":"+t.LocalPort)
+	} else {
+		// TODO(m-terel): consider to use ListenTCP
+		l, err = net.Listen(t.listenNetwork("tcp"), t.LocalHost+":"+t.LocalPort)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("%s: %s", t.Logger.Prefix(), err)
 	}
+	// the port actually bound, e.g. if any free port was requested by 0
+	if pc != nil {
+		t.LocalPort = strconv.Itoa(pc.LocalAddr().(*net.UDPAddr).Port)
+	} else {
+		t.LocalPort = strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+	}
 
 	ctx, t.stopFn = context.WithCancel(ctx)
+	if t.IdleTimeoutMinutes > 0 || t.ExpiresAt != nil {
+		t.autoCloseChan = make(chan bool)
+		autoCloseChan = t.autoCloseChan
+	}
 	if t.IdleTimeoutMinutes > 0 {
-		t.connCloseChan = make(chan bool)
-		autoCloseChan = t.getAutoCloseChan(ctx)
+		t.touch()
+		t.startIdleTimeout(ctx)
+	}
+	if t.ExpiresAt != nil {
+		t.startMaxLifetime(ctx)
 	}
 	t.wg.Add(1)
-	go t.listen(ctx, l)
+	switch {
+	case pc != nil:
+		go t.listenUDP(ctx, pc)
+	case t.HasBasicAuth():
+		go t.serveHTTPProxy(ctx, l)
+	default:
+		go t.listen(ctx, l)
+	}
 	return
 }
 
+// MarshalJSON reports the "tcp" protocol for tunnels that were created without it, e.g. stored by older servers.
+// Tunnels guarded by basic auth are reported with auth_enabled, the password hash is never exposed.
+func (t *Tunnel) MarshalJSON() ([]byte, error) {
+	remote := t.Remote
+	if remote.Protocol == "" {
+		remote.Protocol = chshare.ProtocolTCP
+	}
+	return json.Marshal(struct {
+		chshare.Remote
+		AuthEnabled bool   `json:"auth_enabled,omitempty"`
+		ID          string `json:"id"`
+	}{
+		Remote:      remote,
+		AuthEnabled: t.HasBasicAuth(),
+		ID:          t.ID,
+	})
+}
+
+// listenNetwork returns a given network to listen on. Tunnels listen on IPv4 only, unless the ACL allows IPv6 addresses.
+func (t *Tunnel) listenNetwork(network string) string {
+	if t.acl != nil && t.acl.HasIPv6() {
+		return network
+	}
+	return network + "4"
+}
+
 func (t *Tunnel) Terminate(force bool) error {
 	n := atomic.LoadInt32(&t.connCount)
 	if !force && n > 0 {
@@ -106,73 +184,82 @@ func (t *Tunnel) listen(ctx context.Context, l net.Listener) {
 			return
 		}
 
-		if t.acl != nil {
-			tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr)
-			if !ok {
-				t.Errorf("Unsupported remote address type. Expected net.TCPAddr. %v", conn.RemoteAddr())
-				conn.Close()
-				continue
-			}
-
-			if !t.acl.CheckAccess(tcpAddr) {
-				t.Debugf("Access rejected. Remote addr: %s", tcpAddr)
-				conn.Close()
-				continue
-			}
+		if !t.checkAccess(conn) {
+			conn.Close()
+			continue
 		}
 
 		t.wg.Add(1)
 		go func() {
-			t.accept(ctx, conn)
+			t.accept(ctx, t.trackActivity(t.deadlines.wrap(conn)), conn.RemoteAddr().String())
 			t.wg.Done()
-			if t.connCloseChan != nil {
-				// just track when connection was closed, because connection creation is covered by connection counter
-				t.connCloseChan <- true // TODO: on context close do not wait
-			}
 		}()
 	}
 }
 
-// TODO: consider to create a separate background task to terminate all inactive tunnels based on some deadline/lastActivity time
-func (t *Tunnel) getAutoCloseChan(ctx context.Context) chan bool {
-	autoCloseChan := make(chan bool)
-	idleTimeout := time.Duration(t.IdleTimeoutMinutes) * time.Minute
+// checkAccess returns true if a given connection is allowed by the tunnel ACL.
+func (t *Tunnel) checkAccess(conn net.Conn) bool {
+	if t.acl == nil {
+		return true
+	}
+	tcpAddr, ok := conn.RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		t.Errorf("Unsupported remote address type. Expected net.TCPAddr. %v", conn.RemoteAddr())
+		return false
+	}
+	if !t.acl.CheckAccess(tcpAddr.IP) {
+		t.logConnRejected(tcpAddr.String())
+		return false
+	}
+	return true
+}
+
+// startMaxLifetime terminates the tunnel when its max lifetime is reached even if it has active connections.
+// The lifetime ends at ExpiresAt, so a re-established tunnel gets only the rest of it.
+func (t *Tunnel) startMaxLifetime(ctx context.Context) {
+	timer := time.NewTimer(time.Until(*t.ExpiresAt))
 	go func() {
-		for {
-			select {
-			case <-ctx.Done():
-				// close if the ctx was canceled
-				return
-			case <-time.After(idleTimeout):
-				// track time after the last activity,
-				// if it reaches the timeout and there are no active connections - terminate the tunnel
-				if atomic.LoadInt32(&t.connCount) > 0 {
-					continue
-				}
-				t.Infof("Terminating... inactivity period is reached: %d minute(s)", t.IdleTimeoutMinutes)
-				_ = t.Terminate(true)
-				close(autoCloseChan)
-				return
-			case <-t.connCloseChan:
-				// if there was some activity - continue to restart the inactivity tracking
-				continue
-			}
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			// close if the ctx was canceled
+		case <-timer.C:
+			t.Infof("Terminating... max lifetime of %d minute(s) is reached at %s, active connection(s): %d", t.MaxLifetimeMinutes, t.ExpiresAt.Format(time.RFC3339), atomic.LoadInt32(&t.connCount))
+			t.autoClose()
 		}
 	}()
-	return autoCloseChan
 }
 
-func (t *Tunnel) accept(ctx context.Context, src io.ReadWriteCloser) {
+// autoClose terminates the tunnel and notifies about it via the channel returned by Start.
+func (t *Tunnel) autoClose() {
+	t.autoCloseOnce.Do(func() {
+		_ = t.Terminate(true)
+		close(t.autoCloseChan)
+	})
+}
+
+func (t *Tunnel) accept(ctx context.Context, src io.ReadWriteCloser, srcAddr string) {
 	defer src.Close()
-	t.connectionIDAutoIncrement++
+	cid := atomic.AddInt32(&t.connectionIDAutoIncrement, 1)
 	atomic.AddInt32(&t.connCount, 1)
 	defer atomic.AddInt32(&t.connCount, -1)
 
-	cid := t.connectionIDAutoIncrement
 	l := t.Fork("conn#%d", cid)
-	l.Debugf("Open")
+	logConn := t.connLogging.sampled(cid)
+	if logConn {
+		l.LogWithFields(t.connLogging.Level, "Open", t.connLogFields(srcAddr)...)
+	}
+	openedAt := time.Now()
+	var sent, received int64
+	var closeReason string
+	defer func() {
+		if logConn {
+			t.logConnClose(l, srcAddr, openedAt, sent, received, closeReason)
+		}
+	}()
 
 	done := make(chan bool)
+	defer close(done)
 	// link ctx to conn
 	go func() {
 		select {
@@ -187,17 +274,67 @@ func (t *Tunnel) accept(ctx context.Context, src io.ReadWriteCloser) {
 
 	if t.sshConn == nil {
 		l.Debugf("No remote connection")
+		closeReason = "no remote connection"
 		return
 	}
-	//ssh request for tcp connection for this proxy's remote
-	dst, reqs, err := t.sshConn.OpenChannel("rport", []byte(t.Remote.Remote()))
+	if !t.copyLimiter.Acquire(ctx) {
+		l.Infof("Refused: max concurrent tunnel data copies is reached")
+		closeReason = "max concurrent tunnel data copies is reached"
+		return
+	}
+	defer t.copyLimiter.Release()
+	dst, err := t.openChannel(l, "rport")
 	if err != nil {
-		l.Errorf("Stream error: %s", err)
+		l.Infof("Stream error: %s", err)
+		closeReason = err.Error()
 		return
 	}
-	go ssh.DiscardRequests(reqs)
 	//then pipe
-	s, r := chshare.Pipe(src, dst)
-	l.Debugf("Close (sent %s received %s)", sizestr.ToString(s), sizestr.ToString(r))
-	close(done)
+	sent, received = chshare.Pipe(src, dst)
+}
+
+// logConnClose logs closing of a connection with its stats. A non-empty reason tells why the connection was closed
+// before any data was copied.
+func (t *Tunnel) logConnClose(l *chshare.Logger, srcAddr string, openedAt time.Time, sent, received int64, reason string) {
+	fields := append(t.connLogFields(srcAddr),
+		chshare.LogField{Key: "duration", Value: time.Since(openedAt).Round(time.Millisecond)},
+		chshare.LogField{Key: "sent_bytes", Value: sent},
+		chshare.LogField{Key: "received_bytes", Value: received},
+	)
+	if reason != "" {
+		fields = append(fields, chshare.LogField{Key: "error", Value: reason})
+	}
+	l.LogWithFields(t.connLogging.Level, "Close", fields...)
+}
+
+// logConnRejected logs a connection rejected by the tunnel ACL. Rejections are not sampled and logged at the info level,
+// since they may indicate an attempt of unauthorized access.
+func (t *Tunnel) logConnRejected(srcAddr string) {
+	t.LogWithFields(chshare.LogLevelInfo, "Rejected", append(t.connLogFields(srcAddr), chshare.LogField{Key: "error", Value: "access denied by ACL"})...)
+}
+
+// connLogFields returns fields that identify a connection in log entries.
+func (t *Tunnel) connLogFields(srcAddr string) []chshare.LogField {
+	return []chshare.LogField{
+		{Key: "client_id", Value: t.clientID},
+		{Key: "tunnel_id", Value: t.ID},
+		{Key: "src", Value: srcAddr},
+	}
+}
+
+// openChannel opens a ssh channel of a given type for a connection to a next tunnel backend.
+// Backends that the client fails to dial are skipped.
+func (t *Tunnel) openChannel(l *chshare.Logger, channelType string) (ssh.Channel, error) {
+	var lastErr error
+	for _, backend := range t.balancer.Order() {
+		dst, reqs, err := t.sshConn.OpenChannel(channelType, []byte(backend.Address()))
+		if err != nil {
+			l.Debugf("Backend %s failed: %s", backend.Address(), err)
+			lastErr = err
+			continue
+		}
+		go ssh.DiscardRequests(reqs)
+		return dst, nil
+	}
+	return nil, lastErr
 }
@@ -10,19 +10,31 @@ type TunnelACL struct {
 	AllowedIPs []net.IPNet
 }
 
-// CheckAccess returns true if connection from specified address is allowed
-func (a TunnelACL) CheckAccess(addr *net.TCPAddr) bool {
+// CheckAccess returns true if connection from specified IP is allowed
+func (a TunnelACL) CheckAccess(ip net.IP) bool {
 	if len(a.AllowedIPs) == 0 {
 		return true
 	}
 	for _, allowed := range a.AllowedIPs {
-		if allowed.Contains(addr.IP) {
+		if allowed.Contains(ip) {
 			return true
 		}
 	}
 	return false
 }
 
+// HasIPv6 returns true if any IPv6 address or range is allowed.
+func (a TunnelACL) HasIPv6() bool {
+	for _, allowed := range a.AllowedIPs {
+		if allowed.IP.To4() == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTunnelACL parses a comma separated list of IPv4 and IPv6 addresses and ranges in CIDR notation,
+// e.g. "10.0.0.0/8,192.0.2.1,2001:db8::/32". It returns nil if a given string is empty.
 func ParseTunnelACL(str string) (*TunnelACL, error) {
 	if str == "" {
 		return nil, nil
@@ -33,32 +45,27 @@ func ParseTunnelACL(str string) (*TunnelACL, error) {
 	}
 	values := strings.Split(str, ",")
 	for _, strVal := range values {
-		var ip net.IP
-		var ipNet *net.IPNet
-		var err error
+		strVal = strings.TrimSpace(strVal)
 		if strings.ContainsRune(strVal, '/') {
-			ip, ipNet, err = net.ParseCIDR(strVal)
+			_, ipNet, err := net.ParseCIDR(strVal)
 			if err != nil {
-				return nil, err
-			}
-		} else {
-			ip = net.ParseIP(strVal)
-			if ip == nil {
-				return nil, fmt.Errorf("invalid IP addr: %s", strVal)
+				return nil, fmt.Errorf("invalid CIDR address: %s", strVal)
 			}
+			acl.AllowedIPs = append(acl.AllowedIPs, *ipNet)
+			continue
 		}
 
-		if ip.To4() == nil {
-			return nil, fmt.Errorf("%s is not IPv4 address", strVal)
+		ip := net.ParseIP(strVal)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP addr: %s", strVal)
 		}
 
-		if ipNet == nil {
-			// if range is not specified, specify mask for one addr (/32)
-			ipMask := net.IPv4Mask(255, 255, 255, 255)
-			ipNet = &net.IPNet{IP: ip, Mask: ipMask}
+		// if range is not specified, specify mask for one addr (/32 or /128)
+		if ip4 := ip.To4(); ip4 != nil {
+			acl.AllowedIPs = append(acl.AllowedIPs, net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)})
+		} else {
+			acl.AllowedIPs = append(acl.AllowedIPs, net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)})
 		}
-
-		acl.AllowedIPs = append(acl.AllowedIPs, *ipNet)
 	}
 	return acl, nil
 }
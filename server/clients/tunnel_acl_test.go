@@ -0,0 +1,158 @@
+package clients
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	chshare "github.com/cloudradar-monitoring/rport/share"
+)
+
+func TestParseTunnelACL(t *testing.T) {
+	testCases := []struct {
+		name    string
+		acl     string
+		wantErr string
+		allowed []string
+		denied  []string
+	}{
+		{
+			name: "empty",
+			acl:  "",
+		},
+		{
+			name:    "single IPv4",
+			acl:     "192.0.2.1",
+			allowed: []string{"192.0.2.1", "::ffff:192.0.2.1"},
+			denied:  []string{"192.0.2.2", "2001:db8::1"},
+		},
+		{
+			name:    "IPv4 CIDR",
+			acl:     "10.0.0.0/8,192.0.2.1",
+			allowed: []string{"10.0.0.1", "10.255.255.255", "192.0.2.1"},
+			denied:  []string{"11.0.0.1", "192.0.2.2"},
+		},
+		{
+			name:    "single IPv6",
+			acl:     "2001:db8::1",
+			allowed: []string{"2001:db8::1"},
+			denied:  []string{"2001:db8::2", "192.0.2.1"},
+		},
+		{
+			name:    "IPv6 CIDR",
+			acl:     "2001:db8::/32, fe80::/10",
+			allowed: []string{"2001:db8::1", "2001:db8:ffff::1", "fe80::1"},
+			denied:  []string{"2001:db9::1", "::1", "10.0.0.1"},
+		},
+		{
+			name:    "IPv4 and IPv6",
+			acl:     "10.0.0.0/8,2001:db8::/32",
+			allowed: []string{"10.1.2.3", "2001:db8::1"},
+			denied:  []string{"192.0.2.1", "::1"},
+		},
+		{
+			name:    "invalid IPv4 CIDR",
+			acl:     "10.0.0.0/33",
+			wantErr: "invalid CIDR address: 10.0.0.0/33",
+		},
+		{
+			name:    "invalid IPv6 CIDR",
+			acl:     "10.0.0.0/8,2001:db8::/129",
+			wantErr: "invalid CIDR address: 2001:db8::/129",
+		},
+		{
+			name:    "invalid IP",
+			acl:     "10.0.0.256",
+			wantErr: "invalid IP addr: 10.0.0.256",
+		},
+		{
+			name:    "empty entry",
+			acl:     "10.0.0.1,",
+			wantErr: "invalid IP addr: ",
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			acl, err := ParseTunnelACL(tc.acl)
+
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			if tc.acl == "" {
+				assert.Nil(t, acl)
+				return
+			}
+			for _, ip := range tc.allowed {
+				assert.True(t, acl.CheckAccess(net.ParseIP(ip)), ip)
+			}
+			for _, ip := range tc.denied {
+				assert.False(t, acl.CheckAccess(net.ParseIP(ip)), ip)
+			}
+		})
+	}
+}
+
+func TestTunnelACL(t *testing.T) {
+	testCases := []struct {
+		name       string
+		acl        string
+		wantServed map[string]bool
+	}{
+		{
+			name:       "IPv4 range",
+			acl:        "127.0.0.0/8",
+			wantServed: map[string]bool{"127.0.0.1": true, "::1": false},
+		},
+		{
+			name:       "IPv6 range",
+			acl:        "::1/128",
+			wantServed: map[string]bool{"127.0.0.1": false, "::1": true},
+		},
+		{
+			name:       "IPv4 and IPv6",
+			acl:        "127.0.0.1,::1",
+			wantServed: map[string]bool{"127.0.0.1": true, "::1": true},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			acl, err := ParseTunnelACL(tc.acl)
+			require.NoError(t, err)
+			remote := &chshare.Remote{LocalHost: "0.0.0.0", LocalPort: freePort(t)}
+			require.NoError(t, remote.SetBackends(decodeRemotes(t, startBackend(t, "backend")), nil))
+			tunnel := NewTunnel(testLog, &dialConnMock{}, "client-1", "1", remote, acl, nil, ConnDeadlines{}, DefaultConnLogging, nil)
+			_, err = tunnel.Start(context.Background())
+			require.NoError(t, err)
+			defer func() { require.NoError(t, tunnel.Terminate(true)) }()
+
+			for src, wantServed := range tc.wantServed {
+				conn, err := net.Dial("tcp", net.JoinHostPort(src, remote.LocalPort))
+				if !wantServed && err != nil {
+					// IPv6 connections are refused by an IPv4 only listener
+					continue
+				}
+				require.NoError(t, err, src)
+				require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+				got, err := ioutil.ReadAll(conn)
+				conn.Close()
+				require.NoError(t, err, src)
+				if wantServed {
+					assert.Equal(t, "backend", string(got), src)
+				} else {
+					assert.Empty(t, got, src)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package clients
+
+import (
+	"sync"
+
+	chshare "github.com/cloudradar-monitoring/rport/share"
+)
+
+// backendBalancer distributes tunnel connections between backends using a smooth weighted round-robin.
+// Backends with equal weights are used in a simple rotation.
+type backendBalancer struct {
+	backends []*chshare.Backend
+	current  []int
+	total    int
+	mu       sync.Mutex
+}
+
+func newBackendBalancer(backends []*chshare.Backend) *backendBalancer {
+	b := &backendBalancer{
+		backends: backends,
+		current:  make([]int, len(backends)),
+	}
+	for _, cur := range backends {
+		b.total += weightOf(cur)
+	}
+	return b
+}
+
+// Order returns all backends in the order they should be tried for a next connection.
+// The first one is the selected backend, the rest are fallbacks in case it fails to dial.
+func (b *backendBalancer) Order() []*chshare.Backend {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	best := 0
+	for i, cur := range b.backends {
+		b.current[i] += weightOf(cur)
+		if b.current[i] > b.current[best] {
+			best = i
+		}
+	}
+	b.current[best] -= b.total
+
+	res := make([]*chshare.Backend, 0, len(b.backends))
+	for i := range b.backends {
+		res = append(res, b.backends[(best+i)%len(b.backends)])
+	}
+	return res
+}
+
+func weightOf(backend *chshare.Backend) int {
+	if backend.Weight < 1 {
+		return 1
+	}
+	return backend.Weight
+}
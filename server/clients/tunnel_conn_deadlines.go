@@ -0,0 +1,56 @@
+package clients
+
+import (
+	"net"
+	"time"
+)
+
+// ConnDeadlines defines read and write deadlines of tunnel connections. They are used to detect half-open
+// connections, e.g. when a peer vanished without closing a connection. A zero value disables a deadline.
+type ConnDeadlines struct {
+	// Read is a max period of time without any data transferred over a connection in either direction.
+	Read time.Duration
+	// Write is a max period of time a single write to a connection can block.
+	Write time.Duration
+}
+
+func (d ConnDeadlines) wrap(conn net.Conn) net.Conn {
+	if d.Read <= 0 && d.Write <= 0 {
+		return conn
+	}
+	return &deadlineConn{Conn: conn, deadlines: d}
+}
+
+// deadlineConn moves the deadlines of a connection forward on each read and write.
+type deadlineConn struct {
+	net.Conn
+	deadlines ConnDeadlines
+}
+
+func (c *deadlineConn) Read(b []byte) (int, error) {
+	if err := c.extendReadDeadline(); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *deadlineConn) Write(b []byte) (int, error) {
+	if c.deadlines.Write > 0 {
+		if err := c.Conn.SetWriteDeadline(time.Now().Add(c.deadlines.Write)); err != nil {
+			return 0, err
+		}
+	}
+	n, err := c.Conn.Write(b)
+	if err != nil {
+		return n, err
+	}
+	// data sent to a peer is an activity as well, so a one-way transfer doesn't hit the read deadline
+	return n, c.extendReadDeadline()
+}
+
+func (c *deadlineConn) extendReadDeadline() error {
+	if c.deadlines.Read <= 0 {
+		return nil
+	}
+	return c.Conn.SetReadDeadline(time.Now().Add(c.deadlines.Read))
+}
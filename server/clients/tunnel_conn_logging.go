@@ -0,0 +1,24 @@
+package clients
+
+import (
+	chshare "github.com/cloudradar-monitoring/rport/share"
+)
+
+// ConnLogging defines how opening and closing of tunnel connections is logged.
+type ConnLogging struct {
+	// Level is a log level of the entries.
+	Level chshare.LogLevel
+	// SampleRate makes a tunnel log only every n-th connection to avoid log floods. 0 and 1 log all connections.
+	SampleRate int
+}
+
+// sampled returns true if a connection with a given sequence number of a tunnel should be logged.
+func (l ConnLogging) sampled(connID int32) bool {
+	if l.SampleRate <= 1 {
+		return true
+	}
+	return (connID-1)%int32(l.SampleRate) == 0
+}
+
+// DefaultConnLogging logs all tunnel connections at the debug level.
+var DefaultConnLogging = ConnLogging{Level: chshare.LogLevelDebug}
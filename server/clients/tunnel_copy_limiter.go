@@ -0,0 +1,68 @@
+package clients
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// copyGoroutinesPerConn is a number of goroutines that copy data of a single tunnel connection, one per direction.
+const copyGoroutinesPerConn = 2
+
+// CopyLimiter bounds the total number of goroutines copying tunnel data across all tunnels of the server.
+// A nil CopyLimiter means no limit.
+type CopyLimiter struct {
+	sem     *semaphore.Weighted
+	wait    time.Duration
+	running int64
+}
+
+// NewCopyLimiter returns a limiter that allows up to max copy goroutines. A new connection waits up to a given
+// duration for a free slot and is refused after that. Returns nil if max is not positive.
+func NewCopyLimiter(max int, wait time.Duration) *CopyLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &CopyLimiter{
+		sem:  semaphore.NewWeighted(int64(max)),
+		wait: wait,
+	}
+}
+
+// Acquire reserves the copy goroutines for a single tunnel connection. Returns false if no slot became free in time.
+func (l *CopyLimiter) Acquire(ctx context.Context) bool {
+	if l == nil {
+		return true
+	}
+	if !l.sem.TryAcquire(copyGoroutinesPerConn) {
+		if l.wait <= 0 {
+			return false
+		}
+		ctx, cancel := context.WithTimeout(ctx, l.wait)
+		defer cancel()
+		if err := l.sem.Acquire(ctx, copyGoroutinesPerConn); err != nil {
+			return false
+		}
+	}
+	atomic.AddInt64(&l.running, copyGoroutinesPerConn)
+	return true
+}
+
+// Release frees the copy goroutines reserved by Acquire.
+func (l *CopyLimiter) Release() {
+	if l == nil {
+		return
+	}
+	atomic.AddInt64(&l.running, -copyGoroutinesPerConn)
+	l.sem.Release(copyGoroutinesPerConn)
+}
+
+// Running returns the current number of copy goroutines.
+func (l *CopyLimiter) Running() int {
+	if l == nil {
+		return 0
+	}
+	return int(atomic.LoadInt64(&l.running))
+}
@@ -0,0 +1,240 @@
+package clients
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
+
+	chshare "github.com/cloudradar-monitoring/rport/share"
+	"github.com/cloudradar-monitoring/rport/share/security"
+)
+
+const (
+	schemeHTTP  = "http"
+	schemeHTTPS = "https"
+
+	basicAuthRealm = "rport tunnel"
+	// basicAuthMaxFailures is a number of wrong credentials after which a source address is banned for basicAuthBanDuration.
+	// Banned addresses get 429 without checking the credentials, so they can't make the server run bcrypt.
+	basicAuthMaxFailures = 10
+	basicAuthBanDuration = 5 * time.Minute
+	// proxyIdleConnTimeout is a period after which idle connections of the proxy to the client are closed
+	proxyIdleConnTimeout = time.Minute
+)
+
+// IsHTTPScheme returns true if a given tunnel scheme can be guarded by HTTP basic auth.
+func IsHTTPScheme(scheme string) bool {
+	return scheme == schemeHTTP || scheme == schemeHTTPS
+}
+
+// proxyScheme returns a scheme the basic auth proxy speaks to users and to the tunnel backend.
+func (t *Tunnel) proxyScheme() string {
+	if t.Scheme != nil && *t.Scheme == schemeHTTPS {
+		return schemeHTTPS
+	}
+	return schemeHTTP
+}
+
+// serveHTTPProxy serves a reverse proxy that requires HTTP basic auth before a request is relayed to the client.
+// Requests without valid credentials get 401, no ssh channel is opened for them.
+func (t *Tunnel) serveHTTPProxy(ctx context.Context, l net.Listener) {
+	defer t.wg.Done()
+
+	t.Infof("Listening, basic auth is required")
+
+	var ln net.Listener = &proxyListener{Listener: l, tunnel: t}
+	if t.proxyScheme() == schemeHTTPS {
+		ln = tls.NewListener(ln, t.proxyTLS)
+	}
+
+	transport := &http.Transport{
+		DialContext: t.dialProxyBackend,
+		// backends are reached via the client and often have self-signed certificates
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, //nolint:gosec
+		IdleConnTimeout: proxyIdleConnTimeout,
+	}
+	defer transport.CloseIdleConnections()
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = t.proxyScheme()
+			req.URL.Host = t.Remote.Remote()
+			// the credentials are for the proxy only, they are not passed to the backend
+			req.Header.Del("Authorization")
+		},
+		Transport: transport,
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			t.Debugf("Proxy error: %v", err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+	srv := &http.Server{
+		Handler:  t.basicAuth(proxy),
+		ErrorLog: log.New(proxyErrorLog{t.Logger}, "", 0),
+	}
+
+	// background goroutine to close the server when context is canceled
+	go func() {
+		<-ctx.Done()
+		if err := srv.Close(); err != nil {
+			t.Errorf("Failed to close listener: %v", err)
+			return
+		}
+		t.Debugf("Listener closed")
+	}()
+
+	if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+		t.Errorf("Failed to serve: %v", err)
+	}
+}
+
+// basicAuth relays requests with valid credentials to a given handler.
+func (t *Tunnel) basicAuth(next http.Handler) http.Handler {
+	// verified is a set of sha256 hashes of passwords that match the bcrypt hash, so bcrypt is not run on each request
+	verified := &sync.Map{}
+	banned := security.NewMaxBadAttemptsBanList(basicAuthMaxFailures, basicAuthBanDuration, t.Logger)
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		cid := atomic.AddInt32(&t.connectionIDAutoIncrement, 1)
+		l := t.Fork("conn#%d", cid)
+
+		ip, _, err := net.SplitHostPort(req.RemoteAddr)
+		if err != nil {
+			ip = req.RemoteAddr
+		}
+		if banned.IsBanned(ip) {
+			l.Debugf("Request from %s is rejected: too many failed auth attempts", req.RemoteAddr)
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+
+		user, password, ok := req.BasicAuth()
+		if !ok || !t.checkCredentials(verified, user, password) {
+			l.Debugf("Unauthorized request from %s", req.RemoteAddr)
+			if ok {
+				banned.AddBadAttempt(ip)
+			}
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", basicAuthRealm))
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		banned.AddSuccessAttempt(ip)
+
+		atomic.AddInt32(&t.connCount, 1)
+		defer atomic.AddInt32(&t.connCount, -1)
+		t.touch()
+		logConn := t.connLogging.sampled(cid)
+		if logConn {
+			l.LogWithFields(t.connLogging.Level, "Open", t.connLogFields(req.RemoteAddr)...)
+		}
+		openedAt := time.Now()
+
+		next.ServeHTTP(w, req)
+
+		t.touch()
+		if logConn {
+			l.LogWithFields(t.connLogging.Level, "Close", append(t.connLogFields(req.RemoteAddr),
+				chshare.LogField{Key: "method", Value: req.Method},
+				chshare.LogField{Key: "path", Value: req.URL.Path},
+				chshare.LogField{Key: "duration", Value: time.Since(openedAt).Round(time.Millisecond)},
+			)...)
+		}
+	})
+}
+
+func (t *Tunnel) checkCredentials(verified *sync.Map, user, password string) bool {
+	if subtle.ConstantTimeCompare([]byte(user), []byte(t.AuthUser)) != 1 {
+		return false
+	}
+	key := sha256.Sum256([]byte(password))
+	if _, ok := verified.Load(key); ok {
+		return true
+	}
+	if bcrypt.CompareHashAndPassword([]byte(t.AuthPasswordHash), []byte(password)) != nil {
+		return false
+	}
+	verified.Store(key, true)
+	return true
+}
+
+// dialProxyBackend opens a ssh channel to a next tunnel backend for a connection of the proxy.
+func (t *Tunnel) dialProxyBackend(ctx context.Context, _, _ string) (net.Conn, error) {
+	if t.sshConn == nil {
+		return nil, errors.New("no remote connection")
+	}
+	if !t.copyLimiter.Acquire(ctx) {
+		return nil, errors.New("max concurrent tunnel data copies is reached")
+	}
+	ch, err := t.openChannel(t.Logger, "rport")
+	if err != nil {
+		t.copyLimiter.Release()
+		return nil, err
+	}
+	return &channelConn{Channel: ch, release: t.copyLimiter.Release}, nil
+}
+
+// proxyListener applies the tunnel ACL, deadlines and activity tracking to accepted connections.
+type proxyListener struct {
+	net.Listener
+	tunnel *Tunnel
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if !l.tunnel.checkAccess(conn) {
+			conn.Close()
+			continue
+		}
+		return l.tunnel.trackActivity(l.tunnel.deadlines.wrap(conn)), nil
+	}
+}
+
+// channelConn is a ssh channel used as a connection of the proxy to a tunnel backend.
+type channelConn struct {
+	ssh.Channel
+	release   func()
+	closeOnce sync.Once
+}
+
+func (c *channelConn) Close() error {
+	err := c.Channel.Close()
+	c.closeOnce.Do(c.release)
+	return err
+}
+
+func (c *channelConn) LocalAddr() net.Addr                { return channelAddr{} }
+func (c *channelConn) RemoteAddr() net.Addr               { return channelAddr{} }
+func (c *channelConn) SetDeadline(t time.Time) error      { return nil }
+func (c *channelConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *channelConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type channelAddr struct{}
+
+func (channelAddr) Network() string { return "ssh" }
+func (channelAddr) String() string  { return "ssh-channel" }
+
+// proxyErrorLog writes errors of the proxy server, e.g. failed TLS handshakes, to the tunnel log.
+type proxyErrorLog struct {
+	*chshare.Logger
+}
+
+func (l proxyErrorLog) Write(p []byte) (int, error) {
+	l.Debugf("%s", strings.TrimSpace(string(p)))
+	return len(p), nil
+}
@@ -0,0 +1,184 @@
+package clients
+
+import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/ssh"
+
+	chshare "github.com/cloudradar-monitoring/rport/share"
+)
+
+// countingConnMock counts opened channels.
+type countingConnMock struct {
+	dialConnMock
+	opened int32
+}
+
+func (c *countingConnMock) OpenChannel(name string, data []byte) (ssh.Channel, <-chan *ssh.Request, error) {
+	atomic.AddInt32(&c.opened, 1)
+	return c.dialConnMock.OpenChannel(name, data)
+}
+
+func newBasicAuthRemote(t *testing.T, backendURL, scheme string) *chshare.Remote {
+	u, err := url.Parse(backendURL)
+	require.NoError(t, err)
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	require.NoError(t, err)
+	return &chshare.Remote{
+		LocalHost:        "127.0.0.1",
+		LocalPort:        freePort(t),
+		RemoteHost:       u.Hostname(),
+		RemotePort:       u.Port(),
+		Scheme:           &scheme,
+		AuthUser:         "admin",
+		AuthPasswordHash: string(hash),
+	}
+}
+
+func TestTunnelBasicAuth(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte("backend, authorization: " + req.Header.Get("Authorization")))
+	}))
+	defer backend.Close()
+
+	conn := &countingConnMock{}
+	remote := newBasicAuthRemote(t, backend.URL, "http")
+	tunnel := NewTunnel(testLog, conn, "client-1", "1", remote, nil, nil, ConnDeadlines{}, DefaultConnLogging, nil)
+	_, err := tunnel.Start(context.Background())
+	require.NoError(t, err)
+	defer func() { require.NoError(t, tunnel.Terminate(true)) }()
+
+	testCases := []struct {
+		name     string
+		user     string
+		password string
+
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "no credentials",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "wrong password",
+			user:       "admin",
+			password:   "wrong",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "wrong user",
+			user:       "root",
+			password:   "secret",
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "valid credentials",
+			user:       "admin",
+			password:   "secret",
+			wantStatus: http.StatusOK,
+			// credentials are not passed to the backend
+			wantBody: "backend, authorization: ",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			openedBefore := atomic.LoadInt32(&conn.opened)
+			req, err := http.NewRequest(http.MethodGet, "http://"+remote.LocalHost+":"+remote.LocalPort+"/", nil)
+			require.NoError(t, err)
+			if tc.user != "" {
+				req.SetBasicAuth(tc.user, tc.password)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			body, err := ioutil.ReadAll(resp.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.wantStatus, resp.StatusCode)
+			if tc.wantStatus == http.StatusUnauthorized {
+				assert.Equal(t, `Basic realm="rport tunnel"`, resp.Header.Get("WWW-Authenticate"))
+				assert.Equal(t, openedBefore, atomic.LoadInt32(&conn.opened), "no channel is expected to be opened")
+				return
+			}
+			assert.Equal(t, tc.wantBody, string(body))
+		})
+	}
+}
+
+func TestTunnelBasicAuthHTTPS(t *testing.T) {
+	backend := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte("backend"))
+	}))
+	defer backend.Close()
+	remote := newBasicAuthRemote(t, backend.URL, "https")
+
+	// without a certificate
+	tunnel := NewTunnel(testLog, &dialConnMock{}, "client-1", "1", remote, nil, nil, ConnDeadlines{}, DefaultConnLogging, nil)
+	_, err := tunnel.Start(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "https tunnels with basic auth require a TLS certificate")
+
+	// the proxy uses the certificate of the test server, so the test client trusts it
+	proxyTLS := &tls.Config{Certificates: backend.TLS.Certificates}
+	tunnel = NewTunnel(testLog, &dialConnMock{}, "client-1", "1", remote, nil, nil, ConnDeadlines{}, DefaultConnLogging, proxyTLS)
+	_, err = tunnel.Start(context.Background())
+	require.NoError(t, err)
+	defer func() { require.NoError(t, tunnel.Terminate(true)) }()
+
+	req, err := http.NewRequest(http.MethodGet, "https://"+remote.LocalHost+":"+remote.LocalPort+"/", nil)
+	require.NoError(t, err)
+	req.SetBasicAuth("admin", "secret")
+	resp, err := backend.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "backend", string(body))
+}
+
+func TestTunnelBasicAuthBansFailedAttempts(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		_, _ = w.Write([]byte("backend"))
+	}))
+	defer backend.Close()
+
+	remote := newBasicAuthRemote(t, backend.URL, "http")
+	tunnel := NewTunnel(testLog, &dialConnMock{}, "client-1", "1", remote, nil, nil, ConnDeadlines{}, DefaultConnLogging, nil)
+	_, err := tunnel.Start(context.Background())
+	require.NoError(t, err)
+	defer func() { require.NoError(t, tunnel.Terminate(true)) }()
+
+	doRequest := func(password string) int {
+		req, err := http.NewRequest(http.MethodGet, "http://"+remote.LocalHost+":"+remote.LocalPort+"/", nil)
+		require.NoError(t, err)
+		req.SetBasicAuth("admin", password)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	assert.Equal(t, http.StatusOK, doRequest("secret"))
+	for i := 0; i < basicAuthMaxFailures; i++ {
+		assert.Equal(t, http.StatusUnauthorized, doRequest("wrong"))
+	}
+
+	// valid credentials are not checked either while the source is banned
+	assert.Equal(t, http.StatusTooManyRequests, doRequest("wrong"))
+	assert.Equal(t, http.StatusTooManyRequests, doRequest("secret"))
+}
@@ -0,0 +1,77 @@
+package clients
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// idleCheckInterval is how often tunnels with an idle timeout check their last activity. var is used to override in tests
+var idleCheckInterval = 10 * time.Second
+
+// startIdleTimeout terminates the tunnel when no data is transferred through it in either direction within its idle timeout.
+// Connections that are open but idle don't keep the tunnel alive, they are closed together with the tunnel.
+func (t *Tunnel) startIdleTimeout(ctx context.Context) {
+	idleTimeout := time.Duration(t.IdleTimeoutMinutes) * time.Minute
+	go func() {
+		ticker := time.NewTicker(idleCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				// close if the ctx was canceled
+				return
+			case <-ticker.C:
+				if t.idleFor() < idleTimeout {
+					continue
+				}
+				t.Infof("Terminating... inactivity period is reached: %d minute(s), active connection(s): %d", t.IdleTimeoutMinutes, atomic.LoadInt32(&t.connCount))
+				t.autoClose()
+				return
+			}
+		}
+	}()
+}
+
+// touch records an activity of the tunnel.
+func (t *Tunnel) touch() {
+	atomic.StoreInt64(&t.lastActivity, now().UnixNano())
+}
+
+// idleFor returns a period of time since the last activity of the tunnel.
+func (t *Tunnel) idleFor() time.Duration {
+	return now().Sub(time.Unix(0, atomic.LoadInt64(&t.lastActivity)))
+}
+
+// trackActivity wraps a tunnel connection to record an activity of the tunnel on each transferred data.
+// The connection is returned as is if the tunnel has no idle timeout.
+func (t *Tunnel) trackActivity(conn net.Conn) net.Conn {
+	if t.IdleTimeoutMinutes <= 0 {
+		return conn
+	}
+	t.touch()
+	return &activityConn{Conn: conn, tunnel: t}
+}
+
+// activityConn records an activity of a tunnel when data is read or written.
+type activityConn struct {
+	net.Conn
+	tunnel *Tunnel
+}
+
+func (c *activityConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.tunnel.touch()
+	}
+	return n, err
+}
+
+func (c *activityConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	if n > 0 {
+		c.tunnel.touch()
+	}
+	return n, err
+}
@@ -0,0 +1,104 @@
+package clients
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	chshare "github.com/cloudradar-monitoring/rport/share"
+)
+
+// fakeClock is a clock that is moved forward manually.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Add(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestTunnelIdleTimeout(t *testing.T) {
+	defer func(f func() time.Time, d time.Duration) { now, idleCheckInterval = f, d }(now, idleCheckInterval)
+	clock := &fakeClock{now: time.Now()}
+	now = clock.Now
+	idleCheckInterval = 5 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := New(t).Connection(&dialConnMock{}).Build()
+	client.Tunnels = nil
+	client.Context = ctx
+	client.Logger = testLog
+	remote := &chshare.Remote{LocalHost: "127.0.0.1", LocalPort: freePort(t), IdleTimeoutMinutes: 1}
+	require.NoError(t, remote.SetBackends(decodeRemotes(t, startEchoBackend(t)), nil))
+	tunnel, err := client.StartTunnel(remote, nil, nil, ConnDeadlines{}, DefaultConnLogging, nil)
+	require.NoError(t, err)
+	addr := remote.LocalHost + ":" + remote.LocalPort
+	hasTunnel := func() bool {
+		client.Lock()
+		defer client.Unlock()
+		return client.FindTunnel(tunnel.ID) != nil
+	}
+
+	conn := echoThroughTunnel(t, addr)
+	require.NotNil(t, conn)
+	defer conn.Close()
+
+	// data transferred within the idle timeout keeps the tunnel open
+	for i := 0; i < 3; i++ {
+		clock.Add(40 * time.Second)
+		time.Sleep(10 * idleCheckInterval)
+		require.True(t, hasTunnel())
+		_, err = conn.Write([]byte("x"))
+		require.NoError(t, err)
+		_, err = io.ReadFull(conn, make([]byte, 1))
+		require.NoError(t, err)
+	}
+
+	// when no data is transferred within the idle timeout, an open connection doesn't keep the tunnel
+	clock.Add(time.Minute)
+
+	// then
+	require.Eventually(t, func() bool { return !hasTunnel() }, 2*time.Second, 10*time.Millisecond)
+	_, err = io.ReadFull(conn, make([]byte, 1))
+	assert.Error(t, err)
+	_, err = net.Dial("tcp", addr)
+	assert.Error(t, err)
+}
+
+func TestTunnelWithoutIdleTimeout(t *testing.T) {
+	defer func(f func() time.Time, d time.Duration) { now, idleCheckInterval = f, d }(now, idleCheckInterval)
+	clock := &fakeClock{now: time.Now()}
+	now = clock.Now
+	idleCheckInterval = 5 * time.Millisecond
+
+	remote := &chshare.Remote{LocalHost: "127.0.0.1", LocalPort: freePort(t)}
+	require.NoError(t, remote.SetBackends(decodeRemotes(t, startEchoBackend(t)), nil))
+	tunnel := NewTunnel(testLog, &dialConnMock{}, "client-1", "1", remote, nil, nil, ConnDeadlines{}, DefaultConnLogging, nil)
+	autoCloseChan, err := tunnel.Start(context.Background())
+	require.NoError(t, err)
+	defer func() { require.NoError(t, tunnel.Terminate(true)) }()
+
+	clock.Add(24 * time.Hour)
+	time.Sleep(10 * idleCheckInterval)
+
+	assert.Nil(t, autoCloseChan)
+	conn := echoThroughTunnel(t, remote.LocalHost+":"+remote.LocalPort)
+	require.NotNil(t, conn)
+	conn.Close()
+}
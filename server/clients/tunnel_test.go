@@ -0,0 +1,731 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	chshare "github.com/cloudradar-monitoring/rport/share"
+)
+
+// dialConnMock mimics a client that dials a requested address when a channel is opened.
+type dialConnMock struct {
+	ssh.Conn
+}
+
+func (c *dialConnMock) OpenChannel(name string, data []byte) (ssh.Channel, <-chan *ssh.Request, error) {
+	network := "tcp"
+	if name == chshare.UDPChannelType {
+		network = "udp"
+	}
+	conn, err := net.Dial(network, string(data))
+	if err != nil {
+		return nil, nil, &ssh.OpenChannelError{Reason: ssh.ConnectionFailed, Message: err.Error()}
+	}
+	reqs := make(chan *ssh.Request)
+	close(reqs)
+	if network == "udp" {
+		// relay datagrams the same way the client does
+		stream, clientStream := net.Pipe()
+		go chshare.RelayDatagrams(clientStream, conn)
+		return &channelMock{Conn: stream}, reqs, nil
+	}
+	return &channelMock{Conn: conn}, reqs, nil
+}
+
+type channelMock struct {
+	net.Conn
+}
+
+func (c *channelMock) CloseWrite() error {
+	return c.Conn.(*net.TCPConn).CloseWrite()
+}
+
+func (c *channelMock) SendRequest(name string, wantReply bool, payload []byte) (bool, error) {
+	return false, errors.New("not supported")
+}
+
+func (c *channelMock) Stderr() io.ReadWriter {
+	return nil
+}
+
+// startBackend starts a tcp server that replies with a given name to every connection.
+func startBackend(t *testing.T, name string) string {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte(name))
+			conn.Close()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func deadBackend(t *testing.T) string {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+	return addr
+}
+
+func freePort(t *testing.T) string {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return strconv.Itoa(l.Addr().(*net.TCPAddr).Port)
+}
+
+func decodeRemotes(t *testing.T, addrs ...string) []*chshare.Remote {
+	var res []*chshare.Remote
+	for _, addr := range addrs {
+		r, err := chshare.DecodeRemote(addr)
+		require.NoError(t, err)
+		res = append(res, r)
+	}
+	return res
+}
+
+func TestTunnelStartOnAnyPort(t *testing.T) {
+	testCases := []struct {
+		name     string
+		protocol string
+	}{
+		{
+			name:     "tcp",
+			protocol: chshare.ProtocolTCP,
+		},
+		{
+			name:     "udp",
+			protocol: chshare.ProtocolUDP,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			remote := &chshare.Remote{LocalHost: "127.0.0.1", LocalPort: "0", RemoteHost: "127.0.0.1", RemotePort: "22", Protocol: tc.protocol}
+			tunnel := NewTunnel(testLog, &dialConnMock{}, "client-1", "1", remote, nil, nil, ConnDeadlines{}, DefaultConnLogging, nil)
+
+			_, err := tunnel.Start(context.Background())
+			require.NoError(t, err)
+			defer func() { require.NoError(t, tunnel.Terminate(true)) }()
+
+			assert.NotEqual(t, "0", tunnel.LocalPort)
+			// the port is bound by the tunnel
+			if tc.protocol == chshare.ProtocolUDP {
+				_, err = net.ListenPacket("udp4", "127.0.0.1:"+tunnel.LocalPort)
+			} else {
+				_, err = net.Listen("tcp4", "127.0.0.1:"+tunnel.LocalPort)
+			}
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestTunnelMarshalJSON(t *testing.T) {
+	testCases := []struct {
+		name         string
+		protocol     string
+		wantProtocol string
+	}{
+		{
+			name:         "no protocol",
+			protocol:     "",
+			wantProtocol: chshare.ProtocolTCP,
+		},
+		{
+			name:         "udp",
+			protocol:     chshare.ProtocolUDP,
+			wantProtocol: chshare.ProtocolUDP,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			tunnel := &Tunnel{
+				ID:     "1",
+				Remote: chshare.Remote{LocalHost: "0.0.0.0", LocalPort: "2222", RemoteHost: "0.0.0.0", RemotePort: "22", Protocol: tc.protocol},
+			}
+
+			b, err := json.Marshal(tunnel)
+			require.NoError(t, err)
+
+			var got map[string]interface{}
+			require.NoError(t, json.Unmarshal(b, &got))
+			assert.Equal(t, tc.wantProtocol, got["protocol"])
+			assert.Equal(t, "1", got["id"])
+			assert.Equal(t, "2222", got["lport"])
+			assert.Equal(t, tc.protocol, tunnel.Protocol, "tunnel is not changed")
+		})
+	}
+}
+
+func TestTunnelMarshalJSONWithBasicAuth(t *testing.T) {
+	tunnel := &Tunnel{
+		ID:     "1",
+		Remote: chshare.Remote{LocalPort: "4000", RemotePort: "80", AuthUser: "admin", AuthPasswordHash: "$2a$10$hash"},
+	}
+
+	b, err := json.Marshal(tunnel)
+	require.NoError(t, err)
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(b, &got))
+	assert.Equal(t, true, got["auth_enabled"])
+	assert.Equal(t, "admin", got["auth_user"])
+	assert.NotContains(t, string(b), "$2a$10$hash")
+}
+
+func TestTunnelWithMultipleBackends(t *testing.T) {
+	backendA := startBackend(t, "a")
+	backendB := startBackend(t, "b")
+	dead := deadBackend(t)
+
+	testCases := []struct {
+		name     string
+		backends []string
+		weights  []int
+		want     map[string]int
+	}{
+		{
+			name:     "round-robin",
+			backends: []string{backendA, backendB},
+			want:     map[string]int{"a": 4, "b": 4},
+		},
+		{
+			name:     "weighted",
+			backends: []string{backendA, backendB},
+			weights:  []int{3, 1},
+			want:     map[string]int{"a": 6, "b": 2},
+		},
+		{
+			name:     "dead backend is skipped",
+			backends: []string{backendA, dead, backendB},
+			want:     map[string]int{"a": 3, "b": 5},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			remote := &chshare.Remote{LocalHost: "127.0.0.1", LocalPort: freePort(t)}
+			require.NoError(t, remote.SetBackends(decodeRemotes(t, tc.backends...), tc.weights))
+
+			tunnel := NewTunnel(testLog, &dialConnMock{}, "client-1", "1", remote, nil, nil, ConnDeadlines{}, DefaultConnLogging, nil)
+			_, err := tunnel.Start(context.Background())
+			require.NoError(t, err)
+			defer func() { require.NoError(t, tunnel.Terminate(true)) }()
+
+			got := make(map[string]int)
+			for i := 0; i < 8; i++ {
+				got[readFromTunnel(t, remote.LocalHost+":"+remote.LocalPort)]++
+			}
+
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func readFromTunnel(t *testing.T, addr string) string {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	b, err := ioutil.ReadAll(conn)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestBackendBalancerConcurrentUse(t *testing.T) {
+	b := newBackendBalancer([]*chshare.Backend{{Host: "a", Port: "1", Weight: 1}, {Host: "b", Port: "1", Weight: 1}})
+
+	var mu sync.Mutex
+	got := make(map[string]int)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			order := b.Order()
+			mu.Lock()
+			got[order[0].Host]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, map[string]int{"a": 50, "b": 50}, got)
+}
+
+// startEchoBackend starts a tcp server that echoes data back and keeps connections open until a client closes them.
+func startEchoBackend(t *testing.T) string {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// echoThroughTunnel returns an open connection if a tunnel echoes written data back, nil if the connection was refused.
+func echoThroughTunnel(t *testing.T, addr string) net.Conn {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+	_, err = conn.Write([]byte("x"))
+	if err == nil {
+		b := make([]byte, 1)
+		if _, err = io.ReadFull(conn, b); err == nil {
+			return conn
+		}
+	}
+	conn.Close()
+	return nil
+}
+
+func TestTunnelCopyLimit(t *testing.T) {
+	const maxCopies = 6
+	limiter := NewCopyLimiter(maxCopies, 100*time.Millisecond)
+	remote := &chshare.Remote{LocalHost: "127.0.0.1", LocalPort: freePort(t)}
+	require.NoError(t, remote.SetBackends(decodeRemotes(t, startEchoBackend(t)), nil))
+
+	tunnel := NewTunnel(testLog, &dialConnMock{}, "client-1", "1", remote, nil, limiter, ConnDeadlines{}, DefaultConnLogging, nil)
+	_, err := tunnel.Start(context.Background())
+	require.NoError(t, err)
+	defer func() { require.NoError(t, tunnel.Terminate(true)) }()
+	addr := remote.LocalHost + ":" + remote.LocalPort
+
+	var peak int64
+	stopWatch := make(chan struct{})
+	watchDone := make(chan struct{})
+	go func() {
+		defer close(watchDone)
+		for {
+			if cur := int64(limiter.Running()); cur > atomic.LoadInt64(&peak) {
+				atomic.StoreInt64(&peak, cur)
+			}
+			select {
+			case <-stopWatch:
+				return
+			case <-time.After(time.Millisecond):
+			}
+		}
+	}()
+
+	var mu sync.Mutex
+	var open []net.Conn
+	refused := 0
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			conn := echoThroughTunnel(t, addr)
+			mu.Lock()
+			defer mu.Unlock()
+			if conn == nil {
+				refused++
+				return
+			}
+			open = append(open, conn)
+		}()
+	}
+	wg.Wait()
+	close(stopWatch)
+	<-watchDone
+
+	assert.Len(t, open, maxCopies/copyGoroutinesPerConn)
+	assert.Equal(t, 20-maxCopies/copyGoroutinesPerConn, refused)
+	assert.LessOrEqual(t, atomic.LoadInt64(&peak), int64(maxCopies))
+	assert.Equal(t, maxCopies, limiter.Running())
+
+	// a waiting connection gets a slot freed by a closed one
+	done := make(chan net.Conn)
+	go func() {
+		done <- echoThroughTunnel(t, addr)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, open[0].Close())
+	conn := <-done
+	require.NotNil(t, conn)
+	conn.Close()
+	for _, c := range open[1:] {
+		c.Close()
+	}
+	assert.Eventually(t, func() bool { return limiter.Running() == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestCopyLimiterNil(t *testing.T) {
+	limiter := NewCopyLimiter(0, time.Second)
+
+	assert.Nil(t, limiter)
+	assert.True(t, limiter.Acquire(context.Background()))
+	limiter.Release()
+	assert.Equal(t, 0, limiter.Running())
+}
+
+// startSilentBackend starts a tcp server that never sends anything. Connections that were closed by the other side are
+// sent to a returned channel.
+func startSilentBackend(t *testing.T) (string, chan struct{}) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+	closed := make(chan struct{}, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_, _ = io.Copy(ioutil.Discard, conn)
+				conn.Close()
+				closed <- struct{}{}
+			}()
+		}
+	}()
+	return l.Addr().String(), closed
+}
+
+func TestTunnelConnDeadlines(t *testing.T) {
+	testCases := []struct {
+		name      string
+		deadlines ConnDeadlines
+		wantReap  bool
+	}{
+		{
+			name:      "half-open connection is reaped after read deadline",
+			deadlines: ConnDeadlines{Read: 200 * time.Millisecond, Write: 200 * time.Millisecond},
+			wantReap:  true,
+		},
+		{
+			name:      "deadlines disabled",
+			deadlines: ConnDeadlines{},
+			wantReap:  false,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			backend, backendClosed := startSilentBackend(t)
+			remote := &chshare.Remote{LocalHost: "127.0.0.1", LocalPort: freePort(t)}
+			require.NoError(t, remote.SetBackends(decodeRemotes(t, backend), nil))
+
+			tunnel := NewTunnel(testLog, &dialConnMock{}, "client-1", "1", remote, nil, nil, tc.deadlines, DefaultConnLogging, nil)
+			_, err := tunnel.Start(context.Background())
+			require.NoError(t, err)
+			defer func() { require.NoError(t, tunnel.Terminate(true)) }()
+
+			// the peer sends some data and then vanishes without closing the connection
+			conn, err := net.Dial("tcp", remote.LocalHost+":"+remote.LocalPort)
+			require.NoError(t, err)
+			defer conn.Close()
+			_, err = conn.Write([]byte("x"))
+			require.NoError(t, err)
+			require.Eventually(t, func() bool { return atomic.LoadInt32(&tunnel.connCount) == 1 }, time.Second, 10*time.Millisecond)
+
+			select {
+			case <-backendClosed:
+				require.True(t, tc.wantReap, "connection is reaped unexpectedly")
+			case <-time.After(time.Second):
+				require.False(t, tc.wantReap, "connection is not reaped")
+			}
+
+			if tc.wantReap {
+				assert.Eventually(t, func() bool { return atomic.LoadInt32(&tunnel.connCount) == 0 }, time.Second, 10*time.Millisecond)
+				require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+				_, err = conn.Read(make([]byte, 1))
+				assert.Equal(t, io.EOF, err)
+			} else {
+				assert.EqualValues(t, 1, atomic.LoadInt32(&tunnel.connCount))
+			}
+		})
+	}
+}
+
+func TestTunnelConnDeadlinesActiveTransfer(t *testing.T) {
+	backend := startEchoBackend(t)
+	remote := &chshare.Remote{LocalHost: "127.0.0.1", LocalPort: freePort(t)}
+	require.NoError(t, remote.SetBackends(decodeRemotes(t, backend), nil))
+
+	deadlines := ConnDeadlines{Read: 200 * time.Millisecond, Write: 200 * time.Millisecond}
+	tunnel := NewTunnel(testLog, &dialConnMock{}, "client-1", "1", remote, nil, nil, deadlines, DefaultConnLogging, nil)
+	_, err := tunnel.Start(context.Background())
+	require.NoError(t, err)
+	defer func() { require.NoError(t, tunnel.Terminate(true)) }()
+
+	conn, err := net.Dial("tcp", remote.LocalHost+":"+remote.LocalPort)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// a connection that keeps transferring data outlives the deadlines
+	b := make([]byte, 1)
+	for i := 0; i < 8; i++ {
+		_, err = conn.Write([]byte("x"))
+		require.NoError(t, err)
+		_, err = io.ReadFull(conn, b)
+		require.NoError(t, err)
+		time.Sleep(100 * time.Millisecond)
+	}
+	assert.EqualValues(t, 1, atomic.LoadInt32(&tunnel.connCount))
+}
+
+func TestTunnelConnLogging(t *testing.T) {
+	logFile, err := ioutil.TempFile("", "tunnel-conn-log")
+	require.NoError(t, err)
+	logFile.Close()
+	defer os.Remove(logFile.Name())
+	logOutput := chshare.NewLogOutput(logFile.Name())
+	require.NoError(t, logOutput.Start())
+	defer logOutput.Shutdown()
+	logger := chshare.NewLogger("test", logOutput, chshare.LogLevelInfo)
+
+	remote := &chshare.Remote{LocalHost: "127.0.0.1", LocalPort: freePort(t)}
+	require.NoError(t, remote.SetBackends(decodeRemotes(t, startEchoBackend(t)), nil))
+	connLogging := ConnLogging{Level: chshare.LogLevelInfo, SampleRate: 2}
+	tunnel := NewTunnel(logger, &dialConnMock{}, "client-1", "1", remote, nil, nil, ConnDeadlines{}, connLogging, nil)
+	_, err = tunnel.Start(context.Background())
+	require.NoError(t, err)
+	defer func() { require.NoError(t, tunnel.Terminate(true)) }()
+
+	var srcAddrs []string
+	for i := 0; i < 3; i++ {
+		conn := echoThroughTunnel(t, remote.LocalHost+":"+remote.LocalPort)
+		require.NotNil(t, conn)
+		srcAddrs = append(srcAddrs, conn.LocalAddr().String())
+		conn.Close()
+		require.Eventually(t, func() bool { return atomic.LoadInt32(&tunnel.connCount) == 0 }, time.Second, 10*time.Millisecond)
+	}
+
+	b, err := ioutil.ReadFile(logFile.Name())
+	require.NoError(t, err)
+	var lines []string
+	for _, line := range strings.Split(string(b), "\n") {
+		if strings.Contains(line, "conn#") {
+			lines = append(lines, line)
+		}
+	}
+	// only the 1st and the 3rd connections are sampled
+	require.Len(t, lines, 4)
+	for i, src := range []string{srcAddrs[0], srcAddrs[2]} {
+		fields := `client_id="client-1" tunnel_id="1" src="` + src + `"`
+		assert.Contains(t, lines[2*i], "Open "+fields)
+		assert.Contains(t, lines[2*i+1], "Close "+fields+" duration=")
+		assert.Contains(t, lines[2*i+1], " sent_bytes=1 received_bytes=1")
+	}
+}
+
+func TestTunnelConnLoggingRefused(t *testing.T) {
+	testCases := []struct {
+		name      string
+		backend   func(t *testing.T) string
+		acl       string
+		fullLimit bool
+		wantLine  string
+		wantErr   string
+	}{
+		{
+			name:     "backend is not available",
+			backend:  deadBackend,
+			wantLine: `Close client_id="client-1" tunnel_id="1" src="%s" duration=`,
+			wantErr:  `sent_bytes=0 received_bytes=0 error="ssh: rejected: connect failed`,
+		},
+		{
+			name:      "max copies is reached",
+			backend:   startEchoBackend,
+			fullLimit: true,
+			wantLine:  `Close client_id="client-1" tunnel_id="1" src="%s" duration=`,
+			wantErr:   `sent_bytes=0 received_bytes=0 error="max concurrent tunnel data copies is reached"`,
+		},
+		{
+			name:     "rejected by ACL",
+			backend:  startEchoBackend,
+			acl:      "192.0.2.1",
+			wantLine: `Rejected client_id="client-1" tunnel_id="1" src="%s" error="access denied by ACL"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			logFile, err := ioutil.TempFile("", "tunnel-conn-log")
+			require.NoError(t, err)
+			logFile.Close()
+			defer os.Remove(logFile.Name())
+			logOutput := chshare.NewLogOutput(logFile.Name())
+			require.NoError(t, logOutput.Start())
+			defer logOutput.Shutdown()
+			logger := chshare.NewLogger("test", logOutput, chshare.LogLevelInfo)
+
+			remote := &chshare.Remote{LocalHost: "127.0.0.1", LocalPort: freePort(t)}
+			require.NoError(t, remote.SetBackends(decodeRemotes(t, tc.backend(t)), nil))
+			acl, err := ParseTunnelACL(tc.acl)
+			require.NoError(t, err)
+			var limiter *CopyLimiter
+			if tc.fullLimit {
+				limiter = NewCopyLimiter(copyGoroutinesPerConn, 0)
+				require.True(t, limiter.Acquire(context.Background()))
+				defer limiter.Release()
+			}
+			connLogging := ConnLogging{Level: chshare.LogLevelInfo}
+			tunnel := NewTunnel(logger, &dialConnMock{}, "client-1", "1", remote, acl, limiter, ConnDeadlines{}, connLogging, nil)
+			_, err = tunnel.Start(context.Background())
+			require.NoError(t, err)
+			defer func() { require.NoError(t, tunnel.Terminate(true)) }()
+
+			conn, err := net.Dial("tcp", remote.LocalHost+":"+remote.LocalPort)
+			require.NoError(t, err)
+			defer conn.Close()
+			wantLine := fmt.Sprintf(tc.wantLine, conn.LocalAddr().String())
+
+			// the connection is closed by the tunnel
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+			_, err = conn.Read(make([]byte, 1))
+			assert.Equal(t, io.EOF, err)
+			assert.Eventually(t, func() bool {
+				b, err := ioutil.ReadFile(logFile.Name())
+				require.NoError(t, err)
+				return strings.Contains(string(b), wantLine) && strings.Contains(string(b), tc.wantErr)
+			}, time.Second, 10*time.Millisecond)
+		})
+	}
+}
+
+func TestConnLoggingSampled(t *testing.T) {
+	testCases := []struct {
+		name       string
+		sampleRate int
+		wantLogged []int32
+	}{
+		{
+			name:       "no sampling",
+			sampleRate: 0,
+			wantLogged: []int32{1, 2, 3, 4, 5},
+		},
+		{
+			name:       "every connection",
+			sampleRate: 1,
+			wantLogged: []int32{1, 2, 3, 4, 5},
+		},
+		{
+			name:       "every 2nd connection",
+			sampleRate: 2,
+			wantLogged: []int32{1, 3, 5},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			l := ConnLogging{SampleRate: tc.sampleRate}
+			var logged []int32
+			for cid := int32(1); cid <= 5; cid++ {
+				if l.sampled(cid) {
+					logged = append(logged, cid)
+				}
+			}
+			assert.Equal(t, tc.wantLogged, logged)
+		})
+	}
+}
+
+func TestTunnelMaxLifetime(t *testing.T) {
+	testCases := []struct {
+		name               string
+		maxLifetime        time.Duration
+		idleTimeoutMinutes int
+		wantAutoClose      bool
+	}{
+		{
+			name:          "max lifetime is reached",
+			maxLifetime:   200 * time.Millisecond,
+			wantAutoClose: true,
+		},
+		{
+			name:               "max lifetime is reached before idle timeout",
+			maxLifetime:        200 * time.Millisecond,
+			idleTimeoutMinutes: 1,
+			wantAutoClose:      true,
+		},
+		{
+			name:          "no max lifetime",
+			maxLifetime:   0,
+			wantAutoClose: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			remote := &chshare.Remote{LocalHost: "127.0.0.1", LocalPort: freePort(t), IdleTimeoutMinutes: tc.idleTimeoutMinutes}
+			if tc.maxLifetime > 0 {
+				expiresAt := time.Now().Add(tc.maxLifetime)
+				remote.ExpiresAt = &expiresAt
+			}
+			require.NoError(t, remote.SetBackends(decodeRemotes(t, startEchoBackend(t)), nil))
+			tunnel := NewTunnel(testLog, &dialConnMock{}, "client-1", "1", remote, nil, nil, ConnDeadlines{}, DefaultConnLogging, nil)
+			autoCloseChan, err := tunnel.Start(context.Background())
+			require.NoError(t, err)
+			defer func() { require.NoError(t, tunnel.Terminate(true)) }()
+			addr := remote.LocalHost + ":" + remote.LocalPort
+
+			// an active connection doesn't prevent the tunnel from closing
+			conn := echoThroughTunnel(t, addr)
+			require.NotNil(t, conn)
+			defer conn.Close()
+
+			if !tc.wantAutoClose {
+				assert.Nil(t, autoCloseChan)
+				time.Sleep(300 * time.Millisecond)
+				_, err = conn.Write([]byte("x"))
+				require.NoError(t, err)
+				_, err = io.ReadFull(conn, make([]byte, 1))
+				assert.NoError(t, err)
+				return
+			}
+
+			select {
+			case <-autoCloseChan:
+			case <-time.After(2 * time.Second):
+				require.Fail(t, "tunnel is not closed after max lifetime")
+			}
+			_, err = io.ReadFull(conn, make([]byte, 1))
+			assert.Error(t, err)
+			_, err = net.Dial("tcp", addr)
+			assert.Error(t, err)
+		})
+	}
+}
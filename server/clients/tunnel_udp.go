@@ -0,0 +1,293 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	chshare "github.com/cloudradar-monitoring/rport/share"
+)
+
+// udpLimits bound resources used to relay datagrams of a single udp tunnel, so spoofed source addresses can't exhaust
+// the memory of the server.
+type udpLimits struct {
+	// IdleTimeout is a period without datagrams after which a relay of a source address is closed.
+	IdleTimeout time.Duration
+	// MaxFlows is a max number of source addresses relayed at once, datagrams of new ones are dropped.
+	MaxFlows int
+	// QueueSize is a max number of datagrams of a source address waiting to be relayed, extra ones are dropped.
+	QueueSize int
+	// MaxQueuedBytes is a max total size of datagrams of all sources waiting to be relayed, extra ones are dropped.
+	MaxQueuedBytes int
+}
+
+var defaultUDPLimits = udpLimits{
+	IdleTimeout:    time.Minute,
+	MaxFlows:       256,
+	QueueSize:      16,
+	MaxQueuedBytes: 4 * 1024 * 1024,
+}
+
+var (
+	errTooManyUDPFlows        = errors.New("too many source addresses are relayed")
+	errTooManyQueuedDatagrams = errors.New("too many datagrams are waiting to be relayed")
+	errTooManyQueuedUDPBytes  = errors.New("too many bytes are waiting to be relayed")
+)
+
+// udpFlows keeps queues of datagrams of source addresses that are relayed.
+type udpFlows struct {
+	limits udpLimits
+
+	mu          sync.Mutex
+	queues      map[string]chan []byte
+	queuedBytes int
+}
+
+func newUDPFlows(limits udpLimits) *udpFlows {
+	return &udpFlows{
+		limits: limits,
+		queues: make(map[string]chan []byte),
+	}
+}
+
+// enqueue adds a datagram to a queue of a given source. Returns the queue if it was created by this datagram, so a new
+// relay has to be started for it.
+func (f *udpFlows) enqueue(src string, payload []byte) (newQueue chan []byte, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	queue, ok := f.queues[src]
+	if !ok && len(f.queues) >= f.limits.MaxFlows {
+		return nil, errTooManyUDPFlows
+	}
+	if f.queuedBytes+len(payload) > f.limits.MaxQueuedBytes {
+		return nil, errTooManyQueuedUDPBytes
+	}
+	if !ok {
+		queue = make(chan []byte, f.limits.QueueSize)
+		f.queues[src] = queue
+		newQueue = queue
+	}
+	select {
+	case queue <- payload:
+	default:
+		return nil, errTooManyQueuedDatagrams
+	}
+	f.queuedBytes += len(payload)
+	return newQueue, nil
+}
+
+// dequeued releases a budget of a datagram that was taken from a queue.
+func (f *udpFlows) dequeued(payload []byte) {
+	f.mu.Lock()
+	f.queuedBytes -= len(payload)
+	f.mu.Unlock()
+}
+
+// removeIfEmpty removes a queue of a given source if no datagrams are waiting in it. Returns false if the queue
+// is not empty, so the relay has to continue.
+func (f *udpFlows) removeIfEmpty(src string, queue chan []byte) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(queue) > 0 {
+		return false
+	}
+	delete(f.queues, src)
+	return true
+}
+
+// remove removes a queue of a given source and drops the datagrams waiting in it. Returns a number of dropped datagrams.
+func (f *udpFlows) remove(src string, queue chan []byte) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.queues, src)
+	dropped := 0
+	for {
+		select {
+		case payload := <-queue:
+			f.queuedBytes -= len(payload)
+			dropped++
+		default:
+			return dropped
+		}
+	}
+}
+
+// listenUDP relays datagrams received on a given socket to the client. Each source address gets its own ssh channel,
+// so replies are sent back to the right source. The channel is closed when the source is idle for udpLimits.IdleTimeout.
+func (t *Tunnel) listenUDP(ctx context.Context, pc net.PacketConn) {
+	defer t.wg.Done()
+
+	t.Infof("Listening")
+
+	// background goroutine to close the socket when context is canceled
+	go func() {
+		<-ctx.Done()
+		if err := pc.Close(); err != nil {
+			t.Errorf("Failed to close listener: %v", err)
+			return
+		}
+		t.Debugf("Listener closed")
+	}()
+
+	flows := newUDPFlows(t.udpLimits)
+	buf := make([]byte, chshare.MaxDatagramSize)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-ctx.Done():
+				//listener closed
+			default:
+				t.Errorf("Failed to read datagram: %v", err)
+			}
+			return
+		}
+
+		if t.acl != nil {
+			udpAddr, ok := addr.(*net.UDPAddr)
+			if !ok {
+				t.Errorf("Unsupported remote address type. Expected net.UDPAddr. %v", addr)
+				continue
+			}
+
+			if !t.acl.CheckAccess(udpAddr.IP) {
+				t.logConnRejected(udpAddr.String())
+				continue
+			}
+		}
+
+		queue, err := flows.enqueue(addr.String(), append([]byte(nil), buf[:n]...))
+		if err != nil {
+			t.Debugf("Datagram from %s is dropped: %v", addr, err)
+			continue
+		}
+		t.touch()
+		if queue != nil {
+			t.wg.Add(1)
+			go func(src net.Addr) {
+				defer t.wg.Done()
+				t.relayUDP(ctx, pc, src, flows, queue)
+			}(addr)
+		}
+	}
+}
+
+// relayUDP sends datagrams of a given source to the client and sends replies back to the source until the source is idle.
+// The queue of the source is removed before the relay is finished, so new datagrams of the source start a new relay.
+func (t *Tunnel) relayUDP(ctx context.Context, pc net.PacketConn, src net.Addr, flows *udpFlows, queue chan []byte) {
+	cid := atomic.AddInt32(&t.connectionIDAutoIncrement, 1)
+	atomic.AddInt32(&t.connCount, 1)
+	defer atomic.AddInt32(&t.connCount, -1)
+
+	l := t.Fork("conn#%d", cid)
+	removed := false
+	defer func() {
+		if removed {
+			return
+		}
+		if dropped := flows.remove(src.String(), queue); dropped > 0 {
+			l.Infof("%d datagrams from %s are dropped: relay is closed", dropped, src)
+		}
+	}()
+
+	logConn := t.connLogging.sampled(cid)
+	if logConn {
+		l.LogWithFields(t.connLogging.Level, "Open", t.connLogFields(src.String())...)
+	}
+	openedAt := time.Now()
+	var sent, received int64
+	var closeReason string
+	defer func() {
+		if logConn {
+			t.logConnClose(l, src.String(), openedAt, sent, received, closeReason)
+		}
+	}()
+
+	if t.sshConn == nil {
+		l.Debugf("No remote connection")
+		closeReason = "no remote connection"
+		return
+	}
+	if !t.copyLimiter.Acquire(ctx) {
+		l.Infof("Refused: max concurrent tunnel data copies is reached")
+		closeReason = "max concurrent tunnel data copies is reached"
+		return
+	}
+	defer t.copyLimiter.Release()
+	dst, err := t.openChannel(l, chshare.UDPChannelType)
+	if err != nil {
+		l.Infof("Stream error: %s", err)
+		closeReason = err.Error()
+		return
+	}
+
+	activity := make(chan struct{}, 1)
+	replied := make(chan struct{})
+	go func() {
+		defer close(replied)
+		buf := make([]byte, chshare.MaxDatagramSize)
+		for {
+			payload, err := chshare.ReadDatagram(dst, buf)
+			if err != nil {
+				return
+			}
+			if _, err := pc.WriteTo(payload, src); err != nil {
+				return
+			}
+			received += int64(len(payload))
+			t.touch()
+			select {
+			case activity <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	idleTimeout := t.udpLimits.IdleTimeout
+	idle := time.NewTimer(idleTimeout)
+	defer idle.Stop()
+	resetIdle := func() {
+		if !idle.Stop() {
+			select {
+			case <-idle.C:
+			default:
+			}
+		}
+		idle.Reset(idleTimeout)
+	}
+relay:
+	for {
+		select {
+		case payload := <-queue:
+			flows.dequeued(payload)
+			if err := chshare.WriteDatagram(dst, payload); err != nil {
+				l.Debugf("Failed to send datagram: %v", err)
+				break relay
+			}
+			sent += int64(len(payload))
+			resetIdle()
+		case <-activity:
+			resetIdle()
+		case <-replied:
+			// closed by the client
+			break relay
+		case <-idle.C:
+			// a datagram could be queued right before the timeout, it's relayed before closing
+			if !flows.removeIfEmpty(src.String(), queue) {
+				idle.Reset(idleTimeout)
+				continue
+			}
+			removed = true
+			l.Debugf("closed: no datagrams for %v", idleTimeout)
+			break relay
+		case <-ctx.Done():
+			break relay
+		}
+	}
+	dst.Close()
+	<-replied
+}
@@ -0,0 +1,185 @@
+package clients
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	chshare "github.com/cloudradar-monitoring/rport/share"
+)
+
+// startUDPEchoBackend starts a udp server that replies with a given prefix followed by every received datagram.
+func startUDPEchoBackend(t *testing.T, prefix string) string {
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { pc.Close() })
+	go func() {
+		buf := make([]byte, chshare.MaxDatagramSize)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			_, _ = pc.WriteTo(append([]byte(prefix), buf[:n]...), addr)
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func freeUDPPort(t *testing.T) string {
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer pc.Close()
+	_, port, err := net.SplitHostPort(pc.LocalAddr().String())
+	require.NoError(t, err)
+	return port
+}
+
+func exchangeDatagram(t *testing.T, conn net.Conn, payload string) string {
+	_, err := conn.Write([]byte(payload))
+	require.NoError(t, err)
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	buf := make([]byte, chshare.MaxDatagramSize)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	return string(buf[:n])
+}
+
+func TestUDPTunnel(t *testing.T) {
+	backend := startUDPEchoBackend(t, "echo:")
+	remote, err := chshare.DecodeRemote("127.0.0.1:" + freeUDPPort(t) + "/udp:" + backend + "/udp")
+	require.NoError(t, err)
+	tunnel := NewTunnel(testLog, &dialConnMock{}, "client-1", "1", remote, nil, nil, ConnDeadlines{}, DefaultConnLogging, nil)
+	tunnel.udpLimits.IdleTimeout = 200 * time.Millisecond
+	_, err = tunnel.Start(context.Background())
+	require.NoError(t, err)
+	defer func() { require.NoError(t, tunnel.Terminate(true)) }()
+
+	src1, err := net.Dial("udp", remote.LocalHost+":"+remote.LocalPort)
+	require.NoError(t, err)
+	defer src1.Close()
+	src2, err := net.Dial("udp", remote.LocalHost+":"+remote.LocalPort)
+	require.NoError(t, err)
+	defer src2.Close()
+
+	// replies are sent back to the right source
+	assert.Equal(t, "echo:ping1", exchangeDatagram(t, src1, "ping1"))
+	assert.Equal(t, "echo:ping2", exchangeDatagram(t, src2, "ping2"))
+	assert.Equal(t, "echo:ping3", exchangeDatagram(t, src1, "ping3"))
+	assert.EqualValues(t, 2, atomic.LoadInt32(&tunnel.connCount))
+
+	// idle sources are closed
+	require.Eventually(t, func() bool { return atomic.LoadInt32(&tunnel.connCount) == 0 }, 2*time.Second, 10*time.Millisecond)
+
+	// a new datagram of a closed source starts a new relay
+	assert.Equal(t, "echo:ping4", exchangeDatagram(t, src1, "ping4"))
+}
+
+func TestUDPTunnelACL(t *testing.T) {
+	backend := startUDPEchoBackend(t, "echo:")
+	remote, err := chshare.DecodeRemote("127.0.0.1:" + freeUDPPort(t) + "/udp:" + backend + "/udp")
+	require.NoError(t, err)
+	acl, err := ParseTunnelACL("192.0.2.1")
+	require.NoError(t, err)
+	tunnel := NewTunnel(testLog, &dialConnMock{}, "client-1", "1", remote, acl, nil, ConnDeadlines{}, DefaultConnLogging, nil)
+	_, err = tunnel.Start(context.Background())
+	require.NoError(t, err)
+	defer func() { require.NoError(t, tunnel.Terminate(true)) }()
+
+	conn, err := net.Dial("udp", remote.LocalHost+":"+remote.LocalPort)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(t, err)
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(200*time.Millisecond)))
+	_, err = conn.Read(make([]byte, 10))
+	require.Error(t, err)
+	assert.EqualValues(t, 0, atomic.LoadInt32(&tunnel.connCount))
+}
+
+func TestUDPTunnelMaxFlows(t *testing.T) {
+	backend := startUDPEchoBackend(t, "echo:")
+	remote, err := chshare.DecodeRemote("127.0.0.1:" + freeUDPPort(t) + "/udp:" + backend + "/udp")
+	require.NoError(t, err)
+	tunnel := NewTunnel(testLog, &dialConnMock{}, "client-1", "1", remote, nil, nil, ConnDeadlines{}, DefaultConnLogging, nil)
+	tunnel.udpLimits.MaxFlows = 1
+	_, err = tunnel.Start(context.Background())
+	require.NoError(t, err)
+	defer func() { require.NoError(t, tunnel.Terminate(true)) }()
+
+	src1, err := net.Dial("udp", remote.LocalHost+":"+remote.LocalPort)
+	require.NoError(t, err)
+	defer src1.Close()
+	src2, err := net.Dial("udp", remote.LocalHost+":"+remote.LocalPort)
+	require.NoError(t, err)
+	defer src2.Close()
+
+	assert.Equal(t, "echo:ping1", exchangeDatagram(t, src1, "ping1"))
+
+	// datagrams of a new source are dropped
+	_, err = src2.Write([]byte("ping2"))
+	require.NoError(t, err)
+	require.NoError(t, src2.SetReadDeadline(time.Now().Add(200*time.Millisecond)))
+	_, err = src2.Read(make([]byte, 10))
+	require.Error(t, err)
+	assert.EqualValues(t, 1, atomic.LoadInt32(&tunnel.connCount))
+
+	// known sources are still relayed
+	assert.Equal(t, "echo:ping3", exchangeDatagram(t, src1, "ping3"))
+}
+
+func TestUDPFlowsEnqueue(t *testing.T) {
+	flows := newUDPFlows(udpLimits{MaxFlows: 2, QueueSize: 2, MaxQueuedBytes: 10})
+
+	queue1, err := flows.enqueue("src1", []byte("123"))
+	require.NoError(t, err)
+	require.NotNil(t, queue1, "new source starts a relay")
+
+	queue, err := flows.enqueue("src1", []byte("456"))
+	require.NoError(t, err)
+	assert.Nil(t, queue, "known source doesn't start a relay")
+
+	_, err = flows.enqueue("src1", []byte("7"))
+	assert.Equal(t, errTooManyQueuedDatagrams, err)
+
+	queue2, err := flows.enqueue("src2", []byte("1234"))
+	require.NoError(t, err)
+	require.NotNil(t, queue2)
+
+	_, err = flows.enqueue("src3", []byte("1"))
+	assert.Equal(t, errTooManyUDPFlows, err)
+
+	_, err = flows.enqueue("src2", []byte("1"))
+	assert.Equal(t, errTooManyQueuedUDPBytes, err)
+
+	flows.dequeued(<-queue1)
+	_, err = flows.enqueue("src2", []byte("1"))
+	require.NoError(t, err)
+	assert.Equal(t, 8, flows.queuedBytes)
+}
+
+func TestUDPFlowsRemove(t *testing.T) {
+	flows := newUDPFlows(udpLimits{MaxFlows: 1, QueueSize: 2, MaxQueuedBytes: 10})
+	queue, err := flows.enqueue("src1", []byte("123"))
+	require.NoError(t, err)
+
+	// a queue with a pending datagram is kept
+	assert.False(t, flows.removeIfEmpty("src1", queue))
+	flows.dequeued(<-queue)
+	assert.True(t, flows.removeIfEmpty("src1", queue))
+	assert.Empty(t, flows.queues)
+
+	queue, err = flows.enqueue("src1", []byte("12"))
+	require.NoError(t, err)
+	_, err = flows.enqueue("src1", []byte("34"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, flows.remove("src1", queue))
+	assert.Empty(t, flows.queues)
+	assert.Equal(t, 0, flows.queuedBytes)
+}
@@ -0,0 +1,135 @@
+package chserver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloudradar-monitoring/rport/server/clients"
+	"github.com/cloudradar-monitoring/rport/server/clientsauth"
+	chshare "github.com/cloudradar-monitoring/rport/share"
+)
+
+// clientsAuthPurgeInterval is an interval to check client auth entries for being unused.
+const clientsAuthPurgeInterval = 10 * time.Minute
+
+type boundClientsGetter interface {
+	GetAllByClientID(clientAuthID string) []*clients.Client
+}
+
+// ClientsAuthPurgeTask deletes client auth entries that have no bound clients for longer than a grace period.
+// Since clients are deleted after {keep_lost_clients}, the time an entry became unused is tracked in memory,
+// it's counted from the server start at the latest.
+type ClientsAuthPurgeTask struct {
+	log         *chshare.Logger
+	provider    clientsauth.Provider
+	clients     boundClientsGetter
+	gracePeriod time.Duration
+	// writeable is false in read-only and single client modes, the task does nothing then
+	writeable bool
+	now       func() time.Time
+
+	mu          sync.Mutex
+	unusedSince map[string]time.Time
+}
+
+// NewClientsAuthPurgeTask returns a task to purge client auth entries unused for longer than a given grace period.
+func NewClientsAuthPurgeTask(
+	log *chshare.Logger, provider clientsauth.Provider, clients boundClientsGetter, gracePeriod time.Duration, writeable bool,
+) *ClientsAuthPurgeTask {
+	return &ClientsAuthPurgeTask{
+		log:         log,
+		provider:    provider,
+		clients:     clients,
+		gracePeriod: gracePeriod,
+		writeable:   writeable,
+		now:         time.Now,
+		unusedSince: make(map[string]time.Time),
+	}
+}
+
+// Run purges client auth entries unused for longer than the configured grace period.
+func (t *ClientsAuthPurgeTask) Run(ctx context.Context) error {
+	_, err := t.Purge(t.gracePeriod)
+	return err
+}
+
+// Observe records client auth entries that have no bound clients without purging them.
+func (t *ClientsAuthPurgeTask) Observe() error {
+	if !t.writeable {
+		return nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, err := t.observe()
+	return err
+}
+
+// Purge deletes client auth entries that have no bound clients for at least a given grace period
+// and returns their IDs sorted. It's a no-op if client auth is not writeable.
+func (t *ClientsAuthPurgeTask) Purge(gracePeriod time.Duration) ([]string, error) {
+	if !t.writeable {
+		return nil, nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now, err := t.observe()
+	if err != nil {
+		return nil, err
+	}
+
+	purged := []string{}
+	for id, since := range t.unusedSince {
+		if now.Sub(since) < gracePeriod {
+			continue
+		}
+		// a client could connect meanwhile
+		if len(t.clients.GetAllByClientID(id)) > 0 {
+			delete(t.unusedSince, id)
+			continue
+		}
+		if err := t.provider.Delete(id); err != nil {
+			return purged, fmt.Errorf("failed to delete client auth %q: %v", id, err)
+		}
+		delete(t.unusedSince, id)
+		purged = append(purged, id)
+		t.log.Infof("ClientAuth %q purged, it has no bound clients since %s.", id, since.Format(time.RFC3339))
+	}
+	sort.Strings(purged)
+
+	return purged, nil
+}
+
+// observe updates the time client auth entries became unused and returns the current time.
+func (t *ClientsAuthPurgeTask) observe() (time.Time, error) {
+	now := t.now()
+	all, err := t.provider.GetAll()
+	if err != nil {
+		return now, fmt.Errorf("failed to get client auth entries: %v", err)
+	}
+
+	existing := make(map[string]bool, len(all))
+	for _, cur := range all {
+		existing[cur.ID] = true
+		if len(t.clients.GetAllByClientID(cur.ID)) > 0 {
+			delete(t.unusedSince, cur.ID)
+			continue
+		}
+		if _, ok := t.unusedSince[cur.ID]; !ok {
+			t.unusedSince[cur.ID] = now
+		}
+	}
+	// forget entries deleted by other means
+	for id := range t.unusedSince {
+		if !existing[id] {
+			delete(t.unusedSince, id)
+		}
+	}
+
+	return now, nil
+}
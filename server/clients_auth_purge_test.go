@@ -0,0 +1,191 @@
+package chserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/rport/server/clients"
+	"github.com/cloudradar-monitoring/rport/server/clientsauth"
+)
+
+type boundClientsMock map[string][]*clients.Client
+
+func (m boundClientsMock) GetAllByClientID(clientAuthID string) []*clients.Client {
+	return m[clientAuthID]
+}
+
+func getClientAuthIDs(t *testing.T, p clientsauth.Provider) []string {
+	all, err := p.GetAll()
+	require.NoError(t, err)
+	clientsauth.SortByID(all, false)
+	ids := make([]string, 0, len(all))
+	for _, cur := range all {
+		ids = append(ids, cur.ID)
+	}
+	return ids
+}
+
+func TestClientsAuthPurgeTask(t *testing.T) {
+	provider := clientsauth.NewMockProvider([]*clientsauth.ClientAuth{
+		{ID: "recent", Password: "pswd"},
+		{ID: "stale", Password: "pswd"},
+		{ID: "used", Password: "pswd"},
+	})
+	bound := boundClientsMock{
+		"recent": {clients.New(t).ClientAuthID("recent").Build()},
+		"used":   {clients.New(t).ClientAuthID("used").Build()},
+	}
+	now := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	task := NewClientsAuthPurgeTask(testLog, provider, bound, time.Hour, true)
+	task.now = func() time.Time { return now }
+
+	// server start
+	require.NoError(t, task.Observe())
+
+	// the last client of "recent" is deleted
+	now = now.Add(50 * time.Minute)
+	delete(bound, "recent")
+	require.NoError(t, task.Run(context.Background()))
+	assert.Equal(t, []string{"recent", "stale", "used"}, getClientAuthIDs(t, provider))
+
+	// "stale" exceeds the grace period
+	now = now.Add(11 * time.Minute)
+	purged, err := task.Purge(time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"stale"}, purged)
+	assert.Equal(t, []string{"recent", "used"}, getClientAuthIDs(t, provider))
+
+	// "recent" gets a client again before the grace period is exceeded
+	bound["recent"] = []*clients.Client{clients.New(t).ClientAuthID("recent").Build()}
+	now = now.Add(time.Hour)
+	purged, err = task.Purge(time.Hour)
+	require.NoError(t, err)
+	assert.Empty(t, purged)
+	assert.Equal(t, []string{"recent", "used"}, getClientAuthIDs(t, provider))
+}
+
+func TestClientsAuthPurgeTaskReadOnly(t *testing.T) {
+	provider := clientsauth.NewMockProvider([]*clientsauth.ClientAuth{{ID: "stale", Password: "pswd"}})
+	now := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	task := NewClientsAuthPurgeTask(testLog, provider, boundClientsMock{}, time.Hour, false)
+	task.now = func() time.Time { return now }
+
+	require.NoError(t, task.Observe())
+	now = now.Add(2 * time.Hour)
+	purged, err := task.Purge(time.Hour)
+	require.NoError(t, err)
+
+	assert.Empty(t, purged)
+	assert.Equal(t, []string{"stale"}, getClientAuthIDs(t, provider))
+}
+
+func TestHandlePurgeClientsAuth(t *testing.T) {
+	c1 := clients.New(t).ClientAuthID(cl1.ID).DisconnectedDuration(5 * time.Minute).Build()
+
+	testCases := []struct {
+		name            string
+		provider        clientsauth.Provider
+		clientAuthWrite bool
+		purgeAfter      time.Duration
+		query           string
+
+		wantStatusCode  int
+		wantResp        string
+		wantClientsAuth []string
+	}{
+		{
+			name:            "purge unused",
+			provider:        clientsauth.NewMockProvider([]*clientsauth.ClientAuth{cl1, cl2, cl3}),
+			clientAuthWrite: true,
+			query:           "?older_than=0s",
+			wantStatusCode:  http.StatusOK,
+			wantResp:        `{"data":["user2","user3"]}`,
+			wantClientsAuth: []string{cl1.ID},
+		},
+		{
+			name:            "within configured grace period",
+			provider:        clientsauth.NewMockProvider([]*clientsauth.ClientAuth{cl1, cl2, cl3}),
+			clientAuthWrite: true,
+			purgeAfter:      time.Hour,
+			wantStatusCode:  http.StatusOK,
+			wantResp:        `{"data":[]}`,
+			wantClientsAuth: []string{cl1.ID, cl2.ID, cl3.ID},
+		},
+		{
+			name:            "grace period is not configured",
+			provider:        clientsauth.NewMockProvider([]*clientsauth.ClientAuth{cl1, cl2, cl3}),
+			clientAuthWrite: true,
+			wantStatusCode:  http.StatusBadRequest,
+			wantResp:        `{"errors":[{"code":"ERR_CODE_INVALID_REQUEST","title":"Missing older_than param, 'purge_clients_auth_after' is not configured.","detail":""}]}`,
+			wantClientsAuth: []string{cl1.ID, cl2.ID, cl3.ID},
+		},
+		{
+			name:            "invalid grace period",
+			provider:        clientsauth.NewMockProvider([]*clientsauth.ClientAuth{cl1, cl2, cl3}),
+			clientAuthWrite: true,
+			query:           "?older_than=-1h",
+			wantStatusCode:  http.StatusBadRequest,
+			wantResp:        `{"errors":[{"code":"ERR_CODE_INVALID_REQUEST","title":"Invalid older_than param -1h.","detail":""}]}`,
+			wantClientsAuth: []string{cl1.ID, cl2.ID, cl3.ID},
+		},
+		{
+			name:            "read-only",
+			provider:        clientsauth.NewMockProvider([]*clientsauth.ClientAuth{cl1, cl2, cl3}),
+			clientAuthWrite: false,
+			query:           "?older_than=0s",
+			wantStatusCode:  http.StatusMethodNotAllowed,
+			wantResp:        `{"errors":[{"code":"ERR_CODE_CLIENT_AUTH_RO","title":"Client authentication has been attached in read-only mode.","detail":""}]}`,
+			wantClientsAuth: []string{cl1.ID, cl2.ID, cl3.ID},
+		},
+		{
+			name:            "single client",
+			provider:        clientsauth.NewSingleProvider(cl2.ID, cl2.Password),
+			clientAuthWrite: true,
+			query:           "?older_than=0s",
+			wantStatusCode:  http.StatusMethodNotAllowed,
+			wantResp:        `{"errors":[{"code":"ERR_CODE_CLIENT_AUTH_SINGLE","title":"Client authentication is enabled only for a single user.","detail":""}]}`,
+			wantClientsAuth: []string{cl2.ID},
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			clientService := NewClientService(nil, clients.NewClientRepository([]*clients.Client{c1}, &hour, testLog))
+			al := APIListener{
+				insecureForTests: true,
+				Server: &Server{
+					clientService: clientService,
+					config: &Config{
+						Server: ServerConfig{
+							AuthWrite:             tc.clientAuthWrite,
+							MaxRequestBytes:       1024 * 1024,
+							PurgeClientsAuthAfter: tc.purgeAfter,
+						},
+					},
+					clientAuthProvider: tc.provider,
+					clientsAuthPurge: NewClientsAuthPurgeTask(
+						testLog, tc.provider, clientService, tc.purgeAfter, tc.provider.IsWriteable() && tc.clientAuthWrite,
+					),
+				},
+				Logger: testLog,
+			}
+			al.initRouter()
+			require.NoError(t, al.clientsAuthPurge.Observe())
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/clients-auth/purge"+tc.query, nil)
+			w := httptest.NewRecorder()
+			al.router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.wantStatusCode, w.Code)
+			assert.Equal(t, tc.wantResp, w.Body.String())
+			assert.Equal(t, tc.wantClientsAuth, getClientAuthIDs(t, tc.provider))
+		})
+	}
+}
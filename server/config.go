@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"net/smtp"
 	"net/url"
+	"os"
 	"os/exec"
 	"path"
 	"regexp"
@@ -20,9 +21,12 @@ import (
 	mapset "github.com/deckarep/golang-set"
 	"github.com/jpillora/requestlog"
 
+	"github.com/cloudradar-monitoring/rport/server/api/jobs"
 	"github.com/cloudradar-monitoring/rport/server/api/message"
+	"github.com/cloudradar-monitoring/rport/server/clients"
 	"github.com/cloudradar-monitoring/rport/server/ports"
 	chshare "github.com/cloudradar-monitoring/rport/share"
+	"github.com/cloudradar-monitoring/rport/share/comm"
 	"github.com/cloudradar-monitoring/rport/share/email"
 )
 
@@ -40,6 +44,14 @@ type APIConfig struct {
 	UserLoginWait  float32 `mapstructure:"user_login_wait"`
 	MaxFailedLogin int     `mapstructure:"max_failed_login"`
 	BanTime        int     `mapstructure:"ban_time"`
+	// RequestTimeout limits the time to handle an API request, 0 means no limit
+	RequestTimeout time.Duration `mapstructure:"request_timeout"`
+	// MaxClientsPageLimit caps page[limit] of the clients list, 0 means no cap
+	MaxClientsPageLimit int `mapstructure:"max_clients_page_limit"`
+	// EnableMetrics enables the Prometheus metrics endpoint
+	EnableMetrics bool `mapstructure:"enable_metrics"`
+	// PersistSessions stores API sessions in the data dir, so users stay logged in after restarts
+	PersistSessions bool `mapstructure:"persist_sessions"`
 
 	TwoFATokenDelivery       string                 `mapstructure:"two_fa_token_delivery"`
 	TwoFATokenTTLSeconds     int                    `mapstructure:"two_fa_token_ttl_seconds"`
@@ -53,6 +65,11 @@ func (c *APIConfig) IsTwoFAOn() bool {
 	return c.TwoFATokenDelivery != ""
 }
 
+// IsTOTPOn returns true if 2FA codes are generated by authenticator apps of users instead of being sent to them.
+func (c *APIConfig) IsTOTPOn() bool {
+	return c.TwoFATokenDelivery == "totp"
+}
+
 func (c *APIConfig) parseAndValidate2FASendToType() error {
 	if c.TwoFASendToType != message.ValidationNone &&
 		c.TwoFASendToType != message.ValidationEmail &&
@@ -86,33 +103,87 @@ type LogConfig struct {
 }
 
 type ServerConfig struct {
-	ListenAddress              string        `mapstructure:"address"`
-	URL                        string        `mapstructure:"url"`
-	KeySeed                    string        `mapstructure:"key_seed"`
-	Auth                       string        `mapstructure:"auth"`
-	AuthFile                   string        `mapstructure:"auth_file"`
-	AuthTable                  string        `mapstructure:"auth_table"`
-	Proxy                      string        `mapstructure:"proxy"`
-	UsedPortsRaw               []string      `mapstructure:"used_ports"`
-	ExcludedPortsRaw           []string      `mapstructure:"excluded_ports"`
-	DataDir                    string        `mapstructure:"data_dir"`
-	KeepLostClients            time.Duration `mapstructure:"keep_lost_clients"`
-	CleanupClients             time.Duration `mapstructure:"cleanup_clients_interval"`
-	MaxRequestBytes            int64         `mapstructure:"max_request_bytes"`
-	CheckPortTimeout           time.Duration `mapstructure:"check_port_timeout"`
-	RunRemoteCmdTimeoutSec     int           `mapstructure:"run_remote_cmd_timeout_sec"`
-	AuthWrite                  bool          `mapstructure:"auth_write"`
-	AuthMultiuseCreds          bool          `mapstructure:"auth_multiuse_creds"`
-	EquateClientauthidClientid bool          `mapstructure:"equate_clientauthid_clientid"`
-	AllowRoot                  bool          `mapstructure:"allow_root"`
-	ClientLoginWait            float32       `mapstructure:"client_login_wait"`
-	MaxFailedLogin             int           `mapstructure:"max_failed_login"`
-	BanTime                    int           `mapstructure:"ban_time"`
-	EnableWsTestEndpoints      bool          `mapstructure:"enable_ws_test_endpoints"`
+	ListenAddress                string        `mapstructure:"address"`
+	URL                          string        `mapstructure:"url"`
+	KeySeed                      string        `mapstructure:"key_seed"`
+	Auth                         string        `mapstructure:"auth"`
+	AuthFile                     string        `mapstructure:"auth_file"`
+	AuthTable                    string        `mapstructure:"auth_table"`
+	Proxy                        string        `mapstructure:"proxy"`
+	UsedPortsRaw                 []string      `mapstructure:"used_ports"`
+	ExcludedPortsRaw             []string      `mapstructure:"excluded_ports"`
+	DataDir                      string        `mapstructure:"data_dir"`
+	KeepLostClients              time.Duration `mapstructure:"keep_lost_clients"`
+	ParkLostClients              bool          `mapstructure:"park_lost_clients"`
+	CleanupClients               time.Duration `mapstructure:"cleanup_clients_interval"`
+	CleanupClientsJitter         time.Duration `mapstructure:"cleanup_clients_jitter"`
+	CleanupClientsBatchSize      int           `mapstructure:"cleanup_clients_batch_size"`
+	ClientSaveWorkers            int           `mapstructure:"client_save_workers"`
+	ClientSaveBatchSize          int           `mapstructure:"client_save_batch_size"`
+	MaxRequestBytes              int64         `mapstructure:"max_request_bytes"`
+	CheckPortTimeout             time.Duration `mapstructure:"check_port_timeout"`
+	RunRemoteCmdTimeoutSec       int           `mapstructure:"run_remote_cmd_timeout_sec"`
+	AuthWrite                    bool          `mapstructure:"auth_write"`
+	AuthMultiuseCreds            bool          `mapstructure:"auth_multiuse_creds"`
+	EquateClientauthidClientid   bool          `mapstructure:"equate_clientauthid_clientid"`
+	AllowRoot                    bool          `mapstructure:"allow_root"`
+	ClientLoginWait              float32       `mapstructure:"client_login_wait"`
+	MaxFailedLogin               int           `mapstructure:"max_failed_login"`
+	BanTime                      int           `mapstructure:"ban_time"`
+	MaxConnAttemptsPerIP         int           `mapstructure:"max_conn_attempts_per_ip"`
+	ConnAttemptsInterval         time.Duration `mapstructure:"conn_attempts_interval"`
+	ConnRateBanTime              time.Duration `mapstructure:"conn_rate_ban_time"`
+	EnableWsTestEndpoints        bool          `mapstructure:"enable_ws_test_endpoints"`
+	JobResultsDir                string        `mapstructure:"job_results_dir"`
+	KeepJobs                     time.Duration `mapstructure:"keep_jobs"`
+	KeepAuditLog                 time.Duration `mapstructure:"keep_audit_log"`
+	JobsDBDriver                 string        `mapstructure:"jobs_db_driver"`
+	JobsDBDSN                    string        `mapstructure:"jobs_db_dsn"`
+	NodeID                       string        `mapstructure:"node_id"`
+	AllowedEnvironments          []string      `mapstructure:"allowed_environments"`
+	MaxConcurrentMultiJobs       int           `mapstructure:"max_concurrent_multi_jobs"`
+	MaxConcurrentTunnelCopies    int           `mapstructure:"max_concurrent_tunnel_copies"`
+	TunnelCopyWait               time.Duration `mapstructure:"tunnel_copy_wait"`
+	TunnelReadDeadline           time.Duration `mapstructure:"tunnel_read_deadline"`
+	TunnelWriteDeadline          time.Duration `mapstructure:"tunnel_write_deadline"`
+	TunnelConnLogLevel           string        `mapstructure:"tunnel_conn_log_level"`
+	TunnelConnLogSampleRate      int           `mapstructure:"tunnel_conn_log_sample_rate"`
+	MaxChannelsPerClient         int           `mapstructure:"max_channels_per_client"`
+	MaxJobResultSizeBytes        int           `mapstructure:"max_job_result_size_bytes"`
+	RegistrationHookURL          string        `mapstructure:"first_registration_hook_url"`
+	RegistrationHookCommand      string        `mapstructure:"first_registration_hook_command"`
+	RegistrationHookRetries      int           `mapstructure:"first_registration_hook_retries"`
+	RegistrationHookTimeout      time.Duration `mapstructure:"first_registration_hook_timeout"`
+	ClientStateWebhookURLs       []string      `mapstructure:"client_state_webhook_urls"`
+	ClientStateWebhookSecret     string        `mapstructure:"client_state_webhook_secret"`
+	ClientStateWebhookRetries    int           `mapstructure:"client_state_webhook_retries"`
+	ClientStateWebhookTimeout    time.Duration `mapstructure:"client_state_webhook_timeout"`
+	PurgeClientsAuthAfter        time.Duration `mapstructure:"purge_clients_auth_after"`
+	CommandSigningKey            string        `mapstructure:"command_signing_key"`
+	MaxCachedDisconnectedClients int           `mapstructure:"max_cached_disconnected_clients"`
+	ShutdownGracePeriod          time.Duration `mapstructure:"shutdown_grace_period"`
+	AllowedOrigins               []string      `mapstructure:"allowed_origins"`
+	AllowedHosts                 []string      `mapstructure:"allowed_hosts"`
+	ClientIdleTimeout            time.Duration `mapstructure:"client_idle_timeout"`
+	RequiredClientFields         []string      `mapstructure:"required_client_fields"`
+	MissingClientFieldsAction    string        `mapstructure:"missing_client_fields_action"`
 
 	allowedPorts mapset.Set
 	authID       string
 	authPassword string
+
+	tunnelConnLogLevel chshare.LogLevel
+}
+
+// String returns the config with the key seed, client credentials, jobs DB DSN and webhook secret redacted, so it can be logged.
+func (c ServerConfig) String() string {
+	type serverConfig ServerConfig
+	for _, secret := range []*string{&c.KeySeed, &c.Auth, &c.authPassword, &c.JobsDBDSN, &c.ClientStateWebhookSecret} {
+		if *secret != "" {
+			*secret = redactedValue
+		}
+	}
+	return fmt.Sprintf("%+v", serverConfig(c))
 }
 
 type DatabaseConfig struct {
@@ -146,6 +217,84 @@ func (c *PushoverConfig) Validate() error {
 	return nil
 }
 
+// LDAPConfig enables authentication of API users against an LDAP directory if URL is set.
+type LDAPConfig struct {
+	URL            string            `mapstructure:"url"`
+	StartTLS       bool              `mapstructure:"start_tls"`
+	AllowInsecure  bool              `mapstructure:"allow_insecure"`
+	BindDN         string            `mapstructure:"bind_dn"`
+	BindPassword   string            `mapstructure:"bind_password"`
+	BaseDN         string            `mapstructure:"base_dn"`
+	UserFilter     string            `mapstructure:"user_filter"`
+	GroupFilter    string            `mapstructure:"group_filter"`
+	GroupAttribute string            `mapstructure:"group_attribute"`
+	Groups         map[string]string `mapstructure:"groups"`
+	Timeout        time.Duration     `mapstructure:"timeout"`
+	BindCacheTTL   time.Duration     `mapstructure:"bind_cache_ttl"`
+}
+
+// String returns the config with the bind password redacted, so it can be logged.
+func (c LDAPConfig) String() string {
+	type ldapConfig LDAPConfig
+	if c.BindPassword != "" {
+		c.BindPassword = redactedValue
+	}
+	return fmt.Sprintf("%+v", ldapConfig(c))
+}
+
+func (c *LDAPConfig) Validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+		return errors.New("invalid ldap.url, expected ldap:// or ldaps:// url, e.g. 'ldaps://ldap.example.com:636'")
+	}
+	if u.User != nil {
+		return errors.New("ldap.url cannot contain credentials, use ldap.bind_dn and ldap.bind_password instead")
+	}
+	if c.StartTLS && u.Scheme == "ldaps" {
+		return errors.New("ldap.start_tls cannot be used with ldaps:// url")
+	}
+	if u.Scheme == "ldap" && !c.StartTLS && !c.AllowInsecure {
+		return errors.New("ldap.url must be an ldaps:// url or ldap.start_tls must be enabled to not send passwords in plain text, set ldap.allow_insecure to allow it")
+	}
+	if c.BaseDN == "" {
+		return errors.New("ldap.base_dn is required")
+	}
+	if strings.Count(c.UserFilter, "%s") != 1 {
+		return fmt.Errorf("invalid ldap.user_filter %q, expected exactly one %%s placeholder for the username", c.UserFilter)
+	}
+	if strings.Count(c.GroupFilter, "%s") != 1 {
+		return fmt.Errorf("invalid ldap.group_filter %q, expected exactly one %%s placeholder for the user DN", c.GroupFilter)
+	}
+	if c.GroupAttribute == "" {
+		return errors.New("ldap.group_attribute is required")
+	}
+	if len(c.Groups) == 0 {
+		return errors.New("ldap.groups is required, map at least one LDAP group to an rport group")
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("ldap.timeout cannot be negative, actual: %v", c.Timeout)
+	}
+	if c.BindCacheTTL < 0 {
+		return fmt.Errorf("ldap.bind_cache_ttl cannot be negative, actual: %v", c.BindCacheTTL)
+	}
+	return nil
+}
+
+// PushedClientConfig is a client config the server pushes to all clients at connect time. Empty fields are not pushed.
+type PushedClientConfig struct {
+	KeepAlive     time.Duration `mapstructure:"keep_alive"`
+	SendBackLimit int           `mapstructure:"send_back_limit"`
+}
+
+func (c PushedClientConfig) Payload() comm.PushedConfig {
+	return comm.PushedConfig{
+		KeepAlive: c.KeepAlive,
+		RemoteCommands: comm.PushedCommandsConfig{
+			SendBackLimit: c.SendBackLimit,
+		},
+	}
+}
+
 type SMTPConfig struct {
 	Server       string `mapstructure:"server"`
 	AuthUsername string `mapstructure:"auth_username"`
@@ -219,6 +368,15 @@ type Config struct {
 	Database DatabaseConfig `mapstructure:"database"`
 	Pushover PushoverConfig `mapstructure:"pushover"`
 	SMTP     SMTPConfig     `mapstructure:"smtp"`
+	// PushedClientConfig is pushed to clients at connect time.
+	PushedClientConfig PushedClientConfig `mapstructure:"client-config"`
+	AutoTags           AutoTagsConfig     `mapstructure:"auto-tags"`
+	LDAP               LDAPConfig         `mapstructure:"ldap"`
+}
+
+type AutoTagsConfig struct {
+	// Rules to tag clients by their attributes.
+	Rules []clients.AutoTagRule `mapstructure:"rules"`
 }
 
 func (c *Config) GetVaultDBPath() string {
@@ -263,6 +421,172 @@ func (c *Config) ParseAndValidate() error {
 		return fmt.Errorf("expected 'Keep Lost Clients' can be in range [%v, %v], actual: %v", MinKeepLostClients, MaxKeepLostClients, c.Server.KeepLostClients)
 	}
 
+	if c.Server.MaxConcurrentMultiJobs < 0 {
+		return fmt.Errorf("'max_concurrent_multi_jobs' cannot be negative, actual: %d", c.Server.MaxConcurrentMultiJobs)
+	}
+
+	if c.Server.MaxConcurrentTunnelCopies < 0 {
+		return fmt.Errorf("'max_concurrent_tunnel_copies' cannot be negative, actual: %d", c.Server.MaxConcurrentTunnelCopies)
+	}
+
+	if c.Server.TunnelCopyWait < 0 {
+		return fmt.Errorf("'tunnel_copy_wait' cannot be negative, actual: %v", c.Server.TunnelCopyWait)
+	}
+
+	if c.Server.TunnelReadDeadline < 0 {
+		return fmt.Errorf("'tunnel_read_deadline' cannot be negative, actual: %v", c.Server.TunnelReadDeadline)
+	}
+
+	if c.Server.CleanupClientsJitter < 0 {
+		return fmt.Errorf("'cleanup_clients_jitter' cannot be negative, actual: %v", c.Server.CleanupClientsJitter)
+	}
+
+	if c.Server.CleanupClientsBatchSize < 0 {
+		return fmt.Errorf("'cleanup_clients_batch_size' cannot be negative, actual: %d", c.Server.CleanupClientsBatchSize)
+	}
+
+	if c.Server.ClientSaveWorkers < 0 {
+		return fmt.Errorf("'client_save_workers' cannot be negative, actual: %d", c.Server.ClientSaveWorkers)
+	}
+
+	if c.Server.ClientSaveWorkers > 0 && c.Server.ClientSaveBatchSize <= 0 {
+		return fmt.Errorf("'client_save_batch_size' must be positive, actual: %d", c.Server.ClientSaveBatchSize)
+	}
+
+	if c.Server.TunnelWriteDeadline < 0 {
+		return fmt.Errorf("'tunnel_write_deadline' cannot be negative, actual: %v", c.Server.TunnelWriteDeadline)
+	}
+
+	c.Server.tunnelConnLogLevel = chshare.LogLevelDebug
+	if c.Server.TunnelConnLogLevel != "" {
+		if c.Server.tunnelConnLogLevel, err = chshare.ParseLogLevel(c.Server.TunnelConnLogLevel); err != nil {
+			return fmt.Errorf("invalid 'tunnel_conn_log_level': %v", err)
+		}
+	}
+
+	if c.Server.TunnelConnLogSampleRate < 0 {
+		return fmt.Errorf("'tunnel_conn_log_sample_rate' cannot be negative, actual: %d", c.Server.TunnelConnLogSampleRate)
+	}
+
+	for _, origin := range c.Server.AllowedOrigins {
+		if u, err := url.Parse(origin); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.Trim(u.Path, "/") != "" {
+			return fmt.Errorf("invalid 'allowed_origins' entry %q, expected scheme and host, e.g. https://example.com", origin)
+		}
+	}
+
+	for _, host := range c.Server.AllowedHosts {
+		if host == "" || strings.Contains(host, "/") {
+			return fmt.Errorf("invalid 'allowed_hosts' entry %q, expected a host with an optional port, e.g. example.com:8080", host)
+		}
+	}
+
+	if c.Server.ClientIdleTimeout < 0 {
+		return fmt.Errorf("'client_idle_timeout' cannot be negative, actual: %v", c.Server.ClientIdleTimeout)
+	}
+
+	if err := validateRequiredClientFields(c.Server.RequiredClientFields); err != nil {
+		return fmt.Errorf("invalid 'required_client_fields': %v", err)
+	}
+
+	switch c.Server.MissingClientFieldsAction {
+	case "", MissingClientFieldsReject, MissingClientFieldsWarn:
+	default:
+		return fmt.Errorf("invalid 'missing_client_fields_action' %q, expected %q or %q", c.Server.MissingClientFieldsAction, MissingClientFieldsReject, MissingClientFieldsWarn)
+	}
+
+	if c.Server.ShutdownGracePeriod < 0 {
+		return fmt.Errorf("'shutdown_grace_period' cannot be negative, actual: %v", c.Server.ShutdownGracePeriod)
+	}
+
+	if c.Server.MaxConnAttemptsPerIP < 0 {
+		return fmt.Errorf("'max_conn_attempts_per_ip' cannot be negative, actual: %d", c.Server.MaxConnAttemptsPerIP)
+	}
+
+	if c.Server.MaxConnAttemptsPerIP > 0 {
+		if c.Server.ConnAttemptsInterval <= 0 {
+			return fmt.Errorf("'conn_attempts_interval' must be positive, actual: %v", c.Server.ConnAttemptsInterval)
+		}
+		if c.Server.ConnRateBanTime <= 0 {
+			return fmt.Errorf("'conn_rate_ban_time' must be positive, actual: %v", c.Server.ConnRateBanTime)
+		}
+	}
+
+	if c.Server.MaxChannelsPerClient < 0 {
+		return fmt.Errorf("'max_channels_per_client' cannot be negative, actual: %d", c.Server.MaxChannelsPerClient)
+	}
+
+	if c.Server.MaxJobResultSizeBytes < 0 {
+		return fmt.Errorf("'max_job_result_size_bytes' cannot be negative, actual: %d", c.Server.MaxJobResultSizeBytes)
+	}
+
+	if c.Server.RegistrationHookURL != "" {
+		if u, err := url.Parse(c.Server.RegistrationHookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid 'first_registration_hook_url' %q, expected an http or https URL", c.Server.RegistrationHookURL)
+		}
+	}
+
+	if c.Server.RegistrationHookRetries < 0 {
+		return fmt.Errorf("'first_registration_hook_retries' cannot be negative, actual: %d", c.Server.RegistrationHookRetries)
+	}
+
+	if (c.Server.RegistrationHookURL != "" || c.Server.RegistrationHookCommand != "") && c.Server.RegistrationHookTimeout <= 0 {
+		return fmt.Errorf("'first_registration_hook_timeout' should be greater than 0, actual: %v", c.Server.RegistrationHookTimeout)
+	}
+
+	for _, webhookURL := range c.Server.ClientStateWebhookURLs {
+		if u, err := url.Parse(webhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid 'client_state_webhook_urls' entry %q, expected an http or https URL", webhookURL)
+		}
+	}
+
+	if c.Server.ClientStateWebhookRetries < 0 {
+		return fmt.Errorf("'client_state_webhook_retries' cannot be negative, actual: %d", c.Server.ClientStateWebhookRetries)
+	}
+
+	if len(c.Server.ClientStateWebhookURLs) > 0 && c.Server.ClientStateWebhookTimeout <= 0 {
+		return fmt.Errorf("'client_state_webhook_timeout' should be greater than 0, actual: %v", c.Server.ClientStateWebhookTimeout)
+	}
+
+	if c.Server.KeepJobs < 0 {
+		return fmt.Errorf("'keep_jobs' cannot be negative, actual: %v", c.Server.KeepJobs)
+	}
+
+	if c.Server.KeepAuditLog < 0 {
+		return fmt.Errorf("'keep_audit_log' cannot be negative, actual: %v", c.Server.KeepAuditLog)
+	}
+
+	switch c.Server.JobsDBDriver {
+	case "", jobs.DBDriverSqlite:
+	case jobs.DBDriverPostgres:
+		if c.Server.JobsDBDSN == "" {
+			return fmt.Errorf("'jobs_db_dsn' is required when 'jobs_db_driver' is %q", jobs.DBDriverPostgres)
+		}
+		if c.Server.JobResultsDir != "" {
+			return fmt.Errorf("'job_results_dir' cannot be used when 'jobs_db_driver' is %q, results stored on disk are not available to other servers", jobs.DBDriverPostgres)
+		}
+		if c.Server.NodeID == "" {
+			hostname, err := os.Hostname()
+			if err != nil {
+				return fmt.Errorf("failed to get hostname to use as 'node_id': %v", err)
+			}
+			c.Server.NodeID = hostname
+		}
+	default:
+		return fmt.Errorf("invalid 'jobs_db_driver': %q, expected one of: %q, %q", c.Server.JobsDBDriver, jobs.DBDriverSqlite, jobs.DBDriverPostgres)
+	}
+
+	if _, err := clients.NewAutoTagger(c.AutoTags.Rules); err != nil {
+		return fmt.Errorf("invalid 'auto-tags': %v", err)
+	}
+
+	if c.Server.MaxCachedDisconnectedClients < 0 {
+		return fmt.Errorf("'max_cached_disconnected_clients' cannot be negative, actual: %v", c.Server.MaxCachedDisconnectedClients)
+	}
+
+	if c.Server.PurgeClientsAuthAfter < 0 {
+		return fmt.Errorf("'purge_clients_auth_after' cannot be negative, actual: %v", c.Server.PurgeClientsAuthAfter)
+	}
+
 	if err := c.parseAndValidateClientAuth(); err != nil {
 		return err
 	}
@@ -275,6 +599,10 @@ func (c *Config) ParseAndValidate() error {
 		return err
 	}
 
+	if err := c.PushedClientConfig.Payload().Validate(); err != nil {
+		return fmt.Errorf("client-config: %v", err)
+	}
+
 	return nil
 }
 
@@ -308,6 +636,14 @@ func (c *Config) parseAndValidateClientAuth() error {
 }
 
 func (c *Config) parseAndValidateAPI() error {
+	if c.API.RequestTimeout < 0 {
+		return fmt.Errorf("'request_timeout' cannot be negative, actual: %v", c.API.RequestTimeout)
+	}
+
+	if c.API.MaxClientsPageLimit < 0 {
+		return fmt.Errorf("'max_clients_page_limit' cannot be negative, actual: %d", c.API.MaxClientsPageLimit)
+	}
+
 	if c.API.Address != "" {
 		// API enabled
 		err := c.parseAndValidateAPIAuth()
@@ -319,6 +655,9 @@ func (c *Config) parseAndValidateAPI() error {
 			return err
 		}
 		if c.API.JWTSecret == "" {
+			if c.API.PersistSessions {
+				return errors.New("'persist_sessions' requires 'jwt_secret' to be set, a generated secret changes on every restart")
+			}
 			c.API.JWTSecret, err = generateJWTSecret()
 			if err != nil {
 				return err
@@ -347,8 +686,14 @@ func (c *Config) parseAndValidate2FA() error {
 		return errors.New("2FA is not available if you use a single static user-password pair")
 	}
 
+	if c.LDAP.URL != "" {
+		return errors.New("2FA is not available if you use LDAP authentication")
+	}
+
 	// TODO: to do better handling, maybe with using enums
 	switch c.API.TwoFATokenDelivery {
+	case "totp":
+		return nil
 	case "pushover":
 		return c.Pushover.Validate()
 	case "smtp":
@@ -364,8 +709,15 @@ func (c *Config) parseAndValidate2FA() error {
 }
 
 func (c *Config) parseAndValidateAPIAuth() error {
+	if c.LDAP.URL != "" {
+		if c.API.AuthFile != "" || c.API.Auth != "" || c.API.AuthUserTable != "" {
+			return errors.New("'ldap.url' and one of 'auth', 'auth_file' or 'auth_user_table' are set: expected only one of them")
+		}
+		return c.LDAP.Validate()
+	}
+
 	if c.API.AuthFile == "" && c.API.Auth == "" && c.API.AuthUserTable == "" {
-		return errors.New("authentication must be enabled: set either 'auth', 'auth_file' or 'auth_user_table'")
+		return errors.New("authentication must be enabled: set either 'auth', 'auth_file', 'auth_user_table' or 'ldap.url'")
 	}
 
 	if c.API.AuthFile != "" && c.API.Auth != "" {
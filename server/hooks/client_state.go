@@ -0,0 +1,132 @@
+package hooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	chshare "github.com/cloudradar-monitoring/rport/share"
+)
+
+const (
+	ClientStateConnected    = "connected"
+	ClientStateDisconnected = "disconnected"
+	// ClientStateDeleted is sent when an obsolete disconnected client is deleted
+	ClientStateDeleted = "deleted"
+)
+
+// SignatureHeader holds a hex encoded HMAC-SHA256 of a webhook body computed with a shared secret, prefixed with "sha256=".
+const SignatureHeader = "X-Rport-Signature"
+
+// ClientStateEvent is a payload of a client state webhook.
+type ClientStateEvent struct {
+	ClientID   string    `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Tags       []string  `json:"tags"`
+	AutoTags   []string  `json:"auto_tags"`
+	State      string    `json:"state"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// clientStateWebhookWorkers is a number of goroutines delivering client state webhooks and clientStateWebhookQueueSize
+// is a number of deliveries waiting for a free worker, further events are dropped. They're vars to override in tests.
+var (
+	clientStateWebhookWorkers   = 4
+	clientStateWebhookQueueSize = 1000
+)
+
+// ClientStateWebhook notifies HTTP endpoints when clients connect, disconnect or are deleted.
+type ClientStateWebhook struct {
+	urls    []string
+	secret  string
+	retries int
+	queue   chan clientStateDelivery
+
+	httpClient *http.Client
+	logger     *chshare.Logger
+}
+
+type clientStateDelivery struct {
+	url       string
+	prefix    string
+	payload   []byte
+	signature string
+}
+
+// NewClientStateWebhook returns a webhook calling given URLs, nil if there are none. Bodies are signed with a given
+// secret unless it's empty.
+func NewClientStateWebhook(urls []string, secret string, retries int, timeout time.Duration, logger *chshare.Logger) *ClientStateWebhook {
+	if len(urls) == 0 {
+		return nil
+	}
+	h := &ClientStateWebhook{
+		urls:       urls,
+		secret:     secret,
+		retries:    retries,
+		queue:      make(chan clientStateDelivery, clientStateWebhookQueueSize),
+		httpClient: &http.Client{Timeout: timeout},
+		logger:     logger,
+	}
+	for i := 0; i < clientStateWebhookWorkers; i++ {
+		go h.deliver()
+	}
+	return h
+}
+
+// String returns the webhook URLs, the secret is never included.
+func (h *ClientStateWebhook) String() string {
+	return fmt.Sprintf("client state webhook %v", h.urls)
+}
+
+// Fire queues a given event to be posted to all URLs in background. Failed calls are retried up to the configured
+// number of retries. The event is dropped if the queue is full.
+func (h *ClientStateWebhook) Fire(event *ClientStateEvent) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		h.logger.Errorf("client_id=%q, Failed to encode client state webhook payload: %v", event.ClientID, err)
+		return
+	}
+	signature := Sign(payload, h.secret)
+
+	for _, url := range h.urls {
+		prefix := fmt.Sprintf("client_id=%q, Client %s webhook %s", event.ClientID, event.State, url)
+		select {
+		case h.queue <- clientStateDelivery{url: url, prefix: prefix, payload: payload, signature: signature}:
+		default:
+			h.logger.Errorf("%s dropped, too many webhooks are pending.", prefix)
+		}
+	}
+}
+
+func (h *ClientStateWebhook) deliver() {
+	for d := range h.queue {
+		d := d
+		runWithRetries(h.logger, d.prefix, h.retries, func() error { return h.post(d.url, d.payload, d.signature) })
+	}
+}
+
+func (h *ClientStateWebhook) post(url string, payload []byte, signature string) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	if signature != "" {
+		req.Header.Set(SignatureHeader, signature)
+	}
+	return doPost(h.httpClient, req)
+}
+
+// Sign returns a value of SignatureHeader for a given body, empty if a given secret is empty.
+func Sign(body []byte, secret string) string {
+	if secret == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,144 @@
+package hooks
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewClientStateWebhookNotConfigured(t *testing.T) {
+	assert.Nil(t, NewClientStateWebhook(nil, "secret", 3, time.Second, testLog))
+}
+
+func TestClientStateWebhook(t *testing.T) {
+	defer func(d time.Duration) { retryInterval = d }(retryInterval)
+	retryInterval = time.Millisecond
+
+	testCases := []struct {
+		name          string
+		secret        string
+		failures      int32
+		wantSignature string
+	}{
+		{
+			name:          "signed",
+			secret:        "shared-secret",
+			wantSignature: "sha256=c1dffcf3dae1f7bce0f2b84e012239fd90e4ab3082e0fe88351fb64f18a9e207",
+		},
+		{
+			name:     "not signed, retried",
+			failures: 1,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			type delivery struct {
+				body      string
+				signature string
+			}
+			var attempts int32
+			deliveries := make(chan delivery, 10)
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&attempts, 1) <= tc.failures {
+					w.WriteHeader(http.StatusBadGateway)
+					return
+				}
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+				body, err := ioutil.ReadAll(r.Body)
+				assert.NoError(t, err)
+				deliveries <- delivery{body: string(body), signature: r.Header.Get(SignatureHeader)}
+			})
+			srv1 := httptest.NewServer(handler)
+			defer srv1.Close()
+			srv2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := ioutil.ReadAll(r.Body)
+				assert.NoError(t, err)
+				deliveries <- delivery{body: string(body), signature: r.Header.Get(SignatureHeader)}
+			}))
+			defer srv2.Close()
+
+			h := NewClientStateWebhook([]string{srv1.URL, srv2.URL}, tc.secret, 2, time.Second, testLog)
+			h.Fire(&ClientStateEvent{
+				ClientID:   "client-1",
+				ClientName: "Client 1",
+				Tags:       []string{"prod"},
+				State:      ClientStateDisconnected,
+				Timestamp:  time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC),
+			})
+
+			wantBody := `{"client_id":"client-1","client_name":"Client 1","tags":["prod"],"auto_tags":null,"state":"disconnected","timestamp":"2021-06-01T12:00:00Z"}`
+			for i := 0; i < 2; i++ {
+				select {
+				case got := <-deliveries:
+					assert.JSONEq(t, wantBody, got.body)
+					assert.Equal(t, Sign([]byte(got.body), tc.secret), got.signature)
+					assert.Equal(t, tc.wantSignature, got.signature)
+				case <-time.After(5 * time.Second):
+					require.Fail(t, "webhook is not called")
+				}
+			}
+			assert.Equal(t, tc.failures+1, atomic.LoadInt32(&attempts))
+		})
+	}
+}
+
+func TestSign(t *testing.T) {
+	assert.Equal(t, "", Sign([]byte("body"), ""))
+	// echo -n body | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "sha256=dc46983557fea127b43af721467eb9b3fde2338fe3e14f51952aa8478c13d355", Sign([]byte("body"), "secret"))
+}
+
+func TestClientStateWebhookDropsEventsWhenQueueIsFull(t *testing.T) {
+	defer func(workers, size int) {
+		clientStateWebhookWorkers, clientStateWebhookQueueSize = workers, size
+	}(clientStateWebhookWorkers, clientStateWebhookQueueSize)
+	clientStateWebhookWorkers = 1
+	clientStateWebhookQueueSize = 1
+
+	received := make(chan string, 10)
+	unblock := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		received <- string(body)
+		<-unblock
+	}))
+	defer srv.Close()
+	defer close(unblock)
+
+	h := NewClientStateWebhook([]string{srv.URL}, "", 0, 5*time.Second, testLog)
+	h.Fire(&ClientStateEvent{ClientID: "client-1"})
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "webhook is not called")
+	}
+
+	// the only worker is busy, so the second event waits in the queue and the third one is dropped
+	h.Fire(&ClientStateEvent{ClientID: "client-2"})
+	h.Fire(&ClientStateEvent{ClientID: "client-3"})
+	assert.Len(t, h.queue, 1)
+
+	unblock <- struct{}{}
+	select {
+	case got := <-received:
+		assert.Contains(t, got, "client-2")
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "queued webhook is not called")
+	}
+	unblock <- struct{}{}
+	select {
+	case got := <-received:
+		assert.Failf(t, "dropped webhook is called", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
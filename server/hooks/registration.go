@@ -0,0 +1,128 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"time"
+
+	chshare "github.com/cloudradar-monitoring/rport/share"
+)
+
+const outputLimit = 1024
+
+// retryInterval is a delay before the first retry of a failed hook, it's doubled on each next retry. It's a var to override in tests.
+var retryInterval = 5 * time.Second
+
+// RegistrationHook notifies an HTTP endpoint and/or runs a local command when a client connects for the first time.
+type RegistrationHook struct {
+	url     string
+	command string
+	retries int
+	timeout time.Duration
+
+	httpClient *http.Client
+	logger     *chshare.Logger
+}
+
+// NewRegistrationHook returns a hook calling a given URL and/or command, nil if none of them is set.
+func NewRegistrationHook(url, command string, retries int, timeout time.Duration, logger *chshare.Logger) *RegistrationHook {
+	if url == "" && command == "" {
+		return nil
+	}
+	return &RegistrationHook{
+		url:        url,
+		command:    command,
+		retries:    retries,
+		timeout:    timeout,
+		httpClient: &http.Client{Timeout: timeout},
+		logger:     logger,
+	}
+}
+
+// Fire sends given client details encoded as JSON in background. A failed call is retried up to the configured number of retries.
+func (h *RegistrationHook) Fire(clientID string, details interface{}) {
+	payload, err := json.Marshal(details)
+	if err != nil {
+		h.logger.Errorf("client_id=%q, Failed to encode registration hook payload: %v", clientID, err)
+		return
+	}
+
+	if h.url != "" {
+		go h.run(clientID, "URL "+h.url, func() error { return h.post(payload) })
+	}
+	if h.command != "" {
+		go h.run(clientID, "command "+h.command, func() error { return h.exec(payload) })
+	}
+}
+
+func (h *RegistrationHook) run(clientID, target string, call func() error) {
+	runWithRetries(h.logger, fmt.Sprintf("client_id=%q, Registration hook %s", clientID, target), h.retries, call)
+}
+
+// runWithRetries calls a given function until it succeeds or the number of retries is exceeded, the delay between
+// retries starts at retryInterval and is doubled each time. Results are logged with a given prefix.
+func runWithRetries(logger *chshare.Logger, prefix string, retries int, call func() error) {
+	wait := retryInterval
+	for attempt := 0; ; attempt++ {
+		err := call()
+		if err == nil {
+			logger.Debugf("%s succeeded.", prefix)
+			return
+		}
+		if attempt >= retries {
+			logger.Errorf("%s failed after %d attempt(s): %v", prefix, attempt+1, err)
+			return
+		}
+		logger.Infof("%s failed, retrying in %s: %v", prefix, wait, err)
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+func (h *RegistrationHook) post(payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, h.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	return doPost(h.httpClient, req)
+}
+
+// doPost sends a given request with a JSON body, a non-2xx response is an error.
+func doPost(httpClient *http.Client, req *http.Request) error {
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, outputLimit))
+		return fmt.Errorf("unexpected status code %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+func (h *RegistrationHook) exec(payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.timeout)
+	defer cancel()
+
+	stderr := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, h.command)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		if stderr.Len() > 0 {
+			return fmt.Errorf("%v: %s", err, bytes.TrimSpace(stderr.Next(outputLimit)))
+		}
+		return err
+	}
+	return nil
+}
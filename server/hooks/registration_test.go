@@ -0,0 +1,121 @@
+package hooks
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	chshare "github.com/cloudradar-monitoring/rport/share"
+)
+
+var testLog = chshare.NewLogger("hooks", chshare.LogOutput{File: os.Stdout}, chshare.LogLevelDebug)
+
+type testDetails struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestNewRegistrationHookNotConfigured(t *testing.T) {
+	assert.Nil(t, NewRegistrationHook("", "", 3, time.Second, testLog))
+}
+
+func TestRegistrationHookURL(t *testing.T) {
+	defer func(d time.Duration) { retryInterval = d }(retryInterval)
+	retryInterval = time.Millisecond
+
+	testCases := []struct {
+		name         string
+		failures     int32
+		retries      int
+		wantAttempts int32
+		wantBodies   int
+	}{
+		{
+			name:         "success",
+			retries:      2,
+			wantAttempts: 1,
+			wantBodies:   1,
+		},
+		{
+			name:         "success after retries",
+			failures:     2,
+			retries:      2,
+			wantAttempts: 3,
+			wantBodies:   1,
+		},
+		{
+			name:         "retries exceeded",
+			failures:     5,
+			retries:      2,
+			wantAttempts: 3,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			var attempts int32
+			bodies := make(chan string, 10)
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&attempts, 1) <= tc.failures {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				assert.Equal(t, http.MethodPost, r.Method)
+				assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+				body, err := ioutil.ReadAll(r.Body)
+				assert.NoError(t, err)
+				bodies <- string(body)
+			}))
+			defer srv.Close()
+
+			h := NewRegistrationHook(srv.URL, "", tc.retries, time.Second, testLog)
+			h.Fire("client-1", testDetails{ID: "client-1", Name: "Client 1"})
+
+			assert.Eventually(t, func() bool { return atomic.LoadInt32(&attempts) == tc.wantAttempts }, 5*time.Second, 10*time.Millisecond)
+			// no more attempts follow
+			time.Sleep(50 * time.Millisecond)
+			assert.Equal(t, tc.wantAttempts, atomic.LoadInt32(&attempts))
+			require.Len(t, bodies, tc.wantBodies)
+			if tc.wantBodies > 0 {
+				assert.JSONEq(t, `{"id":"client-1","name":"Client 1"}`, <-bodies)
+			}
+		})
+	}
+}
+
+func TestRegistrationHookCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test hook is a shell script")
+	}
+	defer func(d time.Duration) { retryInterval = d }(retryInterval)
+	retryInterval = time.Millisecond
+
+	dir, err := ioutil.TempDir("", "registration-hook")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	outFile := filepath.Join(dir, "out.json")
+	command := filepath.Join(dir, "hook.sh")
+	// fails on the first run, saves the payload on the second one
+	script := "#!/bin/sh\nif [ ! -f " + outFile + ".1 ]; then touch " + outFile + ".1; echo not ready >&2; exit 1; fi\ncat > " + outFile + "\n"
+	require.NoError(t, ioutil.WriteFile(command, []byte(script), 0700))
+
+	h := NewRegistrationHook("", command, 1, time.Second, testLog)
+	h.Fire("client-1", testDetails{ID: "client-1", Name: "Client 1"})
+
+	var got []byte
+	require.Eventually(t, func() bool {
+		got, err = ioutil.ReadFile(outFile)
+		return err == nil && len(got) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.JSONEq(t, `{"id":"client-1","name":"Client 1"}`, string(got))
+}
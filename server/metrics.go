@@ -0,0 +1,126 @@
+package chserver
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+
+	"github.com/cloudradar-monitoring/rport/share/models"
+)
+
+const metricsNamespace = "rport"
+
+// serverMetrics holds Prometheus metrics of the server.
+type serverMetrics struct {
+	registry        *prometheus.Registry
+	jobsCreated     prometheus.Counter
+	requestDuration *prometheus.HistogramVec
+}
+
+func newServerMetrics(clientService *ClientService, jobProvider JobProvider) *serverMetrics {
+	m := &serverMetrics{
+		registry: prometheus.NewRegistry(),
+		jobsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "jobs_created_total",
+			Help:      "Number of jobs created since the server start.",
+		}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "api_request_duration_seconds",
+			Help:      "Latency of API requests.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "code"}),
+	}
+	m.registry.MustRegister(
+		m.jobsCreated,
+		m.requestDuration,
+		&stateCollector{clientService: clientService, jobProvider: jobProvider},
+	)
+	return m
+}
+
+// handler returns a handler that serves the metrics in the Prometheus exposition format.
+func (m *serverMetrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// instrumentRoutes observes durations of requests to all routes of a given router. Routes are labeled by their path
+// template to keep the number of label values low.
+func (m *serverMetrics) instrumentRoutes(router *mux.Router) {
+	_ = router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		tmpl, err := route.GetPathTemplate()
+		if err != nil || route.GetHandler() == nil {
+			return nil
+		}
+		obs := m.requestDuration.MustCurryWith(prometheus.Labels{"route": tmpl})
+		route.Handler(promhttp.InstrumentHandlerDuration(obs, route.GetHandler()))
+		return nil
+	})
+}
+
+// countCreatedJobs returns a job provider that counts created jobs.
+func (m *serverMetrics) countCreatedJobs(p JobProvider) JobProvider {
+	return &jobsCreatedCounter{JobProvider: p, counter: m.jobsCreated}
+}
+
+type jobsCreatedCounter struct {
+	JobProvider
+	counter prometheus.Counter
+}
+
+func (p *jobsCreatedCounter) CreateJob(job *models.Job) error {
+	if err := p.JobProvider.CreateJob(job); err != nil {
+		return err
+	}
+	p.counter.Inc()
+	return nil
+}
+
+var (
+	clientsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "clients"),
+		"Number of clients by connection state.",
+		[]string{"state"}, nil,
+	)
+	jobsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "", "jobs"),
+		"Number of stored jobs by status.",
+		[]string{"status"}, nil,
+	)
+)
+
+// stateCollector reads current numbers of clients and jobs on each scrape.
+type stateCollector struct {
+	clientService *ClientService
+	jobProvider   JobProvider
+}
+
+func (c *stateCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- clientsDesc
+	ch <- jobsDesc
+}
+
+func (c *stateCollector) Collect(ch chan<- prometheus.Metric) {
+	if n, err := c.clientService.CountActive(); err != nil {
+		ch <- prometheus.NewInvalidMetric(clientsDesc, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(clientsDesc, prometheus.GaugeValue, float64(n), "connected")
+	}
+	if n, err := c.clientService.CountDisconnected(); err != nil {
+		ch <- prometheus.NewInvalidMetric(clientsDesc, err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(clientsDesc, prometheus.GaugeValue, float64(n), "disconnected")
+	}
+
+	counts, err := c.jobProvider.CountByStatus()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(jobsDesc, err)
+		return
+	}
+	for _, status := range []string{models.JobStatusRunning, models.JobStatusSuccessful, models.JobStatusFailed, models.JobStatusUnknown, models.JobStatusCanceled} {
+		ch <- prometheus.MustNewConstMetric(jobsDesc, prometheus.GaugeValue, float64(counts[status]), status)
+	}
+}
@@ -0,0 +1,135 @@
+package chserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/rport/server/api"
+	"github.com/cloudradar-monitoring/rport/server/api/jobs"
+	"github.com/cloudradar-monitoring/rport/server/api/users"
+	"github.com/cloudradar-monitoring/rport/server/clients"
+	"github.com/cloudradar-monitoring/rport/server/test/jb"
+	"github.com/cloudradar-monitoring/rport/share/models"
+	"github.com/cloudradar-monitoring/rport/share/security"
+)
+
+func TestMetrics(t *testing.T) {
+	admin := &users.User{
+		Username: "admin",
+		Groups:   []string{users.Administrators},
+	}
+	c1 := clients.New(t).ID("client-1").Build()
+	c2 := clients.New(t).ID("client-2").Build()
+	c3 := clients.New(t).ID("client-3").DisconnectedDuration(5 * time.Minute).Build()
+	clientService := NewClientService(nil, clients.NewClientRepository([]*clients.Client{c1, c2, c3}, &hour, testLog))
+
+	jp, err := jobs.NewSqliteProvider(":memory:", testLog)
+	require.NoError(t, err)
+	defer jp.Close()
+	require.NoError(t, jp.SaveJob(jb.New(t).Status(models.JobStatusFailed).Build()))
+
+	metrics := newServerMetrics(clientService, jp)
+	jobProvider := metrics.countCreatedJobs(jp)
+	require.NoError(t, jobProvider.CreateJob(jb.New(t).Status(models.JobStatusRunning).Build()))
+	require.NoError(t, jobProvider.CreateJob(jb.New(t).Status(models.JobStatusRunning).Build()))
+
+	al := APIListener{
+		insecureForTests: true,
+		Server: &Server{
+			clientService: clientService,
+			config:        &Config{},
+			jobProvider:   jobProvider,
+			metrics:       metrics,
+		},
+		userService: users.NewAPIService(users.NewStaticProvider([]*users.User{admin}), false),
+		Logger:      testLog,
+	}
+	al.initRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/clients", nil)
+	req = req.WithContext(api.WithUser(context.Background(), admin.Username))
+	w := httptest.NewRecorder()
+	al.router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	al.router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `rport_clients{state="connected"} 2`)
+	assert.Contains(t, body, `rport_clients{state="disconnected"} 1`)
+	assert.Contains(t, body, `rport_jobs_created_total 2`)
+	assert.Contains(t, body, `rport_jobs{status="running"} 2`)
+	assert.Contains(t, body, `rport_jobs{status="failed"} 1`)
+	assert.Contains(t, body, `rport_jobs{status="successful"} 0`)
+	assert.Contains(t, body, `rport_api_request_duration_seconds_count{code="200",method="get",route="/api/v1/clients"} 1`)
+}
+
+func TestMetricsRequireAuth(t *testing.T) {
+	clientService := NewClientService(nil, clients.NewClientRepository(nil, &hour, testLog))
+	jp, err := jobs.NewSqliteProvider(":memory:", testLog)
+	require.NoError(t, err)
+	defer jp.Close()
+
+	testCases := []struct {
+		name           string
+		metrics        *serverMetrics
+		withAuth       bool
+		wantStatusCode int
+	}{
+		{
+			name:           "metrics enabled, authorized",
+			metrics:        newServerMetrics(clientService, jp),
+			withAuth:       true,
+			wantStatusCode: http.StatusOK,
+		},
+		{
+			name:           "metrics enabled, unauthorized",
+			metrics:        newServerMetrics(clientService, jp),
+			wantStatusCode: http.StatusUnauthorized,
+		},
+		{
+			name:           "metrics disabled",
+			wantStatusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			al := APIListener{
+				Server: &Server{
+					clientService: clientService,
+					config: &Config{
+						API: APIConfig{
+							Auth: "admin:foobaz",
+						},
+					},
+					jobProvider: jp,
+					metrics:     tc.metrics,
+				},
+				apiSessionRepo: NewAPISessionRepository(),
+				bannedUsers:    security.NewBanList(0),
+				userService:    users.NewAPIService(users.NewStaticProvider([]*users.User{{Username: "admin", Password: "foobaz"}}), false),
+				Logger:         testLog,
+			}
+			al.initRouter()
+
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tc.withAuth {
+				req.SetBasicAuth("admin", "foobaz")
+			}
+			w := httptest.NewRecorder()
+			al.router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.wantStatusCode, w.Code)
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronField is a range of valid values of a single field of a cron expression.
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	{name: "day of week", min: 0, max: 7},
+}
+
+// Cron is a parsed standard cron expression of 5 fields: minute, hour, day of month, month and day of week.
+// Each field accepts '*', single values, ranges 'a-b', steps '*/n' or 'a-b/n' and comma separated lists of them.
+// Day of week is 0-7, both 0 and 7 are Sunday.
+type Cron struct {
+	minutes, hours, days, months, weekdays map[int]bool
+	// anyDay and anyWeekday are set if the field is '*'. Like in cron, if both day fields are restricted,
+	// a time matches if either of them matches.
+	anyDay, anyWeekday bool
+}
+
+// ParseCron parses a given cron expression.
+func ParseCron(spec string) (*Cron, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("invalid cron expression %q: expected %d fields, got %d", spec, len(cronFields), len(parts))
+	}
+
+	values := make([]map[int]bool, len(parts))
+	for i, part := range parts {
+		v, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron expression %q: %v", spec, err)
+		}
+		values[i] = v
+	}
+
+	// Sunday can be set as 7
+	if values[4][7] {
+		values[4][0] = true
+	}
+
+	return &Cron{
+		minutes:    values[0],
+		hours:      values[1],
+		days:       values[2],
+		months:     values[3],
+		weekdays:   values[4],
+		anyDay:     parts[2] == "*",
+		anyWeekday: parts[4] == "*",
+	}, nil
+}
+
+func parseCronField(s string, field cronField) (map[int]bool, error) {
+	res := make(map[int]bool)
+	for _, item := range strings.Split(s, ",") {
+		rng, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			var err error
+			rng = item[:i]
+			step, err = strconv.Atoi(item[i+1:])
+			if err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step %q of %s", item[i+1:], field.name)
+			}
+		}
+
+		from, to := field.min, field.max
+		if rng != "*" {
+			var err error
+			bounds := strings.SplitN(rng, "-", 2)
+			from, err = parseCronValue(bounds[0], field)
+			if err != nil {
+				return nil, err
+			}
+			to = from
+			if len(bounds) == 2 {
+				to, err = parseCronValue(bounds[1], field)
+				if err != nil {
+					return nil, err
+				}
+			} else if step > 1 {
+				// 'a/n' means from a to the max
+				to = field.max
+			}
+			if from > to {
+				return nil, fmt.Errorf("invalid range %q of %s", rng, field.name)
+			}
+		}
+
+		for v := from; v <= to; v += step {
+			res[v] = true
+		}
+	}
+	return res, nil
+}
+
+func parseCronValue(s string, field cronField) (int, error) {
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q of %s", s, field.name)
+	}
+	if v < field.min || v > field.max {
+		return 0, fmt.Errorf("value %d of %s is out of range %d-%d", v, field.name, field.min, field.max)
+	}
+	return v, nil
+}
+
+// Match returns true if a given time matches the expression. Seconds are ignored.
+func (c *Cron) Match(t time.Time) bool {
+	if !c.minutes[t.Minute()] || !c.hours[t.Hour()] || !c.months[int(t.Month())] {
+		return false
+	}
+
+	dayMatch := c.days[t.Day()]
+	weekdayMatch := c.weekdays[int(t.Weekday())]
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return weekdayMatch
+	case c.anyWeekday:
+		return dayMatch
+	}
+	return dayMatch || weekdayMatch
+}
@@ -0,0 +1,77 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCron(t *testing.T) {
+	testCases := []struct {
+		spec    string
+		wantErr string
+	}{
+		{spec: "* * * * *"},
+		{spec: "*/5 0-6,22-23 1,15 */2 1-5"},
+		{spec: "0 12 * * 7"},
+		{spec: "5/15 * * * *"},
+		{spec: "* * * *", wantErr: `invalid cron expression "* * * *": expected 5 fields, got 4`},
+		{spec: "60 * * * *", wantErr: `invalid cron expression "60 * * * *": value 60 of minute is out of range 0-59`},
+		{spec: "* * 0 * *", wantErr: `invalid cron expression "* * 0 * *": value 0 of day of month is out of range 1-31`},
+		{spec: "*/0 * * * *", wantErr: `invalid cron expression "*/0 * * * *": invalid step "0" of minute`},
+		{spec: "* 5-1 * * *", wantErr: `invalid cron expression "* 5-1 * * *": invalid range "5-1" of hour`},
+		{spec: "* * * jan *", wantErr: `invalid cron expression "* * * jan *": invalid value "jan" of month`},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.spec, func(t *testing.T) {
+			_, err := ParseCron(tc.spec)
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestCronMatch(t *testing.T) {
+	// 2021-03-01 is Monday
+	monday := time.Date(2021, 3, 1, 10, 30, 45, 0, time.UTC)
+	sunday := time.Date(2021, 3, 7, 10, 30, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name string
+		spec string
+		time time.Time
+		want bool
+	}{
+		{name: "every minute", spec: "* * * * *", time: monday, want: true},
+		{name: "step matches", spec: "*/15 * * * *", time: monday, want: true},
+		{name: "step doesn't match", spec: "*/20 * * * *", time: monday, want: false},
+		{name: "start with step", spec: "0/10 10 * * *", time: monday, want: true},
+		{name: "list and range", spec: "30 8-9,10 * * *", time: monday, want: true},
+		{name: "other hour", spec: "30 11 * * *", time: monday, want: false},
+		{name: "weekday only", spec: "30 10 * * 1-5", time: monday, want: true},
+		{name: "weekend only", spec: "30 10 * * 0,6", time: monday, want: false},
+		{name: "sunday as 7", spec: "30 10 * * 7", time: sunday, want: true},
+		{name: "sunday as 0", spec: "30 10 * * 0", time: sunday, want: true},
+		{name: "day of month", spec: "30 10 1 * *", time: monday, want: true},
+		{name: "other month", spec: "30 10 1 4 *", time: monday, want: false},
+		{name: "day or weekday", spec: "30 10 15 * 1", time: monday, want: true},
+		{name: "neither day nor weekday", spec: "30 10 15 * 2", time: monday, want: false},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			c, err := ParseCron(tc.spec)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.want, c.Match(tc.time))
+		})
+	}
+}
@@ -2,6 +2,7 @@ package scheduler
 
 import (
 	"context"
+	"math/rand"
 	"time"
 
 	chshare "github.com/cloudradar-monitoring/rport/share"
@@ -26,3 +27,25 @@ func Run(ctx context.Context, log *chshare.Logger, task Task, interval time.Dura
 		}
 	}
 }
+
+// RunWithJitter runs the given task periodically like Run, but waits a random delay up to a given jitter in addition
+// to the interval before each execution, so that tasks started at the same time don't run in lockstep.
+func RunWithJitter(ctx context.Context, log *chshare.Logger, task Task, interval, jitter time.Duration) {
+	if jitter <= 0 {
+		Run(ctx, log, task, interval)
+		return
+	}
+
+	for {
+		timer := time.NewTimer(interval + time.Duration(rand.Int63n(int64(jitter))))
+		select {
+		case <-timer.C:
+			if err := task.Run(ctx); err != nil {
+				log.Errorf("Task %T finished with an error: %v.", task, err)
+			}
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
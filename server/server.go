@@ -2,10 +2,16 @@ package chserver
 
 import (
 	"context"
+	"crypto/ed25519"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"os"
+	"os/signal"
 	"path"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/jmoiron/sqlx"
@@ -17,9 +23,11 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 
 	"github.com/cloudradar-monitoring/rport/server/api/jobs"
+	"github.com/cloudradar-monitoring/rport/server/auditlog"
 	"github.com/cloudradar-monitoring/rport/server/cgroups"
 	"github.com/cloudradar-monitoring/rport/server/clients"
 	"github.com/cloudradar-monitoring/rport/server/clientsauth"
+	"github.com/cloudradar-monitoring/rport/server/hooks"
 	"github.com/cloudradar-monitoring/rport/server/ports"
 	"github.com/cloudradar-monitoring/rport/server/scheduler"
 	chshare "github.com/cloudradar-monitoring/rport/share"
@@ -28,6 +36,14 @@ import (
 	"github.com/cloudradar-monitoring/rport/share/ws"
 )
 
+const (
+	jobsCleanupInterval        = time.Hour
+	auditLogCleanupInterval    = time.Hour
+	apiSessionsCleanupInterval = 10 * time.Minute
+	shutdownJobsPollInterval   = 100 * time.Millisecond
+	errMsgServerShuttingDown   = "server shutting down"
+)
+
 // Server represents a rport service
 type Server struct {
 	*chshare.Logger
@@ -37,11 +53,24 @@ type Server struct {
 	clientService       *ClientService
 	clientProvider      clients.ClientProvider
 	clientAuthProvider  clientsauth.Provider
+	clientsAuthPurge    *ClientsAuthPurgeTask
 	jobProvider         JobProvider
+	scheduleProvider    ScheduleProvider
+	jobsCleanupTask     *jobs.CleanupTask
 	clientGroupProvider cgroups.ClientGroupProvider
 	db                  *sqlx.DB
-	uiJobWebSockets     ws.WebSocketCache // used to push job result to UI
-	jobsDoneChannel     jobResultChanMap  // used for sequential command execution to know when command is finished
+	uiJobWebSockets     ws.WebSocketCache  // used to push job result to UI
+	jobsDoneChannel     jobResultChanMap   // used for sequential command execution to know when command is finished
+	jobOutputChannels   jobOutputChanMap   // used to stream output of running jobs to UI
+	dispatchedJobs      jobIDSet           // ids of jobs sent to clients by this process and not finished yet
+	updatesStatusChans  updatesChanMap     // used to wait for fresh updates status of clients
+	commandSigningKey   ed25519.PrivateKey // used to sign commands sent to clients, nil if signing is disabled
+	metrics             *serverMetrics     // nil if metrics are disabled
+	started             int32              // set to 1 once the server accepts client connections
+
+	shutdownOnce sync.Once
+	shutdownErr  error
+	shuttingDown int32
 }
 
 // NewServer creates and returns a new rport server
@@ -52,7 +81,8 @@ func NewServer(config *Config, filesAPI files.FileAPI) (*Server, error) {
 		config:          config,
 		uiJobWebSockets: ws.NewWebSocketCache(),
 		jobsDoneChannel: jobResultChanMap{
-			m: make(map[string]chan *models.Job),
+			m:     make(map[string]chan *models.Job),
+			limit: config.Server.MaxConcurrentMultiJobs,
 		},
 	}
 
@@ -63,6 +93,14 @@ func NewServer(config *Config, filesAPI files.FileAPI) (*Server, error) {
 	fingerprint := chshare.FingerprintKey(privateKey.PublicKey())
 	s.Infof("Fingerprint %s", fingerprint)
 
+	if config.Server.CommandSigningKey != "" {
+		s.commandSigningKey, err = models.ReadEd25519PrivateKey(config.Server.CommandSigningKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid 'command_signing_key': %v", err)
+		}
+		s.Infof("Commands sent to clients will be signed")
+	}
+
 	s.Infof("data directory path: %q", config.Server.DataDir)
 	if config.Server.DataDir == "" {
 		return nil, errors.New("data directory cannot be empty")
@@ -80,23 +118,41 @@ func NewServer(config *Config, filesAPI files.FileAPI) (*Server, error) {
 		s.Errorf("Failed to store fingerprint %q in file %q: %v", fingerprint, fingerprintFile, err)
 	}
 
-	s.jobProvider, err = jobs.NewSqliteProvider(path.Join(config.Server.DataDir, "jobs.db"), s.Logger)
+	var jobProvider *jobs.SQLProvider
+	if config.Server.JobsDBDriver == jobs.DBDriverPostgres {
+		jobProvider, err = jobs.NewPostgresProvider(config.Server.JobsDBDSN, s.Logger)
+	} else {
+		jobProvider, err = jobs.NewSqliteProvider(path.Join(config.Server.DataDir, "jobs.db"), s.Logger)
+	}
 	if err != nil {
 		return nil, err
 	}
+	if config.Server.JobResultsDir != "" {
+		if err := jobProvider.WithResultsDir(config.Server.JobResultsDir); err != nil {
+			jobProvider.Close()
+			return nil, err
+		}
+	}
+	jobProvider.WithNodeID(config.Server.NodeID)
+	s.jobProvider = jobProvider
+	s.scheduleProvider = jobProvider
+	if config.Server.KeepJobs > 0 {
+		s.jobsCleanupTask = jobs.NewCleanupTask(s.Logger, jobProvider, config.Server.KeepJobs)
+	}
 
 	s.clientGroupProvider, err = cgroups.NewSqliteProvider(path.Join(config.Server.DataDir, "client_groups.db"))
 	if err != nil {
 		return nil, err
 	}
 
-	s.clientProvider, err = clients.NewSqliteProvider(
+	clientProvider, err := clients.NewSqliteProvider(
 		path.Join(config.Server.DataDir, "clients.db"),
 		config.Server.KeepLostClients,
 	)
 	if err != nil {
 		return nil, err
 	}
+	s.clientProvider = clientProvider
 
 	var keepLostClients *time.Duration
 	if config.Server.KeepLostClients > 0 {
@@ -108,11 +164,52 @@ func NewServer(config *Config, filesAPI files.FileAPI) (*Server, error) {
 		ports.NewPortDistributor(config.AllowedPorts()),
 		s.clientProvider,
 		keepLostClients,
+		config.Server.MaxCachedDisconnectedClients,
 		s.Logger,
 	)
 	if err != nil {
 		return nil, err
 	}
+	s.clientService.repo.ParkLostClients = config.Server.ParkLostClients && keepLostClients != nil
+	s.clientService.repo.StartBackgroundSave(config.Server.ClientSaveWorkers, config.Server.ClientSaveBatchSize)
+	s.clientService.allowedEnvironments = config.Server.AllowedEnvironments
+	s.clientService.requiredFields = config.Server.RequiredClientFields
+	s.clientService.warnOnMissingFields = config.Server.MissingClientFieldsAction == MissingClientFieldsWarn
+	s.clientService.tunnelCopyLimiter = clients.NewCopyLimiter(config.Server.MaxConcurrentTunnelCopies, config.Server.TunnelCopyWait)
+	s.clientService.tunnelConnDeadlines = clients.ConnDeadlines{
+		Read:  config.Server.TunnelReadDeadline,
+		Write: config.Server.TunnelWriteDeadline,
+	}
+	s.clientService.tunnelConnLogging = clients.ConnLogging{
+		Level:      config.Server.tunnelConnLogLevel,
+		SampleRate: config.Server.TunnelConnLogSampleRate,
+	}
+	if config.API.CertFile != "" && config.API.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.API.CertFile, config.API.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		s.clientService.tunnelProxyTLS = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+	s.clientService.autoTagger, err = clients.NewAutoTagger(config.AutoTags.Rules)
+	if err != nil {
+		return nil, err
+	}
+	s.clientService.clientRegistry = clientProvider
+	s.clientService.registrationHook = hooks.NewRegistrationHook(
+		config.Server.RegistrationHookURL,
+		config.Server.RegistrationHookCommand,
+		config.Server.RegistrationHookRetries,
+		config.Server.RegistrationHookTimeout,
+		s.Logger.Fork("registration-hook"),
+	)
+	s.clientService.stateWebhook = hooks.NewClientStateWebhook(
+		config.Server.ClientStateWebhookURLs,
+		config.Server.ClientStateWebhookSecret,
+		config.Server.ClientStateWebhookRetries,
+		config.Server.ClientStateWebhookTimeout,
+		s.Logger.Fork("client-state-webhook"),
+	)
 
 	if config.Database.driver != "" {
 		s.db, err = sqlx.Connect(config.Database.driver, config.Database.dsn)
@@ -126,11 +223,27 @@ func NewServer(config *Config, filesAPI files.FileAPI) (*Server, error) {
 	if err != nil {
 		return nil, err
 	}
+	s.clientsAuthPurge = NewClientsAuthPurgeTask(
+		s.Logger,
+		s.clientAuthProvider,
+		s.clientService,
+		config.Server.PurgeClientsAuthAfter,
+		s.clientAuthProvider.IsWriteable() && config.Server.AuthWrite,
+	)
+	// start counting the time entries are unused from now
+	if err := s.clientsAuthPurge.Observe(); err != nil {
+		s.Errorf("Failed to check unused client auth entries: %v", err)
+	}
 	s.clientListener, err = NewClientListener(s, privateKey)
 	if err != nil {
 		return nil, err
 	}
 
+	if config.API.EnableMetrics {
+		s.metrics = newServerMetrics(s.clientService, s.jobProvider)
+		s.jobProvider = s.metrics.countCreatedJobs(s.jobProvider)
+	}
+
 	s.apiListener, err = NewAPIListener(s, fingerprint)
 	if err != nil {
 		return nil, err
@@ -188,12 +301,57 @@ func (s *Server) Run() error {
 	}
 
 	s.Infof("Variable to keep lost clients is set to %v", s.config.Server.KeepLostClients)
+	if n := s.config.Server.MaxCachedDisconnectedClients; n > 0 {
+		if s.config.Server.KeepLostClients > 0 {
+			s.Infof("Up to %d disconnected clients will be cached in memory", n)
+		} else {
+			s.Infof("'max_cached_disconnected_clients' is ignored because 'keep_lost_clients' is disabled")
+		}
+	}
+	if s.config.Server.ParkLostClients {
+		if s.config.Server.KeepLostClients > 0 {
+			s.Infof("Obsolete clients will be parked instead of being deleted")
+		} else {
+			s.Infof("'park_lost_clients' is ignored because 'keep_lost_clients' is disabled")
+		}
+	}
 
 	// TODO(m-terel): add graceful shutdown of background task
-	go scheduler.Run(ctx, s.Logger, clients.NewCleanupTask(s.Logger, s.clientListener.clientService.repo), s.config.Server.CleanupClients)
-	s.Infof("Task to cleanup obsolete clients will run with interval %v", s.config.Server.CleanupClients)
+	cleanupTask := clients.NewCleanupTask(s.Logger, s.clientListener.clientService.repo, s.config.Server.CleanupClientsBatchSize).
+		OnDeleted(s.clientListener.clientService.OnObsoleteDeleted)
+	go scheduler.RunWithJitter(ctx, s.Logger, cleanupTask, s.config.Server.CleanupClients, s.config.Server.CleanupClientsJitter)
+	s.Infof("Task to cleanup obsolete clients will run with interval %v and jitter %v", s.config.Server.CleanupClients, s.config.Server.CleanupClientsJitter)
+
+	if s.jobsCleanupTask != nil {
+		go scheduler.Run(ctx, s.Logger, s.jobsCleanupTask, jobsCleanupInterval)
+		s.Infof("Task to cleanup jobs older than %v will run with interval %v", s.config.Server.KeepJobs, jobsCleanupInterval)
+	}
+
+	if s.apiListener.auditLogProvider != nil && s.config.Server.KeepAuditLog > 0 {
+		go scheduler.Run(ctx, s.Logger, auditlog.NewCleanupTask(s.Logger, s.apiListener.auditLogProvider, s.config.Server.KeepAuditLog), auditLogCleanupInterval)
+		s.Infof("Task to cleanup audit log entries older than %v will run with interval %v", s.config.Server.KeepAuditLog, auditLogCleanupInterval)
+	}
 
-	return s.Wait()
+	go scheduler.Run(ctx, s.Logger, NewAPISessionsCleanupTask(s.Logger, s.apiListener.apiSessionRepo), apiSessionsCleanupInterval)
+
+	go scheduler.Run(ctx, s.Logger, newScheduleTask(s.apiListener), schedulesCheckInterval)
+
+	if s.config.Server.PurgeClientsAuthAfter > 0 {
+		if s.clientsAuthPurge.writeable {
+			go scheduler.Run(ctx, s.Logger, s.clientsAuthPurge, clientsAuthPurgeInterval)
+			s.Infof("Task to purge client auth entries unused for %v will run with interval %v", s.config.Server.PurgeClientsAuthAfter, clientsAuthPurgeInterval)
+		} else {
+			s.Infof("Client auth is read-only, 'purge_clients_auth_after' is ignored")
+		}
+	}
+
+	go s.shutdownOnSignal(syscall.SIGTERM, os.Interrupt)
+
+	err := s.Wait()
+	if atomic.LoadInt32(&s.shuttingDown) == 1 {
+		return s.Shutdown()
+	}
+	return err
 }
 
 // Start is responsible for kicking off the http server
@@ -203,6 +361,7 @@ func (s *Server) Start() error {
 	if err != nil {
 		return err
 	}
+	atomic.StoreInt32(&s.started, 1)
 
 	if s.config.API.Address != "" {
 		err = s.apiListener.Start(s.config.API.Address)
@@ -218,6 +377,11 @@ func (s *Server) Wait() error {
 }
 
 func (s *Server) Close() error {
+	if s.clientService != nil {
+		// flush clients saved in the background before the storage is closed
+		s.clientService.repo.Close()
+	}
+
 	wg := &errgroup.Group{}
 	wg.Go(s.clientListener.Close)
 	wg.Go(s.apiListener.Close)
@@ -231,18 +395,130 @@ func (s *Server) Close() error {
 	return wg.Wait()
 }
 
+// Shutdown stops accepting new API requests and client connections, waits up to 'shutdown_grace_period' for in-flight
+// jobs to finish and closes the server. Jobs that are still running after that are marked as failed.
+// It's safe to call it multiple times, the server is shut down only once.
+func (s *Server) Shutdown() error {
+	s.shutdownOnce.Do(func() {
+		s.shutdownErr = s.shutdown()
+	})
+	return s.shutdownErr
+}
+
+func (s *Server) shutdown() error {
+	atomic.StoreInt32(&s.shuttingDown, 1)
+	gracePeriod := s.config.Server.ShutdownGracePeriod
+	s.Infof("Shutting down, waiting up to %v for running jobs to finish", gracePeriod)
+
+	ctx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancel()
+
+	wg := &errgroup.Group{}
+	wg.Go(func() error { return s.clientListener.httpServer.Shutdown(ctx) })
+	if s.apiListener.httpServer != nil {
+		wg.Go(func() error { return s.apiListener.httpServer.Shutdown(ctx) })
+	}
+	if err := wg.Wait(); err != nil {
+		s.Errorf("Failed to stop listeners gracefully: %v", err)
+	}
+
+	s.waitForRunningJobs(ctx)
+
+	n, err := s.jobProvider.FailRunning(errMsgServerShuttingDown, time.Now())
+	if err != nil {
+		s.Errorf("Failed to mark running jobs as failed: %v", err)
+	} else if n > 0 {
+		s.Infof("%d jobs were still running and marked as failed", n)
+	}
+
+	return s.Close()
+}
+
+// waitForRunningJobs blocks until there are no in-flight multi-client jobs and no running jobs dispatched by this
+// process or the given context is done. Jobs of other servers sharing the jobs DB are tracked in memory only by them,
+// so they are never waited for.
+func (s *Server) waitForRunningJobs(ctx context.Context) {
+	ticker := time.NewTicker(shutdownJobsPollInterval)
+	defer ticker.Stop()
+	for {
+		running, multiJobs := s.dispatchedJobs.Len(), s.jobsDoneChannel.Len()
+		if running == 0 && multiJobs == 0 {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			s.Infof("Grace period is over, %d jobs and %d multi-client jobs are still running", running, multiJobs)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) shutdownOnSignal(signals ...os.Signal) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, signals...)
+	received := <-sig
+	signal.Stop(sig)
+
+	s.Infof("Received %v signal", received)
+	if err := s.Shutdown(); err != nil {
+		s.Errorf("Failed to shut down: %v", err)
+	}
+}
+
+// jobIDSet is a thread safe set of job ids. The zero value is ready to use.
+type jobIDSet struct {
+	m  map[string]struct{}
+	mu sync.RWMutex
+}
+
+func (j *jobIDSet) Add(jid string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.m == nil {
+		j.m = make(map[string]struct{})
+	}
+	j.m[jid] = struct{}{}
+}
+
+func (j *jobIDSet) Del(jid string) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	delete(j.m, jid)
+}
+
+func (j *jobIDSet) Len() int {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return len(j.m)
+}
+
+var ErrTooManyMultiJobs = errors.New("too many multi-client jobs are running, please try later")
+
 // jobResultChanMap is thread safe map with [jobID, chan *models.Job] pairs.
+// It holds an entry for each in-flight multi-client job.
 type jobResultChanMap struct {
 	m  map[string]chan *models.Job
 	mu sync.RWMutex
+	// limit is a max number of in-flight multi-client jobs, 0 means unlimited
+	limit int
 }
 
-func (m *jobResultChanMap) Set(jobID string, done chan *models.Job) {
+// Add registers a new in-flight multi-client job. The returned channel is buffered to hold results of all its jobs,
+// so sending a result never blocks. Returns ErrTooManyMultiJobs if the limit of in-flight jobs is reached.
+func (m *jobResultChanMap) Add(jobID string, size int) (chan *models.Job, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if m.limit > 0 && len(m.m) >= m.limit {
+		return nil, ErrTooManyMultiJobs
+	}
+	done := make(chan *models.Job, size)
 	m.m[jobID] = done
+	return done, nil
 }
 
+// Del removes a finished multi-client job. The channel is not closed to let late results be dropped safely.
 func (m *jobResultChanMap) Del(jobID string) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -254,3 +530,26 @@ func (m *jobResultChanMap) Get(jobID string) chan *models.Job {
 	defer m.mu.RUnlock()
 	return m.m[jobID]
 }
+
+// Send passes a job result to a given multi-client job without blocking. Returns false if the result was dropped.
+func (m *jobResultChanMap) Send(jobID string, job *models.Job) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	done := m.m[jobID]
+	if done == nil {
+		return false
+	}
+	select {
+	case done <- job:
+		return true
+	default:
+		return false
+	}
+}
+
+// Len returns a number of in-flight multi-client jobs.
+func (m *jobResultChanMap) Len() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.m)
+}
@@ -0,0 +1,249 @@
+package chserver
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cloudradar-monitoring/rport/server/api/jobs"
+	"github.com/cloudradar-monitoring/rport/server/cgroups"
+	"github.com/cloudradar-monitoring/rport/server/clients"
+	"github.com/cloudradar-monitoring/rport/server/test/jb"
+	chshare "github.com/cloudradar-monitoring/rport/share"
+	"github.com/cloudradar-monitoring/rport/share/models"
+	"github.com/cloudradar-monitoring/rport/share/ws"
+)
+
+func TestJobResultChanMapLimit(t *testing.T) {
+	testCases := []struct {
+		name        string
+		limit       int
+		wantAdded   int
+		wantLimited int
+	}{
+		{
+			name:        "unlimited",
+			limit:       0,
+			wantAdded:   50,
+			wantLimited: 0,
+		},
+		{
+			name:        "limited",
+			limit:       10,
+			wantAdded:   10,
+			wantLimited: 40,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := jobResultChanMap{
+				m:     make(map[string]chan *models.Job),
+				limit: tc.limit,
+			}
+
+			// when
+			var mu sync.Mutex
+			var added []string
+			var limited int
+			var wg sync.WaitGroup
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func(jid string) {
+					defer wg.Done()
+					_, err := m.Add(jid, 2)
+					mu.Lock()
+					defer mu.Unlock()
+					if err != nil {
+						assert.Equal(t, ErrTooManyMultiJobs, err)
+						limited++
+						return
+					}
+					added = append(added, jid)
+				}("multi-job-" + strconv.Itoa(i))
+			}
+			wg.Wait()
+
+			// then
+			assert.Len(t, added, tc.wantAdded)
+			assert.Equal(t, tc.wantLimited, limited)
+			assert.Equal(t, tc.wantAdded, m.Len())
+
+			for _, jid := range added {
+				m.Del(jid)
+			}
+			assert.Equal(t, 0, m.Len())
+
+			_, err := m.Add("new-multi-job", 2)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestJobResultChanMapSend(t *testing.T) {
+	m := jobResultChanMap{
+		m: make(map[string]chan *models.Job),
+	}
+	done, err := m.Add("multi-job-1", 2)
+	require.NoError(t, err)
+	job1 := jb.New(t).JID("job-1").Build()
+	job2 := jb.New(t).JID("job-2").Build()
+	job3 := jb.New(t).JID("job-3").Build()
+
+	// when buffer has room
+	assert.True(t, m.Send("multi-job-1", job1))
+	assert.True(t, m.Send("multi-job-1", job2))
+	// when buffer is full
+	assert.False(t, m.Send("multi-job-1", job3))
+	// when job is unknown
+	assert.False(t, m.Send("unknown", job1))
+
+	// then
+	assert.Equal(t, job1, <-done)
+	assert.Equal(t, job2, <-done)
+
+	// when job is deleted
+	m.Del("multi-job-1")
+	assert.False(t, m.Send("multi-job-1", job3))
+	assert.Nil(t, m.Get("multi-job-1"))
+}
+
+func TestShutdownDrainsRunningJobs(t *testing.T) {
+	testCases := []struct {
+		name           string
+		single         bool
+		notDispatched  bool
+		finishAfter    time.Duration
+		wantStatus     string
+		wantError      string
+		wantMaxElapsed time.Duration
+	}{
+		{
+			name:           "job finished within grace period",
+			finishAfter:    50 * time.Millisecond,
+			wantStatus:     models.JobStatusSuccessful,
+			wantMaxElapsed: time.Second,
+		},
+		{
+			name:        "job still running after grace period",
+			finishAfter: time.Minute,
+			wantStatus:  models.JobStatusFailed,
+			wantError:   "server shutting down",
+		},
+		{
+			name:           "single-client job finished within grace period",
+			single:         true,
+			finishAfter:    50 * time.Millisecond,
+			wantStatus:     models.JobStatusSuccessful,
+			wantMaxElapsed: time.Second,
+		},
+		{
+			name:        "single-client job still running after grace period",
+			single:      true,
+			finishAfter: time.Minute,
+			wantStatus:  models.JobStatusFailed,
+			wantError:   "server shutting down",
+		},
+		{
+			name:           "running job not dispatched by this process",
+			single:         true,
+			notDispatched:  true,
+			finishAfter:    time.Minute,
+			wantStatus:     models.JobStatusFailed,
+			wantError:      "server shutting down",
+			wantMaxElapsed: 250 * time.Millisecond,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "rportd-shutdown")
+			require.NoError(t, err)
+			defer os.RemoveAll(dir)
+			jobsDBPath := filepath.Join(dir, "jobs.db")
+			jp, err := jobs.NewSqliteProvider(jobsDBPath, testLog)
+			require.NoError(t, err)
+			clientProvider, err := clients.NewSqliteProvider(":memory:", time.Hour)
+			require.NoError(t, err)
+			groupProvider, err := cgroups.NewSqliteProvider(":memory:")
+			require.NoError(t, err)
+
+			multiJobID := "multi-job-1"
+			job := jb.New(t).Status(models.JobStatusRunning).Build()
+			if !tc.single {
+				job.MultiJobID = &multiJobID
+			}
+			require.NoError(t, jp.SaveJob(job))
+
+			s := &Server{
+				Logger: testLog,
+				config: &Config{
+					Server: ServerConfig{ShutdownGracePeriod: 300 * time.Millisecond},
+				},
+				jobProvider:         jp,
+				clientProvider:      clientProvider,
+				clientGroupProvider: groupProvider,
+				uiJobWebSockets:     ws.NewWebSocketCache(),
+				jobsDoneChannel: jobResultChanMap{
+					m: make(map[string]chan *models.Job),
+				},
+			}
+			s.clientListener = &ClientListener{Server: s, httpServer: chshare.NewHTTPServer(0)}
+			s.apiListener = &APIListener{Server: s, httpServer: chshare.NewHTTPServer(0)}
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			addr := l.Addr().String()
+			require.NoError(t, l.Close())
+			require.NoError(t, s.clientListener.httpServer.GoListenAndServe(addr, http.NotFoundHandler()))
+
+			if !tc.single {
+				_, err = s.jobsDoneChannel.Add(multiJobID, 1)
+				require.NoError(t, err)
+			}
+			if !tc.notDispatched {
+				s.dispatchedJobs.Add(job.JID)
+			}
+			// simulate a client sending the job result
+			timer := time.AfterFunc(tc.finishAfter, func() {
+				finished := *job
+				finished.Status = models.JobStatusSuccessful
+				assert.NoError(t, jp.SaveJob(&finished))
+				s.dispatchedJobs.Del(job.JID)
+				s.jobsDoneChannel.Del(multiJobID)
+			})
+			defer timer.Stop()
+
+			start := time.Now()
+			require.NoError(t, s.Shutdown())
+			elapsed := time.Since(start)
+
+			// calling it again is a no-op
+			assert.NoError(t, s.Shutdown())
+			_, err = net.Dial("tcp", addr)
+			assert.Error(t, err, "new connections are not accepted")
+			if tc.wantMaxElapsed > 0 {
+				assert.Less(t, int64(elapsed), int64(tc.wantMaxElapsed))
+			} else {
+				assert.GreaterOrEqual(t, int64(elapsed), int64(s.config.Server.ShutdownGracePeriod))
+			}
+
+			jp, err = jobs.NewSqliteProvider(jobsDBPath, testLog)
+			require.NoError(t, err)
+			defer jp.Close()
+			got, err := jp.GetByJID(job.ClientID, job.JID)
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantStatus, got.Status)
+			assert.Equal(t, tc.wantError, got.Error)
+		})
+	}
+}
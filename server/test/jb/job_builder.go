@@ -22,16 +22,19 @@ import (
 type JobBuilder struct {
 	t *testing.T
 
-	jid        string
-	clientID   string
-	clientName string
-	multiJobID string
-	status     string
-	startedAt  time.Time
-	finishedAt *time.Time
-	result     *models.JobResult
-	isSudo     bool
-	cwd        string
+	jid         string
+	clientID    string
+	clientName  string
+	multiJobID  string
+	status      string
+	startedAt   time.Time
+	finishedAt  *time.Time
+	result      *models.JobResult
+	isSudo      bool
+	cwd         string
+	interpreter string
+	command     string
+	umask       string
 }
 
 // New returns a builder to generate a job that can be used in tests.
@@ -42,6 +45,7 @@ func New(t *testing.T) JobBuilder {
 		clientName: generateRandomClientName(),
 		status:     models.JobStatusSuccessful,
 		startedAt:  time.Date(2020, 10, 10, 10, 10, 10, 0, time.UTC),
+		command:    "/bin/date;foo;whoami",
 		result: &models.JobResult{
 			StdOut: "Mon Sep 28 09:05:08 UTC 2020\nrport",
 			StdErr: "/bin/sh: 1: foo: not found",
@@ -99,6 +103,21 @@ func (b JobBuilder) Cwd(cwd string) JobBuilder {
 	return b
 }
 
+func (b JobBuilder) Interpreter(interpreter string) JobBuilder {
+	b.interpreter = interpreter
+	return b
+}
+
+func (b JobBuilder) Command(command string) JobBuilder {
+	b.command = command
+	return b
+}
+
+func (b JobBuilder) Umask(umask string) JobBuilder {
+	b.umask = umask
+	return b
+}
+
 func (b JobBuilder) Build() *models.Job {
 	if b.jid == "" {
 		jid, err := generateRandomJID()
@@ -113,15 +132,17 @@ func (b JobBuilder) Build() *models.Job {
 			Status:     b.status,
 			FinishedAt: b.finishedAt,
 		},
-		ClientID:   b.clientID,
-		ClientName: b.clientName,
-		Command:    "/bin/date;foo;whoami",
-		PID:        &pid,
-		StartedAt:  b.startedAt,
-		CreatedBy:  "test-user",
-		TimeoutSec: 60,
-		Result:     b.result,
-		MultiJobID: &b.multiJobID,
+		ClientID:    b.clientID,
+		ClientName:  b.clientName,
+		Command:     b.command,
+		Interpreter: b.interpreter,
+		Umask:       b.umask,
+		PID:         &pid,
+		StartedAt:   b.startedAt,
+		CreatedBy:   "test-user",
+		TimeoutSec:  60,
+		Result:      b.result,
+		MultiJobID:  &b.multiJobID,
 	}
 }
 
@@ -12,14 +12,16 @@ import (
 type MultiJobBuilder struct {
 	t *testing.T
 
-	jid        string
-	clientIDs  []string
-	startedAt  time.Time
-	concurrent bool
-	abortOnErr bool
-	withJobs   bool
-	sudo       bool
-	cwd        string
+	jid         string
+	clientIDs   []string
+	startedAt   time.Time
+	concurrent  bool
+	abortOnErr  bool
+	withJobs    bool
+	sudo        bool
+	cwd         string
+	interpreter string
+	createdBy   string
 }
 
 // NewMulti returns a builder to generate a multi-client job that can be used in tests.
@@ -70,6 +72,16 @@ func (b MultiJobBuilder) StartedAt(startedAt time.Time) MultiJobBuilder {
 	return b
 }
 
+func (b MultiJobBuilder) Interpreter(interpreter string) MultiJobBuilder {
+	b.interpreter = interpreter
+	return b
+}
+
+func (b MultiJobBuilder) CreatedBy(createdBy string) MultiJobBuilder {
+	b.createdBy = createdBy
+	return b
+}
+
 func (b MultiJobBuilder) Build() *models.MultiJob {
 	if b.jid == "" {
 		jid, err := generateRandomJID()
@@ -79,6 +91,9 @@ func (b MultiJobBuilder) Build() *models.MultiJob {
 	if len(b.clientIDs) == 0 {
 		b.clientIDs = []string{generateRandomCID(), generateRandomCID()}
 	}
+	if b.createdBy == "" {
+		b.createdBy = "test-user"
+	}
 	jobs := []*models.Job{}
 	if b.withJobs {
 		st := b.startedAt.Add(time.Minute) // is used to order jobs to make tests work
@@ -92,15 +107,16 @@ func (b MultiJobBuilder) Build() *models.MultiJob {
 		MultiJobSummary: models.MultiJobSummary{
 			JID:       b.jid,
 			StartedAt: b.startedAt,
-			CreatedBy: "test-user",
+			CreatedBy: b.createdBy,
 		},
-		ClientIDs:  b.clientIDs,
-		Command:    "/bin/date;foo;whoami",
-		Cwd:        b.cwd,
-		IsSudo:     b.sudo,
-		TimeoutSec: 60,
-		Concurrent: b.concurrent,
-		AbortOnErr: b.abortOnErr,
-		Jobs:       jobs,
+		ClientIDs:   b.clientIDs,
+		Command:     "/bin/date;foo;whoami",
+		Interpreter: b.interpreter,
+		Cwd:         b.cwd,
+		IsSudo:      b.sudo,
+		TimeoutSec:  60,
+		Concurrent:  b.concurrent,
+		AbortOnErr:  b.abortOnErr,
+		Jobs:        jobs,
 	}
 }
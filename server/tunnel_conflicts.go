@@ -0,0 +1,76 @@
+package chserver
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// maxTunnelConflicts limits the number of kept tunnel conflicts, the oldest ones are dropped.
+const maxTunnelConflicts = 1000
+
+// TunnelConflict describes a tunnel requested by a client that failed to start because its server local port is taken.
+type TunnelConflict struct {
+	ClientID  string `json:"client_id"`
+	LocalPort string `json:"local_port"`
+	Remote    string `json:"remote"`
+	// OwnerClientID is an ID of a client that holds the local port. Empty if the port is taken by some other process.
+	OwnerClientID string    `json:"owner_client_id"`
+	Error         string    `json:"error"`
+	RequestedAt   time.Time `json:"requested_at"`
+}
+
+// tunnelConflicts keeps the latest conflict per client and server local port.
+type tunnelConflicts struct {
+	mu sync.Mutex
+	m  map[string]*TunnelConflict
+}
+
+func tunnelConflictKey(clientID, localPort string) string {
+	return clientID + ":" + localPort
+}
+
+func (c *tunnelConflicts) Add(conflict *TunnelConflict) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.m == nil {
+		c.m = make(map[string]*TunnelConflict)
+	}
+
+	key := tunnelConflictKey(conflict.ClientID, conflict.LocalPort)
+	if _, ok := c.m[key]; !ok && len(c.m) >= maxTunnelConflicts {
+		var oldestKey string
+		var oldest *TunnelConflict
+		for k, cur := range c.m {
+			if oldest == nil || cur.RequestedAt.Before(oldest.RequestedAt) {
+				oldestKey, oldest = k, cur
+			}
+		}
+		delete(c.m, oldestKey)
+	}
+	c.m[key] = conflict
+}
+
+// Resolve removes a conflict once a given client holds the local port.
+func (c *tunnelConflicts) Resolve(clientID, localPort string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.m, tunnelConflictKey(clientID, localPort))
+}
+
+// GetAll returns all conflicts, the latest first.
+func (c *tunnelConflicts) GetAll() []*TunnelConflict {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	res := make([]*TunnelConflict, 0, len(c.m))
+	for _, cur := range c.m {
+		res = append(res, cur)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].RequestedAt.After(res[j].RequestedAt)
+	})
+	return res
+}
@@ -0,0 +1,29 @@
+package chserver
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTunnelConflicts(t *testing.T) {
+	now := time.Date(2021, 1, 1, 10, 0, 0, 0, time.UTC)
+	c := tunnelConflicts{}
+
+	c.Add(&TunnelConflict{ClientID: "client-1", LocalPort: "3000", RequestedAt: now})
+	c.Add(&TunnelConflict{ClientID: "client-2", LocalPort: "3000", RequestedAt: now.Add(time.Second)})
+	c.Add(&TunnelConflict{ClientID: "client-1", LocalPort: "3000", Error: "latest", RequestedAt: now.Add(2 * time.Second)})
+
+	got := c.GetAll()
+	assert.Equal(t, []*TunnelConflict{
+		{ClientID: "client-1", LocalPort: "3000", Error: "latest", RequestedAt: now.Add(2 * time.Second)},
+		{ClientID: "client-2", LocalPort: "3000", RequestedAt: now.Add(time.Second)},
+	}, got)
+
+	c.Resolve("client-1", "3000")
+
+	assert.Equal(t, []*TunnelConflict{
+		{ClientID: "client-2", LocalPort: "3000", RequestedAt: now.Add(time.Second)},
+	}, c.GetAll())
+}
@@ -52,3 +52,31 @@ func ResolveIdleTunnelTimeoutValue(idleTimeoutMinutesStr string, skipIdleTimeout
 
 	return idleTimeoutMinutes, nil
 }
+
+const maxLifetimeMax = time.Hour * 24 * 7 //a week
+
+// ResolveTunnelMaxLifetimeValue returns a max lifetime of a tunnel, 0 if it's not given.
+func ResolveTunnelMaxLifetimeValue(maxLifetimeMinutesStr string) (time.Duration, error) {
+	if maxLifetimeMinutesStr == "" {
+		return 0, nil
+	}
+
+	maxLifetimeMinutesInt, err := strconv.Atoi(maxLifetimeMinutesStr)
+	if err != nil {
+		return 0, errors2.APIError{
+			Message:    "invalid max lifetime param",
+			Err:        err,
+			HTTPStatus: http.StatusBadRequest,
+		}
+	}
+	maxLifetime := time.Duration(maxLifetimeMinutesInt) * time.Minute
+
+	if maxLifetime < 0 || maxLifetime > maxLifetimeMax {
+		return 0, errors2.APIError{
+			Message:    fmt.Sprintf("max lifetime param should be in range [0,%d] minutes", int(maxLifetimeMax.Minutes())),
+			HTTPStatus: http.StatusBadRequest,
+		}
+	}
+
+	return maxLifetime, nil
+}
@@ -2,22 +2,53 @@ package comm
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
+	"regexp"
 	"time"
+
+	"github.com/cloudradar-monitoring/rport/share/models"
 )
 
 const (
 	// request types sent by server to clients
 	RequestTypeCheckPort            = "check_port"
 	RequestTypeRunCmd               = "run_cmd"
+	RequestTypeValidateCmd          = "validate_cmd"
 	RequestTypeRefreshUpdatesStatus = "refresh_updates_status"
+	RequestTypeUpdateTags           = "update_tags"
+	RequestTypeInstallUpdates       = "install_updates"
+	RequestTypeCancelJob            = "cancel_job"
+	RequestTypeStreamCmdOutput      = "stream_cmd_output"
+	RequestTypeReconnect            = "reconnect"
 
 	// request types sent by clients to server
 	RequestTypePing          = "ping"
 	RequestTypeCmdResult     = "cmd_result"
 	RequestTypeUpdatesStatus = "updates_status"
+	RequestTypeHealthStatus  = "health_status"
+	RequestTypeCmdOutput     = "cmd_output"
+)
+
+// ServerInfoPath is a path of the endpoint of the client listener that returns ServerInfo without authentication.
+const ServerInfoPath = "/api/v1/server/info"
+
+// server features reported in ServerInfo
+const (
+	FeatureCommandSigning     = "command_signing"
+	FeaturePushedClientConfig = "pushed_client_config"
+	FeatureMaxJobResultSize   = "max_job_result_size"
 )
 
+// ServerInfo describes a server build and enabled features to check its compatibility with a client before connecting.
+type ServerInfo struct {
+	Version         string   `json:"version"`
+	ProtocolVersion string   `json:"protocol_version"`
+	Fingerprint     string   `json:"fingerprint"`
+	Features        []string `json:"features"`
+}
+
 type CheckPortRequest struct {
 	HostPort string
 	Timeout  time.Duration
@@ -40,3 +71,211 @@ type RunCmdResponse struct {
 	Pid       int
 	StartedAt time.Time
 }
+
+// rules that a command can violate
+const (
+	CmdRuleCommand        = "command"
+	CmdRuleTemplate       = "template"
+	CmdRuleInterpreter    = "interpreter"
+	CmdRuleRemoteCommands = "remote_commands"
+	CmdRuleRemoteScripts  = "remote_scripts"
+	CmdRuleAllowDenyList  = "allow_deny_list"
+	CmdRuleWorkingDir     = "working_dir"
+)
+
+// ValidateCmdResponse is a verdict whether a command is allowed to run.
+type ValidateCmdResponse struct {
+	Allowed bool   `json:"allowed"`
+	Rule    string `json:"rule,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+func NewCmdDenied(rule, reason string) *ValidateCmdResponse {
+	return &ValidateCmdResponse{
+		Allowed: false,
+		Rule:    rule,
+		Reason:  reason,
+	}
+}
+
+const MaxTagLength = 100
+
+var tagRegexp = regexp.MustCompile(`^[\p{L}\p{N} _.:/@-]+$`)
+
+// ValidateTag returns an error if a given tag is empty, too long or contains not allowed characters.
+func ValidateTag(tag string) error {
+	if len(tag) > MaxTagLength {
+		return fmt.Errorf("tag %q is longer than %d characters", tag, MaxTagLength)
+	}
+	if !tagRegexp.MatchString(tag) {
+		return fmt.Errorf("tag %q is invalid: only letters, digits, spaces and '_.:/@-' are allowed", tag)
+	}
+	return nil
+}
+
+// UpdateTagsRequest asks a client to add and remove tags.
+type UpdateTagsRequest struct {
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+func (r *UpdateTagsRequest) Validate() error {
+	if len(r.Add) == 0 && len(r.Remove) == 0 {
+		return errors.New("at least one tag to add or remove should be specified")
+	}
+	for _, tag := range append(append([]string{}, r.Add...), r.Remove...) {
+		if err := ValidateTag(tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Apply returns given tags without removed tags and with added tags that are not present yet.
+func (r *UpdateTagsRequest) Apply(tags []string) []string {
+	res := make([]string, 0, len(tags)+len(r.Add))
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		if !seen[tag] && !containsString(r.Remove, tag) {
+			res = append(res, tag)
+			seen[tag] = true
+		}
+	}
+	for _, tag := range r.Add {
+		if !seen[tag] {
+			res = append(res, tag)
+			seen[tag] = true
+		}
+	}
+	return res
+}
+
+func containsString(list []string, s string) bool {
+	for _, cur := range list {
+		if cur == s {
+			return true
+		}
+	}
+	return false
+}
+
+type UpdateTagsResponse struct {
+	Tags []string `json:"tags"`
+}
+
+// RefreshUpdatesStatusRequest asks a client to refresh its updates status.
+type RefreshUpdatesStatusRequest struct {
+	// Force makes a client query the package manager even if the last status is cached
+	Force bool `json:"force"`
+}
+
+// CancelJobRequest asks a client to kill a running command of a job.
+type CancelJobRequest struct {
+	JID string `json:"jid"`
+	PID int    `json:"pid"`
+}
+
+// StreamCmdOutputRequest asks a client to stream the output of a running command of a job.
+type StreamCmdOutputRequest struct {
+	JID string `json:"jid"`
+}
+
+// CmdOutput is a chunk of the output of a running command sent by a client.
+type CmdOutput struct {
+	JID    string `json:"jid"`
+	StdOut string `json:"stdout,omitempty"`
+	StdErr string `json:"stderr,omitempty"`
+}
+
+// ReconnectRequest asks a client to disconnect and connect to another server. The client switches back
+// to its configured main server like it does from fallback servers.
+type ReconnectRequest struct {
+	ServerURL string `json:"server_url"`
+}
+
+func (r *ReconnectRequest) Validate() error {
+	if r.ServerURL == "" {
+		return errors.New("server_url is required")
+	}
+	u, err := url.Parse(r.ServerURL)
+	if err != nil {
+		return fmt.Errorf("invalid server_url: %v", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "ws", "wss":
+	default:
+		return fmt.Errorf("invalid server_url %q: expected an http, https, ws or wss URL", r.ServerURL)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("invalid server_url %q: host is required", r.ServerURL)
+	}
+	return nil
+}
+
+var packageNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.+:~@-]*$`)
+
+// ValidatePackageName returns an error if a given package name could be taken for an option or contains not allowed characters.
+func ValidatePackageName(name string) error {
+	if !packageNameRegexp.MatchString(name) {
+		return fmt.Errorf("package name %q is invalid: it should start with a letter or digit, only letters, digits and '_.+:~@-' are allowed", name)
+	}
+	return nil
+}
+
+// InstallUpdatesRequest asks a client to install updates by its package manager.
+// The result is sent back as the result of the job like for a command.
+type InstallUpdatesRequest struct {
+	Job models.Job `json:"job"`
+	// Packages to update, all updates are installed if empty.
+	Packages     []string `json:"packages"`
+	SecurityOnly bool     `json:"security_only"`
+}
+
+func (r *InstallUpdatesRequest) Validate() error {
+	for _, name := range r.Packages {
+		if err := ValidatePackageName(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// JobCommand returns a command of the job describing the requested updates. Since the job is signed,
+// a client can verify the packages and the security flag haven't been changed by comparing the commands.
+func (r *InstallUpdatesRequest) JobCommand() string {
+	command := "install updates"
+	if r.SecurityOnly {
+		command = "install security updates"
+	}
+	for _, name := range r.Packages {
+		command += " " + name
+	}
+	return command
+}
+
+// PushedConfig is a client config the server pushes at connect time. It overrides the client defaults,
+// values set explicitly on the client are kept. Empty fields are not pushed. Security relevant settings
+// like allowed and denied commands are never pushed, they are controlled on the client only.
+type PushedConfig struct {
+	KeepAlive      time.Duration        `json:"keep_alive"`
+	RemoteCommands PushedCommandsConfig `json:"remote_commands"`
+}
+
+type PushedCommandsConfig struct {
+	SendBackLimit int `json:"send_back_limit"`
+}
+
+// IsEmpty returns true if there is nothing to push.
+func (c PushedConfig) IsEmpty() bool {
+	return c.KeepAlive == 0 && c.RemoteCommands.SendBackLimit == 0
+}
+
+func (c PushedConfig) Validate() error {
+	if c.KeepAlive < 0 {
+		return fmt.Errorf("keep_alive can not be negative: %v", c.KeepAlive)
+	}
+	if c.RemoteCommands.SendBackLimit < 0 {
+		return fmt.Errorf("send_back_limit can not be negative: %d", c.RemoteCommands.SendBackLimit)
+	}
+	return nil
+}
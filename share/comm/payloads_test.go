@@ -0,0 +1,135 @@
+package comm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateTagsRequestValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		req     UpdateTagsRequest
+		wantErr string
+	}{
+		{
+			name: "valid",
+			req:  UpdateTagsRequest{Add: []string{"Datacenter 1", "web-01", "owner@example.com"}, Remove: []string{"os:linux"}},
+		},
+		{
+			name:    "empty",
+			req:     UpdateTagsRequest{},
+			wantErr: "at least one tag to add or remove should be specified",
+		},
+		{
+			name:    "empty tag",
+			req:     UpdateTagsRequest{Remove: []string{""}},
+			wantErr: `tag "" is invalid: only letters, digits, spaces and '_.:/@-' are allowed`,
+		},
+		{
+			name:    "too long tag",
+			req:     UpdateTagsRequest{Add: []string{strings.Repeat("a", 101)}},
+			wantErr: `tag "` + strings.Repeat("a", 101) + `" is longer than 100 characters`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.req.Validate()
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestUpdateTagsRequestApply(t *testing.T) {
+	req := UpdateTagsRequest{Add: []string{"web", "linux", "web"}, Remove: []string{"old"}}
+
+	got := req.Apply([]string{"linux", "old", "db"})
+
+	assert.Equal(t, []string{"linux", "db", "web"}, got)
+}
+
+func TestInstallUpdatesRequestValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		req     InstallUpdatesRequest
+		wantErr string
+	}{
+		{
+			name: "all updates",
+			req:  InstallUpdatesRequest{SecurityOnly: true},
+		},
+		{
+			name: "valid packages",
+			req:  InstallUpdatesRequest{Packages: []string{"openssl", "libstdc++6", "python3.8", "kernel-core-5.14.0:1.el9"}},
+		},
+		{
+			name:    "option as package",
+			req:     InstallUpdatesRequest{Packages: []string{"curl", "--allowerasing"}},
+			wantErr: `package name "--allowerasing" is invalid: it should start with a letter or digit, only letters, digits and '_.+:~@-' are allowed`,
+		},
+		{
+			name:    "shell chars",
+			req:     InstallUpdatesRequest{Packages: []string{"curl;reboot"}},
+			wantErr: `package name "curl;reboot" is invalid: it should start with a letter or digit, only letters, digits and '_.+:~@-' are allowed`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.req.Validate()
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestReconnectRequestValidate(t *testing.T) {
+	testCases := []struct {
+		name    string
+		req     ReconnectRequest
+		wantErr string
+	}{
+		{
+			name: "http",
+			req:  ReconnectRequest{ServerURL: "http://rport2.example.com:8080"},
+		},
+		{
+			name: "wss",
+			req:  ReconnectRequest{ServerURL: "wss://rport2.example.com"},
+		},
+		{
+			name:    "empty",
+			wantErr: "server_url is required",
+		},
+		{
+			name:    "unsupported scheme",
+			req:     ReconnectRequest{ServerURL: "ftp://rport2.example.com"},
+			wantErr: `invalid server_url "ftp://rport2.example.com": expected an http, https, ws or wss URL`,
+		},
+		{
+			name:    "no host",
+			req:     ReconnectRequest{ServerURL: "http://"},
+			wantErr: `invalid server_url "http://": host is required`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.req.Validate()
+			if tc.wantErr != "" {
+				assert.EqualError(t, err, tc.wantErr)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package chshare
 
 import (
+	"context"
 	"errors"
 	"net"
 	"net/http"
@@ -68,10 +69,23 @@ func (h *HTTPServer) closeWith(err error) {
 }
 
 func (h *HTTPServer) Close() error {
+	if !h.isRunning {
+		return nil
+	}
 	h.closeWith(nil)
 	return h.listener.Close()
 }
 
+// Shutdown stops accepting new connections and waits until active requests complete or the given context is done.
+// Hijacked connections, like websockets, are left untouched.
+func (h *HTTPServer) Shutdown(ctx context.Context) error {
+	if !h.isRunning {
+		return nil
+	}
+	h.closeWith(nil)
+	return h.Server.Shutdown(ctx)
+}
+
 func (h *HTTPServer) Wait() error {
 	if !h.isRunning {
 		return errors.New("Already closed")
@@ -4,6 +4,10 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 type LogLevel int
@@ -37,6 +41,11 @@ func NewLogOutput(filePath string) LogOutput {
 	}
 }
 
+// FilePath returns a path of the log file, empty if logs are written to stdout.
+func (o LogOutput) FilePath() string {
+	return o.filePath
+}
+
 func (o *LogOutput) Start() error {
 	if o.filePath == "" {
 		o.File = os.Stdout
@@ -87,11 +96,77 @@ func (l *Logger) Debugf(f string, args ...interface{}) {
 }
 
 func (l *Logger) Logf(severity LogLevel, f string, args ...interface{}) {
+	if severity == LogLevelError {
+		recentErrors.add(fmt.Sprintf("%s %s: "+f, append([]interface{}{time.Now().Format(time.RFC3339), l.prefix}, args...)...))
+	}
 	if l.level >= severity {
 		l.logger.Printf(l.prefix+": "+f, args...)
 	}
 }
 
+// LogField is a key and a value of a structured log entry.
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+// LogWithFields logs a message followed by given fields formatted as key=value pairs. String values are quoted.
+func (l *Logger) LogWithFields(severity LogLevel, msg string, fields ...LogField) {
+	if severity != LogLevelError && l.level < severity {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(msg)
+	for _, f := range fields {
+		b.WriteString(" ")
+		b.WriteString(f.Key)
+		b.WriteString("=")
+		if str, ok := f.Value.(string); ok {
+			b.WriteString(strconv.Quote(str))
+		} else {
+			fmt.Fprint(&b, f.Value)
+		}
+	}
+	l.Logf(severity, "%s", b.String())
+}
+
+// MaxRecentErrors is a number of the last logged errors that are kept in memory.
+const MaxRecentErrors = 200
+
+var recentErrors = &logRing{max: MaxRecentErrors}
+
+// RecentErrors returns the last logged errors, the oldest first.
+func RecentErrors() []string {
+	return recentErrors.list()
+}
+
+// logRing keeps the last max log lines.
+type logRing struct {
+	mu    sync.Mutex
+	max   int
+	lines []string
+	next  int
+}
+
+func (r *logRing) add(line string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.lines) < r.max {
+		r.lines = append(r.lines, line)
+		return
+	}
+	r.lines[r.next] = line
+	r.next = (r.next + 1) % r.max
+}
+
+func (r *logRing) list() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res := make([]string, 0, len(r.lines))
+	res = append(res, r.lines[r.next:]...)
+	return append(res, r.lines[:r.next]...)
+}
+
 func (l *Logger) Fork(prefix string, args ...interface{}) *Logger {
 	//slip the parent prefix at the front
 	args = append([]interface{}{l.prefix}, args...)
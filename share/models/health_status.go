@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+const (
+	HealthHealthy   = "healthy"
+	HealthDegraded  = "degraded"
+	HealthUnhealthy = "unhealthy"
+)
+
+// HealthStatus is a health state computed by a client from its local checks.
+type HealthStatus struct {
+	Refreshed time.Time `json:"refreshed"`
+	State     string    `json:"state"`
+	// Reasons lists checks that made a client not healthy.
+	Reasons []string `json:"reasons"`
+}
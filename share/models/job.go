@@ -1,7 +1,13 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
 	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
 	"time"
 )
 
@@ -10,6 +16,8 @@ const (
 	JobStatusRunning    = "running"
 	JobStatusFailed     = "failed"
 	JobStatusUnknown    = "unknown"
+	// JobStatusCanceled is set to jobs of a multi-client job that didn't finish before its batch timeout
+	JobStatusCanceled = "canceled"
 )
 
 type Job struct {
@@ -28,6 +36,96 @@ type Job struct {
 	Result      *JobResult `json:"result"`
 	IsSudo      bool       `json:"is_sudo"`
 	IsScript    bool       `json:"is_script"`
+	// Umask is an octal umask to run the command with on Unix clients, empty to keep the client umask.
+	// A client reports back the umask the command was actually started with.
+	Umask string `json:"umask,omitempty"`
+	// RunAs is an OS user to run the command as with sudo on Unix clients, empty to run as the client user
+	RunAs string `json:"run_as,omitempty"`
+	// Env holds environment variables to run the command with. It's only sent to the client, values are never stored.
+	Env map[string]string `json:"env,omitempty"`
+	// EnvKeys are names of the environment variables the command was run with
+	EnvKeys []string `json:"env_keys,omitempty"`
+	// Stdin is written to the command stdin which is closed afterwards. It's only sent to the client, it's never stored.
+	Stdin string `json:"stdin,omitempty"`
+	// MaxResultSize limits the size of stdout and stderr in bytes each, 0 means no limit
+	MaxResultSize int `json:"max_result_size,omitempty"`
+	// Truncated is set by a client if stdout or stderr exceeded MaxResultSize
+	Truncated bool `json:"truncated,omitempty"`
+	// ExecutionMetadata is reported by a client with the result
+	ExecutionMetadata *ExecutionMetadata `json:"execution_metadata,omitempty"`
+	// Signature is set by the server if command signing is enabled, see Sign
+	Signature string `json:"signature,omitempty"`
+	// SignatureExpiresAt is covered by the signature, clients refuse jobs with an expired signature
+	SignatureExpiresAt *time.Time `json:"signature_expires_at,omitempty"`
+	// ResultChecksum is a hex encoded sha256 checksum of the result, see JobResult.Checksum. It's set when the result is stored.
+	ResultChecksum string `json:"result_checksum,omitempty"`
+}
+
+// ExecutionMetadata describes where and when a command was executed.
+type ExecutionMetadata struct {
+	Hostname   string    `json:"hostname"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	// ExitCode is nil if the command didn't finish within the timeout or its exit code is unknown
+	ExitCode *int `json:"exit_code"`
+}
+
+// MaxUmask is the max valid umask value.
+const MaxUmask = 0777
+
+// ParseUmask parses an octal umask, e.g. "027" or "0027".
+func ParseUmask(umask string) (int, error) {
+	v, err := strconv.ParseUint(umask, 8, 32)
+	if err != nil || v > MaxUmask {
+		return 0, fmt.Errorf("invalid umask %q, expected an octal value from 0000 to 0777", umask)
+	}
+	return int(v), nil
+}
+
+var runAsRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]{0,31}$`)
+
+// ValidateRunAs returns an error if a given OS user name to run a command as is not safe to pass to sudo.
+func ValidateRunAs(user string) error {
+	if !runAsRegexp.MatchString(user) {
+		return fmt.Errorf("invalid user name %q, expected up to 32 letters, digits, '_', '.' and '-' not starting with a digit, '.' or '-'", user)
+	}
+	return nil
+}
+
+var envKeyRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ValidateEnv returns an error if any of given environment variable names is not a valid shell identifier.
+func ValidateEnv(env map[string]string) error {
+	for _, key := range SortedEnvKeys(env) {
+		if !envKeyRegexp.MatchString(key) {
+			return fmt.Errorf("invalid environment variable name %q, expected letters, digits and underscores not starting with a digit", key)
+		}
+	}
+	return nil
+}
+
+// MaxStdinSize is the max size of a command stdin in bytes.
+const MaxStdinSize = 1024 * 1024
+
+// ValidateStdin returns an error if a given command stdin exceeds MaxStdinSize.
+func ValidateStdin(stdin string) error {
+	if len(stdin) > MaxStdinSize {
+		return fmt.Errorf("stdin size %d exceeds the limit of %d bytes", len(stdin), MaxStdinSize)
+	}
+	return nil
+}
+
+// SortedEnvKeys returns sorted names of given environment variables, nil if there are none.
+func SortedEnvKeys(env map[string]string) []string {
+	if len(env) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
 // JobSummary short info about a job.
@@ -37,15 +135,39 @@ type JobSummary struct {
 	FinishedAt *time.Time `json:"finished_at"`
 }
 
+// ClientJobSummary short info about a job together with a client it ran on.
+type ClientJobSummary struct {
+	JobSummary
+	ClientID    string    `json:"client_id"`
+	Command     string    `json:"command"`
+	Interpreter string    `json:"interpreter"`
+	CreatedBy   string    `json:"created_by"`
+	StartedAt   time.Time `json:"started_at"`
+}
+
 type JobResult struct {
 	StdOut string `json:"stdout"`
 	StdErr string `json:"stderr"`
 }
 
+// Checksum returns a hex encoded sha256 checksum of stdout and stderr. Each of them is prefixed by its length,
+// so moving bytes from one to another changes the checksum.
+func (r *JobResult) Checksum() string {
+	h := sha256.New()
+	for _, cur := range []string{r.StdOut, r.StdErr} {
+		var size [8]byte
+		binary.BigEndian.PutUint64(size[:], uint64(len(cur)))
+		h.Write(size[:])
+		h.Write([]byte(cur))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
 type MultiJob struct {
 	MultiJobSummary
 	ClientIDs   []string `json:"client_ids"`
 	GroupIDs    []string `json:"group_ids"`
+	Tags        []string `json:"tags,omitempty"`
 	Command     string   `json:"command"`
 	Cwd         string   `json:"cwd"`
 	Interpreter string   `json:"interpreter"`
@@ -55,6 +177,13 @@ type MultiJob struct {
 	Jobs        []*Job   `json:"jobs"`
 	IsSudo      bool     `json:"is_sudo"`
 	IsScript    bool     `json:"is_script"`
+	IsTemplate  bool     `json:"is_template"`
+	// Params are values of the params of a template command
+	Params map[string]string `json:"params,omitempty"`
+	// BatchTimeoutSec limits the total execution time on all clients, 0 means no limit.
+	BatchTimeoutSec int `json:"batch_timeout_sec"`
+	// FinishedAt is set when a job with a batch timeout is finished.
+	FinishedAt *time.Time `json:"finished_at"`
 }
 
 type MultiJobSummary struct {
@@ -63,6 +192,18 @@ type MultiJobSummary struct {
 	CreatedBy string    `json:"created_by"`
 }
 
+// MultiJobStatusSummary is a multi-client job summary with a rollup of its clients' jobs statuses.
+type MultiJobStatusSummary struct {
+	MultiJobSummary
+	// ClientCount is a number of clients the job was started on
+	ClientCount int `json:"client_count"`
+	// Status is "running" if any client's job is running, "failed" if any failed or was canceled,
+	// "successful" if all succeeded and "unknown" otherwise
+	Status string `json:"status"`
+	// StatusCounts is a number of clients' jobs by their status
+	StatusCounts map[string]int `json:"status_counts"`
+}
+
 type MultiJobResult struct {
 	Status string     `json:"status"`
 	StdErr string     `json:"stderr"`
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// signedJobData holds job fields that are covered by a job signature.
+type signedJobData struct {
+	JID         string  `json:"jid"`
+	ClientID    string  `json:"client_id"`
+	MultiJobID  *string `json:"multi_job_id"`
+	Command     string  `json:"command"`
+	Interpreter string  `json:"interpreter"`
+	Cwd         string  `json:"cwd"`
+	IsSudo      bool    `json:"is_sudo"`
+	IsScript    bool    `json:"is_script"`
+	TimeoutSec  int     `json:"timeout_sec"`
+	Umask       string  `json:"umask"`
+	// Env is omitted if empty to keep signatures of jobs without env compatible
+	Env map[string]string `json:"env,omitempty"`
+	// RunAs is omitted if empty for the same reason
+	RunAs string `json:"run_as,omitempty"`
+	// StdinSHA256 is a hex encoded sha256 of the stdin, omitted if there is no stdin
+	StdinSHA256 string    `json:"stdin_sha256,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+func (j *Job) signedData() ([]byte, error) {
+	var stdinSHA256 string
+	if j.Stdin != "" {
+		sum := sha256.Sum256([]byte(j.Stdin))
+		stdinSHA256 = hex.EncodeToString(sum[:])
+	}
+	var expiresAt time.Time
+	if j.SignatureExpiresAt != nil {
+		expiresAt = j.SignatureExpiresAt.UTC()
+	}
+	return json.Marshal(signedJobData{
+		JID:         j.JID,
+		ClientID:    j.ClientID,
+		MultiJobID:  j.MultiJobID,
+		Command:     j.Command,
+		Interpreter: j.Interpreter,
+		Cwd:         j.Cwd,
+		IsSudo:      j.IsSudo,
+		IsScript:    j.IsScript,
+		TimeoutSec:  j.TimeoutSec,
+		Umask:       j.Umask,
+		Env:         j.Env,
+		RunAs:       j.RunAs,
+		StdinSHA256: stdinSHA256,
+		ExpiresAt:   expiresAt,
+	})
+}
+
+// Sign sets a base64 encoded ed25519 signature of fields that define what and how the job executes.
+// The signature is valid until a given time, so a captured job can't be replayed later.
+func (j *Job) Sign(key ed25519.PrivateKey, expiresAt time.Time) error {
+	expiresAt = expiresAt.UTC()
+	j.SignatureExpiresAt = &expiresAt
+	data, err := j.signedData()
+	if err != nil {
+		return err
+	}
+	j.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, data))
+	return nil
+}
+
+// VerifySignature returns an error if the job isn't signed, its signature doesn't match a given public key
+// or it's expired at a given time.
+func (j *Job) VerifySignature(key ed25519.PublicKey, now time.Time) error {
+	if j.Signature == "" {
+		return errors.New("command is not signed")
+	}
+	if j.SignatureExpiresAt == nil {
+		return errors.New("command signature has no expiration time")
+	}
+	sig, err := base64.StdEncoding.DecodeString(j.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid command signature: %v", err)
+	}
+	data, err := j.signedData()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(key, data, sig) {
+		return errors.New("invalid command signature")
+	}
+	if now.After(*j.SignatureExpiresAt) {
+		return errors.New("command signature is expired")
+	}
+	return nil
+}
+
+// ReadEd25519PrivateKey reads a PEM encoded PKCS #8 ed25519 private key,
+// e.g. generated by "openssl genpkey -algorithm ed25519".
+func ReadEd25519PrivateKey(path string) (ed25519.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key %q: %v", path, err)
+	}
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key %q is not an ed25519 key", path)
+	}
+	return edKey, nil
+}
+
+// ReadEd25519PublicKey reads a PEM encoded PKIX ed25519 public key,
+// e.g. generated by "openssl pkey -in private.pem -pubout".
+func ReadEd25519PublicKey(path string) (ed25519.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %q: %v", path, err)
+	}
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("public key %q is not an ed25519 key", path)
+	}
+	return edKey, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key: %v", err)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %q", path)
+	}
+	return block, nil
+}
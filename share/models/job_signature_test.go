@@ -0,0 +1,78 @@
+package models
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writePEM(t *testing.T, dir, name, blockType string, der []byte) string {
+	path := filepath.Join(dir, name)
+	err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)
+	require.NoError(t, err)
+	return path
+}
+
+func TestJobSignature(t *testing.T) {
+	dir, err := ioutil.TempDir("", "job-signature")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	require.NoError(t, err)
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+
+	gotPriv, err := ReadEd25519PrivateKey(writePEM(t, dir, "private.pem", "PRIVATE KEY", privDER))
+	require.NoError(t, err)
+	gotPub, err := ReadEd25519PublicKey(writePEM(t, dir, "public.pem", "PUBLIC KEY", pubDER))
+	require.NoError(t, err)
+
+	job := &Job{
+		JobSummary: JobSummary{JID: "1234"},
+		ClientID:   "client-1",
+		Command:    "/bin/date",
+	}
+	now := time.Date(2021, 5, 1, 12, 0, 0, 0, time.UTC)
+	assert.EqualError(t, job.VerifySignature(gotPub, now), "command is not signed")
+
+	require.NoError(t, job.Sign(gotPriv, now.Add(time.Minute)))
+	assert.NotEmpty(t, job.Signature)
+	assert.NoError(t, job.VerifySignature(gotPub, now))
+	assert.EqualError(t, job.VerifySignature(gotPub, now.Add(2*time.Minute)), "command signature is expired")
+
+	// fields not covered by the signature
+	job.CreatedBy = "admin"
+	job.Status = JobStatusRunning
+	assert.NoError(t, job.VerifySignature(gotPub, now))
+
+	job.Stdin = "data"
+	assert.EqualError(t, job.VerifySignature(gotPub, now), "invalid command signature")
+	job.Stdin = ""
+
+	extended := now.Add(time.Hour)
+	job.SignatureExpiresAt = &extended
+	assert.EqualError(t, job.VerifySignature(gotPub, now), "invalid command signature")
+
+	job.SignatureExpiresAt = nil
+	assert.EqualError(t, job.VerifySignature(gotPub, now), "command signature has no expiration time")
+
+	require.NoError(t, job.Sign(gotPriv, now.Add(time.Minute)))
+	job.IsSudo = true
+	assert.EqualError(t, job.VerifySignature(gotPub, now), "invalid command signature")
+
+	_, err = ReadEd25519PublicKey(filepath.Join(dir, "private.pem"))
+	assert.Error(t, err)
+	_, err = ReadEd25519PrivateKey(filepath.Join(dir, "missing.pem"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// Schedule is a command or script that is executed on clients periodically by a cron expression.
+type Schedule struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	CreatedBy string    `json:"created_by"`
+	// Cron is a cron expression of 5 fields: minute, hour, day of month, month and day of week.
+	Cron        string   `json:"cron"`
+	ClientIDs   []string `json:"client_ids"`
+	GroupIDs    []string `json:"group_ids"`
+	Command     string   `json:"command"`
+	Interpreter string   `json:"interpreter"`
+	Cwd         string   `json:"cwd"`
+	IsSudo      bool     `json:"is_sudo"`
+	IsScript    bool     `json:"is_script"`
+	IsTemplate  bool     `json:"is_template"`
+	TimeoutSec  int      `json:"timeout_sec"`
+	Concurrent  bool     `json:"execute_concurrently"`
+	AbortOnErr  bool     `json:"abort_on_error"`
+	// LastRunAt and LastMultiJobID are set when the schedule is triggered.
+	LastRunAt      *time.Time `json:"last_run_at"`
+	LastMultiJobID string     `json:"last_multi_job_id"`
+}
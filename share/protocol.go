@@ -1,8 +1,10 @@
 package chshare
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"time"
 )
 
 // ConnectionRequest represents configuration options when initiating client-server connection
@@ -29,7 +31,36 @@ type ConnectionRequest struct {
 	IPv4                   []string
 	IPv6                   []string
 	Tags                   []string
-	Remotes                []*Remote
+	Environment            string
+	CommandsDisabled       bool
+	// PackageManager is a type of a package manager detected by the client, e.g. "apt", empty if none is supported
+	PackageManager string
+	// Interpreters are named interpreters available on the client, e.g. "powershell". nil if the client doesn't report them
+	Interpreters []string
+	// BootTime is a time when the client system was booted, zero if unknown
+	BootTime time.Time
+	// AcceptsPushedConfig tells the server to reply with ConnectionResponse that can contain a pushed config.
+	AcceptsPushedConfig bool
+	// AcceptsUDPTunnels tells the server that the client relays datagrams of UDP tunnels.
+	AcceptsUDPTunnels bool
+	Remotes           []*Remote
+}
+
+// ConnectionResponse is a reply to a connection request of a client that accepts a pushed config.
+// Other clients get only a list of remotes.
+type ConnectionResponse struct {
+	Remotes []*Remote `json:"remotes"`
+	// Config is a client config pushed by the server, empty if there is nothing to push.
+	Config json.RawMessage `json:"config,omitempty"`
+}
+
+// DecodeConnectionResponse decodes a reply to a connection request, both a ConnectionResponse and a list of remotes.
+func DecodeConnectionResponse(b []byte) (*ConnectionResponse, error) {
+	resp := &ConnectionResponse{}
+	if trimmed := bytes.TrimSpace(b); len(trimmed) > 0 && trimmed[0] == '[' {
+		return resp, json.Unmarshal(b, &resp.Remotes)
+	}
+	return resp, json.Unmarshal(b, resp)
 }
 
 func DecodeConnectionRequest(b []byte) (*ConnectionRequest, error) {
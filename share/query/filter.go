@@ -9,20 +9,36 @@ import (
 	errors2 "github.com/cloudradar-monitoring/rport/server/api/errors"
 )
 
-var filterRegex = regexp.MustCompile(`^filter\[(\w+)]`)
+var filterRegex = regexp.MustCompile(`^filter\[(\w+)](?:\[(\w+)])?`)
+
+// filter operators, filters without an operator match equal values
+const (
+	FilterOperatorGreaterThan = "gt"
+	FilterOperatorLessThan    = "lt"
+)
 
 type FilterOption struct {
 	Column string
-	Values []string
+	// Operator is set if a filter is given as filter[column][operator], e.g. filter[duration][gt]=300
+	Operator string
+	Values   []string
+}
+
+// Key returns a name of a filter as it has to be listed in supported fields, e.g. "duration[gt]" for a filter with an operator.
+func (f FilterOption) Key() string {
+	if f.Operator == "" {
+		return f.Column
+	}
+	return f.Column + "[" + f.Operator + "]"
 }
 
 func ValidateFilterOptions(fo []FilterOption, supportedFields map[string]bool) errors2.APIErrors {
 	errs := errors2.APIErrors{}
 	for i := range fo {
-		ok := supportedFields[fo[i].Column]
+		ok := supportedFields[fo[i].Key()]
 		if !ok {
 			errs = append(errs, errors2.APIError{
-				Message:    fmt.Sprintf("unsupported filter field '%s'", fo[i].Column),
+				Message:    fmt.Sprintf("unsupported filter field '%s'", fo[i].Key()),
 				HTTPStatus: http.StatusBadRequest,
 			})
 		}
@@ -60,8 +76,9 @@ func ExtractFilterOptions(req *http.Request) []FilterOption {
 		}
 
 		fo := FilterOption{
-			Column: filterColumn,
-			Values: orValues,
+			Column:   filterColumn,
+			Operator: matches[2],
+			Values:   orValues,
 		}
 
 		res = append(res, fo)
@@ -32,6 +32,30 @@ func TestGetListOptions(t *testing.T) {
 				Fields:  []FieldsOption{},
 			},
 		},
+		{
+			name:       "filter_with_operator",
+			inputQuery: "filter[duration][gt]=300&filter[duration][lt]=600,900&filter[status]=failed",
+			expectedListOptions: &ListOptions{
+				Sorts: []SortOption{},
+				Filters: []FilterOption{
+					{
+						Column:   "duration",
+						Operator: "gt",
+						Values:   []string{"300"},
+					},
+					{
+						Column:   "duration",
+						Operator: "lt",
+						Values:   []string{"600", "900"},
+					},
+					{
+						Column: "status",
+						Values: []string{"failed"},
+					},
+				},
+				Fields: []FieldsOption{},
+			},
+		},
 		{
 			name:       "all_possible_sorts_and_filters",
 			inputQuery: "sort=date&sort=-user&filter[field1]=val1&filter[field1]=val2,val3&filter[field2]=value2,value3&fields[res1]=f1,f2&fields[res2]=f1,f3",
@@ -119,6 +143,11 @@ func TestValidateListOptionsWithErrors(t *testing.T) {
 				Column: "f5",
 				Values: []string{"v1", "v2"},
 			},
+			{
+				Column:   "f3",
+				Operator: "gt",
+				Values:   []string{"1"},
+			},
 		},
 		Fields: []FieldsOption{
 			{
@@ -133,7 +162,7 @@ func TestValidateListOptionsWithErrors(t *testing.T) {
 	}
 
 	err := ValidateListOptions(options, supportedSortAndFilters, supportedFields)
-	assert.Equal(t, err.Error(), `unsupported sort field 'f5', unsupported filter field 'f5', unsupported field "f3" for resource "res1", unsupported resource in fields: "res2"`)
+	assert.Equal(t, err.Error(), `unsupported sort field 'f5', unsupported filter field 'f5', unsupported filter field 'f3[gt]', unsupported field "f3" for resource "res1", unsupported resource in fields: "res2"`)
 }
 
 func TestValidateListOptionsOk(t *testing.T) {
@@ -0,0 +1,66 @@
+package query
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	errors2 "github.com/cloudradar-monitoring/rport/server/api/errors"
+)
+
+const (
+	paginationLimit  = "page[limit]"
+	paginationOffset = "page[offset]"
+)
+
+// Pagination holds a max number of items to return and a number of items to skip.
+type Pagination struct {
+	Limit  int
+	Offset int
+}
+
+// ExtractPagination parses page[limit] and page[offset] query params. The limit defaults to a given default limit
+// and can't exceed a given max limit.
+func ExtractPagination(req *http.Request, defaultLimit, maxLimit int) (*Pagination, error) {
+	p := &Pagination{
+		Limit: defaultLimit,
+	}
+	q := req.URL.Query()
+
+	if v := q.Get(paginationLimit); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxLimit {
+			return nil, errors2.APIError{
+				Message:    fmt.Sprintf("invalid %s %q, expected a number from 1 to %d", paginationLimit, v, maxLimit),
+				HTTPStatus: http.StatusBadRequest,
+			}
+		}
+		p.Limit = limit
+	}
+
+	if v := q.Get(paginationOffset); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			return nil, errors2.APIError{
+				Message:    fmt.Sprintf("invalid %s %q, expected a non-negative number", paginationOffset, v),
+				HTTPStatus: http.StatusBadRequest,
+			}
+		}
+		p.Offset = offset
+	}
+
+	return p, nil
+}
+
+// Bounds returns start and end indexes of the page in a list of a given length. A zero limit means no limit.
+func (p *Pagination) Bounds(total int) (start, end int) {
+	start = p.Offset
+	if start > total {
+		start = total
+	}
+	end = total
+	if p.Limit > 0 && start+p.Limit < total {
+		end = start + p.Limit
+	}
+	return start, end
+}
@@ -0,0 +1,126 @@
+package query
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractPagination(t *testing.T) {
+	testCases := []struct {
+		name       string
+		inputQuery string
+		want       *Pagination
+		wantErr    string
+	}{
+		{
+			name: "defaults",
+			want: &Pagination{Limit: 10, Offset: 0},
+		},
+		{
+			name:       "limit and offset",
+			inputQuery: "page[limit]=5&page[offset]=20",
+			want:       &Pagination{Limit: 5, Offset: 20},
+		},
+		{
+			name:       "max limit",
+			inputQuery: "page[limit]=100",
+			want:       &Pagination{Limit: 100, Offset: 0},
+		},
+		{
+			name:       "limit exceeds max",
+			inputQuery: "page[limit]=101",
+			wantErr:    `invalid page[limit] "101", expected a number from 1 to 100`,
+		},
+		{
+			name:       "zero limit",
+			inputQuery: "page[limit]=0",
+			wantErr:    `invalid page[limit] "0", expected a number from 1 to 100`,
+		},
+		{
+			name:       "invalid offset",
+			inputQuery: "page[offset]=abc",
+			wantErr:    `invalid page[offset] "abc", expected a non-negative number`,
+		},
+		{
+			name:       "negative offset",
+			inputQuery: "page[offset]=-1",
+			wantErr:    `invalid page[offset] "-1", expected a non-negative number`,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			req := &http.Request{URL: &url.URL{RawQuery: tc.inputQuery}}
+
+			got, err := ExtractPagination(req, 10, 100)
+
+			if tc.wantErr != "" {
+				require.EqualError(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestPaginationBounds(t *testing.T) {
+	testCases := []struct {
+		name       string
+		pagination Pagination
+		total      int
+		wantStart  int
+		wantEnd    int
+	}{
+		{
+			name:       "no limit",
+			pagination: Pagination{},
+			total:      5,
+			wantStart:  0,
+			wantEnd:    5,
+		},
+		{
+			name:       "first page",
+			pagination: Pagination{Limit: 2},
+			total:      5,
+			wantStart:  0,
+			wantEnd:    2,
+		},
+		{
+			name:       "last page",
+			pagination: Pagination{Limit: 2, Offset: 4},
+			total:      5,
+			wantStart:  4,
+			wantEnd:    5,
+		},
+		{
+			name:       "offset without limit",
+			pagination: Pagination{Offset: 3},
+			total:      5,
+			wantStart:  3,
+			wantEnd:    5,
+		},
+		{
+			name:       "offset beyond total",
+			pagination: Pagination{Limit: 2, Offset: 10},
+			total:      5,
+			wantStart:  5,
+			wantEnd:    5,
+		},
+	}
+
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			start, end := tc.pagination.Bounds(tc.total)
+
+			assert.Equal(t, tc.wantStart, start)
+			assert.Equal(t, tc.wantEnd, end)
+		})
+	}
+}
@@ -2,9 +2,12 @@ package chshare
 
 import (
 	"errors"
+	"fmt"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // short-hand conversions
@@ -20,19 +23,58 @@ import (
 //   192.168.0.1:3000:google.com:80 ->
 //     local  192.168.0.1:3000
 //     remote google.com:80
+//   3000/udp:8.8.8.8:53/udp ->
+//     local  127.0.0.1:3000 udp
+//     remote 8.8.8.8:53 udp
 
 const ZeroHost = "0.0.0.0"
 
+// Protocols of tunnels.
+const (
+	ProtocolTCP = "tcp"
+	ProtocolUDP = "udp"
+)
+
 // TODO(m-terel): Remote should be only used for parsing command args and URL query params. Current Remote is kind of a Tunnel model. Refactor to use separate models for representation and business logic.
 type Remote struct {
 	LocalHost          string  `json:"lhost"`
 	LocalPort          string  `json:"lport"`
 	RemoteHost         string  `json:"rhost"`
 	RemotePort         string  `json:"rport"`
+	Protocol           string  `json:"protocol"`
 	LocalPortRandom    bool    `json:"lport_random"`
 	Scheme             *string `json:"scheme"`
 	ACL                *string `json:"acl"` // string representation of Tunnel.TunnelACL field
 	IdleTimeoutMinutes int     `json:"idle_timeout_minutes"`
+	// MaxLifetimeMinutes is a period after which the tunnel is closed regardless of its activity, 0 if unlimited.
+	MaxLifetimeMinutes int `json:"max_lifetime_minutes,omitempty"`
+	// ExpiresAt is when the max lifetime of the tunnel ends, it's kept when the tunnel is re-established. Nil if unlimited.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// Backends is set only when the tunnel forwards to more than one destination. The first backend always matches RemoteHost:RemotePort.
+	Backends []*Backend `json:"backends,omitempty"`
+	// AuthUser is set if HTTP basic auth is required by a proxy in front of an http or https tunnel.
+	AuthUser string `json:"auth_user,omitempty"`
+	// AuthPasswordHash is a bcrypt hash of the basic auth password, the password itself is never stored.
+	// It's not exposed with the tunnel, the clients storage keeps it apart.
+	AuthPasswordHash string `json:"-"`
+}
+
+// Backend is a single destination of a tunnel with multiple remotes.
+type Backend struct {
+	Host   string `json:"host"`
+	Port   string `json:"port"`
+	Weight int    `json:"weight"`
+}
+
+func (b *Backend) Address() string {
+	return b.Host + ":" + b.Port
+}
+
+func (b *Backend) String() string {
+	if b.Weight <= 1 {
+		return b.Address()
+	}
+	return b.Address() + "*" + strconv.Itoa(b.Weight)
 }
 
 func DecodeRemote(s string) (*Remote, error) {
@@ -43,7 +85,16 @@ func DecodeRemote(s string) (*Remote, error) {
 
 	r := &Remote{}
 	for i := len(parts) - 1; i >= 0; i-- {
-		p := parts[i]
+		p, protocol, err := splitPortProtocol(parts[i])
+		if err != nil {
+			return nil, err
+		}
+		if protocol != "" {
+			if r.Protocol != "" && r.Protocol != protocol {
+				return nil, errors.New("Protocols of local and remote ports don't match")
+			}
+			r.Protocol = protocol
+		}
 		if isPort(p) {
 			if r.RemotePort == "" {
 				r.RemotePort = p
@@ -70,9 +121,25 @@ func DecodeRemote(s string) (*Remote, error) {
 	if r.RemoteHost == "" {
 		r.RemoteHost = ZeroHost
 	}
+	if r.Protocol == "" {
+		r.Protocol = ProtocolTCP
+	}
 	return r, nil
 }
 
+// splitPortProtocol splits a protocol suffix off a port, e.g. "53/udp". Parts that are not ports are returned as is.
+func splitPortProtocol(s string) (string, string, error) {
+	i := strings.LastIndex(s, "/")
+	if i < 0 || !isPort(s[:i]) {
+		return s, "", nil
+	}
+	protocol := strings.ToLower(s[i+1:])
+	if protocol != ProtocolTCP && protocol != ProtocolUDP {
+		return "", "", fmt.Errorf("Invalid protocol %q, expected %q or %q", s[i+1:], ProtocolTCP, ProtocolUDP)
+	}
+	return s[:i], protocol, nil
+}
+
 var isPortRegExp = regexp.MustCompile(`^\d+$`)
 
 func isPort(s string) bool {
@@ -86,7 +153,14 @@ func isHost(s string) bool {
 
 //implement Stringer
 func (r *Remote) String() string {
-	s := r.LocalHost + ":" + r.LocalPort + ":" + r.Remote()
+	s := r.LocalHost + ":" + r.LocalPort + r.protocolSuffix() + ":" + r.Remote() + r.protocolSuffix()
+	if len(r.Backends) > 0 {
+		backends := make([]string, 0, len(r.Backends))
+		for _, b := range r.Backends {
+			backends = append(backends, b.String())
+		}
+		s += "(backends:" + strings.Join(backends, ",") + ")"
+	}
 	if r.ACL == nil {
 		return s
 	}
@@ -97,6 +171,65 @@ func (r *Remote) Remote() string {
 	return r.RemoteHost + ":" + r.RemotePort
 }
 
+// IsUDP returns true if the tunnel forwards UDP datagrams. Remotes without a protocol are TCP.
+func (r *Remote) IsUDP() bool {
+	return r.Protocol == ProtocolUDP
+}
+
+// protocolSuffix returns a suffix of ports in a string representation of a remote. It's empty for TCP.
+func (r *Remote) protocolSuffix() string {
+	if r.IsUDP() {
+		return "/" + ProtocolUDP
+	}
+	return ""
+}
+
+// SetBackends sets destinations of a tunnel. The first one becomes the main remote. Weights are optional, a missing weight means 1.
+func (r *Remote) SetBackends(remotes []*Remote, weights []int) error {
+	if len(remotes) == 0 {
+		return errors.New("at least one backend is required")
+	}
+	if len(weights) > 0 && len(weights) != len(remotes) {
+		return fmt.Errorf("expected %d weight(s), got %d", len(remotes), len(weights))
+	}
+
+	r.RemoteHost = remotes[0].RemoteHost
+	r.RemotePort = remotes[0].RemotePort
+	r.Backends = nil
+	if len(remotes) == 1 {
+		return nil
+	}
+
+	for i, cur := range remotes {
+		weight := 1
+		if len(weights) > 0 {
+			weight = weights[i]
+		}
+		if weight < 1 {
+			return fmt.Errorf("invalid weight %d for backend %s: should be a positive number", weight, cur.Remote())
+		}
+		r.Backends = append(r.Backends, &Backend{
+			Host:   cur.RemoteHost,
+			Port:   cur.RemotePort,
+			Weight: weight,
+		})
+	}
+	return nil
+}
+
+// GetBackends returns all destinations of a tunnel.
+func (r *Remote) GetBackends() []*Backend {
+	if len(r.Backends) > 0 {
+		return r.Backends
+	}
+	return []*Backend{{Host: r.RemoteHost, Port: r.RemotePort, Weight: 1}}
+}
+
+// HasBasicAuth returns true if the tunnel is guarded by HTTP basic auth.
+func (r *Remote) HasBasicAuth() bool {
+	return r.AuthUser != ""
+}
+
 func (r *Remote) Equals(other *Remote) bool {
 	return r.String() == other.String()
 }
@@ -111,6 +244,11 @@ func (r *Remote) EqualACL(acl *string) bool {
 	return false
 }
 
+// IsExpired returns true if the max lifetime of the tunnel has ended.
+func (r *Remote) IsExpired() bool {
+	return r.ExpiresAt != nil && !r.ExpiresAt.After(time.Now())
+}
+
 func (r *Remote) IsLocalSpecified() bool {
 	return r.LocalHost != "" && r.LocalPort != ""
 }
@@ -1,6 +1,7 @@
 package security
 
 import (
+	"fmt"
 	"sync"
 	"time"
 
@@ -11,6 +12,20 @@ type BanList struct {
 	banDuration time.Duration
 	mu          sync.RWMutex
 	visitors    map[string]time.Time
+
+	// store is nil if bans are kept only in memory
+	store  BanStore
+	logger *chshare.Logger
+}
+
+// BanStore persists bans, so they survive restarts.
+type BanStore interface {
+	// GetAll returns expiry times of all stored bans by visitor keys
+	GetAll() (map[string]time.Time, error)
+	// Save creates a new or updates an existing ban of a given visitor
+	Save(visitorKey string, expiresAt time.Time) error
+	// Delete removes a ban of a given visitor if it exists
+	Delete(visitorKey string) error
 }
 
 func NewBanList(banDuration time.Duration) *BanList {
@@ -20,10 +35,38 @@ func NewBanList(banDuration time.Duration) *BanList {
 	}
 }
 
+// NewPersistentBanList returns a ban list that loads active bans from a given store and writes new bans to it.
+// Lookups are served from memory.
+func NewPersistentBanList(banDuration time.Duration, store BanStore, logger *chshare.Logger) (*BanList, error) {
+	stored, err := store.GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load bans: %v", err)
+	}
+
+	l := NewBanList(banDuration)
+	l.store = store
+	l.logger = logger
+	now := time.Now()
+	for visitorKey, banExpiry := range stored {
+		if banExpiry.After(now) {
+			l.visitors[visitorKey] = banExpiry
+		}
+	}
+	return l, nil
+}
+
 func (l *BanList) Add(visitorKey string) {
+	banExpiry := time.Now().Add(l.banDuration)
 	l.mu.Lock()
-	defer l.mu.Unlock()
-	l.visitors[visitorKey] = time.Now().Add(l.banDuration)
+	l.visitors[visitorKey] = banExpiry
+	l.mu.Unlock()
+
+	// write to the store without holding the lock to not block lookups
+	if l.store != nil {
+		if err := l.store.Save(visitorKey, banExpiry); err != nil && l.logger != nil {
+			l.logger.Errorf("Failed to store ban of visitor (%s): %v", visitorKey, err)
+		}
+	}
 }
 
 func (l *BanList) IsBanned(visitorKey string) bool {
@@ -40,6 +83,9 @@ type MaxBadAttemptsBanList struct {
 	mu             sync.RWMutex
 	visitors       map[string]*visitor
 	logger         *chshare.Logger
+
+	// store is nil if bans are kept only in memory
+	store BanStore
 }
 
 type visitor struct {
@@ -56,8 +102,40 @@ func NewMaxBadAttemptsBanList(maxBadAttempts int, banDuration time.Duration, log
 	}
 }
 
+// NewPersistentMaxBadAttemptsBanList returns a ban list that loads active bans from a given store and writes new bans
+// to it. Counts of bad attempts are kept only in memory.
+func NewPersistentMaxBadAttemptsBanList(maxBadAttempts int, banDuration time.Duration, store BanStore, logger *chshare.Logger) (*MaxBadAttemptsBanList, error) {
+	stored, err := store.GetAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load bans: %v", err)
+	}
+
+	l := NewMaxBadAttemptsBanList(maxBadAttempts, banDuration, logger)
+	l.store = store
+	now := time.Now()
+	for visitorKey, banExpiry := range stored {
+		if banExpiry.After(now) {
+			banTime := banExpiry
+			l.visitors[visitorKey] = &visitor{banTime: &banTime}
+		}
+	}
+	return l, nil
+}
+
 // AddBadAttempt registers a bad attempt of a visitor.
 func (l *MaxBadAttemptsBanList) AddBadAttempt(visitorKey string) {
+	banTime := l.addBadAttempt(visitorKey)
+
+	// write to the store without holding the lock to not block lookups
+	if banTime != nil && l.store != nil {
+		if err := l.store.Save(visitorKey, *banTime); err != nil && l.logger != nil {
+			l.logger.Errorf("Failed to store ban of visitor (%s): %v", visitorKey, err)
+		}
+	}
+}
+
+// addBadAttempt registers a bad attempt of a visitor and returns a ban expiry if the visitor got banned by it.
+func (l *MaxBadAttemptsBanList) addBadAttempt(visitorKey string) *time.Time {
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
@@ -76,19 +154,27 @@ func (l *MaxBadAttemptsBanList) AddBadAttempt(visitorKey string) {
 		}
 		v.banTime = &t
 		v.badAttempts = 0
+		return &t
 	}
+	return nil
 }
 
-// AddBadAttempt registers a successful attempt of a visitor.
+// AddSuccessAttempt registers a successful attempt of a visitor.
 func (l *MaxBadAttemptsBanList) AddSuccessAttempt(visitorKey string) {
 	l.mu.Lock()
-	defer l.mu.Unlock()
-
 	v, found := l.visitors[visitorKey]
+	wasBanned := found && v.banTime != nil
 	if found {
 		v.badAttempts = 0
 		v.banTime = nil
 	}
+	l.mu.Unlock()
+
+	if wasBanned && l.store != nil {
+		if err := l.store.Delete(visitorKey); err != nil && l.logger != nil {
+			l.logger.Errorf("Failed to delete stored ban of visitor (%s): %v", visitorKey, err)
+		}
+	}
 }
 
 // IsBanned checks whether a given visitor is banned or not.
@@ -98,3 +184,80 @@ func (l *MaxBadAttemptsBanList) IsBanned(visitorKey string) bool {
 	v, found := l.visitors[visitorKey]
 	return found && v.banTime != nil && v.banTime.After(time.Now())
 }
+
+// MaxRateBanList bans visitors by their keys for Z period after more than N attempts within a given interval.
+type MaxRateBanList struct {
+	maxAttempts int
+	interval    time.Duration
+	banDuration time.Duration
+	mu          sync.Mutex
+	visitors    map[string]*rateVisitor
+	logger      *chshare.Logger
+	now         func() time.Time
+	lastCleanup time.Time
+}
+
+type rateVisitor struct {
+	windowStart time.Time
+	attempts    int
+	banTime     time.Time
+}
+
+func NewMaxRateBanList(maxAttempts int, interval, banDuration time.Duration, logger *chshare.Logger) *MaxRateBanList {
+	return &MaxRateBanList{
+		maxAttempts: maxAttempts,
+		interval:    interval,
+		banDuration: banDuration,
+		visitors:    make(map[string]*rateVisitor),
+		logger:      logger,
+		now:         time.Now,
+	}
+}
+
+// AddAttempt registers an attempt of a visitor and returns false if the visitor is banned.
+func (l *MaxRateBanList) AddAttempt(visitorKey string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastCleanup) >= l.interval {
+		l.cleanup(now)
+	}
+
+	v, found := l.visitors[visitorKey]
+	if !found {
+		v = &rateVisitor{windowStart: now}
+		l.visitors[visitorKey] = v
+	}
+
+	if v.banTime.After(now) {
+		return false
+	}
+
+	if now.Sub(v.windowStart) >= l.interval {
+		v.windowStart = now
+		v.attempts = 0
+	}
+
+	v.attempts++
+	if v.attempts > l.maxAttempts {
+		v.banTime = now.Add(l.banDuration)
+		v.attempts = 0
+		if l.logger != nil {
+			l.logger.Infof("Maximum of %d connection attempts per %s exceeded. Visitor (%s) banned. Ban expiry: %s", l.maxAttempts, l.interval, visitorKey, v.banTime.Format(time.RFC3339))
+		}
+		return false
+	}
+
+	return true
+}
+
+// cleanup removes visitors which are neither banned nor have attempts within the current interval.
+func (l *MaxRateBanList) cleanup(now time.Time) {
+	for key, v := range l.visitors {
+		if !v.banTime.After(now) && now.Sub(v.windowStart) >= l.interval {
+			delete(l.visitors, key)
+		}
+	}
+	l.lastCleanup = now
+}
@@ -0,0 +1,118 @@
+package security
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxRateBanList(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	l := NewMaxRateBanList(3, time.Minute, 5*time.Minute, nil)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, l.AddAttempt("1.1.1.1"), "attempt %d", i+1)
+	}
+	assert.False(t, l.AddAttempt("1.1.1.1"), "rate exceeded")
+	assert.True(t, l.AddAttempt("2.2.2.2"), "other visitor is not affected")
+
+	// the ban outlasts the interval
+	now = now.Add(2 * time.Minute)
+	assert.False(t, l.AddAttempt("1.1.1.1"), "still banned")
+
+	now = now.Add(4 * time.Minute)
+	assert.True(t, l.AddAttempt("1.1.1.1"), "ban expired")
+	assert.NotContains(t, l.visitors, "2.2.2.2", "inactive visitors are cleaned up")
+}
+
+func TestMaxRateBanListResetsAttemptsAfterInterval(t *testing.T) {
+	now := time.Date(2021, 6, 1, 12, 0, 0, 0, time.UTC)
+	l := NewMaxRateBanList(2, time.Minute, 5*time.Minute, nil)
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 5; i++ {
+		assert.True(t, l.AddAttempt("1.1.1.1"))
+		assert.True(t, l.AddAttempt("1.1.1.1"))
+		now = now.Add(time.Minute)
+	}
+}
+
+type banStoreMock struct {
+	bans map[string]time.Time
+}
+
+func (s *banStoreMock) GetAll() (map[string]time.Time, error) {
+	res := make(map[string]time.Time, len(s.bans))
+	for k, v := range s.bans {
+		res[k] = v
+	}
+	return res, nil
+}
+
+func (s *banStoreMock) Save(visitorKey string, expiresAt time.Time) error {
+	s.bans[visitorKey] = expiresAt
+	return nil
+}
+
+func (s *banStoreMock) Delete(visitorKey string) error {
+	delete(s.bans, visitorKey)
+	return nil
+}
+
+func TestPersistentBanList(t *testing.T) {
+	store := &banStoreMock{bans: map[string]time.Time{
+		"active":  time.Now().Add(time.Hour),
+		"expired": time.Now().Add(-time.Hour),
+	}}
+
+	l, err := NewPersistentBanList(time.Minute, store, nil)
+	require.NoError(t, err)
+	assert.True(t, l.IsBanned("active"))
+	assert.False(t, l.IsBanned("expired"))
+	assert.NotContains(t, l.visitors, "expired")
+
+	l.Add("new")
+	assert.True(t, l.IsBanned("new"))
+	assert.Contains(t, store.bans, "new")
+
+	// simulate a restart
+	restarted, err := NewPersistentBanList(time.Minute, store, nil)
+	require.NoError(t, err)
+	assert.True(t, restarted.IsBanned("active"))
+	assert.True(t, restarted.IsBanned("new"))
+	assert.False(t, restarted.IsBanned("unknown"))
+}
+
+func TestPersistentMaxBadAttemptsBanList(t *testing.T) {
+	store := &banStoreMock{bans: map[string]time.Time{
+		"1.1.1.1": time.Now().Add(time.Hour),
+		"2.2.2.2": time.Now().Add(-time.Hour),
+	}}
+
+	l, err := NewPersistentMaxBadAttemptsBanList(2, time.Minute, store, nil)
+	require.NoError(t, err)
+	assert.True(t, l.IsBanned("1.1.1.1"))
+	assert.False(t, l.IsBanned("2.2.2.2"))
+	assert.NotContains(t, l.visitors, "2.2.2.2")
+
+	l.AddBadAttempt("3.3.3.3")
+	assert.False(t, l.IsBanned("3.3.3.3"))
+	assert.NotContains(t, store.bans, "3.3.3.3", "bad attempts are not stored")
+	l.AddBadAttempt("3.3.3.3")
+	assert.True(t, l.IsBanned("3.3.3.3"))
+	assert.Contains(t, store.bans, "3.3.3.3")
+
+	// simulate a restart
+	restarted, err := NewPersistentMaxBadAttemptsBanList(2, time.Minute, store, nil)
+	require.NoError(t, err)
+	assert.True(t, restarted.IsBanned("1.1.1.1"))
+	assert.True(t, restarted.IsBanned("3.3.3.3"))
+	assert.False(t, restarted.IsBanned("4.4.4.4"))
+
+	restarted.AddSuccessAttempt("3.3.3.3")
+	assert.False(t, restarted.IsBanned("3.3.3.3"))
+	assert.NotContains(t, store.bans, "3.3.3.3")
+}
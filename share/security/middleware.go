@@ -21,3 +21,21 @@ func RejectBannedIPs(f http.Handler, bannedIPs *MaxBadAttemptsBanList) http.Hand
 		f.ServeHTTP(w, r)
 	}
 }
+
+// RejectRateLimitedIPs refuses requests from IPs that exceeded the allowed rate of attempts.
+func RejectRateLimitedIPs(f http.Handler, rateLimitedIPs *MaxRateBanList) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to split host port for %q: %v", r.RemoteAddr, err), http.StatusInternalServerError)
+			return
+		}
+
+		if !rateLimitedIPs.AddAttempt(ip) {
+			http.Error(w, "Too many connection attempts. Please try later.", http.StatusTooManyRequests)
+			return
+		}
+
+		f.ServeHTTP(w, r)
+	}
+}
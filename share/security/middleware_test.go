@@ -0,0 +1,35 @@
+package security
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRejectRateLimitedIPs(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	h := RejectRateLimitedIPs(ok, NewMaxRateBanList(5, time.Minute, time.Hour, nil))
+
+	connect := func(remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusOK, connect("192.0.2.1:4000"), "attempt %d", i+1)
+	}
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusTooManyRequests, connect("192.0.2.1:4000"))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, connect("192.0.2.1:5000"), "limit applies per IP regardless of port")
+	assert.Equal(t, http.StatusOK, connect("192.0.2.2:4000"), "other IP is not affected")
+	assert.Equal(t, http.StatusInternalServerError, connect("invalid"))
+}
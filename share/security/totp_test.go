@@ -0,0 +1,94 @@
+package security
+
+import (
+	"encoding/base32"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfc6238Secret is the SHA1 test secret of RFC 6238, Appendix B
+var rfc6238Secret = base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestTOTPCode(t *testing.T) {
+	// the last 6 digits of the 8 digit RFC 6238 test vectors
+	testCases := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+		{unix: 20000000000, want: "353130"},
+	}
+
+	for _, tc := range testCases {
+		got, err := TOTPCode(rfc6238Secret, time.Unix(tc.unix, 0))
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, got, "time %d", tc.unix)
+	}
+
+	_, err := TOTPCode("not base32!", time.Now())
+	assert.Error(t, err)
+}
+
+func TestValidateTOTPCode(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	testCases := []struct {
+		name     string
+		code     string
+		want     bool
+		wantStep int64
+	}{
+		{name: "current step", code: "081804", want: true, wantStep: 37037036},
+		{name: "previous step", code: mustTOTPCode(t, now.Add(-TOTPPeriod)), want: true, wantStep: 37037035},
+		{name: "next step", code: mustTOTPCode(t, now.Add(TOTPPeriod)), want: true, wantStep: 37037037},
+		{name: "two steps ago", code: mustTOTPCode(t, now.Add(-2*TOTPPeriod))},
+		{name: "two steps ahead", code: mustTOTPCode(t, now.Add(2*TOTPPeriod))},
+		{name: "wrong code", code: "123456"},
+		{name: "wrong length", code: "81804"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gotStep, got, err := ValidateTOTPCode(rfc6238Secret, tc.code, now, 1)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+			assert.Equal(t, tc.wantStep, gotStep)
+		})
+	}
+}
+
+func TestNewTOTPSecretAndURI(t *testing.T) {
+	secret, err := NewTOTPSecret()
+	require.NoError(t, err)
+	assert.Len(t, secret, 32)
+
+	code, err := TOTPCode(secret, time.Now())
+	require.NoError(t, err)
+	assert.Len(t, code, TOTPDigits)
+
+	u, err := url.Parse(TOTPURI("Rport", "admin", secret))
+	require.NoError(t, err)
+	assert.Equal(t, "otpauth", u.Scheme)
+	assert.Equal(t, "totp", u.Host)
+	assert.Equal(t, "/Rport:admin", u.Path)
+	assert.Equal(t, url.Values{
+		"secret":    {secret},
+		"issuer":    {"Rport"},
+		"algorithm": {"SHA1"},
+		"digits":    {"6"},
+		"period":    {"30"},
+	}, u.Query())
+}
+
+func mustTOTPCode(t *testing.T, at time.Time) string {
+	code, err := TOTPCode(rfc6238Secret, at)
+	require.NoError(t, err)
+	return code
+}
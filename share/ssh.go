@@ -43,13 +43,25 @@ func FingerprintKey(k ssh.PublicKey) string {
 	return strings.Join(strbytes, ":")
 }
 
-func HandleTCPStream(l *Logger, connStats *ConnStats, src io.ReadWriteCloser, remote string) {
+// HandleTCPChannel dials the remote requested by a given channel and pipes the data between them.
+// The channel is rejected if the remote can't be dialed, so the other side can try another destination.
+func HandleTCPChannel(l *Logger, connStats *ConnStats, ch ssh.NewChannel) {
+	remote := string(ch.ExtraData())
 	dst, err := net.Dial("tcp", remote)
 	if err != nil {
 		l.Debugf("Remote failed (%s)", err)
-		src.Close()
+		if rejectErr := ch.Reject(ssh.ConnectionFailed, err.Error()); rejectErr != nil {
+			l.Debugf("Failed to reject stream: %s", rejectErr)
+		}
 		return
 	}
+	src, reqs, err := ch.Accept()
+	if err != nil {
+		l.Debugf("Failed to accept stream: %s", err)
+		dst.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
 	connStats.Open()
 	l.Debugf("%s: Open", connStats)
 	s, r := Pipe(src, dst)
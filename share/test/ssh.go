@@ -20,6 +20,7 @@ type ConnMock struct {
 	inputRequestName string
 	inputWantReply   bool
 	inputPayload     []byte
+	closed           bool
 }
 
 func NewConnMock() *ConnMock {
@@ -47,3 +48,16 @@ func (c *ConnMock) InputSendRequest() (name string, wantReply bool, payload []by
 func (c *ConnMock) RemoteAddr() net.Addr {
 	return c.ReturnRemoteAddr
 }
+
+func (c *ConnMock) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *ConnMock) IsClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
@@ -0,0 +1,114 @@
+package chshare
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/jpillora/sizestr"
+	"golang.org/x/crypto/ssh"
+)
+
+// UDPChannelType is a type of ssh channels that relay datagrams of UDP tunnels.
+// The extra data of the channel is a destination address to send the datagrams to.
+const UDPChannelType = "rport-udp"
+
+// MaxDatagramSize is the max size of a datagram payload that can be relayed.
+const MaxDatagramSize = 65535
+
+// datagramHeaderSize is a size of the length prefix of a datagram frame.
+const datagramHeaderSize = 2
+
+// WriteDatagram writes a datagram to a stream as a frame: a 2-byte big-endian payload length followed by the payload.
+func WriteDatagram(w io.Writer, payload []byte) error {
+	if len(payload) > MaxDatagramSize {
+		return fmt.Errorf("datagram size %d exceeds the limit of %d bytes", len(payload), MaxDatagramSize)
+	}
+	frame := make([]byte, datagramHeaderSize+len(payload))
+	binary.BigEndian.PutUint16(frame, uint16(len(payload)))
+	copy(frame[datagramHeaderSize:], payload)
+	_, err := w.Write(frame)
+	return err
+}
+
+// ReadDatagram reads a datagram frame written by WriteDatagram. The payload is read into a given buffer
+// which should be at least MaxDatagramSize long.
+func ReadDatagram(r io.Reader, buf []byte) ([]byte, error) {
+	var header [datagramHeaderSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	size := int(binary.BigEndian.Uint16(header[:]))
+	if size > len(buf) {
+		return nil, fmt.Errorf("datagram size %d exceeds the buffer size %d", size, len(buf))
+	}
+	if _, err := io.ReadFull(r, buf[:size]); err != nil {
+		return nil, err
+	}
+	return buf[:size], nil
+}
+
+// HandleUDPChannel relays datagrams between a given channel and the UDP destination requested by the channel.
+// The relay stops when the channel is closed.
+func HandleUDPChannel(l *Logger, connStats *ConnStats, ch ssh.NewChannel) {
+	remote := string(ch.ExtraData())
+	dst, err := net.Dial("udp", remote)
+	if err != nil {
+		l.Debugf("Remote failed (%s)", err)
+		if rejectErr := ch.Reject(ssh.ConnectionFailed, err.Error()); rejectErr != nil {
+			l.Debugf("Failed to reject stream: %s", rejectErr)
+		}
+		return
+	}
+	src, reqs, err := ch.Accept()
+	if err != nil {
+		l.Debugf("Failed to accept stream: %s", err)
+		dst.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	connStats.Open()
+	l.Debugf("%s: Open udp", connStats)
+	s, r := RelayDatagrams(src, dst)
+	connStats.Close()
+	l.Debugf("%s: Close udp (sent %s received %s)", connStats, sizestr.ToString(s), sizestr.ToString(r))
+}
+
+// RelayDatagrams sends datagrams read from a stream to a connected UDP socket and frames datagrams received
+// from the socket back to the stream until either of them fails. It returns sizes of payloads sent to the socket
+// and received from it.
+func RelayDatagrams(stream io.ReadWriteCloser, conn net.Conn) (int64, int64) {
+	var sent, received int64
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		buf := make([]byte, MaxDatagramSize)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			if err := WriteDatagram(stream, buf[:n]); err != nil {
+				return
+			}
+			received += int64(n)
+		}
+	}()
+
+	buf := make([]byte, MaxDatagramSize)
+	for {
+		payload, err := ReadDatagram(stream, buf)
+		if err != nil {
+			break
+		}
+		if _, err := conn.Write(payload); err != nil {
+			break
+		}
+		sent += int64(len(payload))
+	}
+	stream.Close()
+	conn.Close()
+	<-done
+	return sent, received
+}
@@ -0,0 +1,31 @@
+package chshare
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDatagramFraming(t *testing.T) {
+	stream, peer := net.Pipe()
+	defer stream.Close()
+	defer peer.Close()
+
+	payloads := [][]byte{[]byte("first"), {}, make([]byte, MaxDatagramSize)}
+	go func() {
+		for _, p := range payloads {
+			assert.NoError(t, WriteDatagram(peer, p))
+		}
+	}()
+
+	buf := make([]byte, MaxDatagramSize)
+	for _, want := range payloads {
+		got, err := ReadDatagram(stream, buf)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	assert.EqualError(t, WriteDatagram(peer, make([]byte, MaxDatagramSize+1)), "datagram size 65536 exceeds the limit of 65535 bytes")
+}